@@ -0,0 +1,420 @@
+// Package archive implements a read only backend which shows the
+// members of a zip or tar archive stored on another remote as files.
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/archive"
+)
+
+var (
+	errorReadOnly = errors.New("archive remotes are read only")
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "archive",
+		Description: "Read archives (zip, tar, tar.gz)",
+		NewFs:       NewFs,
+		MetadataInfo: &fs.MetadataInfo{
+			System: map[string]fs.MetadataHelp{
+				"mode": {
+					Help:     "File type and mode",
+					Type:     "octal, unix style",
+					Example:  "0100664",
+					ReadOnly: true,
+				},
+				"mtime": {
+					Help:     "Time of last modification",
+					Type:     "RFC 3339",
+					Example:  "2006-01-02T15:04:05.999999999Z07:00",
+					ReadOnly: true,
+				},
+			},
+			Help: `The mode and modification time stored in the archive are read as metadata.`,
+		},
+		Options: []fs.Option{{
+			Name: "remote",
+			Help: `Remote path of the archive to read.
+
+Normally should contain a ':' and a path to a file, e.g.
+"myremote:path/to/archive.zip".`,
+			Required: true,
+		}, {
+			Name: "format",
+			Help: `Format of the archive.
+
+If not set the format is worked out from the extension of the archive.`,
+			Examples: []fs.OptionExample{{
+				Value: "",
+				Help:  "Work out the format from the file extension.",
+			}, {
+				Value: "zip",
+				Help:  "Zip archive.",
+			}, {
+				Value: "tar",
+				Help:  "Uncompressed tar archive.",
+			}, {
+				Value: "tar.gz",
+				Help:  "Gzip compressed tar archive.",
+			}},
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote string `config:"remote"`
+	Format string `config:"format"`
+}
+
+// Fs represents the members of an archive as a read only file system
+type Fs struct {
+	name     string
+	root     string
+	opt      Options
+	features *fs.Features                // optional features
+	archive  *archive.Archive            // index of the archive
+	src      fs.Object                   // the archive object
+	dirs     map[string]*archive.Entry   // directories keyed on path within archive
+	children map[string][]*archive.Entry // directory listings keyed on path within archive
+	files    map[string]*archive.Entry   // files keyed on path within archive
+}
+
+// Object describes a member of the archive
+type Object struct {
+	fs     *Fs
+	remote string
+	e      *archive.Entry
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point archive remote at itself - check the value of the remote setting")
+	}
+	var format archive.Format
+	if opt.Format != "" {
+		err = format.Set(opt.Format)
+	} else {
+		format, err = archive.FormatFromName(opt.Remote)
+	}
+	if err != nil {
+		return nil, err
+	}
+	parent, leaf, err := fspath.Split(opt.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse remote %q: %w", opt.Remote, err)
+	}
+	if leaf == "" {
+		return nil, fmt.Errorf("remote %q must point to an archive file", opt.Remote)
+	}
+	if parent == "" {
+		parent = "."
+	}
+	srcFs, err := cache.Get(ctx, parent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make remote %q: %w", parent, err)
+	}
+	src, err := srcFs.NewObject(ctx, leaf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find archive %q: %w", opt.Remote, err)
+	}
+	a, err := archive.New(ctx, src, format)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fs{
+		name:    name,
+		root:    strings.Trim(root, "/"),
+		opt:     *opt,
+		archive: a,
+		src:     src,
+	}
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+		ReadMetadata:            true,
+	}).Fill(ctx, f)
+	f.index(ctx)
+
+	// Check to see if the root is a file
+	if _, isFile := f.files[f.root]; isFile {
+		f.root = path.Dir(f.root)
+		if f.root == "." {
+			f.root = ""
+		}
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// index builds the directory listings from the archive entries
+//
+// Directories which are implied by the paths of entries but which
+// don't have an entry of their own are given the modification time
+// of the archive.
+func (f *Fs) index(ctx context.Context) {
+	modTime := f.src.ModTime(ctx)
+	f.dirs = map[string]*archive.Entry{}
+	f.children = map[string][]*archive.Entry{"": nil}
+	f.files = map[string]*archive.Entry{}
+	// Record explicit directories first so their times are used
+	for _, e := range f.archive.Entries {
+		if e.IsDir {
+			f.dirs[e.Path] = e
+		}
+	}
+	var addDir func(dir string)
+	addDir = func(dir string) {
+		if _, found := f.children[dir]; found {
+			return
+		}
+		f.children[dir] = nil
+		e, found := f.dirs[dir]
+		if !found {
+			e = &archive.Entry{
+				Path:    dir,
+				ModTime: modTime,
+				IsDir:   true,
+			}
+			f.dirs[dir] = e
+		}
+		parent := parentDir(dir)
+		addDir(parent)
+		f.children[parent] = append(f.children[parent], e)
+	}
+	for _, e := range f.archive.Entries {
+		if e.IsDir {
+			addDir(e.Path)
+			continue
+		}
+		if _, found := f.files[e.Path]; found {
+			fs.Logf(f, "Ignoring duplicate entry %q in archive", e.Path)
+			continue
+		}
+		if _, found := f.dirs[e.Path]; found {
+			fs.Logf(f, "Ignoring file %q in archive which has the same name as a directory", e.Path)
+			continue
+		}
+		f.files[e.Path] = e
+		parent := parentDir(e.Path)
+		addDir(parent)
+		f.children[parent] = append(f.children[parent], e)
+	}
+}
+
+// parentDir returns the parent directory of p or "" for the root
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("archive %s:%s", f.name, f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return time.Second
+}
+
+// Hashes returns the supported hash sets.
+//
+// Zip archives store a CRC-32 of each member.
+func (f *Fs) Hashes() hash.Set {
+	if f.archive.Format() == archive.FormatZip {
+		return hash.Set(hash.CRC32)
+	}
+	return hash.Set(hash.None)
+}
+
+// archivePath returns the path within the archive of remote
+func (f *Fs) archivePath(remote string) string {
+	return strings.Trim(path.Join(f.root, remote), "/")
+}
+
+// fsPath returns the path relative to the root of the Fs of
+// archivePath
+func (f *Fs) fsPath(archivePath string) string {
+	if f.root == "" {
+		return archivePath
+	}
+	return strings.TrimPrefix(archivePath, f.root+"/")
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	children, found := f.children[f.archivePath(dir)]
+	if !found {
+		return nil, fs.ErrorDirNotFound
+	}
+	entries = make(fs.DirEntries, 0, len(children))
+	for _, e := range children {
+		if e.IsDir {
+			entries = append(entries, fs.NewDir(f.fsPath(e.Path), e.ModTime))
+		} else {
+			entries = append(entries, f.newObject(e))
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	archivePath := f.archivePath(remote)
+	e, found := f.files[archivePath]
+	if !found {
+		if _, isDir := f.children[archivePath]; isDir {
+			return nil, fs.ErrorIsDir
+		}
+		return nil, fs.ErrorObjectNotFound
+	}
+	return f.newObject(e), nil
+}
+
+// newObject makes an Object from an archive entry
+func (f *Fs) newObject(e *archive.Entry) *Object {
+	return &Object{
+		fs:     f,
+		remote: f.fsPath(e.Path),
+		e:      e,
+	}
+}
+
+// Put in to the remote path with the modTime given of the given size
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errorReadOnly
+}
+
+// Mkdir makes the directory (container, bucket)
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return errorReadOnly
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return errorReadOnly
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.fs
+}
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Hash returns the CRC-32 of zip members
+func (o *Object) Hash(ctx context.Context, t hash.Type) (string, error) {
+	if t != hash.CRC32 || !o.e.HasCRC {
+		return "", hash.ErrUnsupported
+	}
+	return fmt.Sprintf("%08x", o.e.CRC32), nil
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.e.Size
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.e.ModTime
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	return errorReadOnly
+}
+
+// Storable returns whether the object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Open opens the file for read. Call Close() on the returned io.ReadCloser
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	return o.e.Open(ctx, options...)
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return errorReadOnly
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	return errorReadOnly
+}
+
+// Metadata returns the mode and modification time of the member
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	return o.e.Metadata(), nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs         = (*Fs)(nil)
+	_ fs.Object     = (*Object)(nil)
+	_ fs.Metadataer = (*Object)(nil)
+)
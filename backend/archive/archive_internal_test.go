@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/archive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testModTime = time.Date(2023, 11, 12, 13, 14, 15, 0, time.UTC)
+
+// makeArchive writes an archive into a temporary directory and
+// returns its path
+func makeArchive(t *testing.T, name string) string {
+	format, err := archive.FormatFromName(name)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := archive.NewWriter(&buf, format)
+	for _, e := range []struct {
+		path    string
+		content string
+		isDir   bool
+	}{
+		{path: "empty", isDir: true},
+		{path: "top.txt", content: "top"},
+		{path: "a/b/deep.txt", content: "deep file"},
+		{path: "a/b/c.txt", content: "sea"},
+	} {
+		require.NoError(t, w.Add(&archive.Entry{
+			Path:    e.path,
+			Size:    int64(len(e.content)),
+			ModTime: testModTime,
+			Mode:    0640,
+			IsDir:   e.isDir,
+		}, bytes.NewBufferString(e.content)))
+	}
+	require.NoError(t, w.Close())
+	archivePath := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(archivePath, buf.Bytes(), 0600))
+	return archivePath
+}
+
+func TestArchiveBackend(t *testing.T) {
+	ctx := context.Background()
+	for _, name := range []string{"test.zip", "test.tar", "test.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			m := configmap.Simple{"remote": makeArchive(t, name)}
+			f, err := NewFs(ctx, "archive", "", m)
+			require.NoError(t, err)
+
+			var paths []string
+			err = walk.ListR(ctx, f, "", true, -1, walk.ListAll, func(entries fs.DirEntries) error {
+				for _, entry := range entries {
+					paths = append(paths, entry.Remote())
+				}
+				return nil
+			})
+			require.NoError(t, err)
+			sort.Strings(paths)
+			assert.Equal(t, []string{"a", "a/b", "a/b/c.txt", "a/b/deep.txt", "empty", "top.txt"}, paths)
+
+			o, err := f.NewObject(ctx, "a/b/deep.txt")
+			require.NoError(t, err)
+			assert.Equal(t, int64(9), o.Size())
+			assert.True(t, testModTime.Equal(o.ModTime(ctx)))
+			in, err := o.Open(ctx, &fs.RangeOption{Start: 5, End: -1})
+			require.NoError(t, err)
+			data, err := io.ReadAll(in)
+			require.NoError(t, err)
+			require.NoError(t, in.Close())
+			assert.Equal(t, "file", string(data))
+
+			metadata, err := fs.GetMetadata(ctx, o)
+			require.NoError(t, err)
+			assert.Equal(t, "100640", metadata["mode"])
+
+			if name == "test.zip" {
+				sum, err := o.Hash(ctx, hash.CRC32)
+				require.NoError(t, err)
+				assert.Equal(t, "c13bc252", sum)
+			}
+
+			_, err = f.NewObject(ctx, "a/b")
+			assert.Equal(t, fs.ErrorIsDir, err)
+			_, err = f.NewObject(ctx, "missing")
+			assert.Equal(t, fs.ErrorObjectNotFound, err)
+			_, err = f.List(ctx, "missing")
+			assert.Equal(t, fs.ErrorDirNotFound, err)
+			_, err = f.Put(ctx, bytes.NewBufferString("x"), o)
+			assert.Equal(t, errorReadOnly, err)
+
+			// Check a root pointing into the archive
+			sub, err := NewFs(ctx, "archive", "a/b", m)
+			require.NoError(t, err)
+			entries, err := sub.List(ctx, "")
+			require.NoError(t, err)
+			assert.Equal(t, 2, len(entries))
+
+			// Check a root pointing to a file
+			sub, err = NewFs(ctx, "archive", "a/b/c.txt", m)
+			assert.Equal(t, fs.ErrorIsFile, err)
+			assert.Equal(t, "a/b", sub.Root())
+			_, err = sub.NewObject(ctx, "c.txt")
+			require.NoError(t, err)
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -1982,6 +1983,7 @@ func increment(xs *[8]byte) {
 type azBlock struct {
 	chunkNumber int
 	id          string
+	staged      bool // set once the block has been staged
 }
 
 // Implements the fs.ChunkWriter interface
@@ -2060,6 +2062,98 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 	return info, chunkWriter, nil
 }
 
+// ResumeChunkWriter carries on the multipart upload described by
+// state which was started by OpenChunkWriter.
+//
+// Only the blocks in state which are still staged on the blob are
+// kept, the others will need writing again.
+func (f *Fs) ResumeChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, state fs.ChunkWriterState, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	// Temporary Object under construction
+	o := &Object{
+		fs:     f,
+		remote: remote,
+	}
+	ui, err := o.prepareUpload(ctx, src, options)
+	if err != nil {
+		return info, nil, fmt.Errorf("failed to prepare upload: %w", err)
+	}
+
+	// Read the sizes of the blocks staged on the blob
+	var resp blockblob.GetBlockListResponse
+	err = f.pacer.Call(func() (bool, error) {
+		resp, err = ui.blb.GetBlockList(ctx, blockblob.BlockListTypeUncommitted, nil)
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return info, nil, fmt.Errorf("failed to list staged blocks: %w", err)
+	}
+
+	chunkWriter := &azChunkWriter{
+		chunkSize: state.ChunkSize,
+		size:      src.Size(),
+		f:         f,
+		ui:        ui,
+		o:         o,
+	}
+	sizes := make(map[string]int64, len(resp.UncommittedBlocks))
+	var lastBlockID uint64
+	for _, block := range resp.UncommittedBlocks {
+		if block.Name == nil || block.Size == nil {
+			continue
+		}
+		sizes[*block.Name] = *block.Size
+		// Carry on numbering the blocks after the ones staged
+		// already so none of them are replaced
+		binaryBlockID, err := base64.StdEncoding.DecodeString(*block.Name)
+		if err == nil && len(binaryBlockID) == len(chunkWriter.binaryBlockID) {
+			if n := binary.LittleEndian.Uint64(binaryBlockID); n > lastBlockID {
+				lastBlockID = n
+			}
+		}
+	}
+	binary.LittleEndian.PutUint64(chunkWriter.binaryBlockID[:], lastBlockID)
+	for chunkNumber, blockID := range state.Chunks {
+		size := chunkWriter.chunkSize
+		if remaining := chunkWriter.size - int64(chunkNumber)*size; remaining < size {
+			size = remaining
+		}
+		if staged, ok := sizes[blockID]; !ok || staged != size {
+			fs.Debugf(o, "resume chunk writer: block for chunk %d missing or changed so will upload again", chunkNumber+1)
+			continue
+		}
+		chunkWriter.blocks = append(chunkWriter.blocks, azBlock{
+			chunkNumber: chunkNumber,
+			id:          blockID,
+			staged:      true,
+		})
+	}
+	info = fs.ChunkWriterInfo{
+		ChunkSize:   state.ChunkSize,
+		Concurrency: o.fs.opt.UploadConcurrency,
+	}
+	fs.Debugf(o, "resume chunk writer: resumed multipart upload with %d blocks", len(chunkWriter.blocks))
+	return info, chunkWriter, nil
+}
+
+// ChunkWriterState returns the state of the multipart upload so far
+//
+// Azure has no upload ID as the blocks are staged on the blob
+// itself. The record of each chunk is the ID of its block.
+func (w *azChunkWriter) ChunkWriterState() fs.ChunkWriterState {
+	w.blocksMu.Lock()
+	defer w.blocksMu.Unlock()
+	state := fs.ChunkWriterState{
+		ChunkSize: w.chunkSize,
+		Chunks:    make(map[int]string, len(w.blocks)),
+	}
+	for _, block := range w.blocks {
+		if block.staged {
+			state.Chunks[block.chunkNumber] = block.id
+		}
+	}
+	return state
+}
+
 // WriteChunk will write chunk number with reader bytes, where chunk number >= 0
 func (w *azChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (int64, error) {
 	if chunkNumber < 0 {
@@ -2084,12 +2178,23 @@ func (w *azChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader
 	increment(&w.binaryBlockID)
 	blockID := base64.StdEncoding.EncodeToString(w.binaryBlockID[:])
 
-	// Save the blockID for the commit
+	// Save the blockID for the commit, replacing the block of a
+	// chunk written before
 	w.blocksMu.Lock()
-	w.blocks = append(w.blocks, azBlock{
-		chunkNumber: chunkNumber,
-		id:          blockID,
-	})
+	replaced := false
+	for i := range w.blocks {
+		if w.blocks[i].chunkNumber == chunkNumber {
+			w.blocks[i].id = blockID
+			w.blocks[i].staged = false
+			replaced = true
+		}
+	}
+	if !replaced {
+		w.blocks = append(w.blocks, azBlock{
+			chunkNumber: chunkNumber,
+			id:          blockID,
+		})
+	}
 	w.blocksMu.Unlock()
 
 	err = w.f.pacer.Call(func() (bool, error) {
@@ -2116,6 +2221,14 @@ func (w *azChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader
 		return -1, fmt.Errorf("failed to upload chunk %d with %v bytes: %w", chunkNumber+1, currentChunkSize, err)
 	}
 
+	w.blocksMu.Lock()
+	for i := range w.blocks {
+		if w.blocks[i].id == blockID {
+			w.blocks[i].staged = true
+		}
+	}
+	w.blocksMu.Unlock()
+
 	fs.Debugf(w.o, "multipart upload wrote chunk %d with %v bytes", chunkNumber+1, currentChunkSize)
 	return currentChunkSize, err
 }
@@ -2425,14 +2538,16 @@ func parseTier(tier string) *blob.AccessTier {
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = &Fs{}
-	_ fs.Copier          = &Fs{}
-	_ fs.PutStreamer     = &Fs{}
-	_ fs.Purger          = &Fs{}
-	_ fs.ListRer         = &Fs{}
-	_ fs.OpenChunkWriter = &Fs{}
-	_ fs.Object          = &Object{}
-	_ fs.MimeTyper       = &Object{}
-	_ fs.GetTierer       = &Object{}
-	_ fs.SetTierer       = &Object{}
+	_ fs.Fs                = &Fs{}
+	_ fs.Copier            = &Fs{}
+	_ fs.PutStreamer       = &Fs{}
+	_ fs.Purger            = &Fs{}
+	_ fs.ListRer           = &Fs{}
+	_ fs.OpenChunkWriter   = &Fs{}
+	_ fs.ResumeChunkWriter = &Fs{}
+	_ fs.ChunkWriterStater = &azChunkWriter{}
+	_ fs.Object            = &Object{}
+	_ fs.MimeTyper         = &Object{}
+	_ fs.GetTierer         = &Object{}
+	_ fs.SetTierer         = &Object{}
 )
@@ -2097,13 +2097,50 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 		return info, nil, err
 	}
 
+	up, err := f.newLargeUpload(ctx, o, nil, src, f.opt.ChunkSize, false, nil)
+	if err != nil {
+		return info, nil, err
+	}
+	// Use the chunk size of the upload which is bigger than
+	// --b2-chunk-size for files which would need too many parts,
+	// so the chunks match the parts the state records on resume
 	info = fs.ChunkWriterInfo{
-		ChunkSize:   int64(f.opt.ChunkSize),
+		ChunkSize:   up.chunkSize,
 		Concurrency: o.fs.opt.UploadConcurrency,
 		//LeavePartsOnError: o.fs.opt.LeavePartsOnError,
 	}
-	up, err := f.newLargeUpload(ctx, o, nil, src, f.opt.ChunkSize, false, nil)
-	return info, up, err
+	return info, up, nil
+}
+
+// ResumeChunkWriter carries on the large file upload described by
+// state which was started by OpenChunkWriter.
+//
+// Only the parts in state which are still present in the upload are
+// kept, the others will need writing again.
+func (f *Fs) ResumeChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, state fs.ChunkWriterState, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	if f.opt.Versions {
+		return info, nil, errNotWithVersions
+	}
+	if f.opt.VersionAt.IsSet() {
+		return info, nil, errNotWithVersionAt
+	}
+
+	// Temporary Object under construction
+	o := &Object{
+		fs:     f,
+		remote: remote,
+	}
+
+	info = fs.ChunkWriterInfo{
+		ChunkSize:   state.ChunkSize,
+		Concurrency: o.fs.opt.UploadConcurrency,
+	}
+	up, err := f.resumeLargeUpload(ctx, o, src, state)
+	if err != nil {
+		return info, nil, err
+	}
+	fs.Debugf(o, "resume chunk writer: resumed large file upload %v with %d parts", state.ID, len(up.ChunkWriterState().Chunks))
+	return info, up, nil
 }
 
 // Remove an object
@@ -2264,16 +2301,18 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = &Fs{}
-	_ fs.Purger          = &Fs{}
-	_ fs.Copier          = &Fs{}
-	_ fs.PutStreamer     = &Fs{}
-	_ fs.CleanUpper      = &Fs{}
-	_ fs.ListRer         = &Fs{}
-	_ fs.PublicLinker    = &Fs{}
-	_ fs.OpenChunkWriter = &Fs{}
-	_ fs.Commander       = &Fs{}
-	_ fs.Object          = &Object{}
-	_ fs.MimeTyper       = &Object{}
-	_ fs.IDer            = &Object{}
+	_ fs.Fs                = &Fs{}
+	_ fs.Purger            = &Fs{}
+	_ fs.Copier            = &Fs{}
+	_ fs.PutStreamer       = &Fs{}
+	_ fs.CleanUpper        = &Fs{}
+	_ fs.ListRer           = &Fs{}
+	_ fs.PublicLinker      = &Fs{}
+	_ fs.OpenChunkWriter   = &Fs{}
+	_ fs.ResumeChunkWriter = &Fs{}
+	_ fs.ChunkWriterStater = &largeUpload{}
+	_ fs.Commander         = &Fs{}
+	_ fs.Object            = &Object{}
+	_ fs.MimeTyper         = &Object{}
+	_ fs.IDer              = &Object{}
 )
@@ -164,6 +164,81 @@ func (f *Fs) newLargeUpload(ctx context.Context, o *Object, in io.Reader, src fs
 	return up, nil
 }
 
+// resumeLargeUpload carries on the upload of object o described by
+// state which was started by newLargeUpload
+//
+// Only the parts in state which are still present in the upload are
+// kept, the others will need uploading again.
+func (f *Fs) resumeLargeUpload(ctx context.Context, o *Object, src fs.ObjectInfo, state fs.ChunkWriterState) (up *largeUpload, err error) {
+	// Read the SHA1s of the parts in the upload
+	sha1s := map[int64]string{}
+	opts := rest.Opts{
+		Method: "POST",
+		Path:   "/b2_list_parts",
+	}
+	var request = api.ListPartsRequest{
+		ID:           state.ID,
+		MaxPartCount: 1000,
+	}
+	for {
+		var response api.ListPartsResponse
+		err = f.pacer.Call(func() (bool, error) {
+			resp, err := f.srv.CallJSON(ctx, &opts, &request, &response)
+			return f.shouldRetry(ctx, resp, err)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts of large file %q: %w", state.ID, err)
+		}
+		for _, part := range response.Parts {
+			sha1s[part.PartNumber] = part.SHA1
+		}
+		if response.NextPartNumber == nil {
+			break
+		}
+		request.StartPartNumber = *response.NextPartNumber
+	}
+
+	size := src.Size()
+	up = &largeUpload{
+		f:         f,
+		o:         o,
+		what:      "upload",
+		id:        state.ID,
+		size:      size,
+		parts:     int((size + state.ChunkSize - 1) / state.ChunkSize),
+		sha1s:     make([]string, 0, 16),
+		chunkSize: state.ChunkSize,
+	}
+	up.in, up.wrap = accounting.UnWrap(nil)
+	for chunkNumber, sha1 := range state.Chunks {
+		if sha1 == "" || sha1s[int64(chunkNumber+1)] != sha1 {
+			fs.Debugf(o, "resume chunk writer: part %d missing or changed so will upload again", chunkNumber+1)
+			continue
+		}
+		up.addSha1(chunkNumber, sha1)
+	}
+	return up, nil
+}
+
+// ChunkWriterState returns the state of the large upload so far
+//
+// The record of each chunk is its SHA1 in hex.
+func (up *largeUpload) ChunkWriterState() fs.ChunkWriterState {
+	up.sha1smu.Lock()
+	defer up.sha1smu.Unlock()
+	state := fs.ChunkWriterState{
+		ID:        up.id,
+		ChunkSize: up.chunkSize,
+		Chunks:    make(map[int]string, len(up.sha1s)),
+	}
+	for chunkNumber, sha1 := range up.sha1s {
+		if sha1 != "" {
+			state.Chunks[chunkNumber] = sha1
+		}
+	}
+	return state
+}
+
 // getUploadURL returns the upload info with the UploadURL and the AuthorizationToken
 //
 // This should be returned with returnUploadURL when finished
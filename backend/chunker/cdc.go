@@ -0,0 +1,622 @@
+package chunker
+
+// Content defined chunking
+//
+// In the "fastcdc" chunking mode files are split at boundaries chosen
+// by their content using the FastCDC algorithm, so inserting or
+// deleting data only changes the chunks around the edit, not every
+// chunk after it.
+//
+// Data chunks are stored in a pool directory inside the wrapped
+// remote, named after the SHA-256 of their contents, so a chunk is
+// stored only once however many files or versions of a file contain
+// it. Chunker remotes wrapping the same remote share the pool.
+//
+// A composite file is represented by its meta object, which has the
+// "chunking" field set (metadata format version 3), and a control
+// chunk of type "cdc" holding the index - the list of pool chunks
+// making up the file. Removing a file removes its meta object and
+// index only, as the pool chunks may be used by other files. The "gc"
+// backend command removes pool chunks no index refers to.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	chunkingFixed   = "fixed"   // split files at multiples of chunk_size
+	chunkingFastCDC = "fastcdc" // split files with content defined chunking
+	cdcCtrlType     = "cdc"     // type of the control chunk holding the index
+	cdcIndexVersion = 1         // current/highest supported index format
+	cdcHashName     = "sha256"  // hash used to name pool chunks
+	cdcMinChunkSize = 256       // smallest allowed cdc_chunk_size
+)
+
+// gearTable maps each byte to a random value for the rolling hash.
+//
+// It must never change or files uploaded after the change won't share
+// chunks with files uploaded before it. The values are made by
+// splitmix64 with a fixed seed.
+var gearTable = func() (table [256]uint64) {
+	x := uint64(0x2545f4914f6cdd1d)
+	for i := range table {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// cdcSplitter splits a stream into chunks using FastCDC with
+// normalized chunking.
+//
+// Chunks are between a quarter and four times the average size. The
+// boundaries depend only on the data, not on how it is read.
+type cdcSplitter struct {
+	in      io.Reader
+	buf     []byte // holds maxSize bytes of input
+	start   int    // start of the unused data in buf
+	end     int    // end of the unused data in buf
+	err     error  // error from in, returned once buf is used up
+	minSize int
+	avgSize int
+	maxSize int
+	maskS   uint64 // mask making cuts before avgSize less likely
+	maskL   uint64 // mask making cuts after avgSize more likely
+}
+
+// newCDCSplitter makes a splitter reading from in with average chunk
+// size avgSize which must be a power of 2
+func newCDCSplitter(in io.Reader, avgSize int) *cdcSplitter {
+	avgBits := bits.Len(uint(avgSize)) - 1
+	return &cdcSplitter{
+		in:      in,
+		buf:     make([]byte, 4*avgSize),
+		minSize: avgSize / 4,
+		avgSize: avgSize,
+		maxSize: 4 * avgSize,
+		maskS:   ^uint64(0) << (64 - (avgBits + 2)),
+		maskL:   ^uint64(0) << (64 - (avgBits - 2)),
+	}
+}
+
+// fill tops up buf from the input
+func (s *cdcSplitter) fill() {
+	copy(s.buf, s.buf[s.start:s.end])
+	s.end -= s.start
+	s.start = 0
+	for s.end < len(s.buf) && s.err == nil {
+		var n int
+		n, s.err = s.in.Read(s.buf[s.end:])
+		s.end += n
+	}
+}
+
+// Next returns the next chunk, or io.EOF if there are no more.
+//
+// The chunk is only valid until the next call.
+func (s *cdcSplitter) Next() ([]byte, error) {
+	if s.end-s.start < s.maxSize && s.err == nil {
+		s.fill()
+	}
+	if s.err != nil && s.err != io.EOF {
+		return nil, s.err
+	}
+	if s.start == s.end {
+		return nil, io.EOF
+	}
+	n := s.cut(s.buf[s.start:s.end])
+	chunk := s.buf[s.start : s.start+n]
+	s.start += n
+	return chunk, nil
+}
+
+// More returns true if there is more data to read
+func (s *cdcSplitter) More() bool {
+	if s.start == s.end && s.err == nil {
+		s.fill()
+	}
+	return s.start != s.end
+}
+
+// cut returns the length of the chunk at the start of data
+func (s *cdcSplitter) cut(data []byte) int {
+	n := len(data)
+	if n <= s.minSize {
+		return n
+	}
+	if n > s.maxSize {
+		n = s.maxSize
+	}
+	normal := s.avgSize
+	if normal > n {
+		normal = n
+	}
+	var fp uint64
+	i := s.minSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&s.maskS == 0 {
+			return i
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&s.maskL == 0 {
+			return i
+		}
+	}
+	return n
+}
+
+// cdcIndex lists the pool chunks making up a file
+type cdcIndex struct {
+	Version int        `json:"ver"`
+	Hash    string     `json:"hash"` // hash naming the chunks
+	Chunks  []cdcChunk `json:"chunks"`
+}
+
+// cdcChunk is a pool chunk in a cdcIndex
+type cdcChunk struct {
+	Hash string `json:"h"`
+	Size int64  `json:"s"`
+}
+
+// poolChunkName returns the path in the pool of the chunk with the hash sum
+func poolChunkName(sum string) string {
+	return sum[:2] + "/" + sum
+}
+
+// isChunkHash returns true if sum looks like a chunk hash
+func isChunkHash(sum string) bool {
+	if len(sum) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil
+}
+
+// readCDCIndex reads and checks the index stored in o
+func readCDCIndex(ctx context.Context, o fs.Object) (*cdcIndex, error) {
+	reader, err := o.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(reader)
+	_ = reader.Close() // ensure file handle is freed on windows
+	if err != nil {
+		return nil, err
+	}
+	var index cdcIndex
+	err = json.Unmarshal(data, &index)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk index: %w", err)
+	}
+	if index.Version < 1 {
+		return nil, errors.New("invalid chunk index: wrong version")
+	}
+	if index.Version > cdcIndexVersion || index.Hash != cdcHashName {
+		return nil, ErrMetaUnknown
+	}
+	for _, chunk := range index.Chunks {
+		if !isChunkHash(chunk.Hash) || chunk.Size <= 0 {
+			return nil, errors.New("invalid chunk index: bad chunk")
+		}
+	}
+	return &index, nil
+}
+
+// setChunking sets up the chunking mode
+// must be called *after* setMetaFormat.
+func (f *Fs) setChunking(chunking string) error {
+	switch chunking {
+	case chunkingFixed:
+		f.useCDC = false
+	case chunkingFastCDC:
+		if !f.useMeta {
+			return errors.New("fastcdc chunking requires metadata")
+		}
+		size := f.opt.CDCChunkSize
+		if size < cdcMinChunkSize || size > math.MaxInt32 || size&(size-1) != 0 {
+			return fmt.Errorf("cdc_chunk_size must be a power of 2 between %d and 1 GiB", cdcMinChunkSize)
+		}
+		f.useCDC = true
+	default:
+		return fmt.Errorf("unsupported chunking '%s'", chunking)
+	}
+	return nil
+}
+
+// isPoolDir returns true if dir is the chunk pool
+func (f *Fs) isPoolDir(dir string) bool {
+	return strings.Trim(path.Join(f.root, dir), "/") == f.poolDir
+}
+
+// getPool returns the Fs of the chunk pool, making it if necessary
+func (f *Fs) getPool(ctx context.Context) (fs.Fs, error) {
+	f.poolMu.Lock()
+	defer f.poolMu.Unlock()
+	if f.pool == nil {
+		pool, err := cache.Get(ctx, f.poolRemote)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make chunk pool %q: %w", f.poolRemote, err)
+		}
+		f.pool = pool
+	}
+	return f.pool, nil
+}
+
+// putPoolChunk uploads data to the pool unless it is there already
+//
+// Chunks which are there already have their modification time
+// refreshed so gc doesn't remove them before the index of the file
+// being uploaded refers to them.
+func (f *Fs) putPoolChunk(ctx context.Context, pool fs.Fs, sum string, data []byte) error {
+	remote := poolChunkName(sum)
+	if o, err := pool.NewObject(ctx, remote); err == nil && o.Size() == int64(len(data)) {
+		// stored by this or another file already
+		err = o.SetModTime(ctx, time.Now())
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, fs.ErrorCantSetModTime) && !errors.Is(err, fs.ErrorCantSetModTimeWithoutDelete) {
+			return fmt.Errorf("failed to refresh chunk %s: %w", sum, err)
+		}
+		// upload it again to refresh it instead
+	}
+	info := object.NewStaticObjectInfo(remote, time.Now(), int64(len(data)), true, nil, pool)
+	_, err := pool.Put(ctx, bytes.NewReader(data), info)
+	if err != nil {
+		return fmt.Errorf("failed to upload chunk %s: %w", sum, err)
+	}
+	return nil
+}
+
+// putCDC implements put for content defined chunking
+func (f *Fs) putCDC(ctx context.Context, in io.Reader, src fs.ObjectInfo, remote string, options []fs.OpenOption, basePut putFn) (obj fs.Object, err error) {
+	pool, err := f.getPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The chunking reader does the hashing and accounting,
+	// the splitter chooses where the chunks end
+	c := f.newChunkingReader(src)
+	c.chunkLimit = math.MaxInt64
+	wrapIn := c.wrapStream(ctx, in, src)
+	splitter := newCDCSplitter(wrapIn, int(f.opt.CDCChunkSize))
+
+	var metaObject fs.Object
+	defer func() {
+		if err != nil {
+			c.rollback(ctx, metaObject)
+		}
+	}()
+
+	xactID, err := f.newXactID(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	// next returns a copy of the next chunk or nil at the end
+	next := func() ([]byte, error) {
+		chunk, err := splitter.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), chunk...), nil
+	}
+	data, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	// Store a file which fits in one chunk as a non-chunked file
+	// unless it looks like metadata or metadata is needed for hashes
+	if !splitter.More() {
+		if c.sizeTotal != -1 && c.readCount != c.sizeTotal {
+			return nil, fmt.Errorf("incorrect upload size %d != %d", c.readCount, c.sizeTotal)
+		}
+		_, madeByChunker, _ := unmarshalSimpleJSON(ctx, nil, data)
+		if !madeByChunker && !f.hashAll {
+			tempRemote := f.makeChunkName(remote, 0, "", xactID)
+			chunk, err := basePut(ctx, bytes.NewReader(data), f.wrapInfo(src, tempRemote, int64(len(data))), options...)
+			if err != nil {
+				return nil, err
+			}
+			c.chunks = append(c.chunks, chunk)
+			f.removeOldChunks(ctx, remote)
+			chunk, err = f.baseMove(ctx, chunk, remote, delAlways)
+			if err != nil {
+				return nil, err
+			}
+			return f.newObject("", chunk, nil), nil
+		}
+	}
+
+	// Upload the chunks the pool doesn't have yet
+	ci := fs.GetConfig(ctx)
+	index := cdcIndex{
+		Version: cdcIndexVersion,
+		Hash:    cdcHashName,
+		Chunks:  []cdcChunk{},
+	}
+	seen := map[string]bool{}
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(ci.Transfers)
+	for data != nil && gCtx.Err() == nil {
+		if len(index.Chunks) > maxSafeChunkNumber {
+			_ = g.Wait()
+			return nil, ErrChunkOverflow
+		}
+		sum := sha256.Sum256(data)
+		chunk := cdcChunk{
+			Hash: hex.EncodeToString(sum[:]),
+			Size: int64(len(data)),
+		}
+		index.Chunks = append(index.Chunks, chunk)
+		if !seen[chunk.Hash] {
+			seen[chunk.Hash] = true
+			chunkData := data
+			g.Go(func() error {
+				return f.putPoolChunk(gCtx, pool, chunk.Hash, chunkData)
+			})
+		}
+		data, err = next()
+		if err != nil {
+			_ = g.Wait()
+			return nil, err
+		}
+	}
+	err = g.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate uploaded size
+	if c.sizeTotal != -1 && c.readCount != c.sizeTotal {
+		return nil, fmt.Errorf("incorrect upload size %d != %d", c.readCount, c.sizeTotal)
+	}
+	var sizeTotal int64
+	for _, chunk := range index.Chunks {
+		sizeTotal += chunk.Size
+	}
+	if sizeTotal != c.readCount {
+		return nil, fmt.Errorf("incorrect chunks size %d != %d", sizeTotal, c.readCount)
+	}
+
+	// Upload the index as a temporary control chunk
+	indexData, err := json.Marshal(&index)
+	if err != nil {
+		return nil, err
+	}
+	indexRemote := f.makeChunkName(remote, -1, cdcCtrlType, xactID)
+	indexInfo := object.NewStaticObjectInfo(indexRemote, src.ModTime(ctx), int64(len(indexData)), true, nil, f)
+	indexObject, err := f.base.Put(ctx, bytes.NewReader(indexData), indexInfo)
+	if err != nil {
+		return nil, err
+	}
+	c.chunks = append(c.chunks, indexObject)
+
+	// If previous object was chunked, remove its chunks
+	f.removeOldChunks(ctx, remote)
+
+	if !f.useNoRename {
+		indexRemote = f.makeChunkName(remote, -1, cdcCtrlType, "")
+		indexObject, err = f.baseMove(ctx, indexObject, indexRemote, delFailed)
+		if err != nil {
+			return nil, err
+		}
+		c.chunks[len(c.chunks)-1] = indexObject
+		xactID = ""
+	}
+
+	// Update meta object
+	c.updateHashes()
+	metadata, err := marshalSimpleJSON(ctx, sizeTotal, len(index.Chunks), c.md5, c.sha1, xactID, chunkingFastCDC)
+	if err != nil {
+		return nil, err
+	}
+	metaInfo := f.wrapInfo(src, remote, int64(len(metadata)))
+	metaObject, err = basePut(ctx, bytes.NewReader(metadata), metaInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	o := f.newObject("", metaObject, nil)
+	o.cdcIndex = indexObject
+	o.size = sizeTotal
+	o.nChunks = len(index.Chunks)
+	o.xactID = xactID
+	return o, nil
+}
+
+// openCDC opens a file made by content defined chunking
+func (o *Object) openCDC(ctx context.Context, offset, limit int64, options []fs.OpenOption) (io.ReadCloser, error) {
+	pool, err := o.f.getPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	index, err := readCDCIndex(ctx, o.cdcIndex)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]int64, len(index.Chunks))
+	var total int64
+	for i, chunk := range index.Chunks {
+		sizes[i] = chunk.Size
+		total += chunk.Size
+	}
+	if total != o.size {
+		return nil, errors.New("chunk index doesn't match file size")
+	}
+	open := func(ctx context.Context, chunkNo int, options ...fs.OpenOption) (io.ReadCloser, error) {
+		sum := index.Chunks[chunkNo].Hash
+		chunk, err := pool.NewObject(ctx, poolChunkName(sum))
+		if err != nil {
+			return nil, fmt.Errorf("chunk %s missing from pool: %w", sum, err)
+		}
+		return chunk.Open(ctx, options...)
+	}
+	return newLinearReader(ctx, sizes, open, offset, limit, options)
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "gc",
+	Short: "Remove unused chunks from the chunk pool",
+	Long: `This removes the chunks in the pool used by content defined chunking
+which no file refers to any more.
+
+The whole of the wrapped remote is scanned for chunk indexes, so all
+chunker remotes sharing the pool must wrap the same remote and use the
+same name format. Chunks uploaded or reused recently are kept in case
+they belong to an upload which hasn't finished, so min-age should be
+longer than the longest upload.
+
+Usage Example:
+
+    rclone backend gc chunker:
+    rclone backend gc chunker: -o min-age=24h
+
+Use the --dry-run flag to see what would be removed. It returns
+statistics like this
+
+    {
+        "chunks": 10123,
+        "deleted": 200,
+        "deletedBytes": 209715200,
+        "indexes": 42,
+        "kept": 5
+    }
+`,
+	Opts: map[string]string{
+		"min-age": "Don't remove chunks uploaded more recently than this (default 1h)",
+	},
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "gc":
+		minAge := fs.Duration(time.Hour)
+		if value, ok := opt["min-age"]; ok {
+			err := minAge.Set(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid min-age: %w", err)
+			}
+		}
+		return f.gc(ctx, time.Duration(minAge))
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// gc removes the chunks in the pool older than minAge which aren't in
+// any chunk index under the root of the wrapped remote
+func (f *Fs) gc(ctx context.Context, minAge time.Duration) (map[string]int64, error) {
+	root, err := cache.Get(ctx, f.rootRemote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make wrapped remote %q: %w", f.rootRemote, err)
+	}
+	poolPrefix := f.poolDir + "/"
+	var indexes, chunks []fs.Object
+	err = walk.ListR(ctx, root, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			remote := o.Remote()
+			if strings.HasPrefix(remote, poolPrefix) {
+				chunks = append(chunks, o)
+			} else if _, _, ctrlType, _ := f.parseChunkName(remote); ctrlType == cdcCtrlType {
+				indexes = append(indexes, o)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wrapped remote: %w", err)
+	}
+
+	// Any error reading an index must abort as it could lead to
+	// removing chunks which are in use
+	used := map[string]bool{}
+	for _, o := range indexes {
+		index, err := readCDCIndex(ctx, o)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk index %q: %w", o.Remote(), err)
+		}
+		for _, chunk := range index.Chunks {
+			used[chunk.Hash] = true
+		}
+	}
+
+	var (
+		deleted, deletedBytes, kept int64
+		deleteErr                   error
+		wg                          sync.WaitGroup
+	)
+	toBeDeleted := make(fs.ObjectsChan, fs.GetConfig(ctx).Checkers)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		deleteErr = operations.DeleteFiles(ctx, toBeDeleted)
+	}()
+	cutoff := time.Now().Add(-minAge)
+	for _, o := range chunks {
+		sum := path.Base(o.Remote())
+		if !isChunkHash(sum) || used[sum] {
+			continue
+		}
+		if o.ModTime(ctx).After(cutoff) {
+			kept++
+			continue
+		}
+		deleted++
+		deletedBytes += o.Size()
+		toBeDeleted <- o
+	}
+	close(toBeDeleted)
+	wg.Wait()
+	return map[string]int64{
+		"indexes":      int64(len(indexes)),
+		"chunks":       int64(len(chunks)),
+		"deleted":      deleted,
+		"deletedBytes": deletedBytes,
+		"kept":         kept,
+	}, deleteErr
+}
@@ -76,6 +76,8 @@ import (
 //
 // Metadata format v1 does not define any control chunk types,
 // they are currently ignored aka reserved.
+// Format v3 adds the "cdc" control chunk holding the list of pool
+// chunks of a file made by content defined chunking (see cdc.go).
 // In future they can be used to implement resumable uploads etc.
 const (
 	ctrlTypeRegStr   = `[a-z][a-z0-9]{2,6}`
@@ -105,7 +107,7 @@ const maxMetadataSize = 1023
 const maxMetadataSizeWritten = 255
 
 // Current/highest supported metadata format.
-const metadataVersion = 2
+const metadataVersion = 3
 
 // optimizeFirstChunk enables the following optimization in the Put:
 // If a single chunk is expected, put the first chunk using the
@@ -143,6 +145,7 @@ func init() {
 		Name:        "chunker",
 		Description: "Transparently chunk/split large files",
 		NewFs:       NewFs,
+		CommandHelp: commandHelp,
 		Options: []fs.Option{{
 			Name:     "remote",
 			Required: true,
@@ -155,6 +158,21 @@ Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
 			Advanced: false,
 			Default:  fs.SizeSuffix(2147483648), // 2 GiB
 			Help:     `Files larger than chunk size will be split in chunks.`,
+		}, {
+			Name:     "chunking",
+			Advanced: false,
+			Default:  chunkingFixed,
+			Help:     `Choose how chunker splits files into chunks.`,
+			Examples: []fs.OptionExample{{
+				Value: chunkingFixed,
+				Help:  `Split files larger than chunk size into chunks of chunk size.`,
+			}, {
+				Value: chunkingFastCDC,
+				Help: `Split files at boundaries chosen by their content.
+Chunks are stored by hash in a pool shared by all files,
+so data common to several files or versions is stored once.
+Requires metadata.`,
+			}},
 		}, {
 			Name:     "name_format",
 			Advanced: true,
@@ -264,6 +282,24 @@ If meta format is set to "none", rename transactions will always be used.
 This method is EXPERIMENTAL, don't use on production systems.`,
 				},
 			},
+		}, {
+			Name:     "cdc_chunk_size",
+			Advanced: true,
+			Default:  fs.SizeSuffix(1024 * 1024), // 1 MiB
+			Help: `Average chunk size for content defined chunking.
+
+Chunks will be between a quarter and four times this size.
+It must be a power of 2. Changing it stops new uploads sharing
+chunks with files already in the pool.`,
+		}, {
+			Name:     "pool_dir",
+			Advanced: true,
+			Default:  ".rclone_chunks",
+			Help: `Directory of the chunk pool for content defined chunking.
+
+This is relative to the root of the wrapped remote and is hidden
+from listings. Use the "gc" backend command to remove chunks which
+are no longer used.`,
 		}},
 	})
 }
@@ -311,6 +347,18 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	if err := f.configure(opt.NameFormat, opt.MetaFormat, opt.HashType, opt.Transactions); err != nil {
 		return nil, err
 	}
+	if err := f.setChunking(opt.Chunking); err != nil {
+		return nil, err
+	}
+
+	// The chunk pool is shared by all chunker remotes wrapping the
+	// same remote so it lives at the root of the wrapped remote.
+	f.poolDir = path.Clean(opt.PoolDir)
+	if f.poolDir == "." || f.poolDir == ".." || strings.HasPrefix(f.poolDir, "../") || path.IsAbs(f.poolDir) {
+		return nil, errors.New("pool_dir must be a directory inside the wrapped remote")
+	}
+	f.rootRemote = baseName + basePath
+	f.poolRemote = baseName + fspath.JoinRootPath(basePath, f.poolDir)
 
 	// Handle the tricky case detected by FsMkdir/FsPutFiles/FsIsFile
 	// when `rpath` points to a composite multi-chunk file without metadata,
@@ -354,6 +402,9 @@ type Options struct {
 	HashType     string        `config:"hash_type"`
 	FailHard     bool          `config:"fail_hard"`
 	Transactions string        `config:"transactions"`
+	Chunking     string        `config:"chunking"`
+	CDCChunkSize fs.SizeSuffix `config:"cdc_chunk_size"`
+	PoolDir      string        `config:"pool_dir"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -376,6 +427,12 @@ type Fs struct {
 	features     *fs.Features   // optional features
 	dirSort      bool           // reserved for future, ignored
 	useNoRename  bool           // can be set with the transactions option
+	useCDC       bool           // true if chunking is fastcdc
+	poolDir      string         // path of the chunk pool in the wrapped remote
+	poolRemote   string         // remote string of the chunk pool
+	rootRemote   string         // remote string of the root of the wrapped remote
+	poolMu       sync.Mutex     // protects pool
+	pool         fs.Fs          // chunk pool, made when first needed
 }
 
 // configure sets up chunker for given name format, meta format and hash type.
@@ -778,6 +835,14 @@ func (f *Fs) processEntries(ctx context.Context, origEntries fs.DirEntries, dirP
 			// this is some kind of chunk
 			// metobject should have been created above if present
 			mainObject := byRemote[mainRemote]
+			if f.useMeta && ctrlType == cdcCtrlType && xactID == txnByRemote[mainRemote] {
+				if mainObject == nil {
+					fs.Debugf(f, "skip orphan chunk index %q", remote)
+					break
+				}
+				mainObject.cdcIndex = entry
+				break
+			}
 			isSpecial := xactID != txnByRemote[mainRemote] || ctrlType != ""
 			if mainObject == nil && f.useMeta && !isSpecial {
 				fs.Debugf(f, "skip orphan data chunk %q", remote)
@@ -812,6 +877,9 @@ func (f *Fs) processEntries(ctx context.Context, origEntries fs.DirEntries, dirP
 				badEntry[mainRemote] = true
 			}
 		case fs.Directory:
+			if f.isPoolDir(entry.Remote()) {
+				break // hide the chunk pool
+			}
 			isSubdir[entry.Remote()] = true
 			wrapDir := fs.NewDirCopy(ctx, entry)
 			wrapDir.SetRemote(entry.Remote())
@@ -953,6 +1021,10 @@ func (f *Fs) scanObject(ctx context.Context, remote string, quickScan bool) (fs.
 		if !sameMain {
 			continue // skip alien chunks
 		}
+		if f.useMeta && ctrlType == cdcCtrlType && xactID == currentXactID {
+			o.cdcIndex = entry
+			continue
+		}
 		if ctrlType != "" || xactID != currentXactID {
 			if f.useMeta {
 				// temporary/control chunk calls for lazy metadata read
@@ -995,6 +1067,11 @@ func (f *Fs) scanObject(ctx context.Context, remote string, quickScan bool) (fs.
 		if err := o.validate(); err != nil {
 			return nil, err
 		}
+		if o.cdcIndex != nil {
+			if err := o.readMetadata(ctx); err != nil {
+				return nil, err
+			}
+		}
 	}
 	return o, nil
 }
@@ -1063,7 +1140,13 @@ func (o *Object) readMetadata(ctx context.Context) error {
 		default:
 			return fmt.Errorf("invalid metadata: %w", err)
 		}
-		if o.size != metaInfo.Size() || len(o.chunks) != metaInfo.nChunks {
+		if metaInfo.chunking != "" {
+			if o.cdcIndex == nil {
+				return errors.New("chunk index is missing")
+			}
+			o.size = metaInfo.Size()
+			o.nChunks = metaInfo.nChunks
+		} else if o.size != metaInfo.Size() || len(o.chunks) != metaInfo.nChunks || o.cdcIndex != nil {
 			return errors.New("metadata doesn't match file size")
 		}
 		o.md5 = metaInfo.md5
@@ -1144,6 +1227,10 @@ func (f *Fs) put(
 		}
 	}
 
+	if f.useCDC {
+		return f.putCDC(ctx, in, src, remote, options, basePut)
+	}
+
 	// Prepare to upload
 	c := f.newChunkingReader(src)
 	wrapIn := c.wrapStream(ctx, in, src)
@@ -1301,7 +1388,7 @@ func (f *Fs) put(
 	switch f.opt.MetaFormat {
 	case "simplejson":
 		c.updateHashes()
-		metadata, err = marshalSimpleJSON(ctx, sizeTotal, len(c.chunks), c.md5, c.sha1, xactID)
+		metadata, err = marshalSimpleJSON(ctx, sizeTotal, len(c.chunks), c.md5, c.sha1, xactID, "")
 	}
 	if err == nil {
 		metaInfo := f.wrapInfo(src, baseRemote, int64(len(metadata)))
@@ -1489,6 +1576,11 @@ func (f *Fs) removeOldChunks(ctx context.Context, remote string) {
 				fs.Errorf(chunk, "Failed to remove old chunk: %v", err)
 			}
 		}
+		if oldObject.cdcIndex != nil {
+			if err := oldObject.cdcIndex.Remove(ctx); err != nil {
+				fs.Errorf(oldObject.cdcIndex, "Failed to remove old chunk index: %v", err)
+			}
+		}
 	}
 }
 
@@ -1646,6 +1738,15 @@ func (o *Object) Remove(ctx context.Context) (err error) {
 		}
 	}
 
+	// The pool chunks of a file made by content defined chunking may
+	// be used by other files so only its index is removed.
+	if o.cdcIndex != nil {
+		indexErr := o.cdcIndex.Remove(ctx)
+		if err == nil {
+			err = indexErr
+		}
+	}
+
 	// There are no known control chunks to remove atm.
 	return err
 }
@@ -1690,8 +1791,19 @@ func (f *Fs) copyOrMove(ctx context.Context, o *Object, remote string, do copyMo
 		newChunks = append(newChunks, chunkResult)
 	}
 
+	// Copy/move the chunk index of a file made by content defined
+	// chunking. Its data chunks stay in the pool.
+	var newIndex fs.Object
+	if err == nil && o.cdcIndex != nil {
+		indexRemote := o.cdcIndex.Remote()
+		if !strings.HasPrefix(indexRemote, mainRemote) {
+			err = fmt.Errorf("invalid chunk name %q", indexRemote)
+		} else {
+			newIndex, err = do(ctx, o.cdcIndex, remote+indexRemote[len(mainRemote):])
+		}
+	}
+
 	// Copy or move old metadata.
-	// There are no known control chunks to move/copy atm.
 	var metaObject fs.Object
 	if err == nil && o.main != nil {
 		metaObject, err = do(ctx, o.main, remote)
@@ -1700,22 +1812,32 @@ func (f *Fs) copyOrMove(ctx context.Context, o *Object, remote string, do copyMo
 		for _, chunk := range newChunks {
 			silentlyRemove(ctx, chunk)
 		}
+		if newIndex != nil {
+			silentlyRemove(ctx, newIndex)
+		}
 		return nil, err
 	}
 
 	// Create wrapping object, calculate and validate total size
 	newObj := f.newObject(remote, metaObject, newChunks)
+	newObj.cdcIndex = newIndex
 	err = newObj.validate()
 	if err != nil {
 		silentlyRemove(ctx, newObj)
 		return nil, err
 	}
+	nChunks, chunking := len(newChunks), ""
+	if newIndex != nil {
+		newObj.size = o.size
+		newObj.nChunks = o.nChunks
+		nChunks, chunking = o.nChunks, chunkingFastCDC
+	}
 
 	// Update metadata
 	var metadata []byte
 	switch f.opt.MetaFormat {
 	case "simplejson":
-		metadata, err = marshalSimpleJSON(ctx, newObj.size, len(newChunks), md5, sha1, o.xactID)
+		metadata, err = marshalSimpleJSON(ctx, newObj.size, nChunks, md5, sha1, o.xactID, chunking)
 		if err == nil {
 			metaInfo := f.wrapInfo(metaObject, "", int64(len(metadata)))
 			err = newObj.main.Update(ctx, bytes.NewReader(metadata), metaInfo)
@@ -1753,6 +1875,8 @@ func (f *Fs) okForServerSide(ctx context.Context, src fs.Object, opName string)
 		diff = "chunk numbering"
 	case f.opt.MetaFormat != obj.f.opt.MetaFormat:
 		diff = "meta formats"
+	case obj.cdcIndex != nil && f.poolRemote != obj.f.poolRemote:
+		diff = "chunk pools"
 	}
 	if diff != "" {
 		fs.Debugf(src, "Can't %s - different %s", opName, diff)
@@ -1966,6 +2090,8 @@ type Object struct {
 	xIDCached bool        // true if xactID has been read
 	unsure    bool        // true if need to read metadata to detect object type
 	xactID    string      // transaction ID for "norename" or empty string for "renamed" chunks
+	cdcIndex  fs.Object   // chunk index if file is made by content defined chunking
+	nChunks   int         // number of pool chunks if file is made by content defined chunking
 	md5       string
 	sha1      string
 	f         *Fs
@@ -2007,6 +2133,9 @@ func (o *Object) validate() error {
 		o.size = -1
 		return fmt.Errorf("%q metadata is too large", o.remote)
 	}
+	if o.cdcIndex != nil {
+		return nil // size is set from metadata
+	}
 
 	var totalSize int64
 	for _, chunk := range o.chunks {
@@ -2053,7 +2182,7 @@ func (o *Object) mainChunk() fs.Object {
 }
 
 func (o *Object) isComposite() bool {
-	return o.chunks != nil
+	return o.chunks != nil || o.cdcIndex != nil
 }
 
 // Fs returns read only access to the Fs that this object is part of
@@ -2076,6 +2205,15 @@ func (o *Object) Remote() string {
 
 // Size returns the size of the file
 func (o *Object) Size() int64 {
+	if o.cdcIndex != nil && !o.isFull {
+		// The size of a file made by content defined chunking is
+		// only found in its metadata, so read it when first needed
+		// rather than for every file listed.
+		if err := o.readMetadata(context.TODO()); err != nil {
+			fs.Debugf(o, "failed to read metadata: %v", err)
+			return -1
+		}
+	}
 	if o.isComposite() {
 		return o.size // total size of data chunks in a composite file
 	}
@@ -2182,13 +2320,27 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 		limit = o.size - offset
 	}
 
-	return o.newLinearReader(ctx, offset, limit, openOptions)
+	if o.cdcIndex != nil {
+		return o.openCDC(ctx, offset, limit, openOptions)
+	}
+	sizes := make([]int64, len(o.chunks))
+	for i, chunk := range o.chunks {
+		sizes[i] = chunk.Size()
+	}
+	open := func(ctx context.Context, chunkNo int, options ...fs.OpenOption) (io.ReadCloser, error) {
+		return o.chunks[chunkNo].Open(ctx, options...)
+	}
+	return newLinearReader(ctx, sizes, open, offset, limit, openOptions)
 }
 
+// openChunkFn opens the data chunk with the given number
+type openChunkFn func(ctx context.Context, chunkNo int, options ...fs.OpenOption) (io.ReadCloser, error)
+
 // linearReader opens and reads file chunks sequentially, without read-ahead
 type linearReader struct {
 	ctx     context.Context
-	chunks  []fs.Object
+	sizes   []int64 // sizes of the data chunks
+	open    openChunkFn
 	options []fs.OpenOption
 	limit   int64
 	count   int64
@@ -2197,10 +2349,11 @@ type linearReader struct {
 	err     error
 }
 
-func (o *Object) newLinearReader(ctx context.Context, offset, limit int64, options []fs.OpenOption) (io.ReadCloser, error) {
+func newLinearReader(ctx context.Context, sizes []int64, open openChunkFn, offset, limit int64, options []fs.OpenOption) (io.ReadCloser, error) {
 	r := &linearReader{
 		ctx:     ctx,
-		chunks:  o.chunks,
+		sizes:   sizes,
+		open:    open,
 		options: options,
 		limit:   limit,
 	}
@@ -2221,12 +2374,12 @@ func (r *linearReader) nextChunk(offset int64) (int64, error) {
 	if r.err != nil {
 		return -1, r.err
 	}
-	if r.pos >= len(r.chunks) || r.limit <= 0 || offset < 0 {
+	if r.pos >= len(r.sizes) || r.limit <= 0 || offset < 0 {
 		return -1, io.EOF
 	}
 
-	chunk := r.chunks[r.pos]
-	count := chunk.Size()
+	chunkNo := r.pos
+	count := r.sizes[chunkNo]
 	r.pos++
 
 	if offset >= count {
@@ -2242,7 +2395,7 @@ func (r *linearReader) nextChunk(offset int64) (int64, error) {
 		return -1, err
 	}
 
-	reader, err := chunk.Open(r.ctx, options...)
+	reader, err := r.open(r.ctx, chunkNo, options...)
 	if err != nil {
 		return -1, err
 	}
@@ -2292,14 +2445,15 @@ func (r *linearReader) Close() (err error) {
 
 // ObjectInfo describes a wrapped fs.ObjectInfo for being the source
 type ObjectInfo struct {
-	src     fs.ObjectInfo
-	fs      *Fs
-	nChunks int    // number of data chunks
-	xactID  string // transaction ID for "norename" or empty string for "renamed" chunks
-	size    int64  // overrides source size by the total size of data chunks
-	remote  string // overrides remote name
-	md5     string // overrides MD5 checksum
-	sha1    string // overrides SHA1 checksum
+	src      fs.ObjectInfo
+	fs       *Fs
+	nChunks  int    // number of data chunks
+	xactID   string // transaction ID for "norename" or empty string for "renamed" chunks
+	chunking string // chunking mode if not fixed
+	size     int64  // overrides source size by the total size of data chunks
+	remote   string // overrides remote name
+	md5      string // overrides MD5 checksum
+	sha1     string // overrides SHA1 checksum
 }
 
 func (f *Fs) wrapInfo(src fs.ObjectInfo, newRemote string, totalSize int64) *ObjectInfo {
@@ -2394,9 +2548,10 @@ type metaSimpleJSON struct {
 	Size     *int64 `json:"size"`    // total size of data chunks
 	ChunkNum *int   `json:"nchunks"` // number of data chunks
 	// optional extra fields
-	MD5    string `json:"md5,omitempty"`
-	SHA1   string `json:"sha1,omitempty"`
-	XactID string `json:"txn,omitempty"` // transaction ID for norename transactions
+	MD5      string `json:"md5,omitempty"`
+	SHA1     string `json:"sha1,omitempty"`
+	XactID   string `json:"txn,omitempty"`      // transaction ID for norename transactions
+	Chunking string `json:"chunking,omitempty"` // chunking mode if not fixed
 }
 
 // marshalSimpleJSON
@@ -2405,10 +2560,17 @@ type metaSimpleJSON struct {
 // - for files larger than chunk size
 // - if file contents can be mistaken as meta object
 // - if consistent hashing is On but wrapped remote can't provide given hash
-func marshalSimpleJSON(ctx context.Context, size int64, nChunks int, md5, sha1, xactID string) ([]byte, error) {
-	version := metadataVersion
-	if xactID == "" && version == 2 {
-		version = 1
+// - for files made by content defined chunking
+//
+// The lowest version which can describe the file is used, so files
+// remain readable by older rclone versions where possible.
+func marshalSimpleJSON(ctx context.Context, size int64, nChunks int, md5, sha1, xactID, chunking string) ([]byte, error) {
+	version := 1
+	switch {
+	case chunking != "":
+		version = 3
+	case xactID != "":
+		version = 2
 	}
 	metadata := metaSimpleJSON{
 		// required core fields
@@ -2416,9 +2578,10 @@ func marshalSimpleJSON(ctx context.Context, size int64, nChunks int, md5, sha1,
 		Size:     &size,
 		ChunkNum: &nChunks,
 		// optional extra fields
-		MD5:    md5,
-		SHA1:   sha1,
-		XactID: xactID,
+		MD5:      md5,
+		SHA1:     sha1,
+		XactID:   xactID,
+		Chunking: chunking,
 	}
 	data, err := json.Marshal(&metadata)
 	if err == nil && data != nil && len(data) >= maxMetadataSizeWritten {
@@ -2482,13 +2645,17 @@ func unmarshalSimpleJSON(ctx context.Context, metaObject fs.Object, data []byte)
 		}
 	}
 	// ChunkNum is allowed to be 0 in future versions
-	if *metadata.ChunkNum < 1 && *metadata.Version <= metadataVersion {
+	// and for empty files made by content defined chunking
+	if *metadata.ChunkNum < 1 && *metadata.Version <= metadataVersion && metadata.Chunking == "" {
 		return nil, false, errors.New("wrong number of chunks")
 	}
 	// Non-strict mode also accepts future metadata versions
 	if *metadata.Version > metadataVersion {
 		return nil, true, ErrMetaUnknown // produced by incompatible version of rclone
 	}
+	if metadata.Chunking != "" && metadata.Chunking != chunkingFastCDC {
+		return nil, true, ErrMetaUnknown // produced by incompatible version of rclone
+	}
 
 	var nilFs *Fs // nil object triggers appropriate type method
 	info = nilFs.wrapInfo(metaObject, "", *metadata.Size)
@@ -2496,6 +2663,7 @@ func unmarshalSimpleJSON(ctx context.Context, metaObject fs.Object, data []byte)
 	info.md5 = metadata.MD5
 	info.sha1 = metadata.SHA1
 	info.xactID = metadata.XactID
+	info.chunking = metadata.Chunking
 	return info, true, nil
 }
 
@@ -2549,6 +2717,7 @@ var (
 	_ fs.Wrapper         = (*Fs)(nil)
 	_ fs.ChangeNotifier  = (*Fs)(nil)
 	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
 	_ fs.ObjectInfo      = (*ObjectInfo)(nil)
 	_ fs.Object          = (*Object)(nil)
 	_ fs.ObjectUnWrapper = (*Object)(nil)
@@ -6,10 +6,13 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	mathrand "math/rand"
 	"path"
 	"regexp"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
@@ -679,7 +682,7 @@ func testMetadataInput(t *testing.T, f *Fs) {
 		}
 	}
 
-	metaData, err := marshalSimpleJSON(ctx, 3, 1, "", "", "")
+	metaData, err := marshalSimpleJSON(ctx, 3, 1, "", "", "", "")
 	require.NoError(t, err)
 	todaysMeta := string(metaData)
 	runSubtest(todaysMeta, "today")
@@ -870,6 +873,7 @@ func testMD5AllSlow(t *testing.T, f *Fs) {
 		"hash_type":    "md5all",
 		"transactions": "rename",
 		"meta_format":  "simplejson",
+		"chunking":     "fixed",
 	})
 	chunkFs, ok := fsResult.(*Fs)
 	require.True(t, ok, "fs must be a chunker remote")
@@ -899,6 +903,212 @@ func testMD5AllSlow(t *testing.T, f *Fs) {
 	require.NoError(t, operations.Purge(ctx, baseFs, ""))
 }
 
+// cdcTestData returns n bytes of random data which is the same each
+// time so the number of chunks changed by an edit doesn't vary
+func cdcTestData(n int) []byte {
+	data := make([]byte, n)
+	_, _ = mathrand.New(mathrand.NewSource(1)).Read(data)
+	return data
+}
+
+// Test that chunk boundaries depend only on the data
+func TestCDCSplitter(t *testing.T) {
+	data := cdcTestData(100 * 1024)
+	split := func(in io.Reader) (chunks []string) {
+		s := newCDCSplitter(in, 1024)
+		for {
+			chunk, err := s.Next()
+			if err == io.EOF {
+				return chunks
+			}
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, len(chunk), 1)
+			assert.LessOrEqual(t, len(chunk), 4096)
+			chunks = append(chunks, string(chunk))
+		}
+	}
+	chunks := split(bytes.NewReader(data))
+	assert.Equal(t, string(data), strings.Join(chunks, ""))
+	assert.Greater(t, len(chunks), 25)
+
+	// Reading in small pieces must not move the boundaries
+	assert.Equal(t, chunks, split(iotest.OneByteReader(bytes.NewReader(data))))
+
+	// Inserting data must only change the chunks around the insert
+	edited := append(append(append([]byte{}, data[:50000]...), "inserted"...), data[50000:]...)
+	old := map[string]bool{}
+	for _, chunk := range chunks {
+		old[chunk] = true
+	}
+	changed := 0
+	for _, chunk := range split(bytes.NewReader(edited)) {
+		if !old[chunk] {
+			changed++
+		}
+	}
+	assert.LessOrEqual(t, changed, 2)
+
+	assert.Nil(t, split(bytes.NewReader(nil)))
+}
+
+func TestIsPoolDir(t *testing.T) {
+	f := &Fs{poolDir: ".rclone_chunks"}
+	assert.True(t, f.isPoolDir(".rclone_chunks"))
+	assert.False(t, f.isPoolDir("dir/.rclone_chunks"))
+	f = &Fs{root: "/dir/", poolDir: "dir/pool"}
+	assert.True(t, f.isPoolDir("pool"))
+	assert.False(t, f.isPoolDir("dir/pool"))
+}
+
+// Test content defined chunking and the chunk pool
+func testFastCDC(t *testing.T, f *Fs) {
+	ctx := context.Background()
+	fsResult := deriveFs(ctx, t, f, "fastcdc", settings{
+		"chunking":       "fastcdc",
+		"cdc_chunk_size": "1k",
+		"meta_format":    "simplejson",
+		"hash_type":      "md5",
+		"transactions":   "rename",
+	})
+	chunkFs, ok := fsResult.(*Fs)
+	require.True(t, ok, "fs must be a chunker remote")
+	defer func() {
+		_ = operations.Purge(ctx, chunkFs.base, "")
+	}()
+	pool, err := chunkFs.getPool(ctx)
+	require.NoError(t, err)
+	inPool := func(index *cdcIndex) (found int) {
+		for _, chunk := range index.Chunks {
+			if _, err := pool.NewObject(ctx, poolChunkName(chunk.Hash)); err == nil {
+				found++
+			}
+		}
+		return found
+	}
+
+	contents := string(cdcTestData(64 * 1024))
+	edited := contents[:30000] + "inserted" + contents[30000:]
+	obj1, ok := testPutFile(ctx, t, chunkFs, "file1", contents, "put file1", true).(*Object)
+	require.True(t, ok)
+	obj2, ok := testPutFile(ctx, t, chunkFs, "file2", edited, "put file2", true).(*Object)
+	require.True(t, ok)
+	require.NotNil(t, obj1.cdcIndex, "file1 must be chunked")
+	require.NotNil(t, obj2.cdcIndex, "file2 must be chunked")
+
+	// The files must share most of their chunks
+	index1, err := readCDCIndex(ctx, obj1.cdcIndex)
+	require.NoError(t, err)
+	index2, err := readCDCIndex(ctx, obj2.cdcIndex)
+	require.NoError(t, err)
+	shared := map[string]bool{}
+	for _, chunk := range index1.Chunks {
+		shared[chunk.Hash] = true
+	}
+	unique := 0
+	for _, chunk := range index2.Chunks {
+		if !shared[chunk.Hash] {
+			unique++
+		}
+	}
+	// The chunk with the insert and maybe a couple after it until
+	// the boundaries line up again
+	assert.LessOrEqual(t, unique, 3)
+
+	// Reusing a chunk must refresh it so gc keeps it until the
+	// index referring to it is written
+	chunkSum := index1.Chunks[0].Hash
+	chunk, err := pool.NewObject(ctx, poolChunkName(chunkSum))
+	require.NoError(t, err)
+	longAgo := time.Now().Add(-24 * time.Hour)
+	if chunk.SetModTime(ctx, longAgo) == nil {
+		in, err := chunk.Open(ctx)
+		require.NoError(t, err)
+		chunkData, err := io.ReadAll(in)
+		require.NoError(t, err)
+		_ = in.Close()
+		require.NoError(t, chunkFs.putPoolChunk(ctx, pool, chunkSum, chunkData))
+		chunk, err = pool.NewObject(ctx, poolChunkName(chunkSum))
+		require.NoError(t, err)
+		assert.True(t, chunk.ModTime(ctx).After(longAgo.Add(time.Hour)))
+	}
+
+	// Small files are stored as they are
+	small := testPutFile(ctx, t, chunkFs, "small", "small file", "put small", true).(*Object)
+	assert.False(t, small.isComposite())
+
+	// Listing must show the real sizes and hide the pool without
+	// reading the metadata until the size is needed
+	entries, err := chunkFs.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(entries))
+	for _, entry := range entries {
+		if o, ok := entry.(*Object); ok && o.cdcIndex != nil {
+			assert.False(t, o.isFull, "metadata of %q read by List", o.Remote())
+		}
+	}
+	sizes := map[string]int64{}
+	for _, entry := range entries {
+		sizes[entry.Remote()] = entry.Size()
+	}
+	assert.Equal(t, map[string]int64{
+		"file1": int64(len(contents)),
+		"file2": int64(len(edited)),
+		"small": int64(len("small file")),
+	}, sizes)
+	obj, err := chunkFs.NewObject(ctx, "file2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(edited)), obj.Size())
+	sum, err := obj.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.NotEqual(t, "", sum)
+
+	// Ranged reads
+	r, err := obj.Open(ctx, &fs.RangeOption{Start: 29990, End: 30020})
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	_ = r.Close()
+	assert.Equal(t, edited[29990:30021], string(data))
+
+	// Moved files must share the chunks too
+	moved, err := operations.Move(ctx, chunkFs, nil, "file3", obj1)
+	require.NoError(t, err)
+	fstest.CheckListingWithPrecision(t, chunkFs, []fstest.Item{
+		fstest.NewItem("file2", edited, mtime1),
+		fstest.NewItem("file3", contents, mtime1),
+		fstest.NewItem("small", "small file", mtime1),
+	}, nil, fs.GetModifyWindow(ctx, chunkFs))
+	r, err = moved.Open(ctx)
+	require.NoError(t, err)
+	data, err = io.ReadAll(r)
+	require.NoError(t, err)
+	_ = r.Close()
+	assert.Equal(t, contents, string(data))
+
+	// Overwriting a file must remove its old index
+	obj3 := moved.(*Object)
+	require.NoError(t, obj3.Update(ctx, bytes.NewBufferString(edited), object.NewStaticObjectInfo("file3", mtime1, int64(len(edited)), true, nil, nil)))
+	_, err = chunkFs.base.NewObject(ctx, chunkFs.makeChunkName("file3", -1, cdcCtrlType, ""))
+	require.NoError(t, err)
+	index3, err := readCDCIndex(ctx, obj3.cdcIndex)
+	require.NoError(t, err)
+	assert.Equal(t, index2, index3)
+
+	// gc must keep the chunks in use and remove the rest
+	_, err = chunkFs.Command(ctx, "gc", nil, map[string]string{"min-age": "0"})
+	require.NoError(t, err)
+	assert.Equal(t, len(index2.Chunks), inPool(index2))
+	assert.Less(t, inPool(index1), len(index1.Chunks))
+	require.NoError(t, obj2.Remove(ctx))
+	require.NoError(t, obj3.Remove(ctx))
+	out, err := chunkFs.gc(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), out["deleted"], "recent chunks must be kept")
+	_, err = chunkFs.gc(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, inPool(index2))
+}
+
 // InternalTest dispatches all internal tests
 func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("PutLarge", func(t *testing.T) {
@@ -934,6 +1144,9 @@ func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("MD5AllSlow", func(t *testing.T) {
 		testMD5AllSlow(t, f)
 	})
+	t.Run("FastCDC", func(t *testing.T) {
+		testFastCDC(t, f)
+	})
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
@@ -41,6 +41,7 @@ func TestIntegration(t *testing.T) {
 			"PublicLink",
 			"OpenWriterAt",
 			"OpenChunkWriter",
+			"ResumeChunkWriter",
 			"MergeDirs",
 			"DirCacheFlush",
 			"UserInfo",
@@ -59,3 +60,41 @@ func TestIntegration(t *testing.T) {
 	}
 	fstests.Run(t, &opt)
 }
+
+// TestFastCDC runs integration tests with content defined chunking
+// against a local temporary directory
+func TestFastCDC(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestChunkerFastCDC"
+	tempDir := filepath.Join(os.TempDir(), "rclone-chunker-test-fastcdc")
+	fstests.Run(t, &fstests.Opt{
+		RemoteName:               name + ":",
+		NilObject:                (*chunker.Object)(nil),
+		SkipBadWindowsCharacters: !*UseBadChars,
+		UnimplementableObjectMethods: []string{
+			"MimeType",
+			"GetTier",
+			"SetTier",
+			"Metadata",
+		},
+		UnimplementableFsMethods: []string{
+			"PublicLink",
+			"OpenWriterAt",
+			"OpenChunkWriter",
+			"ResumeChunkWriter",
+			"MergeDirs",
+			"DirCacheFlush",
+			"UserInfo",
+			"Disconnect",
+		},
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "chunker"},
+			{Name: name, Key: "remote", Value: tempDir},
+			{Name: name, Key: "chunking", Value: "fastcdc"},
+			{Name: name, Key: "cdc_chunk_size", Value: "1k"},
+		},
+		QuickTestOK: true,
+	})
+}
@@ -29,7 +29,6 @@ import (
 	"github.com/rclone/rclone/fs/fspath"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/log"
-	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fs/operations"
 )
 
@@ -41,6 +40,7 @@ const (
 	bufferSize          = 8388608
 	heuristicBytes      = 1048576
 	minCompressionRatio = 1.1
+	autoImprovement     = 0.95 // a slower mode must compress to this fraction of the size of a faster one to be chosen
 
 	gzFileExt           = ".gz"
 	metaFileExt         = ".json"
@@ -48,11 +48,20 @@ const (
 )
 
 // Compression modes
+//
+// These are stored in the metadata of each object so must not change.
 const (
 	Uncompressed = 0
 	Gzip         = 2
+	Zstd         = 3
+	Lz4          = 4
+	Brotli       = 5
+	Auto         = -1 // choose a mode for each file - never stored
 )
 
+// autoModes are the modes tried by the auto mode, fastest first
+var autoModes = []int{Lz4, Zstd, Gzip, Brotli}
+
 var nameRegexp = regexp.MustCompile(`^(.+?)\.([A-Za-z0-9-_]{11})$`)
 
 // Register with Fs
@@ -62,6 +71,18 @@ func init() {
 		{ // Default compression mode options {
 			Value: "gzip",
 			Help:  "Standard gzip compression with fastest parameters.",
+		}, {
+			Value: "zstd",
+			Help:  "Zstandard compression - fast with a good compression ratio.",
+		}, {
+			Value: "lz4",
+			Help:  "LZ4 compression - very fast with a lower compression ratio.",
+		}, {
+			Value: "brotli",
+			Help:  "Brotli compression - slow with a high compression ratio.",
+		}, {
+			Value: "auto",
+			Help:  "Choose the mode for each file by compressing a sample of it.",
 		},
 	}
 
@@ -84,15 +105,21 @@ func init() {
 			Examples: compressionModeOptions,
 		}, {
 			Name: "level",
-			Help: `GZIP compression level (-2 to 9).
+			Help: `Compression level.
+
+-1 (the default) uses the default level of the compression mode and
+is generally recommended. Higher levels increase compression at the
+cost of speed. The possible levels depend on the mode:
 
-Generally -1 (default, equivalent to 5) is recommended.
-Levels 1 to 9 increase compression at the cost of speed. Going past 6 
-generally offers very little return.
+- gzip: -2 to 9. Going past 6 generally offers very little return.
+  Level -2 uses Huffman encoding only. Only use if you know what you
+  are doing. Level 0 turns off compression.
+- zstd: 1 to 22.
+- lz4: 0 to 9. Level 0 is the fast mode.
+- brotli: 0 to 11.
 
-Level -2 uses Huffman encoding only. Only use if you know what you
-are doing.
-Level 0 turns off compression.`,
+The level is ignored in auto mode, which uses the default level of
+each mode.`,
 			Default:  sgzip.DefaultCompression,
 			Advanced: true,
 		}, {
@@ -126,7 +153,7 @@ type Fs struct {
 	name     string
 	root     string
 	opt      Options
-	mode     int          // compression mode id
+	mode     int          // compression mode id for new files
 	features *fs.Features // optional features
 }
 
@@ -164,13 +191,18 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 		return nil, fmt.Errorf("failed to make remote %s:%q to wrap: %w", wName, remotePath, err)
 	}
 
+	mode := compressionModeFromName(opt.CompressionMode)
+	if err := checkCompressionLevel(mode, opt.CompressionLevel); err != nil {
+		return nil, err
+	}
+
 	// Create the wrapping fs
 	f := &Fs{
 		Fs:   wrappedFs,
 		name: name,
 		root: rpath,
 		opt:  *opt,
-		mode: compressionModeFromName(opt.CompressionMode),
+		mode: mode,
 	}
 	// the features here are ones we could support, and they are
 	// ANDed with the ones from wrappedFs
@@ -202,11 +234,54 @@ func compressionModeFromName(name string) int {
 	switch name {
 	case "gzip":
 		return Gzip
+	case "zstd":
+		return Zstd
+	case "lz4":
+		return Lz4
+	case "brotli":
+		return Brotli
+	case "auto":
+		return Auto
 	default:
 		return Uncompressed
 	}
 }
 
+// checkCompressionLevel checks the level is valid for mode
+func checkCompressionLevel(mode int, level int) error {
+	switch mode {
+	case Gzip:
+		if level < sgzip.HuffmanOnly || level > sgzip.BestCompression {
+			return fmt.Errorf("compression level %d out of range %d to %d for mode gzip", level, sgzip.HuffmanOnly, sgzip.BestCompression)
+		}
+	case Zstd, Lz4, Brotli:
+		return codecs[mode].checkLevel(level)
+	}
+	return nil
+}
+
+// modeExt returns the file extension for data files compressed with mode
+func modeExt(mode int) string {
+	if c, ok := codecs[mode]; ok {
+		return c.ext
+	}
+	return gzFileExt
+}
+
+// isCompressedExt returns true if ext is the file extension of a
+// compressed data file
+func isCompressedExt(ext string) bool {
+	if ext == gzFileExt {
+		return true
+	}
+	for _, c := range codecs {
+		if ext == c.ext {
+			return true
+		}
+	}
+	return false
+}
+
 // Converts an int64 to base64
 func int64ToBase64(number int64) string {
 	intBytes := make([]byte, 8)
@@ -236,6 +311,9 @@ func processFileName(compressedFileName string) (origFileName string, extension
 	if extension == uncompressedFileExt {
 		return nameWithSize, extension, -2, nil
 	}
+	if !isCompressedExt(extension) {
+		return "", "", 0, errors.New("unknown extension")
+	}
 	match := nameRegexp.FindStringSubmatch(nameWithSize)
 	if match == nil || len(match) != 3 {
 		return "", "", 0, errors.New("invalid filename")
@@ -244,7 +322,7 @@ func processFileName(compressedFileName string) (origFileName string, extension
 	if err != nil {
 		return "", "", 0, errors.New("could not decode size")
 	}
-	return match[1], gzFileExt, size, nil
+	return match[1], extension, size, nil
 }
 
 // Generates the file name for a metadata file
@@ -270,21 +348,13 @@ func unwrapMetadataFile(filename string) (string, bool) {
 // makeDataName generates the file name for a data file with specified compression mode
 func makeDataName(remote string, size int64, mode int) (newRemote string) {
 	if mode != Uncompressed {
-		newRemote = remote + "." + int64ToBase64(size) + gzFileExt
+		newRemote = remote + "." + int64ToBase64(size) + modeExt(mode)
 	} else {
 		newRemote = remote + uncompressedFileExt
 	}
 	return newRemote
 }
 
-// dataName generates the file name for data file
-func (f *Fs) dataName(remote string, size int64, compressed bool) (name string) {
-	if !compressed {
-		return makeDataName(remote, size, Uncompressed)
-	}
-	return makeDataName(remote, size, f.mode)
-}
-
 // addData parses an object and adds it to the DirEntries
 func (f *Fs) addData(entries *fs.DirEntries, o fs.Object) {
 	origFileName, _, size, err := processFileName(o.Remote())
@@ -383,50 +453,90 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 		return nil, fmt.Errorf("error decoding metadata: %w", err)
 	}
 	// Create our Object
-	o, err := f.Fs.NewObject(ctx, makeDataName(remote, meta.CompressionMetadata.Size, meta.Mode))
+	o, err := f.Fs.NewObject(ctx, makeDataName(remote, meta.Size, meta.Mode))
 	if err != nil {
 		return nil, err
 	}
 	return f.newObject(o, mo, meta), nil
 }
 
-// checkCompressAndType checks if an object is compressible and determines it's mime type
+// checkCompressAndType chooses the compression mode for an object and determines it's mime type
 // returns a multireader with the bytes that were read to determine mime type
-func checkCompressAndType(in io.Reader) (newReader io.Reader, compressible bool, mimeType string, err error) {
+func (f *Fs) checkCompressAndType(in io.Reader) (newReader io.Reader, mode int, mimeType string, err error) {
 	in, wrap := accounting.UnWrap(in)
 	buf := make([]byte, heuristicBytes)
-	n, err := in.Read(buf)
+	n, err := io.ReadFull(in, buf)
 	buf = buf[:n]
-	if err != nil && err != io.EOF {
-		return nil, false, "", err
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, Uncompressed, "", err
 	}
 	mime := mimetype.Detect(buf)
-	compressible, err = isCompressible(bytes.NewReader(buf))
+	mode, err = f.chooseMode(buf)
 	if err != nil {
-		return nil, false, "", err
+		return nil, Uncompressed, "", err
 	}
 	in = io.MultiReader(bytes.NewReader(buf), in)
-	return wrap(in), compressible, mime.String(), nil
+	return wrap(in), mode, mime.String(), nil
+}
+
+// level returns the compression level to use for new files
+func (f *Fs) level() int {
+	if f.mode == Auto {
+		return -1
+	}
+	return f.opt.CompressionLevel
 }
 
-// isCompressible checks the compression ratio of the provided data and returns true if the ratio exceeds
-// the configured threshold
-func isCompressible(r io.Reader) (bool, error) {
+// chooseMode returns the compression mode to use for data starting
+// with sample.
+//
+// The sample is compressed with the configured mode, or each of the
+// autoModes in auto mode. If it doesn't compress by more than
+// minCompressionRatio then it isn't worth compressing. In auto mode a
+// slower mode is only chosen if it compresses to autoImprovement of
+// the size of the faster mode.
+func (f *Fs) chooseMode(sample []byte) (int, error) {
+	candidates := []int{f.mode}
+	if f.mode == Auto {
+		candidates = autoModes
+	} else if f.mode == Uncompressed {
+		return Uncompressed, nil
+	}
+	best, bestSize := Uncompressed, int64(0)
+	for _, mode := range candidates {
+		size, err := compressedSize(mode, f.level(), sample)
+		if err != nil {
+			return Uncompressed, err
+		}
+		if size == 0 || float64(len(sample))/float64(size) <= minCompressionRatio {
+			continue
+		}
+		if best == Uncompressed || float64(size) < float64(bestSize)*autoImprovement {
+			best, bestSize = mode, size
+		}
+	}
+	return best, nil
+}
+
+// compressedSize returns the size of data compressed with mode at level
+func compressedSize(mode int, level int, data []byte) (int64, error) {
+	if c, ok := codecs[mode]; ok {
+		return c.compressedSize(data, level)
+	}
 	var b bytes.Buffer
-	w, err := sgzip.NewWriterLevel(&b, sgzip.DefaultCompression)
+	w, err := sgzip.NewWriterLevel(&b, level)
 	if err != nil {
-		return false, err
+		return 0, err
 	}
-	n, err := io.Copy(w, r)
+	_, err = w.Write(data)
 	if err != nil {
-		return false, err
+		return 0, err
 	}
 	err = w.Close()
 	if err != nil {
-		return false, err
+		return 0, err
 	}
-	ratio := float64(n) / float64(b.Len())
-	return ratio > minCompressionRatio, nil
+	return int64(b.Len()), nil
 }
 
 // verifyObjectHash verifies the Objects hash
@@ -450,19 +560,22 @@ func (f *Fs) verifyObjectHash(ctx context.Context, o fs.Object, hasher *hash.Mul
 type putFn func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error)
 
 type compressionResult struct {
-	err  error
-	meta sgzip.GzipMetadata
+	err    error
+	size   int64              // uncompressed size
+	meta   sgzip.GzipMetadata // for gzip
+	frames *FrameMetadata     // for the framed modes
 }
 
 // replicating some of operations.Rcat functionality because we want to support remotes without streaming
 // support and of course cannot know the size of a compressed file before compressing it.
-func (f *Fs) rcat(ctx context.Context, dstFileName string, in io.ReadCloser, modTime time.Time, options []fs.OpenOption) (o fs.Object, err error) {
+//
+// The modification time and metadata are taken from src.
+func (f *Fs) rcat(ctx context.Context, dstFileName string, in io.ReadCloser, src fs.ObjectInfo, options []fs.OpenOption) (o fs.Object, err error) {
 
 	// cache small files in memory and do normal upload
 	buf := make([]byte, f.opt.RAMCacheLimit)
 	if n, err := io.ReadFull(in, buf); err == io.EOF || err == io.ErrUnexpectedEOF {
-		src := object.NewStaticObjectInfo(dstFileName, modTime, int64(len(buf[:n])), false, nil, f.Fs)
-		return f.Fs.Put(ctx, bytes.NewBuffer(buf[:n]), src, options...)
+		return f.Fs.Put(ctx, bytes.NewBuffer(buf[:n]), f.wrapInfo(src, dstFileName, int64(n)), options...)
 	}
 
 	// Need to include what we already read
@@ -473,8 +586,7 @@ func (f *Fs) rcat(ctx context.Context, dstFileName string, in io.ReadCloser, mod
 
 	canStream := f.Fs.Features().PutStream != nil
 	if canStream {
-		src := object.NewStaticObjectInfo(dstFileName, modTime, -1, false, nil, f.Fs)
-		return f.Fs.Features().PutStream(ctx, in, src, options...)
+		return f.Fs.Features().PutStream(ctx, in, f.wrapInfo(src, dstFileName, -1), options...)
 	}
 
 	fs.Debugf(f, "Target remote doesn't support streaming uploads, creating temporary local file")
@@ -498,11 +610,11 @@ func (f *Fs) rcat(ctx context.Context, dstFileName string, in io.ReadCloser, mod
 	if err != nil {
 		return nil, err
 	}
-	return f.Fs.Put(ctx, tempFile, object.NewStaticObjectInfo(dstFileName, modTime, finfo.Size(), false, nil, f.Fs))
+	return f.Fs.Put(ctx, tempFile, f.wrapInfo(src, dstFileName, finfo.Size()), options...)
 }
 
-// Put a compressed version of a file. Returns a wrappable object and metadata.
-func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, options []fs.OpenOption, mimeType string) (fs.Object, *ObjectMetadata, error) {
+// Put a version of a file compressed with mode. Returns a wrappable object and metadata.
+func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, options []fs.OpenOption, mode int, mimeType string) (fs.Object, *ObjectMetadata, error) {
 	// Unwrap reader accounting
 	in, wrap := accounting.UnWrap(in)
 
@@ -514,13 +626,26 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 	pipeReader, pipeWriter := io.Pipe()
 	results := make(chan compressionResult)
 	go func() {
-		gz, err := sgzip.NewWriterLevel(pipeWriter, f.opt.CompressionLevel)
+		var (
+			w      io.WriteCloser
+			gz     *sgzip.Writer
+			framed *framedWriter
+			err    error
+		)
+		if c, ok := codecs[mode]; ok {
+			framed, err = c.newFramedWriter(pipeWriter, f.level())
+			w = framed
+		} else {
+			gz, err = sgzip.NewWriterLevel(pipeWriter, f.level())
+			w = gz
+		}
 		if err != nil {
-			results <- compressionResult{err: err, meta: sgzip.GzipMetadata{}}
+			_ = pipeWriter.CloseWithError(err)
+			results <- compressionResult{err: err}
 			return
 		}
-		_, err = io.Copy(gz, in)
-		gzErr := gz.Close()
+		_, err = io.Copy(w, in)
+		gzErr := w.Close()
 		if gzErr != nil {
 			fs.Errorf(nil, "Failed to close compress: %v", gzErr)
 			if err == nil {
@@ -534,7 +659,15 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 				err = closeErr
 			}
 		}
-		results <- compressionResult{err: err, meta: gz.MetaData()}
+		result := compressionResult{err: err}
+		if framed != nil {
+			result.size = framed.size
+			result.frames = &framed.meta
+		} else {
+			result.meta = gz.MetaData()
+			result.size = result.meta.Size
+		}
+		results <- result
 	}()
 	wrappedIn := wrap(bufio.NewReaderSize(pipeReader, bufferSize)) // Probably no longer needed as sgzip has it's own buffering
 
@@ -556,8 +689,7 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 	}
 
 	// Transfer the data
-	o, err := f.rcat(ctx, makeDataName(src.Remote(), src.Size(), f.mode), io.NopCloser(wrappedIn), src.ModTime(ctx), options)
-	//o, err := operations.Rcat(ctx, f.Fs, makeDataName(src.Remote(), src.Size(), f.mode), io.NopCloser(wrappedIn), src.ModTime(ctx))
+	o, err := f.rcat(ctx, makeDataName(src.Remote(), src.Size(), mode), io.NopCloser(wrappedIn), src, options)
 	if err != nil {
 		if o != nil {
 			removeErr := o.Remove(ctx)
@@ -581,7 +713,7 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 	}
 
 	// Generate metadata
-	meta := newMetadata(result.meta.Size, f.mode, result.meta, hex.EncodeToString(metaHasher.Sum(nil)), mimeType)
+	meta := newMetadata(result.size, mode, result.meta, result.frames, hex.EncodeToString(metaHasher.Sum(nil)), mimeType)
 
 	// Check the hashes of the compressed data if we were comparing them
 	if ht != hash.None && hasher != nil {
@@ -635,7 +767,7 @@ func (f *Fs) putUncompress(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	if err != nil {
 		return nil, nil, err
 	}
-	return o, newMetadata(o.Size(), Uncompressed, sgzip.GzipMetadata{}, hex.EncodeToString(sum), mimeType), nil
+	return o, newMetadata(o.Size(), Uncompressed, sgzip.GzipMetadata{}, nil, hex.EncodeToString(sum), mimeType), nil
 }
 
 // This function will write a metadata struct to a metadata Object for an src. Returns a wrappable metadata object.
@@ -664,16 +796,16 @@ func (f *Fs) putMetadata(ctx context.Context, meta *ObjectMetadata, src fs.Objec
 
 // This function will put both the data and metadata for an Object.
 // putData is the function used for data, while putMeta is the function used for metadata.
-// The putData function will only be used when the object is not compressible if the
-// data is compressible this parameter will be ignored.
+// The putData function will only be used when the object is stored uncompressed, if the
+// data is compressed with mode this parameter will be ignored.
 func (f *Fs) putWithCustomFunctions(ctx context.Context, in io.Reader, src fs.ObjectInfo, options []fs.OpenOption,
-	putData putFn, putMeta putFn, compressible bool, mimeType string) (*Object, error) {
+	putData putFn, putMeta putFn, mode int, mimeType string) (*Object, error) {
 	// Put file then metadata
 	var dataObject fs.Object
 	var meta *ObjectMetadata
 	var err error
-	if compressible {
-		dataObject, meta, err = f.putCompress(ctx, in, src, options, mimeType)
+	if mode != Uncompressed {
+		dataObject, meta, err = f.putCompress(ctx, in, src, options, mode, mimeType)
 	} else {
 		dataObject, meta, err = f.putUncompress(ctx, in, src, putData, options, mimeType)
 	}
@@ -705,12 +837,12 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 	// destroys all server-side versioning.
 	o, err := f.NewObject(ctx, src.Remote())
 	if err == fs.ErrorObjectNotFound {
-		// Get our file compressibility
-		in, compressible, mimeType, err := checkCompressAndType(in)
+		// Get our file compression mode
+		in, mode, mimeType, err := f.checkCompressAndType(in)
 		if err != nil {
 			return nil, err
 		}
-		return f.putWithCustomFunctions(ctx, in, src, options, f.Fs.Put, f.Fs.Put, compressible, mimeType)
+		return f.putWithCustomFunctions(ctx, in, src, options, f.Fs.Put, f.Fs.Put, mode, mimeType)
 	}
 	if err != nil {
 		return nil, err
@@ -726,18 +858,18 @@ func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, opt
 	}
 	found := err == nil
 
-	in, compressible, mimeType, err := checkCompressAndType(in)
+	in, mode, mimeType, err := f.checkCompressAndType(in)
 	if err != nil {
 		return nil, err
 	}
-	newObj, err := f.putWithCustomFunctions(ctx, in, src, options, f.Fs.Features().PutStream, f.Fs.Put, compressible, mimeType)
+	newObj, err := f.putWithCustomFunctions(ctx, in, src, options, f.Fs.Features().PutStream, f.Fs.Put, mode, mimeType)
 	if err != nil {
 		return nil, err
 	}
 
 	// Our transfer is now complete. We have to make sure to remove the old object because our new object will
 	// have a different name except when both the old and the new object where uncompressed.
-	if found && (oldObj.(*Object).meta.Mode != Uncompressed || compressible) {
+	if found && (oldObj.(*Object).meta.Mode != Uncompressed || mode != Uncompressed) {
 		err = oldObj.(*Object).Object.Remove(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("couldn't remove original object: %w", err)
@@ -746,8 +878,8 @@ func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, opt
 
 	// If our new object is compressed we have to rename it with the correct size.
 	// Uncompressed objects don't store the size in the name so we they'll already have the correct name.
-	if compressible {
-		wrapObj, err := operations.Move(ctx, f.Fs, nil, f.dataName(src.Remote(), newObj.size, compressible), newObj.Object)
+	if mode != Uncompressed {
+		wrapObj, err := operations.Move(ctx, f.Fs, nil, makeDataName(src.Remote(), newObj.size, mode), newObj.Object)
 		if err != nil {
 			return nil, fmt.Errorf("couldn't rename streamed object: %w", err)
 		}
@@ -1034,6 +1166,7 @@ type ObjectMetadata struct {
 	MD5                 string // MD5 hash of the file.
 	MimeType            string // Mime type of the file
 	CompressionMetadata sgzip.GzipMetadata
+	FrameMetadata       *FrameMetadata `json:",omitempty"` // Frames for the zstd, lz4 and brotli modes
 }
 
 // Object with external metadata
@@ -1047,11 +1180,12 @@ type Object struct {
 }
 
 // This function generates a metadata object
-func newMetadata(size int64, mode int, cmeta sgzip.GzipMetadata, md5 string, mimeType string) *ObjectMetadata {
+func newMetadata(size int64, mode int, cmeta sgzip.GzipMetadata, frames *FrameMetadata, md5 string, mimeType string) *ObjectMetadata {
 	meta := new(ObjectMetadata)
 	meta.Size = size
 	meta.Mode = mode
 	meta.CompressionMetadata = cmeta
+	meta.FrameMetadata = frames
 	meta.MD5 = md5
 	meta.MimeType = mimeType
 	return meta
@@ -1104,7 +1238,7 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 		return o.mo, o.mo.Update(ctx, in, src, options...)
 	}
 
-	in, compressible, mimeType, err := checkCompressAndType(in)
+	in, mode, mimeType, err := o.f.checkCompressAndType(in)
 	if err != nil {
 		return err
 	}
@@ -1113,8 +1247,8 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	// We'll make sure to delete the old object in this case
 	var newObject *Object
 	origName := o.Remote()
-	if o.meta.Mode != Uncompressed || compressible {
-		newObject, err = o.f.putWithCustomFunctions(ctx, in, o.f.wrapInfo(src, origName, src.Size()), options, o.f.Fs.Put, updateMeta, compressible, mimeType)
+	if o.meta.Mode != Uncompressed || mode != Uncompressed {
+		newObject, err = o.f.putWithCustomFunctions(ctx, in, o.f.wrapInfo(src, origName, src.Size()), options, o.f.Fs.Put, updateMeta, mode, mimeType)
 		if err != nil {
 			return err
 		}
@@ -1130,7 +1264,7 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 			return o.Object, o.Object.Update(ctx, in, src, options...)
 		}
 		// If we are, just update the object and metadata
-		newObject, err = o.f.putWithCustomFunctions(ctx, in, src, options, update, updateMeta, compressible, mimeType)
+		newObject, err = o.f.putWithCustomFunctions(ctx, in, src, options, update, updateMeta, mode, mimeType)
 		if err != nil {
 			return err
 		}
@@ -1321,6 +1455,13 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 			openOptions = append(openOptions, option)
 		}
 	}
+	// The framed modes read only the frames they need
+	if c, ok := codecs[o.meta.Mode]; ok {
+		return c.openFramed(ctx, o.Object, o.meta.FrameMetadata, offset, limit)
+	}
+	if o.meta.Mode != Gzip {
+		return nil, fmt.Errorf("unknown compression mode %d", o.meta.Mode)
+	}
 	// Get a chunkedreader for the wrapped object
 	chunkedReader := chunkedreader.New(ctx, o.Object, initialChunkSize, maxChunkSize)
 	// Get file handle
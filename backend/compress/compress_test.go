@@ -4,6 +4,7 @@ package compress
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	_ "github.com/rclone/rclone/backend/drive"
@@ -20,6 +21,7 @@ var defaultOpt = fstests.Opt{
 	UnimplementableFsMethods: []string{
 		"OpenWriterAt",
 		"OpenChunkWriter",
+		"ResumeChunkWriter",
 		"MergeDirs",
 		"DirCacheFlush",
 		"PutUnchecked",
@@ -53,3 +55,41 @@ func TestRemoteGzip(t *testing.T) {
 	opt.QuickTestOK = true
 	fstests.Run(t, &opt)
 }
+
+// testRemoteMode runs the integration tests with compression mode
+func testRemoteMode(t *testing.T, mode string) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	tempdir := filepath.Join(os.TempDir(), "rclone-compress-test-"+mode)
+	name := "TestCompress" + strings.ToUpper(mode[:1]) + mode[1:]
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "compress"},
+		{Name: name, Key: "remote", Value: tempdir},
+		{Name: name, Key: "mode", Value: mode},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
+
+// TestRemoteZstd tests zstd compression
+func TestRemoteZstd(t *testing.T) {
+	testRemoteMode(t, "zstd")
+}
+
+// TestRemoteLz4 tests lz4 compression
+func TestRemoteLz4(t *testing.T) {
+	testRemoteMode(t, "lz4")
+}
+
+// TestRemoteBrotli tests brotli compression
+func TestRemoteBrotli(t *testing.T) {
+	testRemoteMode(t, "brotli")
+}
+
+// TestRemoteAuto tests choosing the compression for each file
+func TestRemoteAuto(t *testing.T) {
+	testRemoteMode(t, "auto")
+}
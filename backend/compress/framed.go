@@ -0,0 +1,366 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/chunkedreader"
+)
+
+// frameSize is the amount of uncompressed data in each frame
+const frameSize = 1024 * 1024
+
+// FrameMetadata describes the frames of an object stored with one of
+// the framed compression modes.
+//
+// Each frame is compressed independently so reading can start at the
+// beginning of any frame.
+type FrameMetadata struct {
+	FrameSize int64   // Uncompressed size of each frame except the last
+	Sizes     []int64 // Compressed size of each frame
+}
+
+// frameWriter is implemented by the compressors used for frames
+type frameWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// frameReader is implemented by the decompressors used for frames
+type frameReader interface {
+	io.Reader
+	Reset(r io.Reader) error
+	Close()
+}
+
+// codec describes a framed compression mode
+type codec struct {
+	name      string
+	ext       string                               // file extension for the data file
+	minLevel  int                                  // minimum compression level - -1 is always the default
+	maxLevel  int                                  // maximum compression level
+	newWriter func(level int) (frameWriter, error) // make a compressor with the level given
+	newReader func() (frameReader, error)          // make a decompressor
+}
+
+// codecs contains the framed compression modes
+var codecs = map[int]*codec{
+	Zstd: {
+		name:     "zstd",
+		ext:      ".zst",
+		minLevel: 1,
+		maxLevel: 22,
+		newWriter: func(level int) (frameWriter, error) {
+			encoderLevel := zstd.SpeedDefault
+			if level != -1 {
+				encoderLevel = zstd.EncoderLevelFromZstd(level)
+			}
+			return zstd.NewWriter(nil, zstd.WithEncoderLevel(encoderLevel), zstd.WithEncoderConcurrency(1))
+		},
+		newReader: func() (frameReader, error) {
+			return zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		},
+	},
+	Lz4: {
+		name:     "lz4",
+		ext:      ".lz4",
+		minLevel: 0,
+		maxLevel: 9,
+		newWriter: func(level int) (frameWriter, error) {
+			compressionLevel := lz4.Fast
+			if level > 0 {
+				compressionLevel = lz4.CompressionLevel(1 << (8 + level))
+			}
+			w := lz4.NewWriter(nil)
+			err := w.Apply(lz4.CompressionLevelOption(compressionLevel))
+			if err != nil {
+				return nil, err
+			}
+			return w, nil
+		},
+		newReader: func() (frameReader, error) {
+			return lz4Reader{lz4.NewReader(nil)}, nil
+		},
+	},
+	Brotli: {
+		name:     "brotli",
+		ext:      ".br",
+		minLevel: brotli.BestSpeed,
+		maxLevel: brotli.BestCompression,
+		newWriter: func(level int) (frameWriter, error) {
+			if level == -1 {
+				level = brotli.DefaultCompression
+			}
+			return brotli.NewWriterLevel(nil, level), nil
+		},
+		newReader: func() (frameReader, error) {
+			return brotliReader{brotli.NewReader(nil)}, nil
+		},
+	},
+}
+
+// lz4Reader adapts an lz4.Reader to be a frameReader
+type lz4Reader struct {
+	*lz4.Reader
+}
+
+func (r lz4Reader) Reset(in io.Reader) error {
+	r.Reader.Reset(in)
+	return nil
+}
+
+func (r lz4Reader) Close() {}
+
+// brotliReader adapts a brotli.Reader to be a frameReader
+type brotliReader struct {
+	*brotli.Reader
+}
+
+func (r brotliReader) Close() {}
+
+// checkLevel checks level is valid for the codec
+func (c *codec) checkLevel(level int) error {
+	if level != -1 && (level < c.minLevel || level > c.maxLevel) {
+		return fmt.Errorf("compression level %d out of range %d to %d for mode %s", level, c.minLevel, c.maxLevel, c.name)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	out io.Writer
+	n   int64
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.out.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// framedWriter compresses the data written to it into frames of
+// frameSize bytes written to out
+type framedWriter struct {
+	enc     frameWriter
+	out     countingWriter
+	meta    FrameMetadata
+	size    int64 // total uncompressed bytes written
+	inFrame int64 // uncompressed bytes in the current frame
+	open    bool  // set if a frame has been started
+}
+
+// newFramedWriter makes a framedWriter compressing into out
+func (c *codec) newFramedWriter(out io.Writer, level int) (*framedWriter, error) {
+	enc, err := c.newWriter(level)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make %s compressor: %w", c.name, err)
+	}
+	return &framedWriter{
+		enc: enc,
+		out: countingWriter{out: out},
+		meta: FrameMetadata{
+			FrameSize: frameSize,
+			Sizes:     []int64{},
+		},
+	}, nil
+}
+
+// Write data into the frames, starting a new one when the current
+// one is full
+func (w *framedWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if !w.open {
+			w.out.n = 0
+			w.enc.Reset(&w.out)
+			w.inFrame = 0
+			w.open = true
+		}
+		chunk := p
+		if left := w.meta.FrameSize - w.inFrame; int64(len(chunk)) > left {
+			chunk = chunk[:left]
+		}
+		written, err := w.enc.Write(chunk)
+		n += written
+		w.inFrame += int64(written)
+		w.size += int64(written)
+		p = p[written:]
+		if err != nil {
+			return n, err
+		}
+		if w.inFrame >= w.meta.FrameSize {
+			err = w.endFrame()
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// endFrame finishes the current frame and records its size
+func (w *framedWriter) endFrame() error {
+	w.open = false
+	err := w.enc.Close()
+	if err != nil {
+		return err
+	}
+	w.meta.Sizes = append(w.meta.Sizes, w.out.n)
+	return nil
+}
+
+// Close finishes the last frame
+func (w *framedWriter) Close() error {
+	if w.open {
+		return w.endFrame()
+	}
+	return nil
+}
+
+// framedReader decompresses a sequence of frames read from in
+type framedReader struct {
+	in    io.Reader
+	dec   frameReader
+	sizes []int64           // compressed sizes of the frames still to read
+	frame *io.LimitedReader // the current frame or nil
+}
+
+// Read decompressed data, moving on to the next frame as each one
+// finishes
+func (r *framedReader) Read(p []byte) (n int, err error) {
+	for {
+		if r.frame == nil {
+			if len(r.sizes) == 0 {
+				return 0, io.EOF
+			}
+			r.frame = &io.LimitedReader{R: r.in, N: r.sizes[0]}
+			r.sizes = r.sizes[1:]
+			err = r.dec.Reset(r.frame)
+			if err != nil {
+				return 0, err
+			}
+		}
+		n, err = r.dec.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		// Skip anything the decompressor didn't read so the next
+		// frame starts in the right place
+		if _, err = io.Copy(io.Discard, r.frame); err != nil {
+			return n, err
+		}
+		r.frame = nil
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close the decompressor
+func (r *framedReader) Close() error {
+	r.dec.Close()
+	return nil
+}
+
+// openFramed opens the data object o compressed with codec c,
+// returning the uncompressed data from offset for limit bytes, or to
+// the end if limit is -1.
+//
+// Only the frames which cover the range are read from o.
+func (c *codec) openFramed(ctx context.Context, o fs.Object, meta *FrameMetadata, offset, limit int64) (io.ReadCloser, error) {
+	if meta == nil || meta.FrameSize <= 0 {
+		return nil, fmt.Errorf("missing frame metadata for %s compressed object", c.name)
+	}
+	first := int(offset / meta.FrameSize)
+	if first > len(meta.Sizes) {
+		first = len(meta.Sizes)
+	}
+	last := len(meta.Sizes)
+	if limit >= 0 {
+		end := (offset + limit + meta.FrameSize - 1) / meta.FrameSize
+		if end < int64(last) {
+			last = int(end)
+		}
+	}
+	var start, length int64
+	for i, size := range meta.Sizes[:last] {
+		if i < first {
+			start += size
+		} else {
+			length += size
+		}
+	}
+
+	dec, err := c.newReader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to make %s decompressor: %w", c.name, err)
+	}
+	in := chunkedreader.New(ctx, o, initialChunkSize, maxChunkSize)
+	if length > 0 {
+		_, err = in.RangeSeek(ctx, start, io.SeekStart, length)
+		if err != nil {
+			dec.Close()
+			return nil, err
+		}
+	}
+	fr := &framedReader{
+		in:    in,
+		dec:   dec,
+		sizes: meta.Sizes[first:last],
+	}
+	// Skip to the offset within the first frame
+	skip := offset - int64(first)*meta.FrameSize
+	if skip > 0 {
+		_, err = io.CopyN(io.Discard, fr, skip)
+		if err != nil && err != io.EOF {
+			_ = fr.Close()
+			_ = in.Close()
+			return nil, err
+		}
+	}
+	var out io.Reader = fr
+	if limit >= 0 {
+		out = io.LimitReader(fr, limit)
+	}
+	return ReadCloserWrapper{
+		Reader: out,
+		Closer: closers{fr, in},
+	}, nil
+}
+
+// closers closes all of its members returning the first error
+type closers []io.Closer
+
+func (cs closers) Close() (err error) {
+	for _, c := range cs {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// compressedSize returns the size of data compressed in a single
+// frame with the codec at level
+func (c *codec) compressedSize(data []byte, level int) (int64, error) {
+	var out countingWriter
+	out.out = io.Discard
+	w, err := c.newFramedWriter(&out, level)
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(w, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	err = w.Close()
+	if err != nil {
+		return 0, err
+	}
+	return out.n, nil
+}
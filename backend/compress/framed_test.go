@@ -0,0 +1,177 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/buengese/sgzip"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTestData makes some compressible data
+func makeTestData(size int) []byte {
+	rng := rand.New(rand.NewSource(42))
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = "abcdefgh"[rng.Intn(8)]
+	}
+	return data
+}
+
+func TestFramedRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	data := makeTestData(3*frameSize + 12345)
+	for mode, c := range codecs {
+		t.Run(c.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			w, err := c.newFramedWriter(&compressed, -1)
+			require.NoError(t, err)
+			_, err = io.Copy(w, bytes.NewReader(data))
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+			assert.Equal(t, int64(len(data)), w.size)
+			assert.Equal(t, 4, len(w.meta.Sizes))
+			assert.Less(t, compressed.Len(), len(data))
+			var total int64
+			for _, size := range w.meta.Sizes {
+				total += size
+			}
+			assert.Equal(t, int64(compressed.Len()), total)
+
+			o := mockobject.New("test"+c.ext).WithContent(compressed.Bytes(), mockobject.SeekModeRange)
+			for _, test := range []struct {
+				offset int64
+				limit  int64
+			}{
+				{0, -1},
+				{0, 100},
+				{1, -1},
+				{frameSize - 10, 20},
+				{frameSize, frameSize},
+				{2*frameSize + 5, -1},
+				{int64(len(data)) - 1, -1},
+				{int64(len(data)), -1},
+				{int64(len(data)) + 100, -1},
+			} {
+				what := fmt.Sprintf("mode=%d offset=%d limit=%d", mode, test.offset, test.limit)
+				rc, err := c.openFramed(ctx, o, &w.meta, test.offset, test.limit)
+				require.NoError(t, err, what)
+				got, err := io.ReadAll(rc)
+				require.NoError(t, err, what)
+				require.NoError(t, rc.Close(), what)
+				want := []byte{}
+				if test.offset < int64(len(data)) {
+					want = data[test.offset:]
+					if test.limit >= 0 && test.limit < int64(len(want)) {
+						want = want[:test.limit]
+					}
+				}
+				assert.Equal(t, len(want), len(got), what)
+				assert.True(t, bytes.Equal(want, got), what)
+			}
+		})
+	}
+}
+
+func TestFramedEmpty(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range codecs {
+		var compressed bytes.Buffer
+		w, err := c.newFramedWriter(&compressed, -1)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Equal(t, 0, len(w.meta.Sizes))
+		o := mockobject.New("empty"+c.ext).WithContent(compressed.Bytes(), mockobject.SeekModeRange)
+		rc, err := c.openFramed(ctx, o, &w.meta, 0, -1)
+		require.NoError(t, err)
+		got, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		assert.Equal(t, 0, len(got))
+	}
+}
+
+func TestCheckCompressionLevel(t *testing.T) {
+	assert.NoError(t, checkCompressionLevel(Gzip, -1))
+	assert.NoError(t, checkCompressionLevel(Gzip, -2))
+	assert.Error(t, checkCompressionLevel(Gzip, 10))
+	assert.NoError(t, checkCompressionLevel(Zstd, 22))
+	assert.Error(t, checkCompressionLevel(Zstd, 0))
+	assert.NoError(t, checkCompressionLevel(Lz4, 0))
+	assert.Error(t, checkCompressionLevel(Lz4, 10))
+	assert.NoError(t, checkCompressionLevel(Brotli, 11))
+	assert.Error(t, checkCompressionLevel(Brotli, 12))
+	assert.NoError(t, checkCompressionLevel(Auto, 100))
+}
+
+func TestChooseMode(t *testing.T) {
+	random := make([]byte, 100000)
+	_, _ = rand.New(rand.NewSource(1)).Read(random)
+	compressible := makeTestData(100000)
+	for _, test := range []struct {
+		mode int
+		data []byte
+		want int
+	}{
+		{Gzip, compressible, Gzip},
+		{Gzip, random, Uncompressed},
+		{Zstd, compressible, Zstd},
+		{Lz4, random, Uncompressed},
+		{Brotli, compressible, Brotli},
+		{Auto, random, Uncompressed},
+		{Auto, nil, Uncompressed},
+		{Uncompressed, compressible, Uncompressed},
+	} {
+		f := &Fs{mode: test.mode, opt: Options{CompressionLevel: -1}}
+		got, err := f.chooseMode(test.data)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, got, fmt.Sprintf("mode=%d", test.mode))
+	}
+
+	// Auto should choose one of the modes for compressible data
+	f := &Fs{mode: Auto, opt: Options{CompressionLevel: -1}}
+	got, err := f.chooseMode(compressible)
+	require.NoError(t, err)
+	assert.Contains(t, autoModes, got)
+}
+
+func TestProcessFileName(t *testing.T) {
+	for _, mode := range []int{Gzip, Zstd, Lz4, Brotli, Uncompressed} {
+		name := makeDataName("dir/file.txt", 12345, mode)
+		origName, ext, size, err := processFileName(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, "dir/file.txt", origName)
+		if mode == Uncompressed {
+			assert.Equal(t, int64(-2), size)
+			assert.Equal(t, uncompressedFileExt, ext)
+		} else {
+			assert.Equal(t, int64(12345), size)
+			assert.Equal(t, modeExt(mode), ext)
+		}
+	}
+	_, _, _, err := processFileName("file.AAAAAAAAAAA.xyz")
+	assert.Error(t, err)
+}
+
+// Check the frames are stored in the metadata
+func TestFrameMetadata(t *testing.T) {
+	meta := newMetadata(100, Zstd, sgzip.GzipMetadata{}, &FrameMetadata{FrameSize: frameSize, Sizes: []int64{50}}, "md5", "text/plain")
+	data, err := json.Marshal(meta)
+	require.NoError(t, err)
+	got := new(ObjectMetadata)
+	require.NoError(t, json.Unmarshal(data, got))
+	assert.Equal(t, meta, got)
+
+	// Objects from older versions have no frames
+	meta = newMetadata(100, Gzip, sgzip.GzipMetadata{}, nil, "md5", "text/plain")
+	data, err = json.Marshal(meta)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "FrameMetadata")
+}
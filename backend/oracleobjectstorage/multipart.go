@@ -126,6 +126,89 @@ func (f *Fs) OpenChunkWriter(
 	return info, chunkWriter, err
 }
 
+// ResumeChunkWriter carries on the multipart upload described by
+// state which was started by OpenChunkWriter.
+//
+// Only the parts in state which are still present in the upload are
+// kept, the others will need writing again.
+func (f *Fs) ResumeChunkWriter(
+	ctx context.Context,
+	remote string,
+	src fs.ObjectInfo,
+	state fs.ChunkWriterState,
+	options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	// Temporary Object under construction
+	o := &Object{
+		fs:     f,
+		remote: remote,
+	}
+	ui, err := o.prepareUpload(ctx, src, options)
+	if err != nil {
+		return info, nil, fmt.Errorf("failed to prepare upload: %w", err)
+	}
+	bucketName, bucketPath := o.split()
+	existingParts, err := f.listMultipartUploadParts(ctx, bucketName, bucketPath, state.ID)
+	if err != nil {
+		return info, nil, fmt.Errorf("failed to list parts of multipart upload %q: %w", state.ID, err)
+	}
+	uploadID := state.ID
+	chunkWriter := &objectChunkWriter{
+		chunkSize:     state.ChunkSize,
+		size:          src.Size(),
+		f:             f,
+		bucket:        &bucketName,
+		key:           &bucketPath,
+		uploadID:      &uploadID,
+		existingParts: existingParts,
+		ui:            ui,
+		o:             o,
+	}
+	for chunkNumber, record := range state.Chunks {
+		md5hex, eTag, _ := strings.Cut(record, ":")
+		md5binary, err := hex.DecodeString(md5hex)
+		partNumber := chunkNumber + 1
+		existing, ok := existingParts[partNumber]
+		if err != nil || len(md5binary) != md5.Size || !ok || existing.Etag == nil || *existing.Etag != eTag {
+			fs.Debugf(o, "resume chunk writer: part %d missing or changed so will upload again", partNumber)
+			continue
+		}
+		chunkWriter.addMd5(&md5binary, int64(chunkNumber))
+		chunkWriter.addCompletedPart(existing.PartNumber, existing.Etag)
+	}
+	info = fs.ChunkWriterInfo{
+		ChunkSize:         state.ChunkSize,
+		Concurrency:       o.fs.opt.UploadConcurrency,
+		LeavePartsOnError: o.fs.opt.LeavePartsOnError,
+	}
+	fs.Debugf(o, "resume chunk writer: resumed multipart upload %v with %d parts", uploadID, len(chunkWriter.partsToCommit))
+	return info, chunkWriter, nil
+}
+
+// ChunkWriterState returns the state of the multipart upload so far
+//
+// The record of each chunk is its MD5 in hex and its ETag.
+func (w *objectChunkWriter) ChunkWriterState() fs.ChunkWriterState {
+	w.partsToCommitMu.Lock()
+	defer w.partsToCommitMu.Unlock()
+	w.md5sMu.Lock()
+	defer w.md5sMu.Unlock()
+	state := fs.ChunkWriterState{
+		ID:        *w.uploadID,
+		ChunkSize: w.chunkSize,
+		Chunks:    make(map[int]string, len(w.partsToCommit)),
+	}
+	for _, part := range w.partsToCommit {
+		chunkNumber := *part.PartNum - 1
+		start := chunkNumber * md5.Size
+		if start+md5.Size > len(w.md5s) {
+			continue
+		}
+		md5hex := hex.EncodeToString(w.md5s[start : start+md5.Size])
+		state.Chunks[chunkNumber] = md5hex + ":" + *part.Etag
+	}
+	return state
+}
+
 // WriteChunk will write chunk number with reader bytes, where chunk number >= 0
 func (w *objectChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (bytesWritten int64, err error) {
 	if chunkNumber < 0 {
@@ -198,10 +281,17 @@ func (w *objectChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, rea
 
 }
 
-// add a part number and etag to the completed parts
+// add a part number and etag to the completed parts, replacing any
+// part with the same number
 func (w *objectChunkWriter) addCompletedPart(partNum *int, eTag *string) {
 	w.partsToCommitMu.Lock()
 	defer w.partsToCommitMu.Unlock()
+	for i := range w.partsToCommit {
+		if *w.partsToCommit[i].PartNum == *partNum {
+			w.partsToCommit[i].Etag = eTag
+			return
+		}
+	}
 	w.partsToCommit = append(w.partsToCommit, objectstorage.CommitMultipartUploadPartDetails{
 		PartNum: partNum,
 		Etag:    eTag,
@@ -2582,11 +2582,6 @@ var systemMetadataInfo = map[string]fs.MetadataHelp{
 		Type:    "string",
 		Example: "text/plain",
 	},
-	// "tagging": {
-	// 	Help:    "x-amz-tagging header",
-	// 	Type:    "string",
-	// 	Example: "tag1=value1&tag2=value2",
-	// },
 	"tier": {
 		Help:     "Tier of the object",
 		Type:     "string",
@@ -2598,6 +2593,11 @@ var systemMetadataInfo = map[string]fs.MetadataHelp{
 		Type:    "RFC 3339",
 		Example: "2006-01-02T15:04:05.999999999Z07:00",
 	},
+	"x-amz-tagging": {
+		Help:    "Tags of the object as URL query parameters, read with an extra request",
+		Type:    "string",
+		Example: "tag1=value1&tag2=value2",
+	},
 	"btime": {
 		Help:     "Time of file birth (creation) read from Last-Modified header",
 		Type:     "RFC 3339",
@@ -5703,10 +5703,121 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 	return info, chunkWriter, err
 }
 
-// add a part number and etag to the completed parts
+// ResumeChunkWriter carries on the multipart upload described by
+// state which was started by OpenChunkWriter.
+//
+// Only the parts in state which are still present in the upload are
+// kept, the others will need writing again.
+func (f *Fs) ResumeChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, state fs.ChunkWriterState, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	// Temporary Object under construction
+	o := &Object{
+		fs:     f,
+		remote: remote,
+	}
+	ui, err := o.prepareUpload(ctx, src, options)
+	if err != nil {
+		return info, nil, fmt.Errorf("failed to prepare upload: %w", err)
+	}
+	var mReq s3.CreateMultipartUploadInput
+	setFrom_s3CreateMultipartUploadInput_s3PutObjectInput(&mReq, ui.req)
+
+	// Read the ETags of the parts in the upload
+	eTags := map[int64]string{}
+	req := s3.ListPartsInput{
+		Bucket:               mReq.Bucket,
+		Key:                  mReq.Key,
+		UploadId:             &state.ID,
+		RequestPayer:         mReq.RequestPayer,
+		SSECustomerAlgorithm: mReq.SSECustomerAlgorithm,
+		SSECustomerKey:       mReq.SSECustomerKey,
+		SSECustomerKeyMD5:    mReq.SSECustomerKeyMD5,
+	}
+	for {
+		var resp *s3.ListPartsOutput
+		err = f.pacer.Call(func() (bool, error) {
+			resp, err = f.c.ListPartsWithContext(ctx, &req)
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return info, nil, fmt.Errorf("failed to list parts of multipart upload %q: %w", state.ID, err)
+		}
+		for _, part := range resp.Parts {
+			eTags[aws.Int64Value(part.PartNumber)] = aws.StringValue(part.ETag)
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
+			break
+		}
+		req.PartNumberMarker = resp.NextPartNumberMarker
+	}
+
+	chunkWriter := &s3ChunkWriter{
+		chunkSize:            state.ChunkSize,
+		size:                 src.Size(),
+		f:                    f,
+		bucket:               mReq.Bucket,
+		key:                  mReq.Key,
+		uploadID:             aws.String(state.ID),
+		multiPartUploadInput: &mReq,
+		completedParts:       make([]*s3.CompletedPart, 0, len(state.Chunks)),
+		ui:                   ui,
+		o:                    o,
+	}
+	for chunkNumber, record := range state.Chunks {
+		md5hex, eTag, _ := strings.Cut(record, ":")
+		md5binary, err := hex.DecodeString(md5hex)
+		partNumber := int64(chunkNumber + 1)
+		if err != nil || len(md5binary) != md5.Size || eTags[partNumber] != eTag {
+			fs.Debugf(o, "resume chunk writer: part %d missing or changed so will upload again", partNumber)
+			continue
+		}
+		chunkWriter.addMd5(&md5binary, int64(chunkNumber))
+		chunkWriter.addCompletedPart(aws.Int64(partNumber), aws.String(eTag))
+	}
+	info = fs.ChunkWriterInfo{
+		ChunkSize:         state.ChunkSize,
+		Concurrency:       o.fs.opt.UploadConcurrency,
+		LeavePartsOnError: o.fs.opt.LeavePartsOnError,
+	}
+	fs.Debugf(o, "resume chunk writer: resumed multipart upload %v with %d parts", state.ID, len(chunkWriter.completedParts))
+	return info, chunkWriter, nil
+}
+
+// ChunkWriterState returns the state of the multipart upload so far
+//
+// The record of each chunk is its MD5 in hex and its ETag.
+func (w *s3ChunkWriter) ChunkWriterState() fs.ChunkWriterState {
+	w.completedPartsMu.Lock()
+	defer w.completedPartsMu.Unlock()
+	w.md5sMu.Lock()
+	defer w.md5sMu.Unlock()
+	state := fs.ChunkWriterState{
+		ID:        *w.uploadID,
+		ChunkSize: w.chunkSize,
+		Chunks:    make(map[int]string, len(w.completedParts)),
+	}
+	for _, part := range w.completedParts {
+		chunkNumber := *part.PartNumber - 1
+		start := chunkNumber * md5.Size
+		if start+md5.Size > int64(len(w.md5s)) {
+			continue
+		}
+		md5hex := hex.EncodeToString(w.md5s[start : start+md5.Size])
+		state.Chunks[int(chunkNumber)] = md5hex + ":" + aws.StringValue(part.ETag)
+	}
+	return state
+}
+
+// add a part number and etag to the completed parts, replacing any
+// part with the same number
 func (w *s3ChunkWriter) addCompletedPart(partNum *int64, eTag *string) {
 	w.completedPartsMu.Lock()
 	defer w.completedPartsMu.Unlock()
+	for _, part := range w.completedParts {
+		if *part.PartNumber == *partNum {
+			part.ETag = eTag
+			return
+		}
+	}
 	w.completedParts = append(w.completedParts, &s3.CompletedPart{
 		PartNumber: partNum,
 		ETag:       eTag,
@@ -6328,7 +6439,6 @@ func (o *Object) Metadata(ctx context.Context) (metadata fs.Metadata, err error)
 	if o.mimeType != "" {
 		metadata["content-type"] = o.mimeType
 	}
-	// metadata["x-amz-tagging"] = ""
 	if !o.lastModified.IsZero() {
 		metadata["btime"] = o.lastModified.Format(time.RFC3339Nano)
 	}
@@ -6348,23 +6458,61 @@ func (o *Object) Metadata(ctx context.Context) (metadata fs.Metadata, err error)
 	setMetadata("content-encoding", o.contentEncoding)
 	setMetadata("content-language", o.contentLanguage)
 	metadata["tier"] = o.GetTier()
+	if !o.fs.opt.NoSystemMetadata {
+		if tagging := o.getTagging(ctx); tagging != "" {
+			metadata["x-amz-tagging"] = tagging
+		}
+	}
 
 	return metadata, nil
 }
 
+// getTagging returns the tags of the object in the format of the
+// x-amz-tagging header, or "" if it has none or they can't be read
+func (o *Object) getTagging(ctx context.Context) string {
+	bucket, bucketPath := o.split()
+	req := s3.GetObjectTaggingInput{
+		Bucket:    &bucket,
+		Key:       &bucketPath,
+		VersionId: o.versionID,
+	}
+	if o.fs.opt.RequesterPays {
+		req.RequestPayer = aws.String(s3.RequestPayerRequester)
+	}
+	var resp *s3.GetObjectTaggingOutput
+	err := o.fs.pacer.Call(func() (bool, error) {
+		var err error
+		resp, err = o.fs.c.GetObjectTaggingWithContext(ctx, &req)
+		return o.fs.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		// Not all providers support tagging and reading the
+		// tags needs its own permission
+		fs.Debugf(o, "Failed to read tags: %v", err)
+		return ""
+	}
+	tags := url.Values{}
+	for _, tag := range resp.TagSet {
+		tags.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+	}
+	return tags.Encode()
+}
+
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = &Fs{}
-	_ fs.Purger          = &Fs{}
-	_ fs.Copier          = &Fs{}
-	_ fs.PutStreamer     = &Fs{}
-	_ fs.ListRer         = &Fs{}
-	_ fs.Commander       = &Fs{}
-	_ fs.CleanUpper      = &Fs{}
-	_ fs.OpenChunkWriter = &Fs{}
-	_ fs.Object          = &Object{}
-	_ fs.MimeTyper       = &Object{}
-	_ fs.GetTierer       = &Object{}
-	_ fs.SetTierer       = &Object{}
-	_ fs.Metadataer      = &Object{}
+	_ fs.Fs                = &Fs{}
+	_ fs.Purger            = &Fs{}
+	_ fs.Copier            = &Fs{}
+	_ fs.PutStreamer       = &Fs{}
+	_ fs.ListRer           = &Fs{}
+	_ fs.Commander         = &Fs{}
+	_ fs.CleanUpper        = &Fs{}
+	_ fs.OpenChunkWriter   = &Fs{}
+	_ fs.ResumeChunkWriter = &Fs{}
+	_ fs.ChunkWriterStater = &s3ChunkWriter{}
+	_ fs.Object            = &Object{}
+	_ fs.MimeTyper         = &Object{}
+	_ fs.GetTierer         = &Object{}
+	_ fs.SetTierer         = &Object{}
+	_ fs.Metadataer        = &Object{}
 )
@@ -55,6 +55,7 @@ func (f *Fs) InternalTestMetadata(t *testing.T) {
 		"content-language":    "en-US",
 		"content-type":        "text/plain",
 		"mtime":               "2009-05-06T04:05:06.499999999Z",
+		"x-amz-tagging":       "tag1=value1&tag2=value2",
 		// "tier" - read only
 		// "btime" - read only
 	}
@@ -0,0 +1,62 @@
+// Package archive provides the archive command.
+package archive
+
+import (
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/lib/archive"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	format = ""
+)
+
+func init() {
+	cmd.Root.AddCommand(Command)
+	for _, command := range []*cobra.Command{createCommand, listCommand, extractCommand} {
+		Command.AddCommand(command)
+		flags.StringVarP(command.Flags(), &format, "format", "", format, "Archive format (zip, tar, tar.gz) - worked out from the extension if not set", "")
+	}
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "archive <subcommand>",
+	Short: `Create, list and extract archives on remotes.`,
+	Long: `
+rclone archive reads and writes zip, tar and gzip compressed tar
+archives stored on any remote without needing a local copy.
+
+Select what you want to do with the subcommand, eg
+
+    rclone archive create remote:dir remote:backup/dir.tar.gz
+    rclone archive list remote:backup/dir.tar.gz
+    rclone archive extract remote:backup/dir.tar.gz remote:restored
+
+The archive format is worked out from the extension of the archive
+(` + "`.zip`, `.tar`, `.tar.gz` or `.tgz`" + `) unless the ` + "`--format`" + ` flag
+is used.
+
+Archives are streamed to and from the remote. Zip archives and
+uncompressed tar archives can be read with range requests, so listing
+them is quick. Gzip compressed tar archives have to be read from the
+start.
+
+To look inside archives with the other rclone commands, or to mount
+them, use the archive backend.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+	},
+}
+
+// getFormat returns the format of the archive called name
+func getFormat(name string) (f archive.Format, err error) {
+	if format != "" {
+		err = f.Set(format)
+		return f, err
+	}
+	return archive.FormatFromName(name)
+}
@@ -0,0 +1,149 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/archive"
+	"github.com/spf13/cobra"
+)
+
+var createCommand = &cobra.Command{
+	Use:   "create source:path dest:path/archive",
+	Short: `Create an archive from the files in source:path.`,
+	Long: `
+Create an archive containing the files and directories in source:path
+and upload it to dest:path/archive.
+
+    rclone archive create remote:dir remote:backup/dir.zip
+
+The archive is streamed straight to the destination so no local disk
+space is needed. Filters may be used to choose which files go into the
+archive.
+
+The modification times of the files are stored in the archive. If the
+` + "`--metadata`/`-M`" + ` flag is given and the source supports it then
+the file permissions are stored too.
+
+Tar archives need to know the size of each file in advance, so files
+of unknown size can only be stored in zip archives.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc := cmd.NewFsSrc(args)
+		fdst, dstFileName := cmd.NewFsDstFile(args[1:])
+		archiveFormat, err := getFormat(dstFileName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cmd.Run(false, true, command, func() error {
+			return create(context.Background(), fsrc, fdst, dstFileName, archiveFormat)
+		})
+	},
+}
+
+// create makes an archive of fsrc in fdst/dstFileName
+func create(ctx context.Context, fsrc fs.Fs, fdst fs.Fs, dstFileName string, archiveFormat archive.Format) (err error) {
+	ci := fs.GetConfig(ctx)
+	var entries fs.DirEntries
+	err = walk.ListR(ctx, fsrc, "", false, ci.MaxDepth, walk.ListAll, func(dirEntries fs.DirEntries) error {
+		entries = append(entries, dirEntries...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list source: %w", err)
+	}
+	// Store entries in a stable order with each directory
+	// before its contents
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Remote() < entries[j].Remote()
+	})
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		w := archive.NewWriter(pw, archiveFormat)
+		err := writeEntries(ctx, w, entries)
+		if err == nil {
+			err = w.Close()
+		}
+		_ = pw.CloseWithError(err)
+		done <- err
+	}()
+	_, err = operations.Rcat(ctx, fdst, dstFileName, pr, time.Now(), nil)
+	// Unblock the writer if the upload failed
+	_ = pr.CloseWithError(err)
+	writeErr := <-done
+	if err == nil {
+		err = writeErr
+	}
+	return err
+}
+
+// writeEntries adds all the entries to the archive
+func writeEntries(ctx context.Context, w *archive.Writer, entries fs.DirEntries) error {
+	ci := fs.GetConfig(ctx)
+	for _, entry := range entries {
+		e := &archive.Entry{
+			Path:    entry.Remote(),
+			Size:    entry.Size(),
+			ModTime: entry.ModTime(ctx),
+		}
+		switch x := entry.(type) {
+		case fs.Directory:
+			e.IsDir = true
+			e.Mode = 0755
+			err := w.Add(e, nil)
+			if err != nil {
+				return err
+			}
+		case fs.Object:
+			e.Mode = 0644
+			if ci.Metadata {
+				e.Mode = objectMode(ctx, x, e.Mode)
+			}
+			err := addObject(ctx, w, e, x)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addObject adds the contents of o to the archive
+func addObject(ctx context.Context, w *archive.Writer, e *archive.Entry, o fs.Object) (err error) {
+	in, err := operations.Open(ctx, o)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", o.Remote(), err)
+	}
+	defer fs.CheckClose(in, &err)
+	return w.Add(e, in)
+}
+
+// objectMode reads the permissions of o from its metadata returning
+// defaultMode if not found
+func objectMode(ctx context.Context, o fs.Object, defaultMode os.FileMode) os.FileMode {
+	metadata, err := fs.GetMetadata(ctx, o)
+	if err != nil || metadata == nil {
+		return defaultMode
+	}
+	mode, err := strconv.ParseUint(metadata["mode"], 8, 32)
+	if err != nil {
+		return defaultMode
+	}
+	return os.FileMode(mode).Perm()
+}
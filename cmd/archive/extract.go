@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/archive"
+	"github.com/spf13/cobra"
+)
+
+var extractCommand = &cobra.Command{
+	Use:   "extract remote:path/archive dest:path",
+	Short: `Extract the contents of an archive to dest:path.`,
+	Long: `
+Extract the files and directories in the archive at remote:path/archive
+into dest:path.
+
+    rclone archive extract remote:backup/dir.tar.gz remote:restored
+
+The archive is read in a single pass and each file is uploaded to the
+destination as it is read, so no local disk space is needed. Filters
+may be used to choose which files are extracted.
+
+The modification times stored in the archive are set on the extracted
+files. If the ` + "`--metadata`/`-M`" + ` flag is given then the
+permissions are set too, if the destination supports it.
+
+Paths in the archive which would escape dest:path (for example those
+starting with ` + "`../`" + `) are cleaned so they extract inside it.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		src := newArchiveObject(args[0])
+		fdst := cmd.NewFsDir(args[1:])
+		archiveFormat, err := getFormat(src.Remote())
+		if err != nil {
+			log.Fatal(err)
+		}
+		cmd.Run(false, true, command, func() error {
+			return extract(context.Background(), src, fdst, archiveFormat)
+		})
+	},
+}
+
+// extract unpacks the archive in src into fdst
+func extract(ctx context.Context, src fs.Object, fdst fs.Fs, archiveFormat archive.Format) error {
+	ci := fs.GetConfig(ctx)
+	fi := filter.GetConfig(ctx)
+	return archive.Walk(ctx, src, archiveFormat, func(e *archive.Entry, in io.Reader) error {
+		if e.IsDir {
+			if !fi.IncludeRemote(e.Path+"/") || !fdst.Features().CanHaveEmptyDirectories {
+				return nil
+			}
+			err := operations.Mkdir(ctx, fdst, e.Path)
+			if err != nil {
+				return fmt.Errorf("failed to make directory %q: %w", e.Path, err)
+			}
+			return nil
+		}
+		var metadata fs.Metadata
+		if ci.Metadata {
+			metadata = e.Metadata()
+		}
+		if !fi.Include(e.Path, e.Size, e.ModTime, metadata) {
+			return nil
+		}
+		_, err := operations.RcatSize(ctx, fdst, e.Path, io.NopCloser(in), e.Size, e.ModTime, metadata)
+		if err != nil {
+			return fmt.Errorf("failed to extract %q: %w", e.Path, err)
+		}
+		return nil
+	})
+}
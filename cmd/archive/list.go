@@ -0,0 +1,81 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/lib/archive"
+	"github.com/spf13/cobra"
+)
+
+var listCommand = &cobra.Command{
+	Use:   "list remote:path/archive",
+	Short: `List the contents of an archive.`,
+	Long: `
+List the files and directories in the archive at remote:path/archive
+with their size and modification time, in the same format as
+` + "`rclone lsl`" + `. Directories are shown with a trailing ` + "`/`" + `.
+
+    rclone archive list remote:backup/dir.zip
+
+Filters may be used to choose which entries are listed.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		src := newArchiveObject(args[0])
+		archiveFormat, err := getFormat(src.Remote())
+		if err != nil {
+			log.Fatal(err)
+		}
+		cmd.Run(false, false, command, func() error {
+			return list(context.Background(), os.Stdout, src, archiveFormat)
+		})
+	},
+}
+
+// newArchiveObject finds the archive object pointed to by remote
+func newArchiveObject(remote string) fs.Object {
+	f, fileName := cmd.NewFsFile(remote)
+	if fileName == "" {
+		log.Fatalf("%q is not a file", remote)
+	}
+	o, err := f.NewObject(context.Background(), fileName)
+	if err != nil {
+		log.Fatalf("Failed to find archive %q: %v", remote, err)
+	}
+	return o
+}
+
+// list writes the entries of the archive in src to out
+func list(ctx context.Context, out io.Writer, src fs.Object, archiveFormat archive.Format) error {
+	fi := filter.GetConfig(ctx)
+	a, err := archive.New(ctx, src, archiveFormat)
+	if err != nil {
+		return err
+	}
+	for _, e := range a.Entries {
+		name := e.Path
+		if e.IsDir {
+			if !fi.IncludeRemote(name + "/") {
+				continue
+			}
+			name += "/"
+		} else if !fi.Include(name, e.Size, e.ModTime, nil) {
+			continue
+		}
+		_, err = fmt.Fprintf(out, "%9d %s %s\n", e.Size, e.ModTime.Local().Format("2006-01-02 15:04:05.000000000"), name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Package backup provides the backup command.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+// For overriding in unittests.
+var (
+	timeNowFunc = time.Now
+)
+
+func init() {
+	cmd.Root.AddCommand(Command)
+	Command.AddCommand(listCommand, restoreCommand, pruneCommand)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "backup source:path dest:path",
+	Short: `Make a point in time snapshot of source:path in dest:path.`,
+	Long: `
+rclone backup copies the files in source:path into a new snapshot in
+the backup repository at dest:path. Each snapshot is a complete copy
+of the source as it was when the backup was made, so it can be
+browsed and restored with the normal rclone commands as well as with
+the backup subcommands.
+
+    rclone backup /home/user remote:backups/home
+
+The repository is laid out like this
+
+    snapshots/2024-01-02T03-04-05Z/      - the files in the snapshot
+    snapshots/2024-01-02T03-04-05Z.json  - the manifest of the snapshot
+
+The snapshot is named after the UTC time it was started. The manifest
+lists the path, size, modification time and hashes of every file in
+the snapshot. It is written once all the files have been copied, so a
+snapshot without a manifest is incomplete and is ignored.
+
+Files which haven't changed size or modification time since the
+previous snapshot are copied from the previous snapshot using server
+side copy if dest:path supports it, so they don't need to be uploaded
+again. Otherwise every file is copied from the source.
+
+Filters may be used to choose which files are backed up.
+
+Use the subcommands to look after the repository
+
+    rclone backup list remote:backups/home
+    rclone backup restore remote:backups/home /home/user --at 2024-01-02
+    rclone backup prune remote:backups/home --keep-daily 7 --keep-weekly 4
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+		"groups":            "Filter,Listing,Copy",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc, fdst := cmd.NewFsSrcDst(args)
+		cmd.Run(true, true, command, func() error {
+			_, err := Backup(context.Background(), fdst, fsrc)
+			return err
+		})
+	},
+}
+
+// Backup makes a new snapshot of fsrc in the repository repo and
+// returns its manifest.
+func Backup(ctx context.Context, repo, fsrc fs.Fs) (*Manifest, error) {
+	ci := fs.GetConfig(ctx)
+	if operations.OverlappingFilterCheck(ctx, repo, fsrc) {
+		return nil, fs.ErrorOverlapping
+	}
+
+	now := timeNowFunc().UTC()
+	m := &Manifest{
+		Version: manifestVersion,
+		ID:      now.Format(idFormat),
+		Time:    now,
+		Source:  fs.ConfigString(fsrc),
+	}
+	dir := snapshotDir(m.ID)
+
+	// Find the previous snapshot to copy unchanged files from
+	ids, err := Snapshots(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	previous := map[string]*Entry{}
+	var previousDir string
+	if len(ids) > 0 {
+		last := ids[len(ids)-1]
+		if last >= m.ID {
+			return nil, fmt.Errorf("snapshot %s already exists - wait and try again", last)
+		}
+		if repo.Features().Copy != nil {
+			prev, err := ReadManifest(ctx, repo, last)
+			if err != nil {
+				return nil, err
+			}
+			for i := range prev.Files {
+				previous[prev.Files[i].Path] = &prev.Files[i]
+			}
+			previousDir = snapshotDir(last)
+			fs.Infof(repo, "Copying unchanged files from snapshot %s", last)
+		}
+	}
+
+	var objects []fs.Object
+	err = walk.ListR(ctx, fsrc, "", false, ci.MaxDepth, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(o fs.Object) {
+			objects = append(objects, o)
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("backup: failed to list source: %w", err)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Remote() < objects[j].Remote()
+	})
+
+	// Copy the files into the snapshot
+	hashType := repo.Hashes().GetOne()
+	m.Files = make([]Entry, len(objects))
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(ci.Transfers)
+	for i, o := range objects {
+		entry := &m.Files[i]
+		o := o
+		g.Go(func() error {
+			remote := o.Remote()
+			*entry = Entry{
+				Path:    remote,
+				Size:    o.Size(),
+				ModTime: o.ModTime(gCtx).UTC(),
+			}
+			src := o
+			if prev := previous[remote]; prev != nil && prev.Size == entry.Size && prev.ModTime.Equal(entry.ModTime) {
+				prevObj, err := repo.NewObject(gCtx, previousDir+"/"+remote)
+				if err == nil {
+					src = prevObj
+					entry.Hashes = prev.Hashes
+				} else {
+					fs.Debugf(o, "Not found in previous snapshot so copying from source: %v", err)
+				}
+			}
+			dst, err := operations.Copy(gCtx, repo, nil, dir+"/"+remote, src)
+			if err != nil {
+				return fmt.Errorf("backup: failed to copy %q: %w", remote, err)
+			}
+			if entry.Hashes == nil && dst != nil && hashType != hash.None {
+				sum, err := dst.Hash(gCtx, hashType)
+				if err != nil {
+					fs.Debugf(dst, "Failed to read hash: %v", err)
+				} else if sum != "" {
+					entry.Hashes = map[string]string{hashType.String(): sum}
+				}
+			}
+			return nil
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		// Remove the incomplete snapshot so it doesn't waste space
+		purgeErr := operations.Purge(ctx, repo, dir)
+		if purgeErr != nil && !errors.Is(purgeErr, fs.ErrorDirNotFound) {
+			fs.Errorf(repo, "Failed to remove incomplete snapshot %s: %v", m.ID, purgeErr)
+		}
+		return nil, err
+	}
+
+	if operations.SkipDestructive(ctx, manifestName(m.ID), "write manifest") {
+		return m, nil
+	}
+	err = writeManifest(ctx, repo, m)
+	if err != nil {
+		return nil, err
+	}
+	fs.Infof(repo, "Made snapshot %s of %d files", m.ID, len(m.Files))
+	return m, nil
+}
@@ -0,0 +1,223 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	_ "github.com/rclone/rclone/backend/memory"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = fstest.Time("2017-02-03T04:05:06.499999999Z")
+	t2 = fstest.Time("2018-03-04T05:06:07.123456789Z")
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+// setTime makes the next snapshot be made at t
+func setTime(t *testing.T, when string) {
+	oldTimeNowFunc := timeNowFunc
+	timeNowFunc = func() time.Time { return fstest.Time(when) }
+	t.Cleanup(func() { timeNowFunc = oldTimeNowFunc })
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	r.WriteFile("dir/file1", "file1 contents", t1)
+	r.WriteFile("file2", "file2 contents", t1)
+
+	setTime(t, "2024-01-01T02:00:00Z")
+	m1, err := Backup(ctx, r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-01T02-00-00Z", m1.ID)
+	require.Equal(t, 2, len(m1.Files))
+	assert.Equal(t, "dir/file1", m1.Files[0].Path)
+	assert.Equal(t, int64(14), m1.Files[0].Size)
+	assert.True(t, m1.Files[0].ModTime.Equal(t1))
+	assert.Equal(t, int64(28), m1.Size())
+
+	// Change one file and make a second snapshot
+	r.WriteFile("file2", "file2 contents changed", t2)
+	setTime(t, "2024-01-02T02:00:00Z")
+	_, err = Backup(ctx, r.Fremote, r.Flocal)
+	require.NoError(t, err)
+
+	// Making a snapshot at the same time fails
+	_, err = Backup(ctx, r.Fremote, r.Flocal)
+	assert.ErrorContains(t, err, "already exists")
+
+	ids, err := Snapshots(ctx, r.Fremote)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2024-01-01T02-00-00Z", "2024-01-02T02-00-00Z"}, ids)
+
+	got, err := ReadManifest(ctx, r.Fremote, ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, m1.Files, got.Files)
+	assert.True(t, m1.Time.Equal(got.Time))
+
+	var out bytes.Buffer
+	require.NoError(t, list(ctx, &out, r.Fremote))
+	assert.Contains(t, out.String(), "2024-01-01T02-00-00Z")
+	assert.Contains(t, out.String(), "2024-01-02T02-00-00Z")
+
+	// Restore the first snapshot
+	restored, err := fs.NewFs(ctx, r.LocalName+"/restored")
+	require.NoError(t, err)
+	m, err := Restore(ctx, restored, r.Fremote, fstest.Time("2024-01-01T12:00:00Z"))
+	require.NoError(t, err)
+	assert.Equal(t, ids[0], m.ID)
+	fstest.CheckListingWithPrecision(t, restored, []fstest.Item{
+		fstest.NewItem("dir/file1", "file1 contents", t1),
+		fstest.NewItem("file2", "file2 contents", t1),
+	}, nil, fs.GetModifyWindow(ctx, restored))
+
+	// Restore the latest snapshot
+	require.NoError(t, operations.Purge(ctx, restored, ""))
+	m, err = Restore(ctx, restored, r.Fremote, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, ids[1], m.ID)
+	fstest.CheckListingWithPrecision(t, restored, []fstest.Item{
+		fstest.NewItem("dir/file1", "file1 contents", t1),
+		fstest.NewItem("file2", "file2 contents changed", t2),
+	}, nil, fs.GetModifyWindow(ctx, restored))
+
+	// No snapshot this early
+	_, err = Restore(ctx, restored, r.Fremote, fstest.Time("2023-01-01T00:00:00Z"))
+	assert.ErrorContains(t, err, "no snapshots made at or before")
+}
+
+func TestBackupServerSideCopy(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	r.WriteFile("unchanged", "unchanged contents", t1)
+	r.WriteFile("changed", "old contents", t1)
+	repo, err := fs.NewFs(ctx, ":memory:backup-test")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = operations.Purge(ctx, repo, "") })
+
+	setTime(t, "2024-01-01T02:00:00Z")
+	_, err = Backup(ctx, repo, r.Flocal)
+	require.NoError(t, err)
+
+	r.WriteFile("changed", "new contents", t2)
+	setTime(t, "2024-01-02T02:00:00Z")
+	ctx = accounting.WithStatsGroup(ctx, "backup-test")
+	stats := accounting.Stats(ctx)
+	m, err := Backup(ctx, repo, r.Flocal)
+	require.NoError(t, err)
+	out, err := stats.RemoteStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), out["serverSideCopies"])
+	assert.Equal(t, int64(len("unchanged contents")), out["serverSideCopyBytes"])
+
+	require.Equal(t, 2, len(m.Files))
+	for _, entry := range m.Files {
+		assert.NotEmpty(t, entry.Hashes["md5"], entry.Path)
+	}
+	snapshot, err := snapshotFs(ctx, repo, m.ID)
+	require.NoError(t, err)
+	fstest.CheckListingWithPrecision(t, snapshot, []fstest.Item{
+		fstest.NewItem("changed", "new contents", t2),
+		fstest.NewItem("unchanged", "unchanged contents", t1),
+	}, nil, fs.GetModifyWindow(ctx, snapshot))
+}
+
+func TestBackupDryRun(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	r.WriteFile("file", "contents", t1)
+	ci.DryRun = true
+
+	_, err := Backup(ctx, r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	ids, err := Snapshots(ctx, r.Fremote)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(ids))
+}
+
+func TestBackupOverlapping(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	repo, err := fs.NewFs(ctx, r.LocalName+"/backups")
+	require.NoError(t, err)
+	_, err = Backup(ctx, repo, r.Flocal)
+	assert.Equal(t, fs.ErrorOverlapping, err)
+}
+
+func TestPolicyKeep(t *testing.T) {
+	// A snapshot every 12 hours for 30 days, newest first
+	start := time.Date(2024, 1, 1, 6, 0, 0, 0, time.Local)
+	var times []time.Time
+	for i := 59; i >= 0; i-- {
+		times = append(times, start.Add(time.Duration(i)*12*time.Hour))
+	}
+	kept := func(p Policy) (n int) {
+		for _, keep := range p.keep(times) {
+			if keep {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Equal(t, 0, kept(Policy{}))
+	assert.Equal(t, 3, kept(Policy{Last: 3}))
+	assert.Equal(t, 7, kept(Policy{Daily: 7}))
+	assert.Equal(t, 60, kept(Policy{Hourly: 100}))
+	assert.Equal(t, 30, kept(Policy{Daily: 100}))
+	assert.Equal(t, 5, kept(Policy{Weekly: 100}))
+	assert.Equal(t, 1, kept(Policy{Monthly: 1}))
+	assert.Equal(t, 1, kept(Policy{Yearly: 5}))
+	// The daily snapshots cover the latest weekly ones
+	assert.Equal(t, 7+2, kept(Policy{Daily: 7, Weekly: 4}))
+
+	// The last snapshot of the day is kept
+	keep := Policy{Daily: 2}.keep(times)
+	assert.Equal(t, []bool{true, false, true, false}, keep[:4])
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	r.WriteFile("file", "contents", t1)
+	for _, when := range []string{"2024-01-01T12:00:00Z", "2024-01-01T13:00:00Z", "2024-01-02T12:00:00Z", "2024-01-03T12:00:00Z"} {
+		setTime(t, when)
+		_, err := Backup(ctx, r.Fremote, r.Flocal)
+		require.NoError(t, err)
+	}
+
+	_, err := Prune(ctx, r.Fremote, Policy{})
+	assert.Equal(t, ErrorNoPolicy, err)
+
+	// Check --dry-run doesn't remove anything
+	dryCtx, ci := fs.AddConfig(ctx)
+	ci.DryRun = true
+	_, err = Prune(dryCtx, r.Fremote, Policy{Last: 1})
+	require.NoError(t, err)
+	ids, err := Snapshots(ctx, r.Fremote)
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(ids))
+
+	removed, err := Prune(ctx, r.Fremote, Policy{Last: 1, Daily: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2024-01-01T13-00-00Z", "2024-01-01T12-00-00Z"}, removed)
+	ids, err = Snapshots(ctx, r.Fremote)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2024-01-02T12-00-00Z", "2024-01-03T12-00-00Z"}, ids)
+	entries, err := r.Fremote.List(ctx, "snapshots")
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(entries))
+}
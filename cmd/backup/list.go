@@ -0,0 +1,59 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/spf13/cobra"
+)
+
+var listCommand = &cobra.Command{
+	Use:   "list dest:path",
+	Short: `List the snapshots in a backup repository.`,
+	Long: `
+List the complete snapshots in the backup repository at dest:path,
+oldest first, showing the ID of each snapshot, the local time it was
+made, the number of files, their total size and where they were
+backed up from.
+
+    $ rclone backup list remote:backups/home
+    2024-01-01T02-00-00Z  2024-01-01 02:00:00      1234   1.500 GiB  /home/user
+    2024-01-02T02-00-00Z  2024-01-02 02:00:00      1240   1.503 GiB  /home/user
+
+The ID can be used to find the files of the snapshot in
+` + "`dest:path/snapshots/ID`" + `.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		repo := cmd.NewFsDir(args)
+		cmd.Run(false, false, command, func() error {
+			return list(context.Background(), os.Stdout, repo)
+		})
+	},
+}
+
+// list writes a line describing each snapshot in repo to out
+func list(ctx context.Context, out io.Writer, repo fs.Fs) error {
+	ids, err := Snapshots(ctx, repo)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		m, err := ReadManifest(ctx, repo, id)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s  %s  %8d  %10s  %s\n", m.ID, m.Time.Local().Format("2006-01-02 15:04:05"), len(m.Files), fs.SizeSuffix(m.Size()).ByteUnit(), m.Source)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+const (
+	// manifestVersion is the version of the manifest format written
+	manifestVersion = 1
+	// snapshotsDir is the directory in the repository holding the snapshots
+	snapshotsDir = "snapshots"
+	// manifestExt is the extension of the manifest files
+	manifestExt = ".json"
+	// idFormat is the time format used for snapshot IDs
+	idFormat = "2006-01-02T15-04-05Z"
+)
+
+// Manifest describes a snapshot.
+//
+// It is stored in the repository as snapshots/<ID>.json next to the
+// directory snapshots/<ID> which holds the files. The manifest is
+// written after all the files have been copied, so only snapshots with
+// a manifest are complete.
+type Manifest struct {
+	Version int       `json:"version"`
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Files   []Entry   `json:"files"`
+}
+
+// Entry describes a file in a snapshot
+type Entry struct {
+	Path    string            `json:"path"`
+	Size    int64             `json:"size"`
+	ModTime time.Time         `json:"modTime"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+// Size returns the total size of the files in the snapshot
+func (m *Manifest) Size() (size int64) {
+	for i := range m.Files {
+		size += m.Files[i].Size
+	}
+	return size
+}
+
+// snapshotDir returns the directory in the repository holding the
+// files of snapshot id
+func snapshotDir(id string) string {
+	return path.Join(snapshotsDir, id)
+}
+
+// manifestName returns the name of the manifest of snapshot id in the
+// repository
+func manifestName(id string) string {
+	return snapshotDir(id) + manifestExt
+}
+
+// parseID returns the time of the snapshot with id
+func parseID(id string) (time.Time, error) {
+	return time.Parse(idFormat, id)
+}
+
+// snapshotFs returns an Fs pointing at the files of snapshot id in repo
+func snapshotFs(ctx context.Context, repo fs.Fs, id string) (fs.Fs, error) {
+	return cache.Get(ctx, fspath.JoinRootPath(fs.ConfigStringFull(repo), snapshotDir(id)))
+}
+
+// Snapshots returns the IDs of the complete snapshots in repo, oldest
+// first
+func Snapshots(ctx context.Context, repo fs.Fs) (ids []string, err error) {
+	entries, err := repo.List(ctx, snapshotsDir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	for _, entry := range entries {
+		o, ok := entry.(fs.Object)
+		if !ok {
+			continue
+		}
+		name := path.Base(o.Remote())
+		if !strings.HasSuffix(name, manifestExt) {
+			continue
+		}
+		id := strings.TrimSuffix(name, manifestExt)
+		if _, err := parseID(id); err != nil {
+			fs.Debugf(o, "Ignoring file which isn't a snapshot manifest")
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ReadManifest reads the manifest of snapshot id from repo
+func ReadManifest(ctx context.Context, repo fs.Fs, id string) (m *Manifest, err error) {
+	o, err := repo.NewObject(ctx, manifestName(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find manifest of snapshot %s: %w", id, err)
+	}
+	in, err := operations.Open(ctx, o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest of snapshot %s: %w", id, err)
+	}
+	defer fs.CheckClose(in, &err)
+	m = new(Manifest)
+	err = json.NewDecoder(in).Decode(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest of snapshot %s: %w", id, err)
+	}
+	if m.Version > manifestVersion {
+		return nil, fmt.Errorf("manifest of snapshot %s has version %d but this rclone only understands up to version %d", id, m.Version, manifestVersion)
+	}
+	return m, nil
+}
+
+// writeManifest writes m to repo, marking the snapshot complete
+func writeManifest(ctx context.Context, repo fs.Fs, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = operations.Rcat(ctx, repo, manifestName(m.ID), io.NopCloser(bytes.NewReader(data)), m.Time, nil)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest of snapshot %s: %w", m.ID, err)
+	}
+	return nil
+}
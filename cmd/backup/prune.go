@@ -0,0 +1,188 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	policy = Policy{}
+)
+
+func init() {
+	cmdFlags := pruneCommand.Flags()
+	flags.IntVarP(cmdFlags, &policy.Last, "keep-last", "", policy.Last, "Keep the last N snapshots", "")
+	flags.IntVarP(cmdFlags, &policy.Hourly, "keep-hourly", "", policy.Hourly, "Keep the last snapshot of each of the last N hours", "")
+	flags.IntVarP(cmdFlags, &policy.Daily, "keep-daily", "", policy.Daily, "Keep the last snapshot of each of the last N days", "")
+	flags.IntVarP(cmdFlags, &policy.Weekly, "keep-weekly", "", policy.Weekly, "Keep the last snapshot of each of the last N weeks", "")
+	flags.IntVarP(cmdFlags, &policy.Monthly, "keep-monthly", "", policy.Monthly, "Keep the last snapshot of each of the last N months", "")
+	flags.IntVarP(cmdFlags, &policy.Yearly, "keep-yearly", "", policy.Yearly, "Keep the last snapshot of each of the last N years", "")
+}
+
+var pruneCommand = &cobra.Command{
+	Use:   "prune dest:path",
+	Short: `Remove old snapshots from a backup repository.`,
+	Long: `
+Remove the snapshots in the backup repository at dest:path which
+aren't kept by any of the ` + "`--keep-*`" + ` flags.
+
+Each flag keeps the last snapshot in each of the last N periods which
+have a snapshot, so
+
+    rclone backup prune remote:backups/home --keep-daily 7 --keep-weekly 4
+
+keeps the last snapshot of each of the last 7 days which have
+snapshots and the last snapshot of each of the last 4 weeks which have
+snapshots. A snapshot is kept if any of the flags keeps it. Days,
+weeks (which start on Monday), months and years are worked out in
+local time.
+
+At least one ` + "`--keep-*`" + ` flag must be given. The latest snapshot is
+always kept.
+
+The manifest of each snapshot is removed before its files, so an
+interrupted prune never leaves a snapshot which looks complete but
+isn't.
+
+**Important**: Since this can cause data loss, test first with the
+` + "`--dry-run` or the `--interactive`/`-i`" + ` flag.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+		"groups":            "Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		repo := cmd.NewFsDir(args)
+		cmd.Run(true, false, command, func() error {
+			_, err := Prune(context.Background(), repo, policy)
+			return err
+		})
+	},
+}
+
+// Policy says which snapshots Prune keeps.
+//
+// Each field keeps the last snapshot in each of the last N periods
+// which have snapshots.
+type Policy struct {
+	Last    int // keep the last N snapshots
+	Hourly  int // keep the last snapshot in each of the last N hours
+	Daily   int // keep the last snapshot in each of the last N days
+	Weekly  int // keep the last snapshot in each of the last N weeks
+	Monthly int // keep the last snapshot in each of the last N months
+	Yearly  int // keep the last snapshot in each of the last N years
+}
+
+// ErrorNoPolicy is returned by Prune if the policy keeps nothing
+var ErrorNoPolicy = errors.New("no snapshots would be kept - use at least one --keep flag")
+
+// isSet returns true if the policy keeps any snapshots
+func (p Policy) isSet() bool {
+	return p.Last > 0 || p.Hourly > 0 || p.Daily > 0 || p.Weekly > 0 || p.Monthly > 0 || p.Yearly > 0
+}
+
+// keep returns which of the snapshot times should be kept. times
+// must be sorted newest first.
+func (p Policy) keep(times []time.Time) []bool {
+	kept := make([]bool, len(times))
+	buckets := []struct {
+		n      int
+		period func(t time.Time) string
+	}{
+		{p.Last, func(t time.Time) string { return t.Format(time.RFC3339Nano) }},
+		{p.Hourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%04d-%02d", year, week)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{p.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, bucket := range buckets {
+		left := bucket.n
+		last := ""
+		for i, t := range times {
+			if left <= 0 {
+				break
+			}
+			period := bucket.period(t.Local())
+			if period != last {
+				kept[i] = true
+				last = period
+				left--
+			}
+		}
+	}
+	return kept
+}
+
+// Prune removes the snapshots in repo which aren't kept by policy and
+// returns the IDs of the snapshots removed.
+func Prune(ctx context.Context, repo fs.Fs, policy Policy) (removed []string, err error) {
+	if !policy.isSet() {
+		return nil, ErrorNoPolicy
+	}
+	ids, err := Snapshots(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	// Sort newest first
+	times := make([]time.Time, len(ids))
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	for i, id := range ids {
+		times[i], err = parseID(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	kept := policy.keep(times)
+	var errCount int
+	for i, id := range ids {
+		if kept[i] {
+			fs.Debugf(repo, "Keeping snapshot %s", id)
+			continue
+		}
+		err = removeSnapshot(ctx, repo, id)
+		if err != nil {
+			fs.Errorf(repo, "Failed to remove snapshot %s: %v", id, err)
+			errCount++
+			continue
+		}
+		fs.Infof(repo, "Removed snapshot %s", id)
+		removed = append(removed, id)
+	}
+	if errCount > 0 {
+		return removed, fmt.Errorf("prune: failed to remove %d snapshots", errCount)
+	}
+	return removed, nil
+}
+
+// removeSnapshot removes the manifest then the files of snapshot id
+func removeSnapshot(ctx context.Context, repo fs.Fs, id string) error {
+	o, err := repo.NewObject(ctx, manifestName(id))
+	if err != nil {
+		return err
+	}
+	err = operations.DeleteFile(ctx, o)
+	if err != nil {
+		return err
+	}
+	err = operations.Purge(ctx, repo, snapshotDir(id))
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		err = nil
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+)
+
+// Globals
+var (
+	at = fs.Time{}
+)
+
+func init() {
+	flags.FVarP(restoreCommand.Flags(), &at, "at", "", "Restore the latest snapshot made at or before this time or age", "")
+}
+
+var restoreCommand = &cobra.Command{
+	Use:   "restore dest:path target:path",
+	Short: `Restore a snapshot from a backup repository.`,
+	Long: `
+Copy the files in a snapshot in the backup repository at dest:path to
+target:path. Files in target:path which are identical to the files in
+the snapshot are not copied and files in target:path which aren't in
+the snapshot are left alone.
+
+By default the latest snapshot is restored. Use ` + "`--at`" + ` to restore the
+latest snapshot made at or before a time, given either as a date or as
+an age in the same way as ` + "`--max-age`" + `, eg
+
+    rclone backup restore remote:backups/home /home/user --at 2024-01-02
+    rclone backup restore remote:backups/home /home/user --at 3d
+
+Filters may be used to restore only some of the files
+
+    rclone backup restore remote:backups/home /tmp/docs --include "/Documents/**"
+
+If the repository can't store modification times then they are set
+from the manifest of the snapshot after the files are copied.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+		"groups":            "Filter,Listing,Copy",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		repo, fdst := cmd.NewFsSrcDst(args)
+		cmd.Run(true, true, command, func() error {
+			_, err := Restore(context.Background(), fdst, repo, time.Time(at))
+			return err
+		})
+	},
+}
+
+// FindSnapshot returns the ID of the latest snapshot in repo made at
+// or before t, or the latest snapshot if t is zero.
+func FindSnapshot(ctx context.Context, repo fs.Fs, t time.Time) (string, error) {
+	ids, err := Snapshots(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+	for i := len(ids) - 1; i >= 0; i-- {
+		snapshotTime, err := parseID(ids[i])
+		if err != nil {
+			return "", err
+		}
+		if t.IsZero() || !snapshotTime.After(t) {
+			return ids[i], nil
+		}
+	}
+	if t.IsZero() {
+		return "", fmt.Errorf("no snapshots found in %s", fs.ConfigString(repo))
+	}
+	return "", fmt.Errorf("no snapshots made at or before %v found in %s", t.Local(), fs.ConfigString(repo))
+}
+
+// Restore copies the files of the latest snapshot in repo made at or
+// before t into fdst and returns its manifest.
+//
+// If t is zero the latest snapshot is restored.
+func Restore(ctx context.Context, fdst, repo fs.Fs, t time.Time) (*Manifest, error) {
+	id, err := FindSnapshot(ctx, repo, t)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ReadManifest(ctx, repo, id)
+	if err != nil {
+		return nil, err
+	}
+	fsrc, err := snapshotFs(ctx, repo, id)
+	if err != nil {
+		return nil, err
+	}
+	fs.Infof(fdst, "Restoring snapshot %s", id)
+	err = sync.CopyDir(ctx, fdst, fsrc, false)
+	if err != nil {
+		return nil, err
+	}
+	if fsrc.Precision() == fs.ModTimeNotSupported && fdst.Precision() != fs.ModTimeNotSupported {
+		err = setModTimes(ctx, fdst, m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// setModTimes sets the modification times of the files in fdst from
+// the manifest m
+func setModTimes(ctx context.Context, fdst fs.Fs, m *Manifest) error {
+	for i := range m.Files {
+		entry := &m.Files[i]
+		o, err := fdst.NewObject(ctx, entry.Path)
+		if err == fs.ErrorObjectNotFound {
+			// Filtered out or not copied because of --dry-run
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if operations.SkipDestructive(ctx, o, "set modification time") {
+			continue
+		}
+		err = o.SetModTime(ctx, entry.ModTime)
+		if err != nil && err != fs.ErrorCantSetModTime && err != fs.ErrorCantSetModTimeWithoutDelete {
+			return fmt.Errorf("failed to set modification time: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Package cleanupuploads provides the cleanupuploads command.
+package cleanupuploads
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maxAge = fs.Duration(24 * time.Hour)
+	list   = false
+)
+
+// For overriding in unittests.
+var (
+	timeNowFunc = time.Now
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.FVarP(cmdFlags, &maxAge, "max-age", "", "Only abort uploads which haven't made progress for this long", "")
+	flags.BoolVarP(cmdFlags, &list, "list", "", list, "List the uploads instead of aborting them", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "cleanupuploads [remote:path]",
+	Short: `Abort resumable uploads which were never finished.`,
+	Long: `
+When ` + "`--multi-thread-resume`" + ` is in use, rclone saves the state of each
+multi-thread upload in its cache directory so that if rclone is
+interrupted, the next run can carry on the upload from where it left
+off instead of starting again.
+
+If the next run never happens, the parts uploaded so far are left on
+the remote where they may take up space and be charged for. This
+command aborts those uploads, deleting their parts from the remote,
+and forgets their state. Azure Blob uploads can't be aborted, so only
+their state is forgotten - Azure removes the uncommitted blocks after
+a week.
+
+Only uploads which haven't made any progress for ` + "`--max-age`" + ` (default
+24h) are aborted so uploads which are still running aren't disturbed.
+If remote:path is given, only uploads to files in remote:path are
+aborted.
+
+Use ` + "`--list`" + ` to see the uploads which could be resumed instead.
+
+    rclone cleanupuploads --list
+    rclone cleanupuploads --max-age 7d s3:bucket
+
+Uploads which the remote has already removed, for example with
+` + "`rclone cleanup`" + `, are forgotten.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(0, 1, command, args)
+		within := ""
+		if len(args) > 0 {
+			within = fs.ConfigString(cmd.NewFsDir(args))
+		}
+		cmd.Run(false, false, command, func() error {
+			return cleanupUploads(context.Background(), os.Stdout, within)
+		})
+	},
+}
+
+// destination returns the file the upload in s is writing
+func destination(s *operations.ResumeState) string {
+	return fspath.JoinRootPath(s.Fs, s.Remote)
+}
+
+// isWithin returns true if path is within the directory dir
+func isWithin(path, dir string) bool {
+	if dir == "" || path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, ":") && !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return strings.HasPrefix(path, dir)
+}
+
+// cleanupUploads lists or aborts the stale uploads to files within
+// the directory within
+func cleanupUploads(ctx context.Context, out io.Writer, within string) error {
+	states, err := operations.ResumeStates(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, s := range states {
+		dst := destination(s)
+		if !isWithin(dst, within) {
+			continue
+		}
+		if list {
+			fmt.Fprintf(out, "%s %s %d/%d chunks %s\n", s.Updated.Local().Format("2006-01-02 15:04:05"), dst, len(s.ChunkWriter.Chunks), chunks(s), s.Source)
+			continue
+		}
+		if age := timeNowFunc().Sub(s.Updated); age < time.Duration(maxAge) {
+			fs.Debugf(dst, "Not aborting upload which made progress %v ago", age.Truncate(time.Second))
+			continue
+		}
+		err := operations.AbortResume(ctx, s)
+		if err != nil {
+			fs.Errorf(dst, "%v", err)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to abort %d uploads: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// chunks returns the number of chunks in the upload s
+func chunks(s *operations.ResumeState) int64 {
+	chunkSize := s.ChunkWriter.ChunkSize
+	if chunkSize <= 0 {
+		return 0
+	}
+	return (s.Size + chunkSize - 1) / chunkSize
+}
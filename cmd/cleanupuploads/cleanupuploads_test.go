@@ -0,0 +1,93 @@
+package cleanupuploads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsWithin(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		dir  string
+		want bool
+	}{
+		{"s3:bucket/file", "", true},
+		{"s3:bucket/file", "s3:", true},
+		{"s3:bucket/file", "s3:bucket", true},
+		{"s3:bucket/file", "s3:bucket/file", true},
+		{"s3:bucket/file", "s3:buck", false},
+		{"s3:bucket/file", "s3:bucket/dir", false},
+		{"s3:bucket/dir/file", "s3:bucket/dir/", true},
+		{"/tmp/dir/file", "/tmp", true},
+		{"/tmp/dir/file", "/", true},
+		{"s3:bucket/file", "b2:bucket", false},
+	} {
+		assert.Equal(t, test.want, isWithin(test.path, test.dir), test)
+	}
+}
+
+func TestCleanupUploads(t *testing.T) {
+	ctx := context.Background()
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	t.Cleanup(func() { _ = config.SetCacheDir(oldCacheDir) })
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	oldTimeNowFunc := timeNowFunc
+	timeNowFunc = func() time.Time { return now }
+	t.Cleanup(func() { timeNowFunc = oldTimeNowFunc })
+
+	// No uploads
+	var out bytes.Buffer
+	require.NoError(t, cleanupUploads(ctx, &out, ""))
+	assert.Equal(t, "", out.String())
+
+	// Save the state of an upload in progress
+	dir := filepath.Join(config.GetCacheDir(), "resume")
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	writeState := func(name string, s *operations.ResumeState) {
+		data, err := json.Marshal(s)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".json"), data, 0600))
+	}
+	writeState("recent", &operations.ResumeState{
+		Fs:      "TestCleanupUploads:bucket",
+		Remote:  "dir/file",
+		Source:  "/tmp/file",
+		Size:    3 * int64(fs.Mebi),
+		Started: now.Add(-time.Hour),
+		Updated: now.Add(-time.Minute),
+		ChunkWriter: fs.ChunkWriterState{
+			ID:        "upload",
+			ChunkSize: int64(fs.Mebi),
+			Chunks:    map[int]string{0: "a", 1: "b"},
+		},
+	})
+
+	oldList := list
+	list = true
+	t.Cleanup(func() { list = oldList })
+	require.NoError(t, cleanupUploads(ctx, &out, ""))
+	assert.Contains(t, out.String(), "TestCleanupUploads:bucket/dir/file 2/3 chunks /tmp/file")
+	out.Reset()
+	require.NoError(t, cleanupUploads(ctx, &out, "TestCleanupUploads:other"))
+	assert.Equal(t, "", out.String())
+
+	// Recent uploads aren't aborted
+	list = false
+	require.NoError(t, cleanupUploads(ctx, &out, ""))
+	states, err := operations.ResumeStates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(states))
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/rclone/rclone/fs/rc/rcflags"
 	"github.com/rclone/rclone/fs/rc/rcserver"
 	fssync "github.com/rclone/rclone/fs/sync"
+	"github.com/rclone/rclone/fs/tracing"
 	"github.com/rclone/rclone/lib/atexit"
 	"github.com/rclone/rclone/lib/buildinfo"
 	"github.com/rclone/rclone/lib/exitcode"
@@ -427,6 +428,12 @@ func initConfig() {
 		fs.Debugf("rclone", "systemd logging support activated")
 	}
 
+	// Start sending traces if configured
+	err = tracing.Init(ctx)
+	if err != nil {
+		log.Fatalf("Failed to start tracing: %v", err)
+	}
+
 	// Start the remote control server if configured
 	_, err = rcserver.Start(context.Background(), &rcflags.Opt)
 	if err != nil {
@@ -0,0 +1,303 @@
+// Package convmv provides the convmv command.
+package convmv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/lib/transform"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "convmv dest:path --name-transform XXX",
+	Short: `Convert file and directory names in place.`,
+	Long: `
+convmv renames the files and directories in dest:path using the rules
+given with the ` + "`--name-transform`" + ` flag. These are the same rules which
+can be used to rename files as they are transferred with ` + "`rclone copy`" + `,
+` + "`rclone sync`" + ` and ` + "`rclone move`" + `.
+
+If dest:path is a file then only that file is renamed.
+
+Each rule has the form ` + "`[file,|dir,|all,]transform[=argument]`" + `. The
+optional prefix says which names the rule applies to - file names only
+(the default), directory names only, or both. The flag may be repeated
+and the rules are applied in the order given.
+
+| Transform | Effect |
+|-----------|--------|
+` + transform.Help() + `
+For example, to convert all names to Unicode NFC form
+
+    rclone convmv remote:path --name-transform all,nfc
+
+To add a suffix before the extension of every file
+
+    rclone convmv remote:path --name-transform suffix_keep_extension=_old
+
+Which would rename ` + "`stories/The Quick Brown Fox!.txt`" + ` to
+` + "`stories/The Quick Brown Fox!_old.txt`" + `.
+
+To replace spaces with underscores in file and directory names
+
+    rclone convmv remote:path --name-transform "all,replace= :_"
+
+To remove a date prefix with a regular expression (the replacement
+follows the last ` + "`/`" + `)
+
+    rclone convmv remote:path --name-transform "regex=^[0-9]{4}-[0-9]{2}-[0-9]{2} /"
+
+Filters may be used to choose which files are renamed. Files are
+moved server-side if the backend supports it. If two names would be
+renamed to the same thing then neither is renamed and an error is
+reported. Files are not renamed over other files which aren't being
+renamed. Files which are renamed to the old name of another file, for
+example when adding a prefix to ` + "`a` and `xa`" + `, are renamed in an order
+which doesn't lose any of them.
+
+**Important**: Since this can cause data loss, test first with the
+` + "`--dry-run` or the `--interactive`/`-i`" + ` flag.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+		"groups":            "Filter,Listing,Important,Copy",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fdst, fileName := cmd.NewFsFile(args[0])
+		cmd.Run(false, true, command, func() error {
+			ctx := context.Background()
+			if fileName != "" {
+				return ConvmvFile(ctx, fdst, fileName)
+			}
+			return Convmv(ctx, fdst)
+		})
+	},
+}
+
+// ConvmvFile renames the single file fileName in f using the
+// --name-transform rules
+func ConvmvFile(ctx context.Context, f fs.Fs, fileName string) error {
+	ts := transform.Get(ctx)
+	if len(ts) == 0 {
+		return transform.ErrorNoTransforms
+	}
+	newName := ts.Leaf(fileName, false)
+	if newName == fileName {
+		fs.Debugf(fileName, "Name unchanged - not renaming")
+		return nil
+	}
+	return operations.MoveFile(ctx, f, f, newName, fileName)
+}
+
+// Convmv renames the files and directories in f using the
+// --name-transform rules.
+//
+// The files are moved to their new names, then the old directories
+// are removed if they are empty.
+func Convmv(ctx context.Context, f fs.Fs) error {
+	ts := transform.Get(ctx)
+	if len(ts) == 0 {
+		return transform.ErrorNoTransforms
+	}
+	ci := fs.GetConfig(ctx)
+
+	var (
+		objects []fs.Object
+		dirs    []string
+	)
+	err := walk.ListR(ctx, f, "", false, ci.MaxDepth, walk.ListAll, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			switch x := entry.(type) {
+			case fs.Object:
+				objects = append(objects, x)
+			case fs.Directory:
+				dirs = append(dirs, x.Remote())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("convmv: failed to list: %w", err)
+	}
+
+	// Work out the renames, refusing any which collide with each
+	// other or with a file which isn't being renamed
+	var errCount int
+	existing := make(map[string]bool, len(objects))
+	for _, o := range objects {
+		existing[o.Remote()] = true
+	}
+	renames := map[string]string{} // new name to old name
+	moves := map[string]string{}   // old name to new name
+	collided := map[string]bool{}
+	for _, o := range objects {
+		remote := o.Remote()
+		newRemote := ts.Path(remote, false)
+		if newRemote == remote {
+			continue
+		}
+		if oldRemote, found := renames[newRemote]; found {
+			fs.Errorf(o, "Not renaming to %q as %q would be renamed to it too", newRemote, oldRemote)
+			collided[newRemote] = true
+			errCount++
+			continue
+		}
+		renames[newRemote] = remote
+		moves[remote] = newRemote
+	}
+	for newRemote := range collided {
+		fs.Errorf(renames[newRemote], "Not renaming to %q as another file would be renamed to it too", newRemote)
+		delete(moves, renames[newRemote])
+		delete(renames, newRemote)
+		errCount++
+	}
+	// A file can only be renamed over another file if that is being
+	// renamed too. Refusing a rename leaves its file in place so
+	// keep going until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for newRemote, remote := range renames {
+			if _, moving := moves[newRemote]; existing[newRemote] && !moving {
+				fs.Errorf(remote, "Not renaming to %q as it would overwrite another file", newRemote)
+				delete(renames, newRemote)
+				delete(moves, remote)
+				errCount++
+				changed = true
+			}
+		}
+	}
+
+	// Rename the files. Renames which depend on each other are done
+	// one after the other in the right order.
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(ci.Transfers)
+	for _, seq := range orderMoves(moves, tempName) {
+		seq := seq
+		g.Go(func() error {
+			for _, m := range seq {
+				err := operations.MoveFile(gCtx, f, f, m.to, m.from)
+				if err != nil {
+					return fmt.Errorf("convmv: failed to rename %q to %q: %w", m.from, m.to, err)
+				}
+			}
+			return nil
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		return err
+	}
+
+	// Create the renamed directories and remove the old ones,
+	// deepest first, so empty directories are renamed too
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") > strings.Count(dirs[j], "/")
+	})
+	for _, dir := range dirs {
+		newDir := ts.Path(dir, true)
+		if newDir == dir {
+			continue
+		}
+		if f.Features().CanHaveEmptyDirectories {
+			err := operations.Mkdir(ctx, f, newDir)
+			if err != nil {
+				fs.Errorf(fs.LogDirName(f, newDir), "Failed to make directory: %v", err)
+				errCount++
+				continue
+			}
+		}
+		// Ignore errors as the directory may still contain files
+		// which were filtered out
+		err := operations.TryRmdir(ctx, f, dir)
+		if err != nil {
+			fs.Debugf(fs.LogDirName(f, dir), "Not removing old directory: %v", err)
+		}
+	}
+	if errCount > 0 {
+		return fmt.Errorf("convmv: %d names could not be converted", errCount)
+	}
+	return nil
+}
+
+// move is a rename of a file
+type move struct {
+	from string
+	to   string
+}
+
+// tempName returns a name to move remote out of the way to
+func tempName(remote string) string {
+	return remote + ".convmv-" + random.String(8)
+}
+
+// orderMoves puts the renames in moves (old name to new name) into
+// sequences which must be done in order so no file is renamed over a
+// file which hasn't been renamed yet.
+//
+// As no two files are renamed to the same name the renames form
+// chains, which are done from the end, and cycles, such as swaps,
+// which are broken by moving one file to the name made by tempName
+// first. The sequences don't depend on each other.
+func orderMoves(moves map[string]string, tempName func(string) string) (seqs [][]move) {
+	into := make(map[string]string, len(moves)) // new name to old name
+	for from, to := range moves {
+		into[to] = from
+	}
+	done := make(map[string]bool, len(moves))
+	// chain returns the renames from start until the end of the
+	// chain or until a name already done, last first
+	chain := func(start string) (seq []move) {
+		for from := start; !done[from]; {
+			to, found := moves[from]
+			if !found {
+				break
+			}
+			done[from] = true
+			seq = append([]move{{from: from, to: to}}, seq...)
+			from = to
+		}
+		return seq
+	}
+
+	// Sort so the order is repeatable
+	froms := make([]string, 0, len(moves))
+	for from := range moves {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+
+	// Chains start with a file nothing is renamed to
+	for _, from := range froms {
+		if _, found := into[from]; !found {
+			seqs = append(seqs, chain(from))
+		}
+	}
+
+	// The rest are cycles
+	for _, from := range froms {
+		if done[from] {
+			continue
+		}
+		tmp := tempName(from)
+		seq := []move{{from: from, to: tmp}}
+		done[from] = true
+		seq = append(seq, chain(moves[from])...)
+		seq = append(seq, move{from: tmp, to: moves[from]})
+		seqs = append(seqs, seq)
+	}
+	return seqs
+}
@@ -0,0 +1,123 @@
+package convmv
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/transform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = fstest.Time("2017-02-03T04:05:06.499999999Z")
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+func TestConvmvNoTransforms(t *testing.T) {
+	r := fstest.NewRun(t)
+	assert.Equal(t, transform.ErrorNoTransforms, Convmv(context.Background(), r.Fremote))
+	assert.Equal(t, transform.ErrorNoTransforms, ConvmvFile(context.Background(), r.Fremote, "file"))
+}
+
+func TestConvmv(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.NameTransform = []string{"all,replace= :_", "file,suffix_keep_extension=-1"}
+	r.WriteObject(ctx, "sub dir/hello world.txt", "hello world", t1)
+	r.WriteObject(ctx, "top.txt", "top", t1)
+	require.NoError(t, operations.Mkdir(ctx, r.Fremote, "empty dir"))
+
+	require.NoError(t, Convmv(ctx, r.Fremote))
+
+	r.CheckRemoteListing(t, []fstest.Item{
+		fstest.NewItem("sub_dir/hello_world-1.txt", "hello world", t1),
+		fstest.NewItem("top-1.txt", "top", t1),
+	}, []string{
+		"empty_dir",
+		"sub_dir",
+	})
+}
+
+func TestConvmvCollision(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.NameTransform = []string{"trimprefix=x"}
+	file1 := r.WriteObject(ctx, "a", "existing", t1)
+	file2 := r.WriteObject(ctx, "xa", "renamed", t1)
+	r.WriteObject(ctx, "xb", "renamed", t1)
+
+	assert.Error(t, Convmv(ctx, r.Fremote))
+
+	r.CheckRemoteItems(t, file1, file2, fstest.NewItem("b", "renamed", t1))
+}
+
+func TestConvmvChain(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.NameTransform = []string{"prefix=x"}
+	r.WriteObject(ctx, "a", "a", t1)
+	r.WriteObject(ctx, "xa", "xa", t1)
+	r.WriteObject(ctx, "xxa", "xxa", t1)
+
+	require.NoError(t, Convmv(ctx, r.Fremote))
+
+	r.CheckRemoteItems(t,
+		fstest.NewItem("xa", "a", t1),
+		fstest.NewItem("xxa", "xa", t1),
+		fstest.NewItem("xxxa", "xxa", t1),
+	)
+}
+
+func TestOrderMoves(t *testing.T) {
+	tempName := func(remote string) string { return remote + ".tmp" }
+	for _, test := range []struct {
+		name  string
+		moves map[string]string
+		want  [][]move
+	}{{
+		name:  "independent",
+		moves: map[string]string{"a": "A", "b": "B"},
+		want:  [][]move{{{"a", "A"}}, {{"b", "B"}}},
+	}, {
+		name:  "chain",
+		moves: map[string]string{"a": "xa", "xa": "xxa"},
+		want:  [][]move{{{"xa", "xxa"}, {"a", "xa"}}},
+	}, {
+		name:  "swap",
+		moves: map[string]string{"a": "b", "b": "a"},
+		want:  [][]move{{{"a", "a.tmp"}, {"b", "a"}, {"a.tmp", "b"}}},
+	}, {
+		name:  "cycle",
+		moves: map[string]string{"a": "b", "b": "c", "c": "a"},
+		want:  [][]move{{{"a", "a.tmp"}, {"c", "a"}, {"b", "c"}, {"a.tmp", "b"}}},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, orderMoves(test.moves, tempName))
+		})
+	}
+}
+
+func TestConvmvFile(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.NameTransform = []string{"uppercase"}
+	r.WriteObject(ctx, "hello.txt", "hello", t1)
+	file2 := r.WriteObject(ctx, "other.txt", "other", t1)
+
+	require.NoError(t, ConvmvFile(ctx, r.Fremote, "hello.txt"))
+
+	r.CheckRemoteItems(t, fstest.NewItem("HELLO.TXT", "hello", t1), file2)
+}
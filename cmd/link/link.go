@@ -3,18 +3,24 @@ package link
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/http/signedlink"
 	"github.com/spf13/cobra"
 )
 
 var (
-	expire = fs.DurationOff
-	unlink = false
+	expire     = fs.DurationOff
+	unlink     = false
+	selfSigned = false
+	signedOpt  = signedlink.Options{
+		URL: "http://localhost:8080/",
+	}
 )
 
 func init() {
@@ -22,6 +28,11 @@ func init() {
 	cmdFlags := commandDefinition.Flags()
 	flags.FVarP(cmdFlags, &expire, "expire", "", "The amount of time that the link will be valid", "")
 	flags.BoolVarP(cmdFlags, &unlink, "unlink", "", unlink, "Remove existing public link to file/folder", "")
+	flags.BoolVarP(cmdFlags, &selfSigned, "self-signed", "", selfSigned, "Make a link signed by rclone to be served by rclone serve http or rcd", "")
+	flags.StringVarP(cmdFlags, &signedOpt.URL, "self-signed-url", "", signedOpt.URL, "URL of the rclone server for --self-signed", "")
+	flags.StringVarP(cmdFlags, &signedOpt.Root, "self-signed-root", "", signedOpt.Root, "The remote:path rclone serve http is serving for --self-signed, or blank for rcd", "")
+	flags.IntVarP(cmdFlags, &signedOpt.MaxDownloads, "max-downloads", "", signedOpt.MaxDownloads, "Number of times a --self-signed link can be downloaded (0 for unlimited)", "")
+	flags.StringVarP(cmdFlags, &signedOpt.Password, "password", "", signedOpt.Password, "Password needed to download a --self-signed link", "")
 }
 
 var commandDefinition = &cobra.Command{
@@ -48,6 +59,37 @@ If successful, the last line of the output will contain the
 link. Exact capabilities depend on the remote, but the link will
 always by default be created with the least constraints – e.g. no
 expiry, no password protection, accessible without account.
+
+### Self signed links
+
+Use the ` + "`--self-signed`" + ` flag to make a link to a file on any remote,
+even ones without public links, such as SFTP, local or crypt
+remotes. The link is served by ` + "`rclone serve http --signed-links`" + `
+or ` + "`rclone rcd --rc-signed-links`" + ` and is signed with a secret key
+so it can't be changed to point at anything else.
+
+    rclone link --self-signed --self-signed-url https://example.com/ --self-signed-root remote:share remote:share/file
+
+The key is made the first time it is needed and is kept in
+` + "`" + signedlink.KeyFileName + "`" + ` in the same directory as the config file. The server
+must use the same key, so it must run with the same config
+directory, or have the key file copied to its config directory.
+Deleting the key file stops all the links made with it working.
+
+Set ` + "`--self-signed-url`" + ` to the URL the server can be reached at.
+For ` + "`rclone serve http`" + ` set ` + "`--self-signed-root`" + ` to the
+remote it is serving, which the file must be inside. Leave it blank
+for ` + "`rclone rcd`" + ` which serves files as ` + "`/[remote:path]/file`" + `.
+
+Self signed links expire after the ` + "`--expire`" + ` time, which is one
+week if it isn't set. Use ` + "`--max-downloads`" + ` to limit the number of
+times the file can be downloaded. This is a best effort limit - it is
+counted by the server as the bytes of the file it has served and
+starts again if it is restarted. Use ` + "`--password`" + ` to set a password
+which must be entered, with any user name, to download the file.
+
+Self signed links can only be made for files and can't be removed
+with ` + "`--unlink`" + `.
 `,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.41",
@@ -56,7 +98,20 @@ expiry, no password protection, accessible without account.
 		cmd.CheckArgs(1, 1, command, args)
 		fsrc, remote := cmd.NewFsFile(args[0])
 		cmd.Run(false, false, command, func() error {
-			link, err := operations.PublicLink(context.Background(), fsrc, remote, expire, unlink)
+			var (
+				link string
+				err  error
+			)
+			if selfSigned {
+				if unlink {
+					return errors.New("can't --unlink a --self-signed link")
+				}
+				opt := signedOpt
+				opt.Expire = expire
+				link, err = signedlink.Make(context.Background(), fsrc, remote, opt)
+			} else {
+				link, err = operations.PublicLink(context.Background(), fsrc, remote, expire, unlink)
+			}
 			if err != nil {
 				return err
 			}
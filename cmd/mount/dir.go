@@ -269,3 +269,49 @@ func (d *Dir) Mknod(ctx context.Context, req *fuse.MknodRequest) (node fusefs.No
 	}
 	return node, nil
 }
+
+// Getxattr gets an extended attribute by the given name from the
+// node.
+//
+// If there is no xattr by that name, returns fuse.ErrNoXattr.
+func (d *Dir) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	if !d.fsys.opt.PinXattr {
+		return syscall.ENOSYS // only implemented with --pin-xattr
+	}
+	return getxattr(d.VFS(), d.Path(), req, resp)
+}
+
+var _ fusefs.NodeGetxattrer = (*Dir)(nil)
+
+// Listxattr lists the extended attributes recorded for the node.
+func (d *Dir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	if !d.fsys.opt.PinXattr {
+		return syscall.ENOSYS // only implemented with --pin-xattr
+	}
+	return listxattr(d.VFS(), d.Path(), req, resp)
+}
+
+var _ fusefs.NodeListxattrer = (*Dir)(nil)
+
+// Setxattr sets an extended attribute with the given name and
+// value for the node.
+func (d *Dir) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+	if !d.fsys.opt.PinXattr {
+		return syscall.ENOSYS // only implemented with --pin-xattr
+	}
+	return setxattr(d.VFS(), d.Path(), req)
+}
+
+var _ fusefs.NodeSetxattrer = (*Dir)(nil)
+
+// Removexattr removes an extended attribute for the name.
+//
+// If there is no xattr by that name, returns fuse.ErrNoXattr.
+func (d *Dir) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+	if !d.fsys.opt.PinXattr {
+		return syscall.ENOSYS // only implemented with --pin-xattr
+	}
+	return removexattr(d.VFS(), d.Path(), req)
+}
+
+var _ fusefs.NodeRemovexattrer = (*Dir)(nil)
@@ -98,14 +98,20 @@ func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) (err error) {
 //
 // If there is no xattr by that name, returns fuse.ErrNoXattr.
 func (f *File) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
-	return syscall.ENOSYS // we never implement this
+	if !f.fsys.opt.PinXattr {
+		return syscall.ENOSYS // only implemented with --pin-xattr
+	}
+	return getxattr(f.VFS(), f.Path(), req, resp)
 }
 
 var _ fusefs.NodeGetxattrer = (*File)(nil)
 
 // Listxattr lists the extended attributes recorded for the node.
 func (f *File) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
-	return syscall.ENOSYS // we never implement this
+	if !f.fsys.opt.PinXattr {
+		return syscall.ENOSYS // only implemented with --pin-xattr
+	}
+	return listxattr(f.VFS(), f.Path(), req, resp)
 }
 
 var _ fusefs.NodeListxattrer = (*File)(nil)
@@ -113,7 +119,10 @@ var _ fusefs.NodeListxattrer = (*File)(nil)
 // Setxattr sets an extended attribute with the given name and
 // value for the node.
 func (f *File) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
-	return syscall.ENOSYS // we never implement this
+	if !f.fsys.opt.PinXattr {
+		return syscall.ENOSYS // only implemented with --pin-xattr
+	}
+	return setxattr(f.VFS(), f.Path(), req)
 }
 
 var _ fusefs.NodeSetxattrer = (*File)(nil)
@@ -122,7 +131,10 @@ var _ fusefs.NodeSetxattrer = (*File)(nil)
 //
 // If there is no xattr by that name, returns fuse.ErrNoXattr.
 func (f *File) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
-	return syscall.ENOSYS // we never implement this
+	if !f.fsys.opt.PinXattr {
+		return syscall.ENOSYS // only implemented with --pin-xattr
+	}
+	return removexattr(f.VFS(), f.Path(), req)
 }
 
 var _ fusefs.NodeRemovexattrer = (*File)(nil)
@@ -0,0 +1,45 @@
+//go:build linux
+
+package mount
+
+import (
+	"syscall"
+
+	"bazil.org/fuse"
+	"github.com/rclone/rclone/cmd/mountlib"
+	"github.com/rclone/rclone/vfs"
+)
+
+// getxattr gets the extended attribute for the node at path
+func getxattr(VFS *vfs.VFS, path string, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	value, found := mountlib.GetPinXattr(VFS, path, req.Name)
+	if !found {
+		return fuse.ErrNoXattr
+	}
+	resp.Xattr = value
+	return nil
+}
+
+// listxattr lists the extended attributes for the node at path
+func listxattr(VFS *vfs.VFS, path string, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	resp.Append(mountlib.ListPinXattr(VFS, path)...)
+	return nil
+}
+
+// setxattr sets the extended attribute for the node at path
+func setxattr(VFS *vfs.VFS, path string, req *fuse.SetxattrRequest) error {
+	handled, err := mountlib.SetPinXattr(VFS, path, req.Name, req.Xattr)
+	if !handled {
+		return fuse.Errno(syscall.ENOTSUP)
+	}
+	return translateError(err)
+}
+
+// removexattr removes the extended attribute for the node at path
+func removexattr(VFS *vfs.VFS, path string, req *fuse.RemovexattrRequest) error {
+	handled, err := mountlib.RemovePinXattr(VFS, path, req.Name)
+	if !handled {
+		return fuse.ErrNoXattr
+	}
+	return translateError(err)
+}
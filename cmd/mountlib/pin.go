@@ -0,0 +1,67 @@
+package mountlib
+
+import (
+	"github.com/rclone/rclone/vfs"
+)
+
+// PinXattr is the extended attribute used to pin files and
+// directories in the VFS cache when --pin-xattr is set
+const PinXattr = "user.rclone.pinned"
+
+// GetPinXattr returns the value of the extended attribute name for
+// the node at path and whether it is set
+func GetPinXattr(VFS *vfs.VFS, path string, name string) (value []byte, found bool) {
+	if name != PinXattr || !VFS.IsPinned(path) {
+		return nil, false
+	}
+	return []byte("1"), true
+}
+
+// ListPinXattr returns the names of the extended attributes set on
+// the node at path
+func ListPinXattr(VFS *vfs.VFS, path string) (names []string) {
+	if VFS.IsPinned(path) {
+		names = append(names, PinXattr)
+	}
+	return names
+}
+
+// SetPinXattr pins or unpins the node at path if name is PinXattr.
+// A value of "0" unpins the node, anything else pins it.
+//
+// It returns false if name isn't an attribute rclone knows about.
+func SetPinXattr(VFS *vfs.VFS, path string, name string, value []byte) (handled bool, err error) {
+	if name != PinXattr {
+		return false, nil
+	}
+	if string(value) == "0" {
+		return true, unpin(VFS, path)
+	}
+	return true, VFS.Pin(path)
+}
+
+// RemovePinXattr unpins the node at path if name is PinXattr.
+//
+// It returns false if name isn't an attribute rclone knows about.
+func RemovePinXattr(VFS *vfs.VFS, path string, name string) (handled bool, err error) {
+	if name != PinXattr {
+		return false, nil
+	}
+	return true, unpin(VFS, path)
+}
+
+// unpin path returning vfs.EPERM if it is only pinned by a glob
+// or a parent directory
+func unpin(VFS *vfs.VFS, path string) error {
+	for _, pin := range VFS.Pins() {
+		if pin == path {
+			return VFS.Unpin(path)
+		}
+	}
+	if !VFS.IsPinned(path) {
+		// nothing to do
+		return nil
+	}
+	// Pinned by a glob or a parent directory
+	return vfs.EPERM
+}
@@ -27,7 +27,8 @@ func init() {
 }
 
 func mount(VFS *vfs.VFS, mountpoint string, opt *mountlib.Options) (asyncerrors <-chan error, unmount func() error, err error) {
-	s, err := nfs.NewServer(context.Background(), VFS, &nfs.Options{})
+	nfsOpt := nfs.DefaultOpt
+	s, err := nfs.NewServer(context.Background(), VFS, &nfsOpt)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,204 @@
+package run
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a parsed cron schedule
+type schedule struct {
+	minute, hour, dom, month, dow uint64 // bit n set if value n matches
+	domStar, dowStar              bool   // set if the field started with *
+}
+
+// A field of a cron schedule
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is accepted as well as 0 for Sunday
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Shorthands for common schedules
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseSchedule parses a cron schedule of the form
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field can be *, a number, a range like 1-5, a list like 1,3,5
+// or any of those with a step like */15 or 0-30/10. Months and days
+// of the week can be given as names like jan or mon. The macros
+// @hourly, @daily, @midnight, @weekly, @monthly, @yearly and
+// @annually are accepted too.
+func parseSchedule(spec string) (*schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: expecting 5 fields but got %d", spec, len(fields))
+	}
+	s := &schedule{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	for i, p := range []struct {
+		out   *uint64
+		field cronField
+	}{
+		{&s.minute, minuteField},
+		{&s.hour, hourField},
+		{&s.dom, domField},
+		{&s.month, monthField},
+		{&s.dow, dowField},
+	} {
+		set, err := p.field.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		*p.out = set
+	}
+	// Make Sunday 0 whether it was given as 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// parse a field of a cron schedule returning the values it matches
+func (f cronField) parse(field string) (out uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepPart, f.name)
+			}
+		}
+		var start, end int
+		if rangePart == "*" {
+			start, end = f.min, f.max
+			if f.name == dowField.name {
+				end = 6
+			}
+		} else if startPart, endPart, isRange := strings.Cut(rangePart, "-"); isRange {
+			if start, err = f.value(startPart); err != nil {
+				return 0, err
+			}
+			if end, err = f.value(endPart); err != nil {
+				return 0, err
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid range %q in %s field", rangePart, f.name)
+			}
+		} else {
+			if start, err = f.value(rangePart); err != nil {
+				return 0, err
+			}
+			end = start
+			// A step on a single value means from then to the end
+			if hasStep {
+				end = f.max
+			}
+		}
+		for i := start; i <= end; i += step {
+			out |= 1 << uint(i)
+		}
+	}
+	return out, nil
+}
+
+// value parses a single value in the field
+func (f cronField) value(s string) (int, error) {
+	if n, ok := f.names[strings.ToLower(s)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", s, f.name)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d in %s field", n, f.min, f.max, f.name)
+	}
+	return n, nil
+}
+
+// has returns true if bit n is set in set
+func has(set uint64, n int) bool {
+	return set&(1<<uint(n)) != 0
+}
+
+// dayMatches returns true if the day of t matches the schedule
+//
+// As in cron, if both the day of month and the day of week are
+// restricted then a day matching either will do.
+func (s *schedule) dayMatches(t time.Time) bool {
+	domMatch := has(s.dom, t.Day())
+	dowMatch := has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// next returns the first time after t which matches the schedule or
+// the zero time if there isn't one in the next few years.
+func (s *schedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Give up on schedules like 30th February which never match
+	yearLimit := t.Year() + 5
+	for t.Year() <= yearLimit {
+		year, month, day := t.Date()
+		if !has(s.month, int(month)) {
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			// Skip straight to the next matching minute in this hour if any
+			if later := s.minute >> uint(t.Minute()); later != 0 {
+				t = t.Add(time.Duration(bits.TrailingZeros64(later)) * time.Minute)
+			} else {
+				t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, loc)
+			}
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
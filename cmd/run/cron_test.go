@@ -0,0 +1,69 @@
+package run
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		wantErr string
+	}{
+		{"* * * * *", ""},
+		{"*/15 0-6,22,23 1 jan-mar mon-fri", ""},
+		{"@daily", ""},
+		{"@HOURLY", ""},
+		{"0 0 * * 7", ""},
+		{"5/10 * * * *", ""},
+		{"* * * *", "expecting 5 fields but got 4"},
+		{"60 * * * *", "value 60 out of range 0-59 in minute field"},
+		{"* 24 * * *", "value 24 out of range 0-23 in hour field"},
+		{"* * 0 * *", "value 0 out of range 1-31 in day of month field"},
+		{"* * * foo * ", `invalid value "foo" in month field`},
+		{"*/0 * * * *", `invalid step "0" in minute field`},
+		{"5-1 * * * *", `invalid range "5-1" in minute field`},
+		{"@sometimes", "expecting 5 fields but got 1"},
+	} {
+		_, err := parseSchedule(test.in)
+		if test.wantErr == "" {
+			assert.NoError(t, err, test.in)
+		} else {
+			require.Error(t, err, test.in)
+			assert.Contains(t, err.Error(), test.wantErr, test.in)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// Wednesday
+	start := time.Date(2024, 1, 10, 12, 34, 56, 0, time.UTC)
+	for _, test := range []struct {
+		spec string
+		want string
+	}{
+		{"* * * * *", "2024-01-10T12:35:00Z"},
+		{"*/15 * * * *", "2024-01-10T12:45:00Z"},
+		{"30 * * * *", "2024-01-10T13:30:00Z"},
+		{"@hourly", "2024-01-10T13:00:00Z"},
+		{"@daily", "2024-01-11T00:00:00Z"},
+		{"0 2 * * *", "2024-01-11T02:00:00Z"},
+		{"0 6 * * sun", "2024-01-14T06:00:00Z"},
+		{"0 6 * * 7", "2024-01-14T06:00:00Z"},
+		{"0 0 1 * *", "2024-02-01T00:00:00Z"},
+		{"@yearly", "2025-01-01T00:00:00Z"},
+		{"0 0 29 feb *", "2024-02-29T00:00:00Z"},
+		{"15 9 * * mon-fri", "2024-01-11T09:15:00Z"},
+		// Day of month or day of week if both are set
+		{"0 0 20 * fri", "2024-01-12T00:00:00Z"},
+		{"0 0 11 * sun", "2024-01-11T00:00:00Z"},
+		{"0 0 30 feb *", "0001-01-01T00:00:00Z"},
+	} {
+		s, err := parseSchedule(test.spec)
+		require.NoError(t, err, test.spec)
+		assert.Equal(t, test.want, s.next(start).Format(time.RFC3339), test.spec)
+	}
+}
@@ -0,0 +1,323 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"gopkg.in/yaml.v2"
+)
+
+// The rc calls run by the short command names
+var commandAliases = map[string]string{
+	"copy":   "sync/copy",
+	"sync":   "sync/sync",
+	"move":   "sync/move",
+	"bisync": "sync/bisync",
+	"check":  "operations/check",
+}
+
+// When to send the webhook
+const (
+	webhookAlways  = "always"
+	webhookSuccess = "success"
+	webhookFailure = "failure"
+)
+
+// jobFile is the contents of a job file
+type jobFile struct {
+	Defaults jobSpec             `yaml:"defaults"`
+	Jobs     map[string]*jobSpec `yaml:"jobs"`
+
+	names []string // names of the jobs, sorted
+}
+
+// jobSpec describes a job in the job file
+type jobSpec struct {
+	Command    string                 `yaml:"command"`     // rc call or short name, e.g. "sync"
+	Src        string                 `yaml:"src"`         // passed to the command as srcFs
+	Dst        string                 `yaml:"dst"`         // passed to the command as dstFs
+	Params     map[string]interface{} `yaml:"params"`      // extra parameters for the command
+	Filter     []string               `yaml:"filter"`      // filter rules as used by --filter
+	Config     map[string]interface{} `yaml:"config"`      // overrides for the global config
+	Schedule   string                 `yaml:"schedule"`    // when to run in cron syntax
+	Depends    []string               `yaml:"depends"`     // jobs which must succeed first
+	Retries    *int                   `yaml:"retries"`     // times to retry the job if it fails
+	RetryDelay string                 `yaml:"retry_delay"` // time to wait between retries
+	Webhook    string                 `yaml:"webhook"`     // URL to POST the result to
+	WebhookOn  string                 `yaml:"webhook_on"`  // when to POST the result
+
+	name       string    // name of the job
+	call       *rc.Call  // the rc call to run
+	schedule   *schedule // parsed Schedule if set
+	retryDelay time.Duration
+}
+
+// loadJobFile reads and checks the job file at path
+func loadJobFile(path string) (*jobFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job file: %w", err)
+	}
+	return parseJobFile(data)
+}
+
+// parseJobFile parses and checks a job file
+func parseJobFile(data []byte) (*jobFile, error) {
+	f := new(jobFile)
+	err := yaml.UnmarshalStrict(data, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse job file: %w", err)
+	}
+	if len(f.Jobs) == 0 {
+		return nil, errors.New("no jobs in job file")
+	}
+	for name, job := range f.Jobs {
+		if job == nil {
+			return nil, fmt.Errorf("job %q: no definition", name)
+		}
+		job.name = name
+		job.applyDefaults(&f.Defaults)
+		err = job.check(f)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", name, err)
+		}
+		f.names = append(f.names, name)
+	}
+	sort.Strings(f.names)
+	err = f.checkCycles()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// applyDefaults fills in the settings of job which aren't set from
+// defaults
+func (job *jobSpec) applyDefaults(defaults *jobSpec) {
+	if job.Command == "" {
+		job.Command = defaults.Command
+	}
+	if job.Filter == nil {
+		job.Filter = defaults.Filter
+	}
+	if job.Retries == nil {
+		job.Retries = defaults.Retries
+	}
+	if job.RetryDelay == "" {
+		job.RetryDelay = defaults.RetryDelay
+	}
+	if job.Webhook == "" {
+		job.Webhook = defaults.Webhook
+	}
+	if job.WebhookOn == "" {
+		job.WebhookOn = defaults.WebhookOn
+	}
+	job.Params = mergeMaps(defaults.Params, job.Params)
+	job.Config = mergeMaps(defaults.Config, job.Config)
+}
+
+// mergeMaps returns the values in a overridden by the values in b
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	if len(a) == 0 {
+		return b
+	}
+	out := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
+
+// check the job is valid and parse its settings
+func (job *jobSpec) check(f *jobFile) (err error) {
+	if job.Command == "" {
+		return errors.New("command not set")
+	}
+	path := job.Command
+	if alias, ok := commandAliases[path]; ok {
+		path = alias
+	}
+	job.call = rc.Calls.Get(path)
+	if job.call == nil {
+		return fmt.Errorf("unknown command %q", job.Command)
+	}
+	if job.Schedule != "" {
+		job.schedule, err = parseSchedule(job.Schedule)
+		if err != nil {
+			return err
+		}
+	}
+	if job.Retries != nil && *job.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+	job.retryDelay = 10 * time.Second
+	if job.RetryDelay != "" {
+		job.retryDelay, err = fs.ParseDuration(job.RetryDelay)
+		if err != nil {
+			return fmt.Errorf("invalid retry_delay: %w", err)
+		}
+	}
+	switch job.WebhookOn {
+	case "":
+		job.WebhookOn = webhookAlways
+	case webhookAlways, webhookSuccess, webhookFailure:
+	default:
+		return fmt.Errorf("webhook_on must be %q, %q or %q", webhookAlways, webhookSuccess, webhookFailure)
+	}
+	for _, dep := range job.Depends {
+		if f.Jobs[dep] == nil {
+			return fmt.Errorf("depends on unknown job %q", dep)
+		}
+	}
+	// Convert the maps so they can be encoded as JSON
+	for _, m := range []map[string]interface{}{job.Params, job.Config} {
+		for k, v := range m {
+			m[k] = jsonValue(v)
+		}
+	}
+	// Check the config overrides are valid
+	if len(job.Config) > 0 {
+		err = checkConfig(job.Config)
+		if err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkConfig checks config can be used to override the global config
+func checkConfig(config map[string]interface{}) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(new(fs.ConfigInfo))
+}
+
+// jsonValue converts the maps YAML decodes into maps which can be
+// encoded as JSON
+func jsonValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			out[fmt.Sprint(k)] = jsonValue(v)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, v := range x {
+			out[i] = jsonValue(v)
+		}
+		return out
+	}
+	return v
+}
+
+// checkCycles returns an error if any jobs depend on themselves
+func (f *jobFile) checkCycles() error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("jobs depend on each other: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range f.Jobs[name].Depends {
+			err := visit(dep, append(path, name))
+			if err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, name := range f.names {
+		err := visit(name, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closure returns the sorted names of the jobs in names and the jobs
+// they depend on
+func (f *jobFile) closure(names []string) (out []string, err error) {
+	seen := map[string]bool{}
+	var add func(name string)
+	add = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		out = append(out, name)
+		for _, dep := range f.Jobs[name].Depends {
+			add(dep)
+		}
+	}
+	for _, name := range names {
+		if f.Jobs[name] == nil {
+			return nil, fmt.Errorf("unknown job %q", name)
+		}
+		add(name)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// params returns the parameters to pass to the rc call for the job
+func (job *jobSpec) params() rc.Params {
+	in := rc.Params{}
+	for k, v := range job.Params {
+		in[k] = v
+	}
+	if job.Src != "" {
+		in["srcFs"] = job.Src
+	}
+	if job.Dst != "" {
+		in["dstFs"] = job.Dst
+	}
+	if len(job.Config) > 0 {
+		in["_config"] = job.Config
+	}
+	if len(job.Filter) > 0 {
+		in["_filter"] = rc.Params{"FilterRule": job.Filter}
+	}
+	in["_group"] = job.group()
+	return in
+}
+
+// group returns the stats group the job is run in
+func (job *jobSpec) group() string {
+	return "run/" + job.name
+}
+
+// retries returns the number of times to retry the job
+func (job *jobSpec) retries() int {
+	if job.Retries == nil {
+		return 0
+	}
+	return *job.Retries
+}
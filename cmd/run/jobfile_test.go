@@ -0,0 +1,112 @@
+package run
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/rclone/rclone/fs/operations"
+	_ "github.com/rclone/rclone/fs/sync"
+)
+
+func TestParseJobFile(t *testing.T) {
+	f, err := parseJobFile([]byte(`
+defaults:
+  retries: 2
+  config:
+    Transfers: 8
+    CheckFirst: true
+  webhook: http://example.com/hook
+jobs:
+  photos:
+    command: sync
+    src: /src
+    dst: remote:dst
+    filter: ["- *.tmp"]
+    config:
+      Transfers: 2
+      Headers:
+        - Key: a
+          Value: b
+    schedule: "@daily"
+  check:
+    command: check
+    src: /src
+    dst: remote:dst
+    params:
+      oneway: true
+    depends: [photos]
+    retries: 0
+    retry_delay: 1m
+    webhook_on: failure
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"check", "photos"}, f.names)
+
+	photos := f.Jobs["photos"]
+	assert.Equal(t, "photos", photos.name)
+	assert.Equal(t, "sync/sync", photos.call.Path)
+	assert.NotNil(t, photos.schedule)
+	assert.Equal(t, 2, photos.retries())
+	assert.Equal(t, 10*time.Second, photos.retryDelay)
+	assert.Equal(t, webhookAlways, photos.WebhookOn)
+	assert.Equal(t, rc.Params{
+		"srcFs": "/src",
+		"dstFs": "remote:dst",
+		"_config": map[string]interface{}{
+			"Transfers":  2,
+			"CheckFirst": true,
+			"Headers": []interface{}{
+				map[string]interface{}{"Key": "a", "Value": "b"},
+			},
+		},
+		"_filter": rc.Params{"FilterRule": []string{"- *.tmp"}},
+		"_group":  "run/photos",
+	}, photos.params())
+
+	check := f.Jobs["check"]
+	assert.Equal(t, "operations/check", check.call.Path)
+	assert.Nil(t, check.schedule)
+	assert.Equal(t, 0, check.retries())
+	assert.Equal(t, time.Minute, check.retryDelay)
+	assert.Equal(t, webhookFailure, check.WebhookOn)
+	assert.Equal(t, "http://example.com/hook", check.Webhook)
+	assert.Equal(t, true, check.params()["oneway"])
+	assert.Equal(t, map[string]interface{}{"Transfers": 8, "CheckFirst": true}, check.params()["_config"])
+
+	names, err := f.closure([]string{"check"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"check", "photos"}, names)
+	names, err = f.closure([]string{"photos"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"photos"}, names)
+	_, err = f.closure([]string{"potato"})
+	assert.EqualError(t, err, `unknown job "potato"`)
+}
+
+func TestParseJobFileErrors(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		wantErr string
+	}{
+		{"jobs:\n", "no jobs in job file"},
+		{"potato: 1\n", "failed to parse job file"},
+		{"jobs:\n  a:\n    src: /\n", `job "a": command not set`},
+		{"jobs:\n  a:\n    command: potato\n", `job "a": unknown command "potato"`},
+		{"jobs:\n  a:\n    command: copy\n    potato: 1\n", "field potato not found"},
+		{"jobs:\n  a:\n    command: copy\n    schedule: '* *'\n", `job "a": schedule "* *": expecting 5 fields`},
+		{"jobs:\n  a:\n    command: copy\n    retries: -1\n", `job "a": retries must not be negative`},
+		{"jobs:\n  a:\n    command: copy\n    retry_delay: soon\n", `job "a": invalid retry_delay`},
+		{"jobs:\n  a:\n    command: copy\n    webhook_on: never\n", `job "a": webhook_on must be`},
+		{"jobs:\n  a:\n    command: copy\n    depends: [b]\n", `job "a": depends on unknown job "b"`},
+		{"jobs:\n  a:\n    command: copy\n    config:\n      Potato: 1\n", `job "a": invalid config: json: unknown field "Potato"`},
+		{"jobs:\n  a:\n    command: copy\n    depends: [b]\n  b:\n    command: copy\n    depends: [a]\n", "jobs depend on each other: a -> b -> a"},
+	} {
+		_, err := parseJobFile([]byte(test.in))
+		require.Error(t, err, test.in)
+		assert.Contains(t, err.Error(), test.wantErr, test.in)
+	}
+}
@@ -0,0 +1,119 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs/rc"
+)
+
+var (
+	activeMu     sync.Mutex
+	activeRunner *runner // the runner of rclone run --daemon if running
+	activeCtx    context.Context
+)
+
+// setActive sets the runner the rc calls control
+func setActive(ctx context.Context, r *runner) {
+	activeMu.Lock()
+	activeRunner, activeCtx = r, ctx
+	activeMu.Unlock()
+}
+
+// clearActive removes the runner the rc calls control
+func clearActive() {
+	activeMu.Lock()
+	activeRunner, activeCtx = nil, nil
+	activeMu.Unlock()
+}
+
+// getActive returns the runner the rc calls control
+func getActive() (context.Context, *runner, error) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	if activeRunner == nil {
+		return nil, nil, errors.New("rclone run --daemon is not running")
+	}
+	return activeCtx, activeRunner, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "run/list",
+		Fn:    rcList,
+		Title: "List the jobs of rclone run and their status",
+		Help: `This lists the jobs in the job file of the running
+` + "`rclone run --daemon`" + ` command.
+
+It returns
+
+- jobs - an array of the jobs, each with
+    - name - the name of the job
+    - command - the command the job runs
+    - schedule - when the job runs
+    - depends - the jobs this job depends on
+    - status - one of idle, waiting, running, success, failed, skipped or cancelled
+    - jobid - the ID of the last rc job the job ran which can be passed to job/status
+    - attempts - the number of attempts made in the last run
+    - runs - the number of times the job has been run
+    - failures - the number of those runs which failed
+    - lastStart - when the last run started
+    - lastEnd - when the last run ended
+    - lastError - the error from the last run if it failed
+    - nextRun - when the job will next run on its schedule
+
+The stats of each job are kept in the stats group "run/<name>".
+`,
+	})
+}
+
+// List the jobs and their status
+func rcList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	_, r, err := getActive()
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"jobs": r.list()}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "run/start",
+		AuthRequired: true,
+		Fn:           rcStart,
+		Title:        "Start jobs of rclone run now",
+		Help: `This starts jobs in the job file of the running
+` + "`rclone run --daemon`" + ` command now, without waiting for their
+schedules. The jobs they depend on are run first.
+
+This takes the following parameters:
+
+- name - the name of the job to run, or a comma separated list of names
+
+The jobs are run in the background. Use run/list to see how they are
+getting on.
+`,
+	})
+}
+
+// Start jobs now
+func rcStart(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	name, err := in.GetString("name")
+	if err != nil {
+		return nil, err
+	}
+	runCtx, r, err := getActive()
+	if err != nil {
+		return nil, err
+	}
+	names := strings.Split(name, ",")
+	// Check the names before starting
+	_, err = r.file.closure(names)
+	if err != nil {
+		return nil, rc.NewErrParamInvalid(err)
+	}
+	r.start(runCtx, names)
+	return nil, nil
+}
@@ -0,0 +1,40 @@
+package run
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRc(t *testing.T) {
+	ctx := context.Background()
+	list := rc.Calls.Get("run/list")
+	require.NotNil(t, list)
+	start := rc.Calls.Get("run/start")
+	require.NotNil(t, start)
+	assert.True(t, start.AuthRequired)
+
+	_, err := list.Fn(ctx, rc.Params{})
+	assert.EqualError(t, err, "rclone run --daemon is not running")
+
+	f, err := parseJobFile([]byte("jobs:\n  a:\n    command: copy\n    schedule: '@daily'\n"))
+	require.NoError(t, err)
+	setActive(ctx, newRunner(f, 1))
+	defer clearActive()
+
+	out, err := list.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	jobs := out["jobs"].([]jobStatus)
+	require.Equal(t, 1, len(jobs))
+	assert.Equal(t, "a", jobs[0].Name)
+	assert.Equal(t, "@daily", jobs[0].Schedule)
+	assert.Equal(t, statusIdle, jobs[0].Status)
+
+	_, err = start.Fn(ctx, rc.Params{})
+	assert.True(t, rc.IsErrParamNotFound(err))
+	_, err = start.Fn(ctx, rc.Params{"name": "a,potato"})
+	assert.EqualError(t, err, `unknown job "potato"`)
+}
@@ -0,0 +1,146 @@
+// Package run provides the run command.
+package run
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemon  = false
+	jobList []string
+	maxJobs = 1
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &daemon, "daemon", "", daemon, "Keep running, starting the jobs on their schedules", "")
+	flags.StringArrayVarP(cmdFlags, &jobList, "job", "", jobList, "Only run this job and the jobs it depends on (can be repeated)", "")
+	flags.IntVarP(cmdFlags, &maxJobs, "max-jobs", "", maxJobs, "Number of jobs to run at once", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "run jobs.yaml",
+	Short: `Run the copy, sync and check jobs defined in a job file.`,
+	Long: `
+This runs the jobs defined in a YAML job file, either once or, with
+` + "`--daemon`" + `, whenever they are due on their schedules. It can replace
+wrapping rclone in cron jobs and shell scripts.
+
+Here is an example job file:
+
+` + "```yaml" + `
+defaults:
+  retries: 2
+  retry_delay: 1m
+  webhook: https://example.com/rclone-hook
+  webhook_on: failure
+jobs:
+  photos:
+    command: sync
+    src: /home/user/photos
+    dst: remote:photos
+    filter:
+      - "- *.tmp"
+      - "+ *.jpg"
+      - "- *"
+    config:
+      Transfers: 8
+      BwLimit: 10M
+    schedule: "0 2 * * *"
+  check-photos:
+    command: check
+    src: /home/user/photos
+    dst: remote:photos
+    params:
+      oneway: true
+    depends: [photos]
+    schedule: "0 6 * * sun"
+` + "```" + `
+
+Each job has these settings, any of which apart from ` + "`src`" + `,
+` + "`dst`" + `, ` + "`schedule`" + ` and ` + "`depends`" + ` can be given in ` + "`defaults`" + `
+to apply to all the jobs.
+
+- ` + "`command`" + ` - one of ` + "`copy`" + `, ` + "`sync`" + `, ` + "`move`" + `, ` + "`bisync`" + ` or ` + "`check`" + `, or
+  the path of any rc call, e.g. ` + "`operations/purge`" + `.
+- ` + "`src`" + ` and ` + "`dst`" + ` - the source and destination, passed to the rc
+  call as ` + "`srcFs`" + ` and ` + "`dstFs`" + `.
+- ` + "`params`" + ` - any other parameters to pass to the rc call, as
+  described in the [rc docs](/rc/).
+- ` + "`filter`" + ` - filter rules for the job as used by ` + "`--filter`" + `. These
+  are added to any filter flags given on the command line.
+- ` + "`config`" + ` - overrides for the global config as used by the ` + "`_config`" + `
+  rc parameter. The names are the names of the fields of the config,
+  e.g. ` + "`Transfers`" + `, ` + "`CheckFirst`" + ` or ` + "`DryRun`" + `. Values in ` + "`defaults`" + ` and the
+  job are merged.
+- ` + "`schedule`" + ` - when to run the job with ` + "`--daemon`" + ` in cron syntax:
+  ` + "`minute hour day-of-month month day-of-week`" + `, or one of ` + "`@hourly`" + `,
+  ` + "`@daily`" + `, ` + "`@weekly`" + `, ` + "`@monthly`" + ` or ` + "`@yearly`" + `. Times are local.
+- ` + "`depends`" + ` - a list of jobs which must succeed before this job is
+  run. If one fails this job is skipped.
+- ` + "`retries`" + ` - the number of times to retry the job if it fails
+  (default 0).
+- ` + "`retry_delay`" + ` - how long to wait between retries (default 10s).
+- ` + "`webhook`" + ` - a URL to POST the result of the job to as JSON.
+- ` + "`webhook_on`" + ` - when to POST the result: ` + "`always`" + ` (the default),
+  ` + "`success`" + ` or ` + "`failure`" + `.
+
+Without ` + "`--daemon`" + ` all the jobs are run once, ignoring their
+schedules, and rclone exits with an error if any of them failed. Use
+` + "`--job`" + ` to run only some of the jobs and the jobs they depend on.
+
+With ` + "`--daemon`" + ` rclone keeps running, starting each job with a
+schedule when it is due, after running the jobs it depends on. Jobs
+without a schedule are only run as dependencies. If a job is still
+running when it is next due, that run is skipped.
+
+Jobs are run one at a time unless ` + "`--max-jobs`" + ` is set higher.
+
+Each run of a job is an rc job so it can be seen and stopped with the
+` + "`job/list`" + `, ` + "`job/status`" + ` and ` + "`job/stop`" + ` rc calls if the remote
+control is enabled with ` + "`--rc`" + `. The stats of each job are kept in the
+stats group ` + "`run/<name>`" + `. The ` + "`run/list`" + ` rc call shows the status of
+all the jobs and ` + "`run/start`" + ` runs a job straight away.
+
+    rclone run jobs.yaml
+    rclone run --job photos jobs.yaml
+    rclone run --daemon --rc jobs.yaml
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		cmd.Run(false, false, command, func() error {
+			file, err := loadJobFile(args[0])
+			if err != nil {
+				return err
+			}
+			return run(context.Background(), file)
+		})
+	},
+}
+
+// run the jobs in file as set by the flags
+func run(ctx context.Context, file *jobFile) error {
+	r := newRunner(file, maxJobs)
+	if daemon {
+		if len(jobList) > 0 {
+			return errors.New("can't use --job with --daemon")
+		}
+		setActive(ctx, r)
+		defer clearActive()
+		return r.daemon(ctx)
+	}
+	names := jobList
+	if len(names) == 0 {
+		names = file.names
+	}
+	return r.runJobs(ctx, names)
+}
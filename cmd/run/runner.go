@@ -0,0 +1,404 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fshttp"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+)
+
+// The states a job can be in
+const (
+	statusIdle      = "idle"
+	statusWaiting   = "waiting"
+	statusRunning   = "running"
+	statusSuccess   = "success"
+	statusFailed    = "failed"
+	statusSkipped   = "skipped"
+	statusCancelled = "cancelled"
+)
+
+// errDependencyFailed is returned for jobs which weren't run because
+// a job they depend on failed
+var errDependencyFailed = errors.New("not run as a job it depends on failed")
+
+// For overriding in unittests.
+var (
+	timeNowFunc = time.Now
+)
+
+// jobStatus is the status of a job as returned by run/list
+type jobStatus struct {
+	Name      string    `json:"name"`
+	Command   string    `json:"command"`
+	Schedule  string    `json:"schedule,omitempty"`
+	Depends   []string  `json:"depends,omitempty"`
+	Status    string    `json:"status"`
+	JobID     int64     `json:"jobid,omitempty"` // ID of the rc job of the last attempt
+	Attempts  int       `json:"attempts"`        // attempts made by the last run
+	Runs      int       `json:"runs"`            // number of times the job has been run
+	Failures  int       `json:"failures"`        // number of those runs which failed
+	LastStart time.Time `json:"lastStart"`
+	LastEnd   time.Time `json:"lastEnd"`
+	LastError string    `json:"lastError,omitempty"`
+	NextRun   time.Time `json:"nextRun"`
+}
+
+// jobResult is the result of a run of a job, err is set before done
+// is closed
+type jobResult struct {
+	done chan struct{}
+	err  error
+}
+
+// runner runs the jobs in a job file
+type runner struct {
+	file     *jobFile
+	limit    chan struct{} // limits the number of jobs running at once
+	jobMu    map[string]*sync.Mutex
+	mu       sync.Mutex // protects status and inflight
+	status   map[string]*jobStatus
+	inflight map[string]*jobResult // runs of jobs started by runJobs which haven't finished
+	running  sync.WaitGroup        // jobs started with start
+}
+
+func newRunner(file *jobFile, maxJobs int) *runner {
+	if maxJobs < 1 {
+		maxJobs = 1
+	}
+	r := &runner{
+		file:     file,
+		limit:    make(chan struct{}, maxJobs),
+		jobMu:    make(map[string]*sync.Mutex, len(file.names)),
+		status:   make(map[string]*jobStatus, len(file.names)),
+		inflight: make(map[string]*jobResult, len(file.names)),
+	}
+	for _, name := range file.names {
+		job := file.Jobs[name]
+		r.jobMu[name] = new(sync.Mutex)
+		r.status[name] = &jobStatus{
+			Name:     name,
+			Command:  job.Command,
+			Schedule: job.Schedule,
+			Depends:  job.Depends,
+			Status:   statusIdle,
+		}
+	}
+	return r
+}
+
+// setStatus updates the status of the job called name with fn
+func (r *runner) setStatus(name string, fn func(s *jobStatus)) {
+	r.mu.Lock()
+	fn(r.status[name])
+	r.mu.Unlock()
+}
+
+// list returns a copy of the status of all the jobs
+func (r *runner) list() []jobStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]jobStatus, 0, len(r.file.names))
+	for _, name := range r.file.names {
+		out = append(out, *r.status[name])
+	}
+	return out
+}
+
+// runJobs runs the jobs called names and the jobs they depend on,
+// running each job once the jobs it depends on have succeeded.
+//
+// If a job depended on is already being run by another call of
+// runJobs, for example because jobs depending on it were scheduled at
+// the same time, the result of that run is used rather than running
+// it again. The jobs called names are always run.
+func (r *runner) runJobs(ctx context.Context, names []string) error {
+	requested := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		requested[name] = struct{}{}
+	}
+	names, err := r.file.closure(names)
+	if err != nil {
+		return err
+	}
+	results := make(map[string]*jobResult, len(names))
+	var start []string
+	r.mu.Lock()
+	for _, name := range names {
+		if _, ok := requested[name]; !ok {
+			if res := r.inflight[name]; res != nil {
+				fs.Debugf(name, "Using the run of the job already in progress")
+				results[name] = res
+				continue
+			}
+		}
+		res := &jobResult{done: make(chan struct{})}
+		results[name] = res
+		r.inflight[name] = res
+		r.status[name].Status = statusWaiting
+		start = append(start, name)
+	}
+	r.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, name := range start {
+		name := name
+		job := r.file.Jobs[name]
+		res := results[name]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(res.done)
+			defer func() {
+				r.mu.Lock()
+				if r.inflight[name] == res {
+					delete(r.inflight, name)
+				}
+				r.mu.Unlock()
+			}()
+			for _, dep := range job.Depends {
+				<-results[dep].done
+				if results[dep].err != nil {
+					fs.Errorf(name, "Skipping job as %q failed", dep)
+					r.setStatus(name, func(s *jobStatus) { s.Status = statusSkipped })
+					res.err = errDependencyFailed
+					return
+				}
+			}
+			select {
+			case r.limit <- struct{}{}:
+			case <-ctx.Done():
+				r.setStatus(name, func(s *jobStatus) { s.Status = statusCancelled })
+				res.err = ctx.Err()
+				return
+			}
+			res.err = r.runJob(ctx, job)
+			<-r.limit
+		}()
+	}
+	wg.Wait()
+	failed := 0
+	for _, res := range results {
+		if res.err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed", failed, len(names))
+	}
+	return nil
+}
+
+// runJob runs job retrying it if it fails
+func (r *runner) runJob(ctx context.Context, job *jobSpec) (err error) {
+	// Only run each job once at a time
+	mu := r.jobMu[job.name]
+	mu.Lock()
+	defer mu.Unlock()
+
+	start := timeNowFunc()
+	r.setStatus(job.name, func(s *jobStatus) {
+		s.Status = statusRunning
+		s.Attempts = 0
+		s.LastStart = start
+		s.LastEnd = time.Time{}
+		s.LastError = ""
+	})
+	accounting.StatsGroup(ctx, job.group()).ResetCounters()
+
+	var (
+		out   rc.Params
+		jobID int64
+		tries = job.retries() + 1
+	)
+	for attempt := 1; attempt <= tries; attempt++ {
+		fs.Infof(job.name, "Starting job (attempt %d/%d)", attempt, tries)
+		var rcJob *jobs.Job
+		rcJob, out, err = jobs.NewJob(ctx, job.call.Fn, job.params())
+		if rcJob != nil {
+			jobID = rcJob.ID
+		}
+		if err == nil {
+			err = outputError(out)
+		}
+		r.setStatus(job.name, func(s *jobStatus) {
+			s.Attempts = attempt
+			s.JobID = jobID
+		})
+		if err == nil || attempt == tries || ctx.Err() != nil {
+			break
+		}
+		fs.Errorf(job.name, "Job failed, retrying in %v: %v", job.retryDelay, err)
+		select {
+		case <-time.After(job.retryDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	end := timeNowFunc()
+	r.setStatus(job.name, func(s *jobStatus) {
+		s.Runs++
+		s.LastEnd = end
+		if err != nil {
+			s.Status = statusFailed
+			s.Failures++
+			s.LastError = err.Error()
+		} else {
+			s.Status = statusSuccess
+		}
+	})
+	if err != nil {
+		fs.Errorf(job.name, "Job failed: %v", err)
+	} else {
+		fs.Logf(job.name, "Job succeeded in %v", end.Sub(start).Truncate(time.Millisecond))
+	}
+	r.notify(ctx, job, out, err)
+	return err
+}
+
+// outputError returns an error if the output of an rc call says it
+// failed, as operations/check does
+func outputError(out rc.Params) error {
+	if success, ok := out["success"].(bool); ok && !success {
+		if status, ok := out["status"].(string); ok && status != "" {
+			return errors.New(status)
+		}
+		return errors.New("command was not successful")
+	}
+	return nil
+}
+
+// webhookPayload is sent to the webhook when a job finishes
+type webhookPayload struct {
+	jobStatus
+	Success bool      `json:"success"`
+	Output  rc.Params `json:"output,omitempty"`
+	Stats   rc.Params `json:"stats,omitempty"`
+}
+
+// notify POSTs the result of the job to its webhook if configured
+func (r *runner) notify(ctx context.Context, job *jobSpec, out rc.Params, jobErr error) {
+	if job.Webhook == "" ||
+		(jobErr == nil && job.WebhookOn == webhookFailure) ||
+		(jobErr != nil && job.WebhookOn == webhookSuccess) {
+		return
+	}
+	payload := webhookPayload{
+		Success: jobErr == nil,
+		Output:  out,
+	}
+	r.mu.Lock()
+	payload.jobStatus = *r.status[job.name]
+	r.mu.Unlock()
+	stats, err := accounting.StatsGroup(ctx, job.group()).RemoteStats()
+	if err == nil {
+		payload.Stats = stats
+	}
+	err = postWebhook(ctx, job.Webhook, &payload)
+	if err != nil {
+		fs.Errorf(job.name, "Failed to send webhook: %v", err)
+	}
+}
+
+// postWebhook POSTs payload as JSON to url
+func postWebhook(ctx context.Context, url string, payload interface{}) (err error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := fshttp.NewClient(ctx).Do(req)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP error %s", resp.Status)
+	}
+	return nil
+}
+
+// start runs the jobs called names in the background
+func (r *runner) start(ctx context.Context, names []string) {
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		err := r.runJobs(ctx, names)
+		if err != nil {
+			fs.Errorf(nil, "run: %v", err)
+		}
+	}()
+}
+
+// daemon runs the jobs with a schedule whenever they are due until
+// ctx is cancelled.
+//
+// Jobs without a schedule are only run when jobs which depend on them
+// are run.
+func (r *runner) daemon(ctx context.Context) error {
+	scheduled := 0
+	var wg sync.WaitGroup
+	for _, name := range r.file.names {
+		job := r.file.Jobs[name]
+		if job.schedule == nil {
+			continue
+		}
+		scheduled++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.schedule(ctx, job)
+		}()
+	}
+	if scheduled == 0 {
+		return errors.New("no jobs have a schedule")
+	}
+	fs.Logf(nil, "Running %d scheduled jobs", scheduled)
+	wg.Wait()
+	r.running.Wait()
+	return nil
+}
+
+// schedule runs job whenever it is due until ctx is cancelled
+func (r *runner) schedule(ctx context.Context, job *jobSpec) {
+	for {
+		now := timeNowFunc()
+		next := job.schedule.next(now)
+		if next.IsZero() {
+			fs.Errorf(job.name, "Schedule %q never runs", job.Schedule)
+			return
+		}
+		r.setStatus(job.name, func(s *jobStatus) { s.NextRun = next })
+		fs.Debugf(job.name, "Next run at %v", next.Format(time.RFC3339))
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		if !r.jobMu[job.name].TryLock() {
+			fs.Logf(job.name, "Not starting job as the last run is still going")
+			continue
+		}
+		r.jobMu[job.name].Unlock()
+		r.start(ctx, []string{job.name})
+	}
+}
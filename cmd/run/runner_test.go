@@ -0,0 +1,180 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunJobs(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	dst := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "file1.txt"), []byte("hello"), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "file2.tmp"), []byte("potato"), 0666))
+
+	var (
+		mu       sync.Mutex
+		payloads []webhookPayload
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var payload webhookPayload
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		mu.Lock()
+		payloads = append(payloads, payload)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	f, err := parseJobFile([]byte(fmt.Sprintf(`
+defaults:
+  webhook: %q
+  webhook_on: failure
+jobs:
+  copy:
+    command: copy
+    src: %q
+    dst: %q
+    filter: ["- *.tmp"]
+  check:
+    command: check
+    src: %q
+    dst: %q
+    params:
+      oneway: true
+    filter: ["- *.tmp"]
+    depends: [copy]
+  missing:
+    command: copy
+    src: %q
+    dst: %q
+    retries: 1
+    retry_delay: 1ms
+  after-missing:
+    command: copy
+    src: %q
+    dst: %q
+    depends: [missing]
+`, server.URL, src, dst, src, dst, filepath.Join(src, "missing"), dst, src, dst)))
+	require.NoError(t, err)
+
+	r := newRunner(f, 2)
+
+	// Just the copy and check jobs
+	require.NoError(t, r.runJobs(ctx, []string{"check"}))
+	_, err = os.Stat(filepath.Join(dst, "file1.txt"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dst, "file2.tmp"))
+	assert.True(t, os.IsNotExist(err))
+	status := r.list()
+	assert.Equal(t, "after-missing", status[0].Name)
+	assert.Equal(t, statusIdle, status[0].Status)
+	assert.Equal(t, "check", status[1].Name)
+	assert.Equal(t, statusSuccess, status[1].Status)
+	assert.Equal(t, 1, status[1].Runs)
+	assert.Equal(t, "copy", status[2].Name)
+	assert.Equal(t, statusSuccess, status[2].Status)
+	assert.Equal(t, 1, status[2].Attempts)
+	assert.NotZero(t, status[2].JobID)
+	assert.False(t, status[2].LastEnd.Before(status[2].LastStart))
+
+	// Now a failing job and the job depending on it
+	err = r.runJobs(ctx, []string{"after-missing"})
+	assert.EqualError(t, err, "2 of 2 jobs failed")
+	status = r.list()
+	assert.Equal(t, statusSkipped, status[0].Status)
+	assert.Equal(t, 0, status[0].Runs)
+	assert.Equal(t, "missing", status[3].Name)
+	assert.Equal(t, statusFailed, status[3].Status)
+	assert.Equal(t, 2, status[3].Attempts)
+	assert.Equal(t, 1, status[3].Failures)
+	assert.Contains(t, status[3].LastError, "directory not found")
+
+	// Only the failure should have been sent to the webhook
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 1, len(payloads))
+	assert.Equal(t, "missing", payloads[0].Name)
+	assert.False(t, payloads[0].Success)
+	assert.Equal(t, statusFailed, payloads[0].Status)
+	assert.NotNil(t, payloads[0].Stats)
+}
+
+func TestRunJobsShareDependency(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	dst := t.TempDir()
+	f, err := parseJobFile([]byte(fmt.Sprintf(`
+jobs:
+  copy:
+    command: copy
+    src: %q
+    dst: %q
+  check:
+    command: check
+    src: %q
+    dst: %q
+    depends: [copy]
+`, src, dst, src, dst)))
+	require.NoError(t, err)
+	r := newRunner(f, 2)
+
+	// Pretend another call is running copy
+	res := &jobResult{done: make(chan struct{})}
+	r.inflight["copy"] = res
+	done := make(chan error)
+	go func() {
+		done <- r.runJobs(ctx, []string{"check"})
+	}()
+	select {
+	case <-done:
+		t.Fatal("check ran before copy finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(res.done)
+	require.NoError(t, <-done)
+
+	// check used the result of the copy in progress
+	status := r.list()
+	assert.Equal(t, "check", status[0].Name)
+	assert.Equal(t, 1, status[0].Runs)
+	assert.Equal(t, "copy", status[1].Name)
+	assert.Equal(t, 0, status[1].Runs)
+
+	// A failed run fails the jobs depending on it
+	res = &jobResult{done: make(chan struct{}), err: errors.New("boom")}
+	close(res.done)
+	r.inflight["copy"] = res
+	assert.EqualError(t, r.runJobs(ctx, []string{"check"}), "2 of 2 jobs failed")
+
+	// Jobs asked for are always run
+	require.NoError(t, r.runJobs(ctx, []string{"copy"}))
+	assert.Equal(t, 1, r.list()[1].Runs)
+	assert.Equal(t, 0, len(r.inflight))
+}
+
+func TestOutputError(t *testing.T) {
+	assert.NoError(t, outputError(nil))
+	assert.NoError(t, outputError(map[string]interface{}{"success": true}))
+	assert.EqualError(t, outputError(map[string]interface{}{"success": false}), "command was not successful")
+	assert.EqualError(t, outputError(map[string]interface{}{"success": false, "status": "2 differences found"}), "2 differences found")
+}
+
+func TestDaemonNoSchedule(t *testing.T) {
+	f, err := parseJobFile([]byte("jobs:\n  a:\n    command: copy\n"))
+	require.NoError(t, err)
+	assert.EqualError(t, newRunner(f, 1).daemon(context.Background()), "no jobs have a schedule")
+}
@@ -55,26 +55,12 @@ func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fi
 		return
 	}
 
-	// Read the mime type from the fs.Object if possible,
-	// otherwise fall back to working out what it is from the file path.
-	var mimeType string
-	if o, ok := fileInfo.DirEntry().(fs.Object); ok {
-		mimeType = fs.MimeType(context.TODO(), o)
-		// If backend doesn't know what the mime type is then
-		// try getting it from the file name
-		if mimeType == "application/octet-stream" {
-			mimeType = fs.MimeTypeFromName(fileInfo.Name())
-		}
-	} else {
-		mimeType = fs.MimeTypeFromName(fileInfo.Name())
-	}
-
-	mediaType := mediaMimeTypeRegexp.FindStringSubmatch(mimeType)
-	if mediaType == nil {
+	mimeType, class := mediaClass(fileInfo)
+	if class == "" {
 		return
 	}
 
-	obj.Class = "object.item." + mediaType[1] + "Item"
+	obj.Class = class
 	obj.Title = fileInfo.Name()
 	obj.Date = upnpav.Timestamp{Time: fileInfo.ModTime()}
 
@@ -83,34 +69,62 @@ func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fi
 		Res:    make([]upnpav.Resource, 0, 1),
 	}
 
+	// Offer the transcoded version first so TVs which can't play
+	// the original choose it
+	if cds.transcoder.wants(fileInfo.Name()) {
+		item.Res = append(item.Res, upnpav.Resource{
+			URL:          transcodedResourceURL(host, cdsObject.Path),
+			ProtocolInfo: cds.transcoder.protocolInfo(),
+		})
+	}
+
 	item.Res = append(item.Res, upnpav.Resource{
-		URL: (&url.URL{
-			Scheme: "http",
-			Host:   host,
-			Path:   path.Join(resPath, cdsObject.Path),
-		}).String(),
+		URL: resourceURL(host, cdsObject.Path, ""),
 		ProtocolInfo: fmt.Sprintf("http-get:*:%s:%s", mimeType, dlna.ContentFeatures{
 			SupportRange: true,
 		}.String()),
 		Size: uint64(fileInfo.Size()),
 	})
 
-	for _, resource := range resources {
-		subtitleURL := (&url.URL{
-			Scheme: "http",
-			Host:   host,
-			Path:   path.Join(resPath, resource.Path()),
-		}).String()
-		item.Res = append(item.Res, upnpav.Resource{
-			URL:          subtitleURL,
-			ProtocolInfo: fmt.Sprintf("http-get:*:%s:*", "text/srt"),
-		})
-	}
+	addSubtitles(&item, resources, host)
 
 	ret = item
 	return
 }
 
+// mediaClass returns the MIME type and UPnP class of a file, or an
+// empty class if it isn't a media file.
+func mediaClass(fileInfo vfs.Node) (mimeType, class string) {
+	// Read the mime type from the fs.Object if possible,
+	// otherwise fall back to working out what it is from the file path.
+	if o, ok := fileInfo.DirEntry().(fs.Object); ok {
+		mimeType = fs.MimeType(context.TODO(), o)
+		// If backend doesn't know what the mime type is then
+		// try getting it from the file name
+		if mimeType == "application/octet-stream" {
+			mimeType = fs.MimeTypeFromName(fileInfo.Name())
+		}
+	} else {
+		mimeType = fs.MimeTypeFromName(fileInfo.Name())
+	}
+
+	mediaType := mediaMimeTypeRegexp.FindStringSubmatch(mimeType)
+	if mediaType == nil {
+		return mimeType, ""
+	}
+	return mimeType, "object.item." + mediaType[1] + "Item"
+}
+
+// resourceURL returns the URL of remote on the server at host
+func resourceURL(host, remote, rawQuery string) string {
+	return (&url.URL{
+		Scheme:   "http",
+		Host:     host,
+		Path:     path.Join(resPath, remote),
+		RawQuery: rawQuery,
+	}).String()
+}
+
 // Returns all the upnpav objects in a directory.
 func (cds *contentDirectoryService) readContainer(o object, host string) (ret []interface{}, err error) {
 	node, err := cds.vfs.Stat(o.Path)
@@ -158,23 +172,25 @@ func (cds *contentDirectoryService) readContainer(o object, host string) (ret []
 func mediaWithResources(nodes vfs.Nodes) (vfs.Nodes, map[vfs.Node]vfs.Nodes) {
 	media, mediaResources := vfs.Nodes{}, make(map[vfs.Node]vfs.Nodes)
 
-	// First, separate out the subtitles and media into maps, keyed by their lowercase base names.
-	mediaByName, subtitlesByName := make(map[string]vfs.Nodes), make(map[string]vfs.Node)
+	// First, separate out the subtitles, and the media into a map keyed by their lowercase base names.
+	mediaByName, subtitles := make(map[string]vfs.Nodes), vfs.Nodes{}
 	for _, node := range nodes {
 		baseName, ext := splitExt(strings.ToLower(node.Name()))
 		switch ext {
-		case ".srt", ".ass", ".ssa", ".sub", ".idx", ".sup", ".jss", ".txt", ".usf", ".cue", ".vtt", ".css":
+		case ".srt", ".ass", ".ssa", ".sub", ".idx", ".sup", ".jss", ".txt", ".usf", ".cue", ".vtt", ".css", ".smi":
 			// .idx should be with .sub, .css should be with vtt otherwise they should be culled,
 			// and their mimeTypes are not consistent, but anyway these negatives don't throw errors.
-			subtitlesByName[baseName] = node
+			subtitles = append(subtitles, node)
 		default:
 			mediaByName[baseName] = append(mediaByName[baseName], node)
 			media = append(media, node)
 		}
 	}
 
-	// Find the associated media file for each subtitle
-	for baseName, node := range subtitlesByName {
+	// Find the associated media file for each subtitle, keeping
+	// them in order so the same one is preferred each time
+	for _, node := range subtitles {
+		baseName, _ := splitExt(strings.ToLower(node.Name()))
 		// Find a media file with the same basename (video.mp4 for video.srt)
 		mediaNodes, found := mediaByName[baseName]
 		if !found {
@@ -207,6 +223,21 @@ type browse struct {
 	RequestedCount int
 }
 
+// page returns requestedCount objects from startingIndex, or all of
+// them if requestedCount is 0
+func page(objs []interface{}, startingIndex, requestedCount int) []interface{} {
+	if startingIndex > len(objs) {
+		startingIndex = len(objs)
+	}
+	if startingIndex > 0 {
+		objs = objs[startingIndex:]
+	}
+	if requestedCount != 0 && requestedCount < len(objs) {
+		objs = objs[:requestedCount]
+	}
+	return objs
+}
+
 // ContentDirectory object from ObjectID.
 func (cds *contentDirectoryService) objectFromID(id string) (o object, err error) {
 	o.Path, err = url.QueryUnescape(id)
@@ -252,16 +283,7 @@ func (cds *contentDirectoryService) Handle(action string, argsXML []byte, r *htt
 				return nil, upnp.Errorf(upnpav.NoSuchObjectErrorCode, err.Error())
 			}
 			totalMatches := len(objs)
-			objs = objs[func() (low int) {
-				low = browse.StartingIndex
-				if low > len(objs) {
-					low = len(objs)
-				}
-				return
-			}():]
-			if browse.RequestedCount != 0 && browse.RequestedCount < len(objs) {
-				objs = objs[:browse.RequestedCount]
-			}
+			objs = page(objs, browse.StartingIndex, browse.RequestedCount)
 			result, err := xml.Marshal(objs)
 			if err != nil {
 				return nil, err
@@ -277,8 +299,11 @@ func (cds *contentDirectoryService) Handle(action string, argsXML []byte, r *htt
 			if err != nil {
 				return nil, err
 			}
-			// TODO: External subtitles won't appear in the metadata here, but probably should.
-			upnpObject, err := cds.cdsObjectToUpnpavObject(obj, node, vfs.Nodes{}, host)
+			var subtitles vfs.Nodes
+			if node.IsFile() {
+				subtitles = cds.subtitlesFor(node)
+			}
+			upnpObject, err := cds.cdsObjectToUpnpavObject(obj, node, subtitles, host)
 			if err != nil {
 				return nil, err
 			}
@@ -294,8 +319,14 @@ func (cds *contentDirectoryService) Handle(action string, argsXML []byte, r *htt
 		}
 	case "GetSearchCapabilities":
 		return map[string]string{
-			"SearchCaps": "",
+			"SearchCaps": searchCaps,
 		}, nil
+	case "Search":
+		var search search
+		if err := xml.Unmarshal(argsXML, &search); err != nil {
+			return nil, err
+		}
+		return cds.search(&search, host)
 	// Samsung Extensions
 	case "X_GetFeatureList":
 		return map[string]string{
@@ -44,9 +44,10 @@ supported. Service discovery uses UDP multicast packets (SSDP) and
 will thus only work on LANs.
 
 Rclone will list all files present in the remote, without filtering
-based on media formats or file extensions. Additionally, there is no
-media transcoding support. This means that some players might show
-files that they are not able to play back correctly.
+based on media formats or file extensions. By default files are served
+as they are, so some players might show files that they are not able
+to play back correctly. See the transcoding section below to convert
+them with an external transcoder such as ffmpeg.
 
 ` + dlnaflags.Help + vfs.Help,
 	Annotations: map[string]string{
@@ -101,6 +102,12 @@ type server struct {
 
 	f   fs.Fs
 	vfs *vfs.VFS
+
+	// For converting files players can't play, nil if not in use
+	transcoder *transcoder
+
+	// For the Search action
+	index searchIndex
 }
 
 func newServer(f fs.Fs, opt *dlnaflags.Options) (*server, error) {
@@ -123,6 +130,10 @@ func newServer(f fs.Fs, opt *dlnaflags.Options) (*server, error) {
 	if len(interfaces) == 0 {
 		interfaces = listInterfaces()
 	}
+	transcoder, err := newTranscoder(opt)
+	if err != nil {
+		return nil, err
+	}
 
 	s := &server{
 		AnnounceInterval: opt.AnnounceInterval,
@@ -133,6 +144,7 @@ func newServer(f fs.Fs, opt *dlnaflags.Options) (*server, error) {
 		httpListenAddr:   opt.ListenAddr,
 		f:                f,
 		vfs:              vfs.New(f, &vfsflags.Opt),
+		transcoder:       transcoder,
 	}
 
 	s.services = map[string]UPnPService{
@@ -259,8 +271,24 @@ func (s *server) resourceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Get(transcodeParam) != "" && s.transcoder != nil {
+		s.transcodeHandler(w, r, node)
+		return
+	}
+
 	w.Header().Set("Content-Length", strconv.FormatInt(node.Size(), 10))
 
+	if _, class := mediaClass(node); class != "" {
+		// Samsung TVs ask for the subtitles when they play the file
+		if r.Header.Get("getCaptionInfo.sec") != "" {
+			if subtitle := preferredSubtitle(s.subtitlesFor(node)); subtitle != nil {
+				w.Header().Set("CaptionInfo.sec", resourceURL(r.Host, subtitle.Path(), ""))
+			}
+		}
+	} else if _, ok := subtitleMimeTypes["."+subtitleExt(node.Name())]; ok {
+		w.Header().Set("Content-Type", subtitleMimeType(node.Name()))
+	}
+
 	// add some DLNA specific headers
 	if r.Header.Get("getContentFeatures.dlna.org") != "" {
 		w.Header().Set("contentFeatures.dlna.org", dms_dlna.ContentFeatures{
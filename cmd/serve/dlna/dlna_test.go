@@ -207,3 +207,197 @@ func TestContentDirectoryBrowseDirectChildren(t *testing.T) {
 	require.Contains(t, string(body), "/r/subdir/video.mp4")
 	require.Contains(t, string(body), "/r/subdir/video.srt")
 }
+
+// soapRequest posts a ContentDirectory action to the server at base
+// returning the status and the unescaped body
+func soapRequest(t *testing.T, base, action, args string) (int, string) {
+	req, err := http.NewRequest("POST", base+serviceControlURL, strings.NewReader(`
+<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"
+            s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+    <s:Body>
+        <u:`+action+` xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">`+args+`</u:`+action+`>
+    </s:Body>
+</s:Envelope>`))
+	require.NoError(t, err)
+	req.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#`+action+`"`)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer fs.CheckClose(resp.Body, &err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, html.UnescapeString(string(body))
+}
+
+// Check that the subtitles are offered in the ways TVs look for them.
+func TestSubtitles(t *testing.T) {
+	code, body := soapRequest(t, baseURL, "Browse", `
+            <ObjectID>%2Fvideo.mp4</ObjectID>
+            <BrowseFlag>BrowseMetadata</BrowseFlag>
+            <Filter>*</Filter>
+            <StartingIndex>0</StartingIndex>
+            <RequestedCount>0</RequestedCount>`)
+	assert.Equal(t, http.StatusOK, code)
+	// Extra resources
+	assert.Contains(t, body, `protocolInfo="http-get:*:text/srt:*">`+baseURL+`/r/video.srt</res>`)
+	assert.Contains(t, body, `protocolInfo="http-get:*:text/srt:*">`+baseURL+`/r/video.en.srt</res>`)
+	// Samsung
+	assert.Contains(t, body, `<sec:CaptionInfoEx sec:type="srt">`+baseURL+`/r/video.en.srt</sec:CaptionInfoEx>`)
+	assert.Contains(t, body, `xmlns:sec="http://www.sec.co.kr/"`)
+	// Sony and Panasonic
+	assert.Contains(t, body, `pv:subtitleFileType="SRT" pv:subtitleFileUri="`+baseURL+`/r/video.en.srt"`)
+
+	req, err := http.NewRequest("HEAD", baseURL+resPath+"video.mp4", nil)
+	require.NoError(t, err)
+	req.Header.Set("getCaptionInfo.sec", "1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, baseURL+"/r/video.en.srt", resp.Header.Get("CaptionInfo.sec"))
+
+	resp, err = http.Get(baseURL + resPath + "video.srt")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, "text/srt", resp.Header.Get("Content-Type"))
+}
+
+// Check that ContentDirectory#Search finds the media files.
+func TestContentDirectorySearch(t *testing.T) {
+	search := func(containerID, criteria string) (int, string) {
+		return soapRequest(t, baseURL, "Search", `
+            <ContainerID>`+containerID+`</ContainerID>
+            <SearchCriteria>`+html.EscapeString(criteria)+`</SearchCriteria>
+            <Filter>*</Filter>
+            <StartingIndex>0</StartingIndex>
+            <RequestedCount>0</RequestedCount>
+            <SortCriteria></SortCriteria>`)
+	}
+
+	code, body := search("0", `upnp:class derivedfrom "object.item.videoItem" and dc:title contains "VIDEO"`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "<TotalMatches>2</TotalMatches>")
+	assert.Contains(t, body, "/r/video.mp4<")
+	assert.Contains(t, body, "/r/subdir/video.mp4<")
+	assert.NotContains(t, body, "small_jpeg.jpg")
+
+	// Only in the container
+	code, body = search("%2Fsubdir", `upnp:class derivedfrom "object.item"`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "<TotalMatches>1</TotalMatches>")
+	assert.Contains(t, body, "/r/subdir/video.mp4<")
+
+	code, body = search("0", `upnp:class = "object.item.imageItem" or upnp:class = "object.container.storageFolder"`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "<TotalMatches>2</TotalMatches>")
+	assert.Contains(t, body, "small_jpeg.jpg")
+	assert.Contains(t, body, "<dc:title>subdir</dc:title>")
+
+	code, body = search("0", `dc:title contains`)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "<errorCode>708</errorCode>")
+
+	code, body = search("%2Fmissing", `*`)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "<errorCode>710</errorCode>")
+
+	code, body = soapRequest(t, baseURL, "GetSearchCapabilities", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, searchCaps)
+}
+
+// TestTranscoderHelper is run as the transcoder by TestTranscode. It
+// writes its arguments followed by the file it is given.
+func TestTranscoderHelper(t *testing.T) {
+	if os.Getenv("RCLONE_TEST_TRANSCODER") == "" {
+		t.Skip("only run as a transcoder")
+	}
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	resp, err := http.Get(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("start=%s\n", args[1])
+	_, _ = io.Copy(os.Stdout, resp.Body)
+	os.Exit(0)
+}
+
+// Check that files are transcoded with the external transcoder.
+func TestTranscode(t *testing.T) {
+	t.Setenv("RCLONE_TEST_TRANSCODER", "1")
+	f, err := fs.NewFs(context.Background(), "testdata/files")
+	require.NoError(t, err)
+	opt := dlnaflags.DefaultOpt
+	opt.ListenAddr = testBindAddress
+	opt.TranscodeCmd = os.Args[0]
+	opt.TranscodeArgs = "-test.run=TestTranscoderHelper -- {in} {start}"
+	opt.TranscodeExts = []string{"mp4"}
+	s, err := newServer(f, &opt)
+	require.NoError(t, err)
+	require.NoError(t, s.Serve())
+	defer s.Close()
+	base := "http://" + s.HTTPConn.Addr().String()
+
+	// The transcoded version is offered first
+	code, body := soapRequest(t, base, "Browse", `
+            <ObjectID>%2Fvideo.mp4</ObjectID>
+            <BrowseFlag>BrowseMetadata</BrowseFlag>
+            <Filter>*</Filter>
+            <StartingIndex>0</StartingIndex>
+            <RequestedCount>0</RequestedCount>`)
+	assert.Equal(t, http.StatusOK, code)
+	transcodedRes := strings.Index(body, `protocolInfo="http-get:*:video/mpeg:DLNA.ORG_OP=10;DLNA.ORG_CI=1;`)
+	originalRes := strings.Index(body, `protocolInfo="http-get:*:video/mp4:`)
+	assert.True(t, transcodedRes >= 0 && originalRes > transcodedRes, body)
+	assert.Contains(t, body, base+"/r/video.mp4?transcode=1</res>")
+
+	original, err := os.ReadFile("testdata/files/video.mp4")
+	require.NoError(t, err)
+	get := func(seek string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", base+resPath+"video.mp4?transcode=1", nil)
+		require.NoError(t, err)
+		if seek != "" {
+			req.Header.Set("TimeSeekRange.dlna.org", seek)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer fs.CheckClose(resp.Body, &err)
+		got, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(got)
+	}
+	resp, got := get("")
+	assert.Equal(t, "video/mpeg", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "start=0.000\n"+string(original), got)
+
+	resp, got = get("npt=0:01:02.500-")
+	assert.Equal(t, "npt=00:01:02.500-", resp.Header.Get("TimeSeekRange.dlna.org"))
+	assert.True(t, strings.HasPrefix(got, "start=62.500\n"), got)
+
+	_, got = get("npt=10.5-")
+	assert.True(t, strings.HasPrefix(got, "start=10.500\n"), got)
+
+	resp, _ = get("bytes=0-")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Transcodes over --transcode-max are refused
+	for i := 0; i < opt.TranscodeMax; i++ {
+		s.transcoder.slots <- struct{}{}
+	}
+	resp, _ = get("")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	for i := 0; i < opt.TranscodeMax; i++ {
+		<-s.transcoder.slots
+	}
+
+	// Files which aren't transcoded
+	resp, err = http.Get(base + resPath + "small_jpeg.jpg?transcode=1")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -22,6 +22,45 @@ default "rclone (hostname)".
 
 Use ` + "`--log-trace` in conjunction with `-vv`" + ` to enable additional debug
 logging of all UPNP traffic.
+
+### Transcoding
+
+Many TVs can't play some files, for example MKV files or HEVC video.
+Use ` + "`--transcode-cmd`" + ` to give the path of an external transcoder,
+such as ffmpeg, and rclone will offer a transcoded version of each
+file with an extension in ` + "`--transcode-ext`" + ` as well as the original.
+The transcoded version is listed first so most TVs play it.
+
+When a TV plays the transcoded version rclone runs the transcoder with
+` + "`--transcode-args`" + ` and streams what it writes to its standard output
+to the TV. The arguments are split on spaces and these placeholders
+are replaced:
+
+- ` + "`{in}`" + ` - the URL the transcoder can read the original file from
+- ` + "`{start}`" + ` - the time in seconds to start from when the TV seeks
+
+The default arguments are for ffmpeg and make an MPEG transport stream
+with H.264 video and AAC audio, which almost all TVs can play. Set
+` + "`--transcode-mime-type`" + ` to the type of file the arguments make.
+
+Transcoding uses a lot of CPU so at most ` + "`--transcode-max`" + ` files are
+transcoded at once. Requests for more are refused with HTTP status
+503 until one of the transcoders finishes.
+
+### Subtitles
+
+Subtitle files next to a media file with the same name, e.g.
+` + "`video.srt` or `video.en.srt` for `video.mkv`" + `, are offered to TVs in
+the ways the common vendors look for them: as extra resources of the
+item, as Samsung ` + "`CaptionInfo`" + ` elements and headers and as the
+` + "`pv:subtitleFileUri`" + ` attribute used by Sony and Panasonic.
+
+### Search
+
+The ContentDirectory ` + "`Search`" + ` action is supported so TVs and apps can
+search the library for ` + "`dc:title`, `upnp:class`, `dc:date`, `@id`" + ` and
+` + "`@parentID`" + `. Rclone builds an index of the files for searching which
+is refreshed when it is older than ` + "`--dir-cache-time`" + `.
 `
 
 // Options is the type for DLNA serving options.
@@ -31,6 +70,11 @@ type Options struct {
 	LogTrace         bool
 	InterfaceNames   []string
 	AnnounceInterval time.Duration
+	TranscodeCmd     string
+	TranscodeArgs    string
+	TranscodeExts    []string
+	TranscodeMime    string
+	TranscodeMax     int
 }
 
 // DefaultOpt contains the defaults options for DLNA serving.
@@ -40,6 +84,11 @@ var DefaultOpt = Options{
 	LogTrace:         false,
 	InterfaceNames:   []string{},
 	AnnounceInterval: 12 * time.Minute,
+	TranscodeCmd:     "",
+	TranscodeArgs:    "-hide_banner -loglevel error -ss {start} -i {in} -map 0:v:0? -map 0:a:0? -c:v libx264 -preset veryfast -c:a aac -f mpegts pipe:1",
+	TranscodeExts:    []string{".mkv", ".avi", ".webm", ".wmv", ".flv", ".mov"},
+	TranscodeMime:    "video/mpeg",
+	TranscodeMax:     2,
 }
 
 // Opt contains the options for DLNA serving.
@@ -54,6 +103,11 @@ func addFlagsPrefix(flagSet *pflag.FlagSet, prefix string, Opt *Options) {
 	flags.BoolVarP(flagSet, &Opt.LogTrace, prefix+"log-trace", "", Opt.LogTrace, "Enable trace logging of SOAP traffic", prefix)
 	flags.StringArrayVarP(flagSet, &Opt.InterfaceNames, prefix+"interface", "", Opt.InterfaceNames, "The interface to use for SSDP (repeat as necessary)", prefix)
 	flags.DurationVarP(flagSet, &Opt.AnnounceInterval, prefix+"announce-interval", "", Opt.AnnounceInterval, "The interval between SSDP announcements", prefix)
+	flags.StringVarP(flagSet, &Opt.TranscodeCmd, prefix+"transcode-cmd", "", Opt.TranscodeCmd, "Path to a transcoder such as ffmpeg to offer transcoded files", prefix)
+	flags.StringVarP(flagSet, &Opt.TranscodeArgs, prefix+"transcode-args", "", Opt.TranscodeArgs, "Arguments for the transcoder with {in} and {start} placeholders", prefix)
+	flags.StringArrayVarP(flagSet, &Opt.TranscodeExts, prefix+"transcode-ext", "", Opt.TranscodeExts, "File extension to offer transcoded versions of (repeat as necessary)", prefix)
+	flags.StringVarP(flagSet, &Opt.TranscodeMime, prefix+"transcode-mime-type", "", Opt.TranscodeMime, "MIME type of the files the transcoder makes", prefix)
+	flags.IntVarP(flagSet, &Opt.TranscodeMax, prefix+"transcode-max", "", Opt.TranscodeMax, "Maximum number of files to transcode at once", prefix)
 }
 
 // AddFlags add the command line flags for DLNA serving.
@@ -0,0 +1,422 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dms/upnp"
+	"github.com/rclone/rclone/cmd/serve/dlna/upnpav"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+// searchCaps are the properties which can be searched
+const searchCaps = "@id,@parentID,dc:title,dc:date,upnp:class"
+
+// Arguments of the Search action
+type search struct {
+	ContainerID    string
+	SearchCriteria string
+	Filter         string
+	StartingIndex  int
+	RequestedCount int
+	SortCriteria   string
+}
+
+// indexEntry is a media file or a directory in the search index
+type indexEntry struct {
+	obj       object
+	node      vfs.Node
+	subtitles vfs.Nodes
+	class     string // upnp:class
+	title     string // dc:title
+	date      string // dc:date
+}
+
+// property returns the value of the property called name and whether
+// the entry has it
+func (e *indexEntry) property(name string) (string, bool) {
+	switch name {
+	case "@id":
+		return e.obj.ID(), true
+	case "@parentID":
+		return e.obj.ParentID(), true
+	case "dc:title":
+		return e.title, true
+	case "upnp:class":
+		return e.class, true
+	case "dc:date":
+		return e.date, true
+	}
+	return "", false
+}
+
+// searchIndex is an index of the media files and directories of the
+// VFS for searching
+//
+// The index is rebuilt in the background when it is older than the
+// directory cache time and the previous index is used until then, so
+// searches only wait for the first one to be built.
+type searchIndex struct {
+	mu       sync.Mutex
+	built    time.Time
+	entries  []*indexEntry
+	err      error         // error from the last build
+	building chan struct{} // closed when the build in progress finishes, nil if none
+}
+
+// get returns the entries of the index, starting a rebuild if it is
+// older than maxAge
+func (idx *searchIndex) get(VFS *vfs.VFS, maxAge time.Duration) ([]*indexEntry, error) {
+	idx.mu.Lock()
+	if idx.entries != nil && time.Since(idx.built) < maxAge {
+		defer idx.mu.Unlock()
+		return idx.entries, nil
+	}
+	done := idx.building
+	if done == nil {
+		done = make(chan struct{})
+		idx.building = done
+		go idx.build(VFS, done)
+	}
+	if idx.entries != nil {
+		defer idx.mu.Unlock()
+		return idx.entries, nil
+	}
+	idx.mu.Unlock()
+
+	// Wait for the first index to be built
+	<-done
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.entries == nil {
+		return nil, idx.err
+	}
+	return idx.entries, nil
+}
+
+// build walks the VFS to make a new index, closing done when finished
+func (idx *searchIndex) build(VFS *vfs.VFS, done chan struct{}) {
+	defer close(done)
+	start := time.Now()
+	var entries []*indexEntry
+	root, err := VFS.Root()
+	if err == nil {
+		entries, err = idx.walk(nil, "/", root)
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.building = nil
+	idx.err = err
+	if err != nil {
+		// Keep the previous index and try again next time
+		fs.Errorf(nil, "Failed to build DLNA search index: %v", err)
+		return
+	}
+	if entries == nil {
+		entries = []*indexEntry{}
+	}
+	fs.Debugf(nil, "Built DLNA search index of %d entries in %v", len(entries), time.Since(start))
+	idx.entries, idx.built = entries, time.Now()
+}
+
+// walk appends the media files and directories in dir and below to
+// entries
+func (idx *searchIndex) walk(entries []*indexEntry, dirPath string, dir *vfs.Dir) ([]*indexEntry, error) {
+	nodes, err := dir.ReadDirAll()
+	if err != nil {
+		return entries, fmt.Errorf("failed to list %q: %w", dirPath, err)
+	}
+	media, mediaResources := mediaWithResources(nodes)
+	for _, node := range media {
+		entry := &indexEntry{
+			obj:       object{Path: path.Join(dirPath, node.Name())},
+			node:      node,
+			subtitles: mediaResources[node],
+			title:     node.Name(),
+			date:      node.ModTime().Format("2006-01-02"),
+		}
+		if subDir, ok := node.(*vfs.Dir); ok {
+			entry.class = "object.container.storageFolder"
+			entries = append(entries, entry)
+			entries, err = idx.walk(entries, entry.obj.Path, subDir)
+			if err != nil {
+				// Carry on with the rest of the files
+				fs.Errorf(nil, "DLNA search index: %v", err)
+			}
+			continue
+		}
+		_, entry.class = mediaClass(node)
+		if entry.class != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// search runs the Search action
+func (cds *contentDirectoryService) search(search *search, host string) (map[string]string, error) {
+	container, err := cds.objectFromID(search.ContainerID)
+	if err != nil {
+		return nil, upnp.Errorf(upnpav.NoSuchContainerErrorCode, err.Error())
+	}
+	node, err := cds.vfs.Stat(container.Path)
+	if err != nil || !node.IsDir() {
+		return nil, upnp.Errorf(upnpav.NoSuchContainerErrorCode, "no such container %q", search.ContainerID)
+	}
+	match, err := parseSearchCriteria(search.SearchCriteria)
+	if err != nil {
+		return nil, upnp.Errorf(upnpav.InvalidSearchCriteriaErrorCode, err.Error())
+	}
+	entries, err := cds.index.get(cds.vfs, cds.vfs.Opt.DirCacheTime)
+	if err != nil {
+		return nil, err
+	}
+	prefix := container.Path
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	var objs []interface{}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.obj.Path, prefix) || !match(entry) {
+			continue
+		}
+		obj, err := cds.cdsObjectToUpnpavObject(entry.obj, entry.node, entry.subtitles, host)
+		if err != nil {
+			fs.Errorf(cds, "error with %s: %s", entry.obj.FilePath(), err)
+			continue
+		}
+		if obj != nil {
+			objs = append(objs, obj)
+		}
+	}
+	totalMatches := len(objs)
+	objs = page(objs, search.StartingIndex, search.RequestedCount)
+	result, err := xml.Marshal(objs)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"TotalMatches":   fmt.Sprint(totalMatches),
+		"NumberReturned": fmt.Sprint(len(objs)),
+		"Result":         didlLite(string(result)),
+		"UpdateID":       cds.updateIDString(),
+	}, nil
+}
+
+// matcher returns true if an entry matches the search criteria
+type matcher func(e *indexEntry) bool
+
+// searchToken is a token of the search criteria
+type searchToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeSearch splits the search criteria into tokens
+func tokenizeSearch(criteria string) (tokens []searchToken, err error) {
+	const opChars = "=!<>"
+	for i := 0; i < len(criteria); {
+		c := criteria[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, searchToken{text: string(c)})
+			i++
+		case c == '"':
+			var value strings.Builder
+			i++
+			for ; i < len(criteria) && criteria[i] != '"'; i++ {
+				if criteria[i] == '\\' && i+1 < len(criteria) {
+					i++
+				}
+				value.WriteByte(criteria[i])
+			}
+			if i >= len(criteria) {
+				return nil, errors.New("unterminated quoted value")
+			}
+			i++
+			tokens = append(tokens, searchToken{text: value.String(), quoted: true})
+		case strings.IndexByte(opChars, c) >= 0:
+			start := i
+			for i < len(criteria) && strings.IndexByte(opChars, criteria[i]) >= 0 {
+				i++
+			}
+			tokens = append(tokens, searchToken{text: criteria[start:i]})
+		default:
+			start := i
+			for i < len(criteria) && strings.IndexByte(" \t\r\n()\""+opChars, criteria[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, searchToken{text: criteria[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+// searchParser parses search criteria into a matcher
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+}
+
+// parseSearchCriteria parses UPnP ContentDirectory search criteria
+// such as `upnp:class derivedfrom "object.item.videoItem" and dc:title
+// contains "holiday"` into a matcher
+func parseSearchCriteria(criteria string) (matcher, error) {
+	criteria = strings.TrimSpace(criteria)
+	if criteria == "" || criteria == "*" {
+		return func(*indexEntry) bool { return true }, nil
+	}
+	tokens, err := tokenizeSearch(criteria)
+	if err != nil {
+		return nil, err
+	}
+	p := &searchParser{tokens: tokens}
+	m, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in search criteria", p.tokens[p.pos].text)
+	}
+	return m, nil
+}
+
+// next returns the next token or an error if there isn't one
+func (p *searchParser) next() (searchToken, error) {
+	if p.pos >= len(p.tokens) {
+		return searchToken{}, errors.New("unexpected end of search criteria")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+// peekWord returns true and skips the next token if it is the unquoted word
+func (p *searchParser) peekWord(word string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// parseOr parses expressions joined by "or"
+func (p *searchParser) parseOr() (matcher, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *indexEntry) bool { return l(e) || right(e) }
+	}
+	return left, nil
+}
+
+// parseAnd parses expressions joined by "and" which binds tighter
+// than "or"
+func (p *searchParser) parseAnd() (matcher, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *indexEntry) bool { return l(e) && right(e) }
+	}
+	return left, nil
+}
+
+// parsePrimary parses a bracketed expression or a property test
+func (p *searchParser) parsePrimary() (matcher, error) {
+	if p.peekWord("(") {
+		m, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekWord(")") {
+			return nil, errors.New("missing ) in search criteria")
+		}
+		return m, nil
+	}
+	prop, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if prop.quoted || op.quoted {
+		return nil, fmt.Errorf("expecting property and operator but got %q %q", prop.text, op.text)
+	}
+	name := prop.text
+	if strings.EqualFold(op.text, "exists") {
+		want := strings.EqualFold(value.text, "true")
+		if value.quoted || (!want && !strings.EqualFold(value.text, "false")) {
+			return nil, fmt.Errorf("exists needs true or false not %q", value.text)
+		}
+		return func(e *indexEntry) bool {
+			_, ok := e.property(name)
+			return ok == want
+		}, nil
+	}
+	if !value.quoted {
+		return nil, fmt.Errorf("expecting quoted value but got %q", value.text)
+	}
+	test, err := stringOp(op.text, strings.ToLower(value.text))
+	if err != nil {
+		return nil, err
+	}
+	return func(e *indexEntry) bool {
+		v, ok := e.property(name)
+		return ok && test(strings.ToLower(v))
+	}, nil
+}
+
+// stringOp returns a test for the operator op against the lower case
+// value. String comparisons are case insensitive.
+func stringOp(op, value string) (func(v string) bool, error) {
+	switch strings.ToLower(op) {
+	case "=":
+		return func(v string) bool { return v == value }, nil
+	case "!=":
+		return func(v string) bool { return v != value }, nil
+	case "<":
+		return func(v string) bool { return v < value }, nil
+	case "<=":
+		return func(v string) bool { return v <= value }, nil
+	case ">":
+		return func(v string) bool { return v > value }, nil
+	case ">=":
+		return func(v string) bool { return v >= value }, nil
+	case "contains":
+		return func(v string) bool { return strings.Contains(v, value) }, nil
+	case "doesnotcontain":
+		return func(v string) bool { return !strings.Contains(v, value) }, nil
+	case "startswith":
+		return func(v string) bool { return strings.HasPrefix(v, value) }, nil
+	case "derivedfrom":
+		return func(v string) bool { return v == value || strings.HasPrefix(v, value+".") }, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q in search criteria", op)
+}
@@ -0,0 +1,115 @@
+package dlna
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearchCriteria(t *testing.T) {
+	e := &indexEntry{
+		obj:   object{Path: "/films/Holiday \"Special\".mkv"},
+		class: "object.item.videoItem",
+		title: "Holiday \"Special\".mkv",
+		date:  "2023-06-01",
+	}
+	match := func(criteria string) (bool, error) {
+		m, err := parseSearchCriteria(criteria)
+		if err != nil {
+			return false, err
+		}
+		return m(e), nil
+	}
+	for _, test := range []struct {
+		criteria string
+		want     bool
+	}{
+		{`*`, true},
+		{``, true},
+		{`upnp:class derivedfrom "object.item"`, true},
+		{`upnp:class derivedfrom "object.item.video"`, false},
+		{`upnp:class DERIVEDFROM "object.item.videoItem"`, true},
+		{`upnp:class = "object.item.audioItem"`, false},
+		{`upnp:class="object.item.videoitem"`, true},
+		{`upnp:class != "object.item.audioItem"`, true},
+		{`dc:title contains "holiday"`, true},
+		{`dc:title doesNotContain "holiday"`, false},
+		{`dc:title startsWith "HOL"`, true},
+		{`dc:title contains "\"special\""`, true},
+		{`dc:date >= "2023-01-01" and dc:date < "2024-01-01"`, true},
+		{`dc:date > "2023-06-01"`, false},
+		{`dc:date <= "2023-06-01"`, true},
+		{`upnp:artist exists true`, false},
+		{`upnp:artist exists false`, true},
+		{`upnp:artist = "x"`, false},
+		{`@id exists true and @parentID = "%2Ffilms"`, true},
+		{`dc:title contains "x" or dc:title contains "holiday"`, true},
+		{`dc:title contains "x" and dc:title contains "holiday" or upnp:class derivedfrom "object.item"`, true},
+		{`dc:title contains "x" and (dc:title contains "holiday" or upnp:class derivedfrom "object.item")`, false},
+	} {
+		got, err := match(test.criteria)
+		require.NoError(t, err, test.criteria)
+		assert.Equal(t, test.want, got, test.criteria)
+	}
+
+	for _, criteria := range []string{
+		`dc:title contains`,
+		`dc:title contains holiday`,
+		`dc:title like "holiday"`,
+		`dc:title contains "holiday`,
+		`(dc:title contains "holiday"`,
+		`dc:title contains "holiday")`,
+		`dc:title contains "holiday" and`,
+		`upnp:artist exists "true"`,
+		`upnp:artist exists maybe`,
+	} {
+		_, err := match(criteria)
+		assert.Error(t, err, criteria)
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "one.mp4"), []byte("one"), 0666))
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	opt := vfscommon.DefaultOpt
+	opt.DirCacheTime = 0
+	VFS := vfs.New(f, &opt)
+	defer VFS.Shutdown()
+	var idx searchIndex
+	titles := func(entries []*indexEntry) (titles []string) {
+		for _, entry := range entries {
+			titles = append(titles, entry.title)
+		}
+		return titles
+	}
+
+	// The first search waits for the index
+	entries, err := idx.get(VFS, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one.mp4"}, titles(entries))
+
+	// Later ones get the previous index while it is rebuilt
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "two.mp4"), []byte("two"), 0666))
+	entries, err = idx.get(VFS, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one.mp4"}, titles(entries))
+	idx.mu.Lock()
+	done := idx.building
+	idx.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	entries, err = idx.get(VFS, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one.mp4", "two.mp4"}, titles(entries))
+}
@@ -0,0 +1,105 @@
+package dlna
+
+import (
+	"encoding/xml"
+	"path"
+	"strings"
+
+	"github.com/rclone/rclone/cmd/serve/dlna/upnpav"
+	"github.com/rclone/rclone/vfs"
+)
+
+// subtitleMimeTypes maps the extensions of subtitle files to the MIME
+// types TVs expect. Others are sent as text/srt.
+var subtitleMimeTypes = map[string]string{
+	".srt": "text/srt",
+	".ass": "text/x-ass",
+	".ssa": "text/x-ssa",
+	".vtt": "text/vtt",
+	".smi": "smi/caption",
+	".sub": "text/x-microdvd",
+}
+
+// subtitleExt returns the lower case extension of a subtitle file
+// without the leading "."
+func subtitleExt(name string) string {
+	_, ext := splitExt(strings.ToLower(name))
+	return strings.TrimPrefix(ext, ".")
+}
+
+// subtitleMimeType returns the MIME type of a subtitle file
+func subtitleMimeType(name string) string {
+	if mimeType, ok := subtitleMimeTypes["."+subtitleExt(name)]; ok {
+		return mimeType
+	}
+	return "text/srt"
+}
+
+// preferredSubtitle returns the subtitle to offer to TVs which only
+// take one. SRT is preferred as nearly all of them can show it.
+func preferredSubtitle(subtitles vfs.Nodes) vfs.Node {
+	for _, subtitle := range subtitles {
+		if subtitleExt(subtitle.Name()) == "srt" {
+			return subtitle
+		}
+	}
+	if len(subtitles) > 0 {
+		return subtitles[0]
+	}
+	return nil
+}
+
+// addSubtitles adds the subtitles to the item in the ways the
+// common TV vendors look for them. It must be called after the media
+// resources have been added.
+func addSubtitles(item *upnpav.Item, subtitles vfs.Nodes, host string) {
+	subtitle := preferredSubtitle(subtitles)
+	if subtitle == nil {
+		return
+	}
+	subtitleURL := resourceURL(host, subtitle.Path(), "")
+	ext := subtitleExt(subtitle.Name())
+	// Sony and Panasonic look for attributes on the media resources
+	for i := range item.Res {
+		item.Res[i].SubtitleFileType = strings.ToUpper(ext)
+		item.Res[i].SubtitleFileURI = subtitleURL
+	}
+	// Samsung looks for CaptionInfo elements
+	for _, name := range []string{"sec:CaptionInfoEx", "sec:CaptionInfo"} {
+		item.Captions = append(item.Captions, upnpav.CaptionInfo{
+			XMLName: xml.Name{Local: name},
+			Type:    ext,
+			URL:     subtitleURL,
+		})
+	}
+	// Most others look for extra resources
+	for _, subtitle := range subtitles {
+		item.Res = append(item.Res, upnpav.Resource{
+			URL:          resourceURL(host, subtitle.Path(), ""),
+			ProtocolInfo: "http-get:*:" + subtitleMimeType(subtitle.Name()) + ":*",
+		})
+	}
+}
+
+// subtitlesFor returns the subtitle files for the media file node
+func (s *server) subtitlesFor(node vfs.Node) vfs.Nodes {
+	dirNode, err := s.vfs.Stat(path.Dir("/" + node.Path()))
+	if err != nil {
+		return nil
+	}
+	dir, ok := dirNode.(*vfs.Dir)
+	if !ok {
+		return nil
+	}
+	entries, err := dir.ReadDirAll()
+	if err != nil {
+		return nil
+	}
+	media, mediaResources := mediaWithResources(entries)
+	for _, m := range media {
+		if m.Name() == node.Name() {
+			return mediaResources[m]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package dlna
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	dms_dlna "github.com/anacrolix/dms/dlna"
+	"github.com/rclone/rclone/cmd/serve/dlna/dlnaflags"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+// transcodeParam is the query parameter asking for a transcoded file
+const transcodeParam = "transcode"
+
+// maxTranscoderErrors is how much of the transcoder's error output is
+// kept for the log
+const maxTranscoderErrors = 4096
+
+// transcoder runs an external command to convert files TVs can't play
+type transcoder struct {
+	cmd      string              // path of the command
+	args     []string            // arguments with placeholders
+	exts     map[string]struct{} // lower case extensions to transcode
+	mimeType string              // type of file the command makes
+	slots    chan struct{}       // limits the number of transcodes at once
+}
+
+// newTranscoder makes a transcoder from the options, returning nil if
+// transcoding isn't configured
+func newTranscoder(opt *dlnaflags.Options) (*transcoder, error) {
+	if opt.TranscodeCmd == "" {
+		return nil, nil
+	}
+	cmd, err := exec.LookPath(opt.TranscodeCmd)
+	if err != nil {
+		return nil, fmt.Errorf("transcoder not found: %w", err)
+	}
+	args := strings.Fields(opt.TranscodeArgs)
+	if !strings.Contains(opt.TranscodeArgs, "{in}") {
+		return nil, fmt.Errorf("--transcode-args must contain {in}: %q", opt.TranscodeArgs)
+	}
+	if opt.TranscodeMax < 1 {
+		return nil, fmt.Errorf("--transcode-max must be at least 1: %d", opt.TranscodeMax)
+	}
+	t := &transcoder{
+		cmd:      cmd,
+		args:     args,
+		exts:     make(map[string]struct{}, len(opt.TranscodeExts)),
+		mimeType: opt.TranscodeMime,
+		slots:    make(chan struct{}, opt.TranscodeMax),
+	}
+	for _, ext := range opt.TranscodeExts {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		t.exts[ext] = struct{}{}
+	}
+	return t, nil
+}
+
+// wants returns true if the file called name should be offered transcoded
+func (t *transcoder) wants(name string) bool {
+	if t == nil {
+		return false
+	}
+	_, ext := splitExt(strings.ToLower(name))
+	_, ok := t.exts[ext]
+	return ok
+}
+
+// contentFeatures returns the DLNA features of the transcoded files
+func (t *transcoder) contentFeatures() string {
+	return dms_dlna.ContentFeatures{
+		SupportTimeSeek: true,
+		Transcoded:      true,
+	}.String()
+}
+
+// protocolInfo returns the protocol info of the transcoded files
+func (t *transcoder) protocolInfo() string {
+	return "http-get:*:" + t.mimeType + ":" + t.contentFeatures()
+}
+
+// command makes the command to transcode the file at in starting at start
+func (t *transcoder) command(in string, start time.Duration) []string {
+	replacer := strings.NewReplacer(
+		"{in}", in,
+		"{start}", strconv.FormatFloat(start.Seconds(), 'f', 3, 64),
+	)
+	args := make([]string, len(t.args))
+	for i, arg := range t.args {
+		args[i] = replacer.Replace(arg)
+	}
+	return args
+}
+
+// parseNPT parses the start of a TimeSeekRange.dlna.org header like
+// "npt=10.5-" or "npt=0:01:02.500-"
+func parseNPT(header string) (time.Duration, error) {
+	npt := strings.TrimSpace(header)
+	if !strings.HasPrefix(npt, "npt=") {
+		return 0, fmt.Errorf("invalid time seek range %q", header)
+	}
+	start, _, _ := strings.Cut(npt[len("npt="):], "-")
+	if strings.Contains(start, ":") {
+		return dms_dlna.ParseNPTTime(start)
+	}
+	seconds, err := strconv.ParseFloat(start, 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid time seek range %q", header)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// localURL returns the URL the transcoder can read remote from
+func (s *server) localURL(remote string) string {
+	addr := s.HTTPConn.Addr().(*net.TCPAddr)
+	ip := addr.IP
+	if ip.IsUnspecified() {
+		if ip.To4() != nil {
+			ip = net.IPv4(127, 0, 0, 1)
+		} else {
+			ip = net.IPv6loopback
+		}
+	}
+	host := net.JoinHostPort(ip.String(), strconv.Itoa(addr.Port))
+	return resourceURL(host, remote, "")
+}
+
+// limitedBuffer keeps the start of what is written to it
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+// Write appends p to the buffer if there is space
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if space := maxTranscoderErrors - b.Len(); space > 0 {
+		if len(p) > space {
+			_, _ = b.Buffer.Write(p[:space])
+		} else {
+			_, _ = b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// transcodeHandler streams the transcoded file node to the client
+func (s *server) transcodeHandler(w http.ResponseWriter, r *http.Request, node vfs.Node) {
+	t := s.transcoder
+	if !node.IsFile() || !t.wants(node.Name()) {
+		http.NotFound(w, r)
+		return
+	}
+	var start time.Duration
+	if seek := r.Header.Get("TimeSeekRange.dlna.org"); seek != "" {
+		var err error
+		start, err = parseNPT(seek)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("TimeSeekRange.dlna.org", "npt="+dms_dlna.FormatNPTTime(start)+"-")
+	}
+	w.Header().Set("Content-Type", t.mimeType)
+	w.Header().Set("contentFeatures.dlna.org", t.contentFeatures())
+	w.Header().Set("transferMode.dlna.org", "Streaming")
+	if r.Method == http.MethodHead {
+		return
+	}
+	select {
+	case t.slots <- struct{}{}:
+		defer func() { <-t.slots }()
+	default:
+		fs.Logf(node, "Not transcoding as %d transcodes are running already", cap(t.slots))
+		http.Error(w, "too many files being transcoded", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The command is killed when the client goes away
+	args := t.command(s.localURL(node.Path()), start)
+	cmd := exec.CommandContext(r.Context(), t.cmd, args...)
+	cmd.Stdout = w
+	var stderr limitedBuffer
+	cmd.Stderr = &stderr
+	fs.Infof(node, "Transcoding from %v with %s %s", start, t.cmd, strings.Join(args, " "))
+	err := cmd.Run()
+	if r.Context().Err() != nil {
+		fs.Debugf(node, "Transcoding stopped by client: %v", err)
+		return
+	}
+	if err != nil {
+		fs.Errorf(node, "Transcoding failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		return
+	}
+	fs.Debugf(node, "Transcoding finished")
+}
+
+// transcodedResourceURL returns the URL of the transcoded version of remote
+func transcodedResourceURL(host, remote string) string {
+	return resourceURL(host, remote, url.Values{transcodeParam: {"1"}}.Encode())
+}
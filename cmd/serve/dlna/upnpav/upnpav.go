@@ -9,6 +9,10 @@ import (
 const (
 	// NoSuchObjectErrorCode : The specified ObjectID is invalid.
 	NoSuchObjectErrorCode = 701
+	// InvalidSearchCriteriaErrorCode : The search criteria is invalid or unsupported.
+	InvalidSearchCriteriaErrorCode = 708
+	// NoSuchContainerErrorCode : The specified ContainerID is invalid.
+	NoSuchContainerErrorCode = 710
 )
 
 // Resource description
@@ -20,6 +24,16 @@ type Resource struct {
 	Bitrate      uint     `xml:"bitrate,attr,omitempty"`
 	Duration     string   `xml:"duration,attr,omitempty"`
 	Resolution   string   `xml:"resolution,attr,omitempty"`
+	// Subtitles for Sony and Panasonic TVs
+	SubtitleFileType string `xml:"pv:subtitleFileType,attr,omitempty"`
+	SubtitleFileURI  string `xml:"pv:subtitleFileUri,attr,omitempty"`
+}
+
+// CaptionInfo describes subtitles for Samsung TVs
+type CaptionInfo struct {
+	XMLName xml.Name
+	Type    string `xml:"sec:type,attr"`
+	URL     string `xml:",chardata"`
 }
 
 // Container description
@@ -34,6 +48,7 @@ type Item struct {
 	Object
 	XMLName  xml.Name `xml:"item"`
 	Res      []Resource
+	Captions []CaptionInfo
 	InnerXML string `xml:",innerxml"`
 }
 
@@ -0,0 +1,178 @@
+//go:build !plan9
+// +build !plan9
+
+package ftp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"unsafe"
+
+	"github.com/rclone/rclone/fs"
+	ftp "goftp.io/server/v2"
+)
+
+// With --client-ca the clients log in with a certificate signed by
+// one of the CAs as one of the users it names.
+//
+// goftp only makes its TLS config from the certificate and key files
+// in ListenAndServe, which doesn't ask for client certificates, so
+// the server listens here and its TLS config is set to one which
+// does. That config is used for the control connections, AUTH TLS and
+// the passive data connections.
+//
+// The users named in the certificate are recorded against the control
+// connection when the certificate is verified, and looked up by the
+// remote address of the session when the user logs in.
+
+// controlListener tracks the control connections it accepts
+type controlListener struct {
+	net.Listener
+	d *driver
+}
+
+// Accept a control connection
+func (l *controlListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	c := &controlConn{Conn: conn, d: l.d}
+	l.d.connsMu.Lock()
+	l.d.conns[conn.RemoteAddr().String()] = c
+	l.d.connsMu.Unlock()
+	return c, nil
+}
+
+// controlConn is a control connection which records the users named
+// in its client certificate
+type controlConn struct {
+	net.Conn
+	d     *driver
+	mu    sync.Mutex // protects users
+	users []string   // users named in the verified client certificate
+}
+
+// Close the connection
+func (c *controlConn) Close() error {
+	c.d.connsMu.Lock()
+	delete(c.d.conns, c.RemoteAddr().String())
+	c.d.connsMu.Unlock()
+	return c.Conn.Close()
+}
+
+// setUsers records the users named in the client certificate
+func (c *controlConn) setUsers(users []string) {
+	c.mu.Lock()
+	c.users = users
+	c.mu.Unlock()
+}
+
+// hasUser returns true if user is named in the client certificate
+func (c *controlConn) hasUser(user string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range c.users {
+		if name == user {
+			return true
+		}
+	}
+	return false
+}
+
+// certUsers returns the users named in cert - its common name and its
+// DNS and email subject alternative names
+func certUsers(cert *x509.Certificate) (users []string) {
+	if cert.Subject.CommonName != "" {
+		users = append(users, cert.Subject.CommonName)
+	}
+	users = append(users, cert.DNSNames...)
+	return append(users, cert.EmailAddresses...)
+}
+
+// newClientCertTLSConfig makes the TLS config for the server which
+// asks for client certificates signed by the CAs in d.opt.ClientCA
+func (d *driver) newClientCertTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(d.opt.TLSCert, d.opt.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load --cert and --key: %w", err)
+	}
+	caPEM, err := os.ReadFile(d.opt.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read --client-ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in --client-ca %q", d.opt.ClientCA)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"ftp"},
+		ClientCAs:    pool,
+		// The login checks the control connection has a
+		// certificate. Clients needn't send one for the data
+		// connections.
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		c, ok := hello.Conn.(*controlConn)
+		if !ok {
+			// a data connection
+			return nil, nil
+		}
+		connConfig := config.Clone()
+		connConfig.GetConfigForClient = nil
+		connConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.VerifiedChains) > 0 {
+				c.setUsers(certUsers(cs.VerifiedChains[0][0]))
+			}
+			return nil
+		}
+		return connConfig, nil
+	}
+	return config, nil
+}
+
+// setTLSConfig sets the private TLS config of srv
+func setTLSConfig(srv *ftp.Server, config *tls.Config) error {
+	field := reflect.ValueOf(srv).Elem().FieldByName("tlsConfig")
+	if !field.IsValid() || field.Type() != reflect.TypeOf(config) {
+		return errors.New("can't set the TLS config of the FTP server")
+	}
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(config))
+	return nil
+}
+
+// listen makes the listener for the control connections
+func (d *driver) listen() (net.Listener, error) {
+	addr := net.JoinHostPort(d.srv.Hostname, strconv.Itoa(d.srv.Port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	listener = &controlListener{Listener: listener, d: d}
+	if !d.opt.ExplicitTLS {
+		listener = tls.NewListener(listener, d.tlsConfig)
+	}
+	return listener, nil
+}
+
+// checkClientCert returns true if the control connection of sctx has
+// a verified client certificate naming user
+func (d *driver) checkClientCert(sctx *ftp.Context, user string) bool {
+	d.connsMu.Lock()
+	c := d.conns[sctx.Sess.RemoteAddr().String()]
+	d.connsMu.Unlock()
+	if c == nil || !c.hasUser(user) {
+		fs.Infof(nil, "login failed: no client certificate for user %q", user)
+		return false
+	}
+	return true
+}
@@ -6,6 +6,7 @@ package ftp
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -15,6 +16,7 @@ import (
 	"os/user"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -37,13 +39,17 @@ import (
 // Options contains options for the http Server
 type Options struct {
 	//TODO add more options
-	ListenAddr   string // Port to listen on
-	PublicIP     string // Passive ports range
-	PassivePorts string // Passive ports range
-	BasicUser    string // single username for basic auth if not using Htpasswd
-	BasicPass    string // password for BasicUser
-	TLSCert      string // TLS PEM key (concatenation of certificate and CA certificate)
-	TLSKey       string // TLS PEM Private key
+	ListenAddr   string    // Port to listen on
+	PublicIP     string    // Passive ports range
+	PassivePorts string    // Passive ports range
+	BasicUser    string    // single username for basic auth if not using Htpasswd
+	BasicPass    string    // password for BasicUser
+	TLSCert      string    // TLS PEM key (concatenation of certificate and CA certificate)
+	TLSKey       string    // TLS PEM Private key
+	ClientCA     string    // client certificate authority to verify clients with
+	ExplicitTLS  bool      // wait for AUTH TLS rather than starting connections with TLS
+	RequireTLS   bool      // refuse logins and data connections without TLS
+	UserBwLimit  fs.BwPair // bandwidth limit for each user - Tx is uploads by the user
 }
 
 // DefaultOpt is the default values used for Options
@@ -68,6 +74,10 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.StringVarP(flagSet, &Opt.BasicPass, "pass", "", Opt.BasicPass, "Password for authentication (empty value allow every password)", "")
 	flags.StringVarP(flagSet, &Opt.TLSCert, "cert", "", Opt.TLSCert, "TLS PEM key (concatenation of certificate and CA certificate)", "")
 	flags.StringVarP(flagSet, &Opt.TLSKey, "key", "", Opt.TLSKey, "TLS PEM Private key", "")
+	flags.StringVarP(flagSet, &Opt.ClientCA, "client-ca", "", Opt.ClientCA, "Client certificate authority to log clients in with their certificates", "")
+	flags.BoolVarP(flagSet, &Opt.ExplicitTLS, "explicit-tls", "", Opt.ExplicitTLS, "Use explicit FTPS where clients switch to TLS with AUTH TLS", "")
+	flags.BoolVarP(flagSet, &Opt.RequireTLS, "require-tls", "", Opt.RequireTLS, "Refuse logins and data connections which don't use TLS", "")
+	flags.FVarP(flagSet, &Opt.UserBwLimit, "user-bwlimit", "", "Bandwidth limit for each user in KiB/s, or use suffix B|K|M|G|T|P or a pair UPLOAD:DOWNLOAD", "")
 }
 
 func init() {
@@ -100,6 +110,35 @@ then using Authentication is advised - see the next section for info.
 By default this will serve files without needing a login.
 
 You can set a single username and password with the --user and --pass flags.
+
+#### TLS
+
+Use --cert and --key to serve FTPS. By default every connection
+starts with TLS (implicit FTPS), which is conventionally served on
+port 990, e.g. --addr :990. Use --explicit-tls to have clients start
+with a plain connection and switch to TLS with the AUTH TLS command
+(explicit FTPS) instead.
+
+Passive data connections always use TLS when serving FTPS, but
+active ones (made with PORT or EPRT) don't. Use --require-tls to
+refuse active data connections and, with --explicit-tls, logins
+before AUTH TLS.
+
+Use --client-ca to log clients in with TLS client certificates. It
+should be a PEM file of the certificate authorities which sign them.
+Clients must then present a certificate signed by one of them, and
+can only log in as a user named in it - by its common name or one of
+its DNS or email subject alternative names. The certificate replaces
+the password so --user and --pass aren't used, except with
+--auth-proxy which is still passed the user's password.
+
+#### Bandwidth
+
+Use --user-bwlimit to limit the bandwidth of each user, shared
+between all their connections. This takes a single limit, e.g. 1M,
+or a pair like --bwlimit, e.g. 10M:1M, where the first limit is for
+files the user uploads and the second for files they download. This
+is applied as well as the global --bwlimit.
 ` + vfs.Help + proxy.Help,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.44",
@@ -132,8 +171,13 @@ type driver struct {
 	globalVFS  *vfs.VFS     // the VFS if not using auth proxy
 	proxy      *proxy.Proxy // may be nil if not in use
 	useTLS     bool
-	userPassMu sync.Mutex        // to protect userPass
-	userPass   map[string]string // cache of username => password when using vfs proxy
+	userPassMu sync.Mutex                       // to protect userPass
+	userPass   map[string]string                // cache of username => password when using vfs proxy
+	limitersMu sync.Mutex                       // to protect limiters
+	limiters   map[string]*accounting.BwLimiter // bandwidth limiters by user
+	tlsConfig  *tls.Config                      // TLS config if using --client-ca
+	connsMu    sync.Mutex                       // to protect conns
+	conns      map[string]*controlConn          // control connections by remote address if using --client-ca
 }
 
 var passivePortsRe = regexp.MustCompile(`^\s*\d+\s*-\s*\d+\s*$`)
@@ -150,9 +194,10 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) (*driver, error) {
 	}
 
 	d := &driver{
-		f:   f,
-		ctx: ctx,
-		opt: *opt,
+		f:        f,
+		ctx:      ctx,
+		opt:      *opt,
+		limiters: make(map[string]*accounting.BwLimiter),
 	}
 	if proxyflags.Opt.AuthProxy != "" {
 		d.proxy = proxy.New(ctx, &proxyflags.Opt)
@@ -161,6 +206,18 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) (*driver, error) {
 		d.globalVFS = vfs.New(f, &vfsflags.Opt)
 	}
 	d.useTLS = d.opt.TLSKey != ""
+	if d.opt.TLSCert == "" && d.opt.TLSKey == "" {
+		switch {
+		case d.opt.ExplicitTLS:
+			return nil, errors.New("--explicit-tls needs --cert and --key")
+		case d.opt.RequireTLS:
+			return nil, errors.New("--require-tls needs --cert and --key")
+		case d.opt.ClientCA != "":
+			return nil, errors.New("--client-ca needs --cert and --key")
+		}
+	} else if d.opt.TLSCert == "" || d.opt.TLSKey == "" {
+		return nil, errors.New("--cert and --key must be used together")
+	}
 
 	// Check PassivePorts format since the server library doesn't!
 	if !passivePortsRe.MatchString(opt.PassivePorts) {
@@ -179,6 +236,7 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) (*driver, error) {
 		Perm:           ftp.NewSimplePerm("ftp", "ftp"), // fake user and group
 		Logger:         &Logger{},
 		TLS:            d.useTLS,
+		ExplicitFTPS:   d.opt.ExplicitTLS,
 		CertFile:       d.opt.TLSCert,
 		KeyFile:        d.opt.TLSKey,
 		//TODO implement a maximum of https://godoc.org/goftp.io/server#ServerOpts
@@ -187,13 +245,85 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) (*driver, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new FTP server: %w", err)
 	}
+	d.srv.Commands = d.commands(d.srv.Commands)
+	// NewServer doesn't copy ForceTLS from the options. Connections
+	// with implicit TLS don't count as TLS for it so it is only
+	// needed with explicit TLS.
+	d.srv.ForceTLS = d.opt.RequireTLS && d.opt.ExplicitTLS
+	if d.opt.ClientCA != "" {
+		d.tlsConfig, err = d.newClientCertTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		err = setTLSConfig(d.srv, d.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		d.conns = make(map[string]*controlConn)
+	}
 	return d, nil
 }
 
+// commands returns a copy of the server commands changed for the
+// TLS options
+func (d *driver) commands(defaults map[string]ftp.Command) map[string]ftp.Command {
+	commands := make(map[string]ftp.Command, len(defaults))
+	for name, command := range defaults {
+		commands[name] = command
+	}
+	if d.useTLS && !d.opt.ExplicitTLS {
+		// The server only accepts these after AUTH TLS, but
+		// clients send them to protect the data connections
+		// with implicit TLS too.
+		commands["PBSZ"] = implicitTLSCommand{Command: commands["PBSZ"], ok: "0"}
+		commands["PROT"] = implicitTLSCommand{Command: commands["PROT"], ok: "P"}
+	}
+	if d.opt.RequireTLS {
+		// Active data connections don't use TLS
+		for _, name := range []string{"PORT", "EPRT", "LPRT"} {
+			commands[name] = refuseCommand{Command: commands[name], message: "Active mode is disabled as it doesn't use TLS - use passive mode"}
+		}
+	}
+	return commands
+}
+
+// implicitTLSCommand replaces PBSZ and PROT with implicit TLS
+type implicitTLSCommand struct {
+	ftp.Command
+	ok string // the parameter which is accepted
+}
+
+// Execute the command
+func (c implicitTLSCommand) Execute(sess *ftp.Session, param string) {
+	if strings.EqualFold(param, c.ok) {
+		sess.WriteMessage(200, "OK")
+	} else {
+		sess.WriteMessage(536, "Only "+c.ok+" is supported")
+	}
+}
+
+// refuseCommand replaces a command which isn't allowed
+type refuseCommand struct {
+	ftp.Command
+	message string
+}
+
+// Execute the command
+func (c refuseCommand) Execute(sess *ftp.Session, param string) {
+	sess.WriteMessage(534, c.message)
+}
+
 // serve runs the ftp server
 func (d *driver) serve() error {
 	fs.Logf(d.f, "Serving FTP on %s", d.srv.Hostname+":"+strconv.Itoa(d.srv.Port))
-	return d.srv.ListenAndServe()
+	if d.tlsConfig == nil {
+		return d.srv.ListenAndServe()
+	}
+	listener, err := d.listen()
+	if err != nil {
+		return err
+	}
+	return d.srv.Serve(listener)
 }
 
 // close stops the ftp server
@@ -233,6 +363,12 @@ func (l *Logger) PrintResponse(sessionID string, code int, message string) {
 
 // CheckPasswd handle auth based on configuration
 func (d *driver) CheckPasswd(sctx *ftp.Context, user, pass string) (ok bool, err error) {
+	// With --client-ca the user must be named in the client
+	// certificate, which replaces the password unless using the
+	// auth proxy
+	if d.tlsConfig != nil && !d.checkClientCert(sctx, user) {
+		return false, nil
+	}
 	if d.proxy != nil {
 		_, _, err = d.proxy.Call(user, pass, false)
 		if err != nil {
@@ -250,7 +386,7 @@ func (d *driver) CheckPasswd(sctx *ftp.Context, user, pass string) (ok bool, err
 		d.userPassMu.Lock()
 		d.userPass[user] = oPass
 		d.userPassMu.Unlock()
-	} else {
+	} else if d.tlsConfig == nil {
 		ok = d.opt.BasicUser == user && (d.opt.BasicPass == "" || d.opt.BasicPass == pass)
 		if !ok {
 			fs.Infof(nil, "login failed: bad credentials")
@@ -284,6 +420,53 @@ func (d *driver) getVFS(sctx *ftp.Context) (VFS *vfs.VFS, err error) {
 	return VFS, nil
 }
 
+// limiter returns the bandwidth limiter for the user of the session
+// or nil if there isn't one
+func (d *driver) limiter(sctx *ftp.Context) *accounting.BwLimiter {
+	if !d.opt.UserBwLimit.IsSet() {
+		return nil
+	}
+	user := sctx.Sess.LoginUser()
+	d.limitersMu.Lock()
+	defer d.limitersMu.Unlock()
+	l := d.limiters[user]
+	if l == nil {
+		l = accounting.NewBwLimiter(d.opt.UserBwLimit)
+		d.limiters[user] = l
+	}
+	return l
+}
+
+// limitReader limits the bandwidth of the reads from an io.Reader
+type limitReader struct {
+	in      io.Reader
+	ctx     context.Context
+	limiter *accounting.BwLimiter
+	slot    accounting.TokenBucketSlot
+}
+
+// Read bytes from the reader, waiting for the bandwidth limit
+func (r *limitReader) Read(p []byte) (n int, err error) {
+	n, err = r.in.Read(p)
+	if n > 0 {
+		limitErr := r.limiter.LimitBandwidth(r.ctx, r.slot, n)
+		if err == nil {
+			err = limitErr
+		}
+	}
+	return n, err
+}
+
+// limit returns in limited by the bandwidth limit of the user of the
+// session for slot
+func (d *driver) limit(sctx *ftp.Context, in io.Reader, slot accounting.TokenBucketSlot) io.Reader {
+	limiter := d.limiter(sctx)
+	if limiter == nil {
+		return in
+	}
+	return &limitReader{in: in, ctx: d.ctx, limiter: limiter, slot: slot}
+}
+
 // Stat get information on file or folder
 func (d *driver) Stat(sctx *ftp.Context, path string) (fi iofs.FileInfo, err error) {
 	defer log.Trace(path, "")("fi=%+v, err = %v", &fi, &err)
@@ -451,7 +634,11 @@ func (d *driver) GetFile(sctx *ftp.Context, path string, offset int64) (size int
 	tr := accounting.GlobalStats().NewTransferRemoteSize(path, node.Size())
 	defer tr.Done(d.ctx, nil)
 
-	return node.Size(), handle, nil
+	fr = struct {
+		io.Reader
+		io.Closer
+	}{d.limit(sctx, handle, accounting.TokenBucketSlotTransportRx), handle}
+	return node.Size(), fr, nil
 }
 
 // PutFile upload a file
@@ -459,6 +646,7 @@ func (d *driver) PutFile(sctx *ftp.Context, path string, data io.Reader, offset
 	defer log.Trace(path, "offset=%d", offset)("err = %v", &err)
 
 	var isExist bool
+	data = d.limit(sctx, data, accounting.TokenBucketSlotTransportTx)
 	VFS, err := d.getVFS(sctx)
 	if err != nil {
 		return 0, err
@@ -9,16 +9,35 @@
 package ftp
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jlaffaye/ftp"
 	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/cmd/serve/servetest"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/stretchr/testify/assert"
-	ftp "goftp.io/server/v2"
+	"github.com/stretchr/testify/require"
+	ftpserver "goftp.io/server/v2"
 )
 
 const (
@@ -47,7 +66,7 @@ func TestFTP(t *testing.T) {
 		go func() {
 			err := w.serve()
 			close(quit)
-			if err != ftp.ErrServerClosed {
+			if err != ftpserver.ErrServerClosed {
 				assert.NoError(t, err)
 			}
 		}()
@@ -70,3 +89,310 @@ func TestFTP(t *testing.T) {
 
 	servetest.Run(t, "ftp", start)
 }
+
+// makeTestCert writes a self signed certificate for testHOST to dir
+// returning the paths of the certificate and key and a pool to verify
+// it with
+func makeTestCert(t *testing.T, dir string) (certPath, keyPath string, pool *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: testHOST},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{testHOST},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certPath = filepath.Join(dir, "cert.pem")
+	keyPath = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certPath, keyPath, pool
+}
+
+// tlsOpt returns options for a server using a test certificate and
+// the TLS config for its clients
+func tlsOpt(t *testing.T) (*Options, *tls.Config) {
+	certPath, keyPath, pool := makeTestCert(t, t.TempDir())
+	opt := DefaultOpt
+	opt.BasicUser = testUSER
+	opt.BasicPass = testPASS
+	opt.TLSCert = certPath
+	opt.TLSKey = keyPath
+	return &opt, &tls.Config{
+		RootCAs:    pool,
+		ServerName: testHOST,
+	}
+}
+
+// startServer starts a server for the tests on port serving a
+// temporary directory returning its address
+func startServer(t *testing.T, opt *Options, port string) string {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	opt.ListenAddr = testHOST + ":" + port
+	opt.PassivePorts = testPASSIVEPORTRANGE
+	s, err := newServer(context.Background(), f, opt)
+	require.NoError(t, err)
+	quit := make(chan struct{})
+	go func() {
+		err := s.serve()
+		close(quit)
+		if err != ftpserver.ErrServerClosed {
+			assert.NoError(t, err)
+		}
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, s.close())
+		<-quit
+	})
+	// Wait for the server to listen
+	addr := opt.ListenAddr
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return addr
+}
+
+// assertCode checks err is an FTP error with code
+func assertCode(t *testing.T, err error, code int) {
+	var tpErr *textproto.Error
+	if assert.True(t, errors.As(err, &tpErr), "want FTP error %d got %v", code, err) {
+		assert.Equal(t, code, tpErr.Code, tpErr.Msg)
+	}
+}
+
+// checkTransfer uploads and downloads a file with c
+func checkTransfer(t *testing.T, c *ftp.ServerConn) {
+	content := "hello world"
+	require.NoError(t, c.Stor("file.txt", strings.NewReader(content)))
+	r, err := c.Retr("file.txt")
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, content, string(got))
+	names, err := c.NameList("/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file.txt"}, names)
+}
+
+func TestFTPImplicitTLS(t *testing.T) {
+	opt, clientTLS := tlsOpt(t)
+	addr := startServer(t, opt, "51781")
+
+	c, err := ftp.Dial(addr, ftp.DialWithTimeout(5*time.Second), ftp.DialWithTLS(clientTLS))
+	require.NoError(t, err)
+	err = c.Login(testUSER, "wrong")
+	assertCode(t, err, 530)
+	require.NoError(t, c.Login(testUSER, testPASS))
+	checkTransfer(t, c)
+	require.NoError(t, c.Quit())
+
+	// Plain connections get no welcome as the server waits for
+	// the TLS handshake
+	raw, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	require.NoError(t, raw.SetReadDeadline(time.Now().Add(250*time.Millisecond)))
+	_, err = raw.Read(make([]byte, 1))
+	assert.True(t, os.IsTimeout(err), err)
+	_ = raw.Close()
+}
+
+func TestFTPExplicitTLS(t *testing.T) {
+	opt, clientTLS := tlsOpt(t)
+	opt.ExplicitTLS = true
+	opt.RequireTLS = true
+	addr := startServer(t, opt, "51782")
+
+	// Plain text logins are refused
+	c, err := ftp.Dial(addr, ftp.DialWithTimeout(5*time.Second))
+	require.NoError(t, err)
+	err = c.Login(testUSER, testPASS)
+	assert.ErrorContains(t, err, "AUTH TLS required")
+	_ = c.Quit()
+
+	c, err = ftp.Dial(addr, ftp.DialWithTimeout(5*time.Second), ftp.DialWithExplicitTLS(clientTLS))
+	require.NoError(t, err)
+	require.NoError(t, c.Login(testUSER, testPASS))
+	checkTransfer(t, c)
+	require.NoError(t, c.Quit())
+
+	// Active data connections are refused
+	raw, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer func() {
+		_ = raw.Close()
+	}()
+	conn := textproto.NewConn(raw)
+	cmd := func(wantCode int, format string, args ...interface{}) {
+		_, err := conn.Cmd(format, args...)
+		require.NoError(t, err)
+		_, _, err = conn.ReadResponse(wantCode)
+		require.NoError(t, err, format)
+	}
+	_, _, err = conn.ReadResponse(220)
+	require.NoError(t, err)
+	cmd(234, "AUTH TLS")
+	conn = textproto.NewConn(tls.Client(raw, clientTLS))
+	cmd(331, "USER %s", testUSER)
+	cmd(230, "PASS %s", testPASS)
+	cmd(534, "PORT 127,0,0,1,4,1")
+	cmd(534, "EPRT |1|127.0.0.1|1025|")
+	cmd(221, "QUIT")
+}
+
+func TestFTPUserBwLimit(t *testing.T) {
+	opt := DefaultOpt
+	opt.BasicUser = testUSER
+	opt.BasicPass = testPASS
+	require.NoError(t, opt.UserBwLimit.Set("1M:512k"))
+	addr := startServer(t, &opt, "51783")
+
+	c, err := ftp.Dial(addr, ftp.DialWithTimeout(5*time.Second))
+	require.NoError(t, err)
+	defer func() {
+		_ = c.Quit()
+	}()
+
+	// The buckets start empty when the user first transfers so
+	// 256k takes at least 0.25s to upload and 0.5s to download
+	require.NoError(t, c.Login(testUSER, testPASS))
+	start := time.Now()
+	content := bytes.Repeat([]byte("x"), 256*1024)
+	require.NoError(t, c.Stor("file.bin", bytes.NewReader(content)))
+	assert.Greater(t, time.Since(start), 200*time.Millisecond)
+
+	r, err := c.Retr("file.bin")
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Greater(t, time.Since(start), 450*time.Millisecond)
+	assert.Equal(t, content, got)
+}
+
+// makeClientCerts writes a CA to dir returning its path and
+// certificates signed by it for each of names
+func makeClientCerts(t *testing.T, dir string, names ...string) (caPath string, certs []tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	caPath = filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+	for i, name := range names {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		certs = append(certs, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key})
+	}
+	return caPath, certs
+}
+
+func TestFTPClientCert(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		explicit bool
+		port     string
+	}{
+		{"Implicit", false, "51784"},
+		{"Explicit", true, "51785"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opt, clientTLS := tlsOpt(t)
+			caPath, certs := makeClientCerts(t, t.TempDir(), testUSER, "other")
+			opt.ClientCA = caPath
+			opt.ExplicitTLS = test.explicit
+			addr := startServer(t, opt, test.port)
+
+			dial := func(certs ...tls.Certificate) *ftp.ServerConn {
+				config := clientTLS.Clone()
+				config.Certificates = certs
+				tlsOption := ftp.DialWithTLS(config)
+				if test.explicit {
+					tlsOption = ftp.DialWithExplicitTLS(config)
+				}
+				c, err := ftp.Dial(addr, ftp.DialWithTimeout(5*time.Second), tlsOption)
+				require.NoError(t, err)
+				t.Cleanup(func() {
+					_ = c.Quit()
+				})
+				return c
+			}
+
+			// The certificate replaces the password
+			c := dial(certs[0])
+			require.NoError(t, c.Login(testUSER, "anything"))
+			checkTransfer(t, c)
+
+			// Users can only log in as the user in their certificate
+			c = dial(certs[1])
+			assertCode(t, c.Login(testUSER, testPASS), 530)
+			c = dial(certs[1])
+			require.NoError(t, c.Login("other", "anything"))
+
+			// Clients must have a certificate
+			c = dial()
+			assertCode(t, c.Login(testUSER, testPASS), 530)
+		})
+	}
+}
+
+func TestFTPOptions(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	for _, test := range []struct {
+		set  func(opt *Options)
+		want string
+	}{
+		{func(opt *Options) { opt.PassivePorts = "1-2-3" }, "invalid format for passive ports"},
+		{func(opt *Options) { opt.ExplicitTLS = true }, "--explicit-tls needs --cert and --key"},
+		{func(opt *Options) { opt.RequireTLS = true }, "--require-tls needs --cert and --key"},
+		{func(opt *Options) { opt.TLSCert = "cert.pem" }, "--cert and --key must be used together"},
+		{func(opt *Options) { opt.ClientCA = "ca.pem" }, "--client-ca needs --cert and --key"},
+	} {
+		opt := DefaultOpt
+		opt.ListenAddr = testHOST + ":0"
+		test.set(&opt)
+		_, err := newServer(context.Background(), f, &opt)
+		assert.ErrorContains(t, err, test.want)
+	}
+}
@@ -20,8 +20,10 @@ import (
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/flags"
 	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/lib/http/signedlink"
 	"github.com/rclone/rclone/lib/systemd"
 	"github.com/rclone/rclone/vfs"
 	"github.com/rclone/rclone/vfs/vfsflags"
@@ -30,9 +32,12 @@ import (
 
 // Options required for http server
 type Options struct {
-	Auth     libhttp.AuthConfig
-	HTTP     libhttp.Config
-	Template libhttp.TemplateConfig
+	Auth        libhttp.AuthConfig
+	HTTP        libhttp.Config
+	Template    libhttp.TemplateConfig
+	AllowWrite  bool // allow files to be uploaded, renamed and deleted
+	Thumbnails  bool // serve thumbnails of images
+	SignedLinks bool // serve files from signed links without authentication
 }
 
 // DefaultOpt is the default values used for Options
@@ -54,6 +59,9 @@ func init() {
 	libhttp.AddAuthFlagsPrefix(flagSet, flagPrefix, &Opt.Auth)
 	libhttp.AddHTTPFlagsPrefix(flagSet, flagPrefix, &Opt.HTTP)
 	libhttp.AddTemplateFlagsPrefix(flagSet, flagPrefix, &Opt.Template)
+	flags.BoolVarP(flagSet, &Opt.AllowWrite, flagPrefix+"allow-write", "", Opt.AllowWrite, "Allow files to be uploaded, renamed and deleted", "")
+	flags.BoolVarP(flagSet, &Opt.Thumbnails, flagPrefix+"thumbnails", "", Opt.Thumbnails, "Serve thumbnails of images in directory listings", "")
+	flags.BoolVarP(flagSet, &Opt.SignedLinks, flagPrefix+"signed-links", "", Opt.SignedLinks, "Serve files from links made with rclone link --self-signed", "")
 	vfsflags.AddFlags(flagSet)
 	proxyflags.AddFlags(flagSet)
 }
@@ -73,6 +81,61 @@ The server will log errors.  Use ` + "`-v`" + ` to see access logs.
 
 ` + "`--bwlimit`" + ` will be respected for file transfers.  Use ` + "`--stats`" + ` to
 control the stats printing.
+
+### Web interface
+
+The directory listings can be browsed with a web browser. Add
+` + "`?zip`" + ` to the URL of any directory to download it, and everything
+in it, as a zip file which is built on the fly.
+
+Use ` + "`--thumbnails`" + ` to show thumbnails of images in the listings.
+These are made by reading the image from the remote, so this can be
+slow for remotes with lots of large images. Only a few thumbnails are
+made at once, images over 32 MiB or 25 megapixels are skipped and the
+thumbnails are kept in memory for a few minutes after they were last
+used. A thumbnail of any image can be fetched by adding
+` + "`?thumbnail`" + ` to its URL.
+
+If the client sends an ` + "`Accept: application/json`" + ` header then the
+directory listing is returned as JSON instead of HTML, e.g.
+
+    curl -H "Accept: application/json" http://localhost:8080/dir/
+
+### Writing files
+
+By default the server is read only. Use ` + "`--allow-write`" + ` to allow
+files to be uploaded, renamed and deleted, from the web interface or
+with these requests:
+
+| Request | Action |
+| :------ | :----- |
+| ` + "`PUT /path/file`" + ` | Upload the body of the request as the file |
+| ` + "`POST /dir/`" + ` | Upload the files in a ` + "`multipart/form-data`" + ` body into the directory |
+| ` + "`POST /dir/new/?op=mkdir`" + ` | Make the directory |
+| ` + "`POST /path?op=rename&to=/new/path`" + ` | Rename a file or directory |
+| ` + "`DELETE /path/file`" + ` | Delete the file |
+| ` + "`DELETE /dir/`" + ` | Delete the directory and everything in it |
+
+Writing files needs authentication so ` + "`--allow-write`" + ` can only be
+used with ` + "`--user`" + `, ` + "`--htpasswd`" + `, ` + "`--client-ca`" + ` or ` + "`--auth-proxy`" + `.
+Requests from web pages on other origins are refused unless allowed
+with ` + "`--allow-origin`" + `. Use ` + "`--read-only`" + ` as well to stop the
+files being changed while keeping the web interface controls hidden.
+
+### Signed links
+
+Use ` + "`--signed-links`" + ` to share files with people who don't have a
+login. This serves files from expiring links made with
+
+    rclone link --self-signed --self-signed-url http://host:8080/ --self-signed-root remote:path remote:path/file
+
+where ` + "`remote:path`" + ` is the remote being served. The links are
+signed with a secret key kept in ` + "`" + signedlink.KeyFileName + "`" + ` next to the config file,
+so they can only be made by rclone with the same key. Links can also
+be made with the [operations/publiclink](/rc/#operations-publiclink) rc call.
+See [rclone link](/commands/rclone_link/) for more about signed links.
+
+Signed links can't be used with ` + "`--auth-proxy`" + `.
 ` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + vfs.Help + proxy.Help,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.39",
@@ -107,7 +170,9 @@ type HTTP struct {
 	server *libhttp.Server
 	opt    Options
 	proxy  *proxy.Proxy
-	ctx    context.Context // for global config
+	links  *signedlink.Server // set if serving signed links
+	thumbs *thumbnails        // set if serving thumbnails
+	ctx    context.Context    // for global config
 }
 
 // Gets the VFS in use for this request
@@ -141,6 +206,9 @@ func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
 		ctx: ctx,
 		opt: opt,
 	}
+	if opt.Thumbnails {
+		s.thumbs = newThumbnails()
+	}
 
 	if proxyflags.Opt.AuthProxy != "" {
 		s.proxy = proxy.New(ctx, &proxyflags.Opt)
@@ -150,6 +218,17 @@ func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
 		s._vfs = vfs.New(f, &vfsflags.Opt)
 	}
 
+	if s.opt.SignedLinks {
+		if s.proxy != nil {
+			return nil, errors.New("--signed-links can't be used with --auth-proxy")
+		}
+		s.links, err = signedlink.NewServer()
+		if err != nil {
+			return nil, err
+		}
+		s.opt.Auth.SkipAuthFn = s.links.SkipAuth
+	}
+
 	s.server, err = libhttp.NewServer(ctx,
 		libhttp.WithConfig(s.opt.HTTP),
 		libhttp.WithAuth(s.opt.Auth),
@@ -158,6 +237,10 @@ func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to init server: %w", err)
 	}
+	if s.opt.AllowWrite && !s.server.UsingAuth() {
+		_ = s.server.Shutdown()
+		return nil, errors.New("--allow-write needs authentication - use --user, --htpasswd, --client-ca or --auth-proxy")
+	}
 
 	router := s.server.Router()
 	router.Use(
@@ -166,6 +249,11 @@ func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
 	)
 	router.Get("/*", s.handler)
 	router.Head("/*", s.handler)
+	if s.opt.AllowWrite {
+		router.Put("/*", s.putHandler)
+		router.Post("/*", s.postHandler)
+		router.Delete("/*", s.deleteHandler)
+	}
 
 	s.server.Serve()
 
@@ -176,9 +264,23 @@ func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
 func (s *HTTP) handler(w http.ResponseWriter, r *http.Request) {
 	isDir := strings.HasSuffix(r.URL.Path, "/")
 	remote := strings.Trim(r.URL.Path, "/")
-	if isDir {
+	query := r.URL.Query()
+	if s.links != nil && signedlink.HasSignature(r) {
+		// Signed links may not have been authenticated so must
+		// only serve the file they were signed for
+		if w, ok := s.links.Check(w, r); ok {
+			s.serveFile(w, r, remote)
+		}
+		return
+	}
+	switch {
+	case isDir && query.Has("zip"):
+		s.serveZip(w, r, remote)
+	case isDir:
 		s.serveDir(w, r, remote)
-	} else {
+	case s.opt.Thumbnails && query.Has("thumbnail"):
+		s.serveThumbnail(w, r, remote)
+	default:
 		s.serveFile(w, r, remote)
 	}
 }
@@ -213,6 +315,8 @@ func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string
 
 	// Make the entries for display
 	directory := serve.NewDirectory(dirRemote, s.server.HTMLTemplate())
+	directory.Writable = s.opt.AllowWrite && !VFS.Opt.ReadOnly
+	directory.Thumbnails = s.opt.Thumbnails
 	for _, node := range dirEntries {
 		if vfsflags.Opt.NoModTime {
 			directory.AddHTMLEntry(node.Path(), node.IsDir(), node.Size(), time.Time{})
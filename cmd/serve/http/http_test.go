@@ -1,9 +1,17 @@
 package http
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -14,8 +22,10 @@ import (
 	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/filter"
 	libhttp "github.com/rclone/rclone/lib/http"
+	"github.com/rclone/rclone/lib/http/signedlink"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -267,3 +277,241 @@ func TestGET(t *testing.T) {
 func TestAuthProxy(t *testing.T) {
 	testGET(t, true)
 }
+
+// startWrite starts a server with opt serving a temporary directory
+// with the default template
+func startWrite(t *testing.T, opt Options) (s *HTTP, testURL string, dir string) {
+	dir = t.TempDir()
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	opt.HTTP = libhttp.DefaultCfg()
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	opt.Auth.BasicUser = testUser
+	opt.Auth.BasicPass = testPass
+	s, err = run(context.Background(), f, opt)
+	require.NoError(t, err, "failed to start server")
+	t.Cleanup(func() {
+		assert.NoError(t, s.server.Shutdown())
+	})
+	return s, s.server.URLs()[0], dir
+}
+
+// do makes a request returning the status and body
+func do(t *testing.T, method, url string, body io.Reader, headers ...string) (int, string) {
+	req, err := http.NewRequest(method, url, body)
+	require.NoError(t, err)
+	req.SetBasicAuth(testUser, testPass)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(data)
+}
+
+func TestAllowWriteNeedsAuth(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	opt := Options{
+		HTTP:       libhttp.DefaultCfg(),
+		AllowWrite: true,
+	}
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	_, err = run(context.Background(), f, opt)
+	assert.ErrorContains(t, err, "--allow-write needs authentication")
+}
+
+func TestWrite(t *testing.T) {
+	_, testURL, dir := startWrite(t, Options{AllowWrite: true})
+	readFile := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// The listing shows the controls
+	status, body := do(t, "GET", testURL, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "Upload files")
+
+	// PUT a file
+	status, _ = do(t, "PUT", testURL+"put.txt", strings.NewReader("hello"))
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "hello", readFile("put.txt"))
+
+	// Make a directory
+	status, _ = do(t, "POST", testURL+"dir/?op=mkdir", nil)
+	assert.Equal(t, http.StatusCreated, status)
+	status, _ = do(t, "POST", testURL+"dir/?op=mkdir", nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	// Upload files in a form
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	for _, name := range []string{"one.txt", `C:\Users\me\two.txt`} {
+		part, err := mw.CreateFormFile("file", name)
+		require.NoError(t, err)
+		_, err = part.Write([]byte("contents of " + name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	status, _ = do(t, "POST", testURL+"dir/", bytes.NewReader(buf.Bytes()), "Content-Type", mw.FormDataContentType())
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "contents of one.txt", readFile("dir/one.txt"))
+	assert.Equal(t, `contents of C:\Users\me\two.txt`, readFile("dir/two.txt"))
+
+	// Rename
+	status, _ = do(t, "POST", testURL+"dir/one.txt?op=rename&to=/dir/three.txt", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, "contents of one.txt", readFile("dir/three.txt"))
+	status, _ = do(t, "POST", testURL+"dir/one.txt?op=rename&to=/four.txt", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// Requests from other web sites are refused
+	status, _ = do(t, "DELETE", testURL+"put.txt", nil, "Origin", "http://example.com")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// Delete a file then the directory with everything in it
+	status, _ = do(t, "DELETE", testURL+"put.txt", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = do(t, "DELETE", testURL+"dir/", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestJSONAndZip(t *testing.T) {
+	_, testURL, dir := startWrite(t, Options{})
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub", "subsub"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("aaa"), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "subsub", "b.txt"), []byte("bbbb"), 0666))
+
+	// The server is read only
+	status, _ := do(t, "PUT", testURL+"put.txt", strings.NewReader("hello"))
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	// JSON listing
+	status, body := do(t, "GET", testURL+"sub/", nil, "Accept", "application/json")
+	assert.Equal(t, http.StatusOK, status)
+	var listing struct {
+		Name    string
+		Entries []struct {
+			Name  string
+			IsDir bool
+			Size  int64
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &listing))
+	assert.Equal(t, "/sub", listing.Name)
+	require.Len(t, listing.Entries, 2)
+	assert.Equal(t, "subsub", listing.Entries[0].Name)
+	assert.True(t, listing.Entries[0].IsDir)
+	assert.Equal(t, "a.txt", listing.Entries[1].Name)
+	assert.Equal(t, int64(3), listing.Entries[1].Size)
+
+	// Zip download
+	status, body = do(t, "GET", testURL+"sub/?zip", nil)
+	assert.Equal(t, http.StatusOK, status)
+	zr, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	got := map[string]string{}
+	for _, file := range zr.File {
+		in, err := file.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		got[file.Name] = string(data)
+	}
+	assert.Equal(t, map[string]string{
+		"sub/":             "",
+		"sub/a.txt":        "aaa",
+		"sub/subsub/":      "",
+		"sub/subsub/b.txt": "bbbb",
+	}, got)
+}
+
+func TestThumbnail(t *testing.T) {
+	s, testURL, dir := startWrite(t, Options{Thumbnails: true})
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buf, img))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "red.png"), buf.Bytes(), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "not.png"), []byte("not an image"), 0666))
+
+	status, body := do(t, "GET", testURL, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `src="red.png?thumbnail"`)
+
+	status, body = do(t, "GET", testURL+"red.png?thumbnail", nil)
+	assert.Equal(t, http.StatusOK, status)
+	thumb, err := jpeg.Decode(strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 128, 64), thumb.Bounds())
+	r, g, b, _ := thumb.At(64, 32).RGBA()
+	assert.Greater(t, r, uint32(0xf000))
+	assert.Less(t, g, uint32(0x1000))
+	assert.Less(t, b, uint32(0x1000))
+
+	status, _ = do(t, "GET", testURL+"not.png?thumbnail", nil)
+	assert.Equal(t, http.StatusUnsupportedMediaType, status)
+
+	// Thumbnails and failures are only made once
+	status, _ = do(t, "GET", testURL+"red.png?thumbnail", nil)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = do(t, "GET", testURL+"not.png?thumbnail", nil)
+	assert.Equal(t, http.StatusUnsupportedMediaType, status)
+	assert.Equal(t, 2, s.thumbs.cache.Entries())
+}
+
+func TestSignedLinks(t *testing.T) {
+	oldPath := config.GetConfigPath()
+	require.NoError(t, config.SetConfigPath(filepath.Join(t.TempDir(), "rclone.conf")))
+	defer func() {
+		_ = config.SetConfigPath(oldPath)
+	}()
+	_, testURL, dir := startWrite(t, Options{SignedLinks: true})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("shared"), 0666))
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+
+	link, err := signedlink.Make(context.Background(), f, "file.txt", signedlink.Options{
+		URL:          testURL,
+		Root:         dir,
+		MaxDownloads: 1,
+	})
+	require.NoError(t, err)
+	get := func(url string) int {
+		resp, err := http.Get(url)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Without the signature authentication is needed
+	assert.Equal(t, http.StatusUnauthorized, get(testURL+"file.txt"))
+	assert.Equal(t, http.StatusUnauthorized, get(strings.Replace(link, "file.txt", "", 1)))
+	assert.Equal(t, http.StatusUnauthorized, get(strings.Replace(link, "sig=", "sig=x", 1)))
+
+	resp, err := http.Get(link)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "shared", string(body))
+
+	// The download has been used up
+	assert.Equal(t, http.StatusGone, get(link))
+}
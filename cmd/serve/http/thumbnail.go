@@ -0,0 +1,168 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register the image decoders
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/cache"
+	"github.com/rclone/rclone/vfs"
+)
+
+const (
+	thumbnailSize      = 128        // largest width or height of a thumbnail
+	maxThumbnailSource = 32 << 20   // largest image file to make a thumbnail of
+	maxThumbnailPixels = 25_000_000 // largest image to make a thumbnail of
+	maxThumbnailers    = 4          // most thumbnails to make at once
+)
+
+// thumbnails makes thumbnails a few at a time and remembers them for
+// a while, along with the images which failed, so each one is only
+// made once however many times it is asked for.
+type thumbnails struct {
+	slots chan struct{} // limits the number of thumbnails made at once
+	cache *cache.Cache  // thumbnails or errors by file
+}
+
+func newThumbnails() *thumbnails {
+	return &thumbnails{
+		slots: make(chan struct{}, maxThumbnailers),
+		cache: cache.New(),
+	}
+}
+
+// get returns the thumbnail of file in VFS, making it if necessary
+func (t *thumbnails) get(ctx context.Context, VFS *vfs.VFS, file *vfs.File) (data []byte, err error) {
+	key := fmt.Sprintf("%p\x00%s\x00%d\x00%d", VFS, file.Path(), file.Size(), file.ModTime().UnixNano())
+	value, err := t.cache.Get(key, func(key string) (value interface{}, ok bool, err error) {
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+		defer func() { <-t.slots }()
+		data, err := makeThumbnail(file)
+		return data, true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+// serveThumbnail serves a JPEG thumbnail of the image at remote
+func (s *HTTP) serveThumbnail(w http.ResponseWriter, r *http.Request, remote string) {
+	VFS, err := s.getVFS(r.Context())
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to serve thumbnail: %v", err)
+		return
+	}
+	node, err := VFS.Stat(remote)
+	if err != nil || !node.IsFile() {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	file := node.(*vfs.File)
+	if file.Size() > maxThumbnailSource {
+		http.Error(w, "Image too large for a thumbnail", http.StatusUnsupportedMediaType)
+		return
+	}
+	data, err := s.thumbs.get(r.Context(), VFS, file)
+	if err != nil {
+		fs.Debugf(remote, "Failed to make thumbnail: %v", err)
+		http.Error(w, "Failed to make thumbnail", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, "", file.ModTime(), bytes.NewReader(data))
+}
+
+// makeThumbnail reads the image in file and returns a JPEG thumbnail
+// of it
+func makeThumbnail(file *vfs.File) (data []byte, err error) {
+	in, err := file.Open(os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	buf, err := io.ReadAll(io.LimitReader(in, maxThumbnailSource))
+	if err != nil {
+		return nil, err
+	}
+	// Check the size first so huge images don't use all the memory
+	config, _, err := image.DecodeConfig(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > maxThumbnailPixels {
+		return nil, fmt.Errorf("image too large: %dx%d", config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	err = jpeg.Encode(out, thumbnail(img, thumbnailSize), &jpeg.Options{Quality: 80})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// thumbnail returns img scaled to fit in a square of size pixels,
+// averaging the pixels which make up each pixel of the result.
+// Transparent parts are shown on white as JPEG has no transparency.
+func thumbnail(img image.Image, size int) *image.RGBA64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, h*size/w
+		} else {
+			tw, th = w*size/h, size
+		}
+		if tw < 1 {
+			tw = 1
+		}
+		if th < 1 {
+			th = 1
+		}
+	}
+	out := image.NewRGBA64(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+(x+1)*w/tw
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			// The colours are premultiplied so add white for the
+			// transparent part
+			white := 0xffff - a/n
+			out.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r/n + white),
+				G: uint16(g/n + white),
+				B: uint16(b/n + white),
+				A: 0xffff,
+			})
+		}
+	}
+	return out
+}
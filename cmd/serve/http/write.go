@@ -0,0 +1,242 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/vfs"
+)
+
+// checkOrigin returns true if the request may change files.
+//
+// Browsers send the credentials they have for the server with
+// requests made by any web page so this stops other web sites
+// changing the files. It writes an error response if not.
+func (s *HTTP) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	allowOrigin := s.opt.HTTP.AllowOrigin
+	if origin == "" || allowOrigin == "*" || origin == allowOrigin {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err == nil && u.Host == r.Host {
+		return true
+	}
+	fs.Infof(r.URL.Path, "%s: Refusing request from origin %q", r.RemoteAddr, origin)
+	http.Error(w, "Cross origin request forbidden", http.StatusForbidden)
+	return false
+}
+
+// writeError writes an http error for a failed change to remote
+func writeError(remote string, w http.ResponseWriter, text string, err error) {
+	var status int
+	switch {
+	case errors.Is(err, vfs.ENOENT):
+		status = http.StatusNotFound
+	case errors.Is(err, vfs.EEXIST), errors.Is(err, vfs.ENOTEMPTY):
+		status = http.StatusConflict
+	case errors.Is(err, vfs.EROFS), errors.Is(err, vfs.EPERM):
+		status = http.StatusForbidden
+	default:
+		serve.Error(remote, w, text, err)
+		return
+	}
+	fs.Infof(remote, "%s: %v", text, err)
+	http.Error(w, text+": "+err.Error(), status)
+}
+
+// checkLeaf returns an error if leaf can't be used as a file name
+func checkLeaf(leaf string) error {
+	if leaf == "" || leaf == "." || leaf == ".." || strings.ContainsAny(leaf, "/\\") {
+		return errors.New("invalid file name")
+	}
+	return nil
+}
+
+// putHandler uploads the body of the request to the file
+func (s *HTTP) putHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkOrigin(w, r) {
+		return
+	}
+	VFS, err := s.getVFS(r.Context())
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to upload file: %v", err)
+		return
+	}
+	remote := strings.Trim(r.URL.Path, "/")
+	if strings.HasSuffix(r.URL.Path, "/") || checkLeaf(path.Base(remote)) != nil {
+		http.Error(w, "Can't upload to a directory", http.StatusBadRequest)
+		return
+	}
+	if err := s.upload(r, VFS, remote, r.Body, r.ContentLength); err != nil {
+		writeError(remote, w, "Failed to upload file", err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// postHandler uploads files into a directory or does the operation
+// in the op parameter
+func (s *HTTP) postHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkOrigin(w, r) {
+		return
+	}
+	VFS, err := s.getVFS(r.Context())
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to change files: %v", err)
+		return
+	}
+	isDir := strings.HasSuffix(r.URL.Path, "/")
+	remote := strings.Trim(r.URL.Path, "/")
+	query := r.URL.Query()
+	switch op := query.Get("op"); op {
+	case "", "upload":
+		if !isDir {
+			http.Error(w, "Files must be uploaded to a directory", http.StatusBadRequest)
+			return
+		}
+		s.uploadForm(w, r, VFS, remote)
+	case "mkdir":
+		if _, err := VFS.Stat(remote); err == nil {
+			http.Error(w, "Already exists", http.StatusConflict)
+			return
+		}
+		if err := VFS.Mkdir(remote, 0777); err != nil {
+			writeError(remote, w, "Failed to make directory", err)
+			return
+		}
+		fs.Infof(remote, "%s: Made directory", r.RemoteAddr)
+		w.WriteHeader(http.StatusCreated)
+	case "rename":
+		to := strings.Trim(query.Get("to"), "/")
+		if remote == "" || checkLeaf(path.Base(to)) != nil {
+			http.Error(w, "Invalid rename", http.StatusBadRequest)
+			return
+		}
+		if err := VFS.Rename(remote, to); err != nil {
+			writeError(remote, w, "Failed to rename", err)
+			return
+		}
+		fs.Infof(remote, "%s: Renamed to %q", r.RemoteAddr, to)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Unknown op", http.StatusBadRequest)
+	}
+}
+
+// deleteHandler deletes a file, or a directory and everything in it
+func (s *HTTP) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkOrigin(w, r) {
+		return
+	}
+	VFS, err := s.getVFS(r.Context())
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to delete: %v", err)
+		return
+	}
+	remote := strings.Trim(r.URL.Path, "/")
+	if remote == "" {
+		http.Error(w, "Can't delete the root", http.StatusForbidden)
+		return
+	}
+	node, err := VFS.Stat(remote)
+	if err != nil {
+		writeError(remote, w, "Failed to delete", err)
+		return
+	}
+	if dir, ok := node.(*vfs.Dir); ok {
+		err = dir.RemoveAll()
+	} else {
+		err = node.Remove()
+	}
+	if err != nil {
+		writeError(remote, w, "Failed to delete", err)
+		return
+	}
+	fs.Infof(remote, "%s: Deleted", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadForm uploads the files in a multipart/form-data request to
+// the directory dirRemote
+func (s *HTTP) uploadForm(w http.ResponseWriter, r *http.Request, VFS *vfs.VFS, dirRemote string) {
+	node, err := VFS.Stat(dirRemote)
+	if err != nil {
+		writeError(dirRemote, w, "Failed to upload files", err)
+		return
+	}
+	if !node.IsDir() {
+		http.Error(w, "Not a directory", http.StatusNotFound)
+		return
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expecting a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			http.Error(w, "Failed to read multipart body", http.StatusBadRequest)
+			return
+		}
+		fileName := part.FileName()
+		if fileName == "" {
+			// not a file
+			continue
+		}
+		// Some browsers send the full path of the file
+		leaf := path.Base(strings.ReplaceAll(fileName, `\`, "/"))
+		if checkLeaf(leaf) != nil {
+			http.Error(w, "Invalid file name", http.StatusBadRequest)
+			return
+		}
+		remote := path.Join(dirRemote, leaf)
+		err = s.upload(r, VFS, remote, part, -1)
+		if err != nil {
+			writeError(remote, w, "Failed to upload file", err)
+			return
+		}
+	}
+	// Send browsers posting the form back to the directory
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Location", "./")
+		w.WriteHeader(http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// upload writes in to the file remote
+func (s *HTTP) upload(r *http.Request, VFS *vfs.VFS, remote string, in io.Reader, size int64) (err error) {
+	ctx := r.Context()
+	fs.Infof(remote, "%s: Uploading file", r.RemoteAddr)
+	handle, err := VFS.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	tr := accounting.Stats(ctx).NewTransferRemoteSize(remote, size)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	acc := tr.Account(ctx, io.NopCloser(in))
+	_, err = io.Copy(handle, acc)
+	closeErr := handle.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/vfs"
+)
+
+// serveZip serves the directory at dirRemote and everything in it
+// as a zip file built as it is sent
+func (s *HTTP) serveZip(w http.ResponseWriter, r *http.Request, dirRemote string) {
+	VFS, err := s.getVFS(r.Context())
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to serve zip: %v", err)
+		return
+	}
+	node, err := VFS.Stat(dirRemote)
+	if err == vfs.ENOENT {
+		http.Error(w, "Directory not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		serve.Error(dirRemote, w, "Failed to find directory", err)
+		return
+	}
+	if !node.IsDir() {
+		http.Error(w, "Not a directory", http.StatusNotFound)
+		return
+	}
+	name := node.Name()
+	if dirRemote == "" {
+		name = "rclone"
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	if r.Method == "HEAD" {
+		return
+	}
+
+	fs.Infof(dirRemote, "%s: Serving directory as zip", r.RemoteAddr)
+	zw := zip.NewWriter(w)
+	err = zipDir(r.Context(), zw, node.(*vfs.Dir), name+"/")
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		// The headers have been sent so all we can do is stop
+		err = fs.CountError(err)
+		fs.Errorf(dirRemote, "Didn't finish writing zip: %v", err)
+	}
+}
+
+// zipDir adds dir and everything in it to zw with names starting
+// with prefix
+func zipDir(ctx context.Context, zw *zip.Writer, dir *vfs.Dir, prefix string) error {
+	_, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     prefix,
+		Modified: dir.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	nodes, err := dir.ReadDirAll()
+	if err != nil {
+		return fmt.Errorf("failed to list %q: %w", dir.Path(), err)
+	}
+	for _, node := range nodes {
+		switch x := node.(type) {
+		case *vfs.Dir:
+			err = zipDir(ctx, zw, x, prefix+x.Name()+"/")
+		case *vfs.File:
+			err = zipFile(ctx, zw, x, prefix+x.Name())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipFile adds the contents of file to zw as name
+func zipFile(ctx context.Context, zw *zip.Writer, file *vfs.File, name string) (err error) {
+	out, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: file.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	in, err := file.Open(os.O_RDONLY)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", file.Path(), err)
+	}
+	defer fs.CheckClose(in, &err)
+	tr := accounting.Stats(ctx).NewTransferRemoteSize(file.Path(), file.Size())
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	_, err = io.Copy(out, tr.Account(ctx, io.NopCloser(in)))
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", file.Path(), err)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+//go:build unix
+// +build unix
+
+package nfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	billy "github.com/go-git/go-billy/v5"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/vfs"
+	nfs "github.com/willscott/go-nfs"
+	nfshelper "github.com/willscott/go-nfs/helpers"
+)
+
+// The types of handle cache
+const (
+	cacheMemory = "memory"
+	cacheDisk   = "disk"
+)
+
+// Cache converts between the paths of files and the NFS handles
+// given to clients for them
+type Cache interface {
+	// ToHandle takes a file and represents it with an opaque handle to reference it.
+	ToHandle(f billy.Filesystem, path []string) []byte
+
+	// FromHandle converts from an opaque handle to the file it represents
+	FromHandle(fh []byte) (billy.Filesystem, []string, error)
+
+	// HandleLimit exports how many file handles can be safely stored by this cache.
+	HandleLimit() int
+}
+
+// newCache makes the handle cache set by opt
+func newCache(vfs *vfs.VFS, f billy.Filesystem, opt *Options) (Cache, error) {
+	switch opt.HandleCache {
+	case cacheMemory:
+		// The caching handler only needs the embedded handler for
+		// the methods we don't call, so we don't pass one.
+		return nfshelper.NewCachingHandler(nil, opt.HandleLimit), nil
+	case cacheDisk:
+		dir := opt.HandleCacheDir
+		if dir == "" {
+			dir = defaultCacheDir(vfs.Fs())
+		}
+		return newDiskCache(f, dir, opt.HandleLimit)
+	}
+	return nil, fmt.Errorf("unknown handle cache type %q - must be %q or %q", opt.HandleCache, cacheMemory, cacheDisk)
+}
+
+// defaultCacheDir returns the directory under the cache dir used to
+// store the handles for f
+func defaultCacheDir(f fs.Fs) string {
+	return filepath.Join(config.GetCacheDir(), "serve-nfs", "handles", f.Name(), filepath.FromSlash(f.Root()))
+}
+
+// touchInterval is how often the modification time of a handle file
+// is updated when it is used
+const touchInterval = time.Hour
+
+// diskCache stores the handles on disk so they stay valid when
+// rclone is restarted.
+//
+// The handle of a file is the SHA-256 of its path so it is always
+// the same. The path is stored in a file named after the handle so
+// it can be found from the handle.
+//
+// The modification time of a handle file is when it was last used
+// (to within touchInterval) and when there are more than limit
+// handles the least recently used are removed. The handles of files
+// which are removed or renamed through NFS are removed straight away.
+type diskCache struct {
+	f     billy.Filesystem
+	dir   string
+	limit int
+
+	mu      sync.Mutex
+	handles int  // number of handles stored
+	pruning bool // set while handles are being removed
+}
+
+// newDiskCache makes a handle cache for f storing the handles in dir
+func newDiskCache(f billy.Filesystem, dir string, limit int) (*diskCache, error) {
+	err := file.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make handle cache directory: %w", err)
+	}
+	c := &diskCache{
+		f:     f,
+		dir:   dir,
+		limit: limit,
+	}
+	handles, err := c.list()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read handle cache directory: %w", err)
+	}
+	c.handles = len(handles)
+	fs.Debugf(nil, "NFS handle cache in %q has %d handles", dir, c.handles)
+	if c.handles > c.limit {
+		c.pruning = true
+		c.prune()
+	}
+	return c, nil
+}
+
+// handleFile is a handle stored on disk
+type handleFile struct {
+	path    string
+	modTime time.Time
+}
+
+// list returns the handles stored on disk, removing any temporary
+// files left behind
+func (c *diskCache) list() (handles []handleFile, err error) {
+	err = filepath.WalkDir(c.dir, func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			_ = os.Remove(path)
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		handles = append(handles, handleFile{path: path, modTime: fi.ModTime()})
+		return nil
+	})
+	return handles, err
+}
+
+// added records that a handle was stored, removing the least recently
+// used handles in the background if there are too many
+func (c *diskCache) added() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handles++
+	if c.handles > c.limit && !c.pruning {
+		c.pruning = true
+		go c.prune()
+	}
+}
+
+// prune removes the least recently used handles until there are
+// fewer than limit, leaving some room so it doesn't run too often
+//
+// Call with pruning set
+func (c *diskCache) prune() {
+	defer func() {
+		c.mu.Lock()
+		c.pruning = false
+		c.mu.Unlock()
+	}()
+	handles, err := c.list()
+	if err != nil {
+		fs.Errorf(nil, "NFS handle cache: failed to list handles: %v", err)
+		return
+	}
+	keep := c.limit - c.limit/10
+	if len(handles) <= keep {
+		return
+	}
+	sort.Slice(handles, func(i, j int) bool {
+		return handles[i].modTime.Before(handles[j].modTime)
+	})
+	removed := 0
+	for _, handle := range handles[:len(handles)-keep] {
+		err := os.Remove(handle.path)
+		if err != nil && !os.IsNotExist(err) {
+			fs.Errorf(nil, "NFS handle cache: failed to remove handle: %v", err)
+			continue
+		}
+		removed++
+	}
+	fs.Debugf(nil, "NFS handle cache: removed %d least recently used handles", removed)
+	c.mu.Lock()
+	c.handles = len(handles) - removed
+	c.mu.Unlock()
+}
+
+// touch marks the handle stored in handlePath which was last marked
+// at modTime as used
+func (c *diskCache) touch(handlePath string, modTime time.Time) {
+	now := time.Now()
+	if now.Sub(modTime) < touchInterval {
+		return
+	}
+	err := os.Chtimes(handlePath, now, now)
+	if err != nil {
+		fs.Debugf(nil, "NFS handle cache: failed to mark handle as used: %v", err)
+	}
+}
+
+// forget removes the handle of path as it doesn't exist any more
+func (c *diskCache) forget(path string) {
+	sum := sha256.Sum256([]byte(path))
+	err := os.Remove(c.handlePath(sum[:]))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fs.Errorf(nil, "NFS handle cache: failed to remove handle for %q: %v", path, err)
+		}
+		return
+	}
+	c.mu.Lock()
+	c.handles--
+	c.mu.Unlock()
+}
+
+// handlePath returns the path of the file the handle fh is stored in
+func (c *diskCache) handlePath(fh []byte) string {
+	name := hex.EncodeToString(fh)
+	return filepath.Join(c.dir, name[0:2], name[2:4], name)
+}
+
+// ToHandle takes a file and represents it with an opaque handle to reference it.
+func (c *diskCache) ToHandle(f billy.Filesystem, path []string) []byte {
+	joined := strings.Join(path, "/")
+	sum := sha256.Sum256([]byte(joined))
+	fh := sum[:]
+	handlePath := c.handlePath(fh)
+	if fi, err := os.Stat(handlePath); err == nil {
+		c.touch(handlePath, fi.ModTime())
+		return fh
+	}
+	err := c.write(handlePath, joined)
+	if err != nil {
+		fs.Errorf(nil, "NFS handle cache: failed to store handle for %q: %v", joined, err)
+	} else {
+		c.added()
+	}
+	return fh
+}
+
+// write stores path in handlePath atomically
+func (c *diskCache) write(handlePath, path string) (err error) {
+	err = file.MkdirAll(filepath.Dir(handlePath), 0700)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(handlePath), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	_, err = tmp.WriteString(path)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), handlePath)
+}
+
+// FromHandle converts from an opaque handle to the file it represents
+func (c *diskCache) FromHandle(fh []byte) (billy.Filesystem, []string, error) {
+	if len(fh) != sha256.Size {
+		return nil, []string{}, &nfs.NFSStatusError{NFSStatus: nfs.NFSStatusBadHandle}
+	}
+	handlePath := c.handlePath(fh)
+	data, modTime, err := readHandle(handlePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, []string{}, &nfs.NFSStatusError{NFSStatus: nfs.NFSStatusStale}
+	} else if err != nil {
+		return nil, []string{}, &nfs.NFSStatusError{NFSStatus: nfs.NFSStatusServerFault, WrappedErr: err}
+	}
+	c.touch(handlePath, modTime)
+	if len(data) == 0 {
+		return c.f, []string{}, nil
+	}
+	return c.f, strings.Split(string(data), "/"), nil
+}
+
+// readHandle reads the path stored in handlePath and when it was
+// last used
+func readHandle(handlePath string) (data []byte, modTime time.Time, err error) {
+	in, err := os.Open(handlePath)
+	if err != nil {
+		return nil, modTime, err
+	}
+	defer fs.CheckClose(in, &err)
+	fi, err := in.Stat()
+	if err != nil {
+		return nil, modTime, err
+	}
+	data, err = io.ReadAll(in)
+	return data, fi.ModTime(), err
+}
+
+// HandleLimit exports how many file handles can be safely stored by this cache.
+func (c *diskCache) HandleLimit() int {
+	return c.limit
+}
+
+// Check interface
+var _ Cache = (*diskCache)(nil)
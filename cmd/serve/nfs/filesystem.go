@@ -17,7 +17,14 @@ import (
 
 // FS is our wrapper around the VFS to properly support billy.Filesystem interface
 type FS struct {
-	vfs *vfs.VFS
+	vfs      *vfs.VFS
+	readOnly bool              // set to serve this view of the VFS read only
+	forget   func(path string) // if set called with paths removed or renamed
+}
+
+// readOnlyView returns a read only view of f
+func (f *FS) readOnlyView() *FS {
+	return &FS{vfs: f.vfs, readOnly: true, forget: f.forget}
 }
 
 // ReadDir implements read dir
@@ -47,12 +54,20 @@ func (f *FS) Stat(filename string) (os.FileInfo, error) {
 
 // Rename renames a file
 func (f *FS) Rename(oldpath, newpath string) error {
-	return f.vfs.Rename(oldpath, newpath)
+	err := f.vfs.Rename(oldpath, newpath)
+	if err == nil && f.forget != nil {
+		f.forget(oldpath)
+	}
+	return err
 }
 
 // Remove deletes a file
 func (f *FS) Remove(filename string) error {
-	return f.vfs.Remove(filename)
+	err := f.vfs.Remove(filename)
+	if err == nil && f.forget != nil {
+		f.forget(filename)
+	}
+	return err
 }
 
 // Join joins path elements
@@ -148,7 +163,7 @@ func (f *FS) Root() string {
 
 // Capabilities exports the filesystem capabilities
 func (f *FS) Capabilities() billy.Capability {
-	if f.vfs.Opt.CacheMode == vfscommon.CacheModeOff {
+	if f.readOnly || f.vfs.Opt.ReadOnly || f.vfs.Opt.CacheMode == vfscommon.CacheModeOff {
 		return billy.ReadCapability | billy.SeekCapability
 	}
 	return billy.WriteCapability | billy.ReadCapability |
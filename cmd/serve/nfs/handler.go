@@ -5,6 +5,7 @@ package nfs
 
 import (
 	"context"
+	iofs "io/fs"
 	"net"
 
 	"github.com/go-git/go-billy/v5"
@@ -14,19 +15,40 @@ import (
 )
 
 // NewBackendAuthHandler creates a handler for the provided filesystem
-func NewBackendAuthHandler(vfs *vfs.VFS) nfs.Handler {
-	return &BackendAuthHandler{vfs}
+func NewBackendAuthHandler(vfs *vfs.VFS, opt *Options) (*BackendAuthHandler, error) {
+	h := &BackendAuthHandler{
+		vfs: vfs,
+		fs:  &FS{vfs: vfs},
+	}
+	var err error
+	h.cache, err = newCache(vfs, h.fs, opt)
+	if err != nil {
+		return nil, err
+	}
+	if dc, ok := h.cache.(*diskCache); ok {
+		h.fs.forget = dc.forget
+	}
+	// The memory cache keeps the verifiers too, otherwise use a
+	// caching handler just for them
+	var ok bool
+	if h.verifiers, ok = h.cache.(nfs.CachingHandler); !ok {
+		h.verifiers = nfshelper.NewCachingHandler(nil, opt.HandleLimit).(nfs.CachingHandler)
+	}
+	return h, nil
 }
 
 // BackendAuthHandler returns a NFS backing that exposes a given file system in response to all mount requests.
 type BackendAuthHandler struct {
-	vfs *vfs.VFS
+	vfs       *vfs.VFS
+	fs        *FS                // the filesystem given to all mounts
+	cache     Cache              // converts paths to and from handles
+	verifiers nfs.CachingHandler // remembers directory listings being read
 }
 
 // Mount backs Mount RPC Requests, allowing for access control policies.
 func (h *BackendAuthHandler) Mount(ctx context.Context, conn net.Conn, req nfs.MountRequest) (status nfs.MountStatus, hndl billy.Filesystem, auths []nfs.AuthFlavor) {
 	status = nfs.MountStatusOk
-	hndl = &FS{vfs: h.vfs}
+	hndl = h.fs
 	auths = []nfs.AuthFlavor{nfs.AuthFlavorNull}
 	return
 }
@@ -48,23 +70,71 @@ func (h *BackendAuthHandler) FSStat(ctx context.Context, f billy.Filesystem, s *
 	return nil
 }
 
-// ToHandle handled by CachingHandler
+// ToHandle converts a file path to an opaque handle using the handle cache
 func (h *BackendAuthHandler) ToHandle(f billy.Filesystem, s []string) []byte {
-	return []byte{}
+	// Always store the writable filesystem - FromHandle works out
+	// whether the file can be written each time
+	return h.cache.ToHandle(h.fs, s)
+}
+
+// FromHandle converts an opaque handle to a file path using the
+// handle cache.
+//
+// If the permissions of the file don't allow it to be written then a
+// read only filesystem is returned so that the NFS ACCESS call and
+// the calls which modify the file fail.
+func (h *BackendAuthHandler) FromHandle(fh []byte) (billy.Filesystem, []string, error) {
+	f, s, err := h.cache.FromHandle(fh)
+	if err != nil {
+		return f, s, err
+	}
+	if !h.writable(s) {
+		return h.fs.readOnlyView(), s, nil
+	}
+	return f, s, nil
 }
 
-// FromHandle handled by CachingHandler
-func (h *BackendAuthHandler) FromHandle([]byte) (billy.Filesystem, []string, error) {
-	return nil, []string{}, nil
+// writable returns false if the file at path s can't be written
+// because of the permissions set on the VFS
+func (h *BackendAuthHandler) writable(s []string) bool {
+	opt := &h.vfs.Opt
+	// Only look at the file if the permissions deny writing to
+	// something. The whole filesystem being read only is dealt with
+	// by FS.Capabilities.
+	if opt.DirPerms&0222 != 0 && opt.FilePerms&0222 != 0 {
+		return true
+	}
+	fi, err := h.fs.Stat(h.fs.Join(s...))
+	if err != nil {
+		// Let the operation find the error
+		return true
+	}
+	return fi.Mode().Perm()&0222 != 0
 }
 
-// HandleLimit handled by cachingHandler
+// HandleLimit returns the number of handles the handle cache can store
 func (h *BackendAuthHandler) HandleLimit() int {
-	return -1
+	return h.cache.HandleLimit()
+}
+
+// VerifierFor returns the cookie verifier for the listing of the
+// directory path, remembering the listing so it can be continued
+func (h *BackendAuthHandler) VerifierFor(path string, contents []iofs.FileInfo) uint64 {
+	return h.verifiers.VerifierFor(path, contents)
 }
 
-func newHandler(vfs *vfs.VFS) nfs.Handler {
-	handler := NewBackendAuthHandler(vfs)
-	cacheHelper := nfshelper.NewCachingHandler(handler, 1024)
-	return cacheHelper
+// DataForVerifier returns the listing of the directory path with the
+// cookie verifier or nil if it has been forgotten
+func (h *BackendAuthHandler) DataForVerifier(path string, verifier uint64) []iofs.FileInfo {
+	return h.verifiers.DataForVerifier(path, verifier)
 }
+
+func newHandler(vfs *vfs.VFS, opt *Options) (nfs.Handler, error) {
+	return NewBackendAuthHandler(vfs, opt)
+}
+
+// Check interface
+var (
+	_ nfs.Handler        = (*BackendAuthHandler)(nil)
+	_ nfs.CachingHandler = (*BackendAuthHandler)(nil)
+)
@@ -0,0 +1,225 @@
+//go:build unix
+// +build unix
+
+package nfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	billy "github.com/go-git/go-billy/v5"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestVFS makes a VFS on a temporary directory with the options
+// changed by fn
+func newTestVFS(t *testing.T, fn func(opt *vfscommon.Options)) *vfs.VFS {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "dir"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dir", "file"), []byte("hello"), 0666))
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	opt := vfscommon.DefaultOpt
+	opt.CacheMode = vfscommon.CacheModeWrites
+	if fn != nil {
+		fn(&opt)
+	}
+	v := vfs.New(f, &opt)
+	t.Cleanup(v.Shutdown)
+	return v
+}
+
+func TestDiskCache(t *testing.T) {
+	v := newTestVFS(t, nil)
+	dir := t.TempDir()
+	opt := DefaultOpt
+	opt.HandleCache = cacheDisk
+	opt.HandleCacheDir = dir
+	h, err := NewBackendAuthHandler(v, &opt)
+	require.NoError(t, err)
+
+	root := h.ToHandle(h.fs, []string{})
+	file := h.ToHandle(h.fs, []string{"dir", "file"})
+	assert.Equal(t, 32, len(root))
+	assert.NotEqual(t, root, file)
+	assert.Equal(t, file, h.ToHandle(h.fs, []string{"dir", "file"}))
+
+	f, path, err := h.FromHandle(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, path)
+	assert.Equal(t, h.fs, f)
+
+	// The handles should still work with a new handler as if rclone
+	// had been restarted
+	h2, err := NewBackendAuthHandler(v, &opt)
+	require.NoError(t, err)
+	_, path, err = h2.FromHandle(file)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir", "file"}, path)
+	assert.Equal(t, file, h2.ToHandle(h2.fs, []string{"dir", "file"}))
+
+	// Unknown and invalid handles
+	unknown := make([]byte, 32)
+	_, _, err = h2.FromHandle(unknown)
+	assert.Error(t, err)
+	_, _, err = h2.FromHandle([]byte{1, 2, 3})
+	assert.Error(t, err)
+
+	assert.Equal(t, DefaultOpt.HandleLimit, h2.HandleLimit())
+}
+
+func TestDiskCacheLimit(t *testing.T) {
+	v := newTestVFS(t, nil)
+	dir := t.TempDir()
+	opt := DefaultOpt
+	opt.HandleCache = cacheDisk
+	opt.HandleCacheDir = dir
+	opt.HandleLimit = 10
+	h, err := NewBackendAuthHandler(v, &opt)
+	require.NoError(t, err)
+	c := h.cache.(*diskCache)
+	handles := func() int {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.handles
+	}
+
+	// Removed and renamed files are forgotten
+	file := h.ToHandle(h.fs, []string{"dir", "file"})
+	require.NoError(t, h.fs.Rename("dir/file", "dir/file2"))
+	_, _, err = h.FromHandle(file)
+	assert.Error(t, err)
+	file2 := h.ToHandle(h.fs, []string{"dir", "file2"})
+	require.NoError(t, h.fs.Remove("dir/file2"))
+	_, _, err = h.FromHandle(file2)
+	assert.Error(t, err)
+	assert.Equal(t, 0, handles())
+
+	// The least recently used handles are forgotten over the limit
+	age := func(fh []byte, d time.Duration) {
+		when := time.Now().Add(-d)
+		require.NoError(t, os.Chtimes(c.handlePath(fh), when, when))
+	}
+	old := h.ToHandle(h.fs, []string{"old"})
+	age(old, 3*time.Hour)
+	used := h.ToHandle(h.fs, []string{"used"})
+	age(used, 3*time.Hour)
+	for i := 2; i < opt.HandleLimit; i++ {
+		age(h.ToHandle(h.fs, []string{fmt.Sprint(i)}), 2*time.Hour)
+	}
+	assert.Equal(t, opt.HandleLimit, handles())
+	_, _, err = h.FromHandle(used)
+	require.NoError(t, err)
+	h.ToHandle(h.fs, []string{"new"})
+	assert.Eventually(t, func() bool {
+		return handles() <= opt.HandleLimit
+	}, 10*time.Second, 10*time.Millisecond)
+	_, _, err = h.FromHandle(old)
+	assert.Error(t, err)
+	_, _, err = h.FromHandle(used)
+	assert.NoError(t, err)
+
+	// The handles are counted on restart
+	h2, err := NewBackendAuthHandler(v, &opt)
+	require.NoError(t, err)
+	assert.Equal(t, handles(), h2.cache.(*diskCache).handles)
+}
+
+func TestVerifiers(t *testing.T) {
+	for _, cacheType := range []string{cacheMemory, cacheDisk} {
+		t.Run(cacheType, func(t *testing.T) {
+			v := newTestVFS(t, nil)
+			opt := DefaultOpt
+			opt.HandleCache = cacheType
+			opt.HandleCacheDir = t.TempDir()
+			h, err := NewBackendAuthHandler(v, &opt)
+			require.NoError(t, err)
+			contents, err := h.fs.ReadDir("dir")
+			require.NoError(t, err)
+			verifier := h.VerifierFor("dir", contents)
+			assert.Equal(t, contents, h.DataForVerifier("dir", verifier))
+			assert.Nil(t, h.DataForVerifier("dir", verifier+1))
+		})
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	v := newTestVFS(t, nil)
+	opt := DefaultOpt
+	opt.HandleLimit = 10
+	h, err := NewBackendAuthHandler(v, &opt)
+	require.NoError(t, err)
+
+	file := h.ToHandle(h.fs, []string{"dir", "file"})
+	_, path, err := h.FromHandle(file)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir", "file"}, path)
+	assert.Equal(t, 10, h.HandleLimit())
+
+	// Handles are lost on restart
+	h2, err := NewBackendAuthHandler(v, &opt)
+	require.NoError(t, err)
+	_, _, err = h2.FromHandle(file)
+	assert.Error(t, err)
+
+	opt.HandleCache = "potato"
+	_, err = NewBackendAuthHandler(v, &opt)
+	assert.ErrorContains(t, err, `unknown handle cache type "potato"`)
+}
+
+// writable returns whether the handle is served writable
+func writable(t *testing.T, h *BackendAuthHandler, path ...string) bool {
+	f, _, err := h.FromHandle(h.ToHandle(h.fs, path))
+	require.NoError(t, err)
+	return billy.CapabilityCheck(f, billy.WriteCapability)
+}
+
+func TestAccess(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		fn       func(opt *vfscommon.Options)
+		wantRoot bool
+		wantDir  bool
+		wantFile bool
+		wantNew  bool // a file which doesn't exist yet
+	}{
+		{
+			name:     "Default",
+			wantRoot: true, wantDir: true, wantFile: true, wantNew: true,
+		}, {
+			name: "ReadOnly",
+			fn:   func(opt *vfscommon.Options) { opt.ReadOnly = true },
+		}, {
+			name: "CacheModeOff",
+			fn:   func(opt *vfscommon.Options) { opt.CacheMode = vfscommon.CacheModeOff },
+		}, {
+			name:     "ReadOnlyFiles",
+			fn:       func(opt *vfscommon.Options) { opt.FilePerms = 0444 },
+			wantRoot: true, wantDir: true, wantFile: false, wantNew: true,
+		}, {
+			name:     "ReadOnlyDirs",
+			fn:       func(opt *vfscommon.Options) { opt.DirPerms = 0555 },
+			wantRoot: false, wantDir: false, wantFile: true, wantNew: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			v := newTestVFS(t, test.fn)
+			opt := DefaultOpt
+			h, err := NewBackendAuthHandler(v, &opt)
+			require.NoError(t, err)
+			assert.Equal(t, test.wantRoot, writable(t, h))
+			assert.Equal(t, test.wantDir, writable(t, h, "dir"))
+			assert.Equal(t, test.wantFile, writable(t, h, "dir", "file"))
+			assert.Equal(t, test.wantNew, writable(t, h, "dir", "potato"))
+		})
+	}
+}
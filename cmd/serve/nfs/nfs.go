@@ -25,15 +25,27 @@ import (
 
 // Options contains options for the NFS Server
 type Options struct {
-	ListenAddr string // Port to listen on
+	ListenAddr     string // Port to listen on
+	HandleLimit    int    // max number of handles to cache
+	HandleCache    string // type of handle cache: memory or disk
+	HandleCacheDir string // where the disk handle cache is stored
 }
 
-var opt Options
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	HandleLimit: 1000000,
+	HandleCache: cacheMemory,
+}
+
+var opt = DefaultOpt
 
-// AddFlags adds flags for the sftp
+// AddFlags adds flags for the nfs
 func AddFlags(flagSet *pflag.FlagSet, Opt *Options) {
 	rc.AddOption("nfs", &Opt)
 	flags.StringVarP(flagSet, &Opt.ListenAddr, "addr", "", Opt.ListenAddr, "IPaddress:Port or :Port to bind server to", "")
+	flags.IntVarP(flagSet, &Opt.HandleLimit, "nfs-cache-handle-limit", "", Opt.HandleLimit, "Max file handles cached simultaneously (min 5)", "")
+	flags.StringVarP(flagSet, &Opt.HandleCache, "nfs-cache-type", "", Opt.HandleCache, "Type of NFS handle cache to use: memory or disk", "")
+	flags.StringVarP(flagSet, &Opt.HandleCacheDir, "nfs-cache-dir", "", Opt.HandleCacheDir, "The directory the NFS handle cache will use if set", "")
 }
 
 func init() {
@@ -86,6 +98,48 @@ To mount the server under Linux/macOS, use the following command:
 
 Where ` + "`$PORT`" + ` is the same port number we used in the serve nfs command.
 
+### NFS file handles
+
+NFS clients refer to files with file handles which rclone makes up.
+Which handles have been given out needs to be remembered, and how this
+is done is set with ` + "`--nfs-cache-type`" + `:
+
+- ` + "`memory`" + ` - the handles are kept in memory. This is the default.
+  The handles are lost when rclone is restarted, so clients will get
+  "stale file handle" errors and will need to be remounted.
+- ` + "`disk`" + ` - the handles are made from the paths of the files and are
+  stored on disk, so they stay the same when rclone is restarted and
+  clients can carry on using the mount. The handles are stored under
+  the directory set by ` + "`--cache-dir`" + ` unless ` + "`--nfs-cache-dir`" + ` is set.
+
+With either cache at most ` + "`--nfs-cache-handle-limit`" + ` handles are
+remembered, after which the least recently used are forgotten. If
+clients see "stale file handle" errors when working with large
+directory trees then raise this limit. The limit also caps the number
+of directory entries returned in a single directory read. The ` + "`disk`" + `
+cache also forgets the handles of files and directories as soon as
+they are removed or renamed through NFS.
+
+### Permissions and locking
+
+If the VFS is read only because of ` + "`--read-only`" + ` or because
+` + "`--vfs-cache-mode`" + ` is ` + "`off`" + ` then the NFS ACCESS call reports that
+nothing can be modified and calls which modify files fail with a read
+only file system error. Likewise, if ` + "`--file-perms`" + ` or ` + "`--dir-perms`" + `
+remove all the write permissions from files or directories then
+those files or directories are served read only.
+
+The NFS server doesn't support the NLM file locking protocol, so
+clients should be mounted with locking done locally, for example with
+the ` + "`nolock`" + ` option on Linux or the ` + "`locallocks`" + ` option on macOS:
+
+    mount -o port=$PORT,mountport=$PORT,nolock $HOSTNAME: path/to/mountpoint
+
+Locks taken this way only apply to the processes on the client which
+took them. They aren't seen by other NFS clients, by other users of
+the remote or by rclone, so don't rely on them to stop files being
+changed by more than one client at once.
+
 This feature is only available on Unix platforms.
 
 ` + vfs.Help,
@@ -5,6 +5,7 @@ package nfs
 
 import (
 	"context"
+	"fmt"
 	"net"
 
 	nfs "github.com/willscott/go-nfs"
@@ -36,7 +37,13 @@ func NewServer(ctx context.Context, vfs *vfs.VFS, opt *Options) (s *Server, err
 		ctx: ctx,
 		opt: *opt,
 	}
-	s.handler = newHandler(vfs)
+	if s.opt.HandleLimit < 5 {
+		return nil, fmt.Errorf("--nfs-cache-handle-limit must be at least 5 but is %d", s.opt.HandleLimit)
+	}
+	s.handler, err = newHandler(vfs, &s.opt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make NFS handler: %w", err)
+	}
 	s.listener, err = net.Listen("tcp", s.opt.ListenAddr)
 	if err != nil {
 		fs.Errorf(nil, "NFS server failed to listen: %v\n", err)
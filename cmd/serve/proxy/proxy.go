@@ -72,6 +72,21 @@ proxy process (on STDIN) would look similar to this:
 }
 |||
 
+Some protocols, such as SMB with its NTLM authentication and S3 with
+its signed requests, never send the password to the server, they send
+a response to a challenge which can only be checked by something which
+knows the password. For these
+the input to the proxy process only has the |user|
+
+|||
+{
+	"user": "me"
+}
+|||
+
+and the proxy must return the user's password in the |_password|
+parameter of the output for rclone to check the response against.
+
 And as an example return this on STDOUT
 
 |||
@@ -126,8 +141,9 @@ type Proxy struct {
 
 // cacheEntry is what is stored in the vfsCache
 type cacheEntry struct {
-	vfs    *vfs.VFS          // stored VFS
-	pwHash [sha256.Size]byte // sha256 hash of the password/publicKey
+	vfs      *vfs.VFS          // stored VFS
+	pwHash   [sha256.Size]byte // sha256 hash of the password/publicKey
+	password *string           // password from _password if made by CallUser
 }
 
 // New creates a new proxy with the Options passed in
@@ -200,7 +216,36 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value interface{}, er
 	if err != nil {
 		return nil, err
 	}
+	return p.newEntry(user, auth, nil, config)
+}
 
+// callUser runs the auth proxy with just the user name and returns a
+// cacheEntry with the password from _password and an error
+//
+// The backend is only made if check returns nil for the password.
+func (p *Proxy) callUser(user string, check func(password string) error) (value interface{}, err error) {
+	config, err := p.run(map[string]string{
+		"user": user,
+	})
+	if err != nil {
+		return nil, err
+	}
+	password, ok := config.Get("_password")
+	if !ok {
+		return nil, errors.New("proxy: _password not set in result")
+	}
+	delete(config, "_password")
+	err = check(password)
+	if err != nil {
+		return nil, err
+	}
+	return p.newEntry(user, password, &password, config)
+}
+
+// newEntry makes the backend from the config the proxy returned and
+// returns a cacheEntry for it and an error. password is stored in the
+// entry if set.
+func (p *Proxy) newEntry(user, auth string, password *string, config configmap.Simple) (value interface{}, err error) {
 	// Look for required fields in the answer
 	fsName, ok := config.Get("type")
 	if !ok {
@@ -242,8 +287,9 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value interface{}, er
 		// need to in memory. An attacker would find it easier to go
 		// after the unencrypted password in memory most likely.
 		entry := cacheEntry{
-			vfs:    vfs.New(f, &vfsflags.Opt),
-			pwHash: sha256.Sum256([]byte(auth)),
+			vfs:      vfs.New(f, &vfsflags.Opt),
+			pwHash:   sha256.Sum256([]byte(auth)),
+			password: password,
 		}
 		return entry, true, nil
 	})
@@ -289,6 +335,46 @@ func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey
 	return entry.vfs, user, nil
 }
 
+// CallUser runs the auth proxy with just the user name provided
+// returning a *vfs.VFS and the key used in the VFS cache.
+//
+// This is for protocols like SMB and S3 which use challenge response
+// authentication, so the server never sees the password but needs to
+// know it to check the client's response. check is called with the
+// password the proxy returned in _password and should return an
+// error if the client's response doesn't match it. The backend is
+// only made, and the VFS returned, if check returns nil.
+func (p *Proxy) CallUser(user string, check func(password string) error) (VFS *vfs.VFS, vfsKey string, err error) {
+	// Look in the cache first
+	value, cached := p.vfsCache.GetMaybe(user)
+
+	// If not found then call the proxy for a fresh answer
+	if !cached {
+		value, err = p.callUser(user, check)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// check we got what we were expecting
+	entry, ok := value.(cacheEntry)
+	if !ok {
+		return nil, "", fmt.Errorf("proxy: value is not cache entry: %#v", value)
+	}
+	if entry.password == nil {
+		return nil, "", errors.New("proxy: _password not set in result")
+	}
+
+	// A fresh answer has been checked already
+	if cached {
+		err = check(*entry.password)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return entry.vfs, user, nil
+}
+
 // Get VFS from the cache using key - returns nil if not found
 func (p *Proxy) Get(key string) *vfs.VFS {
 	value, ok := p.vfsCache.GetMaybe(key)
@@ -35,6 +35,10 @@ func main() {
 	if out["_root"] == "" {
 		out["_root"] = ""
 	}
+	if in["pass"] == "" && in["public_key"] == "" {
+		// the password for CallUser
+		out["_password"] = "password"
+	}
 	json.NewEncoder(os.Stdout).Encode(&out)
 	if err != nil {
 		log.Fatal(err)
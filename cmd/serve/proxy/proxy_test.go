@@ -6,6 +6,7 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"log"
 	"strings"
 	"testing"
@@ -147,6 +148,45 @@ func TestRun(t *testing.T) {
 
 	})
 
+	t.Run("CallUser", func(t *testing.T) {
+		// check cache empty
+		assert.Equal(t, 0, p.vfsCache.Entries())
+		defer p.vfsCache.Clear()
+
+		errWrong := errors.New("wrong password")
+		check := func(want string) func(string) error {
+			return func(password string) error {
+				if password != want {
+					return errWrong
+				}
+				return nil
+			}
+		}
+
+		// a failed check doesn't make the backend
+		vfs, vfsKey, err := p.CallUser(testUser, check("wrong"))
+		require.ErrorIs(t, err, errWrong)
+		require.Nil(t, vfs)
+		assert.Equal(t, "", vfsKey)
+		assert.Equal(t, 0, p.vfsCache.Entries())
+
+		vfs, vfsKey, err = p.CallUser(testUser, check("password"))
+		require.NoError(t, err)
+		require.NotNil(t, vfs)
+		assert.Equal(t, "proxy-"+testUser, vfs.Fs().Name())
+		assert.Equal(t, testUser, vfsKey)
+		assert.Equal(t, 1, p.vfsCache.Entries())
+
+		// the cached password is checked too
+		vfs, _, err = p.CallUser(testUser, check("wrong"))
+		require.ErrorIs(t, err, errWrong)
+		require.Nil(t, vfs)
+		vfs, _, err = p.CallUser(testUser, check("password"))
+		require.NoError(t, err)
+		require.NotNil(t, vfs)
+		assert.Equal(t, 1, p.vfsCache.Entries())
+	})
+
 	privateKey, privateKeyErr := rsa.GenerateKey(rand.Reader, 2048)
 	if privateKeyErr != nil {
 		log.Fatal("error generating test private key " + privateKeyErr.Error())
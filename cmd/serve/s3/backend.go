@@ -24,17 +24,19 @@ var (
 // s3Backend implements the gofacess3.Backend interface to make an S3
 // backend for gofakes3
 type s3Backend struct {
-	opt  *Options
-	vfs  *vfs.VFS
-	meta *sync.Map
+	opt      *Options
+	vfs      *vfs.VFS
+	meta     *sync.Map
+	versions bool // set if the backend lists old versions of files
 }
 
 // newBackend creates a new SimpleBucketBackend.
-func newBackend(vfs *vfs.VFS, opt *Options) gofakes3.Backend {
+func newBackend(vfs *vfs.VFS, opt *Options) *s3Backend {
 	return &s3Backend{
-		vfs:  vfs,
-		opt:  opt,
-		meta: new(sync.Map),
+		vfs:      vfs,
+		opt:      opt,
+		meta:     new(sync.Map),
+		versions: listsVersions(vfs.Fs()),
 	}
 }
 
@@ -92,8 +94,6 @@ func (b *s3Backend) ListBucket(bucket string, prefix *gofakes3.Prefix, page gofa
 }
 
 // HeadObject returns the fileinfo for the given object name.
-//
-// Note that the metadata is not supported yet.
 func (b *s3Backend) HeadObject(bucketName, objectName string) (*gofakes3.Object, error) {
 	_, err := b.vfs.Stat(bucketName)
 	if err != nil {
@@ -124,11 +124,8 @@ func (b *s3Backend) HeadObject(bucketName, objectName string) (*gofakes3.Object,
 		"Content-Type":  fs.MimeType(context.Background(), fobj),
 	}
 
-	if val, ok := b.meta.Load(fp); ok {
-		metaMap := val.(map[string]string)
-		for k, v := range metaMap {
-			meta[k] = v
-		}
+	for k, v := range b.objectMeta(fp, fobj) {
+		meta[k] = v
 	}
 
 	return &gofakes3.Object{
@@ -197,11 +194,8 @@ func (b *s3Backend) GetObject(bucketName, objectName string, rangeRequest *gofak
 		"Content-Type":  fs.MimeType(context.Background(), fobj),
 	}
 
-	if val, ok := b.meta.Load(fp); ok {
-		metaMap := val.(map[string]string)
-		for k, v := range metaMap {
-			meta[k] = v
-		}
+	for k, v := range b.objectMeta(fp, fobj) {
+		meta[k] = v
 	}
 
 	return &gofakes3.Object{
@@ -279,6 +273,10 @@ func (b *s3Backend) PutObject(
 		}
 	}
 
+	if b.userMetadata(fp) {
+		return result, b.putWithMetadata(fp, meta, input, size)
+	}
+
 	if size == 0 {
 		// maybe a touch operation
 		return b.TouchObject(fp, meta)
@@ -419,6 +417,9 @@ func (b *s3Backend) BucketExists(name string) (exists bool, err error) {
 func (b *s3Backend) CopyObject(srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string) (result gofakes3.CopyObjectResult, err error) {
 	fp := path.Join(srcBucket, srcKey)
 	if srcBucket == dstBucket && srcKey == dstKey {
+		if b.userMetadata(fp) {
+			return result, b.replaceMetadata(fp, meta)
+		}
 		b.meta.Store(fp, meta)
 
 		val, ok := meta["X-Amz-Meta-Mtime"]
@@ -450,10 +451,19 @@ func (b *s3Backend) CopyObject(srcBucket, srcKey, dstBucket, dstKey string, meta
 	}()
 
 	for k, v := range c.Metadata {
-		if _, found := meta[k]; !found && k != "X-Amz-Acl" {
+		if _, found := meta[k]; !found && k != "X-Amz-Acl" && k != taggingCountHeader {
 			meta[k] = v
 		}
 	}
+	if _, found := meta[taggingHeader]; !found {
+		tags, err := b.getTags(srcBucket, srcKey)
+		if err != nil {
+			return result, err
+		}
+		if len(tags) > 0 {
+			meta[taggingHeader] = formatTags(tags)
+		}
+	}
 	if _, ok := meta["mtime"]; !ok {
 		meta["mtime"] = swift.TimeToFloatString(cStat.ModTime())
 	}
@@ -468,3 +478,22 @@ func (b *s3Backend) CopyObject(srcBucket, srcKey, dstBucket, dstKey string, meta
 		LastModified: gofakes3.NewContentTime(cStat.ModTime()),
 	}, nil
 }
+
+// getFsObject returns the path of the object in the VFS and the
+// object on the backend
+func (b *s3Backend) getFsObject(bucketName, objectName string) (fp string, o fs.Object, err error) {
+	_, err = b.vfs.Stat(bucketName)
+	if err != nil {
+		return "", nil, gofakes3.BucketNotFound(bucketName)
+	}
+	fp = path.Join(bucketName, objectName)
+	node, err := b.vfs.Stat(fp)
+	if err != nil || !node.IsFile() {
+		return "", nil, gofakes3.KeyNotFound(objectName)
+	}
+	o, ok := node.DirEntry().(fs.Object)
+	if !ok {
+		return "", nil, gofakes3.KeyNotFound(objectName)
+	}
+	return fp, o, nil
+}
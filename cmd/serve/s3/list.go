@@ -8,6 +8,7 @@ import (
 	"github.com/Mikubill/gofakes3"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/version"
 )
 
 func (b *s3Backend) entryListR(bucket, fdPath, name string, acceptComPrefix bool, response *gofakes3.ObjectList) error {
@@ -38,6 +39,10 @@ func (b *s3Backend) entryListR(bucket, fdPath, name string, acceptComPrefix bool
 				return err
 			}
 		} else {
+			if b.versions && version.Match(object) {
+				// old versions are listed by ListBucketVersions
+				continue
+			}
 			item := &gofakes3.Content{
 				Key:          gofakes3.URLEncode(objectPath),
 				LastModified: gofakes3.NewContentTime(entry.ModTime()),
@@ -59,6 +64,10 @@ func (b *s3Backend) getObjectsListArbitrary(bucket string, prefix *gofakes3.Pref
 			entry := entry.(fs.Object)
 			objName := entry.Remote()
 			object := strings.TrimPrefix(objName, bucket)[1:]
+			if b.versions && version.Match(path.Base(object)) {
+				// old versions are listed by ListBucketVersions
+				continue
+			}
 
 			var matchResult gofakes3.PrefixMatch
 			if prefix.Match(object, &matchResult) {
@@ -0,0 +1,345 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mikubill/gofakes3"
+	"github.com/ncw/swift/v2"
+	"github.com/rclone/rclone/cmd/serve/servemeta"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+const (
+	metaPrefix         = "X-Amz-Meta-"
+	taggingHeader      = "X-Amz-Tagging"
+	taggingCountHeader = "X-Amz-Tagging-Count"
+
+	// The metadata key the tags of an object are stored in. The s3
+	// backend sets the tags of the objects it uploads from this key,
+	// other backends store it as it is.
+	taggingMetadataKey = "x-amz-tagging"
+
+	// S3 limits on tags
+	maxTags           = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// The headers which are stored in the metadata under their lower
+// case names, as the s3 backend does.
+var metadataHeaders = map[string]bool{
+	"Cache-Control":       true,
+	"Content-Disposition": true,
+	"Content-Encoding":    true,
+	"Content-Language":    true,
+	"Content-Type":        true,
+}
+
+// tag is an S3 object tag
+type tag struct {
+	Key   string
+	Value string
+}
+
+// tagSet is the body of GetObjectTagging and PutObjectTagging
+type tagSet struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Tags    []tag    `xml:"TagSet>Tag"`
+}
+
+var (
+	errInvalidTag = &s3Error{http.StatusBadRequest, "InvalidTag", "The tag provided was not a valid tag."}
+	errBadTagging = &s3Error{http.StatusBadRequest, "InvalidArgument", "The header 'x-amz-tagging' shall be encoded as UTF-8 then URLEncoded URL query parameters without tag name duplicates."}
+)
+
+// parseTags parses tags in the form of the x-amz-tagging header,
+// e.g. "key1=value1&key2=value2"
+func parseTags(s string) ([]tag, error) {
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, errBadTagging
+	}
+	tags := make([]tag, 0, len(values))
+	for key, value := range values {
+		if len(value) != 1 {
+			return nil, errBadTagging
+		}
+		tags = append(tags, tag{Key: key, Value: value[0]})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Key < tags[j].Key
+	})
+	return tags, checkTags(tags)
+}
+
+// checkTags checks tags are within the S3 limits
+func checkTags(tags []tag) error {
+	if len(tags) > maxTags {
+		return &s3Error{http.StatusBadRequest, "BadRequest", "Object tags cannot be greater than 10"}
+	}
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		if t.Key == "" || len(t.Key) > maxTagKeyLength || len(t.Value) > maxTagValueLength || seen[t.Key] {
+			return errInvalidTag
+		}
+		seen[t.Key] = true
+	}
+	return nil
+}
+
+// formatTags formats tags in the form of the x-amz-tagging header
+func formatTags(tags []tag) string {
+	values := make(url.Values, len(tags))
+	for _, t := range tags {
+		values.Set(t.Key, t.Value)
+	}
+	return values.Encode()
+}
+
+// toMetadata converts the metadata gofakes3 gives us, which is
+// keyed on HTTP header names, into rclone metadata.
+//
+// User metadata "X-Amz-Meta-Key" is stored as "key", the Content-*
+// headers as their lower case names and the tags as
+// "x-amz-tagging". The "mtime" user metadata is left out as it is
+// stored as the modification time.
+func toMetadata(meta map[string]string) fs.Metadata {
+	m := make(fs.Metadata, len(meta))
+	for k, v := range meta {
+		k = http.CanonicalHeaderKey(k)
+		switch {
+		case strings.HasPrefix(k, metaPrefix):
+			key := strings.ToLower(k[len(metaPrefix):])
+			if key != "mtime" {
+				m[key] = v
+			}
+		case k == taggingHeader:
+			m[taggingMetadataKey] = v
+		case metadataHeaders[k]:
+			m[strings.ToLower(k)] = v
+		}
+	}
+	return m
+}
+
+// fromMetadata converts rclone metadata into HTTP headers to return
+// to the client. This is the reverse of toMetadata except that the
+// tags are returned as a count.
+//
+// The system metadata of the backend, apart from the headers, isn't
+// returned.
+func fromMetadata(m fs.Metadata, system map[string]fs.MetadataHelp) map[string]string {
+	meta := make(map[string]string, len(m))
+	for k, v := range m {
+		header := http.CanonicalHeaderKey(k)
+		switch {
+		case k == taggingMetadataKey:
+			if tags, err := parseTags(v); err == nil && len(tags) > 0 {
+				meta[taggingCountHeader] = strconv.Itoa(len(tags))
+			}
+		case metadataHeaders[header]:
+			meta[header] = v
+		default:
+			if _, isSystem := system[k]; !isSystem {
+				meta[http.CanonicalHeaderKey(metaPrefix+k)] = v
+			}
+		}
+	}
+	return meta
+}
+
+// metaModTime returns the modification time from the metadata if set
+func metaModTime(meta map[string]string) (t time.Time, ok bool) {
+	for _, key := range []string{"X-Amz-Meta-Mtime", "mtime"} {
+		if val, ok := meta[key]; ok {
+			t, err := swift.FloatStringToTime(val)
+			if err == nil {
+				return t, true
+			}
+		}
+	}
+	return t, false
+}
+
+// userMetadata returns true if the metadata of the object at fp
+// should be stored on the backend rather than in memory.
+//
+// Objects whose metadata can't be stored on the backend are written
+// through the VFS.
+func (b *s3Backend) userMetadata(fp string) bool {
+	return servemeta.CanStore(b.vfs.Fs(), fp)
+}
+
+// objectMeta returns the metadata of the object o at fp as HTTP headers
+func (b *s3Backend) objectMeta(fp string, o fs.Object) map[string]string {
+	meta := map[string]string{}
+	if val, ok := b.meta.Load(fp); ok {
+		for k, v := range val.(map[string]string) {
+			meta[k] = v
+		}
+		if tagging, ok := meta[taggingHeader]; ok {
+			delete(meta, taggingHeader)
+			if tags, err := parseTags(tagging); err == nil && len(tags) > 0 {
+				meta[taggingCountHeader] = strconv.Itoa(len(tags))
+			}
+		}
+	}
+	if b.userMetadata(fp) {
+		ctx := context.Background()
+		m, err := fs.GetMetadata(ctx, o)
+		if err != nil {
+			fs.Errorf(o, "Failed to read metadata: %v", err)
+		}
+		for k, v := range fromMetadata(m, servemeta.SystemMetadata(b.vfs.Fs())) {
+			meta[k] = v
+		}
+		// The mtime is stored as the modification time
+		meta["X-Amz-Meta-Mtime"] = swift.TimeToFloatString(o.ModTime(ctx))
+	}
+	return meta
+}
+
+// putWithMetadata uploads in to fp on the backend with the metadata
+// in meta, bypassing the VFS which can't store metadata.
+func (b *s3Backend) putWithMetadata(fp string, meta map[string]string, in io.Reader, size int64) error {
+	_, err := operations.RcatSize(servemeta.Context(context.Background()), b.vfs.Fs(), fp, io.NopCloser(in), size, modTime(meta), toMetadata(meta))
+	if err != nil {
+		return err
+	}
+	b.meta.Delete(fp)
+	b.forget(fp)
+	return nil
+}
+
+// rewrite uploads the object o at fp again with the metadata m
+func (b *s3Backend) rewrite(fp string, o fs.Object, m fs.Metadata, modTime time.Time) error {
+	err := servemeta.Rewrite(context.Background(), b.vfs.Fs(), o, m, modTime)
+	if err != nil {
+		return err
+	}
+	b.forget(fp)
+	return nil
+}
+
+// forget tells the VFS the object at fp has been changed on the backend
+func (b *s3Backend) forget(fp string) {
+	if root, err := b.vfs.Root(); err == nil {
+		root.ForgetPath(fp, fs.EntryObject)
+	}
+}
+
+// getTags returns the tags of the object
+func (b *s3Backend) getTags(bucket, objectName string) ([]tag, error) {
+	fp, o, err := b.getFsObject(bucket, objectName)
+	if err != nil {
+		return nil, err
+	}
+	var tagging string
+	if val, ok := b.meta.Load(fp); ok {
+		tagging = val.(map[string]string)[taggingHeader]
+	}
+	if b.userMetadata(fp) {
+		m, err := fs.GetMetadata(context.Background(), o)
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := m[taggingMetadataKey]; ok {
+			tagging = value
+		}
+	}
+	return parseTags(tagging)
+}
+
+// setTags replaces the tags of the object
+func (b *s3Backend) setTags(bucket, objectName string, tags []tag) error {
+	fp, o, err := b.getFsObject(bucket, objectName)
+	if err != nil {
+		return err
+	}
+	if !b.userMetadata(fp) {
+		meta := map[string]string{}
+		if val, ok := b.meta.Load(fp); ok {
+			for k, v := range val.(map[string]string) {
+				meta[k] = v
+			}
+		}
+		if len(tags) > 0 {
+			meta[taggingHeader] = formatTags(tags)
+		} else {
+			delete(meta, taggingHeader)
+		}
+		b.meta.Store(fp, meta)
+		return nil
+	}
+	m, err := fs.GetMetadata(context.Background(), o)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		m = fs.Metadata{}
+	}
+	// Removed tags are stored as empty rather than deleted as some
+	// backends, like local, keep metadata which isn't written.
+	if _, ok := m[taggingMetadataKey]; !ok && len(tags) == 0 {
+		return nil
+	}
+	m[taggingMetadataKey] = formatTags(tags)
+	return b.rewrite(fp, o, m, o.ModTime(context.Background()))
+}
+
+// replaceMetadata replaces the metadata of the object at fp with
+// meta, keeping its tags unless meta has some.
+//
+// The object is only uploaded again if the metadata has changed,
+// otherwise just the modification time is set.
+func (b *s3Backend) replaceMetadata(fp string, meta map[string]string) error {
+	ctx := context.Background()
+	node, err := b.vfs.Stat(fp)
+	if err != nil {
+		return err
+	}
+	o, ok := node.DirEntry().(fs.Object)
+	if !ok {
+		return gofakes3.KeyNotFound(fp)
+	}
+	old, err := fs.GetMetadata(ctx, o)
+	if err != nil {
+		return err
+	}
+	m := toMetadata(meta)
+	if _, ok := m[taggingMetadataKey]; !ok {
+		if tagging, ok := old[taggingMetadataKey]; ok {
+			m[taggingMetadataKey] = tagging
+		}
+	}
+	t, hasModTime := metaModTime(meta)
+	// Compare with the metadata toMetadata would have made
+	system := servemeta.SystemMetadata(b.vfs.Fs())
+	current := make(fs.Metadata, len(old))
+	for k, v := range old {
+		if _, isSystem := system[k]; !isSystem || metadataHeaders[http.CanonicalHeaderKey(k)] {
+			current[k] = v
+		}
+	}
+	if reflect.DeepEqual(current, m) {
+		if !hasModTime {
+			return nil
+		}
+		return b.vfs.Chtimes(fp, t, t)
+	}
+	if !hasModTime {
+		t = o.ModTime(ctx)
+	}
+	return b.rewrite(fp, o, m, t)
+}
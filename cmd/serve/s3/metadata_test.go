@@ -0,0 +1,163 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTags(t *testing.T) {
+	got, err := parseTags("b=2&a=1&c=")
+	require.NoError(t, err)
+	assert.Equal(t, []tag{{"a", "1"}, {"b", "2"}, {"c", ""}}, got)
+	assert.Equal(t, "a=1&b=2&c=", formatTags(got))
+
+	got, err = parseTags("")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	_, err = parseTags("a=1&a=2")
+	assert.Equal(t, errBadTagging, err)
+	_, err = parseTags("=1")
+	assert.Equal(t, errInvalidTag, err)
+	_, err = parseTags("a=1&b=2&c=3&d=4&e=5&f=6&g=7&h=8&i=9&j=10&k=11")
+	assert.Error(t, err)
+}
+
+func TestToFromMetadata(t *testing.T) {
+	meta := map[string]string{
+		"X-Amz-Meta-Colour": "red",
+		"X-Amz-Meta-Mtime":  "1234567890.5",
+		"Content-Type":      "text/plain",
+		"Cache-Control":     "no-cache",
+		"X-Amz-Tagging":     "a=1&b=2",
+		"X-Amz-Date":        "20200102T030405Z",
+		"Content-Length":    "5",
+	}
+	m := toMetadata(meta)
+	assert.Equal(t, fs.Metadata{
+		"colour":        "red",
+		"content-type":  "text/plain",
+		"cache-control": "no-cache",
+		"x-amz-tagging": "a=1&b=2",
+	}, m)
+
+	m["mtime"] = "2020-01-02T03:04:05Z"
+	system := map[string]fs.MetadataHelp{"mtime": {}, "content-type": {}}
+	assert.Equal(t, map[string]string{
+		"X-Amz-Meta-Colour":   "red",
+		"Content-Type":        "text/plain",
+		"Cache-Control":       "no-cache",
+		"X-Amz-Tagging-Count": "2",
+	}, fromMetadata(m, system))
+}
+
+// noMetadataFs hides the metadata support of an Fs
+type noMetadataFs struct {
+	fs.Fs
+	features *fs.Features
+}
+
+// Features returns the optional features of this Fs
+func (f *noMetadataFs) Features() *fs.Features {
+	return f.features
+}
+
+// newMetadataTest serves a directory containing a bucket, with or
+// without metadata support, returning the Fs and a client for it
+func newMetadataTest(t *testing.T, metadata bool) (fs.Fs, *minio.Client) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	if metadata && !f.Features().UserMetadata {
+		t.Skip("local backend can't store metadata here")
+	}
+	if !metadata {
+		features := *f.Features()
+		features.UserMetadata = false
+		f = &noMetadataFs{Fs: f, features: &features}
+	}
+	return f, newTestClient(t, f).Client
+}
+
+func testMetadata(t *testing.T, metadata bool) {
+	ctx := context.Background()
+	f, client := newMetadataTest(t, metadata)
+
+	_, err := client.PutObject(ctx, "bucket", "file.txt", strings.NewReader("hello"), 5, minio.PutObjectOptions{
+		ContentType:     "text/potato",
+		ContentLanguage: "en-GB",
+		UserMetadata:    map[string]string{"Colour": "red", "Mtime": "1234567890.5"},
+		UserTags:        map[string]string{"a": "1", "b": "2"},
+	})
+	require.NoError(t, err)
+
+	if metadata {
+		// Check it was stored on the backend
+		o, err := f.NewObject(ctx, "bucket/file.txt")
+		require.NoError(t, err)
+		m, err := fs.GetMetadata(ctx, o)
+		require.NoError(t, err)
+		assert.Equal(t, "red", m["colour"])
+		assert.Equal(t, "text/potato", m["content-type"])
+		assert.Equal(t, "en-GB", m["content-language"])
+		assert.Equal(t, "a=1&b=2", m["x-amz-tagging"])
+	}
+
+	checkObject := func(name string, wantTags map[string]string) {
+		info, err := client.StatObject(ctx, "bucket", name, minio.StatObjectOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "text/potato", info.ContentType)
+		assert.Equal(t, "red", info.UserMetadata["Colour"])
+		assert.Equal(t, "1234567890.5", info.UserMetadata["Mtime"])
+		assert.Equal(t, len(wantTags), info.UserTagCount)
+		gotTags, err := client.GetObjectTagging(ctx, "bucket", name, minio.GetObjectTaggingOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, wantTags, gotTags.ToMap())
+		obj, err := client.GetObject(ctx, "bucket", name, minio.GetObjectOptions{})
+		require.NoError(t, err)
+		data, err := io.ReadAll(obj)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+	}
+	checkObject("file.txt", map[string]string{"a": "1", "b": "2"})
+
+	// Copies keep the metadata and tags
+	_, err = client.CopyObject(ctx, minio.CopyDestOptions{Bucket: "bucket", Object: "copy.txt"}, minio.CopySrcOptions{Bucket: "bucket", Object: "file.txt"})
+	require.NoError(t, err)
+	checkObject("copy.txt", map[string]string{"a": "1", "b": "2"})
+
+	// Replace the tags
+	newTags, err := tags.NewTags(map[string]string{"c": "3"}, true)
+	require.NoError(t, err)
+	require.NoError(t, client.PutObjectTagging(ctx, "bucket", "file.txt", newTags, minio.PutObjectTaggingOptions{}))
+	checkObject("file.txt", map[string]string{"c": "3"})
+
+	// Remove the tags
+	require.NoError(t, client.RemoveObjectTagging(ctx, "bucket", "file.txt", minio.RemoveObjectTaggingOptions{}))
+	checkObject("file.txt", map[string]string{})
+
+	_, err = client.GetObjectTagging(ctx, "bucket", "potato.txt", minio.GetObjectTaggingOptions{})
+	assert.Equal(t, "NoSuchKey", minio.ToErrorResponse(err).Code)
+	_, err = client.GetBucketTagging(ctx, "bucket")
+	assert.Equal(t, "NotImplemented", minio.ToErrorResponse(err).Code)
+}
+
+func TestMetadata(t *testing.T) {
+	testMetadata(t, true)
+}
+
+func TestMetadataInMemory(t *testing.T) {
+	testMetadata(t, false)
+}
@@ -0,0 +1,720 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mikubill/gofakes3"
+	"github.com/rclone/rclone/cmd/serve/servemeta"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// Multipart uploads which haven't been completed or aborted in this
+// time are aborted
+const uploadExpiry = 24 * time.Hour
+
+// multipart handles the S3 multipart upload calls itself rather than
+// leaving them to gofakes3 which assembles the uploads in memory.
+//
+// If the backend supports OpenChunkWriter then each part is written
+// straight to the backend as it arrives, otherwise the parts are
+// spooled to disk and streamed into the VFS when the upload is
+// completed. Either way the parts are held on disk rather than in
+// memory.
+type multipart struct {
+	b       *s3Backend
+	mu      sync.Mutex
+	uploads map[string]*upload // uploads in progress by ID
+}
+
+// upload is a multipart upload in progress
+type upload struct {
+	id        string
+	bucket    string
+	object    string
+	meta      map[string]string
+	initiated time.Time
+	writer    fs.ChunkWriter // set if writing to the backend directly
+
+	mu      sync.Mutex
+	parts   map[int]*part       // uploaded parts by part number
+	writing map[int]*sync.Mutex // held while writing a part by part number
+}
+
+// part is an uploaded part of a multipart upload
+type part struct {
+	number   int
+	etag     string // quoted hex MD5 of the part
+	md5      []byte
+	size     int64
+	modified time.Time
+	spool    string // file the part is spooled to if not written to the backend
+}
+
+// newMultipart makes a multipart upload handler for b
+func newMultipart(b *s3Backend) *multipart {
+	return &multipart{
+		b:       b,
+		uploads: make(map[string]*upload),
+	}
+}
+
+var (
+	errNoSuchUpload      = &s3Error{http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist."}
+	errInvalidPart       = &s3Error{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found."}
+	errInvalidPartOrder  = &s3Error{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order."}
+	errBadDigest         = &s3Error{http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received."}
+	errInvalidDigest     = &s3Error{http.StatusBadRequest, "InvalidDigest", "The Content-MD5 you specified is not valid."}
+	errIncompleteBody    = &s3Error{http.StatusBadRequest, "IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header."}
+	errMissingLength     = &s3Error{http.StatusLengthRequired, "MissingContentLength", "You must provide the Content-Length HTTP header."}
+	errInvalidCopySource = &s3Error{http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey."}
+	errInvalidRange      = &s3Error{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable"}
+)
+
+// checkBucket returns an error if the bucket doesn't exist
+func (m *multipart) checkBucket(bucket string) error {
+	if _, err := m.b.vfs.Stat(bucket); err != nil {
+		return errNoSuchBucket
+	}
+	return nil
+}
+
+// get returns the upload with ID id for bucket and object
+func (m *multipart) get(bucket, object, id string) (*upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.uploads[id]
+	if u == nil || u.bucket != bucket || u.object != object {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+// remove removes the upload with ID id returning it
+func (m *multipart) remove(bucket, object, id string) (*upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.uploads[id]
+	if u == nil || u.bucket != bucket || u.object != object {
+		return nil, errNoSuchUpload
+	}
+	delete(m.uploads, id)
+	return u, nil
+}
+
+// expire aborts the uploads which have been going too long
+func (m *multipart) expire(now time.Time) {
+	m.mu.Lock()
+	var expired []*upload
+	for id, u := range m.uploads {
+		if now.Sub(u.initiated) > uploadExpiry {
+			expired = append(expired, u)
+			delete(m.uploads, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, u := range expired {
+		fs.Logf("serve s3", "Aborting multipart upload of %q as it was started more than %v ago", path.Join(u.bucket, u.object), uploadExpiry)
+		u.abort(context.Background())
+	}
+}
+
+// metadata returns the metadata to store with the object from the headers
+func metadata(header http.Header) map[string]string {
+	meta := make(map[string]string)
+	for k, v := range header {
+		k = http.CanonicalHeaderKey(k)
+		if strings.HasPrefix(k, metaPrefix) || metadataHeaders[k] || k == taggingHeader || k == "Expires" {
+			meta[k] = v[0]
+		}
+	}
+	return meta
+}
+
+// modTime returns the modification time from the metadata or now if not set
+func modTime(meta map[string]string) time.Time {
+	if t, ok := metaModTime(meta); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// create starts a multipart upload - CreateMultipartUpload
+func (m *multipart) create(w http.ResponseWriter, r *http.Request, bucket, objectName string) error {
+	if err := m.checkBucket(bucket); err != nil {
+		return err
+	}
+	m.expire(time.Now())
+	u := &upload{
+		id:        random.String(32),
+		bucket:    bucket,
+		object:    objectName,
+		meta:      metadata(r.Header),
+		initiated: time.Now(),
+		parts:     make(map[int]*part),
+		writing:   make(map[int]*sync.Mutex),
+	}
+	f := m.b.vfs.Fs()
+	if openChunkWriter := f.Features().OpenChunkWriter; openChunkWriter != nil {
+		remote := path.Join(bucket, objectName)
+		src := object.NewStaticObjectInfo(remote, modTime(u.meta), -1, true, nil, f)
+		ctx := context.Background()
+		var options []fs.OpenOption
+		if m.b.userMetadata(remote) {
+			ctx = servemeta.Context(ctx)
+			src = src.WithMetadata(toMetadata(u.meta))
+		} else {
+			for key := range metadataHeaders {
+				if value, ok := u.meta[key]; ok {
+					options = append(options, &fs.HTTPOption{Key: key, Value: value})
+				}
+			}
+		}
+		_, writer, err := openChunkWriter(ctx, remote, src, options...)
+		if err != nil {
+			return fmt.Errorf("failed to start multipart upload: %w", err)
+		}
+		u.writer = writer
+	}
+	m.mu.Lock()
+	m.uploads[u.id] = u
+	m.mu.Unlock()
+	fs.Debugf("serve s3", "Started multipart upload %q of %q", u.id, path.Join(bucket, objectName))
+	return writeXML(w, &struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadID string `xml:"UploadId"`
+	}{Bucket: bucket, Key: objectName, UploadID: u.id})
+}
+
+// uploadPart receives a part of a multipart upload - UploadPart and
+// UploadPartCopy
+func (m *multipart) uploadPart(w http.ResponseWriter, r *http.Request, bucket, object, uploadID string) (err error) {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > gofakes3.MaxUploadPartNumber {
+		return errInvalidPart
+	}
+	u, err := m.get(bucket, object, uploadID)
+	if err != nil {
+		return err
+	}
+
+	// Work out where the part comes from, how big it is and decode
+	// it if necessary
+	var (
+		in      io.Reader = r.Body
+		size              = r.ContentLength
+		wantMD5 []byte
+	)
+	copySource := r.Header.Get("X-Amz-Copy-Source")
+	if copySource != "" {
+		var src *gofakes3.Object
+		src, err = m.openCopySource(copySource, r.Header.Get("X-Amz-Copy-Source-Range"))
+		if err != nil {
+			return err
+		}
+		defer fs.CheckClose(src.Contents, &err)
+		in, size = src.Contents, src.Size
+		if src.Range != nil {
+			size = src.Range.Length
+		}
+	} else if r.Header.Get("X-Amz-Content-Sha256") == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		in = newChunkedReader(r.Body)
+		size, err = strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil {
+			return errMissingLength
+		}
+	}
+	if size < 0 {
+		return errMissingLength
+	}
+	if md5Base64, ok := r.Header["Content-Md5"]; ok && copySource == "" {
+		wantMD5, err = base64.StdEncoding.DecodeString(md5Base64[0])
+		if err != nil || len(wantMD5) != md5.Size {
+			return errInvalidDigest
+		}
+	}
+
+	// Spool the part to disk
+	p, spool, err := spoolPart(in, size)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if spool != nil {
+			_ = spool.Close()
+			if p.spool == "" {
+				_ = os.Remove(spool.Name())
+			}
+		}
+	}()
+	if wantMD5 != nil && string(wantMD5) != string(p.md5) {
+		return errBadDigest
+	}
+	p.number = partNumber
+
+	// Parts may be uploaded again to replace them so only write
+	// one copy of a part at once to keep the part recorded the same
+	// as the part written
+	unlock := u.lockPart(partNumber)
+	defer unlock()
+	if u.writer != nil {
+		// Write the part to the backend now
+		_, err = u.writer.WriteChunk(r.Context(), partNumber-1, spool)
+		if err != nil {
+			return fmt.Errorf("failed to write part %d: %w", partNumber, err)
+		}
+	} else {
+		// Keep the spooled part until the upload is complete
+		p.spool = spool.Name()
+	}
+
+	u.mu.Lock()
+	old := u.parts[partNumber]
+	u.parts[partNumber] = p
+	u.mu.Unlock()
+	if old != nil && old.spool != "" {
+		_ = os.Remove(old.spool)
+	}
+	if copySource != "" {
+		return writeXML(w, struct {
+			XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyPartResult"`
+			LastModified string
+			ETag         string
+		}{LastModified: p.modified.UTC().Format(time.RFC3339), ETag: p.etag})
+	}
+	w.Header().Set("ETag", p.etag)
+	return nil
+}
+
+// lockPart stops any other uploads of part number n until the
+// returned function is called
+func (u *upload) lockPart(n int) (unlock func()) {
+	u.mu.Lock()
+	mu := u.writing[n]
+	if mu == nil {
+		mu = new(sync.Mutex)
+		u.writing[n] = mu
+	}
+	u.mu.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// openCopySource opens the object named in the X-Amz-Copy-Source
+// header, reading only the range in X-Amz-Copy-Source-Range if set
+func (m *multipart) openCopySource(source, sourceRange string) (*gofakes3.Object, error) {
+	source, _, _ = strings.Cut(source, "?") // no support for versionId
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		return nil, errInvalidCopySource
+	}
+	srcBucket, srcKey, ok := strings.Cut(source, "/")
+	if !ok || srcBucket == "" || srcKey == "" {
+		return nil, errInvalidCopySource
+	}
+	var rangeRequest *gofakes3.ObjectRangeRequest
+	if sourceRange != "" {
+		// Only "bytes=first-last" is valid here
+		var first, last int64
+		_, err := fmt.Sscanf(sourceRange, "bytes=%d-%d", &first, &last)
+		if err != nil || first < 0 || last < first {
+			return nil, errInvalidRange
+		}
+		rangeRequest = &gofakes3.ObjectRangeRequest{Start: first, End: last}
+	}
+	obj, err := m.b.GetObject(srcBucket, srcKey, rangeRequest)
+	if gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchBucket) {
+		return nil, errNoSuchBucket
+	} else if gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		return nil, errNoSuchKey
+	} else if err != nil {
+		return nil, err
+	}
+	if rangeRequest != nil && rangeRequest.End >= obj.Size {
+		_ = obj.Contents.Close()
+		return nil, errInvalidRange
+	}
+	return obj, nil
+}
+
+// spoolPart reads size bytes of in into a temporary file returning
+// the part and the file positioned at the start
+func spoolPart(in io.Reader, size int64) (p *part, spool *os.File, err error) {
+	spool, err = os.CreateTemp("", "rclone-serve-s3-part-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = spool.Close()
+			_ = os.Remove(spool.Name())
+			spool = nil
+		}
+	}()
+	hasher := md5.New()
+	n, err := io.Copy(io.MultiWriter(spool, hasher), io.LimitReader(in, size))
+	if err != nil {
+		return nil, nil, err
+	}
+	if n != size {
+		return nil, nil, errIncompleteBody
+	}
+	_, err = spool.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := hasher.Sum(nil)
+	p = &part{
+		etag:     `"` + hex.EncodeToString(sum) + `"`,
+		md5:      sum,
+		size:     size,
+		modified: time.Now(),
+	}
+	return p, spool, nil
+}
+
+// completeRequest is the body of CompleteMultipartUpload
+type completeRequest struct {
+	Parts []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+// complete finishes a multipart upload - CompleteMultipartUpload
+func (m *multipart) complete(w http.ResponseWriter, r *http.Request, bucket, object, uploadID string) (err error) {
+	var req completeRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Parts) == 0 {
+		return errMalformedXML
+	}
+	u, err := m.get(bucket, object, uploadID)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	parts, err := u.check(&req)
+	u.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	u, err = m.remove(bucket, object, uploadID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			u.abort(context.Background())
+		}
+	}()
+
+	fp := path.Join(bucket, object)
+	if u.writer != nil {
+		err = u.writer.Close(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to complete multipart upload: %w", err)
+		}
+		u.writer = nil
+		// Let the VFS know the object has changed
+		m.b.forget(fp)
+		if m.b.userMetadata(fp) {
+			m.b.meta.Delete(fp)
+		} else {
+			m.b.meta.Store(fp, u.meta)
+		}
+	} else {
+		err = u.assemble(m.b, parts)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The ETag of a multipart upload is the MD5 of the MD5s of the parts
+	hasher := md5.New()
+	for _, p := range parts {
+		_, _ = hasher.Write(p.md5)
+	}
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(hasher.Sum(nil)), len(parts))
+	fs.Debugf("serve s3", "Completed multipart upload %q of %q with %d parts", u.id, fp, len(parts))
+	return writeXML(w, &struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}{Location: "/" + fp, Bucket: bucket, Key: object, ETag: etag})
+}
+
+// check the parts in req match the parts uploaded returning them in order
+//
+// Call with u.mu held
+func (u *upload) check(req *completeRequest) (parts []*part, err error) {
+	last := 0
+	for _, reqPart := range req.Parts {
+		if reqPart.PartNumber <= last {
+			return nil, errInvalidPartOrder
+		}
+		last = reqPart.PartNumber
+		p := u.parts[reqPart.PartNumber]
+		if p == nil || strings.Trim(reqPart.ETag, `"`) != strings.Trim(p.etag, `"`) {
+			return nil, errInvalidPart
+		}
+		parts = append(parts, p)
+	}
+	// The backend will use all the parts which have been written so
+	// they must all be used and numbered consecutively
+	if u.writer != nil {
+		if len(parts) != len(u.parts) {
+			return nil, &s3Error{http.StatusBadRequest, "InvalidPart", "All the uploaded parts must be used to complete the upload."}
+		}
+		for i, p := range parts {
+			if p.number != i+1 {
+				return nil, &s3Error{http.StatusBadRequest, "InvalidPart", "The parts must be numbered consecutively from 1."}
+			}
+		}
+	}
+	return parts, nil
+}
+
+// assemble streams the spooled parts into the VFS
+func (u *upload) assemble(b *s3Backend, parts []*part) (err error) {
+	var size int64
+	for _, p := range parts {
+		size += p.size
+	}
+	in := &partsReader{parts: parts}
+	defer fs.CheckClose(in, &err)
+	_, err = b.PutObject(u.bucket, u.object, u.meta, in, size)
+	if err != nil {
+		return fmt.Errorf("failed to write multipart upload: %w", err)
+	}
+	u.removeSpools()
+	return nil
+}
+
+// partsReader reads the spooled parts one after the other, only
+// opening one at once
+type partsReader struct {
+	parts []*part
+	f     *os.File // the part being read
+}
+
+// Read implements io.Reader
+func (pr *partsReader) Read(p []byte) (n int, err error) {
+	for {
+		if pr.f == nil {
+			if len(pr.parts) == 0 {
+				return 0, io.EOF
+			}
+			pr.f, err = os.Open(pr.parts[0].spool)
+			if err != nil {
+				return 0, err
+			}
+			pr.parts = pr.parts[1:]
+		}
+		n, err = pr.f.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		err = pr.f.Close()
+		pr.f = nil
+		if err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close closes the part being read if any
+func (pr *partsReader) Close() error {
+	if pr.f == nil {
+		return nil
+	}
+	err := pr.f.Close()
+	pr.f = nil
+	return err
+}
+
+// removeSpools removes any spooled parts
+func (u *upload) removeSpools() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, p := range u.parts {
+		if p.spool != "" {
+			_ = os.Remove(p.spool)
+			p.spool = ""
+		}
+	}
+}
+
+// abort cancels the upload removing any parts
+func (u *upload) abort(ctx context.Context) {
+	if u.writer != nil {
+		err := u.writer.Abort(ctx)
+		if err != nil {
+			fs.Errorf("serve s3", "Failed to abort multipart upload of %q: %v", path.Join(u.bucket, u.object), err)
+		}
+		u.writer = nil
+	}
+	u.removeSpools()
+}
+
+// abort cancels a multipart upload - AbortMultipartUpload
+func (m *multipart) abort(w http.ResponseWriter, r *http.Request, bucket, object, uploadID string) error {
+	u, err := m.remove(bucket, object, uploadID)
+	if err != nil {
+		return err
+	}
+	u.abort(context.Background())
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// listParts lists the parts uploaded so far - ListParts
+func (m *multipart) listParts(w http.ResponseWriter, r *http.Request, bucket, object, uploadID string) error {
+	u, err := m.get(bucket, object, uploadID)
+	if err != nil {
+		return err
+	}
+	type partXML struct {
+		PartNumber   int
+		LastModified string
+		ETag         string
+		Size         int64
+	}
+	out := struct {
+		XMLName     xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListPartsResult"`
+		Bucket      string
+		Key         string
+		UploadID    string `xml:"UploadId"`
+		IsTruncated bool
+		Parts       []partXML `xml:"Part"`
+	}{Bucket: bucket, Key: object, UploadID: uploadID}
+	u.mu.Lock()
+	for _, p := range u.parts {
+		out.Parts = append(out.Parts, partXML{
+			PartNumber:   p.number,
+			LastModified: p.modified.UTC().Format(time.RFC3339),
+			ETag:         p.etag,
+			Size:         p.size,
+		})
+	}
+	u.mu.Unlock()
+	sort.Slice(out.Parts, func(i, j int) bool {
+		return out.Parts[i].PartNumber < out.Parts[j].PartNumber
+	})
+	return writeXML(w, &out)
+}
+
+// list lists the uploads in progress in bucket - ListMultipartUploads
+func (m *multipart) list(w http.ResponseWriter, r *http.Request, bucket string) error {
+	if err := m.checkBucket(bucket); err != nil {
+		return err
+	}
+	prefix := r.URL.Query().Get("prefix")
+	type uploadXML struct {
+		Key       string
+		UploadID  string `xml:"UploadId"`
+		Initiated string
+	}
+	out := struct {
+		XMLName     xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListMultipartUploadsResult"`
+		Bucket      string
+		Prefix      string
+		IsTruncated bool
+		Uploads     []uploadXML `xml:"Upload"`
+	}{Bucket: bucket, Prefix: prefix}
+	m.mu.Lock()
+	for _, u := range m.uploads {
+		if u.bucket == bucket && strings.HasPrefix(u.object, prefix) {
+			out.Uploads = append(out.Uploads, uploadXML{
+				Key:       u.object,
+				UploadID:  u.id,
+				Initiated: u.initiated.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(out.Uploads, func(i, j int) bool {
+		if out.Uploads[i].Key != out.Uploads[j].Key {
+			return out.Uploads[i].Key < out.Uploads[j].Key
+		}
+		return out.Uploads[i].Initiated < out.Uploads[j].Initiated
+	})
+	return writeXML(w, &out)
+}
+
+// chunkedReader decodes a body sent with aws-chunked encoding
+//
+// Each chunk looks like
+//
+//	<hex size>;chunk-signature=<signature>\r\n<data>\r\n
+//
+// finishing with a chunk of size 0.
+type chunkedReader struct {
+	in     *bufio.Reader
+	remain int64 // bytes left in this chunk
+	done   bool
+	first  bool
+}
+
+func newChunkedReader(in io.Reader) *chunkedReader {
+	return &chunkedReader{in: bufio.NewReader(in), first: true}
+}
+
+// Read implements io.Reader
+func (c *chunkedReader) Read(p []byte) (n int, err error) {
+	for c.remain == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if !c.first {
+			// Skip the \r\n after the last chunk
+			if _, err = c.in.Discard(2); err != nil {
+				return 0, err
+			}
+		}
+		c.first = false
+		line, err := c.in.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		c.remain, err = strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil || c.remain < 0 {
+			return 0, fmt.Errorf("bad chunk header %q", line)
+		}
+		if c.remain == 0 {
+			c.done = true
+		}
+	}
+	if int64(len(p)) > c.remain {
+		p = p[:c.remain]
+	}
+	n, err = c.in.Read(p)
+	c.remain -= int64(n)
+	if err == io.EOF && c.remain != 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
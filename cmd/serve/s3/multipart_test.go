@@ -0,0 +1,306 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/ncw/swift/v2"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkFs adds OpenChunkWriter to an Fs so the uploads can be
+// checked to go through it
+type chunkFs struct {
+	fs.Fs
+	features *fs.Features
+
+	mu      sync.Mutex
+	chunks  int // number of chunks written
+	aborted int // number of uploads aborted
+}
+
+func newChunkFs(f fs.Fs) *chunkFs {
+	cf := &chunkFs{Fs: f}
+	features := *f.Features()
+	features.OpenChunkWriter = cf.openChunkWriter
+	cf.features = &features
+	return cf
+}
+
+// Features returns the optional features of this Fs
+func (f *chunkFs) Features() *fs.Features {
+	return f.features
+}
+
+func (f *chunkFs) openChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	meta, err := fs.GetMetadataOptions(ctx, f, src, options)
+	if err != nil {
+		return info, nil, err
+	}
+	return info, &testChunkWriter{f: f, remote: remote, src: src, meta: meta, chunks: map[int][]byte{}}, nil
+}
+
+// testChunkWriter writes the chunks to the Fs when closed
+type testChunkWriter struct {
+	f      *chunkFs
+	remote string
+	src    fs.ObjectInfo
+	meta   fs.Metadata
+	mu     sync.Mutex
+	chunks map[int][]byte
+}
+
+func (w *testChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (int64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, err
+	}
+	w.mu.Lock()
+	w.chunks[chunkNumber] = data
+	w.mu.Unlock()
+	w.f.mu.Lock()
+	w.f.chunks++
+	w.f.mu.Unlock()
+	return int64(len(data)), nil
+}
+
+func (w *testChunkWriter) Close(ctx context.Context) error {
+	var numbers []int
+	for n := range w.chunks {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	var buf bytes.Buffer
+	for _, n := range numbers {
+		buf.Write(w.chunks[n])
+	}
+	src := object.NewStaticObjectInfo(w.remote, w.src.ModTime(ctx), int64(buf.Len()), true, nil, nil)
+	if w.meta != nil {
+		var ci *fs.ConfigInfo
+		ctx, ci = fs.AddConfig(ctx)
+		ci.Metadata = true
+		src = src.WithMetadata(w.meta)
+	}
+	_, err := w.f.Fs.Put(ctx, &buf, src)
+	return err
+}
+
+func (w *testChunkWriter) Abort(ctx context.Context) error {
+	w.f.mu.Lock()
+	w.f.aborted++
+	w.f.mu.Unlock()
+	return nil
+}
+
+// newTestClient serves f returning a client for it
+func newTestClient(t *testing.T, f fs.Fs) *minio.Core {
+	endpoint, keyid, keysec := serveS3(f)
+	testURL, err := url.Parse(endpoint)
+	require.NoError(t, err)
+	client, err := minio.NewCore(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+	return client
+}
+
+// newMultipartTest makes a serve s3 serving dir, optionally with an
+// OpenChunkWriter, returning a client for it
+func newMultipartTest(t *testing.T, withChunkWriter bool) (dir string, cf *chunkFs, client *minio.Core) {
+	// Put the spooled parts somewhere we can check
+	t.Setenv("TMPDIR", t.TempDir())
+	dir = t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bucket"), 0777))
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	if withChunkWriter {
+		cf = newChunkFs(f)
+		f = cf
+	}
+	client = newTestClient(t, f)
+	return dir, cf, client
+}
+
+// checkNoSpools checks there are no spooled parts left
+func checkNoSpools(t *testing.T) {
+	spools, err := filepath.Glob(filepath.Join(os.TempDir(), "rclone-serve-s3-part-*"))
+	require.NoError(t, err)
+	assert.Empty(t, spools)
+}
+
+func testMultipartPutObject(t *testing.T, withChunkWriter bool) {
+	ctx := context.Background()
+	dir, cf, client := newMultipartTest(t, withChunkWriter)
+	data := []byte(random.String(12 * 1024 * 1024))
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	_, err := client.Client.PutObject(ctx, "bucket", "dir/file.bin", bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		PartSize:     5 * 1024 * 1024,
+		ContentType:  "application/potato",
+		UserMetadata: map[string]string{"mtime": swift.TimeToFloatString(modTime)},
+	})
+	require.NoError(t, err)
+
+	got, err := os.ReadFile(filepath.Join(dir, "bucket", "dir", "file.bin"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got), "contents differ")
+	fi, err := os.Stat(filepath.Join(dir, "bucket", "dir", "file.bin"))
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(fi.ModTime()), "modtime %v", fi.ModTime())
+
+	info, err := client.Client.StatObject(ctx, "bucket", "dir/file.bin", minio.StatObjectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), info.Size)
+	assert.Equal(t, "application/potato", info.ContentType)
+
+	if withChunkWriter {
+		assert.Equal(t, 3, cf.chunks)
+	}
+	checkNoSpools(t)
+}
+
+func TestMultipartPutObject(t *testing.T) {
+	testMultipartPutObject(t, false)
+}
+
+func TestMultipartPutObjectChunkWriter(t *testing.T) {
+	testMultipartPutObject(t, true)
+}
+
+func testMultipartCalls(t *testing.T, withChunkWriter bool) {
+	ctx := context.Background()
+	dir, cf, client := newMultipartTest(t, withChunkWriter)
+	part1 := []byte(random.String(5 * 1024 * 1024))
+	part2 := []byte("the end")
+
+	_, err := client.NewMultipartUpload(ctx, "nobucket", "file", minio.PutObjectOptions{})
+	assert.Equal(t, "NoSuchBucket", minio.ToErrorResponse(err).Code)
+
+	uploadID, err := client.NewMultipartUpload(ctx, "bucket", "file", minio.PutObjectOptions{})
+	require.NoError(t, err)
+	p1, err := client.PutObjectPart(ctx, "bucket", "file", uploadID, 1, bytes.NewReader(part1), int64(len(part1)), minio.PutObjectPartOptions{})
+	require.NoError(t, err)
+	// Parts can be uploaded again to replace them
+	_, err = client.PutObjectPart(ctx, "bucket", "file", uploadID, 2, strings.NewReader("replaced"), 8, minio.PutObjectPartOptions{})
+	require.NoError(t, err)
+	p2, err := client.PutObjectPart(ctx, "bucket", "file", uploadID, 2, bytes.NewReader(part2), int64(len(part2)), minio.PutObjectPartOptions{})
+	require.NoError(t, err)
+
+	_, err = client.PutObjectPart(ctx, "bucket", "file", "potato", 1, bytes.NewReader(part2), int64(len(part2)), minio.PutObjectPartOptions{})
+	assert.Equal(t, "NoSuchUpload", minio.ToErrorResponse(err).Code)
+
+	parts, err := client.ListObjectParts(ctx, "bucket", "file", uploadID, 0, 1000)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(parts.ObjectParts))
+	assert.Equal(t, 1, parts.ObjectParts[0].PartNumber)
+	assert.Equal(t, int64(len(part1)), parts.ObjectParts[0].Size)
+	assert.Equal(t, p2.ETag, strings.Trim(parts.ObjectParts[1].ETag, `"`))
+
+	uploads, err := client.ListMultipartUploads(ctx, "bucket", "", "", "", "", 1000)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(uploads.Uploads))
+	assert.Equal(t, "file", uploads.Uploads[0].Key)
+	assert.Equal(t, uploadID, uploads.Uploads[0].UploadID)
+
+	// Wrong ETag
+	_, err = client.CompleteMultipartUpload(ctx, "bucket", "file", uploadID, []minio.CompletePart{
+		{PartNumber: 1, ETag: p2.ETag},
+		{PartNumber: 2, ETag: p2.ETag},
+	}, minio.PutObjectOptions{})
+	assert.Equal(t, "InvalidPart", minio.ToErrorResponse(err).Code)
+
+	if withChunkWriter {
+		// Must use all the parts written to the backend
+		_, err = client.CompleteMultipartUpload(ctx, "bucket", "file", uploadID, []minio.CompletePart{
+			{PartNumber: 1, ETag: p1.ETag},
+		}, minio.PutObjectOptions{})
+		assert.Equal(t, "InvalidPart", minio.ToErrorResponse(err).Code)
+	}
+
+	res, err := client.CompleteMultipartUpload(ctx, "bucket", "file", uploadID, []minio.CompletePart{
+		{PartNumber: 1, ETag: p1.ETag},
+		{PartNumber: 2, ETag: p2.ETag},
+	}, minio.PutObjectOptions{})
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res.ETag, "-2"), res.ETag)
+
+	got, err := os.ReadFile(filepath.Join(dir, "bucket", "file"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(append(part1, part2...), got), "contents differ")
+
+	// The upload has gone now
+	_, err = client.ListObjectParts(ctx, "bucket", "file", uploadID, 0, 1000)
+	assert.Equal(t, "NoSuchUpload", minio.ToErrorResponse(err).Code)
+
+	// Copy the object in two parts
+	uploadID, err = client.NewMultipartUpload(ctx, "bucket", "copy", minio.PutObjectOptions{})
+	require.NoError(t, err)
+	c1, err := client.CopyObjectPart(ctx, "bucket", "file", "bucket", "copy", uploadID, 1, 0, int64(len(part1)), nil)
+	require.NoError(t, err)
+	assert.Equal(t, p1.ETag, strings.Trim(c1.ETag, `"`))
+	c2, err := client.CopyObjectPart(ctx, "bucket", "file", "bucket", "copy", uploadID, 2, int64(len(part1)), int64(len(part2)), nil)
+	require.NoError(t, err)
+	assert.Equal(t, p2.ETag, strings.Trim(c2.ETag, `"`))
+	_, err = client.CopyObjectPart(ctx, "bucket", "file", "bucket", "copy", uploadID, 3, int64(len(part1)), int64(len(part1)), nil)
+	assert.Equal(t, "InvalidRange", minio.ToErrorResponse(err).Code)
+	_, err = client.CopyObjectPart(ctx, "bucket", "potato", "bucket", "copy", uploadID, 3, 0, 1, nil)
+	assert.Equal(t, "NoSuchKey", minio.ToErrorResponse(err).Code)
+	_, err = client.CompleteMultipartUpload(ctx, "bucket", "copy", uploadID, []minio.CompletePart{c1, c2}, minio.PutObjectOptions{})
+	require.NoError(t, err)
+	got, err = os.ReadFile(filepath.Join(dir, "bucket", "copy"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(append(part1, part2...), got), "contents differ")
+
+	// Abort an upload
+	uploadID, err = client.NewMultipartUpload(ctx, "bucket", "aborted", minio.PutObjectOptions{})
+	require.NoError(t, err)
+	_, err = client.PutObjectPart(ctx, "bucket", "aborted", uploadID, 1, bytes.NewReader(part2), int64(len(part2)), minio.PutObjectPartOptions{})
+	require.NoError(t, err)
+	require.NoError(t, client.AbortMultipartUpload(ctx, "bucket", "aborted", uploadID))
+	err = client.AbortMultipartUpload(ctx, "bucket", "aborted", uploadID)
+	assert.Equal(t, "NoSuchUpload", minio.ToErrorResponse(err).Code)
+	_, err = os.Stat(filepath.Join(dir, "bucket", "aborted"))
+	assert.True(t, os.IsNotExist(err))
+	if withChunkWriter {
+		assert.Equal(t, 1, cf.aborted)
+	}
+
+	checkNoSpools(t)
+}
+
+func TestMultipartCalls(t *testing.T) {
+	testMultipartCalls(t, false)
+}
+
+func TestMultipartCallsChunkWriter(t *testing.T) {
+	testMultipartCalls(t, true)
+}
+
+func TestChunkedReader(t *testing.T) {
+	in := "5;chunk-signature=0123\r\nhello\r\n6;chunk-signature=4567\r\n world\r\n0;chunk-signature=89ab\r\n\r\n"
+	got, err := io.ReadAll(newChunkedReader(strings.NewReader(in)))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(got))
+
+	_, err = io.ReadAll(newChunkedReader(strings.NewReader("5;chunk-signature=0123\r\nhel")))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = io.ReadAll(newChunkedReader(strings.NewReader("potato\r\n")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Mikubill/gofakes3"
+	"github.com/Mikubill/gofakes3/signature"
+	"github.com/rclone/rclone/fs"
+)
+
+// router handles the S3 calls which gofakes3 doesn't do, or doesn't
+// do well enough, itself passing the others on to gofakes3.
+type router struct {
+	hostBucket bool // get the bucket from the host name
+	checkAuth  bool // check the requests are signed
+	b          *s3Backend
+	multipart  *multipart
+	tagging    *tagging
+	next       http.Handler
+}
+
+// newRouter makes a router for b which passes the calls it doesn't
+// handle on to next
+func newRouter(b *s3Backend, opt *Options, checkAuth bool, next http.Handler) *router {
+	return &router{
+		hostBucket: !opt.pathBucketMode,
+		checkAuth:  checkAuth,
+		b:          b,
+		multipart:  newMultipart(b),
+		tagging:    &tagging{b: b},
+		next:       next,
+	}
+}
+
+// s3Error is an error to return to the client
+type s3Error struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *s3Error) Error() string {
+	return e.code + ": " + e.message
+}
+
+var (
+	errNoSuchBucket   = &s3Error{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist."}
+	errNoSuchKey      = &s3Error{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	errMalformedXML   = &s3Error{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema."}
+	errAccessDenied   = &s3Error{http.StatusForbidden, "AccessDenied", "Access Denied"}
+	errNotImplemented = &s3Error{http.StatusNotImplemented, "NotImplemented", "A header you provided implies functionality that is not implemented."}
+)
+
+// ServeHTTP handles the calls the router knows about passing the
+// others on to next
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	_, isUploads := query["uploads"]
+	_, isTagging := query["tagging"]
+	uploadID := query.Get("uploadId")
+	versionID := query.Get("versionId")
+	// gofakes3 returns the current version for HEAD with a version
+	isHeadVersion := r.Method == http.MethodHead && versionID != "" && versionID != "null"
+	if !isUploads && !isTagging && uploadID == "" && !isHeadVersion {
+		rt.next.ServeHTTP(w, r)
+		return
+	}
+	if rt.checkAuth && signature.V4SignVerify(r) != signature.ErrNone {
+		fs.Infof("serve s3", "Access Denied: %s => %s", r.RemoteAddr, r.URL)
+		rt.writeError(w, r, errAccessDenied)
+		return
+	}
+	m, t := rt.multipart, rt.tagging
+	bucket, object := rt.split(r)
+	var err error
+	switch {
+	case isUploads && r.Method == http.MethodPost && object != "":
+		err = m.create(w, r, bucket, object)
+	case isUploads && r.Method == http.MethodGet && object == "":
+		err = m.list(w, r, bucket)
+	case uploadID != "" && r.Method == http.MethodPut:
+		err = m.uploadPart(w, r, bucket, object, uploadID)
+	case uploadID != "" && r.Method == http.MethodPost:
+		err = m.complete(w, r, bucket, object, uploadID)
+	case uploadID != "" && r.Method == http.MethodDelete:
+		err = m.abort(w, r, bucket, object, uploadID)
+	case uploadID != "" && r.Method == http.MethodGet:
+		err = m.listParts(w, r, bucket, object, uploadID)
+	case isHeadVersion && object != "":
+		err = rt.headVersion(w, bucket, object, gofakes3.VersionID(versionID))
+	case isTagging && object == "":
+		// No bucket tagging
+		err = errNotImplemented
+	case isTagging && r.Method == http.MethodGet:
+		err = t.get(w, r, bucket, object)
+	case isTagging && r.Method == http.MethodPut:
+		err = t.put(w, r, bucket, object)
+	case isTagging && r.Method == http.MethodDelete:
+		err = t.delete(w, r, bucket, object)
+	default:
+		rt.next.ServeHTTP(w, r)
+		return
+	}
+	if err != nil {
+		rt.writeError(w, r, err)
+	}
+}
+
+// split returns the bucket and object the request is for
+func (rt *router) split(r *http.Request) (bucket, object string) {
+	p := strings.Trim(r.URL.Path, "/")
+	if rt.hostBucket {
+		bucket, _, _ = strings.Cut(r.Host, ".")
+		return bucket, p
+	}
+	bucket, object, _ = strings.Cut(p, "/")
+	return bucket, object
+}
+
+// writeError writes err as an S3 error response
+func (rt *router) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		s3Err   *s3Error
+		fakeErr gofakes3.Error
+	)
+	if errors.As(err, &fakeErr) && fakeErr.ErrorCode() != gofakes3.ErrInternal {
+		code := fakeErr.ErrorCode()
+		s3Err = &s3Error{code.Status(), string(code), code.Message()}
+	} else if !errors.As(err, &s3Err) {
+		fs.Errorf("serve s3", "%s %s failed: %v", r.Method, r.URL, err)
+		s3Err = &s3Error{http.StatusInternalServerError, "InternalError", "We encountered an internal error, please try again."}
+	}
+	writeError(w, r, s3Err.status, s3Err.code, s3Err.message)
+}
+
+// writeXML writes v as the XML response
+func writeXML(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", "application/xml")
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
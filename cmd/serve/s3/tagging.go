@@ -0,0 +1,46 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+// tagging handles the object tagging calls which gofakes3 doesn't
+// support. The tags are stored in the metadata of the object.
+type tagging struct {
+	b *s3Backend
+}
+
+// get returns the tags of an object - GetObjectTagging
+func (t *tagging) get(w http.ResponseWriter, r *http.Request, bucket, object string) error {
+	tags, err := t.b.getTags(bucket, object)
+	if err != nil {
+		return err
+	}
+	return writeXML(w, &tagSet{
+		Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/",
+		Tags:  tags,
+	})
+}
+
+// put replaces the tags of an object - PutObjectTagging
+func (t *tagging) put(w http.ResponseWriter, r *http.Request, bucket, object string) error {
+	var req tagSet
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return errMalformedXML
+	}
+	if err := checkTags(req.Tags); err != nil {
+		return err
+	}
+	return t.b.setTags(bucket, object, req.Tags)
+}
+
+// delete removes the tags of an object - DeleteObjectTagging
+func (t *tagging) delete(w http.ResponseWriter, r *http.Request, bucket, object string) error {
+	err := t.b.setTags(bucket, object, nil)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
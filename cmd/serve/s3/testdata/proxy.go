@@ -0,0 +1,41 @@
+//go:build ignore
+// +build ignore
+
+// An auth proxy for testing which serves root/<user> to each user
+// apart from "unknown" which it rejects
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatalf("Syntax: %s <root>", os.Args[0])
+	}
+	root := os.Args[1]
+
+	// Read the input
+	var in map[string]string
+	err := json.NewDecoder(os.Stdin).Decode(&in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if in["user"] == "unknown" {
+		log.Fatal("unknown user")
+	}
+
+	// Write the output
+	var out = map[string]string{
+		"type":      "local",
+		"_root":     filepath.Join(root, in["user"]),
+		"_password": "secret-" + in["user"],
+	}
+	err = json.NewEncoder(os.Stdout).Encode(&out)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
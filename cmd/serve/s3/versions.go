@@ -0,0 +1,291 @@
+package s3
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mikubill/gofakes3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/version"
+)
+
+// listsVersions returns true if f lists the old versions of files
+// with a version string in their names, as the s3 and b2 backends do
+// with --s3-versions and --b2-versions.
+func listsVersions(f fs.Fs) bool {
+	_, _, _, config, err := fs.ConfigFs(fs.ConfigStringFull(f))
+	if err != nil {
+		return false
+	}
+	value, ok := config.Get("versions")
+	if !ok {
+		return false
+	}
+	versions, _ := strconv.ParseBool(value)
+	return versions
+}
+
+// versionID returns the S3 version ID of the version of a file made
+// at t. This is the version string the backend adds to its name
+// without the leading "-".
+func versionID(t time.Time) gofakes3.VersionID {
+	return gofakes3.VersionID(strings.TrimPrefix(version.Add("", t), "-"))
+}
+
+// versionTime returns the time of the version with ID id
+func versionTime(id gofakes3.VersionID) (t time.Time, ok bool) {
+	t, base := version.Remove("x-" + string(id))
+	return t, !t.IsZero() && base == "x"
+}
+
+// versionName returns the name the backend lists version id of
+// objectName as
+func (b *s3Backend) versionName(objectName string, id gofakes3.VersionID) (string, error) {
+	t, ok := versionTime(id)
+	if !b.versions || !ok {
+		return "", gofakes3.ErrNoSuchVersion
+	}
+	return version.Add(objectName, t), nil
+}
+
+// VersioningConfiguration returns versioning enabled if the backend
+// lists old versions.
+func (b *s3Backend) VersioningConfiguration(bucket string) (config gofakes3.VersioningConfiguration, err error) {
+	_, err = b.vfs.Stat(bucket)
+	if err != nil {
+		return config, gofakes3.BucketNotFound(bucket)
+	}
+	if b.versions {
+		config.Status = gofakes3.VersioningEnabled
+	}
+	return config, nil
+}
+
+// SetVersioningConfiguration isn't supported as versioning is
+// configured on the backend.
+func (b *s3Backend) SetVersioningConfiguration(bucket string, v gofakes3.VersioningConfiguration) error {
+	return gofakes3.ErrNotImplemented
+}
+
+// GetObjectVersion fetches a version of the object.
+func (b *s3Backend) GetObjectVersion(bucketName, objectName string, id gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
+	if id == "" {
+		return b.GetObject(bucketName, objectName, rangeRequest)
+	}
+	name, err := b.versionName(objectName, id)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := b.GetObject(bucketName, name, rangeRequest)
+	if gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		return nil, gofakes3.ErrNoSuchVersion
+	} else if err != nil {
+		return nil, err
+	}
+	obj.Name = gofakes3.URLEncode(objectName)
+	obj.VersionID = id
+	return obj, nil
+}
+
+// HeadObjectVersion returns the fileinfo for a version of the object.
+func (b *s3Backend) HeadObjectVersion(bucketName, objectName string, id gofakes3.VersionID) (*gofakes3.Object, error) {
+	if id == "" {
+		return b.HeadObject(bucketName, objectName)
+	}
+	name, err := b.versionName(objectName, id)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := b.HeadObject(bucketName, name)
+	if gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		return nil, gofakes3.ErrNoSuchVersion
+	} else if err != nil {
+		return nil, err
+	}
+	obj.Name = objectName
+	obj.VersionID = id
+	return obj, nil
+}
+
+// headVersion answers HeadObject for a version of an object
+func (rt *router) headVersion(w http.ResponseWriter, bucket, object string, id gofakes3.VersionID) error {
+	obj, err := rt.b.HeadObjectVersion(bucket, object, id)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = obj.Contents.Close()
+	}()
+	h := w.Header()
+	for k, v := range obj.Metadata {
+		h.Set(k, v)
+	}
+	h.Set("x-amz-version-id", string(id))
+	h.Set("ETag", `"`+hex.EncodeToString(obj.Hash)+`"`)
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// DeleteObjectVersion deletes a version of the object.
+func (b *s3Backend) DeleteObjectVersion(bucketName, objectName string, id gofakes3.VersionID) (result gofakes3.ObjectDeleteResult, err error) {
+	_, err = b.vfs.Stat(bucketName)
+	if err != nil {
+		return result, gofakes3.BucketNotFound(bucketName)
+	}
+	name, err := b.versionName(objectName, id)
+	if err != nil {
+		// S3 doesn't return an error for versions which don't exist
+		return result, nil
+	}
+	err = b.vfs.Remove(path.Join(bucketName, name))
+	if err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	result.VersionID = id
+	return result, nil
+}
+
+// objectVersion is a version of an object in a version listing
+type objectVersion struct {
+	key     string
+	id      gofakes3.VersionID // "" for the current version
+	t       time.Time          // time of the version
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// before returns true if v should be listed before w. The versions of
+// each object are listed newest first, starting with the current one.
+func (v *objectVersion) before(w *objectVersion) bool {
+	if v.key != w.key {
+		return v.key < w.key
+	}
+	if (v.id == "") != (w.id == "") {
+		return v.id == ""
+	}
+	return v.t.After(w.t)
+}
+
+// ListBucketVersions lists the versions of the objects in the bucket
+// with the current versions first.
+//
+// Only the current versions are listed if the backend doesn't list
+// old versions.
+func (b *s3Backend) ListBucketVersions(bucketName string, prefix *gofakes3.Prefix, page *gofakes3.ListBucketVersionsPage) (*gofakes3.ListBucketVersionsResult, error) {
+	_, err := b.vfs.Stat(bucketName)
+	if err != nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	if prefix == nil {
+		prefix = &gofakes3.Prefix{}
+	}
+	// workaround as in ListBucket
+	if strings.TrimSpace(prefix.Prefix) == "" {
+		prefix.HasPrefix = false
+	}
+	if strings.TrimSpace(prefix.Delimiter) == "" {
+		prefix.HasDelimiter = false
+	}
+	if page == nil {
+		page = &gofakes3.ListBucketVersionsPage{}
+	}
+	result := gofakes3.NewListBucketVersionsResult(bucketName, prefix, page)
+
+	ctx := context.Background()
+	var versions []*objectVersion
+	err = walk.ListR(ctx, b.vfs.Fs(), bucketName, false, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o := entry.(fs.Object)
+			v := &objectVersion{
+				key:     strings.TrimPrefix(o.Remote(), bucketName+"/"),
+				modTime: o.ModTime(ctx),
+				size:    o.Size(),
+				etag:    `"` + getFileHash(o) + `"`,
+			}
+			if b.versions {
+				if t, key := version.Remove(v.key); !t.IsZero() {
+					v.key, v.id, v.t = key, versionID(t), t
+				}
+			}
+			var match gofakes3.PrefixMatch
+			if !prefix.Match(v.key, &match) {
+				continue
+			}
+			if match.CommonPrefix {
+				if !page.HasKeyMarker || match.MatchedPart > page.KeyMarker {
+					result.AddPrefix(gofakes3.URLEncode(match.MatchedPart))
+				}
+				continue
+			}
+			versions = append(versions, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].before(versions[j])
+	})
+	sort.Slice(result.CommonPrefixes, func(i, j int) bool {
+		return result.CommonPrefixes[i].Prefix < result.CommonPrefixes[j].Prefix
+	})
+
+	// Skip to the marker
+	if page.HasKeyMarker {
+		marker := &objectVersion{key: page.KeyMarker}
+		if page.HasVersionIDMarker && page.VersionIDMarker != "null" {
+			marker.id = page.VersionIDMarker
+			marker.t, _ = versionTime(marker.id)
+		}
+		i := sort.Search(len(versions), func(i int) bool {
+			v := versions[i]
+			if !page.HasVersionIDMarker {
+				return v.key > marker.key
+			}
+			return marker.before(v)
+		})
+		versions = versions[i:]
+	}
+
+	maxKeys := page.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = gofakes3.DefaultMaxBucketVersionKeys
+	}
+	if int64(len(versions)) > maxKeys {
+		versions = versions[:maxKeys]
+		last := versions[len(versions)-1]
+		result.IsTruncated = true
+		result.NextKeyMarker = gofakes3.URLEncode(last.key)
+		result.NextVersionIDMarker = last.id
+		if last.id == "" {
+			result.NextVersionIDMarker = "null"
+		}
+	}
+	for _, v := range versions {
+		result.Versions = append(result.Versions, &gofakes3.Version{
+			Key:          gofakes3.URLEncode(v.key),
+			VersionID:    v.id,
+			IsLatest:     v.id == "",
+			LastModified: gofakes3.NewContentTime(v.modTime),
+			Size:         v.size,
+			StorageClass: gofakes3.StorageStandard,
+			ETag:         v.etag,
+		})
+	}
+	return result, nil
+}
+
+// Check interface
+var _ gofakes3.VersionedBackend = (*s3Backend)(nil)
@@ -0,0 +1,127 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mikubill/gofakes3"
+	"github.com/minio/minio-go/v7"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionID(t *testing.T) {
+	when := time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	id := versionID(when)
+	assert.Equal(t, gofakes3.VersionID("v2020-01-02-030405-006"), id)
+	got, ok := versionTime(id)
+	assert.True(t, ok)
+	assert.True(t, when.Equal(got))
+
+	for _, id := range []gofakes3.VersionID{"", "null", "potato", "v2020-01-02-030405", "xv2020-01-02-030405-006"} {
+		_, ok = versionTime(id)
+		assert.False(t, ok, id)
+	}
+
+	b := &s3Backend{versions: true}
+	name, err := b.versionName("dir/file.txt", id)
+	require.NoError(t, err)
+	assert.Equal(t, "dir/file-v2020-01-02-030405-006.txt", name)
+	_, err = b.versionName("dir/file.txt", "potato")
+	assert.Equal(t, gofakes3.ErrNoSuchVersion, err)
+	b.versions = false
+	_, err = b.versionName("dir/file.txt", id)
+	assert.Equal(t, gofakes3.ErrNoSuchVersion, err)
+}
+
+func TestListsVersions(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	assert.False(t, listsVersions(f))
+	t.Setenv("RCLONE_CONFIG_LOCAL_VERSIONS", "true")
+	assert.True(t, listsVersions(f))
+}
+
+func TestVersions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bucket := filepath.Join(dir, "bucket")
+	require.NoError(t, os.Mkdir(bucket, 0777))
+	for name, contents := range map[string]string{
+		"file.txt":                        "current",
+		"file-v2020-01-02-030405-000.txt": "old",
+		"file-v2021-01-02-030405-000.txt": "newer",
+		"gone-v2020-01-02-030405-000.txt": "deleted",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(bucket, name), []byte(contents), 0666))
+	}
+	// Pretend the local backend lists versions like --s3-versions
+	t.Setenv("RCLONE_CONFIG_LOCAL_VERSIONS", "true")
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	client := newTestClient(t, f).Client
+
+	config, err := client.GetBucketVersioning(ctx, "bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "Enabled", config.Status)
+
+	list := func(opts minio.ListObjectsOptions) (got []string) {
+		opts.Recursive = true
+		for info := range client.ListObjects(ctx, "bucket", opts) {
+			require.NoError(t, info.Err)
+			item := info.Key
+			if opts.WithVersions {
+				item += " " + info.VersionID
+				if info.IsLatest {
+					item += " latest"
+				}
+			}
+			got = append(got, item)
+		}
+		return got
+	}
+	assert.Equal(t, []string{"file.txt"}, list(minio.ListObjectsOptions{}))
+	want := []string{
+		"file.txt null latest",
+		"file.txt v2021-01-02-030405-000",
+		"file.txt v2020-01-02-030405-000",
+		"gone.txt v2020-01-02-030405-000",
+	}
+	assert.Equal(t, want, list(minio.ListObjectsOptions{WithVersions: true}))
+	// Check the paging
+	assert.Equal(t, want, list(minio.ListObjectsOptions{WithVersions: true, MaxKeys: 1}))
+
+	read := func(versionID string) string {
+		obj, err := client.GetObject(ctx, "bucket", "file.txt", minio.GetObjectOptions{VersionID: versionID})
+		require.NoError(t, err)
+		data, err := io.ReadAll(obj)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "current", read(""))
+	assert.Equal(t, "newer", read("v2021-01-02-030405-000"))
+	assert.Equal(t, "old", read("v2020-01-02-030405-000"))
+
+	info, err := client.StatObject(ctx, "bucket", "file.txt", minio.StatObjectOptions{VersionID: "v2021-01-02-030405-000"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("newer")), info.Size)
+	assert.Equal(t, "v2021-01-02-030405-000", info.VersionID)
+	_, err = client.StatObject(ctx, "bucket", "file.txt", minio.StatObjectOptions{VersionID: "v1999-01-02-030405-000"})
+	assert.Equal(t, http.StatusNotFound, minio.ToErrorResponse(err).StatusCode)
+	obj, err := client.GetObject(ctx, "bucket", "file.txt", minio.GetObjectOptions{VersionID: "v1999-01-02-030405-000"})
+	require.NoError(t, err)
+	_, err = io.ReadAll(obj)
+	assert.Equal(t, "NoSuchVersion", minio.ToErrorResponse(err).Code)
+
+	err = client.RemoveObject(ctx, "bucket", "file.txt", minio.RemoveObjectOptions{VersionID: "v2020-01-02-030405-000"})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(bucket, "file-v2020-01-02-030405-000.txt"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 3, len(list(minio.ListObjectsOptions{WithVersions: true})))
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/rclone/rclone/cmd/serve/restic"
 	"github.com/rclone/rclone/cmd/serve/s3"
 	"github.com/rclone/rclone/cmd/serve/sftp"
+	"github.com/rclone/rclone/cmd/serve/smb"
 	"github.com/rclone/rclone/cmd/serve/webdav"
 	"github.com/spf13/cobra"
 )
@@ -43,6 +44,9 @@ func init() {
 	if s3.Command != nil {
 		Command.AddCommand(s3.Command)
 	}
+	if smb.Command != nil {
+		Command.AddCommand(smb.Command)
+	}
 	cmd.Root.AddCommand(Command)
 }
 
@@ -0,0 +1,119 @@
+// Package servemeta has helpers for the servers which store metadata
+// in the objects on the backend.
+package servemeta
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/encoder"
+)
+
+// Context returns a copy of ctx which makes the backend read and
+// write metadata
+func Context(ctx context.Context) context.Context {
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Metadata = true
+	return ctx
+}
+
+// CanStore returns true if metadata for the object at remote can be
+// stored on f.
+//
+// The objects with metadata are written straight to the backend,
+// bypassing the VFS which remembers the name they were written with,
+// so f must support user metadata and list the object under the same
+// name. It doesn't for names which its encoding can't represent in
+// rclone's standard encoding, such as those with control characters
+// or invalid UTF-8.
+func CanStore(f fs.Fs, remote string) bool {
+	if !f.Features().UserMetadata {
+		return false
+	}
+	enc := encoding(f)
+	if enc == nil {
+		return true
+	}
+	return enc.ToStandardPath(enc.FromStandardPath(remote)) == remote
+}
+
+// encodings caches the encoding of each Fs by config string
+var encodings sync.Map
+
+// encoding returns the encoding f is configured with, or nil if it
+// doesn't have one
+func encoding(f fs.Fs) *encoder.MultiEncoder {
+	configString := fs.ConfigStringFull(f)
+	if enc, ok := encodings.Load(configString); ok {
+		return enc.(*encoder.MultiEncoder)
+	}
+	var enc *encoder.MultiEncoder
+	_, _, _, m, err := fs.ConfigFs(configString)
+	if err == nil {
+		if value, ok := m.Get(config.ConfigEncoding); ok {
+			enc = new(encoder.MultiEncoder)
+			if err := enc.Set(value); err != nil {
+				fs.Errorf(f, "Failed to parse encoding %q: %v", value, err)
+				enc = nil
+			}
+		}
+	}
+	encodings.Store(configString, enc)
+	return enc
+}
+
+// SystemMetadata returns the system metadata of the backend of f, or
+// nil if it has none
+func SystemMetadata(f fs.Fs) map[string]fs.MetadataHelp {
+	fsInfo, err := fs.Find(fs.Type(f))
+	if err != nil || fsInfo.MetadataInfo == nil {
+		return nil
+	}
+	return fsInfo.MetadataInfo.System
+}
+
+// Rewrite uploads the object o on f again with the metadata m, less
+// the system metadata which can't be written, and modTime.
+//
+// There is no way of changing the metadata of an object without
+// uploading it again. The object is copied to a temporary file first
+// as some backends can't read and write the same object at once.
+func Rewrite(ctx context.Context, f fs.Fs, o fs.Object, m fs.Metadata, modTime time.Time) (err error) {
+	ctx = Context(ctx)
+	system := SystemMetadata(f)
+	writable := make(fs.Metadata, len(m))
+	for k, v := range m {
+		if help, ok := system[k]; !ok || !help.ReadOnly {
+			writable[k] = v
+		}
+	}
+	spool, err := os.CreateTemp("", "rclone-serve-rewrite-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+	in, err := o.Open(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(spool, in)
+	fs.CheckClose(in, &err)
+	if err != nil {
+		return err
+	}
+	_, err = spool.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = operations.RcatSize(ctx, f, o.Remote(), io.NopCloser(spool), o.Size(), modTime, writable)
+	return err
+}
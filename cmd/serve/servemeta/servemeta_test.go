@@ -0,0 +1,64 @@
+package servemeta
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.DryRun = true
+	newCtx := Context(ctx)
+	assert.True(t, fs.GetConfig(newCtx).Metadata)
+	assert.True(t, fs.GetConfig(newCtx).DryRun)
+	assert.False(t, ci.Metadata)
+}
+
+func TestCanStore(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	if !f.Features().UserMetadata {
+		t.Skip("backend doesn't support user metadata")
+	}
+	assert.True(t, CanStore(f, "dir/file.txt"))
+	assert.True(t, CanStore(f, "dir/ﬁlé ✓.txt"))
+	// Control characters are listed as their standard encoding
+	assert.False(t, CanStore(f, "dir/file\x01.txt"))
+	assert.NotNil(t, encoding(f))
+}
+
+func TestRewrite(t *testing.T) {
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	if !f.Features().UserMetadata {
+		t.Skip("backend doesn't support user metadata")
+	}
+	o, err := operations.Rcat(ctx, f, "file.txt", io.NopCloser(strings.NewReader("potato")), time.Now(), nil)
+	require.NoError(t, err)
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, Rewrite(ctx, f, o, fs.Metadata{"potato": "jersey royal"}, modTime))
+
+	o, err = f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(o.ModTime(ctx)), o.ModTime(ctx))
+	m, err := fs.GetMetadata(Context(ctx), o)
+	require.NoError(t, err)
+	assert.Equal(t, "jersey royal", m["potato"])
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "potato", string(data))
+}
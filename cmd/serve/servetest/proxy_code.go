@@ -29,6 +29,11 @@ func main() {
 		"_root":    root,
 		"_obscure": "pass",
 	}
+	// Servers with challenge response authentication don't
+	// send the password so need to be told it
+	if in["pass"] == "" && in["public_key"] == "" {
+		out["_password"] = "password"
+	}
 	json.NewEncoder(os.Stdout).Encode(&out)
 	if err != nil {
 		log.Fatal(err)
@@ -26,7 +26,8 @@ var subRun = flag.String("sub-run", "", "pass this to the -run command of the ba
 // StartFn describes the callback which should start the server with
 // the Fs passed in.
 // It should return a config for the backend used to connect to the
-// server and a clean up function
+// server and a clean up function. If the config has _root set then
+// that is used as the root of the remote under test.
 type StartFn func(f fs.Fs) (configmap.Simple, func())
 
 // run runs the server then runs the unit tests for the remote against
@@ -80,7 +81,10 @@ func run(t *testing.T, name string, start StartFn, useProxy bool) {
 	if *subRun != "" {
 		args = append(args, "-run", *subRun)
 	}
-	args = append(args, "-remote", remoteName)
+	// The config may set the root of the remote to test
+	root, _ := config.Get("_root")
+	delete(config, "_root")
+	args = append(args, "-remote", remoteName+root)
 	args = append(args, "-list-retries", fmt.Sprint(*fstest.ListRetries))
 	cmd := exec.Command("go", args...)
 
@@ -0,0 +1,524 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	//lint:ignore SA1019 NTLM is defined in terms of MD4
+	"golang.org/x/crypto/md4"
+)
+
+// This file implements the server side of NTLMv2 authentication
+// (MS-NLMP) wrapped in SPNEGO (RFC 4178) as SMB2 uses it.
+
+// Object identifiers of the mechanisms
+var (
+	oidSPNEGO  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	oidNTLMSSP = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+)
+
+// NTLM message types
+const (
+	ntlmNegotiate    = 1
+	ntlmChallenge    = 2
+	ntlmAuthenticate = 3
+)
+
+// NTLM negotiate flags
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateSign                    = 0x00000010
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmTargetTypeServer                 = 0x00020000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiateVersion                 = 0x02000000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiateKeyExch                 = 0x40000000
+	ntlmNegotiate56                      = 0x80000000
+
+	// the flags the server will agree to if the client asks
+	ntlmServerFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateSign |
+		ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSessionSecurity |
+		ntlmNegotiateTargetInfo | ntlmNegotiateVersion | ntlmNegotiate128 |
+		ntlmNegotiateKeyExch | ntlmNegotiate56
+)
+
+// AV pair IDs in the target info
+const (
+	avEOL             = 0
+	avNbComputerName  = 1
+	avNbDomainName    = 2
+	avDNSComputerName = 3
+	avDNSDomainName   = 4
+	avFlags           = 6
+	avTimestamp       = 7
+
+	avFlagMICPresent = 0x00000002
+)
+
+var (
+	ntlmSignature = []byte("NTLMSSP\x00")
+	// Windows 10, NTLM revision 15
+	ntlmVersion = []byte{10, 0, 0x61, 0x4a, 0, 0, 0, 15}
+)
+
+var (
+	errBadToken    = errors.New("malformed security token")
+	errLogonFailed = errors.New("logon failure")
+)
+
+// ntlmServer is the server side of an NTLM authentication
+type ntlmServer struct {
+	targetName string // NetBIOS name of the server
+	negotiate  []byte // the NEGOTIATE_MESSAGE
+	challenge  []byte // the CHALLENGE_MESSAGE
+}
+
+// challengeMessage returns the CHALLENGE_MESSAGE to send in reply to
+// the NEGOTIATE_MESSAGE negotiate
+func (n *ntlmServer) challengeMessage(negotiate []byte) ([]byte, error) {
+	if len(negotiate) < 16 || !bytes.Equal(negotiate[:8], ntlmSignature) || le.Uint32(negotiate[8:]) != ntlmNegotiate {
+		return nil, errBadToken
+	}
+	n.negotiate = append([]byte(nil), negotiate...)
+	flags := le.Uint32(negotiate[12:])&ntlmServerFlags |
+		ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM | ntlmNegotiateTargetInfo | ntlmTargetTypeServer
+
+	name := encodeUTF16(n.targetName)
+	dnsName := encodeUTF16(strings.ToLower(n.targetName))
+	var info []byte
+	addAV := func(id uint16, value []byte) {
+		var hdr [4]byte
+		le.PutUint16(hdr[0:], id)
+		le.PutUint16(hdr[2:], uint16(len(value)))
+		info = append(append(info, hdr[:]...), value...)
+	}
+	var now [8]byte
+	le.PutUint64(now[:], filetime(time.Now()))
+	addAV(avNbDomainName, name)
+	addAV(avNbComputerName, name)
+	addAV(avDNSDomainName, dnsName)
+	addAV(avDNSComputerName, dnsName)
+	addAV(avTimestamp, now[:])
+	addAV(avEOL, nil)
+
+	const payload = 56
+	msg := make([]byte, payload, payload+len(name)+len(info))
+	copy(msg, ntlmSignature)
+	le.PutUint32(msg[8:], ntlmChallenge)
+	putNTLMField(msg[12:], len(name), len(msg))
+	msg = append(msg, name...)
+	le.PutUint32(msg[20:], flags)
+	if _, err := rand.Read(msg[24:32]); err != nil {
+		return nil, err
+	}
+	putNTLMField(msg[40:], len(info), len(msg))
+	msg = append(msg, info...)
+	copy(msg[48:56], ntlmVersion)
+	n.challenge = msg
+	return msg, nil
+}
+
+// putNTLMField writes the length and offset of a payload field
+func putNTLMField(b []byte, length, offset int) {
+	le.PutUint16(b[0:], uint16(length))
+	le.PutUint16(b[2:], uint16(length))
+	le.PutUint32(b[4:], uint32(offset))
+}
+
+// ntlmField returns the payload field of msg described at off
+func ntlmField(msg []byte, off int) ([]byte, error) {
+	if off+8 > len(msg) {
+		return nil, errBadToken
+	}
+	length := int(le.Uint16(msg[off:]))
+	offset := int(le.Uint32(msg[off+4:]))
+	b := field(msg, offset, length)
+	if b == nil && length != 0 {
+		return nil, errBadToken
+	}
+	return b, nil
+}
+
+// authenticateMessage is a decoded AUTHENTICATE_MESSAGE
+type authenticateMessage struct {
+	raw             []byte
+	flags           uint32
+	ntResponse      []byte
+	domain          []byte // UTF-16 encoded
+	user            string
+	encryptedKey    []byte
+	clientAVFlags   uint32
+	micOffset       int // offset of the MIC or 0 if there isn't one
+	anonymousLogon  bool
+	workstationName string
+}
+
+// parseAuthenticate decodes the AUTHENTICATE_MESSAGE msg
+func parseAuthenticate(msg []byte) (a *authenticateMessage, err error) {
+	if len(msg) < 64 || !bytes.Equal(msg[:8], ntlmSignature) || le.Uint32(msg[8:]) != ntlmAuthenticate {
+		return nil, errBadToken
+	}
+	a = &authenticateMessage{
+		raw:   append([]byte(nil), msg...),
+		flags: le.Uint32(msg[60:]),
+	}
+	lmResponse, err := ntlmField(msg, 12)
+	if err != nil {
+		return nil, err
+	}
+	if a.ntResponse, err = ntlmField(msg, 20); err != nil {
+		return nil, err
+	}
+	if a.domain, err = ntlmField(msg, 28); err != nil {
+		return nil, err
+	}
+	user, err := ntlmField(msg, 36)
+	if err != nil {
+		return nil, err
+	}
+	a.user = decodeUTF16(user)
+	workstation, err := ntlmField(msg, 44)
+	if err != nil {
+		return nil, err
+	}
+	a.workstationName = decodeUTF16(workstation)
+	if a.encryptedKey, err = ntlmField(msg, 52); err != nil {
+		return nil, err
+	}
+	a.anonymousLogon = a.user == "" && len(a.ntResponse) == 0 && len(lmResponse) <= 1
+	if len(a.ntResponse) >= 16+28 {
+		// The NTLMv2 client challenge after the 16 byte proof
+		// contains the AV pairs after a 28 byte header
+		av := a.ntResponse[16+28:]
+		for len(av) >= 4 {
+			id, length := le.Uint16(av), int(le.Uint16(av[2:]))
+			if id == avEOL || 4+length > len(av) {
+				break
+			}
+			if id == avFlags && length == 4 {
+				a.clientAVFlags = le.Uint32(av[4:])
+			}
+			av = av[4+length:]
+		}
+	}
+	if a.clientAVFlags&avFlagMICPresent != 0 && a.flags&ntlmNegotiateVersion != 0 && len(msg) >= 88 {
+		a.micOffset = 72
+	}
+	return a, nil
+}
+
+// ntowfv2 returns the NTLMv2 response key for the user
+func ntowfv2(user, password string, domain []byte) []byte {
+	h := md4.New()
+	h.Write(encodeUTF16(password))
+	m := hmac.New(md5.New, h.Sum(nil))
+	m.Write(encodeUTF16(strings.ToUpper(user)))
+	m.Write(domain)
+	return m.Sum(nil)
+}
+
+// verify checks the response in a is for the user's password
+// returning the exported session key if so
+func (n *ntlmServer) verify(a *authenticateMessage, password string) (sessionKey []byte, err error) {
+	if n.challenge == nil || len(a.ntResponse) <= 24 {
+		// Only NTLMv2 is supported
+		return nil, errLogonFailed
+	}
+	serverChallenge := n.challenge[24:32]
+	proof, blob := a.ntResponse[:16], a.ntResponse[16:]
+	// Clients differ in how they send the domain so try the variants
+	domains := [][]byte{a.domain, encodeUTF16(strings.ToUpper(decodeUTF16(a.domain))), nil}
+	var key []byte
+	for _, domain := range domains {
+		responseKey := ntowfv2(a.user, password, domain)
+		m := hmac.New(md5.New, responseKey)
+		m.Write(serverChallenge)
+		m.Write(blob)
+		if hmac.Equal(m.Sum(nil), proof) {
+			m = hmac.New(md5.New, responseKey)
+			m.Write(proof)
+			key = m.Sum(nil)
+			break
+		}
+	}
+	if key == nil {
+		return nil, errLogonFailed
+	}
+	if a.flags&ntlmNegotiateKeyExch != 0 {
+		if len(a.encryptedKey) != 16 {
+			return nil, errBadToken
+		}
+		c, err := rc4.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		exported := make([]byte, 16)
+		c.XORKeyStream(exported, a.encryptedKey)
+		key = exported
+	}
+	if a.micOffset != 0 {
+		msg := append([]byte(nil), a.raw...)
+		mic := append([]byte(nil), msg[a.micOffset:a.micOffset+16]...)
+		copy(msg[a.micOffset:a.micOffset+16], make([]byte, 16))
+		m := hmac.New(md5.New, key)
+		m.Write(n.negotiate)
+		m.Write(n.challenge)
+		m.Write(msg)
+		if !hmac.Equal(m.Sum(nil), mic) {
+			return nil, errLogonFailed
+		}
+	}
+	return key, nil
+}
+
+// ntlmMAC returns the NTLM message signature of msg with sequence
+// number 0 as used for the SPNEGO mechListMIC, or nil if the flags
+// don't support it.
+func ntlmMAC(flags uint32, sessionKey []byte, fromClient bool, msg []byte) []byte {
+	if flags&ntlmNegotiateSign == 0 || flags&ntlmNegotiateExtendedSessionSecurity == 0 {
+		return nil
+	}
+	direction := "server-to-client"
+	if fromClient {
+		direction = "client-to-server"
+	}
+	signKey := md5.Sum(append(append([]byte(nil), sessionKey...), "session key to "+direction+" signing key magic constant\x00"...))
+	sig := make([]byte, 16)
+	le.PutUint32(sig[0:], 1) // version
+	m := hmac.New(md5.New, signKey[:])
+	m.Write(sig[12:16]) // sequence number
+	m.Write(msg)
+	copy(sig[4:12], m.Sum(nil))
+	if flags&ntlmNegotiateKeyExch != 0 {
+		sealKey := sessionKey
+		switch {
+		case flags&ntlmNegotiate128 != 0:
+		case flags&ntlmNegotiate56 != 0:
+			sealKey = sessionKey[:7]
+		default:
+			sealKey = sessionKey[:5]
+		}
+		key := md5.Sum(append(append([]byte(nil), sealKey...), "session key to "+direction+" sealing key magic constant\x00"...))
+		c, err := rc4.NewCipher(key[:])
+		if err != nil {
+			return nil
+		}
+		c.XORKeyStream(sig[4:12], sig[4:12])
+	}
+	return sig
+}
+
+// DER encoding of the SPNEGO tokens
+
+// ASN.1 tags used
+const (
+	tagApplication0 = 0x60
+	tagContext0     = 0xa0
+	tagContext1     = 0xa1
+	tagContext2     = 0xa2
+	tagContext3     = 0xa3
+	tagSequence     = 0x30
+	tagOctetString  = 0x04
+	tagOID          = 0x06
+	tagEnumerated   = 0x0a
+	tagGeneralStr   = 0x1b
+)
+
+// SPNEGO negotiation states
+const (
+	negStateAcceptCompleted  = 0
+	negStateAcceptIncomplete = 1
+)
+
+// parseDER parses the DER element at the start of b
+func parseDER(b []byte) (tag byte, content, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errBadToken
+	}
+	tag = b[0]
+	length := int(b[1])
+	b = b[2:]
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || n > len(b) {
+			return 0, nil, nil, errBadToken
+		}
+		length = 0
+		for _, c := range b[:n] {
+			length = length<<8 | int(c)
+		}
+		b = b[n:]
+	}
+	if length < 0 || length > len(b) {
+		return 0, nil, nil, errBadToken
+	}
+	return tag, b[:length], b[length:], nil
+}
+
+// der returns the DER element with tag and content
+func der(tag byte, content ...[]byte) []byte {
+	var body []byte
+	for _, c := range content {
+		body = append(body, c...)
+	}
+	out := []byte{tag}
+	switch n := len(body); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	case n < 0x10000:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, body...)
+}
+
+// derOID returns the DER encoding of oid
+func derOID(oid asn1.ObjectIdentifier) []byte {
+	b, _ := asn1.Marshal(oid)
+	return b
+}
+
+// spnegoToken is a decoded token from the client
+type spnegoToken struct {
+	raw         bool   // set if this was a raw NTLMSSP token
+	mechTypes   []byte // DER of the mechTypes in a negTokenInit
+	ntlmFirst   bool   // set if NTLMSSP is the client's preferred mechanism
+	ntlmOffered bool   // set if NTLMSSP is one of the mechanisms
+	mechToken   []byte // the token for the mechanism
+	mechListMIC []byte
+}
+
+// parseSPNEGO decodes the security buffer b from a SESSION_SETUP
+// request. This is a negTokenInit in the first request and a
+// negTokenResp after that, or a raw NTLMSSP token from clients which
+// don't use SPNEGO.
+func parseSPNEGO(b []byte) (t spnegoToken, err error) {
+	if bytes.HasPrefix(b, ntlmSignature) {
+		return spnegoToken{raw: true, ntlmFirst: true, ntlmOffered: true, mechToken: b}, nil
+	}
+	tag, content, _, err := parseDER(b)
+	if err != nil {
+		return t, err
+	}
+	switch tag {
+	case tagApplication0:
+		// InitialContextToken ::= [APPLICATION 0] { thisMech, negTokenInit [0] }
+		tag, oid, rest, err := parseDER(content)
+		if err != nil || tag != tagOID || !bytes.Equal(oid, derOID(oidSPNEGO)[2:]) {
+			return t, errBadToken
+		}
+		tag, content, _, err = parseDER(rest)
+		if err != nil || tag != tagContext0 {
+			return t, errBadToken
+		}
+	case tagContext1:
+	default:
+		return t, errBadToken
+	}
+	tag, seq, _, err := parseDER(content)
+	if err != nil || tag != tagSequence {
+		return t, errBadToken
+	}
+	for len(seq) > 0 {
+		var value []byte
+		tag, value, seq, err = parseDER(seq)
+		if err != nil {
+			return t, err
+		}
+		switch tag {
+		case tagContext0:
+			if len(value) > 0 && value[0] != tagSequence {
+				continue // negState in a negTokenResp
+			}
+			t.mechTypes = value
+			_, mechs, _, err := parseDER(value)
+			if err != nil {
+				return t, err
+			}
+			ntlm := derOID(oidNTLMSSP)
+			for first := true; len(mechs) > 0; first = false {
+				rest := mechs
+				_, _, mechs, err = parseDER(mechs)
+				if err != nil {
+					return t, err
+				}
+				if bytes.Equal(rest[:len(rest)-len(mechs)], ntlm) {
+					t.ntlmOffered = true
+					t.ntlmFirst = first
+				}
+			}
+		case tagContext2:
+			if _, t.mechToken, _, err = parseDER(value); err != nil {
+				return t, err
+			}
+		case tagContext3:
+			if _, t.mechListMIC, _, err = parseDER(value); err != nil {
+				return t, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// negTokenInit2 returns the token the server sends in the NEGOTIATE
+// response advertising NTLMSSP
+func negTokenInit2() []byte {
+	return der(tagApplication0,
+		derOID(oidSPNEGO),
+		der(tagContext0, der(tagSequence,
+			der(tagContext0, der(tagSequence, derOID(oidNTLMSSP))),
+			der(tagContext3, der(tagSequence, der(tagContext0, der(tagGeneralStr, []byte("not_defined_in_RFC4178@please_ignore"))))),
+		)),
+	)
+}
+
+// negTokenResp returns a negTokenResp with the fields which are set
+func negTokenResp(state int, supportedMech bool, responseToken, mechListMIC []byte) []byte {
+	var fields [][]byte
+	fields = append(fields, der(tagContext0, der(tagEnumerated, []byte{byte(state)})))
+	if supportedMech {
+		fields = append(fields, der(tagContext1, derOID(oidNTLMSSP)))
+	}
+	if responseToken != nil {
+		fields = append(fields, der(tagContext2, der(tagOctetString, responseToken)))
+	}
+	if mechListMIC != nil {
+		fields = append(fields, der(tagContext3, der(tagOctetString, mechListMIC)))
+	}
+	return der(tagContext1, der(tagSequence, fields...))
+}
+
+// authState is the state of a session being authenticated
+type authState struct {
+	ntlm      ntlmServer
+	mechTypes []byte // the mechTypes from the client's negTokenInit
+	raw       bool   // set if the client isn't using SPNEGO
+}
+
+// wrap wraps the NTLM token in SPNEGO if the client is using it
+func (as *authState) wrap(state int, token, mechListMIC []byte) []byte {
+	if as.raw {
+		return token
+	}
+	return negTokenResp(state, state == negStateAcceptIncomplete, token, mechListMIC)
+}
+
+// String describes the authentication for logging
+func (a *authenticateMessage) String() string {
+	return fmt.Sprintf("user %q domain %q workstation %q", a.user, decodeUTF16(a.domain), a.workstationName)
+}
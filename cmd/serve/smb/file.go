@@ -0,0 +1,868 @@
+package smb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// This file contains the handlers for the commands which work on
+// files and directories.
+
+// openFile is a file or directory opened with CREATE
+type openFile struct {
+	id     fileID
+	tree   *tree
+	vfs    *vfs.VFS
+	access uint32 // the access the client asked for
+
+	mu            sync.Mutex // protects the fields below
+	path          string     // path in the VFS
+	isDir         bool
+	deleteOnClose bool
+	handle        vfs.Handle // handle for reading and writing or nil
+	writing       bool       // set if handle is open for writing
+	written       int64      // end of the data written without the VFS cache
+	list          []dirEntry // directory listing in progress
+	listed        bool       // set if list has been read
+}
+
+// writeFlags returns the flags to open files for writing with in VFS
+func writeFlags(VFS *vfs.VFS) int {
+	if VFS.Opt.CacheMode >= vfscommon.CacheModeMinimal {
+		return os.O_RDWR
+	}
+	return os.O_WRONLY
+}
+
+// getHandle returns a handle for reading or writing the file,
+// opening it if necessary
+func (of *openFile) getHandle(write bool) (vfs.Handle, error) {
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	if of.isDir {
+		return nil, vfs.EINVAL
+	}
+	if of.handle != nil && (of.writing || !write) {
+		return of.handle, nil
+	}
+	// Open for reading and writing straight away if the client
+	// may write and the VFS can do both with the same handle
+	flags := os.O_RDONLY
+	if write || (of.access&(fileWriteData|fileAppendData) != 0 && writeFlags(of.vfs) == os.O_RDWR && !of.vfs.Opt.ReadOnly) {
+		flags = writeFlags(of.vfs)
+	}
+	if of.handle != nil {
+		// Swap the read handle for a write handle
+		_ = of.handle.Close()
+		of.handle = nil
+	}
+	h, err := of.vfs.OpenFile(of.path, flags, 0666)
+	if err != nil {
+		return nil, err
+	}
+	of.handle = h
+	of.writing = flags != os.O_RDONLY
+	return h, nil
+}
+
+// close closes the handle, deleting the file if requested
+func (of *openFile) close() error {
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	var err error
+	if of.handle != nil {
+		err = of.handle.Close()
+		of.handle = nil
+	}
+	if of.deleteOnClose {
+		if removeErr := of.vfs.Remove(of.path); removeErr != nil && !errors.Is(removeErr, vfs.ENOENT) {
+			fs.Errorf(of.path, "SMB: failed to delete on close: %v", removeErr)
+			if err == nil {
+				err = removeErr
+			}
+		}
+	}
+	return err
+}
+
+// stat returns the node of the file
+func (of *openFile) stat() (vfs.Node, error) {
+	of.mu.Lock()
+	p := of.path
+	of.mu.Unlock()
+	return of.vfs.Stat(p)
+}
+
+// statusFromError converts an error from the VFS into an NTSTATUS
+func statusFromError(err error) uint32 {
+	switch {
+	case err == nil:
+		return statusSuccess
+	case errors.Is(err, vfs.ENOENT):
+		return statusObjectNameNotFound
+	case errors.Is(err, vfs.EEXIST):
+		return statusObjectNameCollision
+	case errors.Is(err, vfs.ENOTEMPTY):
+		return statusDirectoryNotEmpty
+	case errors.Is(err, vfs.EPERM):
+		return statusAccessDenied
+	case errors.Is(err, vfs.EROFS):
+		return statusMediaWriteProtected
+	case errors.Is(err, vfs.ENOSYS):
+		return statusNotSupported
+	case errors.Is(err, vfs.EINVAL), errors.Is(err, vfs.ESPIPE):
+		return statusInvalidParameter
+	case errors.Is(err, vfs.ECLOSED), errors.Is(err, vfs.EBADF):
+		return statusFileClosed
+	}
+	fs.Debugf(nil, "SMB: returning I/O error for: %v", err)
+	return statusUnexpectedIOError
+}
+
+// vfsPath converts the path name from the client into a VFS path,
+// returning false if it isn't valid
+func vfsPath(name string) (string, bool) {
+	name = strings.Trim(strings.ReplaceAll(name, `\`, "/"), "/")
+	if strings.ContainsAny(name, ":*?\"<>|\x00") {
+		// Alternate data streams and wildcards aren't allowed
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "." || part == ".." {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// parentDir returns the VFS path of the directory p is in
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// lookupOpen finds the open file with id for r, which may be the file
+// opened by a previous request in the compound
+func (c *conn) lookupOpen(r *request, b []byte) *openFile {
+	id := decodeFileID(b)
+	if id == relatedFileID {
+		id = r.fileID
+	}
+	c.mu.Lock()
+	of := c.opens[id]
+	c.mu.Unlock()
+	if of == nil || of.tree != r.tree {
+		return nil
+	}
+	r.fileID = id
+	return of
+}
+
+// create handles the CREATE command which opens files and
+// directories
+func (c *conn) create(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 56 {
+		return statusInvalidParameter, nil
+	}
+	access := le.Uint32(b[24:])
+	disposition := le.Uint32(b[36:])
+	options := le.Uint32(b[40:])
+	nameField := field(r.msg, int(le.Uint16(b[44:])), int(le.Uint16(b[46:])))
+	if nameField == nil {
+		return statusInvalidParameter, nil
+	}
+	if r.tree.ipc {
+		// Named pipes aren't supported
+		return statusObjectNameNotFound, nil
+	}
+	name, ok := vfsPath(decodeUTF16(nameField))
+	if !ok {
+		return statusObjectNameInvalid, nil
+	}
+	VFS := r.sess.vfs
+	if VFS.Opt.ReadOnly && access&(fileWriteData|fileAppendData|accessDelete|accessGenericWrite|accessGenericAll) != 0 {
+		return statusAccessDenied, nil
+	}
+
+	node, err := VFS.Stat(name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, vfs.ENOENT) {
+		return statusFromError(err), nil
+	}
+	if !exists {
+		if parent, err := VFS.Stat(parentDir(name)); err != nil || !parent.IsDir() {
+			return statusObjectPathNotFound, nil
+		}
+	}
+	switch disposition {
+	case fileOpen, fileOverwrite:
+		if !exists {
+			return statusObjectNameNotFound, nil
+		}
+	case fileCreate:
+		if exists {
+			return statusObjectNameCollision, nil
+		}
+	case fileSupersede, fileOpenIf, fileOverwriteIf:
+	default:
+		return statusInvalidParameter, nil
+	}
+	isDir := options&fileDirectoryFile != 0
+	if exists {
+		if isDir && !node.IsDir() {
+			return statusNotADirectory, nil
+		}
+		if options&fileNonDirectoryFile != 0 && node.IsDir() {
+			return statusFileIsADirectory, nil
+		}
+		isDir = node.IsDir()
+	}
+	overwrite := disposition == fileSupersede || disposition == fileOverwrite || disposition == fileOverwriteIf
+	if exists && isDir && overwrite {
+		return statusInvalidParameter, nil
+	}
+
+	of := &openFile{
+		tree:          r.tree,
+		vfs:           VFS,
+		access:        access,
+		path:          name,
+		isDir:         isDir,
+		deleteOnClose: options&fileDeleteOnClose != 0,
+	}
+	action := uint32(fileOpened)
+	switch {
+	case !exists && isDir:
+		err = VFS.Mkdir(name, 0777)
+		action = fileCreated
+	case !exists:
+		of.handle, err = VFS.OpenFile(name, os.O_CREATE|os.O_EXCL|writeFlags(VFS), 0666)
+		of.writing = true
+		action = fileCreated
+	case overwrite:
+		of.handle, err = VFS.OpenFile(name, os.O_TRUNC|writeFlags(VFS), 0666)
+		of.writing = true
+		action = fileOverwritten
+		if disposition == fileSupersede {
+			action = fileSuperseded
+		}
+	}
+	if err != nil {
+		return statusFromError(err), nil
+	}
+	node, err = VFS.Stat(name)
+	status := statusFromError(err)
+	if status == statusSuccess && of.deleteOnClose && isDir {
+		status = checkEmpty(node)
+	}
+	if status != statusSuccess {
+		of.deleteOnClose = false
+		_ = of.close()
+		return status, nil
+	}
+
+	c.mu.Lock()
+	c.nextFileID++
+	of.id = fileID{persistent: c.nextFileID, volatile: c.nextFileID}
+	c.opens[of.id] = of
+	c.mu.Unlock()
+	r.fileID = of.id
+
+	body := make([]byte, 89)
+	le.PutUint16(body[0:], 89)
+	le.PutUint32(body[4:], action)
+	putTimes(body[8:], node)
+	putSizes(body[40:], node)
+	le.PutUint32(body[56:], fileAttributes(node))
+	of.id.encode(body[64:])
+	return statusSuccess, body
+}
+
+// checkEmpty checks the directory node is empty so it can be deleted
+func checkEmpty(node vfs.Node) uint32 {
+	dir, ok := node.(*vfs.Dir)
+	if !ok {
+		return statusSuccess
+	}
+	entries, err := dir.ReadDirAll()
+	if err != nil {
+		return statusFromError(err)
+	}
+	if len(entries) != 0 {
+		return statusDirectoryNotEmpty
+	}
+	return statusSuccess
+}
+
+// closeFile handles the CLOSE command
+func (c *conn) closeFile(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 24 {
+		return statusInvalidParameter, nil
+	}
+	of := c.lookupOpen(r, b[8:])
+	if of == nil {
+		return statusFileClosed, nil
+	}
+	c.mu.Lock()
+	delete(c.opens, of.id)
+	c.mu.Unlock()
+	err := of.close()
+	if err != nil {
+		return statusFromError(err), nil
+	}
+	body := make([]byte, 60)
+	le.PutUint16(body[0:], 60)
+	if flags := le.Uint16(b[2:]); flags&closeFlagPostQueryAttrib != 0 {
+		if node, err := of.stat(); err == nil {
+			le.PutUint16(body[2:], closeFlagPostQueryAttrib)
+			putTimes(body[8:], node)
+			putSizes(body[40:], node)
+			le.PutUint32(body[56:], fileAttributes(node))
+		}
+	}
+	return statusSuccess, body
+}
+
+// flush handles the FLUSH command
+func (c *conn) flush(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 24 {
+		return statusInvalidParameter, nil
+	}
+	of := c.lookupOpen(r, b[8:])
+	if of == nil {
+		return statusFileClosed, nil
+	}
+	of.mu.Lock()
+	h := of.handle
+	of.mu.Unlock()
+	if h != nil {
+		if err := h.Flush(); err != nil {
+			return statusFromError(err), nil
+		}
+	}
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
+
+// read handles the READ command
+func (c *conn) read(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 48 {
+		return statusInvalidParameter, nil
+	}
+	length := le.Uint32(b[4:])
+	offset := int64(le.Uint64(b[8:]))
+	minCount := le.Uint32(b[32:])
+	if length > maxTransactSize || offset < 0 {
+		return statusInvalidParameter, nil
+	}
+	of := c.lookupOpen(r, b[16:])
+	if of == nil {
+		return statusFileClosed, nil
+	}
+	h, err := of.getHandle(false)
+	if err != nil {
+		return statusFromError(err), nil
+	}
+	body := make([]byte, 16+length)
+	n, err := h.ReadAt(body[16:], offset)
+	if err != nil && err != io.EOF {
+		return statusFromError(err), nil
+	}
+	if (n == 0 && length != 0) || uint32(n) < minCount {
+		return statusEndOfFile, nil
+	}
+	le.PutUint16(body[0:], 17)
+	body[2] = smb2HeaderSize + 16 // DataOffset
+	le.PutUint32(body[4:], uint32(n))
+	return statusSuccess, body[:16+n]
+}
+
+// write handles the WRITE command
+func (c *conn) write(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 48 {
+		return statusInvalidParameter, nil
+	}
+	data := field(r.msg, int(le.Uint16(b[2:])), int(le.Uint32(b[4:])))
+	offset := int64(le.Uint64(b[8:]))
+	if data == nil || offset < 0 {
+		return statusInvalidParameter, nil
+	}
+	of := c.lookupOpen(r, b[16:])
+	if of == nil {
+		return statusFileClosed, nil
+	}
+	if of.access&(fileWriteData|fileAppendData|accessGenericWrite|accessGenericAll|accessMaximumAllowed) == 0 {
+		return statusAccessDenied, nil
+	}
+	h, err := of.getHandle(true)
+	if err != nil {
+		return statusFromError(err), nil
+	}
+	n, err := h.WriteAt(data, offset)
+	if err != nil {
+		return statusFromError(err), nil
+	}
+	of.mu.Lock()
+	if end := offset + int64(n); end > of.written {
+		of.written = end
+	}
+	of.mu.Unlock()
+	body := make([]byte, 16)
+	le.PutUint16(body[0:], 17)
+	le.PutUint32(body[4:], uint32(n))
+	return statusSuccess, body
+}
+
+// lock handles the LOCK command
+//
+// Locks aren't supported, but they are accepted so clients which
+// use them carry on working.
+func (c *conn) lock(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 24 {
+		return statusInvalidParameter, nil
+	}
+	if c.lookupOpen(r, b[8:]) == nil {
+		return statusFileClosed, nil
+	}
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
+
+// ioctl handles the IOCTL command
+func (c *conn) ioctl(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 56 {
+		return statusInvalidParameter, nil
+	}
+	ctlCode := le.Uint32(b[4:])
+	input := field(r.msg, int(le.Uint32(b[24:])), int(le.Uint32(b[28:])))
+	if input == nil {
+		return statusInvalidParameter, nil
+	}
+	var output []byte
+	switch ctlCode {
+	case fsctlValidateNegotiateInfo:
+		// Check the negotiation wasn't tampered with
+		if len(input) < 24 {
+			return statusInvalidParameter, nil
+		}
+		c.mu.Lock()
+		ok := le.Uint32(input[0:]) == c.clientCaps &&
+			string(input[4:20]) == string(c.clientGUID[:]) &&
+			le.Uint16(input[20:]) == c.clientMode &&
+			int(le.Uint16(input[22:])) == len(c.dialects)
+		dialect := c.dialect
+		c.mu.Unlock()
+		if !ok {
+			// The client drops the connection if this fails
+			return statusAccessDenied, nil
+		}
+		output = make([]byte, 24)
+		caps := uint32(0)
+		if dialect != dialect202 {
+			caps = globalCapLargeMTU
+		}
+		le.PutUint32(output[0:], caps)
+		copy(output[4:20], c.s.guid[:])
+		le.PutUint16(output[20:], negotiateSigningEnabled|negotiateSigningRequired)
+		le.PutUint16(output[22:], dialect)
+	case fsctlGetReparsePoint:
+		if c.lookupOpen(r, b[8:]) == nil {
+			return statusFileClosed, nil
+		}
+		return statusNotAReparsePoint, nil
+	case fsctlPipeTransceive:
+		return statusNotSupported, nil
+	default:
+		return statusInvalidDeviceRequest, nil
+	}
+	if int(le.Uint32(b[44:])) < len(output) {
+		return statusBufferTooSmall, nil
+	}
+	body := make([]byte, 48+len(output))
+	le.PutUint16(body[0:], 49)
+	le.PutUint32(body[4:], ctlCode)
+	copy(body[8:24], b[8:24]) // FileId
+	le.PutUint32(body[24:], smb2HeaderSize+48)
+	le.PutUint32(body[32:], smb2HeaderSize+48)
+	le.PutUint32(body[36:], uint32(len(output)))
+	copy(body[48:], output)
+	return statusSuccess, body
+}
+
+// queryDirectory handles the QUERY_DIRECTORY command which lists
+// directories
+func (c *conn) queryDirectory(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 32 {
+		return statusInvalidParameter, nil
+	}
+	class := b[2]
+	flags := b[3]
+	pattern := field(r.msg, int(le.Uint16(b[24:])), int(le.Uint16(b[26:])))
+	outputLength := int(le.Uint32(b[28:]))
+	if pattern == nil {
+		return statusInvalidParameter, nil
+	}
+	switch class {
+	case fileDirectoryInformation, fileFullDirectoryInformation, fileBothDirectoryInformation,
+		fileNamesInformation, fileIDBothDirectoryInformation, fileIDFullDirectoryInformation:
+	default:
+		return statusInvalidInfoClass, nil
+	}
+	of := c.lookupOpen(r, b[8:])
+	if of == nil {
+		return statusFileClosed, nil
+	}
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	if !of.isDir {
+		return statusInvalidParameter, nil
+	}
+	first := !of.listed || flags&(restartScans|reopen) != 0
+	if first {
+		var err error
+		of.list, err = listDir(of.vfs, of.path, decodeUTF16(pattern))
+		if err != nil {
+			return statusFromError(err), nil
+		}
+		of.listed = true
+		if len(of.list) == 0 {
+			return statusNoSuchFile, nil
+		}
+	}
+	if len(of.list) == 0 {
+		return statusNoMoreFiles, nil
+	}
+
+	var out []byte
+	last := 0
+	for len(of.list) > 0 {
+		entry := encodeDirEntry(class, of.list[0])
+		start := roundUp(len(out), 8)
+		if start+len(entry) > outputLength {
+			break
+		}
+		if out != nil {
+			out = append(out, make([]byte, start-len(out))...)
+			le.PutUint32(out[last:], uint32(start-last))
+		}
+		last = start
+		out = append(out, entry...)
+		of.list = of.list[1:]
+		if flags&returnSingleEntry != 0 {
+			break
+		}
+	}
+	if out == nil {
+		return statusInfoLengthMismatch, nil
+	}
+	body := make([]byte, 8+len(out))
+	le.PutUint16(body[0:], 9)
+	le.PutUint16(body[2:], smb2HeaderSize+8)
+	le.PutUint32(body[4:], uint32(len(out)))
+	copy(body[8:], out)
+	return statusSuccess, body
+}
+
+// queryInfo handles the QUERY_INFO command
+func (c *conn) queryInfo(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 40 {
+		return statusInvalidParameter, nil
+	}
+	infoType := b[2]
+	class := b[3]
+	outputLength := int(le.Uint32(b[4:]))
+	additional := le.Uint32(b[16:])
+	of := c.lookupOpen(r, b[24:])
+	if of == nil {
+		return statusFileClosed, nil
+	}
+	node, err := of.stat()
+	if err != nil {
+		return statusFromError(err), nil
+	}
+	var (
+		data     []byte
+		status   uint32
+		variable bool // set if the data can be truncated
+	)
+	switch infoType {
+	case infoFile:
+		data, status, variable = of.fileInfo(class, node)
+	case infoFilesystem:
+		data, status, variable = c.fsInfo(class, of.vfs)
+	case infoSecurity:
+		data = securityDescriptor(additional, node.IsDir(), of.vfs.Opt.ReadOnly)
+		if len(data) > outputLength {
+			// Tell the client how big a buffer it needs
+			r.errorData = make([]byte, 4)
+			le.PutUint32(r.errorData, uint32(len(data)))
+			return statusBufferTooSmall, nil
+		}
+	default:
+		return statusNotSupported, nil
+	}
+	if status != statusSuccess {
+		return status, nil
+	}
+	if len(data) > outputLength {
+		if !variable {
+			return statusInfoLengthMismatch, nil
+		}
+		data = data[:outputLength]
+		status = statusBufferOverflow
+	}
+	body := make([]byte, 8+len(data))
+	le.PutUint16(body[0:], 9)
+	le.PutUint16(body[2:], smb2HeaderSize+8)
+	le.PutUint32(body[4:], uint32(len(data)))
+	copy(body[8:], data)
+	return status, body
+}
+
+// setInfo handles the SET_INFO command
+func (c *conn) setInfo(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 32 {
+		return statusInvalidParameter, nil
+	}
+	infoType := b[2]
+	class := b[3]
+	data := field(r.msg, int(le.Uint16(b[8:])), int(le.Uint32(b[4:])))
+	if data == nil {
+		return statusInvalidParameter, nil
+	}
+	of := c.lookupOpen(r, b[16:])
+	if of == nil {
+		return statusFileClosed, nil
+	}
+	switch infoType {
+	case infoFile:
+		if status := of.setFileInfo(class, data); status != statusSuccess {
+			return status, nil
+		}
+	case infoSecurity:
+		// Permissions can't be stored so ignore them
+	default:
+		return statusNotSupported, nil
+	}
+	return statusSuccess, []byte{2, 0}
+}
+
+// setFileInfo sets the information in data of the class
+func (of *openFile) setFileInfo(class byte, data []byte) uint32 {
+	switch class {
+	case fileBasicInformation:
+		if len(data) < 40 {
+			return statusInfoLengthMismatch
+		}
+		// 0 means don't change and -1 and -2 are to do with
+		// suspending time updates
+		mtime := le.Uint64(data[16:])
+		if mtime == 0 || mtime >= 0xFFFFFFFFFFFFFFFE {
+			return statusSuccess
+		}
+		t := filetimeToTime(mtime)
+		of.mu.Lock()
+		err := of.vfs.Chtimes(of.path, t, t)
+		of.mu.Unlock()
+		return statusFromError(err)
+	case fileRenameInformation:
+		if len(data) < 20 {
+			return statusInfoLengthMismatch
+		}
+		name := field(data, 20, int(le.Uint32(data[16:])))
+		if name == nil {
+			return statusInvalidParameter
+		}
+		newPath, ok := vfsPath(decodeUTF16(name))
+		if !ok {
+			return statusObjectNameInvalid
+		}
+		return of.rename(newPath, data[0] != 0)
+	case fileDispositionInformation, fileDispositionInformationEx:
+		if len(data) < 1 {
+			return statusInfoLengthMismatch
+		}
+		deletePending := data[0]&fileDispositionFlagDelete != 0
+		if deletePending {
+			node, err := of.stat()
+			if err != nil {
+				return statusFromError(err)
+			}
+			if status := checkEmpty(node); status != statusSuccess {
+				return status
+			}
+			if of.vfs.Opt.ReadOnly {
+				return statusMediaWriteProtected
+			}
+		}
+		of.mu.Lock()
+		of.deleteOnClose = deletePending
+		of.mu.Unlock()
+		return statusSuccess
+	case fileEndOfFileInformation:
+		if len(data) < 8 {
+			return statusInfoLengthMismatch
+		}
+		return of.truncate(int64(le.Uint64(data)))
+	case fileAllocationInformation:
+		// The space will be allocated when it is written
+		return statusSuccess
+	}
+	return statusInvalidInfoClass
+}
+
+// rename renames the file to newPath replacing an existing file if
+// replace is set
+func (of *openFile) rename(newPath string, replace bool) uint32 {
+	of.mu.Lock()
+	defer of.mu.Unlock()
+	if newPath == of.path {
+		return statusSuccess
+	}
+	if node, err := of.vfs.Stat(newPath); err == nil && !strings.EqualFold(newPath, of.path) {
+		// Only files can be replaced
+		if !replace {
+			return statusObjectNameCollision
+		}
+		if node.IsDir() {
+			return statusAccessDenied
+		}
+	}
+	if err := of.vfs.Rename(of.path, newPath); err != nil {
+		return statusFromError(err)
+	}
+	of.path = newPath
+	return statusSuccess
+}
+
+// truncate sets the size of the file
+func (of *openFile) truncate(size int64) uint32 {
+	if size < 0 {
+		return statusInvalidParameter
+	}
+	of.mu.Lock()
+	h, writing, written := of.handle, of.writing, of.written
+	of.mu.Unlock()
+	if h != nil && writing && of.vfs.Opt.CacheMode < vfscommon.CacheModeWrites && size != written {
+		if size > written {
+			// Without the cache files can only be written
+			// sequentially, so Windows setting the size before
+			// writing the data is ignored
+			fs.Debugf(of.path, "SMB: ignoring setting size to %d before writing", size)
+			return statusSuccess
+		}
+		return statusAccessDenied
+	}
+	if h != nil && writing {
+		return statusFromError(h.Truncate(size))
+	}
+	node, err := of.stat()
+	if err != nil {
+		return statusFromError(err)
+	}
+	if node.IsDir() {
+		return statusInvalidParameter
+	}
+	return statusFromError(node.Truncate(size))
+}
+
+// dirEntry is an entry in a directory listing
+type dirEntry struct {
+	name string
+	node vfs.Node
+}
+
+// listDir lists the directory at dirPath in VFS returning the entries
+// which match pattern
+func listDir(VFS *vfs.VFS, dirPath, pattern string) (entries []dirEntry, err error) {
+	node, err := VFS.Stat(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := node.(*vfs.Dir)
+	if !ok {
+		return nil, vfs.EINVAL
+	}
+	items, err := dir.ReadDirAll()
+	if err != nil {
+		return nil, err
+	}
+	if pattern == "" {
+		pattern = "*"
+	}
+	add := func(name string, node vfs.Node) {
+		if matchPattern(pattern, name) {
+			entries = append(entries, dirEntry{name: name, node: node})
+		}
+	}
+	parent := node
+	if dirPath != "" {
+		if parent, err = VFS.Stat(parentDir(dirPath)); err != nil {
+			parent = node
+		}
+	}
+	add(".", node)
+	add("..", parent)
+	for _, item := range items {
+		add(item.Name(), item)
+	}
+	return entries, nil
+}
+
+// matchPattern returns true if name matches the Windows wildcard
+// pattern. This is case insensitive as Windows file systems are.
+func matchPattern(pattern, name string) bool {
+	// Turn the DOS wildcards into their plain equivalents
+	pattern = strings.NewReplacer("<", "*", ">", "?", `"`, ".").Replace(pattern)
+	return match([]rune(strings.ToLower(pattern)), []rune(strings.ToLower(name)))
+}
+
+// match matches name against the pattern with * and ? wildcards
+func match(pattern, name []rune) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if match(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+		default:
+			if len(name) == 0 || name[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
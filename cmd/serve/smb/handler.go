@@ -0,0 +1,347 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// This file contains the handlers for the commands which negotiate
+// the connection, authenticate the sessions and connect to the share.
+
+// negotiate handles the NEGOTIATE command
+func (c *conn) negotiate(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 36 {
+		return statusInvalidParameter, nil
+	}
+	count := int(le.Uint16(b[2:]))
+	list := field(r.msg, smb2HeaderSize+36, 2*count)
+	if count == 0 || list == nil {
+		return statusInvalidParameter, nil
+	}
+	dialects := make([]uint16, count)
+	for i := range dialects {
+		dialects[i] = le.Uint16(list[2*i:])
+	}
+	var dialect uint16
+found:
+	for _, d := range serverDialects {
+		for _, clientDialect := range dialects {
+			if d == clientDialect {
+				dialect = d
+				break found
+			}
+		}
+	}
+	if dialect == 0 {
+		return statusNotSupported, nil
+	}
+
+	// SMB 3.1.1 needs the pre-authentication integrity context
+	var contexts []byte
+	if dialect == dialect311 {
+		if !hasSHA512(r.msg, int(le.Uint32(b[28:])), int(le.Uint16(b[32:]))) {
+			return statusInvalidParameter, nil
+		}
+		contexts = make([]byte, 8+38)
+		le.PutUint16(contexts[0:], preauthIntegrityCapabilities)
+		le.PutUint16(contexts[2:], 38)
+		le.PutUint16(contexts[8:], 1)   // HashAlgorithmCount
+		le.PutUint16(contexts[10:], 32) // SaltLength
+		le.PutUint16(contexts[12:], hashAlgorithmSHA512)
+		if _, err := rand.Read(contexts[14:]); err != nil {
+			return statusUnexpectedIOError, nil
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.negotiated {
+		// Only one negotiate is allowed
+		return statusInvalidParameter, nil
+	}
+	c.negotiated = true
+	c.dialect = dialect
+	c.dialects = dialects
+	c.clientMode = le.Uint16(b[4:])
+	c.clientCaps = le.Uint32(b[8:])
+	copy(c.clientGUID[:], b[12:28])
+	fs.Debugf(nil, "SMB connection from %s: negotiated dialect %x", c.nc.RemoteAddr(), dialect)
+	return statusSuccess, c.negotiateResponse(dialect, contexts)
+}
+
+// hasSHA512 returns true if the negotiate contexts in msg offer the
+// SHA512 pre-authentication integrity hash
+func hasSHA512(msg []byte, off, count int) bool {
+	for i := 0; i < count; i++ {
+		hdr := field(msg, off, 8)
+		if hdr == nil {
+			return false
+		}
+		data := field(msg, off+8, int(le.Uint16(hdr[2:])))
+		if data == nil {
+			return false
+		}
+		if le.Uint16(hdr) == preauthIntegrityCapabilities && len(data) >= 4 {
+			for j := 0; j < int(le.Uint16(data)); j++ {
+				if alg := field(data, 4+2*j, 2); alg != nil && le.Uint16(alg) == hashAlgorithmSHA512 {
+					return true
+				}
+			}
+		}
+		off = roundUp(off+8+len(data), 8)
+	}
+	return false
+}
+
+// negotiateResponse returns the body of the NEGOTIATE response for
+// dialect with the negotiate contexts in contexts
+func (c *conn) negotiateResponse(dialect uint16, contexts []byte) []byte {
+	token := negTokenInit2()
+	body := make([]byte, 64, 64+len(token)+8+len(contexts))
+	le.PutUint16(body[0:], 65)
+	// Signing is required so the messages of authenticated
+	// sessions can't be tampered with
+	le.PutUint16(body[2:], negotiateSigningEnabled|negotiateSigningRequired)
+	le.PutUint16(body[4:], dialect)
+	copy(body[8:24], c.s.guid[:])
+	if dialect != dialect202 && dialect != dialectWildcard {
+		le.PutUint32(body[24:], globalCapLargeMTU)
+	}
+	size := maxSize(dialect)
+	le.PutUint32(body[28:], size) // MaxTransactSize
+	le.PutUint32(body[32:], size) // MaxReadSize
+	le.PutUint32(body[36:], size) // MaxWriteSize
+	le.PutUint64(body[40:], filetime(time.Now()))
+	le.PutUint16(body[56:], smb2HeaderSize+64)
+	le.PutUint16(body[58:], uint16(len(token)))
+	body = append(body, token...)
+	if contexts != nil {
+		off := roundUp(smb2HeaderSize+len(body), 8)
+		body = append(body, make([]byte, off-smb2HeaderSize-len(body))...)
+		le.PutUint16(body[6:], 1)
+		le.PutUint32(body[60:], uint32(off))
+		body = append(body, contexts...)
+	}
+	return body
+}
+
+// sessionSetup handles the SESSION_SETUP command which runs the
+// NTLM authentication
+func (c *conn) sessionSetup(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 24 {
+		return statusInvalidParameter, nil
+	}
+	if b[2]&0x01 != 0 {
+		// Binding a session to another channel isn't supported
+		return statusNotSupported, nil
+	}
+	token := field(r.msg, int(le.Uint16(b[12:])), int(le.Uint16(b[14:])))
+	if token == nil {
+		return statusInvalidParameter, nil
+	}
+
+	c.mu.Lock()
+	dialect := c.dialect
+	sess := c.sessions[r.hdr.sessionID]
+	if r.hdr.sessionID == 0 {
+		sess = &session{
+			id:    c.s.newSessionID(),
+			trees: make(map[uint32]*tree),
+		}
+		c.sessions[sess.id] = sess
+	} else if sess == nil {
+		c.mu.Unlock()
+		return statusUserSessionDeleted, nil
+	}
+	if sess.auth == nil {
+		sess.auth = &authState{ntlm: ntlmServer{targetName: c.s.name}}
+		sess.preauth = c.preauth
+	}
+	if dialect == dialect311 {
+		sess.preauth = preauthHash(sess.preauth, r.msg)
+	}
+	c.mu.Unlock()
+	r.sessionID = sess.id
+
+	fail := func(err error) (uint32, []byte) {
+		fs.Infof(nil, "SMB login from %s failed: %v", c.nc.RemoteAddr(), err)
+		c.mu.Lock()
+		if sess.valid {
+			sess.auth = nil
+		} else {
+			delete(c.sessions, sess.id)
+		}
+		c.mu.Unlock()
+		return statusLogonFailure, nil
+	}
+
+	t, err := parseSPNEGO(token)
+	if err != nil {
+		return fail(err)
+	}
+	auth := sess.auth
+	auth.raw = t.raw
+	if t.mechTypes != nil {
+		if !t.ntlmOffered {
+			return fail(errors.New("client doesn't offer NTLMSSP authentication"))
+		}
+		auth.mechTypes = t.mechTypes
+	}
+	if len(t.mechToken) < 12 || !bytes.HasPrefix(t.mechToken, ntlmSignature) {
+		if t.mechTypes == nil {
+			return fail(errBadToken)
+		}
+		// The client sent a token for its preferred mechanism
+		// which isn't NTLMSSP, so ask it to use NTLMSSP
+		r.preauthSess = sess
+		return statusMoreProcessingRequired, sessionSetupResponse(0, auth.wrap(negStateAcceptIncomplete, nil, nil))
+	}
+	switch le.Uint32(t.mechToken[8:]) {
+	case ntlmNegotiate:
+		challenge, err := auth.ntlm.challengeMessage(t.mechToken)
+		if err != nil {
+			return fail(err)
+		}
+		r.preauthSess = sess
+		return statusMoreProcessingRequired, sessionSetupResponse(0, auth.wrap(negStateAcceptIncomplete, challenge, nil))
+	case ntlmAuthenticate:
+		a, err := parseAuthenticate(t.mechToken)
+		if err != nil {
+			return fail(err)
+		}
+		VFS, flags, sessionKey, err := c.s.authenticate(auth, a)
+		if err != nil {
+			return fail(err)
+		}
+		var mechListMIC []byte
+		if sessionKey != nil && auth.mechTypes != nil && t.mechListMIC != nil {
+			want := ntlmMAC(a.flags, sessionKey, true, auth.mechTypes)
+			if want != nil && !hmac.Equal(want, t.mechListMIC) {
+				return fail(errors.New("bad mechListMIC"))
+			}
+			mechListMIC = ntlmMAC(a.flags, sessionKey, false, auth.mechTypes)
+		}
+		c.mu.Lock()
+		if sessionKey != nil && sess.signer == nil {
+			sess.signer, err = newSigner(dialect, sessionKey, sess.preauth[:])
+		}
+		c.mu.Unlock()
+		if err != nil {
+			return fail(err)
+		}
+		c.mu.Lock()
+		sess.user = a.user
+		sess.flags = flags
+		sess.vfs = VFS
+		sess.valid = true
+		sess.auth = nil
+		c.mu.Unlock()
+		r.sess = sess
+		r.signAlways = true
+		fs.Debugf(nil, "SMB session %d from %s: logged in %v", sess.id, c.nc.RemoteAddr(), a)
+		return statusSuccess, sessionSetupResponse(flags, auth.wrap(negStateAcceptCompleted, nil, mechListMIC))
+	}
+	return fail(errBadToken)
+}
+
+// sessionSetupResponse returns the body of a SESSION_SETUP response
+func sessionSetupResponse(flags uint16, token []byte) []byte {
+	body := make([]byte, 8+len(token))
+	le.PutUint16(body[0:], 9)
+	le.PutUint16(body[2:], flags)
+	le.PutUint16(body[4:], smb2HeaderSize+8)
+	le.PutUint16(body[6:], uint16(len(token)))
+	copy(body[8:], token)
+	return body
+}
+
+// logoff handles the LOGOFF command
+func (c *conn) logoff(r *request) (uint32, []byte) {
+	c.mu.Lock()
+	delete(c.sessions, r.sess.id)
+	opens := c.removeOpens(func(of *openFile) bool {
+		return of.tree.sess == r.sess
+	})
+	c.mu.Unlock()
+	for _, of := range opens {
+		of.close()
+	}
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
+
+// treeConnect handles the TREE_CONNECT command
+func (c *conn) treeConnect(r *request) (uint32, []byte) {
+	b := r.body
+	if len(b) < 8 {
+		return statusInvalidParameter, nil
+	}
+	path := field(r.msg, int(le.Uint16(b[4:])), int(le.Uint16(b[6:])))
+	if path == nil {
+		return statusInvalidParameter, nil
+	}
+	// The path is \\server\share
+	share := decodeUTF16(path)
+	share = share[strings.LastIndex(share, `\`)+1:]
+	t := &tree{sess: r.sess}
+	body := make([]byte, 16)
+	le.PutUint16(body[0:], 16)
+	switch {
+	case strings.EqualFold(share, "IPC$"):
+		t.ipc = true
+		body[2] = shareTypePipe
+		le.PutUint32(body[12:], fileAllAccess)
+	case strings.EqualFold(share, c.s.opt.ShareName):
+		body[2] = shareTypeDisk
+		le.PutUint32(body[4:], shareFlagNoCaching)
+		if r.sess.vfs.Opt.ReadOnly {
+			le.PutUint32(body[12:], fileGenericReadExec)
+		} else {
+			le.PutUint32(body[12:], fileAllAccess)
+		}
+	default:
+		return statusBadNetworkName, nil
+	}
+	c.mu.Lock()
+	c.nextTreeID++
+	t.id = c.nextTreeID
+	r.sess.trees[t.id] = t
+	c.mu.Unlock()
+	r.treeID = t.id
+	return statusSuccess, body
+}
+
+// treeDisconnect handles the TREE_DISCONNECT command
+func (c *conn) treeDisconnect(r *request) (uint32, []byte) {
+	c.mu.Lock()
+	delete(r.sess.trees, r.tree.id)
+	opens := c.removeOpens(func(of *openFile) bool {
+		return of.tree == r.tree
+	})
+	c.mu.Unlock()
+	for _, of := range opens {
+		of.close()
+	}
+	return statusSuccess, []byte{4, 0, 0, 0}
+}
+
+// removeOpens removes the open files which match from the connection
+// returning them
+//
+// Call with c.mu held
+func (c *conn) removeOpens(match func(of *openFile) bool) (opens []*openFile) {
+	for id, of := range c.opens {
+		if match(of) {
+			delete(c.opens, id)
+			opens = append(opens, of)
+		}
+	}
+	return opens
+}
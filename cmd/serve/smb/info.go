@@ -0,0 +1,291 @@
+package smb
+
+import (
+	"strings"
+
+	"github.com/rclone/rclone/vfs"
+)
+
+// This file contains the encodings of the information classes from
+// MS-FSCC which describe files, directories and the file system.
+
+// fileAttributes returns the Windows attributes of node
+func fileAttributes(node vfs.Node) uint32 {
+	if node.IsDir() {
+		return fileAttributeDirectory
+	}
+	if node.VFS().Opt.ReadOnly {
+		return fileAttributeArchive | fileAttributeReadonly
+	}
+	return fileAttributeArchive
+}
+
+// allocationSize returns the space the file takes up on disk
+func allocationSize(node vfs.Node) uint64 {
+	if node.IsDir() {
+		return 0
+	}
+	return uint64((node.Size() + allocationUnit - 1) / allocationUnit * allocationUnit)
+}
+
+// putTimes writes the creation, last access, last write and change
+// times of node into b. Only the modification time is known so all
+// are set to that.
+func putTimes(b []byte, node vfs.Node) {
+	t := filetime(node.ModTime())
+	for i := 0; i < 4; i++ {
+		le.PutUint64(b[8*i:], t)
+	}
+}
+
+// putSizes writes the allocation size and end of file of node into b
+func putSizes(b []byte, node vfs.Node) {
+	le.PutUint64(b[0:], allocationSize(node))
+	if !node.IsDir() {
+		le.PutUint64(b[8:], uint64(node.Size()))
+	}
+}
+
+// windowsName returns the name of the file from the root of the share
+// as Windows would write it
+func windowsName(p string) string {
+	return `\` + strings.ReplaceAll(p, "/", `\`)
+}
+
+// putName returns b with the length and UTF-16 encoding of name
+// appended
+func putName(b []byte, name string) []byte {
+	u := encodeUTF16(name)
+	n := len(b)
+	b = append(b, make([]byte, 4)...)
+	le.PutUint32(b[n:], uint32(len(u)))
+	return append(b, u...)
+}
+
+// fileInfo returns the information of the class for the open file,
+// with a status and whether the data may be truncated to fit
+func (of *openFile) fileInfo(class byte, node vfs.Node) (data []byte, status uint32, variable bool) {
+	of.mu.Lock()
+	name := windowsName(of.path)
+	deletePending := of.deleteOnClose
+	of.mu.Unlock()
+	basic := func() []byte {
+		b := make([]byte, 40)
+		putTimes(b, node)
+		le.PutUint32(b[32:], fileAttributes(node))
+		return b
+	}
+	standard := func() []byte {
+		b := make([]byte, 24)
+		putSizes(b, node)
+		le.PutUint32(b[16:], 1) // NumberOfLinks
+		if deletePending {
+			b[20] = 1
+		}
+		if node.IsDir() {
+			b[21] = 1
+		}
+		return b
+	}
+	internal := func() []byte {
+		b := make([]byte, 8)
+		le.PutUint64(b, node.Inode())
+		return b
+	}
+	access := func() []byte {
+		b := make([]byte, 4)
+		le.PutUint32(b, of.access)
+		return b
+	}
+	switch class {
+	case fileBasicInformation:
+		return basic(), statusSuccess, false
+	case fileStandardInformation:
+		return standard(), statusSuccess, false
+	case fileInternalInformation:
+		return internal(), statusSuccess, false
+	case fileEaInformation, fileModeInformation, fileAlignmentInformation:
+		return make([]byte, 4), statusSuccess, false
+	case fileAccessInformation:
+		return access(), statusSuccess, false
+	case filePositionInformation:
+		return make([]byte, 8), statusSuccess, false
+	case fileNameInformation:
+		return putName(nil, name), statusSuccess, true
+	case fileNormalizedNameInformation:
+		return putName(nil, strings.TrimPrefix(name, `\`)), statusSuccess, true
+	case fileAllInformation:
+		b := append(basic(), standard()...)
+		b = append(b, internal()...)
+		b = append(b, 0, 0, 0, 0) // EaSize
+		b = append(b, access()...)
+		b = append(b, make([]byte, 8+4+4)...) // Position, Mode and Alignment
+		return putName(b, name), statusSuccess, true
+	case fileAlternateNameInformation:
+		// There are no 8.3 names
+		return nil, statusObjectNameNotFound, false
+	case fileStreamInformation:
+		if node.IsDir() {
+			return nil, statusSuccess, true
+		}
+		streamName := encodeUTF16("::$DATA")
+		b := make([]byte, 24, 24+len(streamName))
+		le.PutUint32(b[4:], uint32(len(streamName)))
+		le.PutUint64(b[8:], uint64(node.Size()))
+		le.PutUint64(b[16:], allocationSize(node))
+		return append(b, streamName...), statusSuccess, true
+	case fileNetworkOpenInformation:
+		b := make([]byte, 56)
+		putTimes(b, node)
+		putSizes(b[32:], node)
+		le.PutUint32(b[48:], fileAttributes(node))
+		return b, statusSuccess, false
+	case fileAttributeTagInformation:
+		b := make([]byte, 8)
+		le.PutUint32(b, fileAttributes(node))
+		return b, statusSuccess, false
+	}
+	return nil, statusInvalidInfoClass, false
+}
+
+// fsInfo returns the file system information of the class for the
+// VFS, with a status and whether the data may be truncated to fit
+func (c *conn) fsInfo(class byte, VFS *vfs.VFS) (data []byte, status uint32, variable bool) {
+	switch class {
+	case fileFsVolumeInformation:
+		b := make([]byte, 18)
+		le.PutUint64(b[0:], filetime(c.s.started))
+		le.PutUint32(b[8:], serialNumber(c.s.guid))
+		label := encodeUTF16(c.s.opt.ShareName)
+		le.PutUint32(b[12:], uint32(len(label)))
+		return append(b, label...), statusSuccess, true
+	case fileFsSizeInformation, fileFsFullSizeInformation:
+		total, _, free := VFS.Statfs()
+		units := func(n int64) uint64 {
+			return uint64(n / allocationUnit)
+		}
+		b := make([]byte, 16)
+		le.PutUint64(b[0:], units(total))
+		le.PutUint64(b[8:], units(free))
+		if class == fileFsFullSizeInformation {
+			b = append(b, b[8:16]...) // ActualAvailableAllocationUnits
+		}
+		tail := make([]byte, 8)
+		le.PutUint32(tail[0:], sectorsPerAllocationUnit)
+		le.PutUint32(tail[4:], bytesPerSector)
+		return append(b, tail...), statusSuccess, false
+	case fileFsDeviceInformation:
+		b := make([]byte, 8)
+		le.PutUint32(b[0:], fileDeviceDisk)
+		le.PutUint32(b[4:], fileRemoteDevice)
+		return b, statusSuccess, false
+	case fileFsAttributeInformation:
+		attributes := uint32(fileCasePreservedNames | fileUnicodeOnDisk)
+		if !VFS.Opt.CaseInsensitive {
+			attributes |= fileCaseSensitiveSearch
+		}
+		if VFS.Opt.ReadOnly {
+			attributes |= fileReadOnlyVolume
+		}
+		b := make([]byte, 8)
+		le.PutUint32(b[0:], attributes)
+		le.PutUint32(b[4:], maxComponentNameLength)
+		return putName(b, "NTFS"), statusSuccess, true
+	case fileFsSectorSizeInformation:
+		b := make([]byte, 28)
+		for i := 0; i < 4; i++ {
+			le.PutUint32(b[4*i:], bytesPerSector)
+		}
+		return b, statusSuccess, false
+	}
+	return nil, statusInvalidInfoClass, false
+}
+
+// serialNumber makes the volume serial number from the server GUID
+func serialNumber(guid [16]byte) uint32 {
+	return le.Uint32(guid[:])
+}
+
+// The SID S-1-1-0 of Everyone
+var sidEveryone = []byte{1, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+
+// securityDescriptor returns a self relative security descriptor with
+// the parts asked for in additional. Everyone is the owner and has
+// full access, or read access if the VFS is read only.
+func securityDescriptor(additional uint32, isDir, readOnly bool) []byte {
+	sd := make([]byte, 20)
+	sd[0] = 1 // Revision
+	control := uint16(securityDescriptorSelfRelative)
+	if additional&ownerSecurityInformation != 0 {
+		le.PutUint32(sd[4:], uint32(len(sd)))
+		sd = append(sd, sidEveryone...)
+	}
+	if additional&groupSecurityInformation != 0 {
+		le.PutUint32(sd[8:], uint32(len(sd)))
+		sd = append(sd, sidEveryone...)
+	}
+	if additional&daclSecurityInformation != 0 {
+		control |= securityDescriptorDACLPresent
+		le.PutUint32(sd[16:], uint32(len(sd)))
+		ace := make([]byte, 8, 8+len(sidEveryone))
+		ace[0] = aceAccessAllowed
+		if isDir {
+			ace[1] = aceObjectAndContainerInherit
+		}
+		le.PutUint16(ace[2:], uint16(cap(ace)))
+		if readOnly {
+			le.PutUint32(ace[4:], fileGenericReadExec)
+		} else {
+			le.PutUint32(ace[4:], fileAllAccess)
+		}
+		ace = append(ace, sidEveryone...)
+		acl := make([]byte, 8)
+		acl[0] = 2 // AclRevision
+		le.PutUint16(acl[2:], uint16(len(acl)+len(ace)))
+		le.PutUint16(acl[4:], 1) // AceCount
+		sd = append(append(sd, acl...), ace...)
+	}
+	le.PutUint16(sd[2:], control)
+	return sd
+}
+
+// encodeDirEntry returns the entry for a directory listing in the
+// class, with the NextEntryOffset left as 0
+func encodeDirEntry(class byte, entry dirEntry) []byte {
+	name := encodeUTF16(entry.name)
+	if class == fileNamesInformation {
+		b := make([]byte, 12, 12+len(name))
+		le.PutUint32(b[8:], uint32(len(name)))
+		return append(b, name...)
+	}
+	// The size of the fixed part of each class
+	var size int
+	switch class {
+	case fileDirectoryInformation:
+		size = 64
+	case fileFullDirectoryInformation:
+		size = 68
+	case fileIDFullDirectoryInformation:
+		size = 80
+	case fileBothDirectoryInformation:
+		size = 94
+	case fileIDBothDirectoryInformation:
+		size = 104
+	}
+	b := make([]byte, size, size+len(name))
+	node := entry.node
+	putTimes(b[8:], node)
+	if !node.IsDir() {
+		le.PutUint64(b[40:], uint64(node.Size()))
+	}
+	le.PutUint64(b[48:], allocationSize(node))
+	le.PutUint32(b[56:], fileAttributes(node))
+	le.PutUint32(b[60:], uint32(len(name)))
+	switch class {
+	case fileIDFullDirectoryInformation:
+		le.PutUint64(b[72:], node.Inode())
+	case fileIDBothDirectoryInformation:
+		le.PutUint64(b[96:], node.Inode())
+	}
+	return append(b, name...)
+}
@@ -0,0 +1,380 @@
+package smb
+
+import (
+	"encoding/binary"
+	"time"
+	"unicode/utf16"
+)
+
+// This file contains the constants and encodings of the SMB2 protocol
+// from MS-SMB2 and MS-FSCC which the server uses.
+
+var le = binary.LittleEndian
+
+// The SMB2 dialects
+const (
+	dialect202      = 0x0202
+	dialect210      = 0x0210
+	dialect300      = 0x0300
+	dialect302      = 0x0302
+	dialect311      = 0x0311
+	dialectWildcard = 0x02FF // SMB2 negotiate response to an SMB1 negotiate
+)
+
+// The dialects the server supports from most to least preferred
+var serverDialects = []uint16{dialect311, dialect302, dialect300, dialect210, dialect202}
+
+// The SMB2 commands
+const (
+	cmdNegotiate      = 0x0000
+	cmdSessionSetup   = 0x0001
+	cmdLogoff         = 0x0002
+	cmdTreeConnect    = 0x0003
+	cmdTreeDisconnect = 0x0004
+	cmdCreate         = 0x0005
+	cmdClose          = 0x0006
+	cmdFlush          = 0x0007
+	cmdRead           = 0x0008
+	cmdWrite          = 0x0009
+	cmdLock           = 0x000A
+	cmdIoctl          = 0x000B
+	cmdCancel         = 0x000C
+	cmdEcho           = 0x000D
+	cmdQueryDirectory = 0x000E
+	cmdChangeNotify   = 0x000F
+	cmdQueryInfo      = 0x0010
+	cmdSetInfo        = 0x0011
+)
+
+// Header flags
+const (
+	flagsServerToRedir     = 0x00000001
+	flagsAsyncCommand      = 0x00000002
+	flagsRelatedOperations = 0x00000004
+	flagsSigned            = 0x00000008
+)
+
+// NTSTATUS codes
+const (
+	statusSuccess                = 0x00000000
+	statusBufferOverflow         = 0x80000005
+	statusNoMoreFiles            = 0x80000006
+	statusInvalidInfoClass       = 0xC0000003
+	statusInfoLengthMismatch     = 0xC0000004
+	statusInvalidParameter       = 0xC000000D
+	statusNoSuchFile             = 0xC000000F
+	statusInvalidDeviceRequest   = 0xC0000010
+	statusEndOfFile              = 0xC0000011
+	statusMoreProcessingRequired = 0xC0000016
+	statusAccessDenied           = 0xC0000022
+	statusBufferTooSmall         = 0xC0000023
+	statusObjectNameInvalid      = 0xC0000033
+	statusObjectNameNotFound     = 0xC0000034
+	statusObjectNameCollision    = 0xC0000035
+	statusObjectPathNotFound     = 0xC000003A
+	statusLogonFailure           = 0xC000006D
+	statusMediaWriteProtected    = 0xC00000A2
+	statusFileIsADirectory       = 0xC00000BA
+	statusNotSupported           = 0xC00000BB
+	statusNetworkNameDeleted     = 0xC00000C9
+	statusBadNetworkName         = 0xC00000CC
+	statusUnexpectedIOError      = 0xC00000E9
+	statusDirectoryNotEmpty      = 0xC0000101
+	statusNotADirectory          = 0xC0000103
+	statusFileClosed             = 0xC0000128
+	statusUserSessionDeleted     = 0xC0000203
+	statusNotAReparsePoint       = 0xC0000275
+)
+
+// Negotiate security modes and capabilities
+const (
+	negotiateSigningEnabled  = 0x0001
+	negotiateSigningRequired = 0x0002
+	globalCapLargeMTU        = 0x00000004
+)
+
+// Negotiate context types
+const (
+	preauthIntegrityCapabilities = 0x0001
+	hashAlgorithmSHA512          = 0x0001
+)
+
+// Session flags
+const (
+	sessionFlagIsGuest = 0x0001
+	sessionFlagIsNull  = 0x0002
+)
+
+// Share types and flags and access masks
+const (
+	shareTypeDisk        = 0x01
+	shareTypePipe        = 0x02
+	shareFlagNoCaching   = 0x00000030
+	fileAllAccess        = 0x001F01FF
+	fileGenericReadExec  = 0x001200A9
+	fileWriteData        = 0x00000002
+	fileAppendData       = 0x00000004
+	accessDelete         = 0x00010000
+	accessMaximumAllowed = 0x02000000
+	accessGenericAll     = 0x10000000
+	accessGenericWrite   = 0x40000000
+)
+
+// Create dispositions, options and actions
+const (
+	fileSupersede   = 0x00000000
+	fileOpen        = 0x00000001
+	fileCreate      = 0x00000002
+	fileOpenIf      = 0x00000003
+	fileOverwrite   = 0x00000004
+	fileOverwriteIf = 0x00000005
+
+	fileDirectoryFile    = 0x00000001
+	fileNonDirectoryFile = 0x00000040
+	fileDeleteOnClose    = 0x00001000
+
+	fileSuperseded  = 0x00000000
+	fileOpened      = 0x00000001
+	fileCreated     = 0x00000002
+	fileOverwritten = 0x00000003
+)
+
+// File attributes
+const (
+	fileAttributeReadonly  = 0x00000001
+	fileAttributeDirectory = 0x00000010
+	fileAttributeArchive   = 0x00000020
+)
+
+// Flags for CLOSE and QUERY_DIRECTORY
+const (
+	closeFlagPostQueryAttrib = 0x0001
+
+	restartScans      = 0x01
+	returnSingleEntry = 0x02
+	reopen            = 0x10
+)
+
+// Info types for QUERY_INFO and SET_INFO
+const (
+	infoFile       = 0x01
+	infoFilesystem = 0x02
+	infoSecurity   = 0x03
+)
+
+// File information classes
+const (
+	fileDirectoryInformation       = 1
+	fileFullDirectoryInformation   = 2
+	fileBothDirectoryInformation   = 3
+	fileBasicInformation           = 4
+	fileStandardInformation        = 5
+	fileInternalInformation        = 6
+	fileEaInformation              = 7
+	fileAccessInformation          = 8
+	fileNameInformation            = 9
+	fileRenameInformation          = 10
+	fileNamesInformation           = 12
+	fileDispositionInformation     = 13
+	filePositionInformation        = 14
+	fileModeInformation            = 16
+	fileAlignmentInformation       = 17
+	fileAllInformation             = 18
+	fileAllocationInformation      = 19
+	fileEndOfFileInformation       = 20
+	fileAlternateNameInformation   = 21
+	fileStreamInformation          = 22
+	fileNetworkOpenInformation     = 34
+	fileAttributeTagInformation    = 35
+	fileIDBothDirectoryInformation = 37
+	fileIDFullDirectoryInformation = 38
+	fileNormalizedNameInformation  = 48
+	fileDispositionInformationEx   = 64
+
+	fileDispositionFlagDelete = 0x00000001
+)
+
+// File system information classes and the values in them
+const (
+	fileFsVolumeInformation     = 1
+	fileFsSizeInformation       = 3
+	fileFsDeviceInformation     = 4
+	fileFsAttributeInformation  = 5
+	fileFsFullSizeInformation   = 7
+	fileFsSectorSizeInformation = 11
+
+	fileDeviceDisk          = 0x00000007
+	fileRemoteDevice        = 0x00000010
+	fileCaseSensitiveSearch = 0x00000001
+	fileCasePreservedNames  = 0x00000002
+	fileUnicodeOnDisk       = 0x00000004
+	fileReadOnlyVolume      = 0x00080000
+
+	bytesPerSector           = 512
+	sectorsPerAllocationUnit = 8
+	allocationUnit           = bytesPerSector * sectorsPerAllocationUnit
+	maxComponentNameLength   = 255
+)
+
+// Security descriptors
+const (
+	ownerSecurityInformation       = 0x00000001
+	groupSecurityInformation       = 0x00000002
+	daclSecurityInformation        = 0x00000004
+	securityDescriptorSelfRelative = 0x8000
+	securityDescriptorDACLPresent  = 0x0004
+	aceAccessAllowed               = 0x00
+	aceObjectAndContainerInherit   = 0x03
+)
+
+// IOCTL control codes and flags
+const (
+	fsctlValidateNegotiateInfo = 0x00140204
+	fsctlGetReparsePoint       = 0x000900A8
+	fsctlPipeTransceive        = 0x0011C017
+)
+
+// Sizes and limits
+const (
+	smb2HeaderSize    = 64
+	maxCreditsGranted = 512
+	maxTransactSize   = 1 << 20
+	maxMessageSize    = maxTransactSize + 64*1024
+)
+
+// Protocol IDs at the start of the messages
+const (
+	protocolIDSMB1 uint32 = 0x424D53FF // "\xffSMB"
+	protocolIDSMB2 uint32 = 0x424D53FE // "\xfeSMB"
+)
+
+// header is a decoded SMB2 sync packet header
+type header struct {
+	creditCharge uint16
+	status       uint32
+	command      uint16
+	credits      uint16
+	flags        uint32
+	nextCommand  uint32
+	messageID    uint64
+	asyncID      uint64 // set if flagsAsyncCommand
+	treeID       uint32
+	sessionID    uint64
+	signature    [16]byte
+}
+
+// decodeHeader decodes the header at the start of msg which must be
+// at least smb2HeaderSize long
+func decodeHeader(msg []byte) (h header) {
+	h.creditCharge = le.Uint16(msg[6:])
+	h.status = le.Uint32(msg[8:])
+	h.command = le.Uint16(msg[12:])
+	h.credits = le.Uint16(msg[14:])
+	h.flags = le.Uint32(msg[16:])
+	h.nextCommand = le.Uint32(msg[20:])
+	h.messageID = le.Uint64(msg[24:])
+	if h.flags&flagsAsyncCommand != 0 {
+		h.asyncID = le.Uint64(msg[32:])
+	} else {
+		h.treeID = le.Uint32(msg[36:])
+	}
+	h.sessionID = le.Uint64(msg[40:])
+	copy(h.signature[:], msg[48:64])
+	return h
+}
+
+// encode writes the header into the start of msg
+func (h *header) encode(msg []byte) {
+	le.PutUint32(msg[0:], protocolIDSMB2)
+	le.PutUint16(msg[4:], smb2HeaderSize)
+	le.PutUint16(msg[6:], h.creditCharge)
+	le.PutUint32(msg[8:], h.status)
+	le.PutUint16(msg[12:], h.command)
+	le.PutUint16(msg[14:], h.credits)
+	le.PutUint32(msg[16:], h.flags)
+	le.PutUint32(msg[20:], h.nextCommand)
+	le.PutUint64(msg[24:], h.messageID)
+	if h.flags&flagsAsyncCommand != 0 {
+		le.PutUint64(msg[32:], h.asyncID)
+	} else {
+		le.PutUint32(msg[32:], 0xFEFF) // Reserved - what Windows sends
+		le.PutUint32(msg[36:], h.treeID)
+	}
+	le.PutUint64(msg[40:], h.sessionID)
+	copy(msg[48:64], h.signature[:])
+}
+
+// fileID identifies an open file
+type fileID struct {
+	persistent uint64
+	volatile   uint64
+}
+
+// The file ID used in compounded requests to refer to the file
+// opened by the previous request
+var relatedFileID = fileID{persistent: ^uint64(0), volatile: ^uint64(0)}
+
+// decodeFileID decodes the 16 byte file ID in b
+func decodeFileID(b []byte) fileID {
+	return fileID{
+		persistent: le.Uint64(b[0:]),
+		volatile:   le.Uint64(b[8:]),
+	}
+}
+
+// encode writes the 16 byte file ID into b
+func (id fileID) encode(b []byte) {
+	le.PutUint64(b[0:], id.persistent)
+	le.PutUint64(b[8:], id.volatile)
+}
+
+// encodeUTF16 returns s encoded as UTF-16LE
+func encodeUTF16(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		le.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// decodeUTF16 decodes the UTF-16LE in b
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = le.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// The difference between the Windows epoch (1601) and the Unix epoch
+// in 100ns intervals
+const filetimeUnixEpoch = 116444736000000000
+
+// filetime converts t to a Windows FILETIME
+func filetime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano()/100 + filetimeUnixEpoch)
+}
+
+// filetimeToTime converts a Windows FILETIME to a time.Time
+func filetimeToTime(ft uint64) time.Time {
+	return time.Unix(0, (int64(ft)-filetimeUnixEpoch)*100)
+}
+
+// roundUp rounds n up to a multiple of align which must be a power of 2
+func roundUp(n, align int) int {
+	return (n + align - 1) &^ (align - 1)
+}
+
+// field returns the size bytes of msg at offset off, or nil if they
+// aren't all in msg. Offsets in SMB2 messages are from the start of
+// the header.
+func field(msg []byte, off, size int) []byte {
+	if off < 0 || size < 0 || off+size > len(msg) || off+size < off {
+		return nil
+	}
+	return msg[off : off+size]
+}
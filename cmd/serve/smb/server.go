@@ -0,0 +1,619 @@
+package smb
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfsflags"
+)
+
+// Server is an SMB2/3 server serving a VFS
+type Server struct {
+	ctx       context.Context // for global config
+	opt       Options
+	vfs       *vfs.VFS     // the VFS if not using the auth proxy
+	proxy     *proxy.Proxy // may be nil if not in use
+	listener  net.Listener
+	guid      [16]byte // identifies the server to the clients
+	name      string   // NetBIOS name of the server
+	started   time.Time
+	sessionID uint64 // last session ID handed out - atomic
+
+	mu     sync.Mutex
+	conns  map[*conn]struct{}
+	closed bool
+	wg     sync.WaitGroup // for the connections
+}
+
+// newServer makes a new SMB server serving f, or the remotes the
+// auth proxy returns if it is configured
+func newServer(ctx context.Context, f fs.Fs, opt *Options) (*Server, error) {
+	s := &Server{
+		ctx:     ctx,
+		opt:     *opt,
+		name:    netbiosName(),
+		started: time.Now(),
+		conns:   make(map[*conn]struct{}),
+	}
+	if proxyflags.Opt.AuthProxy != "" {
+		if s.opt.User != "" {
+			return nil, errors.New("--auth-proxy and --user cannot be used at the same time")
+		}
+		s.proxy = proxy.New(ctx, &proxyflags.Opt)
+	} else {
+		vfsOpt := vfsflags.Opt
+		if s.opt.User == "" {
+			// Anyone can log in as a guest so don't let them
+			// change anything
+			fs.Logf(nil, "Serving read only to guests as --user isn't set")
+			vfsOpt.ReadOnly = true
+		}
+		s.vfs = vfs.New(f, &vfsOpt)
+	}
+	if s.opt.ShareName == "" || strings.ContainsAny(s.opt.ShareName, `\/:*?"<>|`) {
+		return nil, fmt.Errorf("invalid share name %q", s.opt.ShareName)
+	}
+	if strings.EqualFold(s.opt.ShareName, "IPC$") {
+		return nil, errors.New("the share can't be called IPC$")
+	}
+	if _, err := rand.Read(s.guid[:]); err != nil {
+		return nil, err
+	}
+	var err error
+	s.listener, err = net.Listen("tcp", s.opt.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %q: %w", s.opt.ListenAddr, err)
+	}
+	return s, nil
+}
+
+// netbiosName makes the NetBIOS name of the server from the host name
+func netbiosName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "RCLONE"
+	}
+	name, _, _ = strings.Cut(name, ".")
+	if len(name) > 15 {
+		name = name[:15]
+	}
+	return strings.ToUpper(name)
+}
+
+// Addr returns the listening address of the server
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve accepts connections until the server is shut down
+func (s *Server) Serve() error {
+	fs.Logf(nil, "SMB server listening on %s serving share %q", s.listener.Addr(), s.opt.ShareName)
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return fmt.Errorf("accept failed: %w", err)
+		}
+		c := newConn(s, nc)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = nc.Close()
+			return nil
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Shutdown stops the server closing all the connections
+func (s *Server) Shutdown() error {
+	s.mu.Lock()
+	s.closed = true
+	err := s.listener.Close()
+	for c := range s.conns {
+		_ = c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	if s.vfs != nil {
+		s.vfs.Shutdown()
+	}
+	return err
+}
+
+// newSessionID returns a new session ID
+func (s *Server) newSessionID() uint64 {
+	return atomic.AddUint64(&s.sessionID, 1)
+}
+
+// authenticate checks the NTLM authentication a against the
+// configured users returning the VFS and the session flags for the
+// user and the session key to sign with, or nil if the session is a
+// guest session which doesn't sign.
+func (s *Server) authenticate(auth *authState, a *authenticateMessage) (VFS *vfs.VFS, flags uint16, sessionKey []byte, err error) {
+	switch {
+	case s.proxy != nil:
+		if a.anonymousLogon {
+			return nil, 0, nil, errLogonFailed
+		}
+		VFS, _, err := s.proxy.CallUser(a.user, func(password string) (err error) {
+			sessionKey, err = auth.ntlm.verify(a, password)
+			return err
+		})
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return VFS, 0, sessionKey, nil
+	case s.opt.User != "":
+		if a.anonymousLogon || !strings.EqualFold(a.user, s.opt.User) {
+			return nil, 0, nil, errLogonFailed
+		}
+		sessionKey, err = auth.ntlm.verify(a, s.opt.Pass)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return s.vfs, 0, sessionKey, nil
+	default:
+		// No users are configured so everyone gets in as a
+		// guest with read only access
+		if a.anonymousLogon {
+			return s.vfs, sessionFlagIsNull, nil, nil
+		}
+		return s.vfs, sessionFlagIsGuest, nil, nil
+	}
+}
+
+// session is an authenticated user on a connection
+type session struct {
+	id      uint64
+	user    string
+	flags   uint16 // session flags - guest or null
+	vfs     *vfs.VFS
+	signer  *signer    // nil if the session isn't signed
+	auth    *authState // set while authenticating
+	valid   bool       // set once authenticated
+	preauth [sha512.Size]byte
+	trees   map[uint32]*tree
+}
+
+// tree is a connection to a share in a session
+type tree struct {
+	id   uint32
+	sess *session
+	ipc  bool // set if this is the IPC$ share
+}
+
+// conn is a connection from a client
+type conn struct {
+	s  *Server
+	nc net.Conn
+
+	writeMu sync.Mutex // held while writing to nc
+
+	mu         sync.Mutex // protects the fields below
+	negotiated bool
+	dialect    uint16
+	clientGUID [16]byte
+	clientMode uint16 // security mode from the client's negotiate
+	clientCaps uint32
+	dialects   []uint16 // dialects from the client's negotiate
+	preauth    [sha512.Size]byte
+	sessions   map[uint64]*session
+	opens      map[fileID]*openFile
+	nextTreeID uint32
+	nextFileID uint64
+
+	wg sync.WaitGroup // for the requests in progress
+}
+
+// newConn makes a new connection from nc
+func newConn(s *Server, nc net.Conn) *conn {
+	return &conn{
+		s:        s,
+		nc:       nc,
+		sessions: make(map[uint64]*session),
+		opens:    make(map[fileID]*openFile),
+	}
+}
+
+// serve reads requests from the connection and runs them until the
+// connection is closed
+func (c *conn) serve() {
+	fs.Debugf(nil, "SMB connection from %s", c.nc.RemoteAddr())
+	defer c.close()
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				fs.Debugf(nil, "SMB connection from %s: %v", c.nc.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(msg) >= 4 && le.Uint32(msg) == protocolIDSMB1 {
+			if err := c.negotiateSMB1(msg); err != nil {
+				fs.Debugf(nil, "SMB connection from %s: %v", c.nc.RemoteAddr(), err)
+				return
+			}
+			continue
+		}
+		if len(msg) < smb2HeaderSize || le.Uint32(msg) != protocolIDSMB2 {
+			fs.Debugf(nil, "SMB connection from %s: bad message", c.nc.RemoteAddr())
+			return
+		}
+		// The negotiation and authentication update the
+		// pre-authentication hash so they must be run in order.
+		// Other requests are run concurrently.
+		switch le.Uint16(msg[12:]) {
+		case cmdNegotiate, cmdSessionSetup:
+			c.wg.Wait()
+			c.process(msg)
+		default:
+			c.wg.Add(1)
+			go func() {
+				defer c.wg.Done()
+				c.process(msg)
+			}()
+		}
+	}
+}
+
+// close closes the connection and all the files opened on it
+func (c *conn) close() {
+	_ = c.nc.Close()
+	c.wg.Wait()
+	c.mu.Lock()
+	opens := c.opens
+	c.opens = make(map[fileID]*openFile)
+	c.sessions = make(map[uint64]*session)
+	c.mu.Unlock()
+	for _, of := range opens {
+		of.close()
+	}
+	fs.Debugf(nil, "SMB connection from %s closed", c.nc.RemoteAddr())
+}
+
+// readMessage reads a message in its 4 byte direct TCP transport
+// frame
+func (c *conn) readMessage() ([]byte, error) {
+	var frame [4]byte
+	if _, err := io.ReadFull(c.nc, frame[:]); err != nil {
+		return nil, err
+	}
+	if frame[0] != 0 {
+		return nil, fmt.Errorf("bad frame type %d", frame[0])
+	}
+	size := int(frame[1])<<16 | int(frame[2])<<8 | int(frame[3])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message too large: %d bytes", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(c.nc, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeMessage writes msg to the client in a transport frame
+func (c *conn) writeMessage(msg []byte) error {
+	frame := []byte{0, byte(len(msg) >> 16), byte(len(msg) >> 8), byte(len(msg))}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.nc.Write(append(frame, msg...))
+	return err
+}
+
+// request is a single SMB2 request being processed, which may be one
+// of a compound
+type request struct {
+	hdr  header
+	msg  []byte // the message including the header
+	body []byte // the message after the header
+	sess *session
+	tree *tree
+
+	// Set by the handlers
+	sessionID   uint64   // session ID to respond with
+	treeID      uint32   // tree ID to respond with
+	fileID      fileID   // file opened by this request for related requests
+	errorData   []byte   // data for the error response
+	signAlways  bool     // sign the response even if the request wasn't signed
+	preauthSess *session // session whose preauth hash the response updates
+	noResponse  bool     // don't send a response
+}
+
+// process runs the requests in msg, which may be a compound, and
+// sends the responses
+func (c *conn) process(msg []byte) {
+	var (
+		out  []byte // responses so far
+		last int    // offset of the last response in out
+		prev *request
+		sign []*session // sessions to sign each response with
+	)
+	for len(msg) > 0 {
+		if len(msg) < smb2HeaderSize {
+			break
+		}
+		hdr := decodeHeader(msg)
+		this := msg
+		if hdr.nextCommand != 0 {
+			if hdr.nextCommand < smb2HeaderSize || int(hdr.nextCommand) > len(msg) || hdr.nextCommand%8 != 0 {
+				break
+			}
+			this, msg = msg[:hdr.nextCommand], msg[hdr.nextCommand:]
+		} else {
+			msg = nil
+		}
+		r := &request{
+			hdr:       hdr,
+			msg:       this,
+			body:      this[smb2HeaderSize:],
+			sessionID: hdr.sessionID,
+			treeID:    hdr.treeID,
+		}
+		related := hdr.flags&flagsRelatedOperations != 0 && prev != nil
+		if related {
+			r.sessionID, r.treeID = prev.sessionID, prev.treeID
+			r.fileID = prev.fileID
+		}
+		var status uint32
+		var body []byte
+		if related && prev.hdr.status != statusSuccess && prev.fileID == (fileID{}) {
+			// A failed request fails the requests related to it
+			status = prev.hdr.status
+		} else {
+			status, body = c.dispatch(r, related)
+		}
+		r.hdr.status = status
+		if r.noResponse {
+			prev = r
+			continue
+		}
+		resp := c.response(r, status, body)
+		if r.preauthSess != nil {
+			c.mu.Lock()
+			r.preauthSess.preauth = preauthHash(r.preauthSess.preauth, resp)
+			c.mu.Unlock()
+		}
+		if r.hdr.command == cmdNegotiate && status == statusSuccess {
+			c.mu.Lock()
+			if c.dialect == dialect311 {
+				c.preauth = preauthHash(preauthHash([sha512.Size]byte{}, r.msg), resp)
+			}
+			c.mu.Unlock()
+		}
+		var signer *session
+		if r.sess != nil && r.sess.signer != nil && (hdr.flags&flagsSigned != 0 || r.signAlways) {
+			signer = r.sess
+		}
+		if out != nil {
+			// Pad the previous response to 8 bytes and link it
+			padded := roundUp(len(out), 8)
+			out = append(out, make([]byte, padded-len(out))...)
+			le.PutUint32(out[last+20:], uint32(padded-last))
+			last = padded
+		}
+		out = append(out, resp...)
+		sign = append(sign, signer)
+		prev = r
+	}
+	if out == nil {
+		return
+	}
+	// Sign each response in the compound now the lengths are known
+	start := 0
+	for _, sess := range sign {
+		end := len(out)
+		if next := le.Uint32(out[start+20:]); next != 0 {
+			end = start + int(next)
+		}
+		if sess != nil {
+			sess.signer.sign(out[start:end])
+		}
+		start = end
+	}
+	if err := c.writeMessage(out); err != nil {
+		fs.Debugf(nil, "SMB connection from %s: write failed: %v", c.nc.RemoteAddr(), err)
+	}
+}
+
+// preauthHash returns the SMB 3.1.1 pre-authentication integrity
+// hash h updated with msg
+func preauthHash(h [sha512.Size]byte, msg []byte) [sha512.Size]byte {
+	d := sha512.New()
+	d.Write(h[:])
+	d.Write(msg)
+	var out [sha512.Size]byte
+	copy(out[:], d.Sum(nil))
+	return out
+}
+
+// response builds the response message for r
+func (c *conn) response(r *request, status uint32, body []byte) []byte {
+	credits := r.hdr.credits
+	if credits == 0 {
+		credits = 1
+	}
+	if credits > maxCreditsGranted {
+		credits = maxCreditsGranted
+	}
+	if status != statusSuccess && body == nil {
+		// The error response
+		body = make([]byte, 9+len(r.errorData))
+		le.PutUint16(body[0:], 9)
+		le.PutUint32(body[4:], uint32(len(r.errorData)))
+		copy(body[8:], r.errorData)
+	}
+	if len(body) >= 2 {
+		// An odd structure size means the body has a variable
+		// part which must be at least one byte long
+		if size := int(le.Uint16(body)); len(body) < size {
+			body = append(body, make([]byte, size-len(body))...)
+		}
+	}
+	h := header{
+		creditCharge: r.hdr.creditCharge,
+		status:       status,
+		command:      r.hdr.command,
+		credits:      credits,
+		flags:        flagsServerToRedir | r.hdr.flags&flagsRelatedOperations,
+		messageID:    r.hdr.messageID,
+		treeID:       r.treeID,
+		sessionID:    r.sessionID,
+	}
+	msg := make([]byte, smb2HeaderSize+len(body))
+	h.encode(msg)
+	copy(msg[smb2HeaderSize:], body)
+	return msg
+}
+
+// dispatch checks the session and tree of r and runs its handler
+func (c *conn) dispatch(r *request, related bool) (status uint32, body []byte) {
+	cmd := r.hdr.command
+	c.mu.Lock()
+	negotiated := c.negotiated
+	c.mu.Unlock()
+	if cmd == cmdNegotiate {
+		return c.negotiate(r)
+	}
+	if !negotiated {
+		return statusInvalidParameter, nil
+	}
+	if cmd == cmdSessionSetup {
+		return c.sessionSetup(r)
+	}
+	if cmd == cmdEcho {
+		return statusSuccess, []byte{4, 0, 0, 0}
+	}
+	if cmd == cmdCancel {
+		// Nothing is run asynchronously so there is nothing to cancel
+		r.noResponse = true
+		return statusSuccess, nil
+	}
+
+	// Look up the session and check the signature
+	c.mu.Lock()
+	sess := c.sessions[r.sessionID]
+	c.mu.Unlock()
+	if sess == nil || !sess.valid {
+		return statusUserSessionDeleted, nil
+	}
+	r.sess = sess
+	// Signing is required so refuse unsigned requests on signed
+	// sessions in case the flag was cleared in transit
+	if sess.signer != nil && (r.hdr.flags&flagsSigned == 0 || !sess.signer.verify(r.msg)) {
+		fs.Debugf(nil, "SMB connection from %s: missing or bad signature", c.nc.RemoteAddr())
+		r.sess = nil // don't sign the response
+		return statusAccessDenied, nil
+	}
+	switch cmd {
+	case cmdLogoff:
+		return c.logoff(r)
+	case cmdTreeConnect:
+		return c.treeConnect(r)
+	}
+
+	// Look up the tree
+	c.mu.Lock()
+	r.tree = sess.trees[r.treeID]
+	c.mu.Unlock()
+	if r.tree == nil {
+		return statusNetworkNameDeleted, nil
+	}
+	switch cmd {
+	case cmdTreeDisconnect:
+		return c.treeDisconnect(r)
+	case cmdCreate:
+		return c.create(r)
+	case cmdClose:
+		return c.closeFile(r)
+	case cmdFlush:
+		return c.flush(r)
+	case cmdRead:
+		return c.read(r)
+	case cmdWrite:
+		return c.write(r)
+	case cmdLock:
+		return c.lock(r)
+	case cmdIoctl:
+		return c.ioctl(r)
+	case cmdQueryDirectory:
+		return c.queryDirectory(r)
+	case cmdChangeNotify:
+		return statusNotSupported, nil
+	case cmdQueryInfo:
+		return c.queryInfo(r)
+	case cmdSetInfo:
+		return c.setInfo(r)
+	}
+	return statusNotSupported, nil
+}
+
+// negotiateSMB1 replies to an SMB1 negotiate from a client which
+// wants to find out if SMB2 is supported
+func (c *conn) negotiateSMB1(msg []byte) error {
+	// The dialect strings follow the 32 byte header, word count and
+	// byte count
+	if len(msg) < 35 || msg[4] != 0x72 {
+		return errors.New("unsupported SMB1 request")
+	}
+	dialect := uint16(0)
+	for _, name := range strings.Split(string(msg[35:]), "\x00") {
+		switch strings.TrimPrefix(name, "\x02") {
+		case "SMB 2.???":
+			dialect = dialectWildcard
+		case "SMB 2.002":
+			if dialect == 0 {
+				dialect = dialect202
+			}
+		}
+	}
+	if dialect == 0 {
+		return errors.New("client doesn't support SMB2")
+	}
+	r := &request{hdr: header{command: cmdNegotiate}}
+	c.mu.Lock()
+	if dialect == dialect202 {
+		c.negotiated = true
+		c.dialect = dialect202
+	}
+	c.mu.Unlock()
+	return c.writeMessage(c.response(r, statusSuccess, c.negotiateResponse(dialect, nil)))
+}
+
+// maxSize returns the maximum read, write and transact size for the
+// dialect
+func maxSize(dialect uint16) uint32 {
+	if dialect == dialect202 || dialect == dialectWildcard {
+		return 65536
+	}
+	return maxTransactSize
+}
@@ -0,0 +1,142 @@
+package smb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+)
+
+// kdf is the SP800-108 counter mode KDF with HMAC-SHA256 which SMB3
+// uses to derive its keys, returning a 128 bit key
+func kdf(key, label, context []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte{0, 0, 0, 1})
+	h.Write(label)
+	h.Write([]byte{0})
+	h.Write(context)
+	h.Write([]byte{0, 0, 0, 128})
+	return h.Sum(nil)[:16]
+}
+
+// cmac is the AES-CMAC message authentication code from RFC 4493
+type cmac struct {
+	block  cipher.Block
+	k1, k2 [aes.BlockSize]byte
+}
+
+// newCMAC makes a cmac with the 128 bit key
+func newCMAC(key []byte) (*cmac, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	c := &cmac{block: block}
+	var l [aes.BlockSize]byte
+	block.Encrypt(l[:], l[:])
+	shiftLeft(c.k1[:], l[:])
+	shiftLeft(c.k2[:], c.k1[:])
+	return c, nil
+}
+
+// shiftLeft sets dst to src shifted left one bit, xoring in the
+// constant Rb if a bit was shifted out, as used in the subkey
+// generation
+func shiftLeft(dst, src []byte) {
+	carry := src[0] >> 7
+	for i := 0; i < len(src)-1; i++ {
+		dst[i] = src[i]<<1 | src[i+1]>>7
+	}
+	dst[len(src)-1] = src[len(src)-1] << 1
+	dst[len(src)-1] ^= 0x87 * carry
+}
+
+// xorBlock xors src into dst
+func xorBlock(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// sum returns the CMAC of msg
+func (c *cmac) sum(msg []byte) []byte {
+	var x [aes.BlockSize]byte
+	n := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	if n == 0 {
+		n = 1
+	}
+	for i := 0; i < n-1; i++ {
+		xorBlock(x[:], msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		c.block.Encrypt(x[:], x[:])
+	}
+	var last [aes.BlockSize]byte
+	rest := msg[(n-1)*aes.BlockSize:]
+	copy(last[:], rest)
+	if len(rest) == aes.BlockSize {
+		xorBlock(last[:], c.k1[:])
+	} else {
+		last[len(rest)] = 0x80
+		xorBlock(last[:], c.k2[:])
+	}
+	xorBlock(x[:], last[:])
+	c.block.Encrypt(x[:], x[:])
+	return x[:]
+}
+
+// signer signs and verifies the messages of a session
+type signer struct {
+	hmac func() hash.Hash // used for SMB 2.x
+	cmac *cmac            // used for SMB 3.x
+}
+
+// newSigner makes the signer for the session key and dialect.
+// preauthHash is the pre-authentication integrity hash of the session
+// for SMB 3.1.1.
+func newSigner(dialect uint16, sessionKey []byte, preauthHash []byte) (*signer, error) {
+	switch dialect {
+	case dialect202, dialect210:
+		key := append([]byte(nil), sessionKey...)
+		return &signer{hmac: func() hash.Hash {
+			return hmac.New(sha256.New, key)
+		}}, nil
+	case dialect311:
+		c, err := newCMAC(kdf(sessionKey, []byte("SMBSigningKey\x00"), preauthHash))
+		return &signer{cmac: c}, err
+	default:
+		c, err := newCMAC(kdf(sessionKey, []byte("SMB2AESCMAC\x00"), []byte("SmbSign\x00")))
+		return &signer{cmac: c}, err
+	}
+}
+
+// signature returns the signature of msg which should have its
+// signature field zeroed
+func (s *signer) signature(msg []byte) []byte {
+	if s.cmac != nil {
+		return s.cmac.sum(msg)
+	}
+	h := s.hmac()
+	h.Write(msg)
+	return h.Sum(nil)[:16]
+}
+
+// sign sets the signed flag in msg and signs it
+func (s *signer) sign(msg []byte) {
+	le.PutUint32(msg[16:], le.Uint32(msg[16:])|flagsSigned)
+	sig := msg[48:64]
+	for i := range sig {
+		sig[i] = 0
+	}
+	copy(sig, s.signature(msg))
+}
+
+// verify checks the signature of msg, returning true if it is OK
+//
+// msg is not modified.
+func (s *signer) verify(msg []byte) bool {
+	buf := append([]byte(nil), msg...)
+	for i := 48; i < 64; i++ {
+		buf[i] = 0
+	}
+	return hmac.Equal(msg[48:64], s.signature(buf))
+}
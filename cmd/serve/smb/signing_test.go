@@ -0,0 +1,43 @@
+package smb
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from RFC 4493
+func TestCMAC(t *testing.T) {
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	msg, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+	c, err := newCMAC(key)
+	require.NoError(t, err)
+	for _, test := range []struct {
+		length int
+		want   string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	} {
+		assert.Equal(t, test.want, hex.EncodeToString(c.sum(msg[:test.length])), test.length)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	for _, dialect := range serverDialects {
+		s, err := newSigner(dialect, key, make([]byte, 64))
+		require.NoError(t, err)
+		msg := make([]byte, 100)
+		h := header{command: cmdEcho, messageID: 3}
+		h.encode(msg)
+		s.sign(msg)
+		assert.True(t, s.verify(msg), "%x", dialect)
+		msg[99] ^= 1
+		assert.False(t, s.verify(msg), "%x", dialect)
+	}
+}
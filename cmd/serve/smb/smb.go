@@ -0,0 +1,139 @@
+// Package smb implements an SMB2/3 server for rclone
+package smb
+
+import (
+	"context"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfsflags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Options contains options for the SMB server
+type Options struct {
+	ListenAddr string // Port to listen on
+	ShareName  string // name of the share the remote is served as
+	User       string // single username for authentication
+	Pass       string // password for User
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	ListenAddr: "localhost:445",
+	ShareName:  "rclone",
+}
+
+// Opt is options set by command line flags
+var Opt = DefaultOpt
+
+// AddFlags adds flags for the smb server
+func AddFlags(flagSet *pflag.FlagSet, Opt *Options) {
+	rc.AddOption("smb", &Opt)
+	flags.StringVarP(flagSet, &Opt.ListenAddr, "addr", "", Opt.ListenAddr, "IPaddress:Port or :Port to bind server to", "")
+	flags.StringVarP(flagSet, &Opt.ShareName, "share", "", Opt.ShareName, "Name of the share to serve the remote as", "")
+	flags.StringVarP(flagSet, &Opt.User, "user", "", Opt.User, "User name for authentication", "")
+	flags.StringVarP(flagSet, &Opt.Pass, "pass", "", Opt.Pass, "Password for authentication", "")
+}
+
+func init() {
+	vfsflags.AddFlags(Command.Flags())
+	proxyflags.AddFlags(Command.Flags())
+	AddFlags(Command.Flags(), &Opt)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "smb remote:path",
+	Short: `Serve remote:path over SMB.`,
+	Long: `Run an SMB2/3 server to serve a remote over the network.
+
+This lets Windows users map any remote as a network drive without
+installing anything, and it works with the SMB clients on macOS and
+Linux too.
+
+    rclone serve smb remote:path --vfs-cache-mode writes --user me --pass secret
+
+The remote is served as a single share, called ` + "`rclone`" + ` by default,
+which can be changed with ` + "`--share`" + `. On Windows it can then be
+mapped with
+
+    net use R: \\hostname\rclone /user:me secret
+
+### Server options
+
+Use ` + "`--addr`" + ` to specify which IP address and port the server should
+listen on, e.g. ` + "`--addr 1.2.3.4:445`" + ` or ` + "`--addr :445`" + ` to listen
+on all IPs. By default it only listens on localhost.
+
+**Note** that Windows will only connect to SMB servers on port 445 so
+you will need to use that port for Windows clients, which needs
+administrator rights on most systems. On Windows itself port 445 is
+used by the built in file sharing service, so rclone will need to
+listen on a different IP address, or the service will need to be
+stopped. Other clients, such as the ` + "`smb`" + ` backend, can use any port.
+
+The server supports the SMB 2.0.2, 2.1, 3.0, 3.0.2 and 3.1.1 dialects
+with message signing. Encryption, opportunistic locks, byte range
+locks, change notifications and alternate data streams are not
+supported.
+
+#### Authentication
+
+Users are authenticated with NTLMv2. The server requires signing, so
+every message after authentication must be signed with the key agreed
+during authentication, and unsigned or altered messages are refused.
+Guest sessions can't be signed so they aren't protected like this.
+Messages are not encrypted.
+
+You can set a single username and password with the ` + "`--user`" + ` and
+` + "`--pass`" + ` flags. The user name is not case sensitive.
+
+If ` + "`--user`" + ` isn't set then anyone can log in as a guest with any
+user name and password, and the remote is served read only. Note that
+recent versions of Windows refuse to connect to servers which only
+allow guest access, so you will need to set a user for Windows
+clients.
+
+Alternatively the ` + "`--auth-proxy`" + ` flag can be used to use a
+different backend for each user - see below. As NTLM never sends the
+password to the server, the proxy is only passed the ` + "`user`" + ` and it
+must return the user's password in ` + "`_password`" + `.
+
+#### VFS options
+
+Windows expects to be able to read and write files at random and to
+find files with names in any case, so the server works best with
+
+    --vfs-cache-mode writes --vfs-case-insensitive
+
+Without ` + "`--vfs-cache-mode writes`" + ` or above files can only be
+written sequentially and existing files can't be modified.
+` + vfs.Help + proxy.Help,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.66",
+		"groups":            "Filter",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		var f fs.Fs
+		if proxyflags.Opt.AuthProxy == "" {
+			cmd.CheckArgs(1, 1, command, args)
+			f = cmd.NewFsSrc(args)
+		} else {
+			cmd.CheckArgs(0, 0, command, args)
+		}
+		cmd.Run(false, true, command, func() error {
+			s, err := newServer(context.Background(), f, &Opt)
+			if err != nil {
+				return err
+			}
+			return s.Serve()
+		})
+	},
+}
@@ -0,0 +1,337 @@
+// Serve smb tests set up a server and run the integration tests
+// for the smb remote against it.
+
+package smb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/cmd/serve/servetest"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/rclone/rclone/vfs/vfsflags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testUser = "rclone"
+	testPass = "password"
+)
+
+// startServer starts a server serving f with opt returning it and a
+// function to stop it
+func startServer(t *testing.T, f fs.Fs, opt *Options) (*Server, func()) {
+	s, err := newServer(context.Background(), f, opt)
+	require.NoError(t, err)
+	quit := make(chan struct{})
+	go func() {
+		assert.NoError(t, s.Serve())
+		close(quit)
+	}()
+	return s, func() {
+		assert.NoError(t, s.Shutdown())
+		<-quit
+	}
+}
+
+// TestSMB runs the smb server then runs the unit tests for the
+// smb remote against it.
+func TestSMB(t *testing.T) {
+	// The smb backend expects random access writes and case
+	// insensitivity, as Windows does
+	oldOpt := vfsflags.Opt
+	vfsflags.Opt.CacheMode = vfscommon.CacheModeWrites
+	vfsflags.Opt.CaseInsensitive = true
+	vfsflags.Opt.WriteBack = 0
+	defer func() {
+		vfsflags.Opt = oldOpt
+	}()
+
+	// Configure and start the server
+	start := func(f fs.Fs) (configmap.Simple, func()) {
+		opt := DefaultOpt
+		opt.ListenAddr = "localhost:0"
+		if f != nil {
+			opt.User = testUser
+			opt.Pass = testPass
+		}
+		s, stop := startServer(t, f, &opt)
+		_, port, err := net.SplitHostPort(s.Addr().String())
+		require.NoError(t, err)
+
+		// Config for the backend we'll use to connect to the server
+		config := configmap.Simple{
+			"type":  "smb",
+			"host":  "localhost",
+			"port":  port,
+			"user":  testUser,
+			"pass":  obscure.MustObscure(testPass),
+			"_root": opt.ShareName,
+		}
+		return config, stop
+	}
+
+	servetest.Run(t, "smb", start)
+}
+
+// newTestServer starts a server with opt serving a local temporary
+// directory returning the server and the directory
+func newTestServer(t *testing.T, opt Options) (*Server, string) {
+	dir := t.TempDir()
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	opt.ListenAddr = "localhost:0"
+	s, stop := startServer(t, f, &opt)
+	t.Cleanup(stop)
+	return s, dir
+}
+
+// dial logs in to the server with the go-smb2 client
+func dial(t *testing.T, s *Server, user, pass string, dialect uint16) (*smb2.Session, error) {
+	nc, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	d := &smb2.Dialer{
+		Negotiator: smb2.Negotiator{
+			RequireMessageSigning: true,
+			SpecifiedDialect:      dialect,
+		},
+		Initiator: &smb2.NTLMInitiator{
+			User:     user,
+			Password: pass,
+		},
+	}
+	sess, err := d.Dial(nc)
+	if err != nil {
+		_ = nc.Close()
+		return nil, err
+	}
+	t.Cleanup(func() {
+		_ = sess.Logoff()
+	})
+	return sess, nil
+}
+
+func TestAuthentication(t *testing.T) {
+	opt := DefaultOpt
+	opt.User = testUser
+	opt.Pass = testPass
+	s, _ := newTestServer(t, opt)
+
+	_, err := dial(t, s, testUser, "wrong", 0)
+	assert.Error(t, err)
+	_, err = dial(t, s, "wrong", testPass, 0)
+	assert.Error(t, err)
+
+	// The user name isn't case sensitive
+	sess, err := dial(t, s, "RClone", testPass, 0)
+	require.NoError(t, err)
+	_, err = sess.Mount("nonexistent")
+	assert.Error(t, err)
+	share, err := sess.Mount(`\\localhost\RCLONE`)
+	require.NoError(t, err)
+	_, err = share.ReadDir("")
+	assert.NoError(t, err)
+}
+
+// tamperConn clears the signature of the messages written to it once
+// tamper is set, as a man in the middle could
+type tamperConn struct {
+	net.Conn
+	tamper bool
+}
+
+func (c *tamperConn) Write(p []byte) (int, error) {
+	if c.tamper && len(p) >= 64 && string(p[:4]) == "\xfeSMB" {
+		p = append([]byte{}, p...)
+		p[16] &^= flagsSigned
+		copy(p[48:64], make([]byte, 16))
+	}
+	return c.Conn.Write(p)
+}
+
+func TestUnsigned(t *testing.T) {
+	opt := DefaultOpt
+	opt.User = testUser
+	opt.Pass = testPass
+	s, dir := newTestServer(t, opt)
+
+	for _, dialect := range serverDialects {
+		t.Run(fmt.Sprintf("%x", dialect), func(t *testing.T) {
+			nc, err := net.Dial("tcp", s.Addr().String())
+			require.NoError(t, err)
+			tc := &tamperConn{Conn: nc}
+			d := &smb2.Dialer{
+				// The client signs as the server requires it
+				Negotiator: smb2.Negotiator{
+					SpecifiedDialect: dialect,
+				},
+				Initiator: &smb2.NTLMInitiator{
+					User:     testUser,
+					Password: testPass,
+				},
+			}
+			sess, err := d.Dial(tc)
+			require.NoError(t, err)
+			defer func() {
+				_ = nc.Close()
+			}()
+
+			share, err := sess.Mount(opt.ShareName)
+			require.NoError(t, err)
+
+			// Unsigned requests are refused
+			tc.tamper = true
+			name := fmt.Sprintf("dir-%x", dialect)
+			assert.Error(t, share.Mkdir(name, 0777))
+			_, err = os.Stat(filepath.Join(dir, name))
+			assert.True(t, os.IsNotExist(err), "unsigned request was run")
+		})
+	}
+}
+
+func TestGuest(t *testing.T) {
+	s, dir := newTestServer(t, DefaultOpt)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0666))
+
+	// Any user and password will do
+	sess, err := dial(t, s, "anyone", "anything", 0)
+	require.NoError(t, err)
+	share, err := sess.Mount(DefaultOpt.ShareName)
+	require.NoError(t, err)
+	data, err := share.ReadFile("file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// Guests can't change anything
+	assert.ErrorIs(t, share.WriteFile("file.txt", []byte("bye"), 0666), os.ErrPermission)
+	assert.ErrorIs(t, share.WriteFile("new.txt", []byte("new"), 0666), os.ErrPermission)
+	assert.ErrorIs(t, share.Remove("file.txt"), os.ErrPermission)
+	assert.Error(t, share.Mkdir("dir", 0777))
+	local, err := os.ReadFile(filepath.Join(dir, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(local))
+}
+
+// TestDialects runs file operations with each dialect, checking the
+// signing works for each
+func TestDialects(t *testing.T) {
+	opt := DefaultOpt
+	opt.User = testUser
+	opt.Pass = testPass
+	s, dir := newTestServer(t, opt)
+
+	for _, dialect := range serverDialects {
+		t.Run(fmt.Sprintf("%x", dialect), func(t *testing.T) {
+			sess, err := dial(t, s, testUser, testPass, dialect)
+			require.NoError(t, err)
+			share, err := sess.Mount(opt.ShareName)
+			require.NoError(t, err)
+			defer func() {
+				assert.NoError(t, share.Umount())
+			}()
+
+			name := fmt.Sprintf("dir-%x", dialect)
+			require.NoError(t, share.Mkdir(name, 0777))
+			assert.ErrorIs(t, share.Mkdir(name, 0777), os.ErrExist)
+
+			// Write and read back a file
+			file := name + `\file.txt`
+			require.NoError(t, share.WriteFile(file, []byte("potato"), 0666))
+			data, err := share.ReadFile(file)
+			require.NoError(t, err)
+			assert.Equal(t, "potato", string(data))
+			local, err := os.ReadFile(filepath.Join(dir, name, "file.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "potato", string(local))
+
+			// Stat and set the modification time
+			fi, err := share.Stat(file)
+			require.NoError(t, err)
+			assert.Equal(t, int64(6), fi.Size())
+			assert.False(t, fi.IsDir())
+			mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			require.NoError(t, share.Chtimes(file, mtime, mtime))
+			fi, err = share.Stat(file)
+			require.NoError(t, err)
+			assert.True(t, mtime.Equal(fi.ModTime()), fi.ModTime())
+			_, err = share.Stat(name + `\nonexistent`)
+			assert.ErrorIs(t, err, os.ErrNotExist)
+
+			// Rename and list
+			require.NoError(t, share.Rename(file, name+`\renamed.txt`))
+			require.NoError(t, share.WriteFile(name+`\other.txt`, []byte("x"), 0666))
+			fis, err := share.ReadDir(name)
+			require.NoError(t, err)
+			var names []string
+			for _, fi := range fis {
+				names = append(names, fi.Name())
+			}
+			sort.Strings(names)
+			assert.Equal(t, []string{"other.txt", "renamed.txt"}, names)
+
+			// A directory with files in can't be removed
+			err = share.Remove(name)
+			assert.Error(t, err)
+			require.NoError(t, share.Remove(name+`\renamed.txt`))
+			require.NoError(t, share.Remove(name+`\other.txt`))
+			require.NoError(t, share.Remove(name))
+			_, err = os.Stat(filepath.Join(dir, name))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	oldOpt := vfsflags.Opt
+	vfsflags.Opt.ReadOnly = true
+	defer func() {
+		vfsflags.Opt = oldOpt
+	}()
+	opt := DefaultOpt
+	opt.User = testUser
+	opt.Pass = testPass
+	s, dir := newTestServer(t, opt)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0666))
+
+	sess, err := dial(t, s, testUser, testPass, 0)
+	require.NoError(t, err)
+	share, err := sess.Mount(opt.ShareName)
+	require.NoError(t, err)
+	data, err := share.ReadFile("file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.ErrorIs(t, share.WriteFile("file.txt", []byte("bye"), 0666), os.ErrPermission)
+	assert.ErrorIs(t, share.Remove("file.txt"), os.ErrPermission)
+}
+
+func TestMatchPattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*", "file.txt", true},
+		{"*.txt", "FILE.TXT", true},
+		{"*.txt", "file.txt.gz", false},
+		{"f?le.*", "file.txt", true},
+		{"f?le.*", "fle.txt", false},
+		{"file.txt", "File.Txt", true},
+		{`<"txt`, "file.txt", true},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+	} {
+		assert.Equal(t, test.want, matchPattern(test.pattern, test.name), "%q %q", test.pattern, test.name)
+	}
+}
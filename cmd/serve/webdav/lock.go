@@ -0,0 +1,348 @@
+package webdav
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/vfs"
+	"golang.org/x/net/webdav"
+)
+
+// lock is a single WebDAV lock
+type lock struct {
+	Token   string
+	Details webdav.LockDetails
+	Expiry  time.Time `json:",omitempty"` // zero if the lock doesn't expire
+	held    bool      // set while a request is using the lock
+}
+
+// temporary returns true if this is one of the locks the webdav
+// handler makes for the duration of a request which doesn't have any
+// locks of its own. These have no owner and don't expire.
+func (l *lock) temporary() bool {
+	return l.Details.OwnerXML == "" && l.Details.Duration < 0
+}
+
+// lockSystem is a webdav.LockSystem which stores the locks in a file
+// so they survive a restart of the server.
+//
+// The locks are on the paths of the VFS. Locks on resources which
+// have been deleted or moved away are removed, as are locks on
+// resources which no longer exist when the locks are read back in.
+type lockSystem struct {
+	vfs   *vfs.VFS
+	path  string // file to store the locks in, or "" not to store them
+	mu    sync.Mutex
+	locks map[string]*lock // by token
+	saved []byte           // what was saved last
+}
+
+// newLockSystem makes a lock system for VFS storing the locks in
+// the file at path, reading in any locks already there.
+func newLockSystem(VFS *vfs.VFS, path string) *lockSystem {
+	ls := &lockSystem{
+		vfs:   VFS,
+		path:  path,
+		locks: make(map[string]*lock),
+	}
+	if path != "" {
+		err := ls.load(time.Now())
+		if err != nil {
+			fs.Errorf(nil, "WebDAV: failed to read locks from %q: %v", path, err)
+		}
+	}
+	return ls
+}
+
+// slashClean cleans name into the form the webdav handler uses
+func slashClean(name string) string {
+	if name == "" || name[0] != '/' {
+		name = "/" + name
+	}
+	return path.Clean(name)
+}
+
+// isBelow returns true if name is a descendant of dir
+func isBelow(name, dir string) bool {
+	if dir == "/" {
+		return name != "/"
+	}
+	return strings.HasPrefix(name, dir+"/")
+}
+
+// covers returns true if l locks name
+func (l *lock) covers(name string) bool {
+	return name == l.Details.Root || (!l.Details.ZeroDepth && isBelow(name, l.Details.Root))
+}
+
+// load reads the locks from the file, dropping the ones which have
+// expired or are on resources which don't exist any more.
+func (ls *lockSystem) load(now time.Time) error {
+	data, err := os.ReadFile(ls.path)
+	if errors.Is(err, os.ErrNotExist) {
+		ls.saved = []byte("[]")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var locks []*lock
+	err = json.Unmarshal(data, &locks)
+	if err != nil {
+		return err
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for _, l := range locks {
+		if !l.Expiry.IsZero() && !now.Before(l.Expiry) {
+			continue
+		}
+		if _, err := ls.vfs.Stat(l.Details.Root); err != nil {
+			fs.Debugf(nil, "WebDAV: dropping lock on %q: %v", l.Details.Root, err)
+			continue
+		}
+		ls.locks[l.Token] = l
+	}
+	ls.saved = data
+	return nil
+}
+
+// changed saves the locks - call with the lock held
+//
+// The temporary locks aren't saved so the ones made for a request and
+// removed at the end of it don't cause a write.
+func (ls *lockSystem) changed() {
+	if ls.path == "" {
+		return
+	}
+	err := ls.save()
+	if err != nil {
+		fs.Errorf(nil, "WebDAV: failed to save locks to %q: %v", ls.path, err)
+	}
+}
+
+// save writes the locks to the file if they have changed - call with
+// the lock held
+func (ls *lockSystem) save() error {
+	locks := make([]*lock, 0, len(ls.locks))
+	for _, l := range ls.locks {
+		if !l.temporary() {
+			locks = append(locks, l)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Token < locks[j].Token
+	})
+	data, err := json.MarshalIndent(locks, "", "\t")
+	if err != nil || string(data) == string(ls.saved) {
+		return err
+	}
+	err = writeFileAtomic(ls.path, data)
+	if err != nil {
+		return err
+	}
+	ls.saved = data
+	return nil
+}
+
+// writeFileAtomic writes data to the file at path so it is either
+// all there or not changed
+func writeFileAtomic(path string, data []byte) (err error) {
+	err = file.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// expire removes the locks which have expired - call with the lock held
+func (ls *lockSystem) expire(now time.Time) {
+	changed := false
+	for token, l := range ls.locks {
+		if !l.held && !l.Expiry.IsZero() && !now.Before(l.Expiry) {
+			delete(ls.locks, token)
+			changed = true
+		}
+	}
+	if changed {
+		ls.changed()
+	}
+}
+
+// lookup returns the lock which one of the conditions claims which
+// locks name and isn't held already, or nil if there isn't one.
+func (ls *lockSystem) lookup(name string, conditions ...webdav.Condition) *lock {
+	for _, c := range conditions {
+		l := ls.locks[c.Token]
+		if l != nil && !l.held && l.covers(name) {
+			return l
+		}
+	}
+	return nil
+}
+
+// Confirm confirms that the caller can claim all of the locks
+// specified by the given conditions, and that holding the union of
+// all of those locks gives exclusive access to all of the named
+// resources.
+func (ls *lockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (release func(), err error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire(now)
+	var l0, l1 *lock
+	if name0 != "" {
+		if l0 = ls.lookup(slashClean(name0), conditions...); l0 == nil {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+	if name1 != "" {
+		if l1 = ls.lookup(slashClean(name1), conditions...); l1 == nil {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+	held := []*lock{l0}
+	if l1 != l0 {
+		held = append(held, l1)
+	}
+	for _, l := range held {
+		if l != nil {
+			l.held = true
+		}
+	}
+	return func() {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		for _, l := range held {
+			if l != nil {
+				l.held = false
+			}
+		}
+	}, nil
+}
+
+// Create creates a lock with the given details
+func (ls *lockSystem) Create(now time.Time, details webdav.LockDetails) (token string, err error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire(now)
+	details.Root = slashClean(details.Root)
+	for _, l := range ls.locks {
+		root := l.Details.Root
+		if root == details.Root ||
+			(isBelow(details.Root, root) && !l.Details.ZeroDepth) ||
+			(isBelow(root, details.Root) && !details.ZeroDepth) {
+			return "", webdav.ErrLocked
+		}
+	}
+	l := &lock{
+		Token:   "opaquelocktoken:" + uuid.New().String(),
+		Details: details,
+	}
+	if details.Duration >= 0 {
+		l.Expiry = now.Add(details.Duration)
+	}
+	ls.locks[l.Token] = l
+	ls.changed()
+	return l.Token, nil
+}
+
+// Refresh refreshes the lock with the given token
+func (ls *lockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire(now)
+	l := ls.locks[token]
+	if l == nil {
+		return webdav.LockDetails{}, webdav.ErrNoSuchLock
+	}
+	if l.held {
+		return webdav.LockDetails{}, webdav.ErrLocked
+	}
+	l.Details.Duration = duration
+	l.Expiry = time.Time{}
+	if duration >= 0 {
+		l.Expiry = now.Add(duration)
+	}
+	ls.changed()
+	return l.Details, nil
+}
+
+// Unlock unlocks the lock with the given token
+func (ls *lockSystem) Unlock(now time.Time, token string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire(now)
+	l := ls.locks[token]
+	if l == nil {
+		return webdav.ErrNoSuchLock
+	}
+	if l.held {
+		return webdav.ErrLocked
+	}
+	delete(ls.locks, token)
+	ls.changed()
+	return nil
+}
+
+// remove removes the locks on name and anything below it, as the
+// resource there has been deleted or moved away.
+func (ls *lockSystem) remove(name string) {
+	name = slashClean(name)
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	changed := false
+	for token, l := range ls.locks {
+		if l.Details.Root == name || isBelow(l.Details.Root, name) {
+			delete(ls.locks, token)
+			changed = true
+		}
+	}
+	if changed {
+		ls.changed()
+	}
+}
+
+// active returns the locks on name, leaving out the temporary ones
+func (ls *lockSystem) active(now time.Time, name string) (locks []lock) {
+	name = slashClean(name)
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire(now)
+	for _, l := range ls.locks {
+		if l.covers(name) && !l.temporary() {
+			locks = append(locks, *l)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Details.Root < locks[j].Details.Root
+	})
+	return locks
+}
+
+// check interface
+var _ webdav.LockSystem = (*lockSystem)(nil)
@@ -0,0 +1,118 @@
+package webdav
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+// newTestVFS makes a VFS on a temporary directory with a file and a
+// directory in
+func newTestVFS(t *testing.T) *vfs.VFS {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "dir", "file.txt"), []byte("hello"), 0666))
+	f, err := fs.NewFs(context.Background(), root)
+	require.NoError(t, err)
+	VFS := vfs.New(f, nil)
+	t.Cleanup(VFS.Shutdown)
+	return VFS
+}
+
+func TestLockSystem(t *testing.T) {
+	ls := newLockSystem(newTestVFS(t), "")
+	now := time.Now()
+
+	fileToken, err := ls.Create(now, webdav.LockDetails{Root: "dir/file.txt", Duration: time.Minute, ZeroDepth: true})
+	require.NoError(t, err)
+	assert.Regexp(t, "^opaquelocktoken:[0-9a-f-]{36}$", fileToken)
+
+	// Conflicting locks
+	for _, details := range []webdav.LockDetails{
+		{Root: "/dir/file.txt", Duration: time.Minute},
+		{Root: "/dir", Duration: time.Minute},
+		{Root: "/", Duration: time.Minute},
+	} {
+		_, err = ls.Create(now, details)
+		assert.Equal(t, webdav.ErrLocked, err, details.Root)
+	}
+
+	// A zero depth lock on the parent is OK
+	dirToken, err := ls.Create(now, webdav.LockDetails{Root: "/dir", Duration: time.Minute, ZeroDepth: true})
+	require.NoError(t, err)
+
+	// Confirm needs the right token
+	_, err = ls.Confirm(now, "/dir/file.txt", "")
+	assert.Equal(t, webdav.ErrConfirmationFailed, err)
+	_, err = ls.Confirm(now, "/dir/file.txt", "", webdav.Condition{Token: dirToken})
+	assert.Equal(t, webdav.ErrConfirmationFailed, err)
+	release, err := ls.Confirm(now, "/dir/file.txt", "", webdav.Condition{Token: fileToken})
+	require.NoError(t, err)
+
+	// A held lock can't be refreshed or unlocked
+	_, err = ls.Refresh(now, fileToken, time.Minute)
+	assert.Equal(t, webdav.ErrLocked, err)
+	assert.Equal(t, webdav.ErrLocked, ls.Unlock(now, fileToken))
+	release()
+
+	// Refresh
+	details, err := ls.Refresh(now, fileToken, 2*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "/dir/file.txt", details.Root)
+	assert.Equal(t, 2*time.Minute, details.Duration)
+	_, err = ls.Refresh(now, "opaquelocktoken:nope", time.Minute)
+	assert.Equal(t, webdav.ErrNoSuchLock, err)
+
+	// Active locks
+	active := ls.active(now, "dir/file.txt")
+	require.Len(t, active, 1)
+	assert.Equal(t, fileToken, active[0].Token)
+
+	// Expiry
+	later := now.Add(90 * time.Second)
+	assert.Len(t, ls.active(later, "/dir"), 0)
+	assert.Len(t, ls.active(later, "/dir/file.txt"), 1)
+	assert.Equal(t, webdav.ErrNoSuchLock, ls.Unlock(later, dirToken))
+
+	// Removing the resource removes the lock
+	ls.remove("dir")
+	assert.Equal(t, webdav.ErrNoSuchLock, ls.Unlock(now, fileToken))
+}
+
+func TestLockSystemPersist(t *testing.T) {
+	VFS := newTestVFS(t)
+	path := filepath.Join(t.TempDir(), "locks.json")
+	ls := newLockSystem(VFS, path)
+	now := time.Now()
+
+	fileToken, err := ls.Create(now, webdav.LockDetails{Root: "/dir/file.txt", Duration: time.Hour, OwnerXML: "<href>me</href>"})
+	require.NoError(t, err)
+	_, err = ls.Create(now, webdav.LockDetails{Root: "/dir", Duration: time.Hour, ZeroDepth: true, OwnerXML: "<href>me</href>"})
+	require.NoError(t, err)
+	// Temporary locks aren't saved
+	_, err = ls.Create(now, webdav.LockDetails{Root: "/other", Duration: -1, ZeroDepth: true})
+	require.NoError(t, err)
+
+	// Locks on files which have gone are dropped when read in
+	require.NoError(t, VFS.Mkdir("dir2", 0777))
+	require.NoError(t, VFS.Rename("dir", "dir2/dir"))
+
+	ls = newLockSystem(VFS, path)
+	assert.Len(t, ls.locks, 0)
+
+	require.NoError(t, VFS.Rename("dir2/dir", "dir"))
+	ls = newLockSystem(VFS, path)
+	assert.Len(t, ls.locks, 2)
+	assert.Equal(t, "<href>me</href>", ls.locks[fileToken].Details.OwnerXML)
+	assert.Len(t, ls.active(now, "/dir/file.txt"), 1)
+	assert.Len(t, ls.active(now, "/dir"), 1)
+}
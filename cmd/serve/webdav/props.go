@@ -0,0 +1,340 @@
+package webdav
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/cmd/serve/servemeta"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"golang.org/x/net/webdav"
+)
+
+// The metadata key the dead properties of a file are stored in on
+// backends which support user metadata
+const propsMetadataKey = "webdav-props"
+
+// deadProp is a property set with PROPPATCH which the server stores
+// but doesn't interpret
+type deadProp struct {
+	Space    string
+	Local    string
+	Lang     string `json:",omitempty"`
+	InnerXML string `json:",omitempty"`
+}
+
+// property returns p as a webdav.Property
+func (p deadProp) property() webdav.Property {
+	return webdav.Property{
+		XMLName:  xml.Name{Space: p.Space, Local: p.Local},
+		Lang:     p.Lang,
+		InnerXML: []byte(p.InnerXML),
+	}
+}
+
+// propStore stores the dead properties
+//
+// The properties of files on backends which support user metadata
+// are stored in the metadata of the object. The properties of
+// everything else are stored in a file indexed by the path in the
+// VFS.
+type propStore struct {
+	path  string // file to store the properties in, or "" not to store them
+	mu    sync.Mutex
+	props map[string][]deadProp // by path in the VFS
+}
+
+// newPropStore makes a propStore storing the properties in the file
+// at path, reading in any properties already there.
+func newPropStore(path string) *propStore {
+	ps := &propStore{
+		path:  path,
+		props: make(map[string][]deadProp),
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &ps.props)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fs.Errorf(nil, "WebDAV: failed to read properties from %q: %v", path, err)
+		}
+	}
+	return ps
+}
+
+// save writes the properties to the file - call with the lock held
+func (ps *propStore) save() error {
+	if ps.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(ps.props, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(ps.path, data)
+}
+
+// metadataObject returns the object the properties of node should be
+// stored in, or nil if they should be stored in the file.
+func metadataObject(VFS *vfs.VFS, node vfs.Node) fs.Object {
+	if node.IsDir() || !servemeta.CanStore(VFS.Fs(), node.Path()) {
+		return nil
+	}
+	o, _ := node.DirEntry().(fs.Object)
+	return o
+}
+
+// get returns the dead properties of node
+func (ps *propStore) get(ctx context.Context, VFS *vfs.VFS, node vfs.Node) (props []deadProp, err error) {
+	ps.mu.Lock()
+	props = append(props, ps.props[slashClean(node.Path())]...)
+	ps.mu.Unlock()
+	o := metadataObject(VFS, node)
+	if o == nil {
+		return props, nil
+	}
+	m, err := fs.GetMetadata(servemeta.Context(ctx), o)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := m[propsMetadataKey]
+	if !ok || value == "" {
+		return props, nil
+	}
+	var stored []deadProp
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err == nil {
+		err = json.Unmarshal(data, &stored)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %q metadata: %w", propsMetadataKey, err)
+	}
+	return patchProps(props, stored, nil), nil
+}
+
+// patchProps returns props with set added and the properties named
+// in remove removed
+func patchProps(props []deadProp, set []deadProp, remove []xml.Name) []deadProp {
+	out := props[:0:0]
+	for _, p := range props {
+		keep := true
+		for _, q := range set {
+			keep = keep && (p.Space != q.Space || p.Local != q.Local)
+		}
+		for _, name := range remove {
+			keep = keep && (p.Space != name.Space || p.Local != name.Local)
+		}
+		if keep {
+			out = append(out, p)
+		}
+	}
+	return append(out, set...)
+}
+
+// patch sets and removes the dead properties of node
+func (ps *propStore) patch(ctx context.Context, VFS *vfs.VFS, node vfs.Node, set []deadProp, remove []xml.Name) error {
+	props, err := ps.get(ctx, VFS, node)
+	if err != nil {
+		return err
+	}
+	props = patchProps(props, set, remove)
+	name := slashClean(node.Path())
+	if o := metadataObject(VFS, node); o != nil {
+		err = writePropsMetadata(ctx, VFS, o, props)
+		if err != nil {
+			return err
+		}
+		// The properties are all in the metadata now
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+		if _, found := ps.props[name]; !found {
+			return nil
+		}
+		delete(ps.props, name)
+		return ps.save()
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if len(props) == 0 {
+		delete(ps.props, name)
+	} else {
+		ps.props[name] = props
+	}
+	return ps.save()
+}
+
+// writePropsMetadata uploads the object o again with props stored in
+// its metadata
+func writePropsMetadata(ctx context.Context, VFS *vfs.VFS, o fs.Object, props []deadProp) (err error) {
+	ctx = servemeta.Context(ctx)
+	m, err := fs.GetMetadata(ctx, o)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		m = fs.Metadata{}
+	}
+	if len(props) == 0 {
+		// Some backends keep keys which aren't passed so blank it
+		m[propsMetadataKey] = ""
+	} else {
+		data, err := json.Marshal(props)
+		if err != nil {
+			return err
+		}
+		m[propsMetadataKey] = base64.StdEncoding.EncodeToString(data)
+	}
+	err = servemeta.Rewrite(ctx, VFS.Fs(), o, m, o.ModTime(ctx))
+	if err != nil {
+		return err
+	}
+	// Tell the VFS the object has changed on the backend
+	if root, err := VFS.Root(); err == nil {
+		root.ForgetPath(o.Remote(), fs.EntryObject)
+	}
+	return nil
+}
+
+// rename moves the properties of oldName and anything below it to
+// newName, replacing any there.
+func (ps *propStore) rename(oldName, newName string) {
+	ps.transfer(oldName, newName, true)
+}
+
+// copy copies the properties of srcName and anything below it to
+// dstName, replacing any there.
+func (ps *propStore) copy(srcName, dstName string) {
+	ps.transfer(srcName, dstName, false)
+}
+
+// transfer copies or moves the properties of src to dst
+func (ps *propStore) transfer(src, dst string, move bool) {
+	src, dst = slashClean(src), slashClean(dst)
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	changed := ps.removeTree(dst)
+	moved := make(map[string][]deadProp)
+	for name, props := range ps.props {
+		if name == src {
+			moved[dst] = props
+		} else if isBelow(name, src) {
+			moved[dst+strings.TrimPrefix(name, src)] = props
+		} else {
+			continue
+		}
+		if move {
+			delete(ps.props, name)
+		}
+	}
+	for name, props := range moved {
+		ps.props[name] = props
+		changed = true
+	}
+	if changed {
+		if err := ps.save(); err != nil {
+			fs.Errorf(nil, "WebDAV: failed to save properties to %q: %v", ps.path, err)
+		}
+	}
+}
+
+// remove removes the properties of name and anything below it
+func (ps *propStore) remove(name string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.removeTree(slashClean(name)) {
+		if err := ps.save(); err != nil {
+			fs.Errorf(nil, "WebDAV: failed to save properties to %q: %v", ps.path, err)
+		}
+	}
+}
+
+// removeTree removes the properties of name and anything below it
+// returning true if any were removed - call with the lock held
+func (ps *propStore) removeTree(name string) (changed bool) {
+	for path := range ps.props {
+		if path == name || isBelow(path, name) {
+			delete(ps.props, path)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// The properties a client can't set
+var (
+	quotaAvailableBytes = xml.Name{Space: "DAV:", Local: "quota-available-bytes"}
+	quotaUsedBytes      = xml.Name{Space: "DAV:", Local: "quota-used-bytes"}
+	lockDiscovery       = xml.Name{Space: "DAV:", Local: "lockdiscovery"}
+)
+
+// quotaProps returns the RFC 4331 quota properties of VFS if the
+// backend can report them
+func quotaProps(VFS *vfs.VFS) (props []webdav.Property) {
+	if VFS.Fs().Features().About == nil {
+		return nil
+	}
+	_, used, free := VFS.Statfs()
+	if free >= 0 {
+		props = append(props, webdav.Property{
+			XMLName:  quotaAvailableBytes,
+			InnerXML: strconv.AppendInt(nil, free, 10),
+		})
+	}
+	if used >= 0 {
+		props = append(props, webdav.Property{
+			XMLName:  quotaUsedBytes,
+			InnerXML: strconv.AppendInt(nil, used, 10),
+		})
+	}
+	return props
+}
+
+// lockDiscoveryProp returns the lockdiscovery property for the locks
+// or false if there aren't any
+func lockDiscoveryProp(now time.Time, locks []lock) (prop webdav.Property, ok bool) {
+	if len(locks) == 0 {
+		return prop, false
+	}
+	var b strings.Builder
+	for _, l := range locks {
+		depth := "infinity"
+		if l.Details.ZeroDepth {
+			depth = "0"
+		}
+		timeout := "Infinite"
+		if !l.Expiry.IsZero() {
+			timeout = fmt.Sprintf("Second-%d", l.Expiry.Sub(now)/time.Second)
+		}
+		fmt.Fprintf(&b, `<D:activelock xmlns:D="DAV:">`+
+			`<D:locktype><D:write/></D:locktype>`+
+			`<D:lockscope><D:exclusive/></D:lockscope>`+
+			`<D:depth>%s</D:depth>`+
+			`<D:owner>%s</D:owner>`+
+			`<D:timeout>%s</D:timeout>`+
+			`<D:locktoken><D:href>%s</D:href></D:locktoken>`+
+			`<D:lockroot><D:href>%s</D:href></D:lockroot>`+
+			`</D:activelock>`,
+			depth, l.Details.OwnerXML, timeout, escapeXML(l.Token), escapeXML(l.Details.Root))
+	}
+	return webdav.Property{
+		XMLName:  lockDiscovery,
+		InnerXML: []byte(b.String()),
+	}, true
+}
+
+// escapeXML escapes s for use in XML text
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -8,10 +8,13 @@ import (
 	"fmt"
 	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	chi "github.com/go-chi/chi/v5"
@@ -20,6 +23,7 @@ import (
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/fs/hash"
 	libhttp "github.com/rclone/rclone/lib/http"
@@ -39,6 +43,7 @@ type Options struct {
 	HashName      string
 	HashType      hash.Type
 	DisableGETDir bool
+	StateDir      string
 }
 
 // DefaultOpt is the default values used for Options
@@ -66,6 +71,7 @@ func init() {
 	proxyflags.AddFlags(flagSet)
 	flags.StringVarP(flagSet, &Opt.HashName, "etag-hash", "", "", "Which hash to use for the ETag, or auto or blank for off", "")
 	flags.BoolVarP(flagSet, &Opt.DisableGETDir, "disable-dir-list", "", false, "Disable HTML directory list on GET request for a directory", "")
+	flags.StringVarP(flagSet, &Opt.StateDir, "state-dir", "", "", "Directory to keep the locks and dead properties in (default in the cache dir)", "")
 }
 
 // Command definition for cobra
@@ -88,6 +94,45 @@ supported hash on the backend or you can use a named hash such as
 "MD5" or "SHA-1". Use the [hashsum](/commands/rclone_hashsum/) command
 to see the full list.
 
+#### --state-dir
+
+The locks and the dead properties which can't be stored in the
+metadata of the objects are kept in this directory so they survive a
+restart of the server. By default this is the ` + "`serve-webdav`" + `
+directory in the rclone cache directory.
+
+### Locking
+
+Clients such as Microsoft Office and macOS Finder lock the files they
+are editing with LOCK. The locks are kept in the state directory and
+are read back in when the server is restarted, dropping those which
+have expired or are on files which no longer exist.
+
+Locks are only enforced on requests made over WebDAV, so they don't
+stop the files being changed on the remote by anything else. A lock
+is removed when the resource it is on is deleted or moved away.
+
+The locks on a resource are reported in its ` + "`lockdiscovery`" + ` property.
+
+### Properties
+
+If the backend can report its usage then the
+` + "`quota-available-bytes`" + ` and ` + "`quota-used-bytes`" + ` properties of
+RFC 4331 are reported for directories.
+
+The dead properties which clients set with PROPPATCH, such as those
+used by CalDAV and CardDAV clients, are stored and returned by
+PROPFIND. If the backend supports user metadata (for example s3, local
+or azureblob) then the properties of a file are stored in the
+` + "`webdav-props`" + ` metadata key of the object. There is no way of
+changing the metadata of an existing object, so setting the
+properties of a file uploads it to the backend again. The properties
+of directories and of files on other backends are stored in the state
+directory.
+
+Setting the ` + "`lastmodified`" + ` property sets the modification time of the
+file instead of storing it.
+
 ### Access WebDAV on Windows
 WebDAV shared folder can be mapped as a drive on Windows, however the default settings prevent it.
 Windows will fail to connect to the server using insecure Basic authentication.
@@ -174,6 +219,14 @@ type WebDAV struct {
 	webdavhandler *webdav.Handler
 	proxy         *proxy.Proxy
 	ctx           context.Context // for global config
+	statesMu      sync.Mutex
+	states        map[string]*state // by state directory
+}
+
+// state is the locks and dead properties of a VFS
+type state struct {
+	locks *lockSystem
+	props *propStore
 }
 
 // check interface
@@ -182,9 +235,10 @@ var _ webdav.FileSystem = (*WebDAV)(nil)
 // Make a new WebDAV to serve the remote
 func newWebDAV(ctx context.Context, f fs.Fs, opt *Options) (w *WebDAV, err error) {
 	w = &WebDAV{
-		f:   f,
-		ctx: ctx,
-		opt: *opt,
+		f:      f,
+		ctx:    ctx,
+		opt:    *opt,
+		states: make(map[string]*state),
 	}
 	if proxyflags.Opt.AuthProxy != "" {
 		w.proxy = proxy.New(ctx, &proxyflags.Opt)
@@ -206,7 +260,6 @@ func newWebDAV(ctx context.Context, f fs.Fs, opt *Options) (w *WebDAV, err error
 	webdavHandler := &webdav.Handler{
 		Prefix:     w.opt.HTTP.BaseURL,
 		FileSystem: w,
-		LockSystem: webdav.NewMemLS(),
 		Logger:     w.logRequest, // FIXME
 	}
 	w.webdavhandler = webdavHandler
@@ -253,6 +306,28 @@ func (w *WebDAV) getVFS(ctx context.Context) (VFS *vfs.VFS, err error) {
 	return VFS, nil
 }
 
+// Gets the locks and dead properties of VFS, reading them in if
+// necessary
+func (w *WebDAV) getState(VFS *vfs.VFS) *state {
+	f := VFS.Fs()
+	stateDir := w.opt.StateDir
+	if stateDir == "" {
+		stateDir = filepath.Join(config.GetCacheDir(), "serve-webdav")
+	}
+	stateDir = filepath.Join(stateDir, f.Name(), filepath.FromSlash(f.Root()))
+	w.statesMu.Lock()
+	defer w.statesMu.Unlock()
+	s := w.states[stateDir]
+	if s == nil {
+		s = &state{
+			locks: newLockSystem(VFS, filepath.Join(stateDir, "locks.json")),
+			props: newPropStore(filepath.Join(stateDir, "props.json")),
+		}
+		w.states[stateDir] = s
+	}
+	return s
+}
+
 // auth does proxy authorization
 func (w *WebDAV) auth(user, pass string) (value interface{}, err error) {
 	VFS, _, err := w.proxy.Call(user, pass, false)
@@ -276,7 +351,26 @@ func (rw *webdavRW) isSuccessfull() bool {
 	return rw.status == 0 || (rw.status >= 200 && rw.status <= 299)
 }
 
-func (w *WebDAV) postprocess(r *http.Request, remote string) {
+func (w *WebDAV) postprocess(r *http.Request, remote string, s *state) {
+	// update the locks and dead properties of resources which have gone or been copied
+	switch r.Method {
+	case "DELETE":
+		s.locks.remove(remote)
+		s.props.remove(remote)
+	case "COPY", "MOVE":
+		dst, err := w.destination(r)
+		if err != nil {
+			fs.Errorf(nil, "Failed to read destination: %v", err)
+			break
+		}
+		if r.Method == "MOVE" {
+			s.locks.remove(remote)
+			s.props.rename(remote, dst)
+		} else {
+			s.props.copy(remote, dst)
+		}
+	}
+
 	// set modtime from requests, don't write to client because status is already written
 	switch r.Method {
 	case "COPY", "MOVE", "PUT":
@@ -308,6 +402,29 @@ func (w *WebDAV) postprocess(r *http.Request, remote string) {
 	}
 }
 
+// destination returns the path in the VFS of the Destination header
+// of a COPY or MOVE request
+func (w *WebDAV) destination(r *http.Request) (string, error) {
+	u, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil {
+		return "", err
+	}
+	dst := u.Path
+	if prefix := strings.TrimRight(w.opt.HTTP.BaseURL, "/"); prefix != "" {
+		if dst != prefix && !strings.HasPrefix(dst, prefix+"/") {
+			return "", fmt.Errorf("destination %q is outside %q", dst, prefix)
+		}
+		dst = dst[len(prefix):]
+	}
+	return strings.Trim(dst, "/"), nil
+}
+
+// ctxKey is the type of the context keys set by the WebDAV server
+type ctxKey int
+
+// ctxKeyPropPatch is set in the context of PROPPATCH requests
+const ctxKeyPropPatch ctxKey = iota
+
 func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	urlPath := r.URL.Path
 	isDir := strings.HasSuffix(urlPath, "/")
@@ -316,14 +433,27 @@ func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		w.serveDir(rw, r, remote)
 		return
 	}
+	VFS, err := w.getVFS(r.Context())
+	if err != nil {
+		http.Error(rw, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to serve WebDAV: %v", err)
+		return
+	}
+	s := w.getState(VFS)
+	// Use the locks of the VFS in use for this request
+	handler := *w.webdavhandler
+	handler.LockSystem = s.locks
 	// Add URL Prefix back to path since webdavhandler needs to
 	// return absolute references.
 	r.URL.Path = w.opt.HTTP.BaseURL + r.URL.Path
+	if r.Method == "PROPPATCH" {
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyPropPatch, true))
+	}
 	wrw := &webdavRW{ResponseWriter: rw}
-	w.webdavhandler.ServeHTTP(wrw, r)
+	handler.ServeHTTP(wrw, r)
 
 	if wrw.isSuccessfull() {
-		w.postprocess(r, remote)
+		w.postprocess(r, remote, s)
 	}
 }
 
@@ -410,11 +540,16 @@ func (w *WebDAV) OpenFile(ctx context.Context, name string, flags int, perm os.F
 	if err != nil {
 		return nil, err
 	}
+	// PROPPATCH opens the resource read write but doesn't write to
+	// it, so open it read only so it isn't uploaded again on close.
+	if isPropPatch, _ := ctx.Value(ctxKeyPropPatch).(bool); isPropPatch && flags == os.O_RDWR {
+		flags = os.O_RDONLY
+	}
 	f, err := VFS.OpenFile(name, flags, perm)
 	if err != nil {
 		return nil, err
 	}
-	return Handle{Handle: f, w: w, ctx: ctx}, nil
+	return Handle{Handle: f, w: w, ctx: ctx, vfs: VFS, state: w.getState(VFS)}, nil
 }
 
 // RemoveAll removes a file or a directory and its contents
@@ -462,8 +597,10 @@ func (w *WebDAV) Stat(ctx context.Context, name string) (fi os.FileInfo, err err
 // Handle represents an open file
 type Handle struct {
 	vfs.Handle
-	w   *WebDAV
-	ctx context.Context
+	w     *WebDAV
+	ctx   context.Context
+	vfs   *vfs.VFS
+	state *state
 }
 
 // Readdir reads directory entries from the handle
@@ -494,7 +631,24 @@ func (h Handle) DeadProps() (map[xml.Name]webdav.Property, error) {
 		xmlName    xml.Name
 		property   webdav.Property
 		properties = make(map[xml.Name]webdav.Property)
+		node       = h.Handle.Node()
 	)
+	props, err := h.state.props.get(h.ctx, h.vfs, node)
+	if err != nil {
+		fs.Errorf(node, "Failed to read dead properties: %v", err)
+	}
+	for _, prop := range props {
+		properties[xml.Name{Space: prop.Space, Local: prop.Local}] = prop.property()
+	}
+	if node.IsDir() {
+		for _, prop := range quotaProps(h.vfs) {
+			properties[prop.XMLName] = prop
+		}
+	}
+	now := time.Now()
+	if prop, ok := lockDiscoveryProp(now, h.state.locks.active(now, node.Path())); ok {
+		properties[prop.XMLName] = prop
+	}
 	if h.w.opt.HashType != hash.None {
 		entry := h.Handle.Node().DirEntry()
 		if o, ok := entry.(fs.Object); ok {
@@ -524,27 +678,70 @@ func (h Handle) DeadProps() (map[xml.Name]webdav.Property, error) {
 	return properties, nil
 }
 
-// Patch changes modtime of the underlying resources, it returns ok for all properties, the error is from setModtime if any
-// FIXME does not check for invalid property and SetModTime error
+// Patch sets and removes the dead properties of the underlying
+// resource, apart from DAV:lastmodified which sets its modtime.
+//
+// The quota properties can't be changed, so if any of them are
+// patched none of the properties are changed.
 func (h Handle) Patch(proppatches []webdav.Proppatch) ([]webdav.Propstat, error) {
 	var (
-		stat webdav.Propstat
-		err  error
+		stat      = webdav.Propstat{Status: http.StatusOK}
+		forbidden = webdav.Propstat{Status: http.StatusForbidden}
+		set       []deadProp
+		remove    []xml.Name
+		err       error
 	)
-	stat.Status = http.StatusOK
 	for _, patch := range proppatches {
 		for _, prop := range patch.Props {
-			stat.Props = append(stat.Props, webdav.Property{XMLName: prop.XMLName})
+			switch prop.XMLName {
+			case quotaAvailableBytes, quotaUsedBytes:
+				forbidden.Props = append(forbidden.Props, webdav.Property{XMLName: prop.XMLName})
+			default:
+				stat.Props = append(stat.Props, webdav.Property{XMLName: prop.XMLName})
+			}
+		}
+	}
+	if len(forbidden.Props) > 0 {
+		propstats := []webdav.Propstat{forbidden}
+		if len(stat.Props) > 0 {
+			stat.Status = http.StatusFailedDependency
+			propstats = append(propstats, stat)
+		}
+		return propstats, nil
+	}
+	for _, patch := range proppatches {
+		for _, prop := range patch.Props {
 			if prop.XMLName.Space == "DAV:" && prop.XMLName.Local == "lastmodified" {
+				if patch.Remove {
+					continue
+				}
 				var modtimeUnix int64
 				modtimeUnix, err = strconv.ParseInt(string(prop.InnerXML), 10, 64)
 				if err == nil {
 					err = h.Handle.Node().SetModTime(time.Unix(modtimeUnix, 0))
 				}
+				if err != nil {
+					return nil, err
+				}
+			} else if patch.Remove {
+				remove = append(remove, prop.XMLName)
+			} else {
+				set = append(set, deadProp{
+					Space:    prop.XMLName.Space,
+					Local:    prop.XMLName.Local,
+					Lang:     prop.Lang,
+					InnerXML: string(prop.InnerXML),
+				})
 			}
 		}
 	}
-	return []webdav.Propstat{stat}, err
+	if len(set) > 0 || len(remove) > 0 {
+		err = h.state.props.patch(h.ctx, h.vfs, h.Handle.Node(), set, remove)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []webdav.Propstat{stat}, nil
 }
 
 // FileInfo represents info about a file satisfying os.FileInfo and
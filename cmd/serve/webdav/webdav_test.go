@@ -14,6 +14,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -56,6 +57,7 @@ func TestWebDav(t *testing.T) {
 		opt.Auth.BasicPass = testPass
 		opt.Template.Path = testTemplate
 		opt.HashType = hash.MD5
+		opt.StateDir = t.TempDir()
 
 		// Start the server
 		w, err := newWebDAV(context.Background(), f, &opt)
@@ -102,6 +104,7 @@ func TestHTTPFunction(t *testing.T) {
 	opt := DefaultOpt
 	opt.HTTP.ListenAddr = []string{testBindAddress}
 	opt.Template.Path = testTemplate
+	opt.StateDir = t.TempDir()
 
 	// Start the server
 	w, err := newWebDAV(context.Background(), f, &opt)
@@ -261,3 +264,161 @@ func HelpTestGET(t *testing.T, testURL string) {
 		checkGolden(t, test.Golden, body)
 	}
 }
+
+// startStateServer starts a server on root keeping its state in
+// stateDir returning its URL and a function to stop it
+func startStateServer(t *testing.T, root, stateDir string) (string, func()) {
+	f, err := fs.NewFs(context.Background(), root)
+	require.NoError(t, err)
+	opt := DefaultOpt
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	opt.HTTP.BaseURL = "/prefix"
+	opt.StateDir = stateDir
+	w, err := newWebDAV(context.Background(), f, &opt)
+	require.NoError(t, err)
+	require.NoError(t, w.serve())
+	return w.Server.URLs()[0], func() {
+		assert.NoError(t, w.Shutdown())
+		w.Wait()
+	}
+}
+
+// doRequest does a WebDAV request returning the response and its body
+func doRequest(t *testing.T, method, url, body string, headers map[string]string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	out, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(out)
+}
+
+const (
+	propfindAll    = `<?xml version="1.0" encoding="utf-8"?><D:propfind xmlns:D="DAV:"><D:allprop/></D:propfind>`
+	propfindLocks  = `<?xml version="1.0" encoding="utf-8"?><D:propfind xmlns:D="DAV:"><D:prop><D:lockdiscovery/></D:prop></D:propfind>`
+	proppatchColor = `<?xml version="1.0" encoding="utf-8"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:C="urn:rclone:test">
+<D:set><D:prop><C:color>red</C:color><C:size>big</C:size></D:prop></D:set>
+</D:propertyupdate>`
+	proppatchRemoveSize = `<?xml version="1.0" encoding="utf-8"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:C="urn:rclone:test">
+<D:remove><D:prop><C:size/></D:prop></D:remove>
+</D:propertyupdate>`
+	proppatchQuota = `<?xml version="1.0" encoding="utf-8"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:C="urn:rclone:test">
+<D:set><D:prop><D:quota-used-bytes>1</D:quota-used-bytes><C:color>blue</C:color></D:prop></D:set>
+</D:propertyupdate>`
+	lockInfo = `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner><D:href>rclone-test</D:href></D:owner></D:lockinfo>`
+)
+
+func TestProperties(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("hello"), 0666))
+	stateDir := t.TempDir()
+	testURL, stop := startStateServer(t, root, stateDir)
+	defer stop()
+
+	for _, name := range []string{"file.txt", "dir/"} {
+		url := testURL + name
+
+		resp, body := doRequest(t, "PROPPATCH", url, proppatchColor, nil)
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode, name)
+		assert.Contains(t, body, "200 OK", name)
+
+		resp, body = doRequest(t, "PROPPATCH", url, proppatchRemoveSize, nil)
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode, name)
+		assert.Contains(t, body, "200 OK", name)
+
+		// The quota can't be set and stops the other properties being set
+		resp, body = doRequest(t, "PROPPATCH", url, proppatchQuota, nil)
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode, name)
+		assert.Contains(t, body, "403 Forbidden", name)
+		assert.Contains(t, body, "424 Failed Dependency", name)
+
+		resp, body = doRequest(t, "PROPFIND", url, propfindAll, map[string]string{"Depth": "0"})
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode, name)
+		assert.Regexp(t, `<color xmlns="urn:rclone:test">red</color>`, body, name)
+		assert.NotContains(t, body, "big", name)
+		assert.NotContains(t, body, "blue", name)
+	}
+
+	// The properties of the file are in its metadata and the
+	// properties of the directory are in the state directory
+	f, err := fs.NewFs(context.Background(), root)
+	require.NoError(t, err)
+	if f.Features().UserMetadata {
+		o, err := f.NewObject(context.Background(), "file.txt")
+		require.NoError(t, err)
+		m, err := fs.GetMetadata(context.Background(), o)
+		require.NoError(t, err)
+		assert.NotEmpty(t, m[propsMetadataKey])
+		data, err := os.ReadFile(filepath.Join(root, "file.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+	}
+	data, err := os.ReadFile(filepath.Join(stateDir, "local", filepath.FromSlash(root), "props.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"/dir"`)
+
+	// Quota is reported for directories
+	_, body := doRequest(t, "PROPFIND", testURL+"dir/", propfindAll, map[string]string{"Depth": "0"})
+	assert.Regexp(t, `<D:quota-available-bytes>\d+</D:quota-available-bytes>`, body)
+	assert.Regexp(t, `<D:quota-used-bytes>\d+</D:quota-used-bytes>`, body)
+
+	// Properties follow a move
+	resp, _ := doRequest(t, "MOVE", testURL+"dir/", "", map[string]string{"Destination": testURL + "moved/"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	_, body = doRequest(t, "PROPFIND", testURL+"moved/", propfindAll, map[string]string{"Depth": "0"})
+	assert.Contains(t, body, "red")
+}
+
+func TestLocks(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("hello"), 0666))
+	stateDir := t.TempDir()
+	testURL, stop := startStateServer(t, root, stateDir)
+	url := testURL + "file.txt"
+
+	resp, body := doRequest(t, "LOCK", url, lockInfo, map[string]string{"Timeout": "Second-3600"})
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	token := strings.Trim(resp.Header.Get("Lock-Token"), "<>")
+	assert.True(t, strings.HasPrefix(token, "opaquelocktoken:"), token)
+
+	// Writing needs the lock token
+	resp, _ = doRequest(t, "PUT", url, "changed", nil)
+	assert.Equal(t, http.StatusLocked, resp.StatusCode)
+	resp, _ = doRequest(t, "PUT", url, "changed", map[string]string{"If": "(<" + token + ">)"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// The lock survives a restart
+	stop()
+	testURL, stop = startStateServer(t, root, stateDir)
+	defer stop()
+	url = testURL + "file.txt"
+
+	resp, body = doRequest(t, "PROPFIND", url, propfindLocks, map[string]string{"Depth": "0"})
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	assert.Contains(t, body, token)
+	assert.Contains(t, body, "rclone-test")
+	assert.Contains(t, body, "/file.txt")
+
+	resp, _ = doRequest(t, "DELETE", url, "", nil)
+	assert.Equal(t, http.StatusLocked, resp.StatusCode)
+
+	resp, _ = doRequest(t, "UNLOCK", url, "", map[string]string{"Lock-Token": "<" + token + ">"})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	_, body = doRequest(t, "PROPFIND", url, propfindLocks, map[string]string{"Depth": "0"})
+	assert.NotContains(t, body, token)
+	resp, _ = doRequest(t, "DELETE", url, "", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
@@ -2,6 +2,7 @@ package accounting
 
 import (
 	"context"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -110,3 +111,54 @@ func bool2Float(e bool) float64 {
 	}
 	return 0
 }
+
+// Metrics provide per transfer metrics.
+type Metrics struct {
+	TransferDuration *prometheus.HistogramVec
+	TransferSize     *prometheus.HistogramVec
+}
+
+// NewMetrics creates a new metrics instance, the instance shall be assigned to
+// DefaultMetrics before any transfers take place.
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		TransferDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "transfer",
+			Name:      "duration_seconds",
+			Help:      "Time taken by each transfer",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"remote", "group"}),
+		TransferSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "transfer",
+			Name:      "size_bytes",
+			Help:      "Bytes transferred by each transfer",
+			Buckets:   prometheus.ExponentialBuckets(1024, 4, 12),
+		}, []string{"remote", "group"}),
+	}
+}
+
+// DefaultMetrics specifies metrics used for transfers.
+var DefaultMetrics = (*Metrics)(nil)
+
+// Collectors returns all prometheus metrics as collectors for registration.
+func (m *Metrics) Collectors() []prometheus.Collector {
+	if m == nil {
+		return nil
+	}
+	return []prometheus.Collector{
+		m.TransferDuration,
+		m.TransferSize,
+	}
+}
+
+// onTransferDone records the transfer of bytes by the transfer from
+// remote in the stats group which took duration
+func (m *Metrics) onTransferDone(remote, group string, bytes int64, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.TransferDuration.WithLabelValues(remote, group).Observe(duration.Seconds())
+	m.TransferSize.WithLabelValues(remote, group).Observe(float64(bytes))
+}
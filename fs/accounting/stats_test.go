@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/stretchr/testify/assert"
@@ -273,6 +274,25 @@ func TestRemoteStats(t *testing.T) {
 	})
 }
 
+func TestTransferMetrics(t *testing.T) {
+	m := NewMetrics("test")
+	oldMetrics := DefaultMetrics
+	DefaultMetrics = m
+	defer func() { DefaultMetrics = oldMetrics }()
+
+	ctx := context.Background()
+	s := NewStatsGroup(ctx, "metrics")
+	tr := s.NewTransferRemoteSize("file", 10)
+	tr.Done(ctx, nil)
+	assert.Equal(t, 1, testutil.CollectAndCount(m.TransferDuration))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.TransferSize))
+
+	// Checks aren't counted
+	tr = s.NewCheckingTransfer(fs.NewDir("dir", time.Now()), "checking")
+	tr.Done(ctx, nil)
+	assert.Equal(t, 1, testutil.CollectAndCount(m.TransferDuration))
+}
+
 // make time ranges from string description for testing
 func makeTimeRanges(t *testing.T, in []string) timeRanges {
 	trs := make(timeRanges, len(in))
@@ -189,6 +189,43 @@ func (tb *tokenBucket) SetBwLimit(bandwidth fs.BwPair) {
 	}
 }
 
+// BwLimiter limits the bandwidth of a group of transfers, for example
+// all the transfers of one user of a server, independently of the
+// global --bwlimit.
+type BwLimiter struct {
+	tbs buckets
+}
+
+// NewBwLimiter makes a BwLimiter with the bandwidth given. Only the
+// Tx and Rx slots are limited.
+func NewBwLimiter(bandwidth fs.BwPair) *BwLimiter {
+	return &BwLimiter{
+		tbs: newTokenBucket(bandwidth),
+	}
+}
+
+// LimitBandwidth sleeps for the correct amount of time for the passage
+// of n bytes through slot i. It returns an error if ctx is cancelled.
+func (l *BwLimiter) LimitBandwidth(ctx context.Context, i TokenBucketSlot, n int) error {
+	tb := l.tbs[i]
+	if tb == nil {
+		return nil
+	}
+	// WaitN fails for more than the burst size so wait in parts
+	burst := tb.Burst()
+	for n > 0 {
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+		if err := tb.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
 // read and set the bandwidth limits
 func (tb *tokenBucket) rcBwlimit(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 	if in["rate"] != nil {
@@ -3,7 +3,9 @@ package accounting
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -90,3 +92,27 @@ func TestRcBwLimit(t *testing.T) {
 	}, out)
 
 }
+
+func TestBwLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewBwLimiter(fs.BwPair{Tx: 1024 * 1024})
+	assert.Nil(t, l.tbs[TokenBucketSlotTransportRx])
+	assert.Nil(t, l.tbs[TokenBucketSlotAccounting])
+
+	// Unlimited slots don't wait
+	start := time.Now()
+	require.NoError(t, l.LimitBandwidth(ctx, TokenBucketSlotTransportRx, 100*1024*1024))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	// 256k at 1M/s takes about 250ms
+	start = time.Now()
+	require.NoError(t, l.LimitBandwidth(ctx, TokenBucketSlotTransportTx, 256*1024))
+	assert.Greater(t, time.Since(start), 200*time.Millisecond)
+
+	// Waits bigger than the burst size can be cancelled
+	burst := l.tbs[TokenBucketSlotTransportTx].Burst()
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err := l.LimitBandwidth(ctx, TokenBucketSlotTransportTx, 2*burst)
+	assert.ErrorIs(t, err, context.Canceled)
+}
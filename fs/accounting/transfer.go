@@ -51,6 +51,7 @@ type Transfer struct {
 	startedAt time.Time
 	checking  bool
 	what      string // what kind of transfer this is
+	fsName    string // name of the remote the object is on if known
 
 	// Protects all below
 	//
@@ -70,7 +71,13 @@ func newCheckingTransfer(stats *StatsInfo, obj fs.DirEntry, what string) *Transf
 
 // newTransfer instantiates new transfer.
 func newTransfer(stats *StatsInfo, obj fs.DirEntry) *Transfer {
-	return newTransferRemoteSize(stats, obj.Remote(), obj.Size(), false, "")
+	tr := newTransferRemoteSize(stats, obj.Remote(), obj.Size(), false, "")
+	if o, ok := obj.(fs.ObjectInfo); ok {
+		if f := o.Fs(); f != nil {
+			tr.fsName = f.Name()
+		}
+	}
+	return tr
 }
 
 func newTransferRemoteSize(stats *StatsInfo, remote string, size int64, checking bool, what string) *Transfer {
@@ -102,7 +109,9 @@ func (tr *Transfer) Done(ctx context.Context, err error) {
 	tr.mu.RUnlock()
 
 	ci := fs.GetConfig(ctx)
+	var bytes int64
 	if acc != nil {
+		bytes, _ = acc.progress()
 		// Close the file if it is still open
 		if err := acc.Close(); err != nil {
 			fs.LogLevelPrintf(ci.StatsLogLevel, nil, "can't close account: %+v\n", err)
@@ -115,11 +124,13 @@ func (tr *Transfer) Done(ctx context.Context, err error) {
 
 	tr.mu.Lock()
 	tr.completedAt = time.Now()
+	duration := tr.completedAt.Sub(tr.startedAt)
 	tr.mu.Unlock()
 
 	if tr.checking {
 		tr.stats.DoneChecking(tr.remote)
 	} else {
+		DefaultMetrics.onTransferDone(tr.fsName, tr.stats.group, bytes, duration)
 		tr.stats.DoneTransferring(tr.remote, err == nil)
 	}
 	tr.stats.PruneTransfers()
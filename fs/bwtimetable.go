@@ -54,6 +54,11 @@ func (bp *BwPair) IsSet() bool {
 	return bp.Tx > 0 || bp.Rx > 0
 }
 
+// Type of the value
+func (bp BwPair) Type() string {
+	return "BwPair"
+}
+
 // BwTimeSlot represents a bandwidth configuration at a point in time.
 type BwTimeSlot struct {
 	DayOfTheWeek int
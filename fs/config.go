@@ -129,11 +129,13 @@ type ConfigInfo struct {
 	MultiThreadSet             bool       // whether MultiThreadStreams was set (set in fs/config/configflags)
 	MultiThreadChunkSize       SizeSuffix // Chunk size for multi-thread downloads / uploads, if not set by filesystem
 	MultiThreadWriteBufferSize SizeSuffix
+	MultiThreadResume          bool   // whether to save the state of multi-thread uploads so they can be resumed
 	OrderBy                    string // instructions on how to order the transfer
 	UploadHeaders              []*HTTPOption
 	DownloadHeaders            []*HTTPOption
 	Headers                    []*HTTPOption
 	MetadataSet                Metadata // extra metadata to write when uploading
+	NameTransform              []string // rules to rename files and directories as they are transferred
 	RefreshTimes               bool
 	NoConsole                  bool
 	TrafficClass               uint8
@@ -150,6 +152,8 @@ type ConfigInfo struct {
 	Inplace                    bool // Download directly to destination file instead of atomic download to temp/rename
 	PartialSuffix              string
 	MetadataMapper             SpaceSepList
+	ListCache                  bool          // keep directory listings in a persistent cache
+	ListCacheMaxAge            time.Duration // maximum age of a cached directory listing
 }
 
 // NewConfig creates a new config with everything set to the default
@@ -195,6 +199,7 @@ func NewConfig() *ConfigInfo {
 	c.KvLockTime = 1 * time.Second
 	c.DefaultTime = Time(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
 	c.PartialSuffix = ".partial"
+	c.ListCacheMaxAge = time.Hour
 
 	// Perform a simple check for debug flags to enable debug logging during the flag initialization
 	for argIndex, arg := range os.Args {
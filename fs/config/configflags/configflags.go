@@ -15,6 +15,7 @@ import (
 	"github.com/rclone/rclone/fs/config/flags"
 	fsLog "github.com/rclone/rclone/fs/log"
 	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/transform"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 )
@@ -129,12 +130,14 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.IntVarP(flagSet, &ci.MultiThreadStreams, "multi-thread-streams", "", ci.MultiThreadStreams, "Number of streams to use for multi-thread downloads", "Copy")
 	flags.FVarP(flagSet, &ci.MultiThreadWriteBufferSize, "multi-thread-write-buffer-size", "", "In memory buffer size for writing when in multi-thread mode", "Copy")
 	flags.FVarP(flagSet, &ci.MultiThreadChunkSize, "multi-thread-chunk-size", "", "Chunk size for multi-thread downloads / uploads, if not set by filesystem", "Copy")
+	flags.BoolVarP(flagSet, &ci.MultiThreadResume, "multi-thread-resume", "", ci.MultiThreadResume, "Save the state of multi-thread uploads so they can be resumed by the next run", "Copy")
 	flags.BoolVarP(flagSet, &ci.UseJSONLog, "use-json-log", "", ci.UseJSONLog, "Use json log format", "Logging")
 	flags.StringVarP(flagSet, &ci.OrderBy, "order-by", "", ci.OrderBy, "Instructions on how to order the transfers, e.g. 'size,descending'", "Copy")
 	flags.StringArrayVarP(flagSet, &uploadHeaders, "header-upload", "", nil, "Set HTTP header for upload transactions", "Networking")
 	flags.StringArrayVarP(flagSet, &downloadHeaders, "header-download", "", nil, "Set HTTP header for download transactions", "Networking")
 	flags.StringArrayVarP(flagSet, &headers, "header", "", nil, "Set HTTP header for all transactions", "Networking")
 	flags.StringArrayVarP(flagSet, &metadataSet, "metadata-set", "", nil, "Add metadata key=value when uploading", "Metadata")
+	flags.StringArrayVarP(flagSet, &ci.NameTransform, "name-transform", "", nil, "Transform paths during the copy process", "Copy")
 	flags.BoolVarP(flagSet, &ci.RefreshTimes, "refresh-times", "", ci.RefreshTimes, "Refresh the modtime of remote files", "Copy")
 	flags.BoolVarP(flagSet, &ci.NoConsole, "no-console", "", ci.NoConsole, "Hide console window (supported on Windows only)", "Config")
 	flags.StringVarP(flagSet, &dscp, "dscp", "", "", "Set DSCP value to connections, value or name, e.g. CS1, LE, DF, AF21", "Networking")
@@ -151,6 +154,8 @@ func AddFlags(ci *fs.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.BoolVarP(flagSet, &ci.Inplace, "inplace", "", ci.Inplace, "Download directly to destination file instead of atomic download to temp/rename", "Copy")
 	flags.StringVarP(flagSet, &partialSuffix, "partial-suffix", "", ci.PartialSuffix, "Add partial-suffix to temporary file name when --inplace is not used", "Copy")
 	flags.FVarP(flagSet, &ci.MetadataMapper, "metadata-mapper", "", "Program to run to transforming metadata before upload", "Metadata")
+	flags.BoolVarP(flagSet, &ci.ListCache, "list-cache", "", ci.ListCache, "Keep directory listings in a persistent cache to reuse in later runs", "Listing")
+	flags.DurationVarP(flagSet, &ci.ListCacheMaxAge, "list-cache-max-age", "", ci.ListCacheMaxAge, "Maximum age of cached directory listings", "Listing")
 }
 
 // ParseHeaders converts the strings passed in via the header flags into HTTPOptions
@@ -298,6 +303,11 @@ func SetFlags(ci *fs.ConfigInfo) {
 		}
 		fs.Debugf(nil, "MetadataUpload %v", ci.MetadataSet)
 	}
+	if len(ci.NameTransform) != 0 {
+		if _, err := transform.Parse(ci.NameTransform); err != nil {
+			log.Fatalf("--name-transform: %v", err)
+		}
+	}
 	if len(dscp) != 0 {
 		if value, ok := parseDSCP(dscp); ok {
 			ci.TrafficClass = value << 2
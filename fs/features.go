@@ -158,6 +158,14 @@ type Features struct {
 	//
 	OpenChunkWriter func(ctx context.Context, remote string, src ObjectInfo, options ...OpenOption) (info ChunkWriterInfo, writer ChunkWriter, err error)
 
+	// ResumeChunkWriter carries on the chunked write described by
+	// state which was started with OpenChunkWriter, possibly by a
+	// different process.
+	//
+	// The chunks which the returned ChunkWriter has already written
+	// can be read with its ChunkWriterState method.
+	ResumeChunkWriter func(ctx context.Context, remote string, src ObjectInfo, state ChunkWriterState, options ...OpenOption) (info ChunkWriterInfo, writer ChunkWriter, err error)
+
 	// UserInfo returns info about the connected user
 	UserInfo func(ctx context.Context) (map[string]string, error)
 
@@ -312,6 +320,9 @@ func (ft *Features) Fill(ctx context.Context, f Fs) *Features {
 	if do, ok := f.(OpenChunkWriter); ok {
 		ft.OpenChunkWriter = do.OpenChunkWriter
 	}
+	if do, ok := f.(ResumeChunkWriter); ok {
+		ft.ResumeChunkWriter = do.ResumeChunkWriter
+	}
 	if do, ok := f.(UserInfoer); ok {
 		ft.UserInfo = do.UserInfo
 	}
@@ -407,6 +418,9 @@ func (ft *Features) Mask(ctx context.Context, f Fs) *Features {
 	if mask.OpenChunkWriter == nil {
 		ft.OpenChunkWriter = nil
 	}
+	if mask.ResumeChunkWriter == nil {
+		ft.ResumeChunkWriter = nil
+	}
 	if mask.UserInfo == nil {
 		ft.UserInfo = nil
 	}
@@ -662,6 +676,8 @@ type OpenChunkWriterFn func(ctx context.Context, remote string, src ObjectInfo,
 // ChunkWriter is returned by OpenChunkWriter to implement chunked writing
 type ChunkWriter interface {
 	// WriteChunk will write chunk number with reader bytes, where chunk number >= 0
+	//
+	// Writing a chunk number which has already been written replaces it.
 	WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (bytesWritten int64, err error)
 
 	// Close complete chunked writer finalising the file.
@@ -673,6 +689,33 @@ type ChunkWriter interface {
 	Abort(ctx context.Context) error
 }
 
+// ChunkWriterState describes a chunked write in progress so that it
+// can be carried on later with ResumeChunkWriter.
+type ChunkWriterState struct {
+	ID        string         `json:"id"`        // backend specific ID of the write, eg the upload ID
+	ChunkSize int64          `json:"chunkSize"` // size of the chunks being written
+	Chunks    map[int]string `json:"chunks"`    // backend specific record, eg the hash, of each chunk written by number
+}
+
+// ChunkWriterStater is an optional interface for ChunkWriter to
+// implement if its writes can be resumed with ResumeChunkWriter
+type ChunkWriterStater interface {
+	// ChunkWriterState returns the state of the write so far
+	ChunkWriterState() ChunkWriterState
+}
+
+// ResumeChunkWriter is an optional interface for Fs to implement
+// resuming chunked writes started by OpenChunkWriter
+type ResumeChunkWriter interface {
+	// ResumeChunkWriter carries on the chunked write described by
+	// state which was started with OpenChunkWriter, possibly by a
+	// different process.
+	//
+	// The chunks which the returned ChunkWriter has already written
+	// can be read with its ChunkWriterState method.
+	ResumeChunkWriter(ctx context.Context, remote string, src ObjectInfo, state ChunkWriterState, options ...OpenOption) (info ChunkWriterInfo, writer ChunkWriter, err error)
+}
+
 // UserInfoer is an optional interface for Fs
 type UserInfoer interface {
 	// UserInfo returns info about the connected user
@@ -17,6 +17,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/tracing"
 	"github.com/rclone/rclone/lib/structs"
 	"golang.org/x/net/publicsuffix"
 )
@@ -114,7 +115,7 @@ func NewTransportCustom(ctx context.Context, customize func(*http.Transport)) ht
 	}
 
 	// Wrap that http.Transport in our own transport
-	return newTransport(ci, t)
+	return newTransport(ctx, ci, t)
 }
 
 // NewTransport returns an http.RoundTripper with the correct timeouts
@@ -122,6 +123,15 @@ func NewTransport(ctx context.Context) http.RoundTripper {
 	(*noTransport).Do(func() {
 		transport = NewTransportCustom(ctx, nil)
 	})
+	// Label the metrics of the shared transport with the remote
+	// being made with ctx
+	if t, ok := transport.(*Transport); ok {
+		if remote, backend := fs.RemoteFromContext(ctx); remote != t.remote || backend != t.backend {
+			tCopy := *t
+			tCopy.remote, tCopy.backend = remote, backend
+			return &tCopy
+		}
+	}
 	return transport
 }
 
@@ -148,17 +158,22 @@ type Transport struct {
 	userAgent     string
 	headers       []*fs.HTTPOption
 	metrics       *Metrics
+	remote        string // name of the remote using the transport for metrics
+	backend       string // type of the backend using the transport for metrics
 }
 
 // newTransport wraps the http.Transport passed in and logs all
 // roundtrips including the body if logBody is set.
-func newTransport(ci *fs.ConfigInfo, transport *http.Transport) *Transport {
+func newTransport(ctx context.Context, ci *fs.ConfigInfo, transport *http.Transport) *Transport {
+	remote, backend := fs.RemoteFromContext(ctx)
 	return &Transport{
 		Transport: transport,
 		dump:      ci.Dump,
 		userAgent: ci.UserAgent,
 		headers:   ci.Headers,
 		metrics:   DefaultMetrics,
+		remote:    remote,
+		backend:   backend,
 	}
 }
 
@@ -247,6 +262,26 @@ func cleanAuths(buf []byte) []byte {
 	return buf
 }
 
+// startSpan starts a trace span for req which is a child of the span
+// in the request context if any
+func (t *Transport) startSpan(req *http.Request) *tracing.Span {
+	if !tracing.Enabled() {
+		return nil
+	}
+	// Don't trace the query as it may contain credentials
+	u := *req.URL
+	u.User = nil
+	u.RawQuery = ""
+	_, span := tracing.StartClient(req.Context(), "HTTP "+req.Method,
+		tracing.String("http.request.method", req.Method),
+		tracing.String("url.full", u.String()),
+		tracing.String("server.address", req.URL.Hostname()),
+		tracing.String("rclone.remote", t.remote),
+		tracing.String("rclone.backend", t.backend),
+	)
+	return span
+}
+
 // RoundTrip implements the RoundTripper interface.
 func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
 	// Limit transactions per second if required
@@ -275,7 +310,14 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 		logMutex.Unlock()
 	}
 	// Do round trip
+	span := t.startSpan(req)
+	start := time.Now()
 	resp, err = t.Transport.RoundTrip(req)
+	duration := time.Since(start)
+	if resp != nil {
+		span.SetAttributes(tracing.Int64("http.response.status_code", int64(resp.StatusCode)))
+	}
+	span.End(err)
 	// Logf response
 	if t.dump&(fs.DumpHeaders|fs.DumpBodies|fs.DumpAuth|fs.DumpRequests|fs.DumpResponses) != 0 {
 		logMutex.Lock()
@@ -291,7 +333,7 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 		logMutex.Unlock()
 	}
 	// Update metrics
-	t.metrics.onResponse(req, resp)
+	t.metrics.onResponse(t, req, resp, duration)
 
 	if err == nil {
 		checkServerTime(req, resp)
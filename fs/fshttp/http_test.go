@@ -1,9 +1,15 @@
 package fshttp
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rclone/rclone/fs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCleanAuth(t *testing.T) {
@@ -45,3 +51,27 @@ func TestCleanAuths(t *testing.T) {
 		assert.Equal(t, test.want, got, test.in)
 	}
 }
+
+func TestTransportMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer ts.Close()
+
+	m := NewMetrics("test")
+	oldMetrics := DefaultMetrics
+	DefaultMetrics = m
+	defer func() { DefaultMetrics = oldMetrics }()
+
+	ctx := context.Background()
+	ci := fs.GetConfig(ctx)
+	tr := newTransport(ctx, ci, http.DefaultTransport.(*http.Transport).Clone())
+	tr.remote, tr.backend = "remote", "backend"
+	client := &http.Client{Transport: tr}
+	resp, err := client.Get(ts.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.Requests.WithLabelValues("remote", "backend", "GET", "418")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.Duration))
+}
@@ -3,6 +3,7 @@ package fshttp
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -10,6 +11,8 @@ import (
 // Metrics provide Transport HTTP level metrics.
 type Metrics struct {
 	StatusCode *prometheus.CounterVec
+	Requests   *prometheus.CounterVec
+	Duration   *prometheus.HistogramVec
 }
 
 // NewMetrics creates a new metrics instance, the instance shall be assigned to
@@ -21,6 +24,19 @@ func NewMetrics(namespace string) *Metrics {
 			Subsystem: "http",
 			Name:      "status_code",
 		}, []string{"host", "method", "code"}),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests made by each remote",
+		}, []string{"remote", "backend", "method", "code"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Time from sending each HTTP request to receiving the response headers",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+		}, []string{"remote", "backend", "method", "code"}),
 	}
 }
 
@@ -34,10 +50,12 @@ func (m *Metrics) Collectors() []prometheus.Collector {
 	}
 	return []prometheus.Collector{
 		m.StatusCode,
+		m.Requests,
+		m.Duration,
 	}
 }
 
-func (m *Metrics) onResponse(req *http.Request, resp *http.Response) {
+func (m *Metrics) onResponse(t *Transport, req *http.Request, resp *http.Response, duration time.Duration) {
 	if m == nil {
 		return
 	}
@@ -46,6 +64,9 @@ func (m *Metrics) onResponse(req *http.Request, resp *http.Response) {
 	if resp != nil {
 		statusCode = resp.StatusCode
 	}
+	code := fmt.Sprint(statusCode)
 
-	m.StatusCode.WithLabelValues(req.Host, req.Method, fmt.Sprint(statusCode)).Inc()
+	m.StatusCode.WithLabelValues(req.Host, req.Method, code).Inc()
+	m.Requests.WithLabelValues(t.remote, t.backend, req.Method, code).Inc()
+	m.Duration.WithLabelValues(t.remote, t.backend, req.Method, code).Observe(duration.Seconds())
 }
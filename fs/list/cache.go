@@ -0,0 +1,624 @@
+package list
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/tracing"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+const (
+	// cacheFacility is the name of the key-value database used
+	cacheFacility = "listcache"
+	// changeNotifyPollInterval is how often backends are asked to
+	// poll for changes
+	changeNotifyPollInterval = time.Minute
+)
+
+// listCache is a persistent cache of the directory listings of the
+// remote called name, used when --list-cache is set.
+//
+// Listings are stored under their path from the root of the remote,
+// so Fs with different roots on the same remote share them. Each
+// listing expires after --list-cache-max-age. Listings are removed
+// when rclone changes the directory and when the backend notifies
+// changes with ChangeNotify.
+type listCache struct {
+	name   string
+	db     *kv.DB
+	ctx    context.Context    // cancelled when the cache is stopped
+	cancel context.CancelFunc // stops the change notifications
+
+	mu       sync.Mutex
+	changes  map[string]uint64 // number of times each key has been invalidated
+	trees    uint64            // number of times a tree has been invalidated
+	watching map[string]bool   // roots we are getting change notifications for
+}
+
+// cacheRecord is a directory listing stored in the cache
+type cacheRecord struct {
+	Time    time.Time // when the listing was read
+	Entries []cacheEntry
+}
+
+// cacheEntry is an object or a directory in a cacheRecord
+type cacheEntry struct {
+	Name    string // leaf name
+	Dir     bool   // set if this is a directory
+	Size    int64
+	Items   int64 // number of items in a directory
+	ModTime time.Time
+	Hashes  map[hash.Type]string
+	ID      string
+}
+
+var (
+	cachesMu sync.Mutex
+	caches   = map[string]*listCache{}
+)
+
+// getCache returns the listing cache for f or nil if it isn't in use
+func getCache(ctx context.Context, f fs.Info) *listCache {
+	if !fs.GetConfig(ctx).ListCache || !kv.Supported() {
+		return nil
+	}
+	fsys, ok := f.(fs.Fs)
+	if !ok {
+		return nil
+	}
+	name := fsys.Name()
+	cachesMu.Lock()
+	c, found := caches[name]
+	if !found {
+		db, err := kv.Start(ctx, cacheFacility, fsys)
+		if err != nil {
+			fs.Errorf(fsys, "Failed to open listing cache - not using it: %v", err)
+		} else {
+			cacheCtx, cancel := context.WithCancel(context.Background())
+			c = &listCache{
+				name:     name,
+				db:       db,
+				ctx:      cacheCtx,
+				cancel:   cancel,
+				changes:  map[string]uint64{},
+				watching: map[string]bool{},
+			}
+			atexit.Register(c.stop)
+		}
+		caches[name] = c
+	}
+	cachesMu.Unlock()
+	if c != nil {
+		c.watch(fsys)
+	}
+	return c
+}
+
+// watch starts listening to change notifications for fsys if the
+// backend supports them and we aren't already
+func (c *listCache) watch(fsys fs.Fs) {
+	doChangeNotify := fsys.Features().ChangeNotify
+	if doChangeNotify == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	root := fsys.Root()
+	if c.watching[root] {
+		return
+	}
+	c.watching[root] = true
+	ctx := c.ctx
+	pollInterval := make(chan time.Duration, 1)
+	pollInterval <- changeNotifyPollInterval
+	doChangeNotify(ctx, func(remote string, entryType fs.EntryType) {
+		fs.Debugf(fsys, "Listing cache: change notified for %q", remote)
+		if entryType == fs.EntryDirectory {
+			c.invalidate(ctx, fsys, remote, true)
+		} else {
+			c.invalidate(ctx, fsys, parentDir(remote), false)
+		}
+	}, pollInterval)
+}
+
+// stop stops the change notifications of the cache
+func (c *listCache) stop() {
+	c.cancel()
+}
+
+// key returns the database key for the absolute path p
+func (c *listCache) key(p string) string {
+	return c.name + ":" + p
+}
+
+// parentDir returns the directory containing remote
+func parentDir(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// parents returns the directories above the absolute path p
+func parents(p string) (dirs []string) {
+	for p != "" {
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		if parent == p {
+			break
+		}
+		dirs = append(dirs, parent)
+		p = parent
+	}
+	return dirs
+}
+
+// generation returns a number which changes whenever the listing of
+// key is invalidated
+func (c *listCache) generation(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changes[key] + c.trees
+}
+
+// get returns the cached listing of dir in f if it hasn't expired
+func (c *listCache) get(ctx context.Context, f fs.Fs, dir string) (entries fs.DirEntries, ok bool) {
+	key := c.key(path.Join(f.Root(), dir))
+	op := &opGet{key: key}
+	err := c.db.Do(false, op)
+	if err != nil && err != kv.ErrEmpty {
+		fs.Debugf(f, "Listing cache: failed to read %q: %v", dir, err)
+		return nil, false
+	}
+	if !op.found {
+		return nil, false
+	}
+	if time.Since(op.rec.Time) > fs.GetConfig(ctx).ListCacheMaxAge {
+		fs.Debugf(f, "Listing cache: %q expired", dir)
+		return nil, false
+	}
+	entries = make(fs.DirEntries, 0, len(op.rec.Entries))
+	for _, e := range op.rec.Entries {
+		remote := path.Join(dir, e.Name)
+		if e.Dir {
+			entries = append(entries, fs.NewDir(remote, e.ModTime).SetSize(e.Size).SetItems(e.Items).SetID(e.ID))
+		} else {
+			entries = append(entries, &cachedObject{
+				f:       f,
+				remote:  remote,
+				size:    e.Size,
+				modTime: e.ModTime,
+				hashes:  e.Hashes,
+				id:      e.ID,
+			})
+		}
+	}
+	fs.Debugf(f, "Listing cache: using cached listing of %q", dir)
+	return entries, true
+}
+
+// put stores the listing of dir in f in the cache unless it has been
+// invalidated since generation gen
+func (c *listCache) put(ctx context.Context, f fs.Fs, dir string, entries fs.DirEntries, gen uint64) {
+	var hashTypes []hash.Type
+	if !f.Features().SlowHash {
+		hashTypes = f.Hashes().Array()
+	}
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	rec := cacheRecord{
+		Time:    time.Now(),
+		Entries: make([]cacheEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		name := strings.TrimPrefix(entry.Remote(), prefix)
+		if name == entry.Remote() && prefix != "" {
+			return // leave it to DirSorted to complain
+		}
+		e := cacheEntry{
+			Name:    name,
+			Size:    entry.Size(),
+			ModTime: entry.ModTime(ctx),
+		}
+		switch x := entry.(type) {
+		case fs.Object:
+			if !x.Storable() {
+				return
+			}
+			for _, hashType := range hashTypes {
+				sum, err := x.Hash(ctx, hashType)
+				if err == nil && sum != "" {
+					if e.Hashes == nil {
+						e.Hashes = map[hash.Type]string{}
+					}
+					e.Hashes[hashType] = sum
+				}
+			}
+			if do, ok := x.(fs.IDer); ok {
+				e.ID = do.ID()
+			}
+		case fs.Directory:
+			e.Dir = true
+			e.Items = x.Items()
+			e.ID = x.ID()
+		default:
+			return
+		}
+		rec.Entries = append(rec.Entries, e)
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&rec)
+	if err != nil {
+		fs.Debugf(f, "Listing cache: failed to encode %q: %v", dir, err)
+		return
+	}
+	key := c.key(path.Join(f.Root(), dir))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.changes[key]+c.trees != gen {
+		fs.Debugf(f, "Listing cache: not storing %q as it changed while being listed", dir)
+		return
+	}
+	err = c.db.Do(true, &opPut{key: key, data: buf.Bytes()})
+	if err != nil {
+		fs.Debugf(f, "Listing cache: failed to store %q: %v", dir, err)
+	}
+}
+
+// invalidate removes the listing of dir in f and the listings of its
+// parents from the cache, and those of the directories under it if
+// tree is set.
+func (c *listCache) invalidate(ctx context.Context, f fs.Info, dir string, tree bool) {
+	p := path.Join(f.Root(), dir)
+	op := &opFind{keys: []string{c.key(p)}}
+	for _, parent := range parents(p) {
+		op.keys = append(op.keys, c.key(parent))
+	}
+	if tree {
+		prefix := c.key(p)
+		if p != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		op.prefix = prefix
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range op.keys {
+		c.changes[key]++
+	}
+	if tree {
+		c.trees++
+	}
+	// Look before deleting to avoid a write transaction if
+	// nothing is cached
+	err := c.db.Do(false, op)
+	if err == kv.ErrEmpty {
+		return
+	}
+	if err == nil && len(op.found) > 0 {
+		err = c.db.Do(true, &opDelete{keys: op.found})
+	}
+	if err != nil {
+		fs.Errorf(f, "Listing cache: failed to invalidate %q: %v", dir, err)
+	}
+}
+
+// listDir lists dir in f, using the listing cache if it is in use
+func listDir(ctx context.Context, f fs.Fs, dir string) (entries fs.DirEntries, err error) {
+	c := getCache(ctx, f)
+	if c == nil {
+		return fsList(ctx, f, dir)
+	}
+	if entries, ok := c.get(ctx, f, dir); ok {
+		return entries, nil
+	}
+	gen := c.generation(c.key(path.Join(f.Root(), dir)))
+	entries, err = fsList(ctx, f, dir)
+	if err != nil {
+		return nil, err
+	}
+	c.put(ctx, f, dir, entries, gen)
+	return entries, nil
+}
+
+// fsList lists dir in f recording a trace span
+func fsList(ctx context.Context, f fs.Fs, dir string) (entries fs.DirEntries, err error) {
+	ctx, span := tracing.Start(ctx, "List", tracing.Remote(f, dir)...)
+	entries, err = f.List(ctx, dir)
+	span.End(err)
+	return entries, err
+}
+
+// InvalidateObject removes the listing of the directory containing
+// remote in f, and the listings of the directories above it, from the
+// listing cache.
+//
+// It should be called whenever an object is created, changed or
+// removed.
+func InvalidateObject(ctx context.Context, f fs.Info, remote string) {
+	if c := getCache(ctx, f); c != nil {
+		c.invalidate(ctx, f, parentDir(remote), false)
+	}
+}
+
+// InvalidateDir removes the listing of dir in f, the listings of the
+// directories above and below it, from the listing cache.
+//
+// It should be called whenever a directory is created, moved or
+// removed.
+func InvalidateDir(ctx context.Context, f fs.Info, dir string) {
+	if c := getCache(ctx, f); c != nil {
+		c.invalidate(ctx, f, dir, true)
+	}
+}
+
+// Resolve returns the backend's own object for o if o was read from
+// the listing cache, otherwise it returns o.
+//
+// Server-side operations need the backend's own objects.
+func Resolve(ctx context.Context, o fs.Object) (fs.Object, error) {
+	if co, ok := o.(*cachedObject); ok {
+		return co.resolve(ctx)
+	}
+	return o, nil
+}
+
+// opGet reads a record from the database
+type opGet struct {
+	key   string
+	rec   cacheRecord
+	found bool
+}
+
+func (op *opGet) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.key))
+	if data == nil {
+		return nil
+	}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&op.rec)
+	if err != nil {
+		return err
+	}
+	op.found = true
+	return nil
+}
+
+// opPut writes a record to the database
+type opPut struct {
+	key  string
+	data []byte
+}
+
+func (op *opPut) Do(ctx context.Context, b kv.Bucket) error {
+	return b.Put([]byte(op.key), op.data)
+}
+
+// opFind finds which of keys and the keys starting with prefix are
+// in the database
+type opFind struct {
+	keys   []string
+	prefix string
+	found  []string
+}
+
+func (op *opFind) Do(ctx context.Context, b kv.Bucket) error {
+	op.found = op.found[:0]
+	for _, key := range op.keys {
+		if b.Get([]byte(key)) != nil {
+			op.found = append(op.found, key)
+		}
+	}
+	if op.prefix != "" {
+		prefix := []byte(op.prefix)
+		cursor := b.Cursor()
+		for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			op.found = append(op.found, string(k))
+		}
+	}
+	return nil
+}
+
+// opDelete removes keys from the database
+type opDelete struct {
+	keys []string
+}
+
+func (op *opDelete) Do(ctx context.Context, b kv.Bucket) error {
+	for _, key := range op.keys {
+		err := b.Delete([]byte(key))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cachedObject is an Object read from the listing cache.
+//
+// It answers questions about the object from the cache and reads the
+// object from the backend when it needs to do anything else.
+type cachedObject struct {
+	f       fs.Fs
+	remote  string
+	size    int64
+	modTime time.Time
+	hashes  map[hash.Type]string
+	id      string
+
+	mu sync.Mutex
+	o  fs.Object // the object read from the backend or nil
+}
+
+// resolve reads the object from the backend if not already done
+func (o *cachedObject) resolve(ctx context.Context) (fs.Object, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.o == nil {
+		obj, err := o.f.NewObject(ctx, o.remote)
+		if err != nil {
+			return nil, err
+		}
+		o.o = obj
+	}
+	return o.o, nil
+}
+
+// resolved returns the object read from the backend or nil
+func (o *cachedObject) resolved() fs.Object {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.o
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *cachedObject) Fs() fs.Info {
+	return o.f
+}
+
+// String returns a description of the Object
+func (o *cachedObject) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *cachedObject) Remote() string {
+	return o.remote
+}
+
+// ModTime returns the modification date of the file
+func (o *cachedObject) ModTime(ctx context.Context) time.Time {
+	if obj := o.resolved(); obj != nil {
+		return obj.ModTime(ctx)
+	}
+	return o.modTime
+}
+
+// Size returns the size of the file
+func (o *cachedObject) Size() int64 {
+	if obj := o.resolved(); obj != nil {
+		return obj.Size()
+	}
+	return o.size
+}
+
+// Hash returns the selected checksum of the file
+func (o *cachedObject) Hash(ctx context.Context, ty hash.Type) (string, error) {
+	if obj := o.resolved(); obj == nil {
+		if sum, found := o.hashes[ty]; found {
+			return sum, nil
+		}
+	}
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	return obj.Hash(ctx, ty)
+}
+
+// MimeType returns the content type of the Object if known, or "" if
+// not
+func (o *cachedObject) MimeType(ctx context.Context) string {
+	if !o.f.Features().ReadMimeType {
+		return ""
+	}
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		fs.Debugf(o, "Listing cache: failed to read mime type: %v", err)
+		return ""
+	}
+	if do, ok := obj.(fs.MimeTyper); ok {
+		return do.MimeType(ctx)
+	}
+	return ""
+}
+
+// Metadata returns metadata for an object
+//
+// It returns nil if there is no Metadata
+func (o *cachedObject) Metadata(ctx context.Context) (fs.Metadata, error) {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if do, ok := obj.(fs.Metadataer); ok {
+		return do.Metadata(ctx)
+	}
+	return nil, nil
+}
+
+// Storable says whether this object can be stored
+func (o *cachedObject) Storable() bool {
+	return true
+}
+
+// ID returns the ID of the Object if known, or "" if not
+func (o *cachedObject) ID() string {
+	if obj := o.resolved(); obj != nil {
+		if do, ok := obj.(fs.IDer); ok {
+			return do.ID()
+		}
+	}
+	return o.id
+}
+
+// SetModTime sets the metadata on the object to set the modification date
+func (o *cachedObject) SetModTime(ctx context.Context, t time.Time) error {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return obj.SetModTime(ctx, t)
+}
+
+// Open opens the file for read
+func (o *cachedObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Open(ctx, options...)
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *cachedObject) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return obj.Update(ctx, in, src, options...)
+}
+
+// Remove this object
+func (o *cachedObject) Remove(ctx context.Context) error {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return obj.Remove(ctx)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object     = (*cachedObject)(nil)
+	_ fs.IDer       = (*cachedObject)(nil)
+	_ fs.MimeTyper  = (*cachedObject)(nil)
+	_ fs.Metadataer = (*cachedObject)(nil)
+)
@@ -0,0 +1,143 @@
+package list
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// names returns the remotes of entries
+func names(entries fs.DirEntries) (names []string) {
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	return names
+}
+
+func TestListCache(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("listing cache not supported on this OS")
+	}
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.ListCache = true
+	dir := t.TempDir()
+	writeFile := func(name, contents string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0777))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0666))
+	}
+	writeFile("file1", "one")
+	writeFile("sub/file2", "two")
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	dirSorted := func(f fs.Fs, dir string) []string {
+		entries, err := DirSorted(ctx, f, true, dir)
+		require.NoError(t, err)
+		return names(entries)
+	}
+	assert.Equal(t, []string{"file1", "sub"}, dirSorted(f, ""))
+	assert.Equal(t, []string{"sub/file2"}, dirSorted(f, "sub"))
+
+	// Changes made outside rclone aren't seen
+	writeFile("file3", "three")
+	writeFile("sub/file4", "four")
+	assert.Equal(t, []string{"file1", "sub"}, dirSorted(f, ""))
+	assert.Equal(t, []string{"sub/file2"}, dirSorted(f, "sub"))
+
+	// The cached objects work
+	entries, err := DirSorted(ctx, f, true, "sub")
+	require.NoError(t, err)
+	o := entries[0].(fs.Object)
+	assert.IsType(t, &cachedObject{}, o)
+	assert.Equal(t, int64(3), o.Size())
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "two", string(data))
+	resolved, err := Resolve(ctx, o)
+	require.NoError(t, err)
+	assert.NotEqual(t, o, resolved)
+	_, isCached := resolved.(*cachedObject)
+	assert.False(t, isCached)
+	metadata, err := fs.GetMetadata(ctx, o)
+	require.NoError(t, err)
+	wantMetadata, err := fs.GetMetadata(ctx, resolved)
+	require.NoError(t, err)
+	assert.Equal(t, wantMetadata, metadata)
+
+	// An Fs with a different root shares the listings
+	fsub, err := fs.NewFs(ctx, filepath.Join(dir, "sub"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file2"}, dirSorted(fsub, ""))
+
+	// Invalidating an object invalidates its directory and the
+	// ones above it
+	InvalidateObject(ctx, fsub, "file4")
+	assert.Equal(t, []string{"file1", "file3", "sub"}, dirSorted(f, ""))
+	assert.Equal(t, []string{"sub/file2", "sub/file4"}, dirSorted(f, "sub"))
+
+	// Invalidating a directory invalidates the ones below it
+	writeFile("file5", "five")
+	writeFile("sub/file6", "six")
+	InvalidateDir(ctx, f, "")
+	assert.Equal(t, []string{"file1", "file3", "file5", "sub"}, dirSorted(f, ""))
+	assert.Equal(t, []string{"sub/file2", "sub/file4", "sub/file6"}, dirSorted(f, "sub"))
+
+	// Expired listings aren't used
+	writeFile("file7", "seven")
+	ci.ListCacheMaxAge = 0
+	assert.Equal(t, []string{"file1", "file3", "file5", "file7", "sub"}, dirSorted(f, ""))
+
+	// Nothing is cached without --list-cache
+	ci.ListCache = false
+	assert.Nil(t, getCache(ctx, f))
+}
+
+func TestListCacheChangedWhileListing(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("listing cache not supported on this OS")
+	}
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.ListCache = true
+	dir := t.TempDir()
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	c := getCache(ctx, f)
+	require.NotNil(t, c)
+
+	// A listing invalidated while being read isn't stored
+	key := c.key(f.Root())
+	gen := c.generation(key)
+	InvalidateObject(ctx, f, "file")
+	c.put(ctx, f, "", fs.DirEntries{fs.NewDir("dir", time.Now())}, gen)
+	_, ok := c.get(ctx, f, "")
+	assert.False(t, ok)
+
+	gen = c.generation(key)
+	c.put(ctx, f, "", fs.DirEntries{fs.NewDir("dir", time.Now())}, gen)
+	entries, ok := c.get(ctx, f, "")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"dir"}, names(entries))
+}
+
+func TestParents(t *testing.T) {
+	assert.Equal(t, []string(nil), parents(""))
+	assert.Equal(t, []string{""}, parents("bucket"))
+	assert.Equal(t, []string{"bucket/dir", "bucket", ""}, parents("bucket/dir/sub"))
+	assert.Equal(t, []string{"/tmp", "/"}, parents("/tmp/dir"))
+	assert.Equal(t, "", parentDir("file"))
+	assert.Equal(t, "dir/sub", parentDir("dir/sub/file"))
+}
@@ -20,8 +20,8 @@ import (
 //
 // Files will be returned in sorted order
 func DirSorted(ctx context.Context, f fs.Fs, includeAll bool, dir string) (entries fs.DirEntries, err error) {
-	// Get unfiltered entries from the fs
-	entries, err = f.List(ctx, dir)
+	// Get unfiltered entries from the fs or the listing cache
+	entries, err = listDir(ctx, f, dir)
 	if err != nil {
 		return nil, err
 	}
@@ -13,7 +13,9 @@ import (
 	"github.com/rclone/rclone/fs/dirtree"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/list"
+	"github.com/rclone/rclone/fs/tracing"
 	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/transform"
 	"golang.org/x/text/unicode/norm"
 )
 
@@ -35,6 +37,7 @@ type March struct {
 	srcListDir listDirFn // function to call to list a directory in the src
 	dstListDir listDirFn // function to call to list a directory in the dst
 	transforms []matchTransformFn
+	names      transform.Transforms // --name-transform rules applied to source names
 	limiter    chan struct{} // make sure we don't do too many operations at once
 }
 
@@ -56,6 +59,8 @@ func (m *March) init(ctx context.Context) {
 	if !m.NoTraverse {
 		m.dstListDir = m.makeListDir(ctx, m.Fdst, m.DstIncludeAll)
 	}
+	// Source names are renamed with --name-transform before matching
+	m.names = transform.Get(ctx)
 	// Now create the matching transform
 	// ..normalise the UTF8 first
 	if !m.NoUnicodeNormalization {
@@ -75,7 +80,7 @@ func (m *March) init(ctx context.Context) {
 }
 
 // list a directory into entries, err
-type listDirFn func(dir string) (entries fs.DirEntries, err error)
+type listDirFn func(ctx context.Context, dir string) (entries fs.DirEntries, err error)
 
 // makeListDir makes constructs a listing function for the given fs
 // and includeAll flags for marching through the file system.
@@ -85,8 +90,8 @@ func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool) listD
 	fi := filter.GetConfig(ctx)
 	if !(ci.UseListR && f.Features().ListR != nil) && // !--fast-list active and
 		!(ci.NoTraverse && fi.HaveFilesFrom()) { // !(--files-from and --no-traverse)
-		return func(dir string) (entries fs.DirEntries, err error) {
-			dirCtx := filter.SetUseFilter(m.Ctx, f.Features().FilterAware && !includeAll) // make filter-aware backends constrain List
+		return func(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+			dirCtx := filter.SetUseFilter(ctx, f.Features().FilterAware && !includeAll) // make filter-aware backends constrain List
 			return list.DirSorted(dirCtx, f, includeAll, dir)
 		}
 	}
@@ -99,7 +104,7 @@ func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool) listD
 		dirs    dirtree.DirTree
 		dirsErr error
 	)
-	return func(dir string) (entries fs.DirEntries, err error) {
+	return func(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
 		mu.Lock()
 		defer mu.Unlock()
 		if !started {
@@ -275,12 +280,16 @@ func (es matchEntries) sort() {
 }
 
 // make a matchEntries from a newMatch entries
-func newMatchEntries(entries fs.DirEntries, transforms []matchTransformFn) matchEntries {
+//
+// names are applied to the leaf before the transforms.
+func newMatchEntries(entries fs.DirEntries, names transform.Transforms, transforms []matchTransformFn) matchEntries {
 	es := make(matchEntries, len(entries))
 	for i := range es {
 		es[i].entry = entries[i]
 		name := path.Base(entries[i].Remote())
 		es[i].leaf = name
+		_, isDir := entries[i].(fs.Directory)
+		name = names.Leaf(name, isDir)
 		for _, transform := range transforms {
 			name = transform(name)
 		}
@@ -300,16 +309,17 @@ type matchPair struct {
 type matchTransformFn func(name string) string
 
 // Process the two listings, matching up the items in the two slices
-// using the transform function on each name first.
+// using the transform function on each name first. The source names
+// are renamed with srcNames before that.
 //
 // Into srcOnly go Entries which only exist in the srcList
 // Into dstOnly go Entries which only exist in the dstList
 // Into matches go matchPair's of src and dst which have the same name
 //
 // This checks for duplicates and checks the list is sorted.
-func matchListings(srcListEntries, dstListEntries fs.DirEntries, transforms []matchTransformFn) (srcOnly fs.DirEntries, dstOnly fs.DirEntries, matches []matchPair) {
-	srcList := newMatchEntries(srcListEntries, transforms)
-	dstList := newMatchEntries(dstListEntries, transforms)
+func matchListings(srcListEntries, dstListEntries fs.DirEntries, srcNames transform.Transforms, transforms []matchTransformFn) (srcOnly fs.DirEntries, dstOnly fs.DirEntries, matches []matchPair) {
+	srcList := newMatchEntries(srcListEntries, srcNames, transforms)
+	dstList := newMatchEntries(dstListEntries, nil, transforms)
 
 	for iSrc, iDst := 0, 0; ; iSrc, iDst = iSrc+1, iDst+1 {
 		var src, dst fs.DirEntry
@@ -382,9 +392,13 @@ func matchListings(srcListEntries, dstListEntries fs.DirEntries, transforms []ma
 // more jobs
 //
 // returns errors using processError
-func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
+func (m *March) processJob(job listDirJob) (jobs []listDirJob, err error) {
+	ctx, span := tracing.Start(m.Ctx, "march",
+		tracing.String("rclone.src.path", job.srcRemote),
+		tracing.String("rclone.dst.path", job.dstRemote),
+	)
+	defer func() { span.End(err) }()
 	var (
-		jobs                   []listDirJob
 		srcList, dstList       fs.DirEntries
 		srcListErr, dstListErr error
 		wg                     sync.WaitGroup
@@ -396,14 +410,14 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			srcList, srcListErr = m.srcListDir(job.srcRemote)
+			srcList, srcListErr = m.srcListDir(ctx, job.srcRemote)
 		}()
 	}
 	if !m.NoTraverse && !job.noDst {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			dstList, dstListErr = m.dstListDir(job.dstRemote)
+			dstList, dstListErr = m.dstListDir(ctx, job.dstRemote)
 		}()
 	}
 
@@ -439,8 +453,8 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 			go func(src fs.DirEntry) {
 				defer wg.Done()
 				if srcObj, ok := src.(fs.Object); ok {
-					leaf := path.Base(srcObj.Remote())
-					dstObj, err := m.Fdst.NewObject(m.Ctx, path.Join(job.dstRemote, leaf))
+					leaf := m.names.Leaf(path.Base(srcObj.Remote()), false)
+					dstObj, err := m.Fdst.NewObject(ctx, path.Join(job.dstRemote, leaf))
 					if err == nil {
 						mu.Lock()
 						dstList = append(dstList, dstObj)
@@ -454,7 +468,7 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 	}
 
 	// Work out what to do and do it
-	srcOnly, dstOnly, matches := matchListings(srcList, dstList, m.transforms)
+	srcOnly, dstOnly, matches := matchListings(srcList, dstList, m.names, m.transforms)
 	for _, src := range srcOnly {
 		if m.aborting() {
 			return nil, m.Ctx.Err()
@@ -463,7 +477,7 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 		if recurse && job.srcDepth > 0 {
 			jobs = append(jobs, listDirJob{
 				srcRemote: src.Remote(),
-				dstRemote: src.Remote(),
+				dstRemote: m.names.Path(src.Remote(), true),
 				srcDepth:  job.srcDepth - 1,
 				noDst:     true,
 			})
@@ -488,7 +502,7 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 		if m.aborting() {
 			return nil, m.Ctx.Err()
 		}
-		recurse := m.Callback.Match(m.Ctx, match.dst, match.src)
+		recurse := m.Callback.Match(ctx, match.dst, match.src)
 		if recurse && job.srcDepth > 0 && job.dstDepth > 0 {
 			jobs = append(jobs, listDirJob{
 				srcRemote: match.src.Remote(),
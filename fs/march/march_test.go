@@ -17,6 +17,7 @@ import (
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/mockdir"
 	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/rclone/rclone/lib/transform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/text/unicode/norm"
@@ -290,7 +291,7 @@ func TestNewMatchEntries(t *testing.T) {
 		c = mockobject.Object("path/c")
 	)
 
-	es := newMatchEntries(fs.DirEntries{a, A, B, c}, nil)
+	es := newMatchEntries(fs.DirEntries{a, A, B, c}, nil, nil)
 	assert.Equal(t, es, matchEntries{
 		{name: "A", leaf: "A", entry: A},
 		{name: "B", leaf: "B", entry: B},
@@ -298,13 +299,22 @@ func TestNewMatchEntries(t *testing.T) {
 		{name: "c", leaf: "c", entry: c},
 	})
 
-	es = newMatchEntries(fs.DirEntries{a, A, B, c}, []matchTransformFn{strings.ToLower})
+	es = newMatchEntries(fs.DirEntries{a, A, B, c}, nil, []matchTransformFn{strings.ToLower})
 	assert.Equal(t, es, matchEntries{
 		{name: "a", leaf: "A", entry: A},
 		{name: "a", leaf: "a", entry: a},
 		{name: "b", leaf: "B", entry: B},
 		{name: "c", leaf: "c", entry: c},
 	})
+
+	names, err := transform.Parse([]string{"prefix=x", "uppercase"})
+	require.NoError(t, err)
+	es = newMatchEntries(fs.DirEntries{a, B, c}, names, nil)
+	assert.Equal(t, es, matchEntries{
+		{name: "XA", leaf: "a", entry: a},
+		{name: "XB", leaf: "B", entry: B},
+		{name: "XC", leaf: "c", entry: c},
+	})
 }
 
 func TestMatchListings(t *testing.T) {
@@ -517,12 +527,12 @@ func TestMatchListings(t *testing.T) {
 					dstList = append(dstList, dst)
 				}
 			}
-			srcOnly, dstOnly, matches := matchListings(srcList, dstList, test.transforms)
+			srcOnly, dstOnly, matches := matchListings(srcList, dstList, nil, test.transforms)
 			assert.Equal(t, test.srcOnly, srcOnly, test.what, "srcOnly differ")
 			assert.Equal(t, test.dstOnly, dstOnly, test.what, "dstOnly differ")
 			assert.Equal(t, test.matches, matches, test.what, "matches differ")
 			// now swap src and dst
-			dstOnly, srcOnly, matches = matchListings(dstList, srcList, test.transforms)
+			dstOnly, srcOnly, matches = matchListings(dstList, srcList, nil, test.transforms)
 			assert.Equal(t, test.srcOnly, srcOnly, test.what, "srcOnly differ")
 			assert.Equal(t, test.dstOnly, dstOnly, test.what, "dstOnly differ")
 			assert.Equal(t, test.matches, matches, test.what, "matches differ")
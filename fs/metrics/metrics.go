@@ -0,0 +1,24 @@
+// Package metrics registers the prometheus metrics served by the
+// remote control server.
+//
+// Packages which the rc server can't import, such as the VFS, use
+// this to add their metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace is the prefix of the names of all of rclone's metrics
+const Namespace = "rclone"
+
+// Register calls newCollectors with the Namespace and registers the
+// collectors it returns so they are served with the rest of the
+// metrics.
+//
+// It should be called from an init function.
+func Register(newCollectors func(namespace string) []prometheus.Collector) {
+	for _, c := range newCollectors(Namespace) {
+		prometheus.MustRegister(c)
+	}
+}
@@ -39,6 +39,7 @@ func NewFs(ctx context.Context, path string) (Fs, error) {
 	if err != nil {
 		return nil, err
 	}
+	ctx = context.WithValue(ctx, remoteContextKey, remoteContext{name: configName, backend: fsInfo.Name})
 	overridden := fsInfo.Options.Overridden(config)
 	if len(overridden) > 0 {
 		extraConfig := overridden.String()
@@ -71,6 +72,32 @@ func NewFs(ctx context.Context, path string) (Fs, error) {
 	return f, err
 }
 
+type remoteContextKeyType struct{}
+
+// Context key for the remote being made by NewFs
+var remoteContextKey = remoteContextKeyType{}
+
+// The remote being made by NewFs
+type remoteContext struct {
+	name    string // name of the remote without any config suffix
+	backend string // type of the backend, eg "s3"
+}
+
+// RemoteFromContext returns the name and backend type of the remote
+// which NewFs is making with ctx, or empty strings if there isn't one.
+//
+// Backends pass the context they were made with to things like HTTP
+// clients and pacers which use this to label their metrics.
+func RemoteFromContext(ctx context.Context) (name, backend string) {
+	if ctx == nil {
+		return "", ""
+	}
+	if r, ok := ctx.Value(remoteContextKey).(remoteContext); ok {
+		return r.name, r.backend
+	}
+	return "", ""
+}
+
 // ConfigFs makes the config for calling NewFs with.
 //
 // It parses the path which is of the form remote:path
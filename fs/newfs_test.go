@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fstest/mockfs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -43,3 +44,34 @@ func TestNewFs(t *testing.T) {
 	assert.Equal(t, ":mockfs{S_NHG}:/tmp", fs.ConfigString(f3))
 	assert.Equal(t, ":mockfs,potato='true':/tmp", fs.ConfigStringFull(f3))
 }
+
+func TestRemoteFromContext(t *testing.T) {
+	ctx := context.Background()
+
+	name, backend := fs.RemoteFromContext(ctx)
+	assert.Equal(t, "", name)
+	assert.Equal(t, "", backend)
+
+	// Register a backend which records the context it was made with
+	oldRegistry := fs.Registry
+	var gotName, gotBackend string
+	fs.Register(&fs.RegInfo{
+		Name: "contextfs",
+		NewFs: func(ctx context.Context, name string, root string, config configmap.Mapper) (fs.Fs, error) {
+			gotName, gotBackend = fs.RemoteFromContext(ctx)
+			return mockfs.NewFs(ctx, name, root, config)
+		},
+		Options: []fs.Option{{
+			Name: "potato",
+			Help: "Does it have a potato?.",
+		}},
+	})
+	defer func() {
+		fs.Registry = oldRegistry
+	}()
+
+	_, err := fs.NewFs(ctx, ":contextfs,potato:/tmp")
+	require.NoError(t, err)
+	assert.Equal(t, ":contextfs", gotName)
+	assert.Equal(t, "contextfs", gotBackend)
+}
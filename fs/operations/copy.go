@@ -18,6 +18,8 @@ import (
 	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/list"
+	"github.com/rclone/rclone/fs/tracing"
 	"github.com/rclone/rclone/lib/atexit"
 	"github.com/rclone/rclone/lib/pacer"
 	"github.com/rclone/rclone/lib/random"
@@ -200,13 +202,17 @@ func (c *copy) updateOrPut(ctx context.Context, in io.ReadCloser, uploadOptions
 		wrappedSrc = fs.NewOverrideRemote(c.src, c.remoteForCopy)
 	}
 	if c.doUpdate && c.inplace {
+		ctx, span := tracing.Start(ctx, "Update", tracing.Remote(c.f, c.remoteForCopy)...)
 		err = c.dst.Update(ctx, inAcc, wrappedSrc, uploadOptions...)
+		span.End(err)
 		// Make sure newDst is c.dst since we updated it
 		if err == nil {
 			newDst = c.dst
 		}
 	} else {
+		ctx, span := tracing.Start(ctx, "Put", tracing.Remote(c.f, c.remoteForCopy)...)
 		newDst, err = c.f.Put(ctx, inAcc, wrappedSrc, uploadOptions...)
+		span.End(err)
 	}
 	closeErr := inAcc.Close()
 	if err == nil {
@@ -368,6 +374,8 @@ func (c *copy) copy(ctx context.Context) (newDst fs.Object, err error) {
 // It returns the destination object if possible.  Note that this may
 // be nil.
 func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Object, err error) {
+	ctx, span := tracing.Start(ctx, "operations.Copy", tracing.Remote(f, remote)...)
+	defer func() { span.End(err) }()
 	ci := fs.GetConfig(ctx)
 	tr := accounting.Stats(ctx).NewTransfer(src)
 	defer func() {
@@ -378,6 +386,17 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 		in.DryRun(src.Size())
 		return newDst, nil
 	}
+	// Use the backend's own objects if they came from the listing cache
+	src, err = list.Resolve(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	if dst != nil {
+		dst, err = list.Resolve(ctx, dst)
+		if err != nil {
+			return nil, err
+		}
+	}
 	c := &copy{
 		f:           f,
 		dstFeatures: f.Features(),
@@ -401,6 +420,7 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 		return nil, err
 	}
 	// Do the copy now everything is set up
+	defer list.InvalidateObject(ctx, f, c.remote)
 	return c.copy(ctx)
 }
 
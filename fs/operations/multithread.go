@@ -58,7 +58,8 @@ type multiThreadCopyState struct {
 	src         fs.Object
 	acc         *accounting.Account
 	numChunks   int
-	noBuffering bool // set to read the input without buffering
+	noBuffering bool         // set to read the input without buffering
+	resume      *ResumeState // if set, save the state of the upload here
 }
 
 // Copy a single chunk into place
@@ -111,6 +112,14 @@ func (mc *multiThreadCopyState) copyChunk(ctx context.Context, chunk int, writer
 		return fmt.Errorf("multi-thread copy: failed to write chunk: %w", err)
 	}
 
+	// Save the state so the upload can be resumed from here
+	if mc.resume != nil {
+		saveErr := mc.resume.save(writer)
+		if saveErr != nil {
+			fs.Errorf(mc.src, "multi-thread copy: %v", saveErr)
+		}
+	}
+
 	fs.Debugf(mc.src, "multi-thread copy: chunk %d/%d (%d-%d) size %v finished", chunk+1, mc.numChunks, start, end, fs.SizeSuffix(bytesWritten))
 	return nil
 }
@@ -158,10 +167,28 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		return nil, fmt.Errorf("multi-thread copy: can't copy zero sized file")
 	}
 
-	info, chunkWriter, err := openChunkWriter(ctx, remote, src, options...)
+	var (
+		info        fs.ChunkWriterInfo
+		chunkWriter fs.ChunkWriter
+		resume      *ResumeState
+		written     map[int]string // chunks already written by a previous run
+	)
+	if ci.MultiThreadResume && f.Features().ResumeChunkWriter != nil {
+		info, chunkWriter, resume, err = openResumableChunkWriter(ctx, f, remote, src, options...)
+	} else {
+		info, chunkWriter, err = openChunkWriter(ctx, remote, src, options...)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("multi-thread copy: failed to open chunk writer: %w", err)
 	}
+	if resume != nil {
+		written = chunkWriter.(fs.ChunkWriterStater).ChunkWriterState().Chunks
+		err = resume.save(chunkWriter)
+		if err != nil {
+			fs.Errorf(src, "multi-thread copy: upload won't be resumable: %v", err)
+			resume = nil
+		}
+	}
 
 	uploadCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -171,6 +198,10 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		if info.LeavePartsOnError || uploadedOK {
 			return
 		}
+		if resume != nil {
+			fs.Infof(src, "multi-thread copy: leaving upload to be resumed by the next run")
+			return
+		}
 		fs.Debugf(src, "multi-thread copy: cancelling transfer on exit")
 		abortErr := chunkWriter.Abort(ctx)
 		if abortErr != nil {
@@ -209,17 +240,32 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		partSize:    info.ChunkSize,
 		numChunks:   numChunks,
 		noBuffering: noBuffering,
+		resume:      resume,
 	}
 
 	// Make accounting
 	mc.acc = tr.Account(gCtx, nil)
 
 	fs.Debugf(src, "Starting multi-thread copy with %d chunks of size %v with %v parallel streams", mc.numChunks, fs.SizeSuffix(mc.partSize), concurrency)
+	if len(written) > 0 {
+		fs.Infof(src, "multi-thread copy: %d/%d chunks already written", len(written), mc.numChunks)
+	}
 	for chunk := 0; chunk < mc.numChunks; chunk++ {
 		// Fail fast, in case an errgroup managed function returns an error
 		if gCtx.Err() != nil {
 			break
 		}
+		// Skip chunks written by a previous run, accounting
+		// for them as if they had been transferred
+		if _, ok := written[chunk]; ok {
+			start := int64(chunk) * mc.partSize
+			end := start + mc.partSize
+			if end > mc.size {
+				end = mc.size
+			}
+			mc.acc.ServerSideTransferEnd(end - start)
+			continue
+		}
 		chunk := chunk
 		g.Go(func() error {
 			return mc.copyChunk(gCtx, chunk, chunkWriter)
@@ -235,6 +281,9 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		return nil, fmt.Errorf("multi-thread copy: failed to close object after copy: %w", err)
 	}
 	uploadedOK = true // file is definitely uploaded OK so no need to abort
+	if resume != nil {
+		resume.remove()
+	}
 
 	obj, err := f.NewObject(ctx, remote)
 	if err != nil {
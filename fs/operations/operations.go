@@ -31,11 +31,13 @@ import (
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/fshttp"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/list"
 	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fs/walk"
 	"github.com/rclone/rclone/lib/atexit"
 	"github.com/rclone/rclone/lib/random"
 	"github.com/rclone/rclone/lib/readers"
+	"github.com/rclone/rclone/lib/transform"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -253,6 +255,7 @@ func equal(ctx context.Context, src fs.ObjectInfo, dst fs.Object, opt equalOpt)
 			}
 			// Update the mtime of the dst object here
 			err := dst.SetModTime(ctx, srcModTime)
+			list.InvalidateObject(ctx, dst.Fs(), dst.Remote())
 			if errors.Is(err, fs.ErrorCantSetModTime) {
 				logModTimeUpload(dst)
 				fs.Infof(dst, "src and dst identical but can't set mod time without re-uploading")
@@ -347,6 +350,21 @@ func Move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 		in.DryRun(src.Size())
 		return newDst, nil
 	}
+	// Use the backend's own objects if they came from the listing cache
+	src, err = list.Resolve(ctx, src)
+	if err != nil {
+		return newDst, err
+	}
+	if dst != nil {
+		dst, err = list.Resolve(ctx, dst)
+		if err != nil {
+			return newDst, err
+		}
+	}
+	defer func() {
+		list.InvalidateObject(ctx, src.Fs(), src.Remote())
+		list.InvalidateObject(ctx, fdst, remote)
+	}()
 	// See if we have Move available
 	if doMove := fdst.Features().Move; doMove != nil && (SameConfig(src.Fs(), fdst) || (SameRemoteType(src.Fs(), fdst) && (fdst.Features().ServerSideAcrossConfigs || ci.ServerSideAcrossConfigs))) {
 		// Delete destination if it exists and is not the same file as src (could be same file while seemingly different if the remote is case insensitive)
@@ -456,6 +474,7 @@ func DeleteFileWithBackupDir(ctx context.Context, dst fs.Object, backupDir fs.Fs
 		err = MoveBackupDir(ctx, backupDir, dst)
 	} else {
 		err = dst.Remove(ctx)
+		list.InvalidateObject(ctx, dst.Fs(), dst.Remote())
 	}
 	if err != nil {
 		fs.Errorf(dst, "Couldn't %s: %v", action, err)
@@ -919,6 +938,7 @@ func Mkdir(ctx context.Context, f fs.Fs, dir string) error {
 	}
 	fs.Debugf(fs.LogDirName(f, dir), "Making directory")
 	err := f.Mkdir(ctx, dir)
+	list.InvalidateDir(ctx, f, dir)
 	if err != nil {
 		err = fs.CountError(err)
 		return err
@@ -934,6 +954,7 @@ func TryRmdir(ctx context.Context, f fs.Fs, dir string) error {
 		return nil
 	}
 	fs.Infof(fs.LogDirName(f, dir), "Removing directory")
+	defer list.InvalidateDir(ctx, f, dir)
 	return f.Rmdir(ctx, dir)
 }
 
@@ -957,6 +978,7 @@ func Purge(ctx context.Context, f fs.Fs, dir string) (err error) {
 			return nil
 		}
 		err = doPurge(ctx, dir)
+		list.InvalidateDir(ctx, f, dir)
 		if errors.Is(err, fs.ErrorCantPurge) {
 			doFallbackPurge = true
 		}
@@ -1108,6 +1130,7 @@ func Rcat(ctx context.Context, fdst fs.Fs, dstFileName string, in io.ReadCloser,
 	defer func() {
 		tr.Done(ctx, err)
 	}()
+	defer list.InvalidateObject(ctx, fdst, dstFileName)
 	in = tr.Account(ctx, in).WithBuffer()
 
 	readCounter := readers.NewCountingReader(in)
@@ -1355,7 +1378,7 @@ func GetCompareDest(ctx context.Context) (CompareDest []fs.Fs, err error) {
 func compareDest(ctx context.Context, dst, src fs.Object, CompareDest fs.Fs) (NoNeedTransfer bool, err error) {
 	var remote string
 	if dst == nil {
-		remote = src.Remote()
+		remote = transform.Path(ctx, src.Remote(), false)
 	} else {
 		remote = dst.Remote()
 	}
@@ -1403,7 +1426,7 @@ func GetCopyDest(ctx context.Context, fdst fs.Fs) (CopyDest []fs.Fs, err error)
 func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, backupDir fs.Fs) (NoNeedTransfer bool, err error) {
 	var remote string
 	if dst == nil {
-		remote = src.Remote()
+		remote = transform.Path(ctx, src.Remote(), false)
 	} else {
 		remote = dst.Remote()
 	}
@@ -1556,6 +1579,7 @@ func RcatSize(ctx context.Context, fdst fs.Fs, dstFileName string, in io.ReadClo
 
 		info := object.NewStaticObjectInfo(dstFileName, modTime, size, true, nil, fdst).WithMetadata(meta)
 		obj, err = fdst.Put(ctx, in, info)
+		list.InvalidateObject(ctx, fdst, dstFileName)
 		if err != nil {
 			fs.Errorf(dstFileName, "Post request put error: %v", err)
 
@@ -1837,6 +1861,7 @@ func TouchDir(ctx context.Context, f fs.Fs, remote string, t time.Time, recursiv
 			if !SkipDestructive(ctx, o, "touch") {
 				fs.Debugf(f, "Touching %q", o.Remote())
 				err := o.SetModTime(ctx, t)
+				list.InvalidateObject(ctx, f, o.Remote())
 				if err != nil {
 					err = fmt.Errorf("failed to touch: %w", err)
 					err = fs.CountError(err)
@@ -2019,6 +2044,10 @@ func DirMove(ctx context.Context, f fs.Fs, srcRemote, dstRemote string) (err err
 		accounting.Stats(ctx).Renames(1)
 		return nil
 	}
+	defer func() {
+		list.InvalidateDir(ctx, f, srcRemote)
+		list.InvalidateDir(ctx, f, dstRemote)
+	}()
 
 	// Use DirMove if possible
 	if doDirMove := f.Features().DirMove; doDirMove != nil {
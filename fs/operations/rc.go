@@ -17,6 +17,7 @@ import (
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/lib/diskusage"
+	"github.com/rclone/rclone/lib/http/signedlink"
 )
 
 func init() {
@@ -397,6 +398,11 @@ func init() {
 - remote - a path within that remote e.g. "dir"
 - unlink - boolean - if set removes the link rather than adding it (optional)
 - expire - string - the expiry time of the link e.g. "1d" (optional)
+- selfSigned - boolean - if set make a link signed by rclone (optional)
+- url - string - the URL of the rclone server for selfSigned links (optional)
+- root - string - the remote:path rclone serve http is serving for selfSigned links or blank for rcd (optional)
+- maxDownloads - int - the number of times a selfSigned link can be downloaded, counted on a best effort basis (optional)
+- password - string - the password needed to download a selfSigned link (optional)
 
 Returns:
 
@@ -420,7 +426,27 @@ func rcPublicLink(ctx context.Context, in rc.Params) (out rc.Params, err error)
 	} else if err != nil {
 		return nil, err
 	}
-	url, err := PublicLink(ctx, f, remote, fs.Duration(expire), unlink)
+	var url string
+	if selfSigned, _ := in.GetBool("selfSigned"); selfSigned {
+		if unlink {
+			return nil, errors.New("can't unlink a selfSigned link")
+		}
+		opt := signedlink.Options{Expire: fs.Duration(expire)}
+		opt.URL, err = in.GetString("url")
+		if err != nil {
+			return nil, err
+		}
+		opt.Root, _ = in.GetString("root")
+		opt.Password, _ = in.GetString("password")
+		maxDownloads, err := in.GetInt64("maxDownloads")
+		if err != nil && !rc.IsErrParamNotFound(err) {
+			return nil, err
+		}
+		opt.MaxDownloads = int(maxDownloads)
+		url, err = signedlink.Make(ctx, f, remote, opt)
+	} else {
+		url, err = PublicLink(ctx, f, remote, fs.Duration(expire), unlink)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -858,13 +884,13 @@ func rcCheck(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 	if checkFileHash != "" {
 		out["hashType"] = checkFileHashType.String()
-		err = CheckSum(context.Background(), dstFs, checkFileFs, checkFileRemote, checkFileHashType, opt, download)
+		err = CheckSum(ctx, dstFs, checkFileFs, checkFileRemote, checkFileHashType, opt, download)
 	} else {
 		if download {
-			err = CheckDownload(context.Background(), opt)
+			err = CheckDownload(ctx, opt)
 		} else {
 			out["hashType"] = srcFs.Hashes().Overlap(dstFs.Hashes()).GetOne().String()
-			err = Check(context.Background(), opt)
+			err = Check(ctx, opt)
 		}
 	}
 	if err != nil {
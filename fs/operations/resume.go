@@ -0,0 +1,217 @@
+package operations
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/object"
+)
+
+// The directory in the cache directory the state of resumable
+// uploads is saved in
+const resumeDirName = "resume"
+
+// ResumeState is the saved state of a multi-thread upload which can
+// be resumed by a later run of rclone if it doesn't complete.
+//
+// It is saved in a file named after the destination and the
+// fingerprint of the source so an upload is only resumed if the
+// source hasn't changed.
+type ResumeState struct {
+	Fs          string              `json:"fs"`          // the destination Fs as a config string
+	Remote      string              `json:"remote"`      // the destination remote
+	Source      string              `json:"source"`      // the source of the upload
+	Fingerprint string              `json:"fingerprint"` // the fingerprint of the source
+	Size        int64               `json:"size"`        // the size of the source
+	ModTime     time.Time           `json:"modTime"`     // the modification time of the source
+	Started     time.Time           `json:"started"`     // when the upload was started
+	Updated     time.Time           `json:"updated"`     // when the state was last saved
+	ChunkWriter fs.ChunkWriterState `json:"chunkWriter"` // the state of the chunk writer
+
+	mu   sync.Mutex
+	path string // the file the state is saved in
+}
+
+// resumeDir returns the directory the state of resumable uploads is
+// saved in
+func resumeDir() string {
+	return filepath.Join(config.GetCacheDir(), resumeDirName)
+}
+
+// resumePath returns the file the state of the upload of the source
+// with fingerprint to (f, remote) is saved in
+func resumePath(f fs.Fs, remote, fingerprint string) string {
+	sum := sha256.Sum256([]byte(fs.ConfigString(f) + "\x00" + remote + "\x00" + fingerprint))
+	return filepath.Join(resumeDir(), hex.EncodeToString(sum[:])+".json")
+}
+
+// loadResumeState reads the state saved in path
+func loadResumeState(path string) (*ResumeState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &ResumeState{path: path}
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode upload state %q: %w", path, err)
+	}
+	return s, nil
+}
+
+// save the state of writer
+func (s *ResumeState) save(writer fs.ChunkWriter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ChunkWriter = writer.(fs.ChunkWriterStater).ChunkWriterState()
+	s.Updated = time.Now()
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload state: %w", err)
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to make upload state directory: %w", err)
+	}
+	// Write to a temporary file then rename so the state is
+	// never left half written
+	tmpPath := s.path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write upload state: %w", err)
+	}
+	err = os.Rename(tmpPath, s.path)
+	if err != nil {
+		return fmt.Errorf("failed to write upload state: %w", err)
+	}
+	return nil
+}
+
+// remove the saved state
+func (s *ResumeState) remove() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		fs.Errorf(nil, "Failed to remove upload state %q: %v", s.path, err)
+	}
+}
+
+// openResumableChunkWriter opens a chunk writer to upload src to
+// (f, remote), resuming the upload saved by a previous run if there
+// is one.
+//
+// It returns the state to save the progress of the upload in, or nil
+// if the upload can't be resumed.
+func openResumableChunkWriter(ctx context.Context, f fs.Fs, remote string, src fs.Object, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, s *ResumeState, err error) {
+	features := f.Features()
+	fingerprint := fs.Fingerprint(ctx, src, true)
+	path := resumePath(f, remote, fingerprint)
+	s, err = loadResumeState(path)
+	if err == nil {
+		info, writer, err = features.ResumeChunkWriter(ctx, remote, src, s.ChunkWriter, options...)
+		if err == nil {
+			fs.Infof(src, "multi-thread copy: resuming upload started at %v", s.Started.Format(time.RFC3339))
+			return info, writer, s, nil
+		}
+		fs.Logf(src, "multi-thread copy: failed to resume upload so starting again: %v", err)
+		s.remove()
+	} else if !os.IsNotExist(err) {
+		fs.Logf(src, "multi-thread copy: ignoring upload state: %v", err)
+	}
+	info, writer, err = features.OpenChunkWriter(ctx, remote, src, options...)
+	if err != nil {
+		return info, nil, nil, err
+	}
+	if _, ok := writer.(fs.ChunkWriterStater); !ok {
+		return info, writer, nil, nil
+	}
+	source := src.Remote()
+	if srcFs, ok := src.Fs().(fs.Fs); ok {
+		source = fspath.JoinRootPath(fs.ConfigString(srcFs), source)
+	}
+	s = &ResumeState{
+		Fs:          fs.ConfigString(f),
+		Remote:      remote,
+		Source:      source,
+		Fingerprint: fingerprint,
+		Size:        src.Size(),
+		ModTime:     src.ModTime(ctx),
+		Started:     time.Now(),
+		path:        path,
+	}
+	return info, writer, s, nil
+}
+
+// ResumeStates returns the saved states of the resumable uploads
+// which haven't completed, oldest first.
+func ResumeStates(ctx context.Context) (states []*ResumeState, err error) {
+	dir := resumeDir()
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload state directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		s, err := loadResumeState(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			fs.Errorf(nil, "Ignoring upload state: %v", err)
+			continue
+		}
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Started.Before(states[j].Started)
+	})
+	return states, nil
+}
+
+// AbortResume aborts the upload with the saved state s and removes
+// the state so it won't be resumed.
+//
+// If the upload can't be found on the remote, eg because it has
+// expired, only the state is removed.
+func AbortResume(ctx context.Context, s *ResumeState) error {
+	if SkipDestructive(ctx, s.Remote, "abort upload") {
+		return nil
+	}
+	f, err := cache.Get(ctx, s.Fs)
+	if err != nil {
+		return fmt.Errorf("failed to make Fs for upload: %w", err)
+	}
+	resumeChunkWriter := f.Features().ResumeChunkWriter
+	if resumeChunkWriter == nil {
+		return fmt.Errorf("can't abort upload to %v: %w", f, fs.ErrorNotImplemented)
+	}
+	src := object.NewStaticObjectInfo(s.Remote, s.ModTime, s.Size, true, nil, f)
+	_, writer, err := resumeChunkWriter(ctx, s.Remote, src, s.ChunkWriter)
+	if err != nil {
+		fs.Logf(s.Remote, "Forgetting upload which can't be resumed: %v", err)
+	} else {
+		err = writer.Abort(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to abort upload: %w", err)
+		}
+		fs.Infof(s.Remote, "Aborted upload started at %v", s.Started.Format(time.RFC3339))
+	}
+	s.remove()
+	return nil
+}
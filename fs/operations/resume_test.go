@@ -0,0 +1,221 @@
+package operations
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const resumableChunkSize = 1024
+
+// resumableFs wraps an Fs with a chunk writer which can be resumed
+// and which keeps the chunks of its uploads in memory
+type resumableFs struct {
+	fs.Fs
+	mu       sync.Mutex
+	uploads  map[string]map[int][]byte // chunks of each upload by ID
+	written  int                       // number of chunks written
+	features *fs.Features
+}
+
+func newResumableFs(ctx context.Context, f fs.Fs) *resumableFs {
+	rf := &resumableFs{
+		Fs:      f,
+		uploads: map[string]map[int][]byte{},
+	}
+	rf.features = (&fs.Features{}).Fill(ctx, rf)
+	return rf
+}
+
+// Features returns the optional features of this Fs
+func (rf *resumableFs) Features() *fs.Features {
+	return rf.features
+}
+
+// OpenChunkWriter starts a new upload
+func (rf *resumableFs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	id := fmt.Sprintf("upload-%d", len(rf.uploads))
+	rf.uploads[id] = map[int][]byte{}
+	return rf.info(), &resumableChunkWriter{f: rf, id: id, remote: remote, src: src}, nil
+}
+
+// ResumeChunkWriter carries on an upload
+func (rf *resumableFs) ResumeChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, state fs.ChunkWriterState, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.uploads[state.ID] == nil {
+		return info, nil, errors.New("upload not found")
+	}
+	return rf.info(), &resumableChunkWriter{f: rf, id: state.ID, remote: remote, src: src}, nil
+}
+
+func (rf *resumableFs) info() fs.ChunkWriterInfo {
+	return fs.ChunkWriterInfo{
+		ChunkSize:   resumableChunkSize,
+		Concurrency: 1,
+	}
+}
+
+type resumableChunkWriter struct {
+	f      *resumableFs
+	id     string
+	remote string
+	src    fs.ObjectInfo
+}
+
+func (w *resumableChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (int64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return -1, err
+	}
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+	w.f.uploads[w.id][chunkNumber] = data
+	w.f.written++
+	return int64(len(data)), nil
+}
+
+func (w *resumableChunkWriter) ChunkWriterState() fs.ChunkWriterState {
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+	state := fs.ChunkWriterState{
+		ID:        w.id,
+		ChunkSize: resumableChunkSize,
+		Chunks:    map[int]string{},
+	}
+	for chunkNumber, data := range w.f.uploads[w.id] {
+		state.Chunks[chunkNumber] = fmt.Sprint(len(data))
+	}
+	return state
+}
+
+func (w *resumableChunkWriter) Close(ctx context.Context) error {
+	w.f.mu.Lock()
+	chunks := w.f.uploads[w.id]
+	delete(w.f.uploads, w.id)
+	w.f.mu.Unlock()
+	var chunkNumbers []int
+	for chunkNumber := range chunks {
+		chunkNumbers = append(chunkNumbers, chunkNumber)
+	}
+	sort.Ints(chunkNumbers)
+	var buf bytes.Buffer
+	for _, chunkNumber := range chunkNumbers {
+		buf.Write(chunks[chunkNumber])
+	}
+	info := object.NewStaticObjectInfo(w.remote, w.src.ModTime(ctx), int64(buf.Len()), true, nil, w.f.Fs)
+	_, err := w.f.Fs.Put(ctx, &buf, info)
+	return err
+}
+
+func (w *resumableChunkWriter) Abort(ctx context.Context) error {
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+	delete(w.f.uploads, w.id)
+	return nil
+}
+
+// failLastChunkObject is an Object which fails to open its last chunk
+type failLastChunkObject struct {
+	fs.Object
+}
+
+func (o failLastChunkObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	for _, option := range options {
+		if ropt, ok := option.(*fs.RangeOption); ok && ropt.End+1 >= o.Size() {
+			return nil, errors.New("BOOM: simulated open failure")
+		}
+	}
+	return o.Object.Open(ctx, options...)
+}
+
+func TestMultithreadCopyResume(t *testing.T) {
+	r := fstest.NewRun(t)
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.MultiThreadResume = true
+	ci.LowLevelRetries = 1
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	t.Cleanup(func() { _ = config.SetCacheDir(oldCacheDir) })
+
+	rf := newResumableFs(ctx, r.Fremote)
+	cache.Put(fs.ConfigString(rf), rf)
+	t.Cleanup(func() { cache.Clear() })
+
+	const fileName = "test-multithread-resume"
+	const size = 4*resumableChunkSize - 1
+	t1 := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	file1 := r.WriteFile(fileName, random.String(size), t1)
+	src, err := r.Flocal.NewObject(ctx, fileName)
+	require.NoError(t, err)
+
+	// failCopy makes an upload which fails on the last chunk
+	failCopy := func() {
+		tr := accounting.GlobalStats().NewTransfer(src)
+		dst, err := multiThreadCopy(ctx, rf, fileName, failLastChunkObject{src}, 1, tr)
+		tr.Done(ctx, err)
+		require.Error(t, err)
+		assert.Nil(t, dst)
+	}
+
+	// A failed upload leaves its state behind
+	failCopy()
+	states, err := ResumeStates(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(states))
+	assert.Equal(t, fileName, states[0].Remote)
+	assert.Equal(t, int64(size), states[0].Size)
+	assert.Equal(t, 3, len(states[0].ChunkWriter.Chunks))
+	assert.Equal(t, 3, rf.written)
+
+	// The next upload only writes the missing chunk
+	tr := accounting.GlobalStats().NewTransfer(src)
+	dst, err := multiThreadCopy(ctx, rf, fileName, src, 1, tr)
+	tr.Done(ctx, err)
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), dst.Size())
+	assert.Equal(t, 4, rf.written)
+	// The chunks written already are accounted too
+	assert.Equal(t, int64(size), tr.Snapshot().Bytes)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, nil, fs.GetModifyWindow(ctx, r.Fremote))
+	states, err = ResumeStates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(states))
+
+	// An aborted upload isn't resumed
+	require.NoError(t, dst.Remove(ctx))
+	failCopy()
+	states, err = ResumeStates(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(states))
+	require.NoError(t, AbortResume(ctx, states[0]))
+	assert.Equal(t, 0, len(rf.uploads))
+	states, err = ResumeStates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(states))
+
+	// Without --multi-thread-resume nothing is saved
+	ci.MultiThreadResume = false
+	failCopy()
+	states, err = ResumeStates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(states))
+}
@@ -26,9 +26,11 @@ func NewPacer(ctx context.Context, c pacer.Calculator) *Pacer {
 	if retries <= 0 {
 		retries = 1
 	}
+	name, _ := RemoteFromContext(ctx)
 	p := &Pacer{
 		Pacer: pacer.New(
 			pacer.InvokerOption(pacerInvoker),
+			pacer.NameOption(name),
 			// pacer.MaxConnectionsOption(ci.Checkers+ci.Transfers),
 			pacer.RetriesOption(retries),
 			pacer.CalculatorOption(c),
@@ -31,6 +31,7 @@ type Options struct {
 	WebGUINoOpenBrowser bool   // set to disable auto opening browser
 	WebGUIFetchURL      string // set the default url for fetching webgui
 	EnableMetrics       bool   // set to disable prometheus metrics on /metrics
+	SignedLinks         bool   // set to serve files from signed links without auth
 	JobExpireDuration   time.Duration
 	JobExpireInterval   time.Duration
 }
@@ -26,12 +26,15 @@ import (
 	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/fshttp"
 	"github.com/rclone/rclone/fs/list"
+	"github.com/rclone/rclone/fs/metrics"
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fs/rc/jobs"
 	"github.com/rclone/rclone/fs/rc/rcflags"
 	"github.com/rclone/rclone/fs/rc/webgui"
 	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/lib/http/signedlink"
+	"github.com/rclone/rclone/lib/pacer"
 	"github.com/rclone/rclone/lib/random"
 	"github.com/skratchdot/open-golang/open"
 )
@@ -42,13 +45,27 @@ func init() {
 	rcloneCollector := accounting.NewRcloneCollector(context.Background())
 	prometheus.MustRegister(rcloneCollector)
 
-	m := fshttp.NewMetrics("rclone")
+	m := fshttp.NewMetrics(metrics.Namespace)
 	for _, c := range m.Collectors() {
 		prometheus.MustRegister(c)
 	}
 	fshttp.DefaultMetrics = m
 
-	promHandler = promhttp.Handler()
+	pm := pacer.NewMetrics(metrics.Namespace)
+	for _, c := range pm.Collectors() {
+		prometheus.MustRegister(c)
+	}
+	pacer.DefaultMetrics = pm
+
+	am := accounting.NewMetrics(metrics.Namespace)
+	for _, c := range am.Collectors() {
+		prometheus.MustRegister(c)
+	}
+	accounting.DefaultMetrics = am
+
+	promHandler = promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+	}))
 }
 
 // Start the remote control server if configured
@@ -74,6 +91,7 @@ type Server struct {
 	files          http.Handler
 	pluginsHandler http.Handler
 	opt            *rc.Options
+	links          *signedlink.Server // set if serving signed links
 }
 
 func newServer(ctx context.Context, opt *rc.Options, mux *http.ServeMux) (*Server, error) {
@@ -127,10 +145,22 @@ func newServer(ctx context.Context, opt *rc.Options, mux *http.ServeMux) (*Serve
 		pluginsHandler: pluginsHandler,
 	}
 
+	auth := opt.Auth
+	if opt.SignedLinks {
+		var err error
+		s.links, err = signedlink.NewServer()
+		if err != nil {
+			return nil, err
+		}
+		auth.SkipAuthFn = func(r *http.Request) bool {
+			return fsMatch.MatchString(strings.TrimLeft(r.URL.Path, "/")) && s.links.SkipAuth(r)
+		}
+	}
+
 	var err error
 	s.server, err = libhttp.NewServer(ctx,
 		libhttp.WithConfig(opt.HTTP),
-		libhttp.WithAuth(opt.Auth),
+		libhttp.WithAuth(auth),
 		libhttp.WithTemplate(opt.Template),
 	)
 	if err != nil {
@@ -367,6 +397,15 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, path string)
 	fsMatchResult := fsMatch.FindStringSubmatch(path)
 
 	switch {
+	case s.links != nil && signedlink.HasSignature(r):
+		// Signed links may not have been authenticated so must
+		// only serve the file they were signed for
+		if fsMatchResult == nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		} else if w, ok := s.links.Check(w, r); ok {
+			s.serveRemote(w, r, fsMatchResult[2], fsMatchResult[1])
+		}
+		return
 	case fsMatchResult != nil && s.opt.Serve:
 		// Serve /[fs]/remote files
 		s.serveRemote(w, r, fsMatchResult[2], fsMatchResult[1])
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -16,8 +17,10 @@ import (
 	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/config/configfile"
 	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/http/signedlink"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -804,3 +807,48 @@ func TestRCDebug(t *testing.T) {
 	opt.Files = ""
 	testServer(t, tests, &opt)
 }
+
+func TestSignedLinks(t *testing.T) {
+	ctx := context.Background()
+	oldPath := config.GetConfigPath()
+	require.NoError(t, config.SetConfigPath(filepath.Join(t.TempDir(), "rclone.conf")))
+	defer func() {
+		_ = config.SetConfigPath(oldPath)
+	}()
+	f, err := fs.NewFs(ctx, testFs)
+	require.NoError(t, err)
+	link, err := signedlink.Make(ctx, f, "file.txt", signedlink.Options{URL: "http://1.2.3.4/"})
+	require.NoError(t, err)
+	linkPath := strings.TrimPrefix(link, "http://1.2.3.4/")
+
+	tests := []testRun{{
+		Name:     "signed",
+		URL:      linkPath,
+		Status:   http.StatusOK,
+		Expected: "this is file1.txt\n",
+	}, {
+		Name:     "unsigned",
+		URL:      remoteURL + "file.txt",
+		Status:   http.StatusUnauthorized,
+		Expected: "401 Unauthorized\n",
+	}, {
+		Name:     "otherFile",
+		URL:      strings.Replace(linkPath, "file.txt", "two.txt", 1),
+		Status:   http.StatusUnauthorized,
+		Expected: "401 Unauthorized\n",
+	}, {
+		Name:        "post",
+		URL:         linkPath,
+		Method:      "POST",
+		Body:        `{}`,
+		ContentType: "application/javascript",
+		Status:      http.StatusUnauthorized,
+		Expected:    "401 Unauthorized\n",
+	}}
+	opt := newTestOpt()
+	opt.Serve = false
+	opt.SignedLinks = true
+	opt.Auth.BasicUser = "user"
+	opt.Auth.BasicPass = "pass"
+	testServer(t, tests, &opt)
+}
@@ -16,8 +16,11 @@ import (
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/list"
 	"github.com/rclone/rclone/fs/march"
 	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/tracing"
+	"github.com/rclone/rclone/lib/transform"
 )
 
 // ErrorMaxDurationReached defines error when transfer duration is reached
@@ -435,15 +438,16 @@ func (s *syncCopyMove) pairCopyOrMove(ctx context.Context, in *pipe, fdst fs.Fs,
 		}
 		src := pair.Src
 		dst := pair.Dst
+		remote := transform.Path(ctx, src.Remote(), false)
 		if s.DoMove {
 			if src != dst {
-				_, err = operations.Move(ctx, fdst, dst, src.Remote(), src)
+				_, err = operations.Move(ctx, fdst, dst, remote, src)
 			} else {
 				// src == dst signals delete the src
 				err = operations.DeleteFile(ctx, src)
 			}
 		} else {
-			_, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
+			_, err = operations.Copy(ctx, fdst, dst, remote, src)
 		}
 		s.processError(err)
 	}
@@ -639,9 +643,10 @@ func copyEmptyDirectories(ctx context.Context, f fs.Fs, entries map[string]fs.Di
 	for _, entry := range entries {
 		dir, ok := entry.(fs.Directory)
 		if ok {
-			err := operations.Mkdir(ctx, f, dir.Remote())
+			remote := transform.Path(ctx, dir.Remote(), true)
+			err := operations.Mkdir(ctx, f, remote)
 			if err != nil {
-				fs.Errorf(fs.LogDirName(f, dir.Remote()), "Failed to Mkdir: %v", err)
+				fs.Errorf(fs.LogDirName(f, remote), "Failed to Mkdir: %v", err)
 			} else {
 				okCount++
 			}
@@ -835,10 +840,11 @@ func (s *syncCopyMove) tryRename(src fs.Object) bool {
 	}
 
 	// Find dst object we are about to overwrite if it exists
-	dstOverwritten, _ := s.fdst.NewObject(s.ctx, src.Remote())
+	remote := transform.Path(s.ctx, src.Remote(), false)
+	dstOverwritten, _ := s.fdst.NewObject(s.ctx, remote)
 
 	// Rename dst to have name src.Remote()
-	_, err := operations.Move(s.ctx, s.fdst, dstOverwritten, src.Remote(), dst)
+	_, err := operations.Move(s.ctx, s.fdst, dstOverwritten, remote, dst)
 	if err != nil {
 		fs.Debugf(src, "Failed to rename to %q: %v", dst.Remote(), err)
 		return false
@@ -1107,7 +1113,18 @@ func (s *syncCopyMove) Match(ctx context.Context, dst, src fs.DirEntry) (recurse
 // If DoMove is true then files will be moved instead of copied.
 //
 // dir is the start directory, "" for root
-func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool, copyEmptySrcDirs bool) error {
+func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool, copyEmptySrcDirs bool) (err error) {
+	name := "sync.CopyDir"
+	if DoMove {
+		name = "sync.MoveDir"
+	} else if deleteMode != fs.DeleteModeOff {
+		name = "sync.Sync"
+	}
+	ctx, span := tracing.Start(ctx, name,
+		tracing.String("rclone.src", fs.ConfigString(fsrc)),
+		tracing.String("rclone.dst", fs.ConfigString(fdst)),
+	)
+	defer func() { span.End(err) }()
 	ci := fs.GetConfig(ctx)
 	if deleteMode != fs.DeleteModeOff && DoMove {
 		return fserrors.FatalError(errors.New("can't delete and move at the same time"))
@@ -1160,13 +1177,15 @@ func MoveDir(ctx context.Context, fdst, fsrc fs.Fs, deleteEmptySrcDirs bool, cop
 		return nil
 	}
 
-	// First attempt to use DirMover if exists, same Fs and no filters are active
-	if fdstDirMove := fdst.Features().DirMove; fdstDirMove != nil && operations.SameConfig(fsrc, fdst) && fi.InActive() {
+	// First attempt to use DirMover if exists, same Fs and no filters or name transforms are active
+	if fdstDirMove := fdst.Features().DirMove; fdstDirMove != nil && operations.SameConfig(fsrc, fdst) && fi.InActive() && !transform.Transforming(ctx) {
 		if operations.SkipDestructive(ctx, fdst, "server-side directory move") {
 			return nil
 		}
 		fs.Debugf(fdst, "Using server-side directory move")
 		err := fdstDirMove(ctx, fsrc, "", "")
+		list.InvalidateDir(ctx, fsrc, "")
+		list.InvalidateDir(ctx, fdst, "")
 		switch err {
 		case fs.ErrorCantDirMove, fs.ErrorDirExists:
 			fs.Infof(fdst, "Server side directory move failed - fallback to file moves: %v", err)
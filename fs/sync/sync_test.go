@@ -17,6 +17,7 @@ import (
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/list"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
 	"github.com/stretchr/testify/assert"
@@ -250,6 +251,41 @@ func TestSyncEmptyDirectories(t *testing.T) {
 	)
 }
 
+// Test sync with --name-transform
+func TestSyncNameTransform(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.NameTransform = []string{"all,uppercase", "file,suffix_keep_extension=-1"}
+	r.WriteFile("sub dir/hello world.txt", "hello world", t1)
+	err := operations.Mkdir(ctx, r.Flocal, "sub dir2")
+	require.NoError(t, err)
+	r.Mkdir(ctx, r.Fremote)
+	file2 := r.WriteObject(ctx, "old.txt", "old", t1)
+	r.CheckRemoteItems(t, file2)
+
+	err = Sync(ctx, r.Fremote, r.Flocal, true)
+	require.NoError(t, err)
+
+	r.CheckRemoteListing(
+		t,
+		[]fstest.Item{
+			fstest.NewItem("SUB DIR/HELLO WORLD-1.TXT", "hello world", t1),
+		},
+		[]string{
+			"SUB DIR",
+			"SUB DIR2",
+		},
+	)
+
+	// A second sync should find everything up to date
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, r.Fremote, r.Flocal, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetDeletes())
+}
+
 // Test a server-side copy if possible, or the backup path if not
 func TestServerSideCopy(t *testing.T) {
 	ctx := context.Background()
@@ -335,6 +371,34 @@ func TestSyncBasedOnCheckSum(t *testing.T) {
 	r.CheckRemoteItems(t, file1)
 }
 
+// Sync with the listing cache, checking the changes made by one sync
+// are seen by the next
+func TestSyncWithListCache(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	ci.ListCache = true
+
+	file1 := r.WriteFile("dir/file1", "file1", t1)
+	file2 := r.WriteFile("file2", "file2", t1)
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, file1, file2)
+
+	// Remove a file from the source and sync the removal
+	o, err := r.Flocal.NewObject(ctx, "dir/file1")
+	require.NoError(t, err)
+	require.NoError(t, operations.DeleteFile(ctx, o))
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, file2)
+
+	// Put it back outside rclone and sync again - the destination
+	// listing must not still have the file in
+	r.WriteFile("dir/file1", "file1", t1)
+	list.InvalidateDir(ctx, r.Flocal, "")
+	require.NoError(t, Sync(ctx, r.Fremote, r.Flocal, false))
+	r.CheckRemoteItems(t, file1, file2)
+}
+
 // Create a file and sync it. Change the last modified date and the
 // file contents but not the size.  If we're only doing sync by size
 // only, we expect nothing to to be transferred on the second sync.
@@ -0,0 +1,282 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/atexit"
+)
+
+// Tuning for the exporter
+const (
+	exportInterval = 5 * time.Second  // how often to send spans
+	exportBatch    = 512              // send spans early if this many are waiting
+	exportTimeout  = 10 * time.Second // timeout for sending each batch
+	maxQueued      = 16384            // drop spans if this many are waiting
+)
+
+// exporter sends spans to an OpenTelemetry collector using OTLP/HTTP
+// with JSON encoding.
+//
+// It doesn't use fshttp so that its own requests aren't traced.
+type exporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+	mu          sync.Mutex
+	spans       []*Span
+	dropped     int
+	kick        chan struct{}
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// Init starts sending spans to the collector configured in Opt if
+// any.
+//
+// The spans waiting to be sent are sent when rclone exits.
+func Init(ctx context.Context) error {
+	if Opt.Endpoint == "" {
+		return nil
+	}
+	u, err := endpointURL(Opt.Endpoint)
+	if err != nil {
+		return err
+	}
+	e := newExporter(u, Opt.ServiceName)
+	activeExporter.Store(e)
+	atexit.Register(e.shutdown)
+	fs.Debugf(nil, "tracing: sending traces to %s", u)
+	return nil
+}
+
+// endpointURL returns the URL to send the traces to from endpoint
+//
+// The OTLP traces path is added if the endpoint doesn't have a path.
+func endpointURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("tracing: invalid endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("tracing: endpoint %q must start with http:// or https://", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+func newExporter(url, serviceName string) *exporter {
+	e := &exporter{
+		url:         url,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		kick:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.run()
+	return e
+}
+
+// add queues span to be sent
+func (e *exporter) add(span *Span) {
+	e.mu.Lock()
+	if len(e.spans) >= maxQueued {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.spans = append(e.spans, span)
+	n := len(e.spans)
+	e.mu.Unlock()
+	if n >= exportBatch {
+		select {
+		case e.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run sends the queued spans periodically until shutdown
+func (e *exporter) run() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.kick:
+		case <-e.done:
+			e.flush()
+			return
+		}
+		e.flush()
+	}
+}
+
+// flush sends all the queued spans
+func (e *exporter) flush() {
+	e.mu.Lock()
+	spans, dropped := e.spans, e.dropped
+	e.spans, e.dropped = nil, 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		fs.Errorf(nil, "tracing: dropped %d spans as the collector isn't keeping up", dropped)
+	}
+	for len(spans) > 0 {
+		n := len(spans)
+		if n > exportBatch {
+			n = exportBatch
+		}
+		err := e.export(spans[:n])
+		if err != nil {
+			fs.Errorf(nil, "tracing: failed to send %d spans: %v", n, err)
+		}
+		spans = spans[n:]
+	}
+}
+
+// shutdown sends the remaining spans and stops the exporter
+func (e *exporter) shutdown() {
+	activeExporter.CompareAndSwap(e, nil)
+	close(e.done)
+	e.wg.Wait()
+}
+
+// export sends spans to the collector
+func (e *exporter) export(spans []*Span) (err error) {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP error %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// The OTLP/HTTP JSON request, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// The OpenTelemetry status code for a failed span
+const statusCodeError = 2
+
+// request makes the OTLP request to send spans
+func (e *exporter) request(spans []*Span) *otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attrs),
+		}
+		if s.parentID != ([8]byte{}) {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != nil {
+			span.Status = &otlpStatus{Code: statusCodeError, Message: s.err.Error()}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+	return &otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: otlpAttributes([]Attribute{
+					String("service.name", e.serviceName),
+					String("service.version", fs.Version),
+				}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/rclone/rclone", Version: fs.Version},
+				Spans: out,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes converts attrs into OTLP attributes
+func otlpAttributes(attrs []Attribute) []otlpAttribute {
+	out := make([]otlpAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		kind := "stringValue"
+		if attr.isInt {
+			kind = "intValue"
+		}
+		out = append(out, otlpAttribute{Key: attr.Key, Value: map[string]string{kind: attr.Value}})
+	}
+	return out
+}
@@ -0,0 +1,190 @@
+// Package tracing records traces of the operations rclone does and
+// sends them to an OpenTelemetry collector.
+//
+// Spans are started with Start and StartClient and carried in the
+// context.Context so that spans started from a context are children
+// of the span in it. If tracing isn't enabled Start returns a nil
+// *Span whose methods do nothing so tracing costs very little when it
+// isn't in use.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Options for tracing
+type Options struct {
+	Endpoint    string // OTLP/HTTP endpoint of the collector to send traces to
+	ServiceName string // service name to report the traces as from
+}
+
+// DefaultOpt is the default values used for Opt
+var DefaultOpt = Options{
+	ServiceName: "rclone",
+}
+
+// Opt is the options for tracing
+var Opt = DefaultOpt
+
+// The exporter spans are sent to when they end, nil if tracing isn't
+// enabled
+var activeExporter atomic.Pointer[exporter]
+
+// Enabled returns true if spans are being recorded
+func Enabled() bool {
+	return activeExporter.Load() != nil
+}
+
+// Span kinds as defined by OpenTelemetry
+const (
+	kindInternal = 1 // an operation within rclone
+	kindClient   = 3 // a request to a remote service
+)
+
+// Attribute is a key value pair describing a span
+type Attribute struct {
+	Key   string
+	Value string
+	isInt bool
+}
+
+// String makes a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int64 makes an integer attribute
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: strconv.FormatInt(value, 10), isInt: true}
+}
+
+// Remote makes the attributes for the remote f and the path within
+// it, or nil if tracing isn't enabled so they cost nothing to pass to
+// Start.
+func Remote(f fs.Info, path string) []Attribute {
+	if !Enabled() {
+		return nil
+	}
+	attrs := make([]Attribute, 0, 2)
+	if f != nil {
+		attrs = append(attrs, String("rclone.remote", f.Name()))
+	}
+	return append(attrs, String("rclone.path", path))
+}
+
+// Span records a single operation in a trace
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte // zero if this is the root span
+	name     string
+	kind     int
+	start    time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs []Attribute
+	err   error
+	ended bool
+}
+
+type spanContextKeyType struct{}
+
+// Context key for the current span
+var spanContextKey = spanContextKeyType{}
+
+// FromContext returns the current span in ctx or nil if there isn't
+// one
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey).(*Span)
+	return span
+}
+
+// Start a span called name as a child of the span in ctx, returning
+// a context carrying the new span.
+//
+// The span must be ended with End. If tracing isn't enabled it
+// returns ctx and a nil span.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return start(ctx, name, kindInternal, attrs)
+}
+
+// StartClient starts a span called name for a request to a remote
+// service as a child of the span in ctx.
+func StartClient(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return start(ctx, name, kindClient, attrs)
+}
+
+func start(ctx context.Context, name string, kind int, attrs []Attribute) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+	span := &Span{
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+		attrs: attrs,
+	}
+	if parent := FromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		randomID(span.traceID[:])
+	}
+	randomID(span.spanID[:])
+	return context.WithValue(ctx, spanContextKey, span), span
+}
+
+// randomID fills id with random bytes
+func randomID(id []byte) {
+	_, err := rand.Read(id)
+	if err != nil {
+		fs.Errorf(nil, "tracing: failed to make span ID: %v", err)
+	}
+}
+
+// SetAttributes adds attrs to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// End the span, marking it as failed if err is not nil, and send it
+// to the collector.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.err = err
+	s.mu.Unlock()
+	if e := activeExporter.Load(); e != nil {
+		e.add(s)
+	}
+}
+
+// TraceID returns the ID of the trace the span is part of as hex
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointURL(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"http://localhost:4318", "http://localhost:4318/v1/traces", false},
+		{"http://localhost:4318/", "http://localhost:4318/v1/traces", false},
+		{"https://collector/custom/path", "https://collector/custom/path", false},
+		{"localhost:4318", "", true},
+		{"ftp://localhost", "", true},
+	} {
+		got, err := endpointURL(test.in)
+		if test.wantErr {
+			assert.Error(t, err, test.in)
+		} else {
+			require.NoError(t, err, test.in)
+			assert.Equal(t, test.want, got, test.in)
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, Enabled())
+	newCtx, span := Start(ctx, "test", String("key", "value"))
+	assert.Nil(t, span)
+	assert.Equal(t, ctx, newCtx)
+	assert.Nil(t, Remote(nil, "path"))
+	// Methods on nil spans do nothing
+	span.SetAttributes(Int64("n", 1))
+	span.End(nil)
+	assert.Equal(t, "", span.TraceID())
+}
+
+func TestExport(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []otlpRequest
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var req otlpRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	u, err := endpointURL(ts.URL)
+	require.NoError(t, err)
+	e := newExporter(u, "test-service")
+	activeExporter.Store(e)
+
+	ctx := context.Background()
+	ctx, parent := Start(ctx, "parent", String("rclone.remote", "remote"))
+	require.NotNil(t, parent)
+	assert.Equal(t, parent, FromContext(ctx))
+	_, child := StartClient(ctx, "child")
+	child.SetAttributes(Int64("http.response.status_code", 404))
+	child.End(errors.New("not found"))
+	parent.End(nil)
+	parent.End(nil) // ending twice is ignored
+
+	e.shutdown()
+	assert.False(t, Enabled())
+
+	require.Equal(t, 1, len(requests))
+	resourceSpans := requests[0].ResourceSpans
+	require.Equal(t, 1, len(resourceSpans))
+	assert.Equal(t, "service.name", resourceSpans[0].Resource.Attributes[0].Key)
+	assert.Equal(t, map[string]string{"stringValue": "test-service"}, resourceSpans[0].Resource.Attributes[0].Value)
+	spans := resourceSpans[0].ScopeSpans[0].Spans
+	require.Equal(t, 2, len(spans))
+
+	gotChild, gotParent := spans[0], spans[1]
+	assert.Equal(t, "parent", gotParent.Name)
+	assert.Equal(t, kindInternal, gotParent.Kind)
+	assert.Equal(t, parent.TraceID(), gotParent.TraceID)
+	assert.Equal(t, "", gotParent.ParentSpanID)
+	assert.Nil(t, gotParent.Status)
+	assert.Equal(t, []otlpAttribute{{Key: "rclone.remote", Value: map[string]string{"stringValue": "remote"}}}, gotParent.Attributes)
+
+	assert.Equal(t, "child", gotChild.Name)
+	assert.Equal(t, kindClient, gotChild.Kind)
+	assert.Equal(t, gotParent.TraceID, gotChild.TraceID)
+	assert.Equal(t, gotParent.SpanID, gotChild.ParentSpanID)
+	assert.NotEqual(t, gotParent.SpanID, gotChild.SpanID)
+	assert.Equal(t, &otlpStatus{Code: statusCodeError, Message: "not found"}, gotChild.Status)
+	assert.Equal(t, []otlpAttribute{{Key: "http.response.status_code", Value: map[string]string{"intValue": "404"}}}, gotChild.Attributes)
+}
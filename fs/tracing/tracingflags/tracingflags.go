@@ -0,0 +1,14 @@
+// Package tracingflags implements command line flags to set up tracing
+package tracingflags
+
+import (
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/tracing"
+	"github.com/spf13/pflag"
+)
+
+// AddFlags adds the tracing flags to the flagSet
+func AddFlags(flagSet *pflag.FlagSet) {
+	flags.StringVarP(flagSet, &tracing.Opt.Endpoint, "tracing-endpoint", "", tracing.Opt.Endpoint, "Send OpenTelemetry traces to this OTLP/HTTP endpoint, e.g. http://localhost:4318", "Debugging")
+	flags.StringVarP(flagSet, &tracing.Opt.ServiceName, "tracing-service-name", "", tracing.Opt.ServiceName, "Service name to report OpenTelemetry traces as from", "Debugging")
+}
@@ -0,0 +1,424 @@
+// Package archive reads and writes zip and tar archives stored in
+// rclone objects.
+//
+// Archives are read with as few requests as possible. Zip archives
+// and uncompressed tar archives are indexed once and members are then
+// read with range requests. Compressed tar archives can only be read
+// sequentially so opening a member means reading the archive from the
+// start.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/readers"
+)
+
+// Format is the type of an archive
+type Format = fs.Enum[formatChoices]
+
+// Supported archive formats
+const (
+	FormatZip Format = iota
+	FormatTar
+	FormatTarGz
+)
+
+type formatChoices struct{}
+
+func (formatChoices) Choices() []string {
+	return []string{
+		FormatZip:   "zip",
+		FormatTar:   "tar",
+		FormatTarGz: "tar.gz",
+	}
+}
+
+func (formatChoices) Type() string {
+	return "ArchiveFormat"
+}
+
+// FormatFromName works out the archive format from the extension of
+// name.
+func FormatFromName(name string) (format Format, err error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return FormatTar, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	}
+	return format, fmt.Errorf("can't work out archive format from %q - use one of these extensions: .zip, .tar, .tar.gz, .tgz", name)
+}
+
+// Entry is a single member of an archive
+type Entry struct {
+	Path    string      // path of the entry within the archive without leading or trailing /
+	Size    int64       // size of the entry - 0 for directories
+	ModTime time.Time   // modification time
+	Mode    os.FileMode // permissions and type of the entry
+	IsDir   bool        // set if this entry is a directory
+	CRC32   uint32      // CRC-32 of the contents if HasCRC is set
+	HasCRC  bool        // set if CRC32 is valid
+
+	a      *Archive  // archive this entry belongs to
+	index  int       // index of the entry in the tar stream
+	offset int64     // offset of the data in an uncompressed tar or -1
+	zf     *zip.File // zip file entry if a zip
+}
+
+// Metadata returns the metadata of the entry in the same form as the
+// local backend produces it.
+func (e *Entry) Metadata() fs.Metadata {
+	return fs.Metadata{
+		"mode":  fmt.Sprintf("%o", unixMode(e.Mode)),
+		"mtime": e.ModTime.Format(time.RFC3339Nano),
+	}
+}
+
+// Archive is an index of the members of an archive object
+type Archive struct {
+	o       fs.Object
+	format  Format
+	Entries []*Entry
+}
+
+// New reads the index of the archive in o.
+//
+// For zip archives this reads the central directory only. For tar
+// archives this reads the whole archive.
+func New(ctx context.Context, o fs.Object, format Format) (a *Archive, err error) {
+	a = &Archive{
+		o:      o,
+		format: format,
+	}
+	switch format {
+	case FormatZip:
+		err = a.readZipIndex(ctx)
+	case FormatTar, FormatTarGz:
+		err = walkTar(ctx, o, format, func(e *Entry, _ io.Reader) error {
+			e.a = a
+			a.Entries = append(a.Entries, e)
+			return nil
+		})
+	default:
+		err = fmt.Errorf("unknown archive format %v", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %v: %w", o, err)
+	}
+	return a, nil
+}
+
+// Format returns the format of the archive
+func (a *Archive) Format() Format {
+	return a.format
+}
+
+// readZipIndex reads the central directory of a zip file
+func (a *Archive) readZipIndex(ctx context.Context) error {
+	size := a.o.Size()
+	if size < 0 {
+		return errors.New("can't read zip archives of unknown size")
+	}
+	zr, err := zip.NewReader(newObjectReaderAt(ctx, a.o), size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		e := &Entry{
+			Size:    int64(zf.UncompressedSize64),
+			ModTime: zf.Modified,
+			Mode:    mode,
+			IsDir:   mode.IsDir(),
+			CRC32:   zf.CRC32,
+			HasCRC:  !mode.IsDir(),
+			a:       a,
+			offset:  -1,
+			zf:      zf,
+		}
+		if !mode.IsDir() && !mode.IsRegular() {
+			fs.Debugf(a.o, "Skipping non regular file %q in archive", zf.Name)
+			continue
+		}
+		if !e.setPath(zf.Name) {
+			fs.Debugf(a.o, "Skipping unsafe name %q in archive", zf.Name)
+			continue
+		}
+		if e.IsDir {
+			e.Size = 0
+		}
+		a.Entries = append(a.Entries, e)
+	}
+	return nil
+}
+
+// setPath cleans up name and sets it as the path of the entry.
+//
+// It returns false if the name is empty or would escape the root of
+// the archive.
+func (e *Entry) setPath(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Clean("/" + name)
+	name = strings.TrimPrefix(name, "/")
+	if name == "" || name == "." {
+		return false
+	}
+	e.Path = name
+	return true
+}
+
+// WalkFunc is called for each entry in the archive.
+//
+// in is the contents of the entry and is only valid during the call.
+// It is nil for directories.
+type WalkFunc func(e *Entry, in io.Reader) error
+
+// Walk calls fn for each entry of the archive in o in the order they
+// are stored in the archive.
+//
+// Tar archives are read in a single streaming pass.
+func Walk(ctx context.Context, o fs.Object, format Format, fn WalkFunc) error {
+	if format != FormatZip {
+		return walkTar(ctx, o, format, fn)
+	}
+	a, err := New(ctx, o, format)
+	if err != nil {
+		return err
+	}
+	for _, e := range a.Entries {
+		if e.IsDir {
+			err = fn(e, nil)
+		} else {
+			err = e.walkZip(ctx, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkZip opens the zip entry and calls fn on it
+func (e *Entry) walkZip(ctx context.Context, fn WalkFunc) error {
+	in, err := e.Open(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(e, in)
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// walkTar reads the tar archive in o calling fn for each entry
+func walkTar(ctx context.Context, o fs.Object, format Format, fn WalkFunc) (err error) {
+	rc, err := o.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(rc, &err)
+	return walkTarReader(ctx, rc, format, fn)
+}
+
+// walkTarReader reads the tar archive from in calling fn for each entry
+func walkTarReader(ctx context.Context, in io.Reader, format Format, fn WalkFunc) error {
+	cr := readers.NewCountingReader(in)
+	var r io.Reader = cr
+	if format == FormatTarGz {
+		gz, err := gzip.NewReader(cr)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for i := 0; ; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := &Entry{
+			Size:    hdr.Size,
+			ModTime: hdr.ModTime,
+			Mode:    hdr.FileInfo().Mode(),
+			index:   i,
+			offset:  -1,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.IsDir = true
+			e.Size = 0
+		case tar.TypeReg:
+			if format == FormatTar {
+				e.offset = int64(cr.BytesRead())
+			}
+		default:
+			fs.Debugf(nil, "Skipping non regular file %q in archive", hdr.Name)
+			continue
+		}
+		if !e.setPath(hdr.Name) {
+			fs.Debugf(nil, "Skipping unsafe name %q in archive", hdr.Name)
+			continue
+		}
+		var data io.Reader
+		if !e.IsDir {
+			data = tr
+		}
+		err = fn(e, data)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Open the entry for reading.
+//
+// It supports fs.RangeOption and fs.SeekOption.
+func (e *Entry) Open(ctx context.Context, options ...fs.OpenOption) (rc io.ReadCloser, err error) {
+	if e.IsDir {
+		return nil, fs.ErrorIsDir
+	}
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.RangeOption:
+			offset, limit = x.Decode(e.Size)
+		case *fs.SeekOption:
+			offset = x.Offset
+		default:
+			if option.Mandatory() {
+				fs.Logf(e.a.o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if offset > e.Size {
+		offset = e.Size
+	}
+	if limit < 0 || offset+limit > e.Size {
+		limit = e.Size - offset
+	}
+	if limit == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	switch {
+	case e.zf != nil:
+		rc, err = e.openZip(ctx)
+	case e.offset >= 0:
+		// Uncompressed tar so read the range directly
+		return e.a.o.Open(ctx, &fs.RangeOption{Start: e.offset + offset, End: e.offset + offset + limit - 1})
+	default:
+		rc, err = e.openTarStream(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		_, err = io.CopyN(io.Discard, rc, offset)
+		if err != nil {
+			_ = rc.Close()
+			return nil, fmt.Errorf("failed to seek to %d in %q: %w", offset, e.Path, err)
+		}
+	}
+	return readers.NewLimitedReadCloser(rc, limit), nil
+}
+
+// openZip opens the data of a zip entry
+//
+// Stored and deflated entries are read with a single range request,
+// anything else is read through the zip library.
+func (e *Entry) openZip(ctx context.Context) (io.ReadCloser, error) {
+	zf := e.zf
+	if zf.Flags&0x1 != 0 {
+		return nil, fmt.Errorf("can't read encrypted zip entry %q", e.Path)
+	}
+	if zf.Method != zip.Store && zf.Method != zip.Deflate {
+		return zf.Open()
+	}
+	dataOffset, err := zf.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := e.a.o.Open(ctx, &fs.RangeOption{Start: dataOffset, End: dataOffset + int64(zf.CompressedSize64) - 1})
+	if err != nil {
+		return nil, err
+	}
+	if zf.Method == zip.Store {
+		return rc, nil
+	}
+	return readCloser{
+		Reader: flate.NewReader(rc),
+		Closer: rc,
+	}, nil
+}
+
+// openTarStream reads the compressed tar archive from the start until
+// it finds the entry.
+func (e *Entry) openTarStream(ctx context.Context) (io.ReadCloser, error) {
+	rc, err := e.a.o.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		err := walkTarReader(ctx, rc, e.a.format, func(found *Entry, in io.Reader) error {
+			if found.index != e.index {
+				return nil
+			}
+			_, err := io.Copy(pw, in)
+			if err == nil {
+				err = io.EOF
+			}
+			return err
+		})
+		if err == nil {
+			err = fmt.Errorf("entry %q not found in archive", e.Path)
+		}
+		_ = rc.Close()
+		_ = pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// readCloser joins a Reader and a Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// unixMode converts an os.FileMode into unix permissions and type bits
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode.IsDir() {
+		m |= 0040000
+	} else {
+		m |= 0100000
+	}
+	return m
+}
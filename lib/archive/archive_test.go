@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testModTime = time.Date(2023, 11, 12, 13, 14, 15, 0, time.UTC)
+
+type testEntry struct {
+	path    string
+	content string
+	isDir   bool
+}
+
+var testEntries = []testEntry{
+	{path: "dir", isDir: true},
+	{path: "dir/file1.txt", content: "hello world"},
+	{path: "dir/empty.txt", content: ""},
+	{path: "file2.bin", content: random.String(3 * readAtBlockSize / 2)},
+}
+
+// makeArchive makes an archive of testEntries in an object
+func makeArchive(t *testing.T, format Format) fs.Object {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, format)
+	for _, te := range testEntries {
+		e := &Entry{
+			Path:    te.path,
+			Size:    int64(len(te.content)),
+			ModTime: testModTime,
+			Mode:    0644,
+			IsDir:   te.isDir,
+		}
+		require.NoError(t, w.Add(e, bytes.NewBufferString(te.content)))
+	}
+	require.NoError(t, w.Close())
+	return mockobject.New("archive").WithContent(buf.Bytes(), mockobject.SeekModeNone)
+}
+
+func TestFormatFromName(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		want    Format
+		wantErr bool
+	}{
+		{"file.zip", FormatZip, false},
+		{"FILE.ZIP", FormatZip, false},
+		{"file.tar", FormatTar, false},
+		{"file.tar.gz", FormatTarGz, false},
+		{"file.tgz", FormatTarGz, false},
+		{"file.gz", FormatZip, true},
+		{"file", FormatZip, true},
+	} {
+		got, err := FormatFromName(test.name)
+		if test.wantErr {
+			assert.Error(t, err, test.name)
+		} else {
+			assert.NoError(t, err, test.name)
+			assert.Equal(t, test.want, got, test.name)
+		}
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"file", "file", true},
+		{"dir/", "dir", true},
+		{"./dir/file", "dir/file", true},
+		{"/abs/file", "abs/file", true},
+		{"../../etc/passwd", "etc/passwd", true},
+		{"dir\\file", "dir/file", true},
+		{"", "", false},
+		{"./", "", false},
+	} {
+		var e Entry
+		ok := e.setPath(test.in)
+		assert.Equal(t, test.ok, ok, test.in)
+		assert.Equal(t, test.want, e.Path, test.in)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	ctx := context.Background()
+	for _, format := range []Format{FormatZip, FormatTar, FormatTarGz} {
+		t.Run(format.String(), func(t *testing.T) {
+			o := makeArchive(t, format)
+			a, err := New(ctx, o, format)
+			require.NoError(t, err)
+			assert.Equal(t, format, a.Format())
+			require.Equal(t, len(testEntries), len(a.Entries))
+			for i, te := range testEntries {
+				e := a.Entries[i]
+				assert.Equal(t, te.path, e.Path)
+				assert.Equal(t, te.isDir, e.IsDir)
+				assert.True(t, testModTime.Equal(e.ModTime), e.ModTime)
+				assert.Equal(t, os.FileMode(0644), e.Mode.Perm())
+				if te.isDir {
+					_, err := e.Open(ctx)
+					assert.Equal(t, fs.ErrorIsDir, err)
+					continue
+				}
+				assert.Equal(t, int64(len(te.content)), e.Size)
+
+				// Read the whole entry
+				in, err := e.Open(ctx)
+				require.NoError(t, err)
+				got, err := io.ReadAll(in)
+				require.NoError(t, err)
+				require.NoError(t, in.Close())
+				assert.Equal(t, te.content, string(got))
+
+				// Read some ranges of the entry
+				for _, r := range []fs.RangeOption{{Start: 0, End: 0}, {Start: 1, End: 5}, {Start: 3, End: -1}, {Start: -1, End: 4}} {
+					if len(te.content) < 6 {
+						break
+					}
+					what := fmt.Sprintf("%s %v", te.path, r)
+					offset, limit := r.Decode(e.Size)
+					want := te.content[offset:]
+					if limit >= 0 {
+						want = want[:limit]
+					}
+					in, err := e.Open(ctx, &r)
+					require.NoError(t, err, what)
+					got, err := io.ReadAll(in)
+					require.NoError(t, err, what)
+					require.NoError(t, in.Close(), what)
+					assert.Equal(t, want, string(got), what)
+				}
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	ctx := context.Background()
+	for _, format := range []Format{FormatZip, FormatTar, FormatTarGz} {
+		t.Run(format.String(), func(t *testing.T) {
+			o := makeArchive(t, format)
+			i := 0
+			err := Walk(ctx, o, format, func(e *Entry, in io.Reader) error {
+				te := testEntries[i]
+				i++
+				assert.Equal(t, te.path, e.Path)
+				if te.isDir {
+					assert.Nil(t, in)
+					return nil
+				}
+				got, err := io.ReadAll(in)
+				require.NoError(t, err)
+				assert.Equal(t, te.content, string(got))
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, len(testEntries), i)
+		})
+	}
+}
+
+func TestWriterTarUnknownSize(t *testing.T) {
+	w := NewWriter(io.Discard, FormatTar)
+	err := w.Add(&Entry{Path: "file", Size: -1}, bytes.NewBufferString("potato"))
+	assert.ErrorContains(t, err, "size is unknown")
+}
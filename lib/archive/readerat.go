@@ -0,0 +1,81 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// readAtBlockSize is the minimum amount of data read from the object
+// by each request.
+const readAtBlockSize = 256 * 1024
+
+// objectReaderAt implements io.ReaderAt on an fs.Object using range
+// requests.
+//
+// The most recently read block is kept so that the small reads made
+// when parsing zip headers don't each turn into a request.
+type objectReaderAt struct {
+	ctx    context.Context
+	o      fs.Object
+	size   int64
+	mu     sync.Mutex
+	offset int64  // offset of buf in the object
+	buf    []byte // most recently read block
+}
+
+func newObjectReaderAt(ctx context.Context, o fs.Object) *objectReaderAt {
+	return &objectReaderAt{
+		ctx:  ctx,
+		o:    o,
+		size: o.Size(),
+	}
+}
+
+// ReadAt reads len(p) bytes at off into p
+func (r *objectReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(p) > 0 {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		if off < r.offset || off >= r.offset+int64(len(r.buf)) {
+			err = r.fill(off, len(p))
+			if err != nil {
+				return n, err
+			}
+		}
+		copied := copy(p, r.buf[off-r.offset:])
+		n += copied
+		off += int64(copied)
+		p = p[copied:]
+	}
+	return n, nil
+}
+
+// fill reads at least want bytes from off into the buffer
+func (r *objectReaderAt) fill(off int64, want int) (err error) {
+	if want < readAtBlockSize {
+		want = readAtBlockSize
+	}
+	end := off + int64(want)
+	if end > r.size {
+		end = r.size
+	}
+	in, err := r.o.Open(r.ctx, &fs.RangeOption{Start: off, End: end - 1})
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	buf := make([]byte, end-off)
+	_, err = io.ReadFull(in, buf)
+	if err != nil {
+		return err
+	}
+	r.offset = off
+	r.buf = buf
+	return nil
+}
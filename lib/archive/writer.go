@@ -0,0 +1,128 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Writer writes an archive as a stream
+type Writer struct {
+	format Format
+	gz     *gzip.Writer
+	tw     *tar.Writer
+	zw     *zip.Writer
+}
+
+// NewWriter makes a Writer which writes an archive of the given
+// format to out.
+//
+// Close must be called to finish the archive.
+func NewWriter(out io.Writer, format Format) *Writer {
+	w := &Writer{
+		format: format,
+	}
+	switch format {
+	case FormatZip:
+		w.zw = zip.NewWriter(out)
+	case FormatTarGz:
+		w.gz = gzip.NewWriter(out)
+		w.tw = tar.NewWriter(w.gz)
+	default:
+		w.tw = tar.NewWriter(out)
+	}
+	return w
+}
+
+// Add writes the entry e to the archive reading its contents from in.
+//
+// in is ignored for directories. Tar archives need the Size of the
+// entry to be known in advance and exactly that many bytes must be
+// read from in.
+func (w *Writer) Add(e *Entry, in io.Reader) error {
+	if w.zw != nil {
+		return w.addZip(e, in)
+	}
+	return w.addTar(e, in)
+}
+
+func (w *Writer) addZip(e *Entry, in io.Reader) error {
+	hdr := &zip.FileHeader{
+		Name:     e.Path,
+		Method:   zip.Deflate,
+		Modified: e.ModTime,
+	}
+	mode := e.Mode.Perm()
+	if e.IsDir {
+		hdr.Name += "/"
+		hdr.Method = zip.Store
+		mode |= os.ModeDir
+	}
+	hdr.SetMode(mode)
+	out, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return fmt.Errorf("failed to write header for %q: %w", e.Path, err)
+	}
+	if e.IsDir {
+		return nil
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %w", e.Path, err)
+	}
+	return nil
+}
+
+func (w *Writer) addTar(e *Entry, in io.Reader) error {
+	if !e.IsDir && e.Size < 0 {
+		return fmt.Errorf("can't add %q to tar archive as its size is unknown", e.Path)
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     e.Path,
+		Size:     e.Size,
+		Mode:     int64(e.Mode.Perm()),
+		ModTime:  e.ModTime,
+		Format:   tar.FormatPAX,
+	}
+	if e.IsDir {
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		hdr.Size = 0
+	}
+	err := w.tw.WriteHeader(hdr)
+	if err != nil {
+		return fmt.Errorf("failed to write header for %q: %w", e.Path, err)
+	}
+	if e.IsDir {
+		return nil
+	}
+	n, err := io.Copy(w.tw, in)
+	if err == nil && n != e.Size {
+		err = fmt.Errorf("size changed: expecting %d bytes but read %d", e.Size, n)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %w", e.Path, err)
+	}
+	return nil
+}
+
+// Close finishes writing the archive.
+//
+// It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	err := w.tw.Close()
+	if err != nil {
+		return err
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
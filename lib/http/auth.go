@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"html/template"
 	"log"
+	"net/http"
 
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/spf13/pflag"
@@ -63,6 +64,10 @@ Use ` + "`--{{ .Prefix }}salt`" + ` to change the password hashing salt from the
 // If a non nil value is returned then it is added to the context under the key
 type CustomAuthFn func(user, pass string) (value interface{}, err error)
 
+// SkipAuthFn if used is called for each request and if it returns true
+// the request is served without authentication.
+type SkipAuthFn func(r *http.Request) bool
+
 // AuthConfig contains options for the http authentication
 type AuthConfig struct {
 	HtPasswd     string       // htpasswd file - if not provided no authentication is done
@@ -71,6 +76,7 @@ type AuthConfig struct {
 	BasicPass    string       // password for BasicUser
 	Salt         string       // password hashing salt
 	CustomAuthFn CustomAuthFn `json:"-"` // custom Auth (not set by command line flags)
+	SkipAuthFn   SkipAuthFn   `json:"-"` // requests to serve without auth (not set by command line flags)
 }
 
 // AddFlagsPrefix adds flags to the flag set for AuthConfig
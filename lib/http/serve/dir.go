@@ -2,8 +2,10 @@ package serve
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"mime"
 	"net/http"
 	"net/url"
 	"path"
@@ -37,6 +39,8 @@ type Directory struct {
 	Breadcrumb   []Crumb
 	Sort         string
 	Order        string
+	Writable     bool // set if the template should show the controls to change files
+	Thumbnails   bool // set if thumbnails can be fetched for images
 }
 
 // Crumb is a breadcrumb entry
@@ -221,7 +225,67 @@ const (
 	sortByTime         = "time"
 )
 
+// jsonEntry is a DirEntry as returned in a JSON listing
+type jsonEntry struct {
+	Name     string
+	URL      string
+	IsDir    bool
+	Size     int64
+	MimeType string     `json:",omitempty"`
+	ModTime  *time.Time `json:",omitempty"`
+}
+
+// jsonDirectory is a Directory as returned in a JSON listing
+type jsonDirectory struct {
+	Name    string
+	Entries []jsonEntry
+}
+
+// WantsJSON returns true if the client asked for a JSON response
+// with its Accept header
+func WantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// serveJSON serves the directory listing as JSON
+func (d *Directory) serveJSON(w http.ResponseWriter) {
+	out := jsonDirectory{
+		Name:    d.Name,
+		Entries: make([]jsonEntry, 0, len(d.Entries)),
+	}
+	for i := range d.Entries {
+		entry := &d.Entries[i]
+		item := jsonEntry{
+			Name:  strings.TrimSuffix(entry.Leaf, "/"),
+			URL:   entry.URL,
+			IsDir: entry.IsDir,
+			Size:  entry.Size,
+		}
+		if !entry.IsDir {
+			item.MimeType = mime.TypeByExtension(path.Ext(item.Name))
+		}
+		if !entry.ModTime.IsZero() {
+			item.ModTime = &entry.ModTime
+		}
+		out.Entries = append(out.Entries, item)
+	}
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(out)
+	if err != nil {
+		Error(d.DirRemote, w, "Failed to encode JSON", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = buf.WriteTo(w)
+	if err != nil {
+		Error(d.DirRemote, nil, "Failed to drain JSON buffer", err)
+	}
+}
+
 // Serve serves a directory
+//
+// The listing is rendered with the HTML template unless the client
+// asks for JSON with its Accept header.
 func (d *Directory) Serve(w http.ResponseWriter, r *http.Request) {
 	// Account the transfer
 	tr := accounting.Stats(r.Context()).NewTransferRemoteSize(d.DirRemote, -1)
@@ -229,6 +293,11 @@ func (d *Directory) Serve(w http.ResponseWriter, r *http.Request) {
 
 	fs.Infof(d.DirRemote, "%s: Serving directory", r.RemoteAddr)
 
+	if WantsJSON(r) {
+		d.serveJSON(w)
+		return
+	}
+
 	buf := &bytes.Buffer{}
 	err := d.HTMLTemplate.Execute(buf, d)
 	if err != nil {
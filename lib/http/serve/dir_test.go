@@ -122,3 +122,26 @@ func TestServe(t *testing.T) {
 </html>
 `, string(body))
 }
+
+func TestServeJSON(t *testing.T) {
+	modTime := time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := NewDirectory("aDirectory", GetTemplate(t))
+	d.AddHTMLEntry("aDirectory/file.txt", false, 64, modTime)
+	d.AddHTMLEntry("aDirectory/dir", true, -1, time.Time{})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com/aDirectory/", nil)
+	r.Header.Set("Accept", "application/json")
+	d.Serve(w, r)
+	resp := w.Result()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.JSONEq(t, `{
+	"Name": "/aDirectory",
+	"Entries": [
+		{"Name": "file.txt", "URL": "file.txt", "IsDir": false, "Size": 64, "MimeType": "text/plain; charset=utf-8", "ModTime": "2000-01-02T03:04:05Z"},
+		{"Name": "dir", "URL": "dir/", "IsDir": true, "Size": -1}
+	]
+}`, string(body))
+}
@@ -302,28 +302,48 @@ func (s *Server) initAuth() {
 	authCertificateUserEnabled := s.tlsConfig != nil && s.tlsConfig.ClientAuth != tls.NoClientCert && s.auth.HtPasswd == "" && s.auth.BasicUser == ""
 	if authCertificateUserEnabled {
 		s.usingAuth = true
-		s.mux.Use(MiddlewareAuthCertificateUser())
+		s.useAuth(MiddlewareAuthCertificateUser())
 	}
 
 	if s.auth.CustomAuthFn != nil {
 		s.usingAuth = true
-		s.mux.Use(MiddlewareAuthCustom(s.auth.CustomAuthFn, s.auth.Realm, authCertificateUserEnabled))
+		s.useAuth(MiddlewareAuthCustom(s.auth.CustomAuthFn, s.auth.Realm, authCertificateUserEnabled))
 		return
 	}
 
 	if s.auth.HtPasswd != "" {
 		s.usingAuth = true
-		s.mux.Use(MiddlewareAuthHtpasswd(s.auth.HtPasswd, s.auth.Realm))
+		s.useAuth(MiddlewareAuthHtpasswd(s.auth.HtPasswd, s.auth.Realm))
 		return
 	}
 
 	if s.auth.BasicUser != "" {
 		s.usingAuth = true
-		s.mux.Use(MiddlewareAuthBasic(s.auth.BasicUser, s.auth.BasicPass, s.auth.Realm, s.auth.Salt))
+		s.useAuth(MiddlewareAuthBasic(s.auth.BasicUser, s.auth.BasicPass, s.auth.Realm, s.auth.Salt))
 		return
 	}
 }
 
+// useAuth adds the auth middleware to the router, skipping it for
+// the requests SkipAuthFn allows
+func (s *Server) useAuth(auth Middleware) {
+	skip := s.auth.SkipAuthFn
+	if skip == nil {
+		s.mux.Use(auth)
+		return
+	}
+	s.mux.Use(func(next http.Handler) http.Handler {
+		authenticated := auth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			authenticated.ServeHTTP(w, r)
+		})
+	})
+}
+
 func (s *Server) initTemplate() error {
 	if s.template == nil {
 		return nil
@@ -0,0 +1,423 @@
+// Package signedlink makes and checks expiring links to files which
+// are signed with a secret key, so rclone's http servers can share
+// files from any remote.
+package signedlink
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config"
+)
+
+// Names of the query parameters of a signed link
+const (
+	paramExpires   = "expires"
+	paramMax       = "max"
+	paramPassword  = "pw"
+	paramSignature = "sig"
+)
+
+// KeyFileName is the name of the file the key is stored in, which is
+// kept next to the config file
+const KeyFileName = "signed-links.key"
+
+// DefaultExpire is how long links last if no expiry is given
+const DefaultExpire = fs.Duration(7 * 24 * time.Hour)
+
+// Key is the secret used to sign the links
+type Key []byte
+
+// KeyPath returns the path of the file the key is stored in
+func KeyPath() string {
+	configPath := config.GetConfigPath()
+	if configPath == "" {
+		return filepath.Join(config.GetCacheDir(), KeyFileName)
+	}
+	return filepath.Join(filepath.Dir(configPath), KeyFileName)
+}
+
+// LoadKey reads the key from KeyPath, making a new random one if it
+// doesn't exist
+func LoadKey() (Key, error) {
+	keyPath := KeyPath()
+	data, err := os.ReadFile(keyPath)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) < 16 {
+			return nil, fmt.Errorf("signed link key %q is corrupted", keyPath)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read signed link key: %w", err)
+	}
+	key := make(Key, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to make signed link key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to make signed link key directory: %w", err)
+	}
+	// O_EXCL so we use the key of another rclone making it at the same time
+	f, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return LoadKey()
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to write signed link key: %w", err)
+	}
+	_, err = f.WriteString(hex.EncodeToString(key) + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write signed link key: %w", err)
+	}
+	fs.Infof(nil, "Made new key for signed links in %q", keyPath)
+	return key, nil
+}
+
+// mac returns the signature of the parts
+func (k Key) mac(parts ...string) string {
+	h := hmac.New(sha256.New, k)
+	for _, part := range parts {
+		_, _ = h.Write([]byte(part))
+		_, _ = h.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Link describes a signed link
+type Link struct {
+	Path         string    // path of the file from the root of the server
+	Expires      time.Time // when the link stops working
+	MaxDownloads int       // how many times the file may be downloaded, 0 for unlimited
+	Password     string    // password needed to download the file, "" for none
+}
+
+// passwordHash returns the hash of the password for the link
+func (k Key) passwordHash(link *Link, expires, maxDownloads string) string {
+	return k.mac("password", link.Path, expires, maxDownloads, link.Password)[:22]
+}
+
+// Sign returns the query parameters which make link valid
+func (k Key) Sign(link Link) url.Values {
+	params := url.Values{}
+	expires := strconv.FormatInt(link.Expires.Unix(), 10)
+	params.Set(paramExpires, expires)
+	maxDownloads := ""
+	if link.MaxDownloads > 0 {
+		maxDownloads = strconv.Itoa(link.MaxDownloads)
+		params.Set(paramMax, maxDownloads)
+	}
+	pw := ""
+	if link.Password != "" {
+		pw = k.passwordHash(&link, expires, maxDownloads)
+		params.Set(paramPassword, pw)
+	}
+	params.Set(paramSignature, k.mac("link", link.Path, expires, maxDownloads, pw))
+	return params
+}
+
+// Errors returned when checking links
+var (
+	ErrBadSignature = errors.New("link signature invalid")
+	ErrExpired      = errors.New("link expired")
+	ErrBadPassword  = errors.New("password needed")
+	ErrTooMany      = errors.New("link download limit reached")
+)
+
+// Verify checks the signature and expiry of the link to path with
+// the query params, returning the link. The password isn't checked.
+func (k Key) Verify(path string, params url.Values, now time.Time) (*Link, error) {
+	expires, maxDownloads, pw := params.Get(paramExpires), params.Get(paramMax), params.Get(paramPassword)
+	want := k.mac("link", path, expires, maxDownloads, pw)
+	if !hmac.Equal([]byte(want), []byte(params.Get(paramSignature))) {
+		return nil, ErrBadSignature
+	}
+	link := &Link{Path: path}
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+	link.Expires = time.Unix(expiresUnix, 0)
+	if !now.Before(link.Expires) {
+		return nil, ErrExpired
+	}
+	if maxDownloads != "" {
+		link.MaxDownloads, err = strconv.Atoi(maxDownloads)
+		if err != nil {
+			return nil, ErrBadSignature
+		}
+	}
+	return link, nil
+}
+
+// checkPassword checks password is the password of the link signed
+// with params
+func (k Key) checkPassword(link *Link, params url.Values, password string) bool {
+	pw := params.Get(paramPassword)
+	if pw == "" {
+		return true
+	}
+	link.Password = password
+	want := k.passwordHash(link, params.Get(paramExpires), params.Get(paramMax))
+	return hmac.Equal([]byte(want), []byte(pw))
+}
+
+// HasSignature returns true if the request is for a signed link. It
+// doesn't check the signature is valid.
+func HasSignature(r *http.Request) bool {
+	return r.URL.Query().Get(paramSignature) != ""
+}
+
+// download counts the downloads of a link
+type download struct {
+	size    int64 // size of the file or -1 if not known yet
+	served  int64 // bytes of the file served
+	expires time.Time
+}
+
+// Server checks the signed links for an http server
+//
+// The download limit of links is best effort. The downloads are
+// counted as the bytes of the file served so players reading a file
+// in parts don't use up the downloads, and a link is used up once it
+// has served the size of the file the number of times it may be
+// downloaded. The request which goes over the limit is still served
+// in full. The downloads are only counted in memory so they start
+// again when the server is restarted.
+type Server struct {
+	key       Key
+	mu        sync.Mutex
+	downloads map[string]*download // downloads by signature
+}
+
+// NewServer makes a Server using the key from LoadKey
+func NewServer() (*Server, error) {
+	key, err := LoadKey()
+	if err != nil {
+		return nil, err
+	}
+	return newServer(key), nil
+}
+
+// newServer makes a Server using key
+func newServer(key Key) *Server {
+	return &Server{
+		key:       key,
+		downloads: make(map[string]*download),
+	}
+}
+
+// requestPath returns the path of the file in the request
+func requestPath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/")
+}
+
+// SkipAuth returns true if the request is a download of a valid
+// signed link so it doesn't need the server's authentication.
+//
+// This is for libhttp.AuthConfig.SkipAuthFn
+func (s *Server) SkipAuth(r *http.Request) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	_, err := s.key.Verify(requestPath(r), r.URL.Query(), time.Now())
+	return err == nil
+}
+
+// Check checks the request is for a valid signed link, asking for
+// the password if needed. If it returns false it has written an error
+// response, otherwise the file should be served to the ResponseWriter
+// it returns which counts the download.
+func (s *Server) Check(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, bool) {
+	p := requestPath(r)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	params := r.URL.Query()
+	link, err := s.key.Verify(p, params, time.Now())
+	if err != nil {
+		fs.Infof(p, "%s: Refusing signed link: %v", r.RemoteAddr, err)
+		http.Error(w, "Link is invalid or has expired", http.StatusForbidden)
+		return nil, false
+	}
+	_, password, _ := r.BasicAuth()
+	if !s.key.checkPassword(link, params, password) {
+		fs.Infof(p, "%s: Refusing signed link: %v", r.RemoteAddr, ErrBadPassword)
+		w.Header().Set("WWW-Authenticate", `Basic realm="Password protected link", charset="UTF-8"`)
+		http.Error(w, "Password needed", http.StatusUnauthorized)
+		return nil, false
+	}
+	if link.MaxDownloads > 0 && r.Method == "GET" {
+		d := s.download(params.Get(paramSignature), link)
+		if d == nil {
+			fs.Infof(p, "%s: Refusing signed link: %v", r.RemoteAddr, ErrTooMany)
+			http.Error(w, "Link download limit reached", http.StatusGone)
+			return nil, false
+		}
+		// Responses with several ranges don't have the size of
+		// the file so serve the whole file instead
+		if strings.Contains(r.Header.Get("Range"), ",") {
+			r.Header.Del("Range")
+		}
+		w = &countingWriter{ResponseWriter: w, s: s, d: d}
+	}
+	fs.Infof(p, "%s: Serving signed link", r.RemoteAddr)
+	return w, true
+}
+
+// download returns the download of link, or nil if it has used up
+// its downloads
+func (s *Server) download(sig string, link *Link) *download {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	d := s.downloads[sig]
+	if d == nil {
+		// Forget the expired links as new ones are added
+		for k, d := range s.downloads {
+			if !now.Before(d.expires) {
+				delete(s.downloads, k)
+			}
+		}
+		d = &download{size: -1, expires: link.Expires}
+		s.downloads[sig] = d
+	}
+	// Empty files can't be counted like this but have nothing to
+	// give away
+	if d.size > 0 && d.served >= d.size*int64(link.MaxDownloads) {
+		return nil
+	}
+	return d
+}
+
+// countingWriter counts the bytes of the file served for a download
+type countingWriter struct {
+	http.ResponseWriter
+	s      *Server
+	d      *download
+	status int
+}
+
+// WriteHeader records the size of the file from the headers of a
+// successful response
+func (w *countingWriter) WriteHeader(status int) {
+	w.status = status
+	if size := responseSize(w.Header(), status); size >= 0 {
+		w.s.mu.Lock()
+		w.d.size = size
+		w.s.mu.Unlock()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the bytes of a successful response
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err = w.ResponseWriter.Write(p)
+	if w.status == http.StatusOK || w.status == http.StatusPartialContent {
+		w.s.mu.Lock()
+		w.d.served += int64(n)
+		w.s.mu.Unlock()
+	}
+	return n, err
+}
+
+// responseSize returns the size of the file from the headers of a
+// response with status or -1 if it isn't known
+func responseSize(header http.Header, status int) int64 {
+	var size string
+	switch status {
+	case http.StatusOK:
+		size = header.Get("Content-Length")
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-99/1234
+		_, size, _ = strings.Cut(header.Get("Content-Range"), "/")
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// Options for making signed links
+type Options struct {
+	URL          string      // URL of the server
+	Root         string      // the remote the server is serving, or "" for rclone rcd
+	Expire       fs.Duration // how long the link lasts
+	MaxDownloads int         // how many times the file may be downloaded, 0 for unlimited
+	Password     string      // password needed to download the file, "" for none
+}
+
+// withSlash returns the config string of f ready to have a path
+// appended
+func withSlash(f fs.Fs) string {
+	s := fs.ConfigString(f)
+	if strings.HasSuffix(s, ":") || strings.HasSuffix(s, "/") {
+		return s
+	}
+	return s + "/"
+}
+
+// Make returns a signed link to the file remote in f
+func Make(ctx context.Context, f fs.Fs, remote string, opt Options) (string, error) {
+	if opt.URL == "" {
+		return "", errors.New("need the URL of the server to make a signed link")
+	}
+	if _, err := f.NewObject(ctx, remote); err != nil {
+		return "", fmt.Errorf("signed links can only be made to files: %w", err)
+	}
+	var linkPath string
+	if opt.Root == "" {
+		// rclone rcd serves files as [remote:path]/file
+		linkPath = "[" + fs.ConfigString(f) + "]/" + remote
+	} else {
+		rootFs, err := cache.Get(ctx, opt.Root)
+		if err != nil && err != fs.ErrorIsFile {
+			return "", fmt.Errorf("failed to make root of server: %w", err)
+		}
+		root, full := withSlash(rootFs), withSlash(f)+remote
+		if !strings.HasPrefix(full, root) {
+			return "", fmt.Errorf("%q isn't inside the root of the server %q", full, root)
+		}
+		linkPath = full[len(root):]
+	}
+	expire := opt.Expire
+	if expire == fs.DurationOff || expire <= 0 {
+		expire = DefaultExpire
+	}
+	key, err := LoadKey()
+	if err != nil {
+		return "", err
+	}
+	params := key.Sign(Link{
+		Path:         linkPath,
+		Expires:      time.Now().Add(time.Duration(expire)),
+		MaxDownloads: opt.MaxDownloads,
+		Password:     opt.Password,
+	})
+	u := &url.URL{Path: linkPath}
+	return strings.TrimSuffix(opt.URL, "/") + "/" + u.EscapedPath() + "?" + params.Encode(), nil
+}
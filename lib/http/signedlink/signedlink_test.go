@@ -0,0 +1,197 @@
+package signedlink
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setConfigDir points the config at a temporary directory so the key
+// is made there
+func setConfigDir(t *testing.T) string {
+	dir := t.TempDir()
+	oldPath := config.GetConfigPath()
+	require.NoError(t, config.SetConfigPath(filepath.Join(dir, "rclone.conf")))
+	t.Cleanup(func() {
+		_ = config.SetConfigPath(oldPath)
+	})
+	return dir
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := setConfigDir(t)
+	key, err := LoadKey()
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+	fi, err := os.Stat(filepath.Join(dir, KeyFileName))
+	require.NoError(t, err)
+	if os.PathSeparator == '/' {
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+
+	// Loading it again gets the same key
+	key2, err := LoadKey()
+	require.NoError(t, err)
+	assert.Equal(t, key, key2)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, KeyFileName), []byte("potato"), 0600))
+	_, err = LoadKey()
+	assert.ErrorContains(t, err, "corrupted")
+}
+
+func TestSignVerify(t *testing.T) {
+	key := Key("0123456789abcdef")
+	now := time.Now()
+	link := Link{
+		Path:         "dir/file.txt",
+		Expires:      now.Add(time.Hour),
+		MaxDownloads: 3,
+	}
+	params := key.Sign(link)
+
+	got, err := key.Verify("dir/file.txt", params, now)
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.MaxDownloads)
+	assert.Equal(t, link.Expires.Unix(), got.Expires.Unix())
+
+	// Expired
+	_, err = key.Verify("dir/file.txt", params, now.Add(2*time.Hour))
+	assert.Equal(t, ErrExpired, err)
+
+	// Wrong path or key
+	_, err = key.Verify("dir/other.txt", params, now)
+	assert.Equal(t, ErrBadSignature, err)
+	_, err = Key("fedcba9876543210").Verify("dir/file.txt", params, now)
+	assert.Equal(t, ErrBadSignature, err)
+
+	// Changed parameters
+	for _, param := range []string{paramExpires, paramMax, paramSignature} {
+		changed := url.Values{}
+		for k, v := range params {
+			changed[k] = v
+		}
+		changed.Set(param, "9"+changed.Get(param))
+		_, err = key.Verify("dir/file.txt", changed, now)
+		assert.Equal(t, ErrBadSignature, err, param)
+	}
+	changed := url.Values{}
+	for k, v := range params {
+		changed[k] = v
+	}
+	changed.Del(paramMax)
+	_, err = key.Verify("dir/file.txt", changed, now)
+	assert.Equal(t, ErrBadSignature, err)
+}
+
+func TestServerCheck(t *testing.T) {
+	s := newServer(Key("0123456789abcdef"))
+	params := s.key.Sign(Link{
+		Path:         "file.txt",
+		Expires:      time.Now().Add(time.Hour),
+		MaxDownloads: 2,
+		Password:     "secret",
+	})
+	target := "http://example.com/file.txt?" + params.Encode()
+	body := strings.Repeat("x", 200)
+	check := func(method, target, password, rangeHeader string) int {
+		r := httptest.NewRequest(method, target, nil)
+		if password != "" {
+			r.SetBasicAuth("anyone", password)
+		}
+		if rangeHeader != "" {
+			r.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		if w, ok := s.Check(rec, r); ok {
+			http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(body))
+		}
+		return rec.Code
+	}
+
+	r := httptest.NewRequest("GET", target, nil)
+	assert.True(t, HasSignature(r))
+	assert.True(t, s.SkipAuth(r))
+	assert.False(t, s.SkipAuth(httptest.NewRequest("PUT", target, nil)))
+	assert.False(t, s.SkipAuth(httptest.NewRequest("GET", strings.Replace(target, "file.txt", "other.txt", 1), nil)))
+	assert.False(t, HasSignature(httptest.NewRequest("GET", "http://example.com/file.txt", nil)))
+
+	assert.Equal(t, http.StatusUnauthorized, check("GET", target, "", ""))
+	assert.Equal(t, http.StatusUnauthorized, check("GET", target, "wrong", ""))
+	assert.Equal(t, http.StatusOK, check("GET", target, "secret", ""))
+	// HEAD doesn't count as a download
+	assert.Equal(t, http.StatusOK, check("HEAD", target, "secret", ""))
+	// Several ranges are served as the whole file
+	assert.Equal(t, http.StatusOK, check("GET", target, "secret", "bytes=0-9,20-29"))
+	assert.Equal(t, http.StatusGone, check("GET", target, "secret", "bytes=100-"))
+	assert.Equal(t, http.StatusMethodNotAllowed, check("DELETE", target, "secret", ""))
+	assert.Equal(t, http.StatusForbidden, check("GET", strings.Replace(target, "file.txt", "other.txt", 1), "secret", ""))
+
+	// Ranges count the bytes served wherever they start
+	target = "http://example.com/file.txt?" + s.key.Sign(Link{
+		Path:         "file.txt",
+		Expires:      time.Now().Add(time.Hour),
+		MaxDownloads: 2,
+	}).Encode()
+	assert.Equal(t, http.StatusPartialContent, check("GET", target, "", "bytes=1-"))
+	assert.Equal(t, http.StatusPartialContent, check("GET", target, "", "bytes=100-199"))
+	assert.Equal(t, http.StatusPartialContent, check("GET", target, "", "bytes=1-"))
+	assert.Equal(t, http.StatusGone, check("GET", target, "", "bytes=1-"))
+	assert.Equal(t, http.StatusGone, check("GET", target, "", ""))
+}
+
+func TestMake(t *testing.T) {
+	setConfigDir(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "file name.txt"), []byte("hello"), 0666))
+	f, err := fs.NewFs(ctx, filepath.Join(dir, "sub"))
+	require.NoError(t, err)
+	key, err := LoadKey()
+	require.NoError(t, err)
+
+	// For rclone serve http
+	link, err := Make(ctx, f, "file name.txt", Options{
+		URL:  "http://example.com/",
+		Root: dir,
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(link, "http://example.com/sub/file%20name.txt?"), link)
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	got, err := key.Verify("sub/file name.txt", u.Query(), time.Now())
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Duration(DefaultExpire)), got.Expires, time.Minute)
+
+	// For rclone rcd
+	link, err = Make(ctx, f, "file name.txt", Options{
+		URL:    "http://example.com",
+		Expire: fs.Duration(time.Hour),
+	})
+	require.NoError(t, err)
+	u, err = url.Parse(link)
+	require.NoError(t, err)
+	got, err = key.Verify("["+fs.ConfigString(f)+"]/file name.txt", u.Query(), time.Now())
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), got.Expires, time.Minute)
+
+	// Errors
+	_, err = Make(ctx, f, "file name.txt", Options{URL: "http://example.com/", Root: filepath.Join(dir, "other")})
+	assert.ErrorContains(t, err, "isn't inside the root")
+	_, err = Make(ctx, f, "missing.txt", Options{URL: "http://example.com/"})
+	assert.ErrorContains(t, err, "only be made to files")
+	_, err = Make(ctx, f, "file name.txt", Options{})
+	assert.ErrorContains(t, err, "need the URL")
+}
@@ -5,7 +5,9 @@ import (
 	"embed"
 	"html/template"
 	"log"
+	"mime"
 	"os"
+	"path"
 	"strings"
 	"time"
 
@@ -41,6 +43,8 @@ to be used within the template to server pages:
 |-- .IsDir    | Boolean for if an entry is a directory or not. |
 |-- .Size     | Size in Bytes of the entry. |
 |-- .ModTime  | The UTC timestamp of an entry. |
+| .Writable   | Boolean for if files may be uploaded, renamed and deleted. |
+| .Thumbnails | Boolean for if thumbnails of images can be fetched with ?thumbnail. |
 
 The server also makes the following functions available so that they can be used within the
 template. These functions help extend the options for dynamic rendering of HTML. They can
@@ -52,6 +56,7 @@ be used to render HTML based on specific conditions.
 | contains    | Checks whether a given substring is present or not in a given string. |
 | hasPrefix   | Checks whether the given string begins with the specified prefix. |
 | hasSuffix   | Checks whether the given string end with the specified suffix. |
+| mimeType    | Returns the MIME type of a file name from its extension. |
 `
 
 	tmpl, err := template.New("template help").Parse(help)
@@ -97,6 +102,12 @@ func AfterEpoch(t time.Time) bool {
 	return t.After(time.Time{})
 }
 
+// MimeType returns the MIME type of the file name from its extension
+// or "" if it isn't known
+func MimeType(name string) string {
+	return mime.TypeByExtension(path.Ext(strings.TrimSuffix(name, "/")))
+}
+
 // Assets holds the embedded filesystem for the default template
 //
 //go:embed templates
@@ -120,6 +131,7 @@ func GetTemplate(tmpl string) (*template.Template, error) {
 		"contains":   strings.Contains,
 		"hasPrefix":  strings.HasPrefix,
 		"hasSuffix":  strings.HasSuffix,
+		"mimeType":   MimeType,
 	}
 
 	tpl, err := template.New("index").Funcs(funcMap).Parse(string(data))
@@ -31,12 +31,14 @@ type Pacer struct {
 	pacer      chan struct{} // To pace the operations
 	connTokens chan struct{} // Connection tokens
 	state      State
+	metrics    *Metrics
 }
 type pacerOptions struct {
 	maxConnections int         // Maximum number of concurrent connections
 	retries        int         // Max number of retries
 	calculator     Calculator  // switchable pacing algorithm - call with mu held
 	invoker        InvokerFunc // wrapper function used to invoke the target function
+	name           string      // name to label the metrics with
 }
 
 // InvokerFunc is the signature of the wrapper function used to invoke the
@@ -66,6 +68,12 @@ func InvokerOption(invoker InvokerFunc) Option {
 	return func(p *pacerOptions) { p.invoker = invoker }
 }
 
+// NameOption sets the name the new Pacer labels its metrics with,
+// usually the name of the remote it is pacing.
+func NameOption(name string) Option {
+	return func(p *pacerOptions) { p.name = name }
+}
+
 // Paced is a function which is called by the Call and CallNoRetry
 // methods.  It should return a boolean, true if it would like to be
 // retried, and an error.  This error may be returned or returned
@@ -84,6 +92,7 @@ func New(options ...Option) *Pacer {
 	p := &Pacer{
 		pacerOptions: opts,
 		pacer:        make(chan struct{}, 1),
+		metrics:      DefaultMetrics,
 	}
 	if p.calculator == nil {
 		p.SetCalculator(nil)
@@ -167,6 +176,7 @@ func (p *Pacer) beginCall() {
 		time.Sleep(t)
 		p.pacer <- struct{}{}
 	}(p.state.SleepTime)
+	p.metrics.onSleep(p.name, p.state.SleepTime)
 	p.mu.Unlock()
 }
 
@@ -193,6 +203,9 @@ func (p *Pacer) endCall(retry bool, err error) {
 func (p *Pacer) call(fn Paced, retries int) (err error) {
 	var retry bool
 	for i := 1; i <= retries; i++ {
+		if i > 1 {
+			p.metrics.onRetry(p.name)
+		}
 		p.beginCall()
 		retry, err = p.invoker(i, retries, fn)
 		p.endCall(retry, err)
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -382,3 +383,18 @@ func TestCallParallel(t *testing.T) {
 	assert.Equal(t, 5, called)
 	wait.Broadcast()
 }
+
+func TestCallMetrics(t *testing.T) {
+	m := NewMetrics("test")
+	oldMetrics := DefaultMetrics
+	DefaultMetrics = m
+	defer func() { DefaultMetrics = oldMetrics }()
+	p := New(NameOption("remote"), RetriesOption(3), CalculatorOption(NewDefault(MinSleep(1*time.Millisecond), MaxSleep(2*time.Millisecond))))
+
+	dp := &dummyPaced{retry: true}
+	err := p.Call(dp.fn)
+	assert.Equal(t, 3, dp.called)
+	assert.Equal(t, errFoo, err)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.Retries.WithLabelValues("remote")))
+	assert.Greater(t, testutil.ToFloat64(m.Sleep.WithLabelValues("remote")), 0.0)
+}
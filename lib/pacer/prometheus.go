@@ -0,0 +1,60 @@
+package pacer
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics provide Pacer level metrics.
+type Metrics struct {
+	Retries *prometheus.CounterVec
+	Sleep   *prometheus.CounterVec
+}
+
+// NewMetrics creates a new metrics instance, the instance shall be assigned to
+// DefaultMetrics before any Pacers are made.
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		Retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pacer",
+			Name:      "retries_total",
+			Help:      "Number of calls retried by the pacer of each remote",
+		}, []string{"remote"}),
+		Sleep: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pacer",
+			Name:      "sleep_seconds_total",
+			Help:      "Total time the pacer of each remote has made calls wait for",
+		}, []string{"remote"}),
+	}
+}
+
+// DefaultMetrics specifies metrics used for new Pacers.
+var DefaultMetrics = (*Metrics)(nil)
+
+// Collectors returns all prometheus metrics as collectors for registration.
+func (m *Metrics) Collectors() []prometheus.Collector {
+	if m == nil {
+		return nil
+	}
+	return []prometheus.Collector{
+		m.Retries,
+		m.Sleep,
+	}
+}
+
+func (m *Metrics) onRetry(name string) {
+	if m == nil {
+		return
+	}
+	m.Retries.WithLabelValues(name).Inc()
+}
+
+func (m *Metrics) onSleep(name string, sleep time.Duration) {
+	if m == nil || sleep <= 0 {
+		return
+	}
+	m.Sleep.WithLabelValues(name).Add(sleep.Seconds())
+}
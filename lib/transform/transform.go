@@ -0,0 +1,306 @@
+// Package transform implements the --name-transform rules which
+// rename files and directories as they are transferred.
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/text/unicode/norm"
+)
+
+// tag says which names a transform applies to
+type tag int
+
+const (
+	tagFile tag = iota // only file names - the default
+	tagDir             // only directory names
+	tagAll             // file and directory names
+)
+
+// transform is a single parsed --name-transform rule
+type transform struct {
+	tag   tag
+	name  string
+	apply func(name string) string
+}
+
+// Transforms is a list of rules which are applied in order
+type Transforms []transform
+
+// algorithm makes the function for a transform from its argument
+type algorithm struct {
+	needsValue bool
+	help       string
+	make       func(value string) (func(name string) string, error)
+}
+
+// simple makes an algorithm which doesn't take an argument
+func simple(help string, fn func(name string) string) algorithm {
+	return algorithm{
+		help: help,
+		make: func(string) (func(string) string, error) {
+			return fn, nil
+		},
+	}
+}
+
+// withValue makes an algorithm which takes a string argument
+func withValue(help string, fn func(value, name string) string) algorithm {
+	return algorithm{
+		needsValue: true,
+		help:       help,
+		make: func(value string) (func(string) string, error) {
+			return func(name string) string {
+				return fn(value, name)
+			}, nil
+		},
+	}
+}
+
+// splitExt splits name into base and extension.
+//
+// Names starting with . and with no other . have no extension.
+func splitExt(name string) (base, ext string) {
+	ext = path.Ext(name)
+	if ext == name {
+		return name, ""
+	}
+	return name[:len(name)-len(ext)], ext
+}
+
+var algorithms = map[string]algorithm{
+	"nfc":       simple("Convert to Unicode NFC (composed) form.", norm.NFC.String),
+	"nfd":       simple("Convert to Unicode NFD (decomposed) form.", norm.NFD.String),
+	"nfkc":      simple("Convert to Unicode NFKC (compatibility composed) form.", norm.NFKC.String),
+	"nfkd":      simple("Convert to Unicode NFKD (compatibility decomposed) form.", norm.NFKD.String),
+	"lowercase": simple("Convert to lower case.", strings.ToLower),
+	"uppercase": simple("Convert to upper case.", strings.ToUpper),
+	"trimextension": simple("Remove the final extension.", func(name string) string {
+		base, _ := splitExt(name)
+		return base
+	}),
+	"prefix": withValue("Add a prefix.", func(value, name string) string {
+		return value + name
+	}),
+	"suffix": withValue("Add a suffix.", func(value, name string) string {
+		return name + value
+	}),
+	"suffix_keep_extension": withValue("Add a suffix before the extension.", func(value, name string) string {
+		base, ext := splitExt(name)
+		return base + value + ext
+	}),
+	"trimprefix": withValue("Remove a prefix if present.", func(value, name string) string {
+		return strings.TrimPrefix(name, value)
+	}),
+	"trimsuffix": withValue("Remove a suffix if present.", func(value, name string) string {
+		return strings.TrimSuffix(name, value)
+	}),
+	"replace": {
+		needsValue: true,
+		help:       "Replace all occurrences of old with new - use old:new.",
+		make: func(value string) (func(string) string, error) {
+			old, replacement, found := strings.Cut(value, ":")
+			if !found || old == "" {
+				return nil, fmt.Errorf("replace needs old:new not %q", value)
+			}
+			return func(name string) string {
+				return strings.ReplaceAll(name, old, replacement)
+			}, nil
+		},
+	},
+	"regex": {
+		needsValue: true,
+		help:       "Replace matches of the regular expression with the replacement - use pattern/replacement.",
+		make: func(value string) (func(string) string, error) {
+			// Names can't contain / so the last / separates the replacement
+			i := strings.LastIndex(value, "/")
+			if i < 0 {
+				return nil, fmt.Errorf("regex needs pattern/replacement not %q", value)
+			}
+			re, err := regexp.Compile(value[:i])
+			if err != nil {
+				return nil, fmt.Errorf("bad regex: %w", err)
+			}
+			replacement := value[i+1:]
+			return func(name string) string {
+				return re.ReplaceAllString(name, replacement)
+			}, nil
+		},
+	},
+	"date": {
+		help: "Add the current date before the extension - the argument is a Go time layout, default -2006-01-02.",
+		make: func(value string) (func(string) string, error) {
+			if value == "" {
+				value = "-2006-01-02"
+			}
+			stamp := time.Now().Format(value)
+			if strings.Contains(stamp, "/") {
+				return nil, fmt.Errorf("date layout %q can't contain /", value)
+			}
+			return func(name string) string {
+				base, ext := splitExt(name)
+				return base + stamp + ext
+			}, nil
+		},
+	},
+}
+
+// Help returns a description of the possible transforms
+func Help() string {
+	var out strings.Builder
+	for _, name := range algorithmNames() {
+		alg := algorithms[name]
+		arg := ""
+		if alg.needsValue {
+			arg = "=XXX"
+		}
+		_, _ = fmt.Fprintf(&out, "| `%s%s` | %s |\n", name, arg, alg.help)
+	}
+	return out.String()
+}
+
+// algorithmNames returns the names of the algorithms in a stable
+// order
+func algorithmNames() []string {
+	return []string{
+		"nfc", "nfd", "nfkc", "nfkd",
+		"lowercase", "uppercase",
+		"prefix", "suffix", "suffix_keep_extension",
+		"trimprefix", "trimsuffix", "trimextension",
+		"replace", "regex", "date",
+	}
+}
+
+// parse a single rule in the form [file,|dir,|all,]name[=value]
+func parse(spec string) (t transform, err error) {
+	rule := spec
+	if scope, rest, found := strings.Cut(rule, ","); found {
+		switch scope {
+		case "file":
+			t.tag = tagFile
+			rule = rest
+		case "dir":
+			t.tag = tagDir
+			rule = rest
+		case "all":
+			t.tag = tagAll
+			rule = rest
+		}
+	}
+	name, value, hasValue := strings.Cut(rule, "=")
+	alg, found := algorithms[name]
+	if !found {
+		return t, fmt.Errorf("unknown name transform %q in %q", name, spec)
+	}
+	if alg.needsValue && !hasValue {
+		return t, fmt.Errorf("name transform %q needs a value in %q", name, spec)
+	}
+	t.name = name
+	t.apply, err = alg.make(value)
+	if err != nil {
+		return t, fmt.Errorf("invalid name transform %q: %w", spec, err)
+	}
+	return t, nil
+}
+
+// Parse the --name-transform rules in specs
+func Parse(specs []string) (ts Transforms, err error) {
+	for _, spec := range specs {
+		t, err := parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// Leaf transforms a single file or directory name
+func (ts Transforms) Leaf(name string, isDir bool) string {
+	for _, t := range ts {
+		switch t.tag {
+		case tagFile:
+			if isDir {
+				continue
+			}
+		case tagDir:
+			if !isDir {
+				continue
+			}
+		}
+		name = t.apply(name)
+	}
+	return name
+}
+
+// Path transforms each element of remote.
+//
+// All the elements but the last are directories. The last is a
+// directory if isDir is set.
+func (ts Transforms) Path(remote string, isDir bool) string {
+	if len(ts) == 0 || remote == "" {
+		return remote
+	}
+	elements := strings.Split(remote, "/")
+	for i, element := range elements {
+		if element == "" {
+			continue
+		}
+		elements[i] = ts.Leaf(element, isDir || i < len(elements)-1)
+	}
+	return strings.Join(elements, "/")
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = map[string]Transforms{}
+)
+
+// Get returns the parsed --name-transform rules from the config in
+// ctx.
+//
+// The rules are checked when the flags are parsed so any errors here
+// are logged and the rules ignored.
+func Get(ctx context.Context) Transforms {
+	specs := fs.GetConfig(ctx).NameTransform
+	if len(specs) == 0 {
+		return nil
+	}
+	key := strings.Join(specs, "\x00")
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	ts, found := cache[key]
+	if !found {
+		var err error
+		ts, err = Parse(specs)
+		if err != nil {
+			fs.Errorf(nil, "Ignoring --name-transform: %v", err)
+		}
+		cache[key] = ts
+	}
+	return ts
+}
+
+// Transforming returns true if there are --name-transform rules in
+// the config in ctx.
+func Transforming(ctx context.Context) bool {
+	return len(Get(ctx)) > 0
+}
+
+// Path transforms remote using the --name-transform rules in the
+// config in ctx.
+func Path(ctx context.Context, remote string, isDir bool) string {
+	return Get(ctx).Path(remote, isDir)
+}
+
+// ErrorNoTransforms is returned by commands which need
+// --name-transform when it isn't set
+var ErrorNoTransforms = errors.New("no --name-transform rules supplied")
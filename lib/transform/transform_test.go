@@ -0,0 +1,107 @@
+package transform
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"potato",
+		"file,potato",
+		"prefix",
+		"replace=nocolon",
+		"replace=:new",
+		"regex=noslash",
+		"regex=[/x",
+		"date=2006/01/02",
+	} {
+		_, err := Parse([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestLeaf(t *testing.T) {
+	for _, test := range []struct {
+		specs []string
+		in    string
+		isDir bool
+		want  string
+	}{
+		{nil, "hello.txt", false, "hello.txt"},
+		{[]string{"uppercase"}, "hello.txt", false, "HELLO.TXT"},
+		{[]string{"uppercase"}, "dir", true, "dir"},
+		{[]string{"dir,uppercase"}, "dir", true, "DIR"},
+		{[]string{"dir,uppercase"}, "hello.txt", false, "hello.txt"},
+		{[]string{"all,uppercase"}, "dir", true, "DIR"},
+		{[]string{"all,uppercase"}, "hello.txt", false, "HELLO.TXT"},
+		{[]string{"lowercase"}, "HeLLo.TXT", false, "hello.txt"},
+		{[]string{"nfc"}, "é", false, "é"},
+		{[]string{"nfd"}, "é", false, "é"},
+		{[]string{"nfkc"}, "ﬁ", false, "fi"},
+		{[]string{"nfkd"}, "½", false, "1⁄2"},
+		{[]string{"prefix=pre-"}, "hello.txt", false, "pre-hello.txt"},
+		{[]string{"suffix=.bak"}, "hello.txt", false, "hello.txt.bak"},
+		{[]string{"suffix_keep_extension=-1"}, "hello.txt", false, "hello-1.txt"},
+		{[]string{"suffix_keep_extension=-1"}, ".hidden", false, ".hidden-1"},
+		{[]string{"trimprefix=pre-"}, "pre-hello.txt", false, "hello.txt"},
+		{[]string{"trimprefix=pre-"}, "hello.txt", false, "hello.txt"},
+		{[]string{"trimsuffix=.bak"}, "hello.txt.bak", false, "hello.txt"},
+		{[]string{"trimextension"}, "hello.tar.gz", false, "hello.tar"},
+		{[]string{"trimextension"}, "hello", false, "hello"},
+		{[]string{"replace=l:L"}, "hello.txt", false, "heLLo.txt"},
+		{[]string{"replace=l:"}, "hello.txt", false, "heo.txt"},
+		{[]string{"regex=([a-z]+)\\.txt/$1.md"}, "hello.txt", false, "hello.md"},
+		{[]string{"regex=[0-9]+/#"}, "a1b22c333", false, "a#b#c#"},
+		{[]string{"date=-20060102"}, "hello.txt", false, "hello-" + time.Now().Format("20060102") + ".txt"},
+		{[]string{"prefix=a", "uppercase", "suffix=b"}, "x", false, "AXb"},
+	} {
+		ts, err := Parse(test.specs)
+		require.NoError(t, err, test.specs)
+		assert.Equal(t, test.want, ts.Leaf(test.in, test.isDir), test.specs)
+	}
+}
+
+func TestPath(t *testing.T) {
+	ts, err := Parse([]string{"all,uppercase", "file,prefix=f-", "dir,prefix=d-"})
+	require.NoError(t, err)
+	assert.Equal(t, "", ts.Path("", false))
+	assert.Equal(t, "f-FILE.TXT", ts.Path("file.txt", false))
+	assert.Equal(t, "d-DIR", ts.Path("dir", true))
+	assert.Equal(t, "d-A/d-B/f-C.TXT", ts.Path("a/b/c.txt", false))
+	assert.Equal(t, "d-A/d-B/d-C", ts.Path("a/b/c", true))
+
+	var none Transforms
+	assert.Equal(t, "a/b/c.txt", none.Path("a/b/c.txt", false))
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, Transforming(ctx))
+	assert.Equal(t, "a/b.txt", Path(ctx, "a/b.txt", false))
+
+	ctx, ci := fs.AddConfig(ctx)
+	ci.NameTransform = []string{"all,uppercase"}
+	assert.True(t, Transforming(ctx))
+	assert.Equal(t, "A/B.TXT", Path(ctx, "a/b.txt", false))
+
+	// Bad rules are ignored
+	ci.NameTransform = []string{"potato"}
+	assert.False(t, Transforming(ctx))
+}
+
+func TestHelp(t *testing.T) {
+	help := Help()
+	for _, name := range algorithmNames() {
+		_, found := algorithms[name]
+		assert.True(t, found, name)
+		assert.Contains(t, help, "`"+name)
+	}
+	assert.Equal(t, len(algorithms), len(algorithmNames()))
+}
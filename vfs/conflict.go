@@ -0,0 +1,21 @@
+package vfs
+
+import "github.com/rclone/rclone/vfs/vfscache"
+
+// Conflicts returns the write conflicts found when writing files back
+// to the remote, oldest first. There are none unless
+// --vfs-cache-mode is writes or full.
+func (vfs *VFS) Conflicts() []vfscache.Conflict {
+	if vfs.cache == nil {
+		return nil
+	}
+	return vfs.cache.Conflicts()
+}
+
+// ClearConflicts forgets the write conflicts found, returning them
+func (vfs *VFS) ClearConflicts() []vfscache.Conflict {
+	if vfs.cache == nil {
+		return nil
+	}
+	return vfs.cache.ClearConflicts()
+}
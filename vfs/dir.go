@@ -955,6 +955,7 @@ func (d *Dir) Mkdir(name string) (*Dir, error) {
 	}
 	// fs.Debugf(path, "Dir.Mkdir")
 	err = d.f.Mkdir(context.TODO(), path)
+	list.InvalidateDir(context.TODO(), d.f, path)
 	if err != nil {
 		fs.Errorf(d, "Dir.Mkdir failed to create directory: %v", err)
 		return nil, err
@@ -987,6 +988,7 @@ func (d *Dir) Remove() error {
 	}
 	// remove directory
 	err = d.f.Rmdir(context.TODO(), d.path)
+	list.InvalidateDir(context.TODO(), d.f, d.path)
 	if err != nil {
 		fs.Errorf(d, "Dir.Remove failed to remove directory: %v", err)
 		return err
@@ -12,6 +12,7 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/kv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -107,6 +108,46 @@ func TestDirForgetAll(t *testing.T) {
 	assert.True(t, root.read.IsZero())
 }
 
+func TestDirListCache(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("listing cache not supported on this OS")
+	}
+	ci := fs.GetConfig(context.Background())
+	oldListCache := ci.ListCache
+	ci.ListCache = true
+	defer func() {
+		ci.ListCache = oldListCache
+	}()
+	_, vfs, _, file1 := dirCreate(t)
+	root, err := vfs.Root()
+	require.NoError(t, err)
+
+	readDir := func() (names []string) {
+		// Forget the directory cache so the listing is read
+		// again, as it is once the directory cache expires
+		root.ForgetAll()
+		fis, err := vfs.ReadDir("dir")
+		require.NoError(t, err)
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+		return names
+	}
+	assert.Equal(t, []string{"file1"}, readDir())
+
+	// The listing cache doesn't bring back removed files or lose
+	// new directories
+	require.NoError(t, vfs.Remove(file1.Path))
+	require.NoError(t, vfs.Mkdir("dir/sub", 0777))
+	assert.Equal(t, []string{"sub"}, readDir())
+
+	require.NoError(t, vfs.Rename("dir/sub", "dir/renamed"))
+	assert.Equal(t, []string{"renamed"}, readDir())
+
+	require.NoError(t, vfs.Remove("dir/renamed"))
+	assert.Equal(t, []string(nil), readDir())
+}
+
 func TestDirForgetPath(t *testing.T) {
 	_, vfs, dir, file1 := dirCreate(t)
 
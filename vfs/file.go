@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/list"
 	"github.com/rclone/rclone/fs/log"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/vfs/vfscommon"
@@ -438,9 +439,14 @@ func (f *File) _applyPendingModTime() error {
 
 	// set the time of the object
 	err := f.o.SetModTime(context.TODO(), f.pendingModTime)
+	list.InvalidateObject(context.TODO(), f.d.f, f.o.Remote())
 	switch err {
 	case nil:
 		fs.Debugf(f.o, "Applied pending mod time %v OK", f.pendingModTime)
+		// Changing the object isn't a write conflict
+		if f.d.vfs.cache != nil {
+			f.d.vfs.cache.UpdateBase(f._path(), f.o)
+		}
 	case fs.ErrorCantSetModTime, fs.ErrorCantSetModTimeWithoutDelete:
 		// do nothing, in order to not break "touch somefile" if it exists already
 	default:
@@ -619,6 +625,7 @@ func (f *File) Remove() (err error) {
 	f.mu.Lock()   // deadlock in RWFileHandle.openPending and .close
 	if f.o != nil {
 		err = f.o.Remove(context.TODO())
+		list.InvalidateObject(context.TODO(), d.f, f.o.Remote())
 	}
 	f.mu.Unlock()
 	f.muRW.Unlock()
@@ -0,0 +1,70 @@
+package vfs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rclone/rclone/vfs/vfscache"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// ErrorPinNeedsCache is returned when trying to pin or prefetch files
+// without --vfs-cache-mode full
+var ErrorPinNeedsCache = errors.New("pinning and prefetching files needs --vfs-cache-mode full")
+
+// pinCache returns the cache if it can be used for pinning
+func (vfs *VFS) pinCache() (*vfscache.Cache, error) {
+	if vfs.Opt.CacheMode < vfscommon.CacheModeFull || vfs.cache == nil {
+		return nil, ErrorPinNeedsCache
+	}
+	return vfs.cache, nil
+}
+
+// Pin pins the paths or globs in patterns in the cache so the files
+// they match are never removed from it, and starts downloading them
+// in the background.
+func (vfs *VFS) Pin(patterns ...string) error {
+	c, err := vfs.pinCache()
+	if err != nil {
+		return err
+	}
+	return c.Pin(patterns...)
+}
+
+// Unpin removes the paths or globs in patterns from the pins
+func (vfs *VFS) Unpin(patterns ...string) error {
+	c, err := vfs.pinCache()
+	if err != nil {
+		return err
+	}
+	return c.Unpin(patterns...)
+}
+
+// Pins returns the paths and globs pinned in the cache
+func (vfs *VFS) Pins() []string {
+	c, err := vfs.pinCache()
+	if err != nil {
+		return nil
+	}
+	return c.Pins()
+}
+
+// IsPinned returns true if the file or directory at name is pinned in
+// the cache
+func (vfs *VFS) IsPinned(name string) bool {
+	c, err := vfs.pinCache()
+	if err != nil {
+		return false
+	}
+	return c.IsPinned(name)
+}
+
+// Prefetch downloads the files matched by the paths or globs in
+// patterns into the cache, or everything pinned if there are none.
+func (vfs *VFS) Prefetch(ctx context.Context, patterns ...string) (vfscache.PrefetchStats, error) {
+	c, err := vfs.pinCache()
+	if err != nil {
+		return vfscache.PrefetchStats{}, err
+	}
+	return c.Prefetch(ctx, patterns...)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/vfs/vfscache"
 )
 
 const getVFSHelp = ` 
@@ -400,13 +402,35 @@ This returns stats for the selected VFS.
     {
         // Status of the disk cache - only present if --vfs-cache-mode > off
         "diskCache": {
+            // Block store stats - only present for --vfs-cache-storage block
+            "blocks": {
+                "blockSize": 4194304,
+                "bytesUsed": 0,
+                "evictedBytes": 0,
+                "evictions": 0,
+                "openKeys": 0,
+                "path": "/home/user/.cache/rclone/vfsBlocks/4194304",
+                "shared": false
+            },
             "bytesUsed": 0,
             "erroredFiles": 0,
+            // Eviction stats - arc* are only present for --vfs-cache-eviction arc
+            "eviction": {
+                "arcFrequentGhosts": 0,
+                "arcRecentGhosts": 0,
+                "arcTarget": 0,
+                "evictedBytes": 0,
+                "evictions": 0,
+                "policy": "arc",
+                "readHits": 0,
+                "readMisses": 0
+            },
             "files": 0,
             "hashType": 1,
             "outOfSpace": false,
             "path": "/home/user/.cache/rclone/vfs/local/mnt/a",
             "pathMeta": "/home/user/.cache/rclone/vfsMeta/local/mnt/a",
+            "pins": 0,
             "uploadsInProgress": 0,
             "uploadsQueued": 0
         },
@@ -437,3 +461,215 @@ func rcStats(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 	}
 	return vfs.Stats(), nil
 }
+
+// getPins returns the paths passed in as path=... parameters
+func getPins(in rc.Params) (patterns []string, err error) {
+	for k, v := range in {
+		pattern, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("value must be string %q=%v", k, v)
+		}
+		if !strings.HasPrefix(k, "path") {
+			return nil, fmt.Errorf("unknown key %q", k)
+		}
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns, nil
+}
+
+const pinHelp = `
+Pass paths or globs in as path=pattern. Any parameter key starting
+with path will be used, e.g.
+
+    rclone rc vfs/%s path=music/favourites path2="photos/**.jpg"
+
+Paths and globs are relative to the root of the VFS and globs use the
+same syntax as the filters. A path or glob which matches a directory
+matches everything in it.
+
+This needs --vfs-cache-mode full.
+`
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vfs/pin",
+		Fn:    rcPin,
+		Title: "Pin files or directories in the VFS cache.",
+		Help: `
+This pins paths or globs in the VFS cache. Files matched by a pin are
+never removed from the cache by --vfs-cache-max-age or
+--vfs-cache-max-size and are downloaded in full in the background so
+they can be used offline. Pins are remembered when rclone is
+restarted.
+` + fmt.Sprintf(pinHelp, "pin") + `
+If no paths are passed in then it returns the current pins.
+
+It returns a list of all the pins under the key "pins".
+` + getVFSHelp,
+	})
+}
+
+func rcPin(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	vfs, err := getVFS(in)
+	if err != nil {
+		return nil, err
+	}
+	patterns, err := getPins(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) > 0 {
+		err = vfs.Pin(patterns...)
+	} else {
+		_, err = vfs.pinCache()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{
+		"pins": vfs.Pins(),
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vfs/unpin",
+		Fn:    rcUnpin,
+		Title: "Unpin files or directories in the VFS cache.",
+		Help: `
+This removes pins made with vfs/pin. The paths and globs must be
+exactly as they were pinned. The files stay in the cache until they
+are removed by the cache cleaner in the usual way.
+` + fmt.Sprintf(pinHelp, "unpin") + `
+It returns a list of the remaining pins under the key "pins".
+` + getVFSHelp,
+	})
+}
+
+func rcUnpin(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	vfs, err := getVFS(in)
+	if err != nil {
+		return nil, err
+	}
+	patterns, err := getPins(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("need at least one path to unpin")
+	}
+	err = vfs.Unpin(patterns...)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{
+		"pins": vfs.Pins(),
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vfs/prefetch",
+		Fn:    rcPrefetch,
+		Title: "Download files into the VFS cache.",
+		Help: `
+This downloads the files matched by paths or globs into the VFS cache
+in full, returning when they have all been downloaded. Unlike
+vfs/pin the files may be removed from the cache again later.
+` + fmt.Sprintf(pinHelp, "prefetch") + `
+If no paths are passed in then everything pinned is downloaded, which
+is useful to pick up new files in pinned directories.
+
+Use _async=true to run this in the background.
+
+It returns
+
+- files - the number of files found
+- bytes - the total size of the files found
+- errors - the number of files which failed to download
+` + getVFSHelp,
+	})
+}
+
+func rcPrefetch(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	vfs, err := getVFS(in)
+	if err != nil {
+		return nil, err
+	}
+	patterns, err := getPins(in)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := vfs.Prefetch(ctx, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{
+		"files":  stats.Files,
+		"bytes":  stats.Bytes,
+		"errors": stats.Errors,
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vfs/conflicts",
+		Fn:    rcConflicts,
+		Title: "Show the write conflicts found by the VFS cache.",
+		Help: `
+This returns the files which were changed on the remote after they
+were opened and before the local changes were written back. What
+happened to the local changes depends on --vfs-write-conflict.
+
+Pass clear=true to forget the conflicts after returning them.
+
+It returns a list of conflicts under the key "conflicts", oldest first,
+like this
+
+    {
+        "conflicts": [
+            {
+                "name": "dir/file.txt",
+                "time": "2024-01-02T15:04:05.123456789Z",
+                "policy": "keep-both",
+                "baseFingerprint": "11,2024-01-02 14:00:00 +0000 UTC,...",
+                "remoteFingerprint": "12,2024-01-02 15:00:00 +0000 UTC,...",
+                "conflictName": "dir/file.conflict-20240102-150405.txt"
+            }
+        ]
+    }
+
+The conflictName is only present for the keep-both policy and is where
+the local changes were uploaded to.
+
+Up to 1000 conflicts are remembered and they are stored in the cache
+directory so they are kept when rclone is restarted. This needs
+--vfs-cache-mode writes or full and a --vfs-write-conflict policy other
+than local-wins.
+` + getVFSHelp,
+	})
+}
+
+func rcConflicts(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	vfs, err := getVFS(in)
+	if err != nil {
+		return nil, err
+	}
+	clearConflicts, err := in.GetBool("clear")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	var conflicts []vfscache.Conflict
+	if clearConflicts {
+		conflicts = vfs.ClearConflicts()
+	} else {
+		conflicts = vfs.Conflicts()
+	}
+	if conflicts == nil {
+		conflicts = []vfscache.Conflict{}
+	}
+	return rc.Params{
+		"conflicts": conflicts,
+	}, nil
+}
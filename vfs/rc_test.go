@@ -2,11 +2,13 @@ package vfs
 
 import (
 	"context"
+	"os"
 	"testing"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/vfs/vfscache"
 	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -125,3 +127,83 @@ func TestRcStats(t *testing.T) {
 	assert.Equal(t, 1, out["metadataCache"].(rc.Params)["dirs"])
 	assert.Equal(t, vfs.Opt, out["opt"].(vfscommon.Options))
 }
+
+func TestRcPin(t *testing.T) {
+	r, vfs, call := rcNewRun(t, "vfs/pin")
+	ctx := context.Background()
+	file1 := r.WriteObject(ctx, "dir/file1", "file1 contents", t1)
+	r.CheckRemoteItems(t, file1)
+
+	_, err := call.Fn(ctx, rc.Params{"path": "dir"})
+	assert.Equal(t, ErrorPinNeedsCache, err)
+
+	vfs.SetCacheMode(vfscommon.CacheModeFull)
+	t.Cleanup(func() {
+		require.NoError(t, vfs.CleanUp())
+	})
+
+	_, err = call.Fn(ctx, rc.Params{"potato": "dir"})
+	assert.ErrorContains(t, err, `unknown key "potato"`)
+
+	out, err := call.Fn(ctx, rc.Params{"path": "dir", "path2": "*.txt"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"pins": []string{"*.txt", "dir"}}, out)
+	assert.True(t, vfs.IsPinned("dir/file1"))
+
+	out, err = call.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"pins": []string{"*.txt", "dir"}}, out)
+
+	prefetch := rc.Calls.Get("vfs/prefetch")
+	out, err = prefetch.Fn(ctx, rc.Params{"path": "dir/file1"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"files": 1, "bytes": int64(14), "errors": 0}, out)
+
+	unpin := rc.Calls.Get("vfs/unpin")
+	_, err = unpin.Fn(ctx, rc.Params{})
+	assert.ErrorContains(t, err, "need at least one path")
+	out, err = unpin.Fn(ctx, rc.Params{"path": "*.txt"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"pins": []string{"dir"}}, out)
+	out, err = unpin.Fn(ctx, rc.Params{"path": "dir"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"pins": []string{}}, out)
+	assert.False(t, vfs.IsPinned("dir/file1"))
+}
+
+func TestRcConflicts(t *testing.T) {
+	r, vfs, call := rcNewRun(t, "vfs/conflicts")
+	ctx := context.Background()
+	r.WriteObject(ctx, "file1", "file1 contents", t1)
+
+	out, err := call.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"conflicts": []vfscache.Conflict{}}, out)
+
+	vfs.Opt.WriteBack = 0
+	vfs.Opt.WriteConflict = vfscommon.WriteConflictKeepBoth
+	vfs.SetCacheMode(vfscommon.CacheModeWrites)
+	t.Cleanup(func() {
+		require.NoError(t, vfs.CleanUp())
+	})
+
+	// Change the remote while the file is open
+	fd, err := vfs.OpenFile("file1", os.O_WRONLY|os.O_TRUNC, 0777)
+	require.NoError(t, err)
+	_, err = fd.Write([]byte("local"))
+	require.NoError(t, err)
+	r.WriteObject(ctx, "file1", "remote changed", t2)
+	require.NoError(t, fd.Close())
+
+	out, err = call.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	conflicts := out["conflicts"].([]vfscache.Conflict)
+	require.Equal(t, 1, len(conflicts))
+	assert.Equal(t, "file1", conflicts[0].Name)
+	assert.Equal(t, "keep-both", conflicts[0].Policy)
+
+	out, err = call.Fn(ctx, rc.Params{"clear": true})
+	require.NoError(t, err)
+	assert.Equal(t, conflicts, out["conflicts"])
+	assert.Equal(t, 0, len(vfs.Conflicts()))
+}
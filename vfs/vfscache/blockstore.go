@@ -0,0 +1,709 @@
+package vfscache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/lib/ranges"
+)
+
+// With --vfs-cache-storage block the data of clean files downloaded
+// from the remote is stored in fixed size blocks in a block store
+// rather than in a sparse file per item. The block store is in
+// <cache-dir>/vfsBlocks/<block-size> and is shared between all the
+// caches using the same cache directory.
+//
+// The blocks of an object are stored under a key. If the remote can
+// quickly make a collision resistant hash the key is made from the
+// hash so identical content is only stored once, otherwise it is made
+// from the remote, the path and the fingerprint so mounts of the same
+// remote share blocks. Weak hashes like MD5 aren't used as a crafted
+// collision would let one file serve the blocks of another.
+//
+// Each block is a file named after its index in a directory for the
+// key. Blocks which are being downloaded have a ".part" suffix and
+// are renamed when complete. Blocks are removed least recently used
+// first so parts of big files can be removed from the cache.
+//
+// Items are moved out of the block store into a cache file of their
+// own when they are modified.
+
+// blockPartSuffix is added to the names of incomplete blocks
+const blockPartSuffix = ".part"
+
+// maxOpenBlocks is the number of complete blocks a blockFile keeps open
+const maxOpenBlocks = 16
+
+// errBlockMissing is returned when a block has been removed from the
+// block store while it was in use
+var errBlockMissing = errors.New("vfs cache: block missing from block store")
+
+// blockStore stores blocks of data keyed by object
+type blockStore struct {
+	root      string // directory the blocks are stored in
+	blockSize int64  // size of each block
+	shared    bool   // set if other processes use the store at the same time
+
+	mu           sync.Mutex
+	refs         map[string]int // number of open blockFiles for each key
+	used         int64          // bytes used by the blocks
+	evicted      int64          // number of blocks removed
+	evictedBytes int64          // bytes of blocks removed
+}
+
+// newBlockStore makes a block store in parentOSPath with blocks of
+// blockSize. If shared is set then file locks are used so other
+// processes can use it at the same time.
+func newBlockStore(parentOSPath string, blockSize int64, shared bool) (*blockStore, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("vfs cache: block size must be greater than 0, got %v", fs.SizeSuffix(blockSize))
+	}
+	root := file.UNCPath(filepath.Join(parentOSPath, "vfsBlocks", strconv.FormatInt(blockSize, 10)))
+	err := createDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create block store directory: %w", err)
+	}
+	s := &blockStore{
+		root:      root,
+		blockSize: blockSize,
+		shared:    shared,
+		refs:      make(map[string]int),
+	}
+	_, s.used = s._scan()
+	fs.Debugf(nil, "vfs cache: block store is %q using %v", root, fs.SizeSuffix(s.used))
+	return s, nil
+}
+
+// blockKeyHashes are the hashes trusted to identify content in the
+// block store
+var blockKeyHashes = hash.NewHashSet(hash.SHA256, hash.Whirlpool)
+
+// blockKey returns the key the blocks of o with fingerprint are
+// stored under
+func blockKey(ctx context.Context, o fs.Object, fingerprint string) string {
+	h := sha256.New()
+	var name, root string
+	if f := o.Fs(); f != nil {
+		if !f.Features().SlowHash {
+			if ht := f.Hashes().Overlap(blockKeyHashes).GetOne(); ht != hash.None {
+				sum, err := o.Hash(ctx, ht)
+				if err == nil && sum != "" {
+					_, _ = fmt.Fprintf(h, "hash\x00%v\x00%s\x00%d", ht, sum, o.Size())
+					return hex.EncodeToString(h.Sum(nil))
+				}
+			}
+		}
+		name, root = f.Name(), f.Root()
+	}
+	_, _ = fmt.Fprintf(h, "object\x00%s\x00%s\x00%s", name, path.Join(root, o.Remote()), fingerprint)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// keyDir returns the directory the blocks for key are stored in
+func (s *blockStore) keyDir(key string) string {
+	return filepath.Join(s.root, key[:2], key)
+}
+
+// blockPath returns the path of block i of key
+func (s *blockStore) blockPath(key string, i int64) string {
+	return filepath.Join(s.keyDir(key), strconv.FormatInt(i, 10))
+}
+
+// blockRange returns the range block i covers in a file of size
+func (s *blockStore) blockRange(i int64, size int64) ranges.Range {
+	r := ranges.Range{Pos: i * s.blockSize, Size: s.blockSize}
+	r.Clip(size)
+	return r
+}
+
+// present returns the ranges of a file of size stored under key
+// which are in complete blocks
+func (s *blockStore) present(key string, size int64) (rs ranges.Ranges) {
+	entries, err := os.ReadDir(s.keyDir(key))
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		i, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil || i < 0 {
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		r := s.blockRange(i, size)
+		if !r.IsEmpty() && fi.Size() == r.Size {
+			rs.Insert(r)
+		}
+	}
+	return rs
+}
+
+// open returns a blockFile to read and write the blocks of a file of
+// size stored under key
+func (s *blockStore) open(key string, size int64) *blockFile {
+	s.mu.Lock()
+	s.refs[key]++
+	s.mu.Unlock()
+	keyLock := s.lockKey(key)
+	return &blockFile{
+		s:         s,
+		key:       key,
+		keyLock:   keyLock,
+		size:      size,
+		rs:        s.present(key, size),
+		files:     make(map[int64]*os.File),
+		parts:     make(map[int64]bool),
+		partLocks: make(map[int64]*fileLock),
+		touched:   make(map[int64]struct{}),
+	}
+}
+
+// release is called when a blockFile using key is closed
+func (s *blockStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs[key]--
+	if s.refs[key] <= 0 {
+		delete(s.refs, key)
+	}
+}
+
+// addUsed adds size to the bytes used
+func (s *blockStore) addUsed(size int64) {
+	s.mu.Lock()
+	s.used += size
+	s.mu.Unlock()
+}
+
+// usage returns the bytes used by the blocks
+func (s *blockStore) usage() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// blockEntry is a block found on disk
+type blockEntry struct {
+	path    string
+	key     string
+	size    int64
+	modTime time.Time
+	lock    bool // set if this is the lock file for the key
+}
+
+// _scan reads all the blocks in the store
+//
+// call with mu held or before the store is in use
+func (s *blockStore) _scan() (entries []blockEntry, used int64) {
+	err := filepath.Walk(s.root, func(osPath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		e := blockEntry{
+			path:    osPath,
+			key:     filepath.Base(filepath.Dir(osPath)),
+			size:    fi.Size(),
+			modTime: fi.ModTime(),
+			lock:    fi.Name() == keyLockName,
+		}
+		entries = append(entries, e)
+		if !e.lock {
+			used += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		fs.Errorf(nil, "vfs cache: failed to read block store: %v", err)
+	}
+	return entries, used
+}
+
+// purge removes blocks not used since cutoff (if it isn't zero) then
+// the least recently used blocks until excess bytes have been freed.
+//
+// Blocks which are open or have keys in keep are not removed. If the
+// store is shared blocks open in other processes are not removed
+// either and nothing is removed if another process is purging. It
+// returns the number of bytes freed.
+func (s *blockStore) purge(cutoff time.Time, excess int64, keep map[string]struct{}) (freed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shared {
+		purgeLock := newFileLock(s.purgeLockPath())
+		locked, err := purgeLock.TryLock()
+		if err != nil || !locked {
+			fs.Debugf(nil, "vfs cache: not purging block store as another process is")
+			return 0
+		}
+		defer func() {
+			_ = purgeLock.Unlock()
+		}()
+	}
+	entries, used := s._scan()
+	dirs := make(map[string]struct{})
+	keyLocks := make(map[string]*fileLock)
+	// canRemove returns true if the blocks of key can be removed
+	canRemove := func(key string) bool {
+		if _, found := keep[key]; found || s.refs[key] > 0 {
+			return false
+		}
+		if !s.shared {
+			return true
+		}
+		lock, found := keyLocks[key]
+		if !found {
+			// nil if in use in another process
+			lock = s.tryLockKeyExclusive(key)
+			keyLocks[key] = lock
+		}
+		return lock != nil
+	}
+	remove := func(e *blockEntry) {
+		err := os.Remove(e.path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fs.Errorf(nil, "vfs cache: failed to remove block: %v", err)
+			}
+			return
+		}
+		freed += e.size
+		s.evicted++
+		s.evictedBytes += e.size
+		dirs[filepath.Dir(e.path)] = struct{}{}
+	}
+	var candidates []blockEntry
+	for i := range entries {
+		e := &entries[i]
+		if e.lock {
+			// Tidy up keys which only have a lock file
+			dirs[filepath.Dir(e.path)] = struct{}{}
+			continue
+		}
+		if !cutoff.IsZero() && e.modTime.Before(cutoff) {
+			if canRemove(e.key) {
+				remove(e)
+			}
+		} else {
+			candidates = append(candidates, *e)
+		}
+	}
+	if freed < excess {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].modTime.Before(candidates[j].modTime)
+		})
+		for i := range candidates {
+			if freed >= excess {
+				break
+			}
+			if canRemove(candidates[i].key) {
+				remove(&candidates[i])
+			}
+		}
+	}
+	// Remove the directories of keys with no blocks left
+	for dir := range dirs {
+		key := filepath.Base(dir)
+		if s.shared && canRemove(key) {
+			lockPath := s.keyLockPath(key)
+			if entries, err := os.ReadDir(dir); err == nil && len(entries) == 1 && entries[0].Name() == keyLockName {
+				_ = os.Remove(lockPath)
+			}
+		}
+		if os.Remove(dir) == nil {
+			_ = os.Remove(filepath.Dir(dir))
+		}
+	}
+	for _, lock := range keyLocks {
+		if lock != nil {
+			_ = lock.Unlock()
+		}
+	}
+	s.used = used - freed
+	if freed > 0 {
+		fs.Infof(nil, "vfs cache: removed %v of blocks from the block store", fs.SizeSuffix(freed))
+	}
+	return freed
+}
+
+// stats returns info about the block store
+func (s *blockStore) stats() rc.Params {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return rc.Params{
+		"path":         s.root,
+		"blockSize":    s.blockSize,
+		"shared":       s.shared,
+		"bytesUsed":    s.used,
+		"openKeys":     len(s.refs),
+		"evictions":    s.evicted,
+		"evictedBytes": s.evictedBytes,
+	}
+}
+
+// blockFile reads and writes the blocks of one file in the store
+//
+// It is used instead of an *os.File for items stored in blocks.
+type blockFile struct {
+	s         *blockStore
+	key       string
+	keyLock   *fileLock // lock showing the key is in use if shared
+	mu        sync.Mutex
+	size      int64               // size of the file
+	rs        ranges.Ranges       // ranges written or in complete blocks
+	files     map[int64]*os.File  // open blocks
+	parts     map[int64]bool      // set if the open block is incomplete
+	partLocks map[int64]*fileLock // locks on incomplete blocks being downloaded if shared
+	touched   map[int64]struct{}  // blocks which have been marked as used
+	closed    bool
+}
+
+// check interface
+var _ cacheFile = (*blockFile)(nil)
+
+// blockRange returns the range block i covers
+func (bf *blockFile) blockRange(i int64) ranges.Range {
+	return bf.s.blockRange(i, bf.size)
+}
+
+// present returns a copy of the ranges of the file available
+func (bf *blockFile) present() ranges.Ranges {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	return append(ranges.Ranges(nil), bf.rs...)
+}
+
+// reload forgets everything except the complete blocks in the store,
+// returning the ranges of the file available.
+//
+// This is used if blocks have been removed by another process.
+func (bf *blockFile) reload() ranges.Ranges {
+	bf.mu.Lock()
+	bf._closeFiles(false)
+	bf.rs = bf.s.present(bf.key, bf.size)
+	bf.mu.Unlock()
+	return bf.present()
+}
+
+// _closeFiles closes the open blocks, except the incomplete ones if
+// keepParts is set
+//
+// call with mu held
+func (bf *blockFile) _closeFiles(keepParts bool) (err error) {
+	for i, fd := range bf.files {
+		if keepParts && bf.parts[i] {
+			continue
+		}
+		closeErr := fd.Close()
+		if closeErr != nil {
+			err = closeErr
+		}
+		delete(bf.files, i)
+		delete(bf.parts, i)
+		bf._unlockPart(i)
+	}
+	return err
+}
+
+// _unlockPart releases the lock on incomplete block i if held
+//
+// call with mu held
+func (bf *blockFile) _unlockPart(i int64) {
+	if lock := bf.partLocks[i]; lock != nil {
+		_ = lock.Unlock()
+		delete(bf.partLocks, i)
+	}
+}
+
+// _readFile returns an open file for block i to read from
+//
+// call with mu held
+func (bf *blockFile) _readFile(i int64) (*os.File, error) {
+	if fd := bf.files[i]; fd != nil {
+		return fd, nil
+	}
+	blockPath := bf.s.blockPath(bf.key, i)
+	fd, err := os.Open(blockPath)
+	if os.IsNotExist(err) {
+		return nil, errBlockMissing
+	} else if err != nil {
+		return nil, fmt.Errorf("vfs cache: failed to open block: %w", err)
+	}
+	if _, found := bf.touched[i]; !found {
+		// Mark the block as recently used
+		now := time.Now()
+		_ = os.Chtimes(blockPath, now, now)
+		bf.touched[i] = struct{}{}
+	}
+	if len(bf.files) >= maxOpenBlocks {
+		_ = bf._closeFiles(true)
+	}
+	bf.files[i] = fd
+	return fd, nil
+}
+
+// _writeFile returns an open file for block i to write to or nil if
+// the block is already complete
+//
+// call with mu held
+func (bf *blockFile) _writeFile(i int64) (*os.File, error) {
+	if fd := bf.files[i]; fd != nil {
+		if !bf.parts[i] {
+			return nil, nil
+		}
+		return fd, nil
+	}
+	blockPath := bf.s.blockPath(bf.key, i)
+	if bf.s.blockComplete(bf.key, i, bf.size) {
+		// Another user of the key has completed the block
+		return nil, nil
+	}
+	err := createDir(filepath.Dir(blockPath))
+	if err != nil {
+		return nil, fmt.Errorf("vfs cache: failed to create block directory: %w", err)
+	}
+	fd, err := file.OpenFile(blockPath+blockPartSuffix, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("vfs cache: failed to open block: %w", err)
+	}
+	// If somebody else is downloading the block too it doesn't
+	// matter as the data is the same
+	if lock := bf.s.lockPart(blockPath + blockPartSuffix); lock != nil {
+		bf.partLocks[i] = lock
+	}
+	bf.files[i] = fd
+	bf.parts[i] = true
+	bf.touched[i] = struct{}{}
+	return fd, nil
+}
+
+// _finishBlock makes block i complete if it has been written
+//
+// call with mu held
+func (bf *blockFile) _finishBlock(i int64) error {
+	fd := bf.files[i]
+	if fd == nil || !bf.parts[i] {
+		return nil
+	}
+	delete(bf.files, i)
+	delete(bf.parts, i)
+	// Unlock first as the file can't be renamed while locked on some OSes
+	bf._unlockPart(i)
+	err := fd.Close()
+	if err != nil {
+		return fmt.Errorf("vfs cache: failed to close block: %w", err)
+	}
+	blockPath := bf.s.blockPath(bf.key, i)
+	err = os.Rename(blockPath+blockPartSuffix, blockPath)
+	if err != nil {
+		if _, statErr := os.Stat(blockPath); statErr == nil {
+			// Another user of the key got there first
+			_ = os.Remove(blockPath + blockPartSuffix)
+			return nil
+		}
+		return fmt.Errorf("vfs cache: failed to complete block: %w", err)
+	}
+	bf.s.addUsed(bf.blockRange(i).Size)
+	return nil
+}
+
+// ReadAt reads len(b) bytes from the file at off
+//
+// It returns errBlockMissing if the data isn't in the store.
+func (bf *blockFile) ReadAt(b []byte, off int64) (n int, err error) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	if bf.closed {
+		return 0, os.ErrClosed
+	}
+	if off >= bf.size {
+		return 0, io.EOF
+	}
+	eof := false
+	if end := off + int64(len(b)); end > bf.size {
+		b = b[:bf.size-off]
+		eof = true
+	}
+	for len(b) > 0 {
+		i := off / bf.s.blockSize
+		r := bf.blockRange(i)
+		chunk := r.End() - off
+		if chunk > int64(len(b)) {
+			chunk = int64(len(b))
+		}
+		fd, err := bf._readFile(i)
+		if err != nil {
+			return n, err
+		}
+		nn, err := fd.ReadAt(b[:chunk], off-r.Pos)
+		n += nn
+		if int64(nn) != chunk {
+			if err == nil || err == io.EOF {
+				err = errBlockMissing
+			}
+			return n, err
+		}
+		off += chunk
+		b = b[chunk:]
+	}
+	if eof {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt writes b to the file at off
+//
+// Blocks which are complete are made available to other users of the
+// store.
+func (bf *blockFile) WriteAt(b []byte, off int64) (n int, err error) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	if bf.closed {
+		return 0, os.ErrClosed
+	}
+	if off < 0 || off+int64(len(b)) > bf.size {
+		return 0, fmt.Errorf("vfs cache: write outside block file: offset=%d, size=%d, file size=%d", off, len(b), bf.size)
+	}
+	for len(b) > 0 {
+		i := off / bf.s.blockSize
+		r := bf.blockRange(i)
+		chunk := r.End() - off
+		if chunk > int64(len(b)) {
+			chunk = int64(len(b))
+		}
+		fd, err := bf._writeFile(i)
+		if err != nil {
+			return n, err
+		}
+		if fd != nil {
+			nn, err := fd.WriteAt(b[:chunk], off-r.Pos)
+			if err != nil {
+				return n + nn, err
+			}
+		}
+		bf.rs.Insert(ranges.Range{Pos: off, Size: chunk})
+		if bf.rs.Present(r) {
+			err = bf._finishBlock(i)
+			if err != nil {
+				return n, err
+			}
+		}
+		n += int(chunk)
+		off += chunk
+		b = b[chunk:]
+	}
+	return n, nil
+}
+
+// copyTo copies the data in rs into w returning the ranges which were
+// copied. Ranges which are missing from the store are skipped.
+func (bf *blockFile) copyTo(w io.WriterAt, rs ranges.Ranges) (copied ranges.Ranges, err error) {
+	buf := make([]byte, bf.s.blockSize)
+	for _, r := range rs {
+		for off := r.Pos; off < r.End(); {
+			chunk := bf.blockRange(off/bf.s.blockSize).End() - off
+			if chunk > r.End()-off {
+				chunk = r.End() - off
+			}
+			n, err := bf.ReadAt(buf[:chunk], off)
+			if errors.Is(err, errBlockMissing) {
+				off += chunk
+				continue
+			} else if err != nil && err != io.EOF {
+				return copied, err
+			}
+			_, err = w.WriteAt(buf[:n], off)
+			if err != nil {
+				return copied, err
+			}
+			copied.Insert(ranges.Range{Pos: off, Size: int64(n)})
+			off += chunk
+		}
+	}
+	return copied, nil
+}
+
+// Truncate sets the size of the file
+func (bf *blockFile) Truncate(size int64) error {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	bf.size = size
+	bf.rs = bf.rs.Intersection(ranges.Range{Pos: 0, Size: size})
+	return nil
+}
+
+// Stat returns info about the file
+func (bf *blockFile) Stat() (os.FileInfo, error) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	return blockFileInfo{name: bf.key, size: bf.size}, nil
+}
+
+// Sync commits the incomplete blocks to disk
+func (bf *blockFile) Sync() (err error) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	for i, fd := range bf.files {
+		if bf.parts[i] {
+			syncErr := fd.Sync()
+			if syncErr != nil {
+				err = syncErr
+			}
+		}
+	}
+	return err
+}
+
+// Close the blocks. Incomplete blocks are left in the store and
+// removed by the cache cleaner.
+func (bf *blockFile) Close() error {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	if bf.closed {
+		return os.ErrClosed
+	}
+	bf.closed = true
+	err := bf._closeFiles(false)
+	if bf.keyLock != nil {
+		_ = bf.keyLock.Unlock()
+	}
+	bf.s.release(bf.key)
+	return err
+}
+
+// blockFileInfo describes an item stored in blocks
+type blockFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi blockFileInfo) Name() string       { return fi.name }
+func (fi blockFileInfo) Size() int64        { return fi.size }
+func (fi blockFileInfo) Mode() os.FileMode  { return 0600 }
+func (fi blockFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi blockFileInfo) IsDir() bool        { return false }
+func (fi blockFileInfo) Sys() interface{}   { return nil }
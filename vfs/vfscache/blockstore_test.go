@@ -0,0 +1,252 @@
+package vfscache
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/rclone/rclone/lib/ranges"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBlockKey = "0123456789abcdef"
+
+func TestBlockFile(t *testing.T) {
+	s, err := newBlockStore(t.TempDir(), 4, false)
+	require.NoError(t, err)
+
+	bf := s.open(testBlockKey, 10)
+	assert.Equal(t, ranges.Ranges(nil), bf.present())
+
+	// Partial blocks are written to .part files
+	n, err := bf.WriteAt([]byte("234"), 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assertPathExist(t, s.blockPath(testBlockKey, 0)+blockPartSuffix)
+	assertPathNotExist(t, s.blockPath(testBlockKey, 0))
+	assert.Equal(t, ranges.Ranges(nil), s.present(testBlockKey, 10))
+
+	// Completed blocks are renamed
+	n, err = bf.WriteAt([]byte("01"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = bf.WriteAt([]byte("5678"), 5)
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assertPathNotExist(t, s.blockPath(testBlockKey, 0)+blockPartSuffix)
+	assertPathExist(t, s.blockPath(testBlockKey, 0))
+	assertPathExist(t, s.blockPath(testBlockKey, 1))
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 8}}, s.present(testBlockKey, 10))
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 9}}, bf.present())
+	assert.Equal(t, int64(8), s.usage())
+
+	// Can't write off the end
+	_, err = bf.WriteAt([]byte("abc"), 9)
+	assert.Error(t, err)
+
+	// The short last block
+	_, err = bf.WriteAt([]byte("9"), 9)
+	require.NoError(t, err)
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 10}}, s.present(testBlockKey, 10))
+
+	// Read across blocks and off the end
+	buf := make([]byte, 6)
+	n, err = bf.ReadAt(buf, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "345678", string(buf[:n]))
+	n, err = bf.ReadAt(buf, 7)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "789", string(buf[:n]))
+	_, err = bf.ReadAt(buf, 10)
+	assert.Equal(t, io.EOF, err)
+
+	fi, err := bf.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), fi.Size())
+
+	// Another file with the same key shares the blocks
+	bf2 := s.open(testBlockKey, 10)
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 10}}, bf2.present())
+	n, err = bf2.WriteAt([]byte("XXXX"), 4)
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	n, err = bf2.ReadAt(buf[:4], 4)
+	require.NoError(t, err)
+	assert.Equal(t, "4567", string(buf[:n]))
+
+	// Copy out the data
+	out, err := os.Create(t.TempDir() + "/out")
+	require.NoError(t, err)
+	copied, err := bf2.copyTo(out, ranges.Ranges{{Pos: 1, Size: 8}})
+	require.NoError(t, err)
+	assert.Equal(t, ranges.Ranges{{Pos: 1, Size: 8}}, copied)
+	require.NoError(t, out.Close())
+	data, err := os.ReadFile(out.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "\x0012345678", string(data))
+
+	// Missing blocks are detected and skipped when copying
+	require.NoError(t, bf2.Close())
+	assert.Error(t, bf2.Close())
+	require.NoError(t, os.Remove(s.blockPath(testBlockKey, 1)))
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 4}, {Pos: 8, Size: 2}}, bf.reload())
+	_, err = bf.ReadAt(buf[:4], 4)
+	assert.Equal(t, errBlockMissing, err)
+	out, err = os.Create(out.Name())
+	require.NoError(t, err)
+	copied, err = bf.copyTo(out, ranges.Ranges{{Pos: 0, Size: 10}})
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 4}, {Pos: 8, Size: 2}}, copied)
+
+	require.NoError(t, bf.Close())
+	assert.Equal(t, 0, len(s.refs))
+}
+
+func TestBlockKey(t *testing.T) {
+	ctx := context.Background()
+	f, err := mockfs.NewFs(ctx, "mock", "root", nil)
+	require.NoError(t, err)
+	newObject := func(remote string) fs.Object {
+		o := mockobject.New(remote).WithContent([]byte("contents"), mockobject.SeekModeNone)
+		o.SetFs(f)
+		return o
+	}
+	a, b := newObject("a"), newObject("b")
+
+	// Weak hashes aren't used to share blocks between objects
+	f.(*mockfs.Fs).SetHashes(hash.NewHashSet(hash.MD5, hash.SHA1))
+	assert.NotEqual(t, blockKey(ctx, a, "fp"), blockKey(ctx, b, "fp"))
+	assert.NotEqual(t, blockKey(ctx, a, "fp"), blockKey(ctx, a, "fp2"))
+
+	// Strong ones are
+	f.(*mockfs.Fs).SetHashes(hash.NewHashSet(hash.MD5, hash.SHA256))
+	assert.Equal(t, blockKey(ctx, a, "fp"), blockKey(ctx, b, "fp2"))
+}
+
+func TestBlockStorePurge(t *testing.T) {
+	s, err := newBlockStore(t.TempDir(), 4, false)
+	require.NoError(t, err)
+	const otherKey = "fedcba9876543210"
+
+	write := func(key string, size int64, age time.Duration) {
+		bf := s.open(key, size)
+		_, err := bf.WriteAt(make([]byte, size), 0)
+		require.NoError(t, err)
+		require.NoError(t, bf.Close())
+		for i := int64(0); i*s.blockSize < size; i++ {
+			when := time.Now().Add(-age - time.Duration(i)*time.Second)
+			require.NoError(t, os.Chtimes(s.blockPath(key, i), when, when))
+		}
+	}
+	write(testBlockKey, 12, time.Hour)
+	write(otherKey, 8, time.Minute)
+	assert.Equal(t, int64(20), s.usage())
+
+	// Remove old blocks
+	freed := s.purge(time.Now().Add(-30*time.Minute), 0, nil)
+	assert.Equal(t, int64(12), freed)
+	assert.Equal(t, int64(8), s.usage())
+	assertPathNotExist(t, s.keyDir(testBlockKey))
+
+	// Blocks in use are kept
+	bf := s.open(otherKey, 8)
+	assert.Equal(t, int64(0), s.purge(time.Time{}, 8, nil))
+	require.NoError(t, bf.Close())
+	assert.Equal(t, int64(0), s.purge(time.Time{}, 8, map[string]struct{}{otherKey: {}}))
+
+	// Remove part of a file least recently used block first
+	assert.Equal(t, int64(4), s.purge(time.Time{}, 1, nil))
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 4}}, s.present(otherKey, 8))
+	assert.Equal(t, int64(4), s.usage())
+
+	stats := s.stats()
+	assert.Equal(t, int64(4), stats["evictions"])
+	assert.Equal(t, int64(16), stats["evictedBytes"])
+}
+
+func TestCacheBlockStorage(t *testing.T) {
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	defer func() {
+		require.NoError(t, config.SetCacheDir(oldCacheDir))
+	}()
+	opt := vfscommon.DefaultOpt
+	opt.CachePollInterval = 0
+	opt.WriteBack = 0
+	opt.CacheStorage = vfscommon.CacheStorageBlock
+	opt.CacheBlockSize = 4
+	r, c := newTestCacheOpt(t, opt)
+	require.NotNil(t, c.blocks)
+
+	contents, obj, item := newFileLength(t, r, c, "existing", 10)
+	require.NoError(t, item.Open(obj))
+	buf := make([]byte, 5)
+	n, err := item.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, contents[:5], string(buf[:n]))
+
+	// Stored in blocks not a cache file
+	key := item.info.Block
+	assert.NotEqual(t, "", key)
+	assertPathNotExist(t, c.toOSPath("existing"))
+	assert.True(t, item.Exists())
+	assert.Equal(t, int64(0), item.getDiskSize())
+	require.NoError(t, item.Close(nil))
+	assert.True(t, item.present())
+	assert.Equal(t, int64(10), c.blocks.usage())
+	assert.Equal(t, int64(10), c.updateUsed())
+	size, err := item.GetSize()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), size)
+
+	// Reloads from the metadata
+	item2 := newItem(c, "existing")
+	assert.Equal(t, key, item2.info.Block)
+	require.NoError(t, item2.Open(obj))
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 10}}, item2.info.Rs)
+
+	// Partial eviction of the blocks not in use, oldest first
+	for i := int64(0); i < 3; i++ {
+		when := time.Now().Add(time.Duration(i-10) * time.Second)
+		require.NoError(t, os.Chtimes(c.blocks.blockPath(key, i), when, when))
+	}
+	c.mu.Lock()
+	c.item["existing"] = item2
+	c.mu.Unlock()
+	c.opt.CacheMaxSize = 4
+	c.purgeOverQuota()
+	assert.Equal(t, int64(10), c.blocks.usage())
+	require.NoError(t, item2.Close(nil))
+	c.purgeOverQuota()
+	c.opt.CacheMaxSize = 0
+	assert.Equal(t, int64(2), c.blocks.usage())
+	assert.Equal(t, ranges.Ranges{{Pos: 8, Size: 2}}, c.blocks.present(key, 10))
+
+	// Writing moves the item into a cache file
+	item3 := c.Item("existing")
+	require.NoError(t, item3.Open(obj))
+	n, err = item3.WriteAt([]byte("HELLO"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "", item3.info.Block)
+	assertPathExist(t, c.toOSPath("existing"))
+	n, err = item3.ReadAt(buf, 5)
+	require.NoError(t, err)
+	assert.Equal(t, contents[5:10], string(buf[:n]))
+	require.NoError(t, item3.Close(nil))
+	checkObject(t, r, "existing", "HELLO"+contents[5:])
+
+	stats := c.Stats()
+	assert.Equal(t, int64(4), stats["blocks"].(rc.Params)["blockSize"])
+}
@@ -9,9 +9,9 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
-	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	sysdnotify "github.com/iguanesolutions/go-systemd/v5/notify"
@@ -41,16 +41,28 @@ import (
 // Cache opened files
 type Cache struct {
 	// read only - no locking needed to read these
-	fremote    fs.Fs                // fs for the remote we are caching
-	fcache     fs.Fs                // fs for the cache directory
-	fcacheMeta fs.Fs                // fs for the cache metadata directory
-	opt        *vfscommon.Options   // vfs Options
-	root       string               // root of the cache directory
-	metaRoot   string               // root of the cache metadata directory
-	hashType   hash.Type            // hash to use locally and remotely
-	hashOption *fs.HashesOption     // corresponding OpenOption
-	writeback  *writeback.WriteBack // holds Items for writeback
-	avFn       AddVirtualFn         // if set, can be called to add dir entries
+	fremote       fs.Fs                // fs for the remote we are caching
+	fcache        fs.Fs                // fs for the cache directory
+	fcacheMeta    fs.Fs                // fs for the cache metadata directory
+	opt           *vfscommon.Options   // vfs Options
+	root          string               // root of the cache directory
+	metaRoot      string               // root of the cache metadata directory
+	hashType      hash.Type            // hash to use locally and remotely
+	hashOption    *fs.HashesOption     // corresponding OpenOption
+	writeback     *writeback.WriteBack // holds Items for writeback
+	avFn          AddVirtualFn         // if set, can be called to add dir entries
+	metrics       *Metrics             // metrics to update, may be nil
+	pinsPath      string               // file the pins are stored in
+	conflictsPath string               // file the write conflicts are stored in
+	ctx           context.Context      // context the cache was started with
+	prefetchMu    sync.Mutex           // held while prefetching
+	evictor       evictor              // eviction policy in use
+	readHits      atomic.Int64         // number of reads already in the cache
+	readMisses    atomic.Int64         // number of reads which needed downloading
+	blocks        *blockStore          // block store if using block storage, otherwise nil
+
+	conflictsMu sync.Mutex // protects conflicts
+	conflicts   []Conflict // write conflicts found, oldest first
 
 	mu            sync.Mutex       // protects the following variables
 	cond          sync.Cond        // cond lock for synchronous cache cleaning
@@ -61,6 +73,9 @@ type Cache struct {
 	cleanerKicked bool             // some thread kicked the cleaner upon out of space
 	kickerMu      sync.Mutex       // mutex for cleanerKicked
 	kick          chan struct{}    // channel for kicking clear to start
+	pins          []pin            // paths and globs never removed from the cache
+	evictions     int64            // number of items removed by the cache cleaner
+	evictedBytes  int64            // space freed by the cache cleaner
 
 }
 
@@ -98,9 +113,20 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 	relativeDirPath = fremote.Name() + "/" + relativeDirPath
 	relativeDirOSPath := toOSPath(relativeDirPath)
 
+	// If sharing the cache directory use a private slot in it for
+	// everything except the block store
+	privateOSPath, privatePath := parentOSPath, parentPath
+	if opt.CacheShared {
+		if privateOSPath, err = lockSharedSlot(ctx, parentOSPath, relativeDirOSPath); err != nil {
+			return nil, err
+		}
+		privatePath = fromOSPath(privateOSPath)
+		fs.Debugf(nil, "vfs cache: using shared cache slot %q", privateOSPath)
+	}
+
 	// Create cache root dirs
 	var dataOSPath, metaOSPath string
-	if dataOSPath, metaOSPath, err = createRootDirs(parentOSPath, relativeDirOSPath); err != nil {
+	if dataOSPath, metaOSPath, err = createRootDirs(privateOSPath, relativeDirOSPath); err != nil {
 		return nil, err
 	}
 	fs.Debugf(nil, "vfs cache: data root is %q", dataOSPath)
@@ -108,27 +134,50 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 
 	// Get (create) cache backends
 	var fdata, fmeta fs.Fs
-	if fdata, fmeta, err = getBackends(ctx, parentPath, relativeDirPath); err != nil {
+	if fdata, fmeta, err = getBackends(ctx, privatePath, relativeDirPath); err != nil {
 		return nil, err
 	}
 	hashType, hashOption := operations.CommonHash(ctx, fdata, fremote)
 
 	// Create the cache object
 	c := &Cache{
-		fremote:    fremote,
-		fcache:     fdata,
-		fcacheMeta: fmeta,
-		opt:        opt,
-		root:       dataOSPath,
-		metaRoot:   metaOSPath,
-		item:       make(map[string]*Item),
-		errItems:   make(map[string]error),
-		hashType:   hashType,
-		hashOption: hashOption,
-		writeback:  writeback.New(ctx, opt),
-		avFn:       avFn,
+		fremote:       fremote,
+		fcache:        fdata,
+		fcacheMeta:    fmeta,
+		opt:           opt,
+		root:          dataOSPath,
+		metaRoot:      metaOSPath,
+		item:          make(map[string]*Item),
+		errItems:      make(map[string]error),
+		hashType:      hashType,
+		hashOption:    hashOption,
+		writeback:     writeback.New(ctx, opt),
+		avFn:          avFn,
+		metrics:       DefaultMetrics,
+		pinsPath:      pinsPath(parentOSPath, relativeDirOSPath),
+		conflictsPath: conflictsPath(privateOSPath, relativeDirOSPath),
+		evictor:       newEvictor(opt.CacheEviction, int64(opt.CacheMaxSize)),
+		ctx:           ctx,
+	}
+
+	// open the block store before the items are loaded - a shared
+	// cache always uses it
+	if opt.CacheStorage == vfscommon.CacheStorageBlock || opt.CacheShared {
+		c.blocks, err = newBlockStore(parentOSPath, int64(opt.CacheBlockSize), opt.CacheShared)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// load the pins so they are respected from the start
+	err = c._loadPins()
+	if err != nil {
+		return nil, err
 	}
 
+	// load the write conflicts found before
+	c.loadConflicts()
+
 	// load in the cache and metadata off disk
 	err = c.reload(ctx)
 	if err != nil {
@@ -143,6 +192,10 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 	c.cond = sync.Cond{L: &c.mu}
 
 	go c.cleaner(ctx)
+	c.metrics.add(ctx, c)
+
+	// Make sure everything pinned is downloaded
+	c.prefetchBackground(append([]pin(nil), c.pins...))
 
 	return c, nil
 }
@@ -166,6 +219,21 @@ func (c *Cache) Stats() (out rc.Params) {
 	out["erroredFiles"] = len(c.errItems)
 	out["bytesUsed"] = c.used
 	out["outOfSpace"] = c.outOfSpace
+	out["pins"] = len(c.pins)
+
+	eviction := rc.Params{
+		"policy":       c.opt.CacheEviction.String(),
+		"evictions":    c.evictions,
+		"evictedBytes": c.evictedBytes,
+		"readHits":     c.readHits.Load(),
+		"readMisses":   c.readMisses.Load(),
+	}
+	c.evictor.stats(eviction)
+	out["eviction"] = eviction
+
+	if c.blocks != nil {
+		out["blocks"] = c.blocks.stats()
+	}
 
 	return out
 }
@@ -483,14 +551,26 @@ func (c *Cache) SetModTime(name string, modTime time.Time) {
 	item.setModTime(modTime)
 }
 
-// CleanUp empties the cache of everything
+// CleanUp empties the cache of everything including the pins and
+// write conflicts
 func (c *Cache) CleanUp() error {
 	err1 := os.RemoveAll(c.root)
 	err2 := os.RemoveAll(c.metaRoot)
+	err3 := os.Remove(c.pinsPath)
+	err4 := os.Remove(c.conflictsPath)
 	if err1 != nil {
 		return err1
 	}
-	return err2
+	if err2 != nil {
+		return err2
+	}
+	if err3 != nil && !os.IsNotExist(err3) {
+		return err3
+	}
+	if err4 != nil && !os.IsNotExist(err4) {
+		return err4
+	}
+	return nil
 }
 
 // walk walks the cache calling the function
@@ -570,12 +650,19 @@ func (c *Cache) KickCleaner() {
 
 // removeNotInUse removes items not in use with a possible maxAge cutoff
 // called with cache mutex locked and up-to-date c.used (as we update it directly here)
+//
+// Pinned items are never removed.
 func (c *Cache) removeNotInUse(item *Item, maxAge time.Duration, emptyOnly bool) {
+	if c._isPinned(item.name) {
+		return
+	}
+	e := item.evictEntry()
 	removed, spaceFreed := item.RemoveNotInUse(maxAge, emptyOnly)
 	// The item space might be freed even if we get an error after the cache file is removed
 	// The item will not be removed or reset the cache data is dirty (DataDirty)
 	c.used -= spaceFreed
 	if removed {
+		c._noteEviction(e, spaceFreed)
 		fs.Infof(nil, "vfs cache RemoveNotInUse (maxAge=%d, emptyOnly=%v): item %s was removed, freed %d bytes", maxAge, emptyOnly, item.GetName(), spaceFreed)
 		// Remove the entry
 		delete(c.item, item.name)
@@ -584,6 +671,22 @@ func (c *Cache) removeNotInUse(item *Item, maxAge time.Duration, emptyOnly bool)
 	}
 }
 
+// _blockKeysInUse returns the block store keys of the items which are
+// open or pinned so their blocks aren't removed
+//
+// call with mu held
+func (c *Cache) _blockKeysInUse() map[string]struct{} {
+	keys := make(map[string]struct{})
+	for name, item := range c.item {
+		item.mu.Lock()
+		if item.info.Block != "" && (item.opens != 0 || c._isPinned(name)) {
+			keys[item.info.Block] = struct{}{}
+		}
+		item.mu.Unlock()
+	}
+	return keys
+}
+
 // Retry failed resets during purgeClean()
 func (c *Cache) retryFailedResets() {
 	// Some items may have failed to reset because there was not enough space
@@ -619,24 +722,28 @@ func (c *Cache) purgeClean() {
 
 	var items Items
 
-	// Make a slice of clean cache files
+	// Make a slice of clean cache files which aren't pinned
 	for _, item := range c.item {
-		if !item.IsDirty() {
+		if !item.IsDirty() && !c._isPinned(item.name) {
 			items = append(items, item)
 		}
 	}
 
-	sort.Sort(items)
+	items = c.sortItems(items)
 
 	// Reset items until the quota is OK
 	for _, item := range items {
 		if c.quotasOK() {
 			break
 		}
+		e := item.evictEntry()
 		resetResult, spaceFreed, err := item.Reset()
 		// The item space might be freed even if we get an error after the cache file is removed
 		// The item will not be removed or reset if the cache data is dirty (DataDirty)
 		c.used -= spaceFreed
+		if resetResult == RemovedNotInUse || (resetResult == ResetComplete && spaceFreed > 0) {
+			c._noteEviction(e, spaceFreed)
+		}
 		fs.Infof(nil, "vfs cache purgeClean item.Reset %s: %s, freed %d bytes", item.GetName(), resetResult.String(), spaceFreed)
 		if resetResult == RemovedNotInUse {
 			delete(c.item, item.name)
@@ -663,6 +770,9 @@ func (c *Cache) purgeOld(maxAge time.Duration) {
 	for _, item := range c.item {
 		c.removeNotInUse(item, maxAge, false)
 	}
+	if c.blocks != nil {
+		c.used -= c.blocks.purge(time.Now().Add(-maxAge), 0, c._blockKeysInUse())
+	}
 	if c.quotasOK() {
 		c.outOfSpace = false
 		c.cond.Broadcast()
@@ -691,6 +801,9 @@ func (c *Cache) updateUsed() (used int64) {
 	for _, item := range c.item {
 		newUsed += item.getDiskSize()
 	}
+	if c.blocks != nil {
+		newUsed += c.blocks.usage()
+	}
 	c.used = newUsed
 	return newUsed
 }
@@ -754,12 +867,17 @@ func (c *Cache) purgeOverQuota() {
 		}
 	}
 
-	sort.Sort(items)
+	items = c.sortItems(items)
 
 	// Remove items until the quota is OK
 	for _, item := range items {
 		c.removeNotInUse(item, 0, c.quotasOK())
 	}
+
+	// Then remove the least recently used blocks
+	if c.blocks != nil && !c.quotasOK() && c.opt.CacheMaxSize > 0 {
+		c.used -= c.blocks.purge(time.Time{}, c.used-int64(c.opt.CacheMaxSize), c._blockKeysInUse())
+	}
 	if c.quotasOK() {
 		c.outOfSpace = false
 		c.cond.Broadcast()
@@ -0,0 +1,264 @@
+package vfscache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// The fingerprint of the remote object is recorded in the item
+// metadata when the item is opened without local changes. When the
+// local changes are written back the remote is checked, and if it
+// has been changed in the meantime the --vfs-write-conflict policy is
+// applied.
+//
+// The check costs a NewObject call and a fingerprint (which may need
+// a hash of the remote object) for each write back, so it isn't done
+// with the default policy local-wins which overwrites the remote
+// whatever happened to it.
+//
+// The conflicts found are stored in a file in the cache directory so
+// they last over restarts.
+
+// maxConflicts is the number of conflicts the cache remembers
+const maxConflicts = 1000
+
+// Conflict records a file which was changed on the remote after it
+// was opened and before the local changes were written back
+type Conflict struct {
+	Name              string    `json:"name"`                   // name of the file in the VFS
+	Time              time.Time `json:"time"`                   // when the conflict was found
+	Policy            string    `json:"policy"`                 // the --vfs-write-conflict policy applied
+	BaseFingerprint   string    `json:"baseFingerprint"`        // fingerprint of the remote when opened
+	RemoteFingerprint string    `json:"remoteFingerprint"`      // fingerprint of the remote when written back
+	ConflictName      string    `json:"conflictName,omitempty"` // where the local changes were uploaded with keep-both
+}
+
+// conflictName returns the name to upload the local changes to name
+// to with suffix if there is a conflict at t
+//
+// The suffix goes before the extension so the file type is kept.
+func conflictName(name string, suffix string, t time.Time) string {
+	ext := path.Ext(name)
+	if ext == path.Base(name) {
+		// dot files have no extension
+		ext = ""
+	}
+	return fmt.Sprintf("%s.%s-%s%s", name[:len(name)-len(ext)], suffix, t.Format("20060102-150405"), ext)
+}
+
+// conflictsPath returns the path of the file the write conflicts are
+// stored in
+func conflictsPath(parentOSPath string, relativeDirOSPath string) string {
+	return file.UNCPath(filepath.Join(parentOSPath, "vfsConflicts", relativeDirOSPath) + ".json")
+}
+
+// detectConflicts returns true if write conflicts should be looked for
+func (c *Cache) detectConflicts() bool {
+	return c.opt.WriteConflict != vfscommon.WriteConflictLocalWins
+}
+
+// loadConflicts reads the write conflicts from disk
+//
+// call before the cache is started
+func (c *Cache) loadConflicts() {
+	data, err := os.ReadFile(c.conflictsPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &c.conflicts)
+	}
+	if err != nil {
+		fs.Errorf(nil, "vfs cache: ignoring write conflicts file %q: %v", c.conflictsPath, err)
+		c.conflicts = nil
+	}
+}
+
+// _saveConflicts writes the write conflicts to disk, removing the
+// file if there are none
+//
+// call with conflictsMu held
+func (c *Cache) _saveConflicts() {
+	err := func() error {
+		if len(c.conflicts) == 0 {
+			err := os.Remove(c.conflictsPath)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}
+		data, err := json.MarshalIndent(c.conflicts, "", "\t")
+		if err != nil {
+			return err
+		}
+		err = createDir(filepath.Dir(c.conflictsPath))
+		if err != nil {
+			return err
+		}
+		tmpPath := c.conflictsPath + ".tmp"
+		err = os.WriteFile(tmpPath, data, 0600)
+		if err != nil {
+			return err
+		}
+		return os.Rename(tmpPath, c.conflictsPath)
+	}()
+	if err != nil {
+		fs.Errorf(nil, "vfs cache: failed to save write conflicts: %v", err)
+	}
+}
+
+// addConflict records conflict
+func (c *Cache) addConflict(conflict Conflict) {
+	c.conflictsMu.Lock()
+	defer c.conflictsMu.Unlock()
+	c.conflicts = append(c.conflicts, conflict)
+	if len(c.conflicts) > maxConflicts {
+		c.conflicts = append(c.conflicts[:0], c.conflicts[len(c.conflicts)-maxConflicts:]...)
+	}
+	c._saveConflicts()
+}
+
+// Conflicts returns the write conflicts found, oldest first
+func (c *Cache) Conflicts() []Conflict {
+	c.conflictsMu.Lock()
+	defer c.conflictsMu.Unlock()
+	return append([]Conflict{}, c.conflicts...)
+}
+
+// ClearConflicts forgets the write conflicts found, returning them
+func (c *Cache) ClearConflicts() []Conflict {
+	c.conflictsMu.Lock()
+	defer c.conflictsMu.Unlock()
+	conflicts := c.conflicts
+	c.conflicts = nil
+	c._saveConflicts()
+	return conflicts
+}
+
+// UpdateBase should be called when the VFS changes the remote object o
+// of the file name itself, for example by setting its modification
+// time, so the change isn't seen as a write conflict.
+func (c *Cache) UpdateBase(name string, o fs.Object) {
+	name = clean(name)
+	c.mu.Lock()
+	item := c.item[name]
+	c.mu.Unlock()
+	if item != nil {
+		item.updateBase(o)
+	}
+}
+
+// _setBase records fingerprint as the fingerprint of the remote
+// object the local changes are based on
+//
+// call with lock held
+func (item *Item) _setBase(fingerprint string) {
+	item.info.BaseFingerprint = &fingerprint
+}
+
+// updateBase records the fingerprint of o as the base of the item if
+// one is known
+func (item *Item) updateBase(o fs.Object) {
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	if item.info.BaseFingerprint != nil && item.c.detectConflicts() {
+		item._setBase(fs.Fingerprint(context.TODO(), o, item.c.opt.FastFingerprint))
+	}
+}
+
+// _resolveConflict checks whether the remote object has changed since
+// the local changes were started and applies the conflict policy if
+// so.
+//
+// It returns the name the local changes should be uploaded to, or ""
+// if they should be discarded, and the current remote object (which
+// may be nil).
+//
+// call with lock held - it is released while checking the remote
+func (item *Item) _resolveConflict(ctx context.Context) (remote string, current fs.Object, err error) {
+	remote = item.name
+	if item.info.BaseFingerprint == nil || !item.c.detectConflicts() {
+		// Metadata from before the base was recorded or
+		// local changes always win
+		return remote, item.o, nil
+	}
+	base := *item.info.BaseFingerprint
+	item.mu.Unlock()
+	current, err = item.c.fremote.NewObject(ctx, remote)
+	item.mu.Lock()
+	if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorIsDir) {
+		current, err = nil, nil
+	} else if err != nil {
+		return "", nil, fmt.Errorf("vfs cache: failed to check remote for write conflict: %w", err)
+	}
+	currentFingerprint := ""
+	if current != nil {
+		currentFingerprint = fs.Fingerprint(ctx, current, item.c.opt.FastFingerprint)
+	}
+	if currentFingerprint == base {
+		return remote, item.o, nil
+	}
+	conflict := Conflict{
+		Name:              remote,
+		Time:              time.Now(),
+		Policy:            item.c.opt.WriteConflict.String(),
+		BaseFingerprint:   base,
+		RemoteFingerprint: currentFingerprint,
+	}
+	switch item.c.opt.WriteConflict {
+	case vfscommon.WriteConflictRemoteWins:
+		fs.Logf(remote, "vfs cache: write conflict: remote changed since opened - discarding local changes")
+		remote = ""
+	case vfscommon.WriteConflictKeepBoth:
+		conflict.ConflictName = conflictName(remote, item.c.opt.ConflictSuffix, conflict.Time)
+		fs.Logf(remote, "vfs cache: write conflict: remote changed since opened - uploading local changes to %q", conflict.ConflictName)
+		remote = conflict.ConflictName
+	}
+	item.c.addConflict(conflict)
+	return remote, current, nil
+}
+
+// _discard forgets the data of the item so the remote object o (which
+// may be nil) is read instead
+//
+// call with lock held
+func (item *Item) _discard(o fs.Object) {
+	item.o = o
+	item.info.Rs = nil
+	item.info.Fingerprint = ""
+	if o != nil {
+		item.info.Fingerprint = fs.Fingerprint(context.TODO(), o, item.c.opt.FastFingerprint)
+	}
+	item._setBase(item.info.Fingerprint)
+
+	// The downloaders are for the old object
+	if downloaders := item.downloaders; downloaders != nil {
+		item.downloaders = nil
+		item.mu.Unlock()
+		_ = downloaders.Close(nil)
+		item.mu.Lock()
+	}
+
+	if item.fd == nil {
+		item._removeFile("local changes discarded")
+	} else {
+		size := int64(0)
+		if o != nil {
+			size = o.Size()
+		}
+		err := item._truncate(size)
+		if err != nil {
+			fs.Errorf(item.name, "vfs cache: failed to discard local changes: %v", err)
+		}
+	}
+}
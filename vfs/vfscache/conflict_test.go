@@ -0,0 +1,151 @@
+package vfscache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConflictName(t *testing.T) {
+	when := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"file.txt", "file.conflict-20240102-150405.txt"},
+		{"dir/file.tar.gz", "dir/file.tar.conflict-20240102-150405.gz"},
+		{"dir/file", "dir/file.conflict-20240102-150405"},
+		{"dir/.bashrc", "dir/.bashrc.conflict-20240102-150405"},
+	} {
+		assert.Equal(t, test.want, conflictName(test.in, "conflict", when), test.in)
+	}
+}
+
+func newConflictTestCache(t *testing.T, policy vfscommon.WriteConflict) (r *fstest.Run, c *Cache) {
+	opt := vfscommon.DefaultOpt
+	opt.CachePollInterval = 0
+	opt.WriteBack = 0
+	opt.WriteConflict = policy
+	return newTestCacheOpt(t, opt)
+}
+
+// writeConflict writes to existing then changes it on the remote
+// before closing it
+func writeConflict(t *testing.T, r *fstest.Run, c *Cache) (contents string) {
+	contents, obj, item := newFileLength(t, r, c, "existing", 10)
+	require.NoError(t, item.Open(obj))
+	// Read it all so the local changes don't depend on the remote
+	buf := make([]byte, 10)
+	_, err := item.ReadAt(buf, 0)
+	require.NoError(t, err)
+	n, err := item.WriteAt([]byte("HELLO"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	r.WriteObject(context.Background(), "existing", "remote changed", time.Now().Add(time.Minute))
+	require.NoError(t, item.Close(nil))
+	return contents
+}
+
+func TestItemWriteConflictNone(t *testing.T) {
+	r, c := newConflictTestCache(t, vfscommon.WriteConflictRemoteWins)
+
+	contents, obj, item := newFileLength(t, r, c, "existing", 10)
+	require.NoError(t, item.Open(obj))
+	_, err := item.WriteAt([]byte("HELLO"), 0)
+	require.NoError(t, err)
+
+	// The VFS changing the object itself isn't a conflict
+	when := time.Now().Add(-time.Hour)
+	require.NoError(t, obj.SetModTime(context.Background(), when))
+	c.UpdateBase("existing", obj)
+	require.NoError(t, item.Close(nil))
+	checkObject(t, r, "existing", "HELLO"+contents[5:])
+
+	// New files aren't a conflict either
+	item, _ = c.get("new")
+	require.NoError(t, item.Open(nil))
+	_, err = item.WriteAt([]byte("NEW"), 0)
+	require.NoError(t, err)
+	require.NoError(t, item.Close(nil))
+	checkObject(t, r, "new", "NEW")
+
+	// Written back files are the new base
+	require.NoError(t, item.Open(item.o))
+	_, err = item.WriteAt([]byte("OLD"), 0)
+	require.NoError(t, err)
+	require.NoError(t, item.Close(nil))
+	checkObject(t, r, "new", "OLD")
+
+	assert.Equal(t, 0, len(c.Conflicts()))
+}
+
+func TestItemWriteConflictLocalWins(t *testing.T) {
+	r, c := newConflictTestCache(t, vfscommon.WriteConflictLocalWins)
+
+	// The remote isn't checked so the local changes overwrite it
+	contents := writeConflict(t, r, c)
+	checkObject(t, r, "existing", "HELLO"+contents[5:])
+	assert.Equal(t, 0, len(c.Conflicts()))
+}
+
+func TestItemWriteConflictRemoteWins(t *testing.T) {
+	r, c := newConflictTestCache(t, vfscommon.WriteConflictRemoteWins)
+
+	_ = writeConflict(t, r, c)
+	checkObject(t, r, "existing", "remote changed")
+
+	// The cache reads the remote version
+	item := c.Item("existing")
+	assert.False(t, item.IsDirty())
+	require.NoError(t, item.Open(item.o))
+	buf := make([]byte, 14)
+	n, err := item.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "remote changed", string(buf[:n]))
+	require.NoError(t, item.Close(nil))
+
+	conflicts := c.ClearConflicts()
+	require.Equal(t, 1, len(conflicts))
+	assert.Equal(t, "remote-wins", conflicts[0].Policy)
+	assert.Equal(t, 0, len(c.Conflicts()))
+}
+
+func TestItemWriteConflictKeepBoth(t *testing.T) {
+	r, c := newConflictTestCache(t, vfscommon.WriteConflictKeepBoth)
+
+	contents := writeConflict(t, r, c)
+	checkObject(t, r, "existing", "remote changed")
+
+	conflicts := c.Conflicts()
+	require.Equal(t, 1, len(conflicts))
+	assert.Equal(t, "keep-both", conflicts[0].Policy)
+	assert.Equal(t, conflictName("existing", "conflict", conflicts[0].Time), conflicts[0].ConflictName)
+	checkObject(t, r, conflicts[0].ConflictName, "HELLO"+contents[5:])
+}
+
+func TestCacheConflictsPersist(t *testing.T) {
+	r, c := newConflictTestCache(t, vfscommon.WriteConflictRemoteWins)
+
+	_ = writeConflict(t, r, c)
+	require.Equal(t, 1, len(c.Conflicts()))
+	assertPathExist(t, c.conflictsPath)
+
+	// A new cache finds the conflicts
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c2, err := New(ctx, r.Fremote, c.opt, addVirtual)
+	require.NoError(t, err)
+	conflicts := c2.Conflicts()
+	require.Equal(t, 1, len(conflicts))
+	assert.Equal(t, "existing", conflicts[0].Name)
+	assert.Equal(t, "remote-wins", conflicts[0].Policy)
+
+	// Clearing them removes the file
+	_ = c2.ClearConflicts()
+	assertPathNotExist(t, c.conflictsPath)
+}
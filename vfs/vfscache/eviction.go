@@ -0,0 +1,283 @@
+package vfscache
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// The eviction policies choose the order the cache cleaner removes
+// items in when the cache is over quota.
+//
+// NB the policies have their own locks which must be taken after
+// Cache.mu and Item.mu. They must not call Cache or Item methods.
+
+// evictEntry is a snapshot of the info about an item the eviction
+// policies need so they can sort without holding the item locks
+type evictEntry struct {
+	item  *Item
+	name  string
+	aTime time.Time
+	hits  int64
+	size  int64
+}
+
+// evictor orders items for removal from the cache
+type evictor interface {
+	// order sorts entries into the order they should be removed in
+	order(entries []evictEntry)
+
+	// accessed is called when the item name is opened
+	accessed(name string)
+
+	// evicted is called when the item e has been removed
+	evicted(e evictEntry)
+
+	// stats adds any policy specific stats to out
+	stats(out rc.Params)
+}
+
+// newEvictor returns the evictor for the policy with the cache size
+// in bytes or <= 0 if unknown
+func newEvictor(policy vfscommon.CacheEviction, maxSize int64) evictor {
+	switch policy {
+	case vfscommon.CacheEvictionLFU:
+		return lfuEvictor{}
+	case vfscommon.CacheEvictionARC:
+		return newARCEvictor(maxSize)
+	case vfscommon.CacheEvictionLargestFirst:
+		return largestFirstEvictor{}
+	}
+	return lruEvictor{}
+}
+
+// sortItems returns the items in the order they should be removed
+// using the cache's eviction policy
+//
+// call with c.mu held
+func (c *Cache) sortItems(items Items) Items {
+	entries := make([]evictEntry, len(items))
+	for i, item := range items {
+		entries[i] = item.evictEntry()
+	}
+	c.evictor.order(entries)
+	for i := range entries {
+		items[i] = entries[i].item
+	}
+	return items
+}
+
+// noteEviction records that e has been removed from the cache
+//
+// call with c.mu held
+func (c *Cache) _noteEviction(e evictEntry, spaceFreed int64) {
+	c.evictions++
+	c.evictedBytes += spaceFreed
+	c.evictor.evicted(e)
+}
+
+// older returns true if a was used before b
+func older(a, b *evictEntry) bool {
+	return a.aTime.Before(b.aTime)
+}
+
+// lruEvictor removes the least recently used items first
+type lruEvictor struct{}
+
+func (lruEvictor) order(entries []evictEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return older(&entries[i], &entries[j])
+	})
+}
+
+func (lruEvictor) accessed(name string) {}
+func (lruEvictor) evicted(e evictEntry) {}
+func (lruEvictor) stats(out rc.Params)  {}
+
+// lfuEvictor removes the least frequently used items first, the
+// least recently used first if they have been used as often
+type lfuEvictor struct{}
+
+func (lfuEvictor) order(entries []evictEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].hits != entries[j].hits {
+			return entries[i].hits < entries[j].hits
+		}
+		return older(&entries[i], &entries[j])
+	})
+}
+
+func (lfuEvictor) accessed(name string) {}
+func (lfuEvictor) evicted(e evictEntry) {}
+func (lfuEvictor) stats(out rc.Params)  {}
+
+// largestFirstEvictor removes the items using the most space first,
+// the least recently used first if they are the same size
+type largestFirstEvictor struct{}
+
+func (largestFirstEvictor) order(entries []evictEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].size != entries[j].size {
+			return entries[i].size > entries[j].size
+		}
+		return older(&entries[i], &entries[j])
+	})
+}
+
+func (largestFirstEvictor) accessed(name string) {}
+func (largestFirstEvictor) evicted(e evictEntry) {}
+func (largestFirstEvictor) stats(out rc.Params)  {}
+
+// maxGhosts is the maximum number of removed items each of the ARC
+// ghost lists remembers
+const maxGhosts = 1024
+
+// arcEvictor is an adaptive replacement cache policy.
+//
+// Items used once are "recent" and items used more than once are
+// "frequent". The policy keeps a target for the bytes used by the
+// recent items and removes the least recently used recent items
+// while they are over the target, otherwise the least recently used
+// frequent items.
+//
+// It remembers the names of removed items in two ghost lists. If a
+// recent item is used again after being removed the target is
+// increased, and if a frequent one is the target is decreased, so the
+// cache adapts to the way it is being used.
+type arcEvictor struct {
+	mu       sync.Mutex
+	maxSize  int64                    // size of the cache or <= 0 if unknown
+	target   int64                    // target bytes for the recent items
+	recent   *list.List               // ghosts of removed recent items, newest at the front
+	frequent *list.List               // ghosts of removed frequent items, newest at the front
+	ghosts   map[string]*list.Element // ghosts by name
+}
+
+// arcGhost is a removed item remembered by the arcEvictor
+type arcGhost struct {
+	name     string
+	size     int64
+	frequent bool
+}
+
+// newARCEvictor makes a new arcEvictor for a cache of maxSize bytes
+func newARCEvictor(maxSize int64) *arcEvictor {
+	return &arcEvictor{
+		maxSize:  maxSize,
+		target:   maxSize / 2,
+		recent:   list.New(),
+		frequent: list.New(),
+		ghosts:   make(map[string]*list.Element),
+	}
+}
+
+// isRecent returns true if e has only been used once
+func isRecent(e *evictEntry) bool {
+	return e.hits <= 1
+}
+
+func (a *arcEvictor) order(entries []evictEntry) {
+	a.mu.Lock()
+	target := a.target
+	a.mu.Unlock()
+	var recent, frequent []evictEntry
+	var recentSize int64
+	for _, e := range entries {
+		if isRecent(&e) {
+			recent = append(recent, e)
+			recentSize += e.size
+		} else {
+			frequent = append(frequent, e)
+		}
+	}
+	lruEvictor{}.order(recent)
+	lruEvictor{}.order(frequent)
+	entries = entries[:0]
+	for len(recent) > 0 || len(frequent) > 0 {
+		if len(recent) > 0 && (recentSize > target || len(frequent) == 0) {
+			recentSize -= recent[0].size
+			entries = append(entries, recent[0])
+			recent = recent[1:]
+		} else {
+			entries = append(entries, frequent[0])
+			frequent = frequent[1:]
+		}
+	}
+}
+
+// accessed adapts the target if name was removed recently
+func (a *arcEvictor) accessed(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	el := a.ghosts[name]
+	if el == nil {
+		return
+	}
+	ghost := el.Value.(*arcGhost)
+	if ghost.frequent {
+		// Removed a frequent item too soon so favour them
+		delta := ghost.size * ratio(a.recent.Len(), a.frequent.Len())
+		a.target -= delta
+		if a.target < 0 {
+			a.target = 0
+		}
+		a.frequent.Remove(el)
+	} else {
+		// Removed a recent item too soon so favour them
+		delta := ghost.size * ratio(a.frequent.Len(), a.recent.Len())
+		a.target += delta
+		if a.maxSize > 0 && a.target > a.maxSize {
+			a.target = a.maxSize
+		}
+		a.recent.Remove(el)
+	}
+	delete(a.ghosts, name)
+}
+
+// ratio returns a/b rounded down but at least 1
+func ratio(a, b int) int64 {
+	if b == 0 || a <= b {
+		return 1
+	}
+	return int64(a / b)
+}
+
+// evicted remembers e in the ghost lists
+func (a *arcEvictor) evicted(e evictEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if el := a.ghosts[e.name]; el != nil {
+		if el.Value.(*arcGhost).frequent {
+			a.frequent.Remove(el)
+		} else {
+			a.recent.Remove(el)
+		}
+	}
+	ghost := &arcGhost{
+		name:     e.name,
+		size:     e.size,
+		frequent: !isRecent(&e),
+	}
+	ghosts := a.recent
+	if ghost.frequent {
+		ghosts = a.frequent
+	}
+	a.ghosts[e.name] = ghosts.PushFront(ghost)
+	if ghosts.Len() > maxGhosts {
+		oldest := ghosts.Back()
+		delete(a.ghosts, oldest.Value.(*arcGhost).name)
+		ghosts.Remove(oldest)
+	}
+}
+
+func (a *arcEvictor) stats(out rc.Params) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out["arcTarget"] = a.target
+	out["arcRecentGhosts"] = a.recent.Len()
+	out["arcFrequentGhosts"] = a.frequent.Len()
+}
@@ -0,0 +1,111 @@
+package vfscache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// make test entries for the eviction policies
+func testEvictEntries() []evictEntry {
+	now := time.Now()
+	return []evictEntry{
+		{name: "big-old-once", aTime: now.Add(-4 * time.Hour), hits: 1, size: 1000},
+		{name: "small-new-often", aTime: now.Add(-1 * time.Hour), hits: 10, size: 10},
+		{name: "small-old-often", aTime: now.Add(-3 * time.Hour), hits: 5, size: 10},
+		{name: "mid-new-once", aTime: now.Add(-2 * time.Hour), hits: 1, size: 100},
+	}
+}
+
+func evictNames(entries []evictEntry) (names []string) {
+	for _, e := range entries {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+func TestEvictorOrder(t *testing.T) {
+	for _, test := range []struct {
+		policy vfscommon.CacheEviction
+		want   []string
+	}{
+		{vfscommon.CacheEvictionLRU, []string{"big-old-once", "small-old-often", "mid-new-once", "small-new-often"}},
+		{vfscommon.CacheEvictionLFU, []string{"big-old-once", "mid-new-once", "small-old-often", "small-new-often"}},
+		{vfscommon.CacheEvictionLargestFirst, []string{"big-old-once", "mid-new-once", "small-old-often", "small-new-often"}},
+		// target is 500 so the recent items are removed while over it
+		{vfscommon.CacheEvictionARC, []string{"big-old-once", "small-old-often", "small-new-often", "mid-new-once"}},
+	} {
+		entries := testEvictEntries()
+		newEvictor(test.policy, 1000).order(entries)
+		assert.Equal(t, test.want, evictNames(entries), test.policy.String())
+	}
+}
+
+func TestEvictorARC(t *testing.T) {
+	a := newARCEvictor(1000)
+	out := rc.Params{}
+	a.stats(out)
+	assert.Equal(t, rc.Params{"arcTarget": int64(500), "arcRecentGhosts": 0, "arcFrequentGhosts": 0}, out)
+
+	// Removing recent items then using them again increases the target
+	a.evicted(evictEntry{name: "a", hits: 1, size: 100})
+	a.evicted(evictEntry{name: "b", hits: 3, size: 50})
+	a.evicted(evictEntry{name: "c", hits: 3, size: 50})
+	a.accessed("a")
+	assert.Equal(t, int64(700), a.target) // 500 + 100 * 2 frequent / 1 recent ghosts
+	a.accessed("a")
+	assert.Equal(t, int64(700), a.target)
+
+	// Using frequent ghosts again decreases it
+	a.accessed("b")
+	assert.Equal(t, int64(650), a.target)
+	a.evicted(evictEntry{name: "d", hits: 1, size: 1000})
+	a.accessed("d")
+	assert.Equal(t, int64(1000), a.target)
+
+	out = rc.Params{}
+	a.stats(out)
+	assert.Equal(t, rc.Params{"arcTarget": int64(1000), "arcRecentGhosts": 0, "arcFrequentGhosts": 1}, out)
+
+	// The ghost lists are limited
+	for i := 0; i < 2*maxGhosts; i++ {
+		a.evicted(evictEntry{name: fmt.Sprintf("file%d", i), hits: 1})
+	}
+	assert.Equal(t, maxGhosts, a.recent.Len())
+	assert.Equal(t, maxGhosts+1, len(a.ghosts))
+}
+
+func TestCacheEvictionLargestFirst(t *testing.T) {
+	opt := vfscommon.DefaultOpt
+	opt.CachePollInterval = 0
+	opt.WriteBack = 0
+	opt.CacheEviction = vfscommon.CacheEvictionLargestFirst
+	_, c := newTestCacheOpt(t, opt)
+
+	potato := c.Item("potato")
+	itemWrite(t, potato, "hello")
+	require.NoError(t, potato.Close(nil))
+	potato2 := c.Item("potato2")
+	itemWrite(t, potato2, "hello2")
+	require.NoError(t, potato2.Close(nil))
+
+	// make potato2 the newest so LRU would remove potato
+	potato2.info.ATime = time.Now().Add(10 * time.Second)
+	assert.Equal(t, int64(1), potato.info.Hits)
+
+	c.opt.CacheMaxSize = 10
+	c.purgeOverQuota()
+	assert.Equal(t, []string{
+		`name="potato" opens=0 size=5`,
+	}, itemAsString(c))
+
+	out := c.Stats()["eviction"].(rc.Params)
+	assert.Equal(t, "largest-first", out["policy"])
+	assert.Equal(t, int64(1), out["evictions"])
+	assert.Equal(t, int64(6), out["evictedBytes"])
+}
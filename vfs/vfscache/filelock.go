@@ -0,0 +1,19 @@
+//go:build !plan9 && !solaris && !js
+// +build !plan9,!solaris,!js
+
+package vfscache
+
+import "github.com/gofrs/flock"
+
+// fileLock is an advisory lock on a file which works between
+// processes. Locks on the same file opened separately conflict
+// within a process too.
+type fileLock struct {
+	*flock.Flock
+}
+
+// newFileLock returns a lock on the file at osPath which is created
+// if needed when it is locked
+func newFileLock(osPath string) *fileLock {
+	return &fileLock{Flock: flock.New(osPath)}
+}
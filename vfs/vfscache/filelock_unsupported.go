@@ -0,0 +1,37 @@
+//go:build plan9 || solaris || js
+// +build plan9 solaris js
+
+package vfscache
+
+import "errors"
+
+var errFileLockUnsupported = errors.New("file locking is not supported on this OS")
+
+// fileLock is an advisory lock on a file which works between
+// processes. It isn't supported on this OS.
+type fileLock struct{}
+
+// newFileLock returns a lock on the file at osPath
+func newFileLock(osPath string) *fileLock {
+	return &fileLock{}
+}
+
+// TryLock takes an exclusive lock if it can without waiting
+func (l *fileLock) TryLock() (bool, error) {
+	return false, errFileLockUnsupported
+}
+
+// TryRLock takes a shared lock if it can without waiting
+func (l *fileLock) TryRLock() (bool, error) {
+	return false, errFileLockUnsupported
+}
+
+// RLock takes a shared lock, waiting if necessary
+func (l *fileLock) RLock() error {
+	return errFileLockUnsupported
+}
+
+// Unlock releases the lock
+func (l *fileLock) Unlock() error {
+	return nil
+}
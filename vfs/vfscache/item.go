@@ -62,7 +62,7 @@ type Item struct {
 	opens           int                      // number of times file is open
 	downloaders     *downloaders.Downloaders // a record of the downloaders in action - may be nil
 	o               fs.Object                // object we are caching - may be nil
-	fd              *os.File                 // handle we are using to read and write to the file
+	fd              cacheFile                // handle we are using to read and write to the file
 	info            Info                     // info about the file to persist to backing store
 	writeBackID     writeback.Handle         // id of any writebacks in progress
 	pendingAccesses int                      // number of threads - cache reset not allowed if not zero
@@ -78,6 +78,23 @@ type Info struct {
 	Rs          ranges.Ranges // which parts of the file are present
 	Fingerprint string        // fingerprint of remote object
 	Dirty       bool          // set if the backing file has been modified
+	Hits        int64         // number of times the file has been opened
+	Block       string        // key of the data in the block store if stored in blocks
+
+	// fingerprint of the remote object the local changes are based
+	// on, "" if there was none, or nil if not known
+	BaseFingerprint *string `json:",omitempty"`
+}
+
+// cacheFile is the storage for the data of an open Item. This is an
+// *os.File or a *blockFile if the item is stored in blocks.
+type cacheFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Close() error
 }
 
 // Items are a slice of *Item ordered by ATime
@@ -144,7 +161,9 @@ func newItem(c *Cache, name string) (item *Item) {
 	fi, statErr := os.Stat(osPath)
 	if statErr != nil {
 		if os.IsNotExist(statErr) {
-			item._removeMeta("cache file doesn't exist")
+			if !item.inBlockStore() {
+				item._removeMeta("cache file doesn't exist")
+			}
 		} else {
 			item.remove(fmt.Sprintf("failed to stat cache file: %v", statErr))
 		}
@@ -165,6 +184,29 @@ func newItem(c *Cache, name string) (item *Item) {
 	return item
 }
 
+// inBlockStore loads the metadata and returns true if it says the
+// item is stored in the block store
+func (item *Item) inBlockStore() bool {
+	if item.c.blocks == nil {
+		return false
+	}
+	exists, err := item.load()
+	return exists && err == nil && item.info.Block != ""
+}
+
+// evictEntry returns the info the eviction policies need about the item
+func (item *Item) evictEntry() evictEntry {
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	return evictEntry{
+		item:  item,
+		name:  item.name,
+		aTime: item.info.ATime,
+		hits:  item.info.Hits,
+		size:  item.info.Rs.Size(),
+	}
+}
+
 // inUse returns true if the item is open or dirty
 func (item *Item) inUse() bool {
 	item.mu.Lock()
@@ -179,6 +221,17 @@ func (item *Item) inUse() bool {
 func (item *Item) getDiskSize() int64 {
 	item.mu.Lock()
 	defer item.mu.Unlock()
+	return item._diskSize()
+}
+
+// _diskSize returns the size on disk of the item. Items stored in
+// blocks take no space as the space is accounted to the block store.
+//
+// call with lock held
+func (item *Item) _diskSize() int64 {
+	if item.info.Block != "" {
+		return 0
+	}
 	return item.info.Rs.Size()
 }
 
@@ -233,6 +286,18 @@ func (item *Item) _truncate(size int64) (err error) {
 		return nil
 	}
 
+	// Items in the block store have no cache file to truncate
+	if item.info.Block != "" {
+		if item.fd != nil {
+			err = item.fd.Truncate(size)
+			if err != nil {
+				return fmt.Errorf("vfs cache: truncate: %w", err)
+			}
+		}
+		item.info.Size = size
+		return nil
+	}
+
 	// Use open handle if available
 	fd := item.fd
 	if fd == nil {
@@ -242,8 +307,9 @@ func (item *Item) _truncate(size int64) (err error) {
 		if item.info.Rs.Size() == 0 {
 			oFlags |= os.O_CREATE
 		}
+		var osFd *os.File
 		osPath := item.c.toOSPath(item.name) // No locking in Cache
-		fd, err = file.OpenFile(osPath, oFlags, 0600)
+		osFd, err = file.OpenFile(osPath, oFlags, 0600)
 		if err != nil && os.IsNotExist(err) {
 			// If the metadata has info but the file doesn't
 			// not exist then it has been externally removed
@@ -251,18 +317,19 @@ func (item *Item) _truncate(size int64) (err error) {
 			item.info.Rs = nil      // show we have no blocks cached
 			item.info.Dirty = false // file can't be dirty if it doesn't exist
 			item._removeMeta("cache file externally deleted")
-			fd, err = file.OpenFile(osPath, os.O_CREATE|os.O_WRONLY, 0600)
+			osFd, err = file.OpenFile(osPath, os.O_CREATE|os.O_WRONLY, 0600)
 		}
 		if err != nil {
 			return fmt.Errorf("vfs cache: truncate: failed to open cache file: %w", err)
 		}
 
-		defer fs.CheckClose(fd, &err)
+		defer fs.CheckClose(osFd, &err)
 
-		err = file.SetSparse(fd)
+		err = file.SetSparse(osFd)
 		if err != nil {
 			fs.Errorf(item.name, "vfs cache: truncate: failed to set as a sparse file: %v", err)
 		}
+		fd = osFd
 	}
 
 	// Check to see what the current size is, and don't truncate
@@ -330,6 +397,11 @@ func (item *Item) Truncate(size int64) (err error) {
 		return errors.New("vfs cache item truncate: internal error: didn't Open file")
 	}
 
+	err = item._materialize()
+	if err != nil {
+		return err
+	}
+
 	// Read old size
 	oldSize, err := item._getSize()
 	if err != nil {
@@ -367,6 +439,13 @@ func (item *Item) Truncate(size int64) (err error) {
 //
 // Call with mutex held
 func (item *Item) _stat() (fi os.FileInfo, err error) {
+	if item.info.Block != "" {
+		modTime := item.info.ModTime
+		if item.o != nil {
+			modTime = item.o.ModTime(context.TODO())
+		}
+		return blockFileInfo{name: item.name, size: item.info.Size, modTime: modTime}, nil
+	}
 	if item.fd != nil {
 		return item.fd.Stat()
 	}
@@ -411,6 +490,9 @@ func (item *Item) GetSize() (size int64, err error) {
 //
 // call with mutex held
 func (item *Item) _exists() bool {
+	if item.info.Block != "" {
+		return true
+	}
 	osPath := item.c.toOSPath(item.name) // No locking in Cache
 	_, err := os.Stat(osPath)
 	return err == nil
@@ -427,6 +509,10 @@ func (item *Item) Exists() bool {
 //
 // call with lock held
 func (item *Item) _dirty() {
+	err := item._materialize()
+	if err != nil {
+		fs.Errorf(item.name, "vfs cache: %v", err)
+	}
 	item.info.ModTime = time.Now()
 	item.info.ATime = item.info.ModTime
 	if !item.modified {
@@ -437,7 +523,7 @@ func (item *Item) _dirty() {
 	}
 	if !item.info.Dirty {
 		item.info.Dirty = true
-		err := item._save()
+		err = item._save()
 		if err != nil {
 			fs.Errorf(item.name, "vfs cache: failed to save item info: %v", err)
 		}
@@ -467,17 +553,23 @@ func (item *Item) _createFile(osPath string) (err error) {
 		return errors.New("vfs cache item: internal error: didn't Close file")
 	}
 	item.modified = false
-	// t0 := time.Now()
-	fd, err := file.OpenFile(osPath, os.O_RDWR, 0600)
-	// fs.Debugf(item.name, "OpenFile took %v", time.Since(t0))
-	if err != nil {
-		return fmt.Errorf("vfs cache item: open failed: %w", err)
-	}
-	err = file.SetSparse(fd)
-	if err != nil {
-		fs.Errorf(item.name, "vfs cache: failed to set as a sparse file: %v", err)
+	if item.info.Block != "" {
+		bf := item.c.blocks.open(item.info.Block, item.info.Size)
+		item.info.Rs = bf.present()
+		item.fd = bf
+	} else {
+		// t0 := time.Now()
+		fd, err := file.OpenFile(osPath, os.O_RDWR, 0600)
+		// fs.Debugf(item.name, "OpenFile took %v", time.Since(t0))
+		if err != nil {
+			return fmt.Errorf("vfs cache item: open failed: %w", err)
+		}
+		err = file.SetSparse(fd)
+		if err != nil {
+			fs.Errorf(item.name, "vfs cache: failed to set as a sparse file: %v", err)
+		}
+		item.fd = fd
 	}
-	item.fd = fd
 
 	err = item._save()
 	if err != nil {
@@ -519,6 +611,8 @@ func (item *Item) open(o fs.Object) (err error) {
 	defer item.mu.Unlock()
 
 	item.info.ATime = time.Now()
+	item.info.Hits++
+	item.c.evictor.accessed(item.name)
 
 	osPath, err := item.c.createItemDir(item.name) // No locking in Cache
 	if err != nil {
@@ -588,19 +682,43 @@ func (item *Item) _store(ctx context.Context, storeFn StoreFn) (err error) {
 
 	// Object has disappeared if cacheObj == nil
 	if cacheObj != nil {
-		o, name := item.o, item.name
-		item.mu.Unlock()
-		o, err := operations.Copy(ctx, item.c.fremote, o, name, cacheObj)
-		item.mu.Lock()
+		name, current, err := item._resolveConflict(ctx)
 		if err != nil {
-			if errors.Is(err, fs.ErrorCantUploadEmptyFiles) {
-				fs.Errorf(name, "Writeback failed: %v", err)
-				return nil
+			return err
+		}
+		switch name {
+		case "":
+			// Local changes discarded
+			item._discard(current)
+		case item.name:
+			o := item.o
+			if current != nil {
+				o = current
 			}
-			return fmt.Errorf("vfs cache: failed to transfer file from cache to remote: %w", err)
+			item.mu.Unlock()
+			o, err = operations.Copy(ctx, item.c.fremote, o, name, cacheObj)
+			item.mu.Lock()
+			if err != nil {
+				if errors.Is(err, fs.ErrorCantUploadEmptyFiles) {
+					fs.Errorf(name, "Writeback failed: %v", err)
+					return nil
+				}
+				return fmt.Errorf("vfs cache: failed to transfer file from cache to remote: %w", err)
+			}
+			item.o = o
+			item._updateFingerprint()
+			item._setBase(item.info.Fingerprint)
+		default:
+			// Keep both - upload the local changes to a new name
+			// and read the remote version from now on
+			item.mu.Unlock()
+			_, err = operations.Copy(ctx, item.c.fremote, nil, name, cacheObj)
+			item.mu.Lock()
+			if err != nil {
+				return fmt.Errorf("vfs cache: failed to transfer file from cache to remote: %w", err)
+			}
+			item._discard(current)
 		}
-		item.o = o
-		item._updateFingerprint()
 	}
 
 	// Write the object back to the VFS layer before we mark it as
@@ -788,6 +906,7 @@ func (item *Item) reload(ctx context.Context) error {
 //
 // call with lock held
 func (item *Item) _checkObject(o fs.Object) error {
+	remoteFingerprint := ""
 	if o == nil {
 		if item.info.Fingerprint != "" {
 			// no remote object && local object
@@ -802,7 +921,7 @@ func (item *Item) _checkObject(o fs.Object) error {
 			// OK
 		}
 	} else {
-		remoteFingerprint := fs.Fingerprint(context.TODO(), o, item.c.opt.FastFingerprint)
+		remoteFingerprint = fs.Fingerprint(context.TODO(), o, item.c.opt.FastFingerprint)
 		fs.Debugf(item.name, "vfs cache: checking remote fingerprint %q against cached fingerprint %q", remoteFingerprint, item.info.Fingerprint)
 		if item.info.Fingerprint != "" {
 			// remote object && local object
@@ -820,9 +939,19 @@ func (item *Item) _checkObject(o fs.Object) error {
 			item.info.Fingerprint = remoteFingerprint
 		}
 		item.info.Size = o.Size()
+		// Store clean files which aren't open in the block store
+		if item.c.blocks != nil && item.fd == nil && !item.info.Dirty && item.info.Block == "" && item.info.Rs.Size() == 0 && o.Size() >= 0 {
+			item.info.Block = blockKey(context.TODO(), o, item.info.Fingerprint)
+			item._removeFile("stored in block store")
+		}
 	}
 	item.o = o
 
+	// Local changes from now on are based on this object
+	if !item.info.Dirty {
+		item._setBase(remoteFingerprint)
+	}
+
 	err := item._truncateToCurrentSize()
 	if err != nil {
 		return fmt.Errorf("vfs cache item: open truncate failed: %w", err)
@@ -921,7 +1050,7 @@ func (item *Item) RemoveNotInUse(maxAge time.Duration, emptyOnly bool) (removed
 		}
 	}
 	if removeIt {
-		spaceUsed := item.info.Rs.Size()
+		spaceUsed := item._diskSize()
 		if !emptyOnly || spaceUsed == 0 {
 			spaceFreed = spaceUsed
 			removed = true
@@ -941,7 +1070,7 @@ func (item *Item) Reset() (rr ResetResult, spaceFreed int64, err error) {
 
 	// The item is not being used now.  Just remove it instead of resetting it.
 	if item.opens == 0 && !item.info.Dirty {
-		spaceFreed = item.info.Rs.Size()
+		spaceFreed = item._diskSize()
 		if item._remove("Removing old cache file not in use") {
 			fs.Errorf(item.name, "item removed when it was writing/uploaded")
 		}
@@ -1018,7 +1147,7 @@ func (item *Item) Reset() (rr ResetResult, spaceFreed int64, err error) {
 		item.fd = nil
 	}
 
-	spaceFreed = item.info.Rs.Size()
+	spaceFreed = item._diskSize()
 
 	// This should not be possible.  We get here only if cache data is not dirty.
 	if item._remove("cache out of space, item is clean") {
@@ -1093,6 +1222,18 @@ func (item *Item) _present() bool {
 	return item.info.Rs.Present(ranges.Range{Pos: 0, Size: item.info.Size})
 }
 
+// _presentRange returns the range of the item from offset of size
+// clipped to the size of the item and whether it is all in the cache
+//
+// call with lock held
+func (item *Item) _presentRange(offset, size int64) (r ranges.Range, present bool) {
+	if offset+size > item.info.Size {
+		size = item.info.Size - offset
+	}
+	r = ranges.Range{Pos: offset, Size: size}
+	return r, item.info.Rs.Present(r)
+}
+
 // present returns true if the whole file has been downloaded
 func (item *Item) present() bool {
 	item.mu.Lock()
@@ -1125,11 +1266,20 @@ func (item *Item) FindMissing(r ranges.Range) (outr ranges.Range) {
 // call with the item lock held
 func (item *Item) _ensure(offset, size int64) (err error) {
 	// defer log.Trace(item.name, "offset=%d, size=%d", offset, size)("err=%v", &err)
-	if offset+size > item.info.Size {
-		size = item.info.Size - offset
+	r, present := item._presentRange(offset, size)
+	if bf, ok := item.fd.(*blockFile); ok && !present && bf.s.shared {
+		// Wait for blocks other processes are downloading
+		// rather than downloading them again
+		item.mu.Unlock()
+		found := bf.waitForOthers(r)
+		item.mu.Lock()
+		if item.fd == bf {
+			for _, fr := range found {
+				item.info.Rs.Insert(fr)
+			}
+			r, present = item._presentRange(offset, size)
+		}
 	}
-	r := ranges.Range{Pos: offset, Size: size}
-	present := item.info.Rs.Present(r)
 	/* This statement simulates a cache space error for test purpose */
 	/* if present != true && item.info.Rs.Size() > 32*1024*1024 {
 		return errors.New("no space left on device")
@@ -1165,6 +1315,23 @@ func (item *Item) _ensure(offset, size int64) (err error) {
 	return item.downloaders.Download(r)
 }
 
+// prefetch downloads the whole of the item into the cache file
+//
+// The item must be open.
+func (item *Item) prefetch() error {
+	item.preAccess()
+	defer item.postAccess()
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	if item.fd == nil {
+		return errors.New("vfs cache item prefetch: internal error: didn't Open file")
+	}
+	if item._present() {
+		return nil
+	}
+	return item._ensure(0, item.info.Size)
+}
+
 // _written marks the (offset, size) as present in the backing file
 //
 // This is called by the downloader downloading file segments and the
@@ -1198,6 +1365,9 @@ func (item *Item) _updateFingerprint() {
 //
 // call with lock held
 func (item *Item) _setModTime(modTime time.Time) {
+	if item.info.Block != "" {
+		return
+	}
 	fs.Debugf(item.name, "vfs cache: setting modification time to %v", modTime)
 	osPath := item.c.toOSPath(item.name) // No locking in Cache
 	err := os.Chtimes(osPath, modTime, modTime)
@@ -1273,6 +1443,13 @@ func (item *Item) readAt(b []byte, off int64) (n int, err error) {
 	}
 	defer item.mu.Unlock()
 
+	_, present := item._presentRange(off, int64(len(b)))
+	item.c.metrics.onRead(item.c.fremote.Name(), present)
+	if present {
+		item.c.readHits.Add(1)
+	} else {
+		item.c.readMisses.Add(1)
+	}
 	err = item._ensure(off, int64(len(b)))
 	if err != nil {
 		return 0, err
@@ -1281,6 +1458,17 @@ func (item *Item) readAt(b []byte, off int64) (n int, err error) {
 	item.info.ATime = time.Now()
 	// Do the reading with Item.mu unlocked and cache protected by preAccess
 	n, err = item.fd.ReadAt(b, off)
+	if bf, ok := item.fd.(*blockFile); ok && errors.Is(err, errBlockMissing) {
+		// Another process may have removed the blocks so find
+		// out what is still there and fetch the rest again
+		fs.Debugf(item.name, "vfs cache: blocks removed from block store - fetching again")
+		item.info.Rs = bf.reload()
+		err = item._ensure(off, int64(len(b)))
+		if err != nil {
+			return 0, err
+		}
+		n, err = item.fd.ReadAt(b, off)
+	}
 	return n, err
 }
 
@@ -1293,9 +1481,15 @@ func (item *Item) WriteAt(b []byte, off int64) (n int, err error) {
 		item.mu.Unlock()
 		return 0, errors.New("vfs cache item WriteAt: internal error: didn't Open file")
 	}
+	err = item._materialize()
+	if err != nil {
+		item.mu.Unlock()
+		return 0, err
+	}
+	fd := item.fd
 	item.mu.Unlock()
 	// Do the writing with Item.mu unlocked
-	n, err = item.fd.WriteAt(b, off)
+	n, err = fd.WriteAt(b, off)
 	if err == nil && n != len(b) {
 		err = fmt.Errorf("short write: tried to write %d but only %d written", len(b), n)
 	}
@@ -1374,6 +1568,44 @@ func (item *Item) WriteAtNoOverwrite(b []byte, off int64) (n int, skipped int, e
 	return n, skipped, err
 }
 
+// _materialize moves the data of an open item stored in blocks into
+// a cache file of its own so it can be modified and uploaded.
+//
+// call with lock held
+func (item *Item) _materialize() (err error) {
+	bf, ok := item.fd.(*blockFile)
+	if !ok {
+		return nil
+	}
+	osPath := item.c.toOSPath(item.name) // No locking in Cache
+	fd, err := file.OpenFile(osPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("vfs cache item: failed to create cache file from blocks: %w", err)
+	}
+	err = file.SetSparse(fd)
+	if err != nil {
+		fs.Errorf(item.name, "vfs cache: failed to set as a sparse file: %v", err)
+	}
+	rs, err := bf.copyTo(fd, item.info.Rs)
+	if err == nil {
+		err = fd.Truncate(item.info.Size)
+	}
+	if err != nil {
+		_ = fd.Close()
+		_ = os.Remove(osPath)
+		return fmt.Errorf("vfs cache item: failed to copy blocks to cache file: %w", err)
+	}
+	closeErr := bf.Close()
+	if closeErr != nil {
+		fs.Errorf(item.name, "vfs cache: failed to close blocks: %v", closeErr)
+	}
+	item.fd = fd
+	item.info.Rs = rs
+	item.info.Block = ""
+	fs.Debugf(item.name, "vfs cache: moved from block store to cache file")
+	return item._save()
+}
+
 // Sync commits the current contents of the file to stable storage. Typically,
 // this means flushing the file system's in-memory copy of recently written
 // data to disk.
@@ -1413,6 +1645,11 @@ func (item *Item) rename(name string, newName string, newObj fs.Object) (err err
 	// Set internal state
 	item.name = newName
 	item.o = newObj
+	if newObj != nil && item.c.detectConflicts() {
+		item._setBase(fs.Fingerprint(context.TODO(), newObj, item.c.opt.FastFingerprint))
+	} else {
+		item.info.BaseFingerprint = nil
+	}
 
 	// Rename cache file if it exists
 	err = rename(item.c.toOSPath(name), item.c.toOSPath(newName)) // No locking in Cache
@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/lib/random"
@@ -211,6 +212,34 @@ func TestItemReadAt(t *testing.T) {
 	require.NoError(t, item.Close(nil))
 }
 
+func TestItemReadAtMetrics(t *testing.T) {
+	m := NewMetrics("test")
+	oldMetrics := DefaultMetrics
+	DefaultMetrics = m
+	defer func() { DefaultMetrics = oldMetrics }()
+
+	r, c := newItemTestCache(t)
+	remote := r.Fremote.Name()
+
+	_, obj, item := newFile(t, r, c, "existing")
+	require.NoError(t, item.Open(obj))
+	buf := make([]byte, 10)
+
+	_, err := item.ReadAt(buf, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.Hits.WithLabelValues(remote)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.Misses.WithLabelValues(remote)))
+
+	_, err = item.ReadAt(buf, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.Hits.WithLabelValues(remote)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.Misses.WithLabelValues(remote)))
+
+	assert.Equal(t, 5, testutil.CollectAndCount(m.usage))
+
+	require.NoError(t, item.Close(nil))
+}
+
 func TestItemWriteAtNew(t *testing.T) {
 	r, c := newItemTestCache(t)
 	item, _ := c.get("potato")
@@ -0,0 +1,386 @@
+package vfscache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/file"
+)
+
+// Pinned items are never removed from the cache by the cleaner and
+// are downloaded in full in the background. Pins are paths or rsync
+// style globs relative to the root of the VFS. A pin matching a
+// directory pins everything in it.
+
+// pin is a path or glob pinned in the cache
+type pin struct {
+	pattern string         // path or glob as supplied
+	re      *regexp.Regexp // compiled glob or nil for a plain path
+}
+
+// isGlob returns true if pattern has any glob characters in
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[{")
+}
+
+// newPin makes a pin from pattern
+func newPin(pattern string) (p pin, err error) {
+	p.pattern = clean(pattern)
+	if isGlob(p.pattern) {
+		p.re, err = filter.GlobToRegexp("/"+p.pattern, false)
+		if err != nil {
+			return p, fmt.Errorf("bad pin %q: %w", pattern, err)
+		}
+	}
+	return p, nil
+}
+
+// matchPath returns true if the pin matches name exactly
+func (p *pin) matchPath(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	return p.pattern == name
+}
+
+// match returns true if the pin matches name or any of the
+// directories it is in
+func (p *pin) match(name string) bool {
+	if p.pattern == "" {
+		return true
+	}
+	for {
+		if p.matchPath(name) {
+			return true
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// base returns the directory to list to find everything the pin
+// could match
+func (p *pin) base() string {
+	if p.re == nil {
+		return p.pattern
+	}
+	var dirs []string
+	for _, segment := range strings.Split(p.pattern, "/") {
+		if isGlob(segment) {
+			break
+		}
+		dirs = append(dirs, segment)
+	}
+	return strings.Join(dirs, "/")
+}
+
+// pinsPath returns the path of the file the pins are stored in
+func pinsPath(parentOSPath string, relativeDirOSPath string) string {
+	return file.UNCPath(filepath.Join(parentOSPath, "vfsPin", relativeDirOSPath) + ".json")
+}
+
+// _loadPins reads the pins from disk
+//
+// call with mu held or before the cache is started
+func (c *Cache) _loadPins() error {
+	data, err := os.ReadFile(c.pinsPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read pins: %w", err)
+	}
+	var patterns []string
+	err = json.Unmarshal(data, &patterns)
+	if err != nil {
+		return fmt.Errorf("corrupt pins file %q: %w", c.pinsPath, err)
+	}
+	c.pins = c.pins[:0]
+	for _, pattern := range patterns {
+		p, err := newPin(pattern)
+		if err != nil {
+			fs.Errorf(nil, "vfs cache: ignoring pin: %v", err)
+			continue
+		}
+		c.pins = append(c.pins, p)
+	}
+	return nil
+}
+
+// _savePins writes the pins to disk, removing the file if there are
+// none
+//
+// call with mu held
+func (c *Cache) _savePins() error {
+	if len(c.pins) == 0 {
+		err := os.Remove(c.pinsPath)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove pins: %w", err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(c._pinPatterns(), "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode pins: %w", err)
+	}
+	err = createDir(filepath.Dir(c.pinsPath))
+	if err != nil {
+		return fmt.Errorf("failed to create pins directory: %w", err)
+	}
+	tmpPath := c.pinsPath + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write pins: %w", err)
+	}
+	err = os.Rename(tmpPath, c.pinsPath)
+	if err != nil {
+		return fmt.Errorf("failed to write pins: %w", err)
+	}
+	return nil
+}
+
+// _pinPatterns returns the patterns of the pins in use
+//
+// call with mu held
+func (c *Cache) _pinPatterns() []string {
+	patterns := make([]string, len(c.pins))
+	for i := range c.pins {
+		patterns[i] = c.pins[i].pattern
+	}
+	return patterns
+}
+
+// _isPinned returns true if name is matched by any of the pins
+//
+// call with mu held
+func (c *Cache) _isPinned(name string) bool {
+	for i := range c.pins {
+		if c.pins[i].match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPinned returns true if name is matched by any of the pins
+//
+// name should be a remote path not an osPath
+func (c *Cache) IsPinned(name string) bool {
+	name = clean(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c._isPinned(name)
+}
+
+// Pins returns the patterns pinned in the cache in sorted order
+func (c *Cache) Pins() []string {
+	c.mu.Lock()
+	patterns := c._pinPatterns()
+	c.mu.Unlock()
+	sort.Strings(patterns)
+	return patterns
+}
+
+// Pin adds the paths or globs in patterns to the pins, saving them to
+// disk and starting to download anything they match in the
+// background.
+func (c *Cache) Pin(patterns ...string) error {
+	var added []pin
+	c.mu.Lock()
+	for _, pattern := range patterns {
+		p, err := newPin(pattern)
+		if err != nil {
+			c.mu.Unlock()
+			return err
+		}
+		found := false
+		for i := range c.pins {
+			if c.pins[i].pattern == p.pattern {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.pins = append(c.pins, p)
+			added = append(added, p)
+		}
+	}
+	err := c._savePins()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, p := range added {
+		fs.Infof(p.pattern, "vfs cache: pinned")
+	}
+	c.prefetchBackground(added)
+	return nil
+}
+
+// Unpin removes the paths or globs in patterns from the pins, saving
+// them to disk. The cache files stay in the cache until they are
+// removed by the cache cleaner in the usual way.
+//
+// It returns an error if any of the patterns weren't pinned.
+func (c *Cache) Unpin(patterns ...string) error {
+	c.mu.Lock()
+	var notFound []string
+	for _, pattern := range patterns {
+		pattern = clean(pattern)
+		i := 0
+		for _, p := range c.pins {
+			if p.pattern != pattern {
+				c.pins[i] = p
+				i++
+			}
+		}
+		if i == len(c.pins) {
+			notFound = append(notFound, pattern)
+		}
+		c.pins = c.pins[:i]
+	}
+	err := c._savePins()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if len(notFound) > 0 {
+		return fmt.Errorf("not pinned: %q", notFound)
+	}
+	return nil
+}
+
+// PrefetchStats is the result of a Prefetch
+type PrefetchStats struct {
+	Files  int   `json:"files"`  // number of files found
+	Bytes  int64 `json:"bytes"`  // total size of the files found
+	Errors int   `json:"errors"` // number of files which failed to download
+}
+
+// Prefetch downloads everything matched by the paths or globs in
+// patterns in full into the cache, returning when it is done.
+//
+// If no patterns are passed in then everything pinned is downloaded.
+func (c *Cache) Prefetch(ctx context.Context, patterns ...string) (stats PrefetchStats, err error) {
+	var ps []pin
+	if len(patterns) == 0 {
+		c.mu.Lock()
+		ps = append(ps, c.pins...)
+		c.mu.Unlock()
+	}
+	for _, pattern := range patterns {
+		p, err := newPin(pattern)
+		if err != nil {
+			return stats, err
+		}
+		ps = append(ps, p)
+	}
+	return c.prefetch(ctx, ps)
+}
+
+// prefetchBackground downloads everything matched by ps in the
+// background
+func (c *Cache) prefetchBackground(ps []pin) {
+	if len(ps) == 0 {
+		return
+	}
+	go func() {
+		stats, err := c.prefetch(c.ctx, ps)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fs.Errorf(nil, "vfs cache: prefetch of pinned files failed: %v", err)
+			return
+		}
+		fs.Infof(nil, "vfs cache: prefetched %d pinned files (%v) with %d errors", stats.Files, fs.SizeSuffix(stats.Bytes), stats.Errors)
+	}()
+}
+
+// prefetch downloads everything matched by ps
+//
+// Only one prefetch runs at once so they don't open the same items
+func (c *Cache) prefetch(ctx context.Context, ps []pin) (stats PrefetchStats, err error) {
+	c.prefetchMu.Lock()
+	defer c.prefetchMu.Unlock()
+	done := make(map[string]struct{})
+	fetch := func(o fs.Object) {
+		remote := o.Remote()
+		if _, found := done[remote]; found {
+			return
+		}
+		done[remote] = struct{}{}
+		stats.Files++
+		stats.Bytes += o.Size()
+		fetchErr := c.fetch(o)
+		if fetchErr != nil {
+			fs.Errorf(remote, "vfs cache: prefetch failed: %v", fetchErr)
+			stats.Errors++
+		}
+	}
+	for i := range ps {
+		p := &ps[i]
+		if err = ctx.Err(); err != nil {
+			return stats, err
+		}
+		base := p.base()
+		if p.re == nil && base != "" {
+			// A plain path may be a file
+			o, err := c.fremote.NewObject(ctx, base)
+			if err == nil {
+				fetch(o)
+				continue
+			}
+		}
+		err = walk.Walk(ctx, c.fremote, base, true, -1, func(dirPath string, entries fs.DirEntries, err error) error {
+			if err != nil {
+				return err
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				o, ok := entry.(fs.Object)
+				if ok && p.match(o.Remote()) {
+					fetch(o)
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			fs.Debugf(p.pattern, "vfs cache: nothing found to prefetch")
+			err = nil
+		}
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// fetch downloads the whole of o into the cache
+func (c *Cache) fetch(o fs.Object) (err error) {
+	remote := path.Clean(o.Remote())
+	item := c.Item(remote)
+	// Opening the item checks the cache file is still valid
+	err = item.Open(o)
+	if err != nil {
+		return err
+	}
+	err = item.prefetch()
+	closeErr := item.Close(nil)
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
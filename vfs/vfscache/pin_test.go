@@ -0,0 +1,130 @@
+package vfscache
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinMatch(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		name    string
+		want    bool
+		base    string
+	}{
+		{"", "file.txt", true, ""},
+		{"/", "dir/file.txt", true, ""},
+		{"file.txt", "file.txt", true, "file.txt"},
+		{"file.txt", "file.txt2", false, "file.txt"},
+		{"file.txt", "dir/file.txt", false, "file.txt"},
+		{"dir", "dir/file.txt", true, "dir"},
+		{"/dir/", "dir/sub/file.txt", true, "dir"},
+		{"dir", "dir2/file.txt", false, "dir"},
+		{"dir/sub", "dir/file.txt", false, "dir/sub"},
+		{"*.jpg", "photo.jpg", true, ""},
+		{"*.jpg", "dir/photo.jpg", false, ""},
+		{"dir/*.jpg", "dir/photo.jpg", true, "dir"},
+		{"dir/*.jpg", "dir/photo.png", false, "dir"},
+		{"dir/**.jpg", "dir/a/b/photo.jpg", true, "dir"},
+		{"dir/*", "dir/sub/photo.png", true, "dir"},
+		{"dir/{a,b}/c*", "dir/b/cat/food", true, "dir"},
+		{"dir/{a,b}/c*", "dir/d/cat", false, "dir"},
+	} {
+		p, err := newPin(test.pattern)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, p.match(test.name), test)
+		assert.Equal(t, test.base, p.base(), test)
+	}
+
+	_, err := newPin("***")
+	assert.Error(t, err)
+}
+
+func TestCachePin(t *testing.T) {
+	r, c := newItemTestCache(t)
+	ctx := context.Background()
+
+	contents := "hello world"
+	r.WriteObject(ctx, "dir/a.txt", contents, time.Now())
+	r.WriteObject(ctx, "dir/sub/b.txt", contents, time.Now())
+	r.WriteObject(ctx, "other/c.txt", contents, time.Now())
+	r.WriteObject(ctx, "other/d.jpg", contents, time.Now())
+
+	present := func(name string) bool {
+		return c.Item(name).present() && c.Exists(name)
+	}
+
+	// Prefetch doesn't pin
+	stats, err := c.Prefetch(ctx, "other/*.jpg", "dir/missing")
+	require.NoError(t, err)
+	assert.Equal(t, PrefetchStats{Files: 1, Bytes: int64(len(contents))}, stats)
+	assert.True(t, present("other/d.jpg"))
+	assert.False(t, present("other/c.txt"))
+	assert.Equal(t, []string{}, c.Pins())
+
+	// Pin downloads in the background
+	require.NoError(t, c.Pin("/dir/", "other/c.txt", "dir"))
+	assert.Equal(t, []string{"dir", "other/c.txt"}, c.Pins())
+	assert.Eventually(t, func() bool {
+		return present("dir/a.txt") && present("dir/sub/b.txt") && present("other/c.txt")
+	}, 10*time.Second, 10*time.Millisecond)
+	c.prefetchMu.Lock()
+	c.prefetchMu.Unlock()
+	assert.True(t, c.IsPinned("dir/sub/b.txt"))
+	assert.True(t, c.IsPinned("dir/sub"))
+	assert.False(t, c.IsPinned("other/d.jpg"))
+
+	// Pins are saved
+	data, err := os.ReadFile(c.pinsPath)
+	require.NoError(t, err)
+	var saved []string
+	require.NoError(t, json.Unmarshal(data, &saved))
+	assert.Equal(t, []string{"dir", "other/c.txt"}, saved)
+
+	// Pinned items aren't removed by the cleaner
+	c.purgeOld(-10 * time.Second)
+	assert.Equal(t, []string{
+		`name="dir/a.txt" opens=0 size=11`,
+		`name="dir/sub/b.txt" opens=0 size=11`,
+		`name="other/c.txt" opens=0 size=11`,
+	}, itemAsString(c))
+	c.opt.CacheMaxSize = 1
+	c.purgeOverQuota()
+	c.purgeClean()
+	c.opt.CacheMaxSize = 0
+	assert.Equal(t, 3, len(itemAsString(c)))
+
+	// Prefetch with no arguments fetches the pins
+	stats, err = c.Prefetch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, PrefetchStats{Files: 3, Bytes: 3 * int64(len(contents))}, stats)
+
+	// Pins are loaded
+	c.mu.Lock()
+	c.pins = nil
+	require.NoError(t, c._loadPins())
+	c.mu.Unlock()
+	assert.Equal(t, []string{"dir", "other/c.txt"}, c.Pins())
+
+	// Unpin
+	err = c.Unpin("dir/sub", "dir")
+	assert.ErrorContains(t, err, `not pinned: ["dir/sub"]`)
+	assert.Equal(t, []string{"other/c.txt"}, c.Pins())
+	c.purgeOld(-10 * time.Second)
+	assert.Equal(t, []string{
+		`name="other/c.txt" opens=0 size=11`,
+	}, itemAsString(c))
+
+	require.NoError(t, c.Unpin("other/c.txt"))
+	assert.Equal(t, []string{}, c.Pins())
+	_, err = os.Stat(c.pinsPath)
+	assert.True(t, os.IsNotExist(err))
+	c.purgeOld(-10 * time.Second)
+	assert.Equal(t, []string(nil), itemAsString(c))
+}
@@ -0,0 +1,150 @@
+package vfscache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rclone/rclone/fs/metrics"
+)
+
+func init() {
+	metrics.Register(func(namespace string) []prometheus.Collector {
+		DefaultMetrics = NewMetrics(namespace)
+		return DefaultMetrics.Collectors()
+	})
+}
+
+// Metrics provide VFS cache metrics.
+type Metrics struct {
+	Hits   *prometheus.CounterVec
+	Misses *prometheus.CounterVec
+	usage  *usageCollector
+}
+
+// NewMetrics creates a new metrics instance, the instance shall be assigned to
+// DefaultMetrics before any caches are made.
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		Hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vfs_cache",
+			Name:      "hits_total",
+			Help:      "Number of reads from the VFS cache which were already cached",
+		}, []string{"remote"}),
+		Misses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vfs_cache",
+			Name:      "misses_total",
+			Help:      "Number of reads from the VFS cache which needed to be downloaded",
+		}, []string{"remote"}),
+		usage: newUsageCollector(namespace),
+	}
+}
+
+// DefaultMetrics specifies metrics used for new caches.
+var DefaultMetrics = (*Metrics)(nil)
+
+// Collectors returns all prometheus metrics as collectors for registration.
+func (m *Metrics) Collectors() []prometheus.Collector {
+	if m == nil {
+		return nil
+	}
+	return []prometheus.Collector{
+		m.Hits,
+		m.Misses,
+		m.usage,
+	}
+}
+
+// onRead records a read from the cache of remote
+func (m *Metrics) onRead(remote string, hit bool) {
+	if m == nil {
+		return
+	}
+	if hit {
+		m.Hits.WithLabelValues(remote).Inc()
+	} else {
+		m.Misses.WithLabelValues(remote).Inc()
+	}
+}
+
+// add reports the usage of c until ctx is cancelled
+func (m *Metrics) add(ctx context.Context, c *Cache) {
+	if m == nil {
+		return
+	}
+	m.usage.mu.Lock()
+	m.usage.caches[c] = struct{}{}
+	m.usage.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.usage.mu.Lock()
+		delete(m.usage.caches, c)
+		m.usage.mu.Unlock()
+	}()
+}
+
+// usageCollector reads the usage of the caches when collected
+type usageCollector struct {
+	mu                sync.Mutex
+	caches            map[*Cache]struct{}
+	bytesUsed         *prometheus.Desc
+	dirtyBytes        *prometheus.Desc
+	files             *prometheus.Desc
+	uploadsInProgress *prometheus.Desc
+	uploadsQueued     *prometheus.Desc
+}
+
+func newUsageCollector(namespace string) *usageCollector {
+	prefix := namespace + "_vfs_cache_"
+	labels := []string{"remote"}
+	return &usageCollector{
+		caches:            map[*Cache]struct{}{},
+		bytesUsed:         prometheus.NewDesc(prefix+"bytes_used", "Bytes used by the VFS cache on disk", labels, nil),
+		dirtyBytes:        prometheus.NewDesc(prefix+"dirty_bytes", "Size of the files in the VFS cache waiting to be uploaded", labels, nil),
+		files:             prometheus.NewDesc(prefix+"files", "Number of files in the VFS cache", labels, nil),
+		uploadsInProgress: prometheus.NewDesc(prefix+"uploads_in_progress", "Number of files being uploaded from the VFS cache", labels, nil),
+		uploadsQueued:     prometheus.NewDesc(prefix+"uploads_queued", "Number of files queued for upload from the VFS cache", labels, nil),
+	}
+}
+
+// Describe is part of the Collector interface: https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+func (u *usageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- u.bytesUsed
+	ch <- u.dirtyBytes
+	ch <- u.files
+	ch <- u.uploadsInProgress
+	ch <- u.uploadsQueued
+}
+
+// Collect is part of the Collector interface: https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+func (u *usageCollector) Collect(ch chan<- prometheus.Metric) {
+	u.mu.Lock()
+	caches := make([]*Cache, 0, len(u.caches))
+	for c := range u.caches {
+		caches = append(caches, c)
+	}
+	u.mu.Unlock()
+
+	for _, c := range caches {
+		remote := c.fremote.Name()
+		uploadsInProgress, uploadsQueued := c.writeback.Stats()
+		c.mu.Lock()
+		used, files := c.used, len(c.item)
+		var dirty int64
+		for _, item := range c.item {
+			item.mu.Lock()
+			if item.info.Dirty {
+				dirty += item.info.Size
+			}
+			item.mu.Unlock()
+		}
+		c.mu.Unlock()
+		ch <- prometheus.MustNewConstMetric(u.bytesUsed, prometheus.GaugeValue, float64(used), remote)
+		ch <- prometheus.MustNewConstMetric(u.dirtyBytes, prometheus.GaugeValue, float64(dirty), remote)
+		ch <- prometheus.MustNewConstMetric(u.files, prometheus.GaugeValue, float64(files), remote)
+		ch <- prometheus.MustNewConstMetric(u.uploadsInProgress, prometheus.GaugeValue, float64(uploadsInProgress), remote)
+		ch <- prometheus.MustNewConstMetric(u.uploadsQueued, prometheus.GaugeValue, float64(uploadsQueued), remote)
+	}
+}
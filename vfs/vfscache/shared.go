@@ -0,0 +1,238 @@
+package vfscache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/lib/ranges"
+)
+
+// With --vfs-cache-shared several rclone processes can use the same
+// cache directory.
+//
+// The data of files which haven't been modified is kept in the block
+// store which all the processes share. Everything else - modified
+// files, metadata and pins - is private to each process and is kept
+// in a numbered slot in <cache-dir>/vfsShared. A process locks the
+// first free slot for its remote when it starts, so a restarted
+// process picks up (and uploads) what was left in the slot by the
+// last process for the remote to use it.
+//
+// File locks coordinate the use of the block store
+//
+//   - Each key has a ".lock" file in its directory which is share
+//     locked while the key is open. The blocks of a key are only
+//     removed by a process holding the exclusive lock, so blocks in use
+//     anywhere are never removed.
+//   - Each ".part" file being downloaded is exclusively locked by the
+//     downloader. Readers which need the block wait for it to be
+//     completed rather than download it themselves, as long as the
+//     download is making progress.
+//   - The ".lock" file next to the block store root is exclusively
+//     locked while the cache cleaner removes blocks so only one
+//     process cleans the block store at once.
+
+// maxSharedSlots is the most processes which can share a cache
+// directory for a remote
+const maxSharedSlots = 256
+
+// keyLockName is the name of the lock file in a key directory
+const keyLockName = ".lock"
+
+// lockSuffix is the suffix of lock files
+const lockSuffix = ".lock"
+
+// blockPollInterval is how often to check on blocks being downloaded
+// by another process
+const blockPollInterval = 50 * time.Millisecond
+
+// blockStallTime is how long to wait for another process downloading
+// a block to make progress before downloading it too
+var blockStallTime = 5 * time.Second
+
+// lockSharedSlot finds the first slot in parentOSPath not in use by
+// another process for the remote in relativeDirOSPath and locks it.
+//
+// The lock is released when ctx is cancelled.
+func lockSharedSlot(ctx context.Context, parentOSPath string, relativeDirOSPath string) (slotOSPath string, err error) {
+	for n := 0; n < maxSharedSlots; n++ {
+		slotOSPath = filepath.Join(parentOSPath, "vfsShared", strconv.Itoa(n))
+		lockPath := file.UNCPath(filepath.Join(slotOSPath, "vfsLock", relativeDirOSPath) + lockSuffix)
+		err = createDir(filepath.Dir(lockPath))
+		if err != nil {
+			return "", fmt.Errorf("failed to create shared cache slot directory: %w", err)
+		}
+		lock := newFileLock(lockPath)
+		locked, err := lock.TryLock()
+		if err != nil {
+			return "", fmt.Errorf("failed to lock shared cache slot: %w", err)
+		}
+		if locked {
+			go func() {
+				<-ctx.Done()
+				_ = lock.Unlock()
+			}()
+			return slotOSPath, nil
+		}
+	}
+	return "", fmt.Errorf("all %d shared cache slots are in use", maxSharedSlots)
+}
+
+// purgeLockPath returns the path of the lock held while purging
+func (s *blockStore) purgeLockPath() string {
+	return s.root + lockSuffix
+}
+
+// keyLockPath returns the path of the lock file for key
+func (s *blockStore) keyLockPath(key string) string {
+	return filepath.Join(s.keyDir(key), keyLockName)
+}
+
+// lockKey share locks key to show it is in use, returning nil if the
+// store isn't shared or the lock couldn't be taken.
+func (s *blockStore) lockKey(key string) (lock *fileLock) {
+	if !s.shared {
+		return nil
+	}
+	lockPath := s.keyLockPath(key)
+	var err error
+	// Retry as a purge in another process may remove the key
+	// directory and lock file while we are taking the lock
+	for tries := 0; tries < 10; tries++ {
+		err = createDir(filepath.Dir(lockPath))
+		if err != nil {
+			continue
+		}
+		lock = newFileLock(lockPath)
+		err = lock.RLock()
+		if err != nil {
+			continue
+		}
+		if _, err = os.Stat(lockPath); err == nil {
+			return lock
+		}
+		_ = lock.Unlock()
+	}
+	fs.Errorf(nil, "vfs cache: failed to lock blocks in shared cache: %v", err)
+	return nil
+}
+
+// tryLockKeyExclusive exclusively locks key if it isn't in use by
+// anyone, returning nil if it couldn't.
+func (s *blockStore) tryLockKeyExclusive(key string) (lock *fileLock) {
+	lock = newFileLock(s.keyLockPath(key))
+	locked, err := lock.TryLock()
+	if err != nil || !locked {
+		return nil
+	}
+	return lock
+}
+
+// lockPart exclusively locks the incomplete block at partPath to show
+// it is being downloaded, returning nil if the store isn't shared or
+// somebody else is downloading it.
+func (s *blockStore) lockPart(partPath string) (lock *fileLock) {
+	if !s.shared {
+		return nil
+	}
+	lock = newFileLock(partPath)
+	locked, err := lock.TryLock()
+	if err != nil || !locked {
+		return nil
+	}
+	return lock
+}
+
+// partBusy returns whether block i of key is being downloaded by
+// somebody else and how much of it has been downloaded so far.
+func (s *blockStore) partBusy(key string, i int64) (busy bool, size int64) {
+	partPath := s.blockPath(key, i) + blockPartSuffix
+	fi, err := os.Stat(partPath)
+	if err != nil {
+		return false, 0
+	}
+	lock := newFileLock(partPath)
+	locked, err := lock.TryRLock()
+	if err != nil {
+		return false, 0
+	}
+	if locked {
+		_ = lock.Unlock()
+		return false, 0
+	}
+	return true, fi.Size()
+}
+
+// blockComplete returns true if block i of a file of size stored
+// under key is complete
+func (s *blockStore) blockComplete(key string, i int64, size int64) bool {
+	fi, err := os.Stat(s.blockPath(key, i))
+	return err == nil && fi.Size() == s.blockRange(i, size).Size
+}
+
+// waitForOthers waits for blocks in r which are being downloaded by
+// somebody else to be completed, for as long as they are making
+// progress.
+//
+// It returns the ranges of r which are now in complete blocks which
+// weren't before.
+func (bf *blockFile) waitForOthers(r ranges.Range) (found ranges.Ranges) {
+	bs := bf.s.blockSize
+	bf.mu.Lock()
+	r.Clip(bf.size)
+	var waiting []int64
+	for i := r.Pos / bs; i*bs < r.End(); i++ {
+		if bf.partLocks[i] == nil && !bf.rs.Present(bf.blockRange(i)) {
+			waiting = append(waiting, i)
+		}
+	}
+	size := bf.size
+	bf.mu.Unlock()
+
+	sizes := make(map[int64]int64, len(waiting))
+	lastProgress := time.Now()
+	for len(waiting) > 0 {
+		busy := waiting[:0]
+		for _, i := range waiting {
+			if bf.s.blockComplete(bf.key, i, size) {
+				continue
+			}
+			isBusy, partSize := bf.s.partBusy(bf.key, i)
+			if !isBusy {
+				continue
+			}
+			if partSize != sizes[i] {
+				sizes[i] = partSize
+				lastProgress = time.Now()
+			}
+			busy = append(busy, i)
+		}
+		waiting = busy
+		if len(waiting) == 0 {
+			break
+		}
+		if time.Since(lastProgress) > blockStallTime {
+			fs.Debugf(nil, "vfs cache: blocks being downloaded by another process stalled - downloading them")
+			break
+		}
+		time.Sleep(blockPollInterval)
+	}
+
+	// Pick up the blocks which were completed
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	for i := r.Pos / bs; i*bs < r.End(); i++ {
+		br := bf.blockRange(i)
+		if !bf.rs.Present(br) && bf.s.blockComplete(bf.key, i, bf.size) {
+			bf.rs.Insert(br)
+			found.Insert(br)
+		}
+	}
+	return found
+}
@@ -0,0 +1,164 @@
+package vfscache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/ranges"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSharedBlockStores makes two block stores sharing a directory as
+// if they were in different processes
+func newSharedBlockStores(t *testing.T) (s1, s2 *blockStore) {
+	dir := t.TempDir()
+	s1, err := newBlockStore(dir, 4, true)
+	require.NoError(t, err)
+	s2, err = newBlockStore(dir, 4, true)
+	require.NoError(t, err)
+	return s1, s2
+}
+
+func TestBlockStoreSharedPurge(t *testing.T) {
+	s1, s2 := newSharedBlockStores(t)
+
+	bf := s1.open(testBlockKey, 8)
+	_, err := bf.WriteAt([]byte("01234567"), 0)
+	require.NoError(t, err)
+	assertPathExist(t, s1.keyLockPath(testBlockKey))
+
+	// Blocks open in another process aren't removed
+	assert.Equal(t, int64(0), s2.purge(time.Time{}, 100, nil))
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 8}}, s2.present(testBlockKey, 8))
+
+	// Nothing is removed while another process is purging
+	require.NoError(t, bf.Close())
+	purgeLock := newFileLock(s1.purgeLockPath())
+	locked, err := purgeLock.TryLock()
+	require.NoError(t, err)
+	require.True(t, locked)
+	assert.Equal(t, int64(0), s2.purge(time.Time{}, 100, nil))
+	require.NoError(t, purgeLock.Unlock())
+
+	// The blocks and lock file are removed when not in use
+	assert.Equal(t, int64(8), s2.purge(time.Time{}, 100, nil))
+	assertPathNotExist(t, s1.keyDir(testBlockKey))
+
+	// Keys with only a lock file are tidied up
+	bf = s1.open(testBlockKey, 8)
+	require.NoError(t, bf.Close())
+	assertPathExist(t, s1.keyLockPath(testBlockKey))
+	assert.Equal(t, int64(0), s2.purge(time.Time{}, 100, nil))
+	assertPathNotExist(t, s1.keyDir(testBlockKey))
+}
+
+func TestBlockFileSharedWait(t *testing.T) {
+	oldBlockStallTime := blockStallTime
+	blockStallTime = 250 * time.Millisecond
+	defer func() {
+		blockStallTime = oldBlockStallTime
+	}()
+	s1, s2 := newSharedBlockStores(t)
+
+	bf1 := s1.open(testBlockKey, 8)
+	defer func() { require.NoError(t, bf1.Close()) }()
+	bf2 := s2.open(testBlockKey, 8)
+	defer func() { require.NoError(t, bf2.Close()) }()
+
+	// Wait for the other process to finish downloading block 0
+	_, err := bf1.WriteAt([]byte("01"), 0)
+	require.NoError(t, err)
+	busy, size := s2.partBusy(testBlockKey, 0)
+	assert.True(t, busy)
+	assert.Equal(t, int64(2), size)
+	done := make(chan error)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, err := bf1.WriteAt([]byte("23"), 2)
+		done <- err
+	}()
+	found := bf2.waitForOthers(ranges.Range{Pos: 0, Size: 8})
+	require.NoError(t, <-done)
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 4}}, found)
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 4}}, bf2.present())
+	busy, _ = s2.partBusy(testBlockKey, 0)
+	assert.False(t, busy)
+
+	// Stop waiting if the download stalls
+	_, err = bf1.WriteAt([]byte("4"), 4)
+	require.NoError(t, err)
+	start := time.Now()
+	found = bf2.waitForOthers(ranges.Range{Pos: 4, Size: 4})
+	assert.Equal(t, ranges.Ranges(nil), found)
+	assert.True(t, time.Since(start) >= blockStallTime)
+
+	// Downloading the same block in both is harmless
+	_, err = bf2.WriteAt([]byte("4567"), 4)
+	require.NoError(t, err)
+	_, err = bf1.WriteAt([]byte("567"), 5)
+	require.NoError(t, err)
+	buf := make([]byte, 8)
+	n, err := bf1.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "01234567", string(buf[:n]))
+}
+
+func TestCacheShared(t *testing.T) {
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	defer func() {
+		require.NoError(t, config.SetCacheDir(oldCacheDir))
+	}()
+	opt := vfscommon.DefaultOpt
+	opt.CachePollInterval = 0
+	opt.WriteBack = 0
+	opt.CacheShared = true
+	opt.CacheBlockSize = 4
+	r, c1 := newTestCacheOpt(t, opt)
+
+	// Start a second cache as if in another process
+	ctx, cancel := context.WithCancel(context.Background())
+	c2, err := New(ctx, r.Fremote, &opt, addVirtual)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, c2.CleanUp())
+		cancel()
+	})
+
+	// Private slots but a shared block store
+	assert.NotEqual(t, c1.root, c2.root)
+	assert.Contains(t, c2.root, filepath.Join("vfsShared", "1"))
+	require.NotNil(t, c2.blocks)
+	assert.Equal(t, c1.blocks.root, c2.blocks.root)
+	assert.Equal(t, true, c2.Stats()["blocks"].(rc.Params)["shared"])
+
+	// Data downloaded by one is used by the other
+	contents, obj, item1 := newFileLength(t, r, c1, "existing", 10)
+	require.NoError(t, item1.Open(obj))
+	buf := make([]byte, 10)
+	n, err := item1.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, contents, string(buf[:n]))
+	require.NoError(t, item1.Close(nil))
+
+	item2 := c2.Item("existing")
+	require.NoError(t, item2.Open(obj))
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: 10}}, item2.info.Rs)
+	n, err = item2.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, contents, string(buf[:n]))
+
+	// Modified files are private
+	_, err = item2.WriteAt([]byte("HELLO"), 0)
+	require.NoError(t, err)
+	assertPathExist(t, c2.toOSPath("existing"))
+	assertPathNotExist(t, c1.toOSPath("existing"))
+	require.NoError(t, item2.Close(nil))
+	checkObject(t, r, "existing", "HELLO"+contents[5:])
+}
@@ -0,0 +1,33 @@
+package vfscommon
+
+import (
+	"github.com/rclone/rclone/fs"
+)
+
+type cacheEvictionChoices struct{}
+
+func (cacheEvictionChoices) Choices() []string {
+	return []string{
+		CacheEvictionLRU:          "lru",
+		CacheEvictionLFU:          "lfu",
+		CacheEvictionARC:          "arc",
+		CacheEvictionLargestFirst: "largest-first",
+	}
+}
+
+// CacheEviction controls the order files are removed from the cache
+// when it is over quota
+type CacheEviction = fs.Enum[cacheEvictionChoices]
+
+// CacheEviction options
+const (
+	CacheEvictionLRU          CacheEviction = iota // remove the least recently used files first
+	CacheEvictionLFU                               // remove the least frequently used files first
+	CacheEvictionARC                               // adaptive replacement balancing recency and frequency
+	CacheEvictionLargestFirst                      // remove the largest files first
+)
+
+// Type of the value
+func (cacheEvictionChoices) Type() string {
+	return "CacheEviction"
+}
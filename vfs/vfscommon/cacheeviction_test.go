@@ -0,0 +1,30 @@
+package vfscommon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// Check CacheEviction it satisfies the pflag interface
+var _ pflag.Value = (*CacheEviction)(nil)
+
+func TestCacheEvictionString(t *testing.T) {
+	assert.Equal(t, "lru", CacheEvictionLRU.String())
+	assert.Equal(t, "largest-first", CacheEvictionLargestFirst.String())
+	assert.Equal(t, "CacheEviction", CacheEvictionARC.Type())
+}
+
+func TestCacheEvictionSet(t *testing.T) {
+	var e CacheEviction
+
+	assert.NoError(t, e.Set("lfu"))
+	assert.Equal(t, CacheEvictionLFU, e)
+
+	assert.NoError(t, json.Unmarshal([]byte(`"arc"`), &e))
+	assert.Equal(t, CacheEvictionARC, e)
+
+	assert.Error(t, e.Set("potato"))
+}
@@ -0,0 +1,29 @@
+package vfscommon
+
+import (
+	"github.com/rclone/rclone/fs"
+)
+
+type cacheStorageChoices struct{}
+
+func (cacheStorageChoices) Choices() []string {
+	return []string{
+		CacheStorageFile:  "file",
+		CacheStorageBlock: "block",
+	}
+}
+
+// CacheStorage controls how the data of the files in the cache is
+// stored on disk
+type CacheStorage = fs.Enum[cacheStorageChoices]
+
+// CacheStorage options
+const (
+	CacheStorageFile  CacheStorage = iota // one sparse file per cached file
+	CacheStorageBlock                     // fixed size blocks shared between files with the same content
+)
+
+// Type of the value
+func (cacheStorageChoices) Type() string {
+	return "CacheStorage"
+}
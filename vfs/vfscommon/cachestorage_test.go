@@ -0,0 +1,30 @@
+package vfscommon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// Check CacheStorage it satisfies the pflag interface
+var _ pflag.Value = (*CacheStorage)(nil)
+
+func TestCacheStorageString(t *testing.T) {
+	assert.Equal(t, "file", CacheStorageFile.String())
+	assert.Equal(t, "block", CacheStorageBlock.String())
+	assert.Equal(t, "CacheStorage", CacheStorageBlock.Type())
+}
+
+func TestCacheStorageSet(t *testing.T) {
+	var s CacheStorage
+
+	assert.NoError(t, s.Set("block"))
+	assert.Equal(t, CacheStorageBlock, s)
+
+	assert.NoError(t, json.Unmarshal([]byte(`"file"`), &s))
+	assert.Equal(t, CacheStorageFile, s)
+
+	assert.Error(t, s.Set("potato"))
+}
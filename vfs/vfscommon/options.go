@@ -29,10 +29,16 @@ type Options struct {
 	CacheMaxSize       fs.SizeSuffix
 	CacheMinFreeSpace  fs.SizeSuffix
 	CachePollInterval  time.Duration
+	CacheEviction      CacheEviction // order to remove files from the cache when over quota
+	CacheStorage       CacheStorage  // how to store the data of cached files
+	CacheBlockSize     fs.SizeSuffix // size of the blocks with CacheStorageBlock
+	CacheShared        bool          // if set share the cache directory with other processes
 	CaseInsensitive    bool
 	WriteWait          time.Duration // time to wait for in-sequence write
 	ReadWait           time.Duration // time to wait for in-sequence read
 	WriteBack          time.Duration // time to wait before writing back dirty files
+	WriteConflict      WriteConflict // what to do if the remote changed before writing back
+	ConflictSuffix     string        // suffix for the local copy with WriteConflictKeepBoth
 	ReadAhead          fs.SizeSuffix // bytes to read ahead in cache mode "full"
 	UsedIsSize         bool          // if true, use the `rclone size` algorithm for Used size
 	FastFingerprint    bool          // if set use fast fingerprints
@@ -56,6 +62,10 @@ var DefaultOpt = Options{
 	CacheMode:          CacheModeOff,
 	CacheMaxAge:        3600 * time.Second,
 	CachePollInterval:  60 * time.Second,
+	CacheEviction:      CacheEvictionLRU,
+	CacheStorage:       CacheStorageFile,
+	CacheBlockSize:     4 * fs.Mebi,
+	CacheShared:        false,
 	ChunkSize:          128 * fs.Mebi,
 	ChunkSizeLimit:     -1,
 	CacheMaxSize:       -1,
@@ -64,6 +74,8 @@ var DefaultOpt = Options{
 	WriteWait:          1000 * time.Millisecond,
 	ReadWait:           20 * time.Millisecond,
 	WriteBack:          5 * time.Second,
+	WriteConflict:      WriteConflictLocalWins,
+	ConflictSuffix:     "conflict",
 	ReadAhead:          0 * fs.Mebi,
 	UsedIsSize:         false,
 	DiskSpaceTotalSize: -1,
@@ -0,0 +1,31 @@
+package vfscommon
+
+import (
+	"github.com/rclone/rclone/fs"
+)
+
+type writeConflictChoices struct{}
+
+func (writeConflictChoices) Choices() []string {
+	return []string{
+		WriteConflictLocalWins:  "local-wins",
+		WriteConflictRemoteWins: "remote-wins",
+		WriteConflictKeepBoth:   "keep-both",
+	}
+}
+
+// WriteConflict controls what happens when a file is written back to
+// the remote but the remote has been changed since the file was opened
+type WriteConflict = fs.Enum[writeConflictChoices]
+
+// WriteConflict options
+const (
+	WriteConflictLocalWins  WriteConflict = iota // overwrite the remote with the local changes
+	WriteConflictRemoteWins                      // discard the local changes
+	WriteConflictKeepBoth                        // upload the local changes with a conflict suffix
+)
+
+// Type of the value
+func (writeConflictChoices) Type() string {
+	return "WriteConflict"
+}
@@ -0,0 +1,30 @@
+package vfscommon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// Check WriteConflict it satisfies the pflag interface
+var _ pflag.Value = (*WriteConflict)(nil)
+
+func TestWriteConflictString(t *testing.T) {
+	assert.Equal(t, "local-wins", WriteConflictLocalWins.String())
+	assert.Equal(t, "keep-both", WriteConflictKeepBoth.String())
+	assert.Equal(t, "WriteConflict", WriteConflictRemoteWins.Type())
+}
+
+func TestWriteConflictSet(t *testing.T) {
+	var c WriteConflict
+
+	assert.NoError(t, c.Set("remote-wins"))
+	assert.Equal(t, WriteConflictRemoteWins, c)
+
+	assert.NoError(t, json.Unmarshal([]byte(`"keep-both"`), &c))
+	assert.Equal(t, WriteConflictKeepBoth, c)
+
+	assert.Error(t, c.Set("potato"))
+}
@@ -29,6 +29,10 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.DurationVarP(flagSet, &Opt.CachePollInterval, "vfs-cache-poll-interval", "", Opt.CachePollInterval, "Interval to poll the cache for stale objects", "VFS")
 	flags.DurationVarP(flagSet, &Opt.CacheMaxAge, "vfs-cache-max-age", "", Opt.CacheMaxAge, "Max time since last access of objects in the cache", "VFS")
 	flags.FVarP(flagSet, &Opt.CacheMaxSize, "vfs-cache-max-size", "", "Max total size of objects in the cache", "VFS")
+	flags.FVarP(flagSet, &Opt.CacheEviction, "vfs-cache-eviction", "", "Order to remove files from the cache when over quota lru|lfu|arc|largest-first", "VFS")
+	flags.FVarP(flagSet, &Opt.CacheStorage, "vfs-cache-storage", "", "How to store cached data file|block", "VFS")
+	flags.FVarP(flagSet, &Opt.CacheBlockSize, "vfs-cache-block-size", "", "Size of the blocks with --vfs-cache-storage block", "VFS")
+	flags.BoolVarP(flagSet, &Opt.CacheShared, "vfs-cache-shared", "", Opt.CacheShared, "Share the cache directory with other rclone processes", "VFS")
 	flags.FVarP(flagSet, &Opt.CacheMinFreeSpace, "vfs-cache-min-free-space", "", "Target minimum free space on the disk containing the cache", "VFS")
 	flags.FVarP(flagSet, &Opt.ChunkSize, "vfs-read-chunk-size", "", "Read the source objects in chunks", "VFS")
 	flags.FVarP(flagSet, &Opt.ChunkSizeLimit, "vfs-read-chunk-size-limit", "", "If greater than --vfs-read-chunk-size, double the chunk size after each chunk read, until the limit is reached ('off' is unlimited)", "VFS")
@@ -38,6 +42,8 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.DurationVarP(flagSet, &Opt.WriteWait, "vfs-write-wait", "", Opt.WriteWait, "Time to wait for in-sequence write before giving error", "VFS")
 	flags.DurationVarP(flagSet, &Opt.ReadWait, "vfs-read-wait", "", Opt.ReadWait, "Time to wait for in-sequence read before seeking", "VFS")
 	flags.DurationVarP(flagSet, &Opt.WriteBack, "vfs-write-back", "", Opt.WriteBack, "Time to writeback files after last use when using cache", "VFS")
+	flags.FVarP(flagSet, &Opt.WriteConflict, "vfs-write-conflict", "", "What to do if the remote changed before writing back local-wins|remote-wins|keep-both", "VFS")
+	flags.StringVarP(flagSet, &Opt.ConflictSuffix, "vfs-conflict-suffix", "", Opt.ConflictSuffix, "Suffix for the local copy with --vfs-write-conflict keep-both", "VFS")
 	flags.FVarP(flagSet, &Opt.ReadAhead, "vfs-read-ahead", "", "Extra read ahead over --buffer-size when using cache-mode full", "VFS")
 	flags.BoolVarP(flagSet, &Opt.UsedIsSize, "vfs-used-is-size", "", Opt.UsedIsSize, "Use the `rclone size` algorithm for Used size", "VFS")
 	flags.BoolVarP(flagSet, &Opt.FastFingerprint, "vfs-fast-fingerprint", "", Opt.FastFingerprint, "Use fast (less accurate) fingerprints for change detection", "VFS")